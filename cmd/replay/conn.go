@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/recorder"
+	"xiaozhi-esp32-server-golang/internal/app/server/types"
+)
+
+// replayConn 按录制时间线向 ChatSession 投递上行信令与音频，并收集下行信令
+type replayConn struct {
+	deviceID string
+
+	cmdCh   chan []byte
+	audioCh chan []byte
+	closed  chan struct{}
+
+	mu       sync.Mutex
+	start    time.Time
+	sent     []recorder.Event
+	audioOut int
+	onClose  func(deviceId string)
+
+	closeOnce sync.Once
+}
+
+var _ types.IConn = (*replayConn)(nil)
+
+func newReplayConn(deviceID string) *replayConn {
+	return &replayConn{
+		deviceID: deviceID,
+		cmdCh:    make(chan []byte, 100),
+		audioCh:  make(chan []byte, 1000),
+		closed:   make(chan struct{}),
+		start:    time.Now(),
+	}
+}
+
+// feed 按录制偏移（除以 speed）依次投递上行事件，全部投递后返回
+func (c *replayConn) feed(ctx context.Context, events []recorder.Event, speed float64) {
+	c.mu.Lock()
+	c.start = time.Now()
+	c.mu.Unlock()
+	for _, e := range events {
+		var ch chan []byte
+		switch e.Kind {
+		case recorder.KindCmdIn:
+			ch = c.cmdCh
+		case recorder.KindAudioIn:
+			ch = c.audioCh
+		default:
+			continue
+		}
+		due := time.Duration(float64(e.Offset) / speed)
+		if wait := due - time.Since(c.start); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.closed:
+				return
+			case <-time.After(wait):
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.closed:
+			return
+		case ch <- e.Data:
+		}
+	}
+}
+
+// sentCommands 返回回放期间收集的下行信令
+func (c *replayConn) sentCommands() ([]recorder.Event, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]recorder.Event(nil), c.sent...), c.audioOut
+}
+
+func (c *replayConn) SendCmd(msg []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, recorder.Event{Kind: recorder.KindCmdOut, Offset: time.Since(c.start), Data: append([]byte(nil), msg...)})
+	return nil
+}
+
+func (c *replayConn) RecvCmd(ctx context.Context, timeout int) ([]byte, error) {
+	return c.recv(ctx, c.cmdCh, timeout)
+}
+
+func (c *replayConn) SendAudio(audio []byte) error {
+	c.mu.Lock()
+	c.audioOut++
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *replayConn) RecvAudio(ctx context.Context, timeout int) ([]byte, error) {
+	return c.recv(ctx, c.audioCh, timeout)
+}
+
+func (c *replayConn) recv(ctx context.Context, ch chan []byte, timeout int) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.closed:
+		return nil, errors.New("connection is closed")
+	case msg := <-ch:
+		return msg, nil
+	case <-time.After(time.Duration(timeout) * time.Second):
+		return nil, errors.New("timeout")
+	}
+}
+
+func (c *replayConn) GetDeviceID() string {
+	return c.deviceID
+}
+
+func (c *replayConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.mu.Lock()
+		onClose := c.onClose
+		c.mu.Unlock()
+		if onClose != nil {
+			onClose(c.deviceID)
+		}
+	})
+	return nil
+}
+
+func (c *replayConn) OnClose(fn func(deviceId string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onClose = fn
+}
+
+func (c *replayConn) CloseAudioChannel() error {
+	return nil
+}
+
+// GetTransportType 回放统一走 websocket 语义，mqtt_udp 录制的上行音频已是解密后的数据
+func (c *replayConn) GetTransportType() string {
+	return types.TransportTypeWebsocket
+}
+
+func (c *replayConn) GetData(key string) (interface{}, error) {
+	return nil, errors.New("not implemented")
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/chat"
+	"xiaozhi-esp32-server-golang/internal/app/server/recorder"
+	user_config "xiaozhi-esp32-server-golang/internal/domain/config"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// replay 将会话录制回放到全新的 ChatSession（ASR/LLM/TTS 使用 cmd/mock_ai_server），
+// 并与录制中的下行信令流逐条对比，存在差异时以退出码 1 结束。
+//
+//	go run ./cmd/mock_ai_server -addr :18080
+//	go run ./cmd/replay -c config/config.yaml -i recordings/xx.xzrec -mock http://127.0.0.1:18080
+func main() {
+	configFile := flag.String("c", "config/config.yaml", "服务端配置文件路径（资源池、VAD 等）")
+	input := flag.String("i", "", "录制文件路径")
+	mockAddr := flag.String("mock", "http://127.0.0.1:18080", "mock_ai_server 地址")
+	speed := flag.Float64("speed", 1.0, "回放速度倍数")
+	settle := flag.Duration("settle", 5*time.Second, "投递完上行事件后等待下行信令的时长")
+	verbose := flag.Bool("v", false, "输出服务端日志")
+	flag.Parse()
+
+	if *input == "" {
+		fmt.Fprintln(os.Stderr, "录制文件路径不能为空: -i <file>")
+		os.Exit(2)
+	}
+	if *speed <= 0 {
+		*speed = 1.0
+	}
+	if *verbose {
+		log.UseStdout()
+	} else {
+		log.SetOutput(os.Stderr)
+	}
+
+	changed, err := run(*configFile, *input, *mockAddr, *speed, *settle)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "回放失败: %v\n", err)
+		os.Exit(2)
+	}
+	if changed {
+		os.Exit(1)
+	}
+}
+
+func run(configFile, input, mockAddr string, speed float64, settle time.Duration) (bool, error) {
+	viper.SetConfigFile(configFile)
+	if err := viper.ReadInConfig(); err != nil {
+		return false, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	rec, err := recorder.ReadFile(input)
+	if err != nil {
+		return false, err
+	}
+	if rec.Config == nil {
+		return false, fmt.Errorf("录制文件中没有用户配置")
+	}
+	cfg, err := mockConfig(*rec.Config, mockAddr)
+	if err != nil {
+		return false, err
+	}
+
+	// 回放期间所有配置查询都返回录制时的配置
+	user_config.RegisterProvider(replayProviderType, &staticConfigProvider{config: cfg})
+	viper.Set("config_provider.type", replayProviderType)
+
+	conn := newReplayConn(rec.Meta.DeviceID)
+	manager, err := chat.NewChatManager(rec.Meta.DeviceID, conn)
+	if err != nil {
+		return false, fmt.Errorf("创建 ChatManager 失败: %w", err)
+	}
+	go func() {
+		if err := manager.Start(); err != nil {
+			log.Errorf("ChatManager 运行失败: %v", err)
+		}
+	}()
+
+	ctx := context.Background()
+	conn.feed(ctx, rec.Events, speed)
+	time.Sleep(settle)
+	manager.Close()
+	conn.Close()
+
+	sent, audioFrames := conn.sentCommands()
+	want := recorder.Signatures(rec.Events, recorder.KindCmdOut)
+	got := recorder.Signatures(sent, recorder.KindCmdOut)
+	lines, changed := recorder.Diff(want, got)
+
+	fmt.Printf("录制: %s (device=%s transport=%s started_at=%s)\n", input, rec.Meta.DeviceID, rec.Meta.Transport, rec.Meta.StartedAt.Format(time.RFC3339))
+	fmt.Printf("下行信令: 录制 %d 条, 回放 %d 条; 下行音频帧: 录制 %d, 回放 %d\n", len(want), len(got), countKind(rec.Events, recorder.KindAudioOut), audioFrames)
+	fmt.Println("--- recorded")
+	fmt.Println("+++ replayed")
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	if changed {
+		fmt.Println("结果: 信令流存在差异")
+	} else {
+		fmt.Println("结果: 信令流一致")
+	}
+	return changed, nil
+}
+
+func countKind(events []recorder.Event, kind recorder.Kind) int {
+	n := 0
+	for _, e := range events {
+		if e.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
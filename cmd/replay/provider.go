@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+
+	"xiaozhi-esp32-server-golang/constants"
+	"xiaozhi-esp32-server-golang/internal/data/client"
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+)
+
+const replayProviderType = "replay"
+
+// staticConfigProvider 始终返回录制时的用户配置，其余能力为空实现
+type staticConfigProvider struct {
+	config types.UConfig
+}
+
+func (p *staticConfigProvider) IsDeviceActivated(ctx context.Context, deviceId string, clientId string) (bool, error) {
+	return true, nil
+}
+
+func (p *staticConfigProvider) GetActivationInfo(ctx context.Context, deviceId string, clientId string) (string, string, string, int) {
+	return "", "", "", 0
+}
+
+func (p *staticConfigProvider) VerifyChallenge(ctx context.Context, deviceId string, clientId string, activationPayload types.ActivationPayload) (bool, error) {
+	return true, nil
+}
+
+func (p *staticConfigProvider) GetUserConfig(ctx context.Context, userID string) (types.UConfig, error) {
+	return p.config, nil
+}
+
+func (p *staticConfigProvider) SwitchDeviceRoleByName(ctx context.Context, deviceID string, roleName string) (string, error) {
+	return "", errors.New("回放模式不支持切换角色")
+}
+
+func (p *staticConfigProvider) RestoreDeviceDefaultRole(ctx context.Context, deviceID string) error {
+	return errors.New("回放模式不支持恢复默认角色")
+}
+
+func (p *staticConfigProvider) GetAgentConfig(ctx context.Context, deviceID string, agentName string) (types.UConfig, error) {
+	return types.UConfig{}, errors.New("回放模式不支持多智能体转接")
+}
+
+func (p *staticConfigProvider) GetSystemConfig(ctx context.Context) (string, error) {
+	return "", nil
+}
+
+func (p *staticConfigProvider) NotifyDeviceEvent(ctx context.Context, eventType string, eventData map[string]interface{}) {
+}
+
+func (p *staticConfigProvider) RegisterMessageEventHandler(ctx context.Context, eventType string, eventHandler types.EventHandler) {
+}
+
+// mockConfig 将录制配置中的 ASR/LLM/TTS 指向 mock_ai_server，并关闭记忆、声纹、知识库等外部依赖；
+// VAD 在本地运行，保持录制时的配置
+func mockConfig(cfg types.UConfig, mockAddr string) (types.UConfig, error) {
+	base, err := url.Parse(mockAddr)
+	if err != nil || base.Host == "" {
+		return cfg, errors.New("mock 地址格式错误，应为 http://host:port")
+	}
+	host, port, err := net.SplitHostPort(base.Host)
+	if err != nil {
+		return cfg, err
+	}
+	httpBase := base.Scheme + "://" + base.Host
+
+	cfg.Asr = types.AsrConfig{
+		Provider: constants.AsrTypeFunAsr,
+		Config: map[string]interface{}{
+			"provider": constants.AsrTypeFunAsr,
+			"host":     host,
+			"port":     port,
+		},
+	}
+	cfg.Llm = types.LlmConfig{
+		Provider: constants.LlmTypeOpenai,
+		Config: map[string]interface{}{
+			"provider":   constants.LlmTypeOpenai,
+			"type":       constants.LlmTypeOpenai,
+			"base_url":   httpBase + "/v1",
+			"api_key":    "mock",
+			"model_name": "mock-gpt",
+		},
+	}
+	cfg.Tts = types.TtsConfig{
+		Provider: constants.TtsTypeOpenAI,
+		Config: map[string]interface{}{
+			"provider":        constants.TtsTypeOpenAI,
+			"api_url":         httpBase + "/v1/audio/speech",
+			"api_key":         "mock",
+			"model":           "tts-1",
+			"voice":           "alloy",
+			"response_format": "wav",
+		},
+	}
+	cfg.MemoryMode = client.MemoryModeNone
+	cfg.VoiceIdentify = nil
+	cfg.KnowledgeBases = nil
+	cfg.OpenClaw.Allowed = false
+	return cfg, nil
+}
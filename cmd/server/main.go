@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -10,8 +11,10 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 	"xiaozhi-esp32-server-golang/internal/app/server"
 	user_config "xiaozhi-esp32-server-golang/internal/domain/config"
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
 	log "xiaozhi-esp32-server-golang/logger"
 
 	"github.com/spf13/viper"
@@ -43,6 +46,13 @@ func main() {
 		return
 	}
 
+	// 初始化链路追踪（tracing.enable 为 false 时仅设置传播器）
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.ConfigFromViper())
+	if err != nil {
+		log.Errorf("初始化链路追踪失败: %v", err)
+		shutdownTracing = func(context.Context) error { return nil }
+	}
+
 	// 根据配置启动 pprof 服务
 	if viper.GetBool("server.pprof.enable") {
 		pprofPort := viper.GetInt("server.pprof.port")
@@ -147,6 +157,13 @@ func main() {
 		StopAsrServerHTTP()
 	}
 
+	// 刷新尚未导出的 span
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Warnf("关闭链路追踪失败: %v", err)
+	}
+	cancel()
+
 	log.Info("服务器已关闭")
 }
 
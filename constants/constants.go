@@ -12,15 +12,18 @@ const (
 	AsrTypeAliyunFunASR = "aliyun_funasr"
 	AsrTypeAliyunQwen3  = "aliyun_qwen3"
 	AsrTypeXunfei       = "xunfei"
+	AsrTypeOpenAI       = "openai"
 )
 
 const (
-	LlmTypeOpenai  = "openai"
-	LlmTypeOllama  = "ollama"
-	LlmTypeEinoLLM = "eino_llm"
-	LlmTypeEino    = "eino"
-	LlmTypeDify    = "dify"
-	LlmTypeCoze    = "coze"
+	LlmTypeOpenai    = "openai"
+	LlmTypeOllama    = "ollama"
+	LlmTypeEinoLLM   = "eino_llm"
+	LlmTypeEino      = "eino"
+	LlmTypeDify      = "dify"
+	LlmTypeCoze      = "coze"
+	LlmTypeAnthropic = "anthropic"
+	LlmTypeGemini    = "gemini"
 )
 
 const (
@@ -10,8 +10,10 @@ import (
 	"xiaozhi-esp32-server-golang/internal/app/mqtt_server"
 	"xiaozhi-esp32-server-golang/internal/app/server/chat"
 	"xiaozhi-esp32-server-golang/internal/app/server/mqtt_udp"
+	"xiaozhi-esp32-server-golang/internal/app/server/recorder"
 	"xiaozhi-esp32-server-golang/internal/app/server/types"
 	"xiaozhi-esp32-server-golang/internal/app/server/websocket"
+	"xiaozhi-esp32-server-golang/internal/data/experiment"
 	"xiaozhi-esp32-server-golang/internal/data/history"
 	user_config "xiaozhi-esp32-server-golang/internal/domain/config"
 	config_types "xiaozhi-esp32-server-golang/internal/domain/config/types"
@@ -51,6 +53,7 @@ func NewApp() *App {
 }
 
 func (a *App) Run() {
+	a.registerMetrics()
 	go a.wsServer.Start()
 	log.Infof("enter Run, mqtt_server.enable: %v", viper.GetBool("mqtt_server.enable"))
 	if viper.GetBool("mqtt_server.enable") {
@@ -82,6 +85,9 @@ func (a *App) Run() {
 	// 启动资源池统计上报（每5秒上报一次到 manager backend）
 	pool.StartStatsReporter(ctx)
 
+	// 启动 A/B 实验轮次上报（仅参与实验的设备产生数据）
+	experiment.StartReporter(ctx)
+
 	select {} // 阻塞主线程
 }
 
@@ -294,12 +300,18 @@ func (a *App) OnNewConnection(transport types.IConn) {
 		a.chatManagers.Remove(deviceID)
 	}
 
+	// 按配置开启会话录制，用于现场问题复现
+	transport = a.maybeRecordConn(transport)
+
 	// 创建新的ChatManager
 	chatManager, err := chat.NewChatManager(deviceID, transport)
 	if err != nil {
 		log.Errorf("创建chatManager失败: %v", err)
 		return
 	}
+	if recorded, ok := transport.(*recorder.Conn); ok {
+		recorded.SetConfig(chatManager.GetClientState().DeviceConfig)
+	}
 
 	// 存储ChatManager
 	a.chatManagers.Set(deviceID, chatManager)
@@ -328,6 +340,20 @@ func (a *App) OnNewConnection(transport types.IConn) {
 	}()
 }
 
+// maybeRecordConn 按 recorder 配置为连接包一层会话录制，失败时回退为原连接
+func (a *App) maybeRecordConn(transport types.IConn) types.IConn {
+	opts, ok := recorder.OptionsFromViper()
+	if !ok || !opts.ShouldRecord(transport.GetDeviceID()) {
+		return transport
+	}
+	recorded, err := recorder.Wrap(transport, opts)
+	if err != nil {
+		log.Warnf("设备 %s 开启会话录制失败: %v", transport.GetDeviceID(), err)
+		return transport
+	}
+	return recorded
+}
+
 // OnOpenClawResponse OpenClaw实时响应下发回调
 func (a *App) OnOpenClawResponse(event openclaw.ResponseDelivery) bool {
 	deviceID := strings.TrimSpace(event.DeviceID)
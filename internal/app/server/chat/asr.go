@@ -63,6 +63,14 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 			log.Errorf("获取解码器失败: %v", err)
 			return
 		}
+		// 上行音频前端处理（高通/降噪/去混响/AGC），在 VAD 与 ASR 之前作用于解码后的 PCM
+		audioFrontend := newAudioFrontend(state, audioFormat.SampleRate, audioFormat.Channels)
+		defer reportAudioFrontend(state, audioFrontend)
+		// 语义断句：按识别文本为每句话计算等待时长，未启用时使用固定静音阈值
+		endOfTurn := newEndOfTurnDetector(state)
+		if endOfTurn != nil {
+			defer endOfTurn.Reset()
+		}
 
 		// 从第一帧实际数据中获取帧大小和帧时长
 		var frameSize int
@@ -181,6 +189,7 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 
 				var vadPcmData []float32
 				pcmData := pcmFrame[:n]
+				audioFrontend.Process(pcmData)
 
 				// 检查帧大小是否一致（正常情况下应该一致，但不一致时使用实际值）
 				if n != frameSize {
@@ -232,6 +241,7 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 							//首次检测到语音时，最多只保留200ms的前静音数据
 							allData := state.AsrAudioBuffer.GetAndClearAllData()
 							pcmData = allData
+							a.session.startVadSegmentSpan()
 						}
 					}
 					//log.Debugf("isVad, pcmData len: %d, vadPcmData len: %d, haveVoice: %v", len(pcmData), len(vadPcmData), haveVoice)
@@ -324,6 +334,7 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 					if voiceDurationInSession < 100 {
 						log.Debugf("语音时长过短 (%dms < 300ms)，重置clientHaveVoice", voiceDurationInSession)
 						state.SetClientHaveVoice(false)
+						a.session.endVadSegmentSpan(true)
 						state.Vad.ResetVoiceDuration()
 						continue
 					}
@@ -359,7 +370,24 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 						continue
 					}
 
-					if state.IsSilence(idleDuration) { //从有声音到 静默的判断
+					isSilence := state.IsSilence(idleDuration)
+					if endOfTurn != nil {
+						decision := endOfTurn.Evaluate(ctx, state.Asr.GetPartialText(), time.Duration(idleDuration)*time.Millisecond)
+						isSilence = decision.End
+						if isSilence {
+							log.Debugf(
+								"语义断句判定说完: text=%s, reason=%s, source=%s, wait=%v, silence=%v",
+								decision.Text,
+								decision.Reason,
+								decision.Source,
+								decision.Wait,
+								decision.Silence,
+							)
+							a.session.recordEndOfTurn(ctx, decision)
+							endOfTurn.Reset()
+						}
+					}
+					if isSilence { //从有声音到 静默的判断
 						log.Debugf(
 							"判定语音结束，准备停止ASR: status=%s, idle=%dms, voice_duration=%dms, voice_duration_in_session=%dms, history_audio_samples=%d, pending_restart=%v",
 							state.Status,
@@ -371,6 +399,7 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 						// 在 OnVoiceSilence 之前重置标志位，以便下次可以再次触发
 						hasTriggeredCancel = false
 						state.OnVoiceSilence()
+						a.session.endVadSegmentSpan(false)
 						state.VoiceStatus.Reset()
 						continue
 					}
@@ -610,6 +639,7 @@ func (a *ASRManager) StartAsrRecognitionLoop(
 
 				//当获取到asr结果时, 结束语音输入（OnVoiceSilence 中会异步获取声纹结果）
 				state.OnVoiceSilence()
+				a.session.endVadSegmentSpan(false)
 
 				// 获取暂存的声纹结果（带超时）
 				speakerResult := a.getSpeakerResult()
@@ -0,0 +1,44 @@
+package chat
+
+import (
+	"strings"
+
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+	"xiaozhi-esp32-server-golang/internal/domain/audio/dsp"
+	"xiaozhi-esp32-server-golang/internal/pkg/metrics"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// newAudioFrontend 按全局 audio_frontend 与智能体配置创建上行音频前端处理链，未启用时返回 nil。
+// 处理链只支持单声道，多声道输入直接跳过
+func newAudioFrontend(state *ClientState, sampleRate, channels int) *dsp.Chain {
+	conf := dsp.ConfigFromMap(state.DeviceConfig.AudioFrontend)
+	if !conf.Enabled {
+		return nil
+	}
+	if err := conf.Validate(); err != nil {
+		log.Warnf("音频前端处理配置无效，已跳过: device=%s, error=%v", state.DeviceID, err)
+		return nil
+	}
+	if channels != 1 {
+		log.Warnf("音频前端处理仅支持单声道，已跳过: device=%s, channels=%d", state.DeviceID, channels)
+		return nil
+	}
+	chain := dsp.NewChain(sampleRate, conf)
+	if chain == nil {
+		return nil
+	}
+	log.Debugf("启用音频前端处理: device=%s, stages=%s, latency=%v", state.DeviceID, strings.Join(chain.Stages(), ","), chain.Latency())
+	return chain
+}
+
+// reportAudioFrontend 会话音频处理结束时上报各级耗时与直通情况
+func reportAudioFrontend(state *ClientState, chain *dsp.Chain) {
+	for _, s := range chain.Stats() {
+		metrics.ObserveAudioFrontend(s.Name, s.Cost, s.Frames+s.BypassedFrames, s.BypassedFrames)
+		if s.BypassEvents > 0 {
+			log.Infof("音频前端处理超出 CPU 预算: device=%s, stage=%s, bypass_events=%d, bypassed_frames=%d, frames=%d",
+				state.DeviceID, s.Name, s.BypassEvents, s.BypassedFrames, s.Frames)
+		}
+	}
+}
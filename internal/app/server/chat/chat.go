@@ -119,6 +119,7 @@ func NewChatManager(deviceID string, transport types_conn.IConn, options ...Chat
 	if !viper.IsSet("chat_hooks.enabled") || viper.GetBool("chat_hooks.enabled") {
 		if err := chathooks.RegisterBuiltinPlugins(hookHub, chatHookBuiltinOverrides()); err != nil {
 			log.Errorf("注册 chat hook builtin plugins 失败: %v", err)
+			hookHub.Close()
 			cm.transport.Close()
 			return nil, err
 		}
@@ -221,6 +222,9 @@ func (c *ChatManager) ReloadDeviceConfig(ctx context.Context) error {
 		return fmt.Errorf("获取设备配置失败: %w", err)
 	}
 	deviceConfig.MemoryMode = NormalizeMemoryMode(deviceConfig.MemoryMode)
+	if c.session != nil {
+		c.session.exitHandoff("reload")
+	}
 
 	oldAgentID := c.clientState.AgentID
 	c.clientState.AgentID = deviceConfig.AgentId
@@ -282,6 +286,14 @@ func (c *ChatManager) GetDeviceId() string {
 	return c.clientState.DeviceID
 }
 
+// GetTransportType 获取连接的传输类型（websocket/udp）
+func (c *ChatManager) GetTransportType() string {
+	if c.transport == nil {
+		return ""
+	}
+	return c.transport.GetTransportType()
+}
+
 // GetSession 获取 ChatSession
 func (c *ChatManager) GetSession() *ChatSession {
 	return c.session
@@ -0,0 +1,52 @@
+package chat
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+	chathooks "xiaozhi-esp32-server-golang/internal/domain/chat/hooks"
+	"xiaozhi-esp32-server-golang/internal/domain/turn"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// newEndOfTurnDetector 按 chat.end_of_turn 配置创建语义断句器，未启用时返回 nil，沿用固定静音阈值。
+// 基础等待时长取会话的静音阈值（chat.chat_max_silence_duration），并按智能体的 asr_speed 缩放
+func newEndOfTurnDetector(state *ClientState) *turn.Detector {
+	baseWait := time.Duration(state.VoiceStatus.SilenceThresholdTime) * time.Millisecond
+	conf := turn.ConfigFromViper(baseWait, state.DeviceConfig.AsrSpeed)
+	if !conf.Enabled {
+		return nil
+	}
+	classifier := turn.DefaultClassifier()
+	log.Debugf("启用语义断句: device=%s, base=%v, min=%v, max=%v, speed=%s, classifier=%v",
+		state.DeviceID, conf.BaseWait, conf.MinWait, conf.MaxWait, conf.Speed, classifier != nil)
+	return turn.NewDetector(conf, classifier)
+}
+
+// recordEndOfTurn 把断句判定写入本轮指标与 VAD 片段 span
+func (s *ChatSession) recordEndOfTurn(ctx context.Context, decision turn.Decision) {
+	if s == nil {
+		return
+	}
+	s.annotateVadSegmentSpan(
+		attribute.String("eot.reason", decision.Reason),
+		attribute.String("eot.source", decision.Source),
+		attribute.Int64("eot.wait_ms", decision.Wait.Milliseconds()),
+	)
+	data := chathooks.MetricData{
+		Stage: chathooks.MetricEndOfTurn,
+		Ts:    time.Now().UnixMilli(),
+		EndOfTurn: &chathooks.EndOfTurn{
+			Reason:  decision.Reason,
+			Source:  decision.Source,
+			Wait:    decision.Wait.Milliseconds(),
+			Silence: decision.Silence.Milliseconds(),
+		},
+	}
+	if err := s.hookHub.EmitMetric(s.hookContext(ctx), data); err != nil {
+		log.Warnf("METRIC hook 执行失败: stage=%s err=%v", data.Stage, err)
+	}
+}
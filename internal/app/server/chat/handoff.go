@@ -0,0 +1,309 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/spf13/viper"
+
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+	user_config "xiaozhi-esp32-server-golang/internal/domain/config"
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// 多智能体转接（handoff）：当前智能体把对话临时交给同一用户下的其它智能体（使用其 LLM、TTS、工具与知识库），
+// 完成本次请求或用户说出返回关键词后切回原智能体。ASR/VAD/记忆/声纹属于设备维度，转接期间沿用原会话配置。
+
+const (
+	// HandoffHistoryShared 目标智能体共享当前对话历史
+	HandoffHistoryShared = "shared"
+	// HandoffHistoryIsolated 目标智能体使用独立历史，返回后丢弃
+	HandoffHistoryIsolated = "isolated"
+)
+
+var defaultHandoffReturnKeywords = []string{"返回原助手", "回到原助手", "切换回来"}
+
+// HandoffRoute 路由规则：用户原话命中关键词时不经 LLM 判断直接转接
+type HandoffRoute struct {
+	AgentName string   `mapstructure:"agent_name"`
+	Keywords  []string `mapstructure:"keywords"`
+	// Stay 为 true 时转接后持续由目标智能体对话，否则完成本次请求后自动返回
+	Stay bool `mapstructure:"stay"`
+}
+
+type handoffConfig struct {
+	HistoryPolicy  string
+	Announce       bool
+	ReturnKeywords []string
+	Routes         []HandoffRoute
+}
+
+func handoffConfigFromViper() handoffConfig {
+	cfg := handoffConfig{
+		HistoryPolicy:  HandoffHistoryShared,
+		Announce:       !viper.IsSet("agent_handoff.announce") || viper.GetBool("agent_handoff.announce"),
+		ReturnKeywords: viper.GetStringSlice("agent_handoff.return_keywords"),
+	}
+	if strings.EqualFold(strings.TrimSpace(viper.GetString("agent_handoff.history_policy")), HandoffHistoryIsolated) {
+		cfg.HistoryPolicy = HandoffHistoryIsolated
+	}
+	if len(cfg.ReturnKeywords) == 0 {
+		cfg.ReturnKeywords = defaultHandoffReturnKeywords
+	}
+	if err := viper.UnmarshalKey("agent_handoff.routes", &cfg.Routes); err != nil {
+		log.Warnf("解析 agent_handoff.routes 失败: %v", err)
+	}
+	return cfg
+}
+
+// handoffState 记录转接前的原智能体上下文，用于返回时恢复
+type handoffState struct {
+	mu sync.Mutex
+
+	active     bool
+	stay       bool
+	policy     string
+	targetName string
+
+	originAgentID  string
+	originConfig   types.UConfig
+	originPrompt   string
+	originDialogue *Dialogue // 仅 isolated 模式下保存
+
+	// announcement 待播报的转接提示，在下一次 LLM 输出前插入
+	announcement string
+}
+
+func agentDisplayName(cfg types.UConfig, fallback string) string {
+	if name := strings.TrimSpace(cfg.AgentName); name != "" {
+		return name
+	}
+	if fallback = strings.TrimSpace(fallback); fallback != "" {
+		return fallback
+	}
+	return "原助手"
+}
+
+// lastUserMessageText 返回对话历史中最近一条用户消息
+func lastUserMessageText(clientState *ClientState) string {
+	messages := clientState.GetMessages(MaxMessageCount)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i] != nil && messages[i].Role == schema.User {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
+
+// IsHandoffActive 当前是否处于转接状态
+func (s *ChatSession) IsHandoffActive() bool {
+	s.handoff.mu.Lock()
+	defer s.handoff.mu.Unlock()
+	return s.handoff.active
+}
+
+// enterHandoff 加载目标智能体配置并切换到转接子上下文，返回目标智能体名称
+func (s *ChatSession) enterHandoff(ctx context.Context, agentName string, request string, stay bool) (string, error) {
+	agentName = strings.TrimSpace(agentName)
+	if agentName == "" {
+		return "", fmt.Errorf("agent_name 不能为空")
+	}
+
+	configProvider, err := user_config.GetProvider(viper.GetString("config_provider.type"))
+	if err != nil {
+		return "", fmt.Errorf("获取配置提供者失败: %w", err)
+	}
+	targetConfig, err := configProvider.GetAgentConfig(ctx, s.clientState.DeviceID, agentName)
+	if err != nil {
+		return "", err
+	}
+
+	cfg := handoffConfigFromViper()
+	h := &s.handoff
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	clientState := s.clientState
+	if h.active {
+		if targetConfig.AgentId != "" && targetConfig.AgentId == clientState.AgentID {
+			h.stay = h.stay || stay
+			return h.targetName, nil
+		}
+		// 不支持嵌套转接，先回到原智能体再转接到新的目标
+		s.restoreHandoffLocked()
+	}
+	if targetConfig.AgentId != "" && targetConfig.AgentId == clientState.AgentID {
+		return "", fmt.Errorf("%s 就是当前智能体，无需转接", agentDisplayName(targetConfig, agentName))
+	}
+
+	origin := clientState.DeviceConfig
+	targetConfig.Asr = origin.Asr
+	targetConfig.Vad = origin.Vad
+	targetConfig.Memory = origin.Memory
+	targetConfig.MemoryMode = origin.MemoryMode
+	targetConfig.VoiceIdentify = origin.VoiceIdentify
+	// OpenClaw 模式按智能体维护，子上下文中不启用
+	targetConfig.OpenClaw = types.OpenClawConfig{}
+
+	h.active = true
+	h.stay = stay
+	h.policy = cfg.HistoryPolicy
+	h.targetName = agentDisplayName(targetConfig, agentName)
+	h.originAgentID = clientState.AgentID
+	h.originConfig = origin
+	h.originPrompt = clientState.SystemPrompt
+	h.originDialogue = nil
+
+	if h.policy == HandoffHistoryIsolated {
+		request = strings.TrimSpace(request)
+		if request == "" {
+			request = lastUserMessageText(clientState)
+		}
+		h.originDialogue = clientState.Dialogue
+		clientState.Dialogue = &Dialogue{}
+		if request != "" {
+			clientState.AddMessage(schema.UserMessage(request))
+		}
+	}
+
+	clientState.AgentID = targetConfig.AgentId
+	clientState.DeviceConfig = targetConfig
+	clientState.SystemPrompt = targetConfig.SystemPrompt
+	clientState.SpeakerTTSConfig = nil
+	applyOutputAudioFormatForTTS(clientState)
+
+	h.announcement = ""
+	if cfg.Announce {
+		h.announcement = fmt.Sprintf("好的，已为您转接%s。", h.targetName)
+	}
+
+	log.Infof("设备 %s 转接智能体: %s(%s) -> %s(%s), history=%s, stay=%v",
+		clientState.DeviceID, agentDisplayName(origin, h.originAgentID), h.originAgentID, h.targetName, targetConfig.AgentId, h.policy, stay)
+	return h.targetName, nil
+}
+
+// exitHandoff 结束转接并恢复原智能体，返回原智能体名称；未处于转接状态时返回 false
+func (s *ChatSession) exitHandoff(reason string) (string, bool) {
+	h := &s.handoff
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.active {
+		return "", false
+	}
+	targetName := h.targetName
+	originName := s.restoreHandoffLocked()
+	log.Infof("设备 %s 结束智能体转接: %s -> %s, reason=%s", s.clientState.DeviceID, targetName, originName, reason)
+	return originName, true
+}
+
+// restoreHandoffLocked 恢复原智能体配置与对话历史，调用方需持有 h.mu
+func (s *ChatSession) restoreHandoffLocked() string {
+	h := &s.handoff
+	clientState := s.clientState
+
+	if h.originDialogue != nil {
+		clientState.Dialogue = h.originDialogue
+		// 独立历史模式下在原历史中留一条说明，保持上下文连贯
+		clientState.AddMessage(schema.AssistantMessage(fmt.Sprintf("（本次请求已由%s处理）", h.targetName), nil))
+	}
+	clientState.AgentID = h.originAgentID
+	clientState.DeviceConfig = h.originConfig
+	clientState.SystemPrompt = h.originPrompt
+	clientState.SpeakerTTSConfig = nil
+	applyOutputAudioFormatForTTS(clientState)
+
+	originName := agentDisplayName(h.originConfig, "")
+	h.active = false
+	h.stay = false
+	h.targetName = ""
+	h.originAgentID = ""
+	h.originConfig = types.UConfig{}
+	h.originPrompt = ""
+	h.originDialogue = nil
+	h.announcement = ""
+	return originName
+}
+
+// finishHandoffTurn 一轮对话结束后调用，非 stay 模式的转接在完成本次请求后自动返回
+func (s *ChatSession) finishHandoffTurn() {
+	s.handoff.mu.Lock()
+	autoReturn := s.handoff.active && !s.handoff.stay
+	s.handoff.mu.Unlock()
+	if autoReturn {
+		s.exitHandoff("completed")
+	}
+}
+
+// takeHandoffAnnouncement 取出待播报的转接提示
+func (s *ChatSession) takeHandoffAnnouncement() string {
+	s.handoff.mu.Lock()
+	defer s.handoff.mu.Unlock()
+	announcement := s.handoff.announcement
+	s.handoff.announcement = ""
+	return announcement
+}
+
+func (s *ChatSession) setHandoffAnnouncement(text string) {
+	if !handoffConfigFromViper().Announce {
+		return
+	}
+	s.handoff.mu.Lock()
+	defer s.handoff.mu.Unlock()
+	s.handoff.announcement = text
+}
+
+// routeHandoff 是 LLM 之前的转接路由阶段：
+// 转接中命中返回关键词时切回原智能体并结束本轮；未转接时命中路由关键词则转接后继续由目标智能体处理。
+// 返回 true 表示本轮已处理完毕，不再请求 LLM。
+func (s *ChatSession) routeHandoff(ctx context.Context, text string) bool {
+	cfg := handoffConfigFromViper()
+	if s.IsHandoffActive() {
+		if !containsOpenClawKeyword(text, cfg.ReturnKeywords) {
+			return false
+		}
+		originName, ok := s.exitHandoff("keyword")
+		if ok && cfg.Announce {
+			_ = s.AddTextToTTSQueue(fmt.Sprintf("已回到%s", originName))
+		}
+		return ok
+	}
+
+	for _, route := range cfg.Routes {
+		if strings.TrimSpace(route.AgentName) == "" || !containsOpenClawKeyword(text, route.Keywords) {
+			continue
+		}
+		if _, err := s.enterHandoff(ctx, route.AgentName, text, route.Stay); err != nil {
+			log.Warnf("设备 %s 按路由规则转接智能体 %s 失败: %v", s.clientState.DeviceID, route.AgentName, err)
+		}
+		break
+	}
+	return false
+}
+
+// continueAfterHandoff 转接/返回后按当前智能体重新获取工具列表，继续本轮 LLM 请求
+func (s *ChatSession) continueAfterHandoff(ctx context.Context) error {
+	return s.llmManager.DoLLmRequest(ctx, nil, s.buildEinoTools(ctx), true, nil)
+}
+
+// prependLLMResponseText 在 LLM 输出前插入一段固定文本（作为首包），用于转接播报
+func prependLLMResponseText(ctx context.Context, text string, responseChan chan llm_common.LLMResponseStruct) chan llm_common.LLMResponseStruct {
+	out := make(chan llm_common.LLMResponseStruct, cap(responseChan)+1)
+	out <- llm_common.LLMResponseStruct{Text: text, IsStart: true}
+	go func() {
+		defer close(out)
+		for resp := range responseChan {
+			resp.IsStart = false
+			select {
+			case <-ctx.Done():
+				return
+			case out <- resp:
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,158 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/spf13/viper"
+
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+	user_config "xiaozhi-esp32-server-golang/internal/domain/config"
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
+)
+
+type handoffTestProvider struct {
+	user_config.UserConfigProvider
+	agents map[string]types.UConfig
+}
+
+func (p *handoffTestProvider) GetAgentConfig(ctx context.Context, deviceID string, agentName string) (types.UConfig, error) {
+	cfg, ok := p.agents[agentName]
+	if !ok {
+		return types.UConfig{}, errors.New("未找到匹配的智能体")
+	}
+	return cfg, nil
+}
+
+func newHandoffTestSession(t *testing.T, policy string) *ChatSession {
+	t.Helper()
+	user_config.RegisterProvider("handoff_test", &handoffTestProvider{agents: map[string]types.UConfig{
+		"家居": {
+			AgentId:      "2",
+			AgentName:    "家居控制",
+			SystemPrompt: "你是家居控制助手",
+			Llm:          types.LlmConfig{Provider: "home-llm"},
+			Asr:          types.AsrConfig{Provider: "other-asr"},
+		},
+	}})
+	viper.Set("config_provider.type", "handoff_test")
+	viper.Set("agent_handoff.history_policy", policy)
+	t.Cleanup(func() {
+		viper.Set("config_provider.type", nil)
+		viper.Set("agent_handoff.history_policy", nil)
+	})
+
+	state := &ClientState{
+		DeviceID:     "dev-1",
+		AgentID:      "1",
+		SystemPrompt: "你是小智",
+		Dialogue:     &Dialogue{},
+		DeviceConfig: types.UConfig{
+			AgentId:   "1",
+			AgentName: "小智",
+			Llm:       types.LlmConfig{Provider: "main-llm"},
+			Asr:       types.AsrConfig{Provider: "funasr"},
+		},
+	}
+	state.AddMessage(schema.UserMessage("帮我把客厅灯打开"))
+	return &ChatSession{clientState: state}
+}
+
+func TestHandoffIsolatedHistoryRestoresOrigin(t *testing.T) {
+	s := newHandoffTestSession(t, HandoffHistoryIsolated)
+
+	name, err := s.enterHandoff(context.Background(), "家居", "", false)
+	if err != nil {
+		t.Fatalf("enterHandoff: %v", err)
+	}
+	if name != "家居控制" || !s.IsHandoffActive() {
+		t.Fatalf("expected handoff to 家居控制, got %q active=%v", name, s.IsHandoffActive())
+	}
+	state := s.clientState
+	if state.AgentID != "2" || state.DeviceConfig.Llm.Provider != "home-llm" || state.SystemPrompt != "你是家居控制助手" {
+		t.Fatalf("expected target agent config to be applied, got agent=%s llm=%s", state.AgentID, state.DeviceConfig.Llm.Provider)
+	}
+	if state.DeviceConfig.Asr.Provider != "funasr" {
+		t.Fatalf("expected device ASR to be kept, got %s", state.DeviceConfig.Asr.Provider)
+	}
+	messages := state.GetMessages(10)
+	if len(messages) != 1 || messages[0].Content != "帮我把客厅灯打开" {
+		t.Fatalf("expected isolated history seeded with the request, got %+v", messages)
+	}
+	if s.takeHandoffAnnouncement() == "" || s.takeHandoffAnnouncement() != "" {
+		t.Fatal("expected announcement to be taken exactly once")
+	}
+
+	state.AddMessage(schema.AssistantMessage("客厅灯已打开", nil))
+	s.finishHandoffTurn()
+
+	if s.IsHandoffActive() {
+		t.Fatal("expected one-shot handoff to return after the turn")
+	}
+	if state.AgentID != "1" || state.DeviceConfig.Llm.Provider != "main-llm" || state.SystemPrompt != "你是小智" {
+		t.Fatalf("expected origin config to be restored, got agent=%s llm=%s", state.AgentID, state.DeviceConfig.Llm.Provider)
+	}
+	messages = state.GetMessages(10)
+	if len(messages) != 2 || messages[0].Content != "帮我把客厅灯打开" || messages[1].Role != schema.Assistant {
+		t.Fatalf("expected origin history plus a handoff note, got %+v", messages)
+	}
+}
+
+func TestHandoffStayReturnsOnKeyword(t *testing.T) {
+	s := newHandoffTestSession(t, HandoffHistoryShared)
+
+	if _, err := s.enterHandoff(context.Background(), "家居", "", true); err != nil {
+		t.Fatalf("enterHandoff: %v", err)
+	}
+	s.finishHandoffTurn()
+	if !s.IsHandoffActive() {
+		t.Fatal("expected stay handoff to survive the turn")
+	}
+	if len(s.clientState.GetMessages(10)) != 1 {
+		t.Fatal("expected shared history to be kept as is")
+	}
+
+	viper.Set("agent_handoff.announce", false)
+	defer viper.Set("agent_handoff.announce", nil)
+	if !s.routeHandoff(context.Background(), "好了，回到原助手吧") {
+		t.Fatal("expected return keyword to be handled")
+	}
+	if s.IsHandoffActive() || s.clientState.AgentID != "1" {
+		t.Fatal("expected origin agent after return keyword")
+	}
+	if s.routeHandoff(context.Background(), "回到原助手") {
+		t.Fatal("expected return keyword to be ignored outside handoff")
+	}
+}
+
+func TestHandoffUnknownAgentKeepsCurrentAgent(t *testing.T) {
+	s := newHandoffTestSession(t, HandoffHistoryShared)
+
+	if _, err := s.enterHandoff(context.Background(), "不存在", "", false); err == nil {
+		t.Fatal("expected error for unknown agent")
+	}
+	if s.IsHandoffActive() || s.clientState.AgentID != "1" {
+		t.Fatal("expected current agent to be kept")
+	}
+}
+
+func TestPrependLLMResponseText(t *testing.T) {
+	in := make(chan llm_common.LLMResponseStruct, 2)
+	in <- llm_common.LLMResponseStruct{Text: "灯已打开", IsStart: true}
+	in <- llm_common.LLMResponseStruct{IsEnd: true}
+	close(in)
+
+	var got []llm_common.LLMResponseStruct
+	for resp := range prependLLMResponseText(context.Background(), "已为您转接家居控制。", in) {
+		got = append(got, resp)
+	}
+	if len(got) != 3 || got[0].Text != "已为您转接家居控制。" || !got[0].IsStart {
+		t.Fatalf("unexpected prefixed stream: %+v", got)
+	}
+	if got[1].IsStart || !got[2].IsEnd {
+		t.Fatalf("expected only the announcement to be marked as start: %+v", got)
+	}
+}
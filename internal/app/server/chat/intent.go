@@ -0,0 +1,278 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	mcp_go "github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel/attribute"
+
+	chathooks "xiaozhi-esp32-server-golang/internal/domain/chat/hooks"
+	"xiaozhi-esp32-server-golang/internal/domain/eventbus"
+	"xiaozhi-esp32-server-golang/internal/domain/intent"
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+	"xiaozhi-esp32-server-golang/internal/domain/openclaw"
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// intentPromptTimeout 意图规则获取 MCP 提示词的超时时间
+const intentPromptTimeout = 10 * time.Second
+
+// routeIntent 是 LLM 之前的意图路由阶段：按当前智能体的规则匹配用户原话并执行动作。
+// 返回 true 表示本轮已处理完毕，不再请求 LLM；未命中、动作为 llm/agent/prompt 或执行失败时返回 false 继续走 LLM，
+// 同时返回本轮交给 LLM 的输入（prompt 动作为展开后的提示词，其余为用户原话）。
+func (s *ChatSession) routeIntent(ctx context.Context, text string) (bool, string) {
+	rules := s.clientState.DeviceConfig.IntentRules
+	if len(rules) == 0 || !intent.Enabled() {
+		return false, text
+	}
+
+	spanCtx, span := s.startTurnChildSpan(ctx, "intent.route", attribute.Int("intent.rules", len(rules)))
+	match := intent.GetRouter().Match(spanCtx, text, rules)
+	if match == nil {
+		span.SetAttributes(attribute.Bool("intent.hit", false))
+		span.End()
+		return false, text
+	}
+
+	rule := match.Rule
+	span.SetAttributes(
+		attribute.Bool("intent.hit", true),
+		attribute.String("intent.rule", rule.Name),
+		attribute.String("intent.match_type", rule.MatchType),
+		attribute.String("intent.action", rule.Action),
+		attribute.Float64("intent.score", match.Score),
+	)
+	s.emitIntentMetric(ctx, match)
+	log.Infof("设备 %s 命中意图规则: rule=%s match=%s action=%s pattern=%q score=%.3f",
+		s.clientState.DeviceID, rule.Name, rule.MatchType, rule.Action, match.Pattern, match.Score)
+
+	handled, llmText, err := s.executeIntent(spanCtx, text, match)
+	span.SetAttributes(attribute.Bool("intent.handled", handled))
+	tracing.End(span, err)
+	if err != nil {
+		log.Warnf("设备 %s 执行意图规则 %s 失败，交由 LLM 处理: %v", s.clientState.DeviceID, rule.Name, err)
+		return false, text
+	}
+	return handled, llmText
+}
+
+func (s *ChatSession) executeIntent(ctx context.Context, text string, match *intent.Match) (bool, string, error) {
+	rule := match.Rule
+	switch strings.ToLower(rule.Action) {
+	case intent.ActionReply:
+		s.speakIntentReply(rule.Reply)
+		return true, text, nil
+	case intent.ActionTool:
+		handled, err := s.executeIntentTool(ctx, text, match)
+		return handled, text, err
+	case intent.ActionAgent:
+		// 转接后本轮请求由目标智能体的 LLM 继续处理
+		if _, err := s.enterHandoff(ctx, rule.Target, text, true); err != nil {
+			return false, text, err
+		}
+		return false, text, nil
+	case intent.ActionMode:
+		handled, err := s.executeIntentMode(rule.Target, rule.Reply)
+		return handled, text, err
+	case intent.ActionLLM:
+		return false, text, nil
+	case intent.ActionPrompt:
+		promptText, err := s.executeIntentPrompt(ctx, text, match)
+		if err != nil {
+			return false, text, err
+		}
+		return false, promptText, nil
+	default:
+		return false, text, fmt.Errorf("未知的意图动作: %s", rule.Action)
+	}
+}
+
+// executeIntentPrompt 获取规则指定的 MCP 提示词（参数按 tool_args 模板渲染），返回展开后的文本作为本轮 LLM 输入
+func (s *ChatSession) executeIntentPrompt(ctx context.Context, text string, match *intent.Match) (string, error) {
+	rule := match.Rule
+	state := s.clientState
+	rendered, err := intent.RenderToolArgs(rule.ToolArgs, text, match.Groups)
+	if err != nil {
+		return "", err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(rendered), &raw); err != nil {
+		return "", err
+	}
+	// MCP 提示词参数只接受字符串
+	args := make(map[string]string, len(raw))
+	for k, v := range raw {
+		if str, ok := v.(string); ok {
+			args[k] = str
+		} else {
+			args[k] = fmt.Sprint(v)
+		}
+	}
+
+	promptCtx, cancel := context.WithTimeout(ctx, intentPromptTimeout)
+	defer cancel()
+	result, err := mcp.GetPrompt(promptCtx, state.DeviceID, state.AgentID, rule.Target, rule.ToolName, args)
+	if err != nil {
+		return "", fmt.Errorf("获取MCP提示词 %s 失败: %w", rule.ToolName, err)
+	}
+	promptText := mcp.PromptText(result)
+	if promptText == "" {
+		return "", fmt.Errorf("MCP提示词 %s 内容为空", rule.ToolName)
+	}
+	log.Infof("意图规则 %s 展开MCP提示词: server=%s prompt=%s", rule.Name, rule.Target, rule.ToolName)
+	return promptText, nil
+}
+
+// executeIntentTool 直接调用 MCP 工具，按规则回复或工具返回的文本播报；工具返回音频/资源时直接播放
+func (s *ChatSession) executeIntentTool(ctx context.Context, text string, match *intent.Match) (bool, error) {
+	rule := match.Rule
+	state := s.clientState
+	args, err := intent.RenderToolArgs(rule.ToolArgs, text, match.Groups)
+	if err != nil {
+		return false, err
+	}
+	tool, toolSource, ok := mcp.GetToolWithSource(state.DeviceID, state.AgentID, rule.ToolName, state.DeviceConfig.MCPServiceNames)
+	if !ok || tool == nil {
+		return false, fmt.Errorf("未找到工具: %s", rule.ToolName)
+	}
+
+	log.Infof("意图规则 %s 直接调用工具: %s, 参数: %s", rule.Name, rule.ToolName, args)
+	startTs := time.Now().UnixMilli()
+	spanCtx, toolSpan := s.startTurnChildSpan(ctx, "tool.invoke",
+		attribute.String("tool.name", rule.ToolName),
+		attribute.String("tool.source", toolSource),
+	)
+	result, err := tool.InvokableRun(spanCtx, args)
+	tracing.End(toolSpan, err)
+	if err != nil {
+		return false, fmt.Errorf("工具 %s 调用失败: %w", rule.ToolName, err)
+	}
+	log.Infof("意图规则 %s 工具调用完成, 耗时: %dms", rule.Name, time.Now().UnixMilli()-startTs)
+
+	var contentList []mcp_go.Content
+	if mcpResp, ok := s.llmManager.handleLocalToolResult(result); ok {
+		if mcpResp.GetType() == MCPResponseTypeAction {
+			switch mcpResp.GetAction() {
+			case "exit_conversation":
+				s.speakIntentReply(rule.Reply)
+				eventbus.Get().Publish(eventbus.TopicExitChat, &eventbus.ExitChatEvent{
+					ClientState: state,
+					Reason:      "意图规则退出",
+					TriggerType: "intent_rule",
+					UserText:    text,
+					Timestamp:   time.Now(),
+				})
+				return true, nil
+			case "transfer_to_agent", "return_to_agent":
+				// 转接/返回后由当前智能体继续处理本轮请求
+				return false, nil
+			}
+		}
+		contentList = mcpResp.GetContent()
+	} else if toolResult, ok := s.llmManager.handleToolResult(result); ok {
+		if toolResult.IsError {
+			return false, fmt.Errorf("工具 %s 返回错误", rule.ToolName)
+		}
+		contentList = toolResult.Content
+	}
+
+	var wg sync.WaitGroup
+	var replyText string
+	for _, content := range contentList {
+		switch c := content.(type) {
+		case mcp_go.AudioContent:
+			s.speakIntentReply(rule.Reply)
+			if err := s.llmManager.handleAudioContent(ctx, "执行成功", c, &wg); err != nil {
+				log.Errorf("意图规则 %s 播放音频资源失败: %v", rule.Name, err)
+			}
+			wg.Wait()
+			return true, nil
+		case mcp_go.ResourceLink:
+			s.speakIntentReply(rule.Reply)
+			if err := s.llmManager.handleResourceLink(ctx, c, tool, &wg); err != nil {
+				log.Errorf("意图规则 %s 播放资源链接失败: %v", rule.Name, err)
+			}
+			wg.Wait()
+			return true, nil
+		case mcp_go.TextContent:
+			replyText += c.Text
+		}
+	}
+
+	if strings.TrimSpace(rule.Reply) != "" {
+		replyText = rule.Reply
+	}
+	if strings.TrimSpace(replyText) == "" {
+		replyText = "好的"
+	}
+	s.speakIntentReply(replyText)
+	return true, nil
+}
+
+// executeIntentMode 切换模式：openclaw 进入 OpenClaw 模式；normal 退出 OpenClaw 模式与智能体转接
+func (s *ChatSession) executeIntentMode(target string, reply string) (bool, error) {
+	state := s.clientState
+	agentID := strings.TrimSpace(state.AgentID)
+	deviceID := strings.TrimSpace(state.DeviceID)
+
+	switch strings.ToLower(strings.TrimSpace(target)) {
+	case intent.ModeOpenClaw:
+		if !state.DeviceConfig.OpenClaw.Allowed {
+			return false, fmt.Errorf("当前智能体未开启 OpenClaw")
+		}
+		if !openclaw.GetManager().EnterMode(agentID, deviceID) {
+			_ = s.AddTextToTTSQueue("OpenClaw当前不可用，请稍后再试")
+			return true, nil
+		}
+		if strings.TrimSpace(reply) == "" {
+			reply = "已进入OpenClaw模式，请继续说"
+		}
+		log.Infof("设备 %s 按意图规则进入OpenClaw模式: agent=%s", deviceID, agentID)
+	case intent.ModeNormal:
+		s.finishOpenClawWarmup("", true)
+		openclaw.GetManager().ExitMode(agentID, deviceID)
+		s.exitHandoff("intent")
+		if strings.TrimSpace(reply) == "" {
+			reply = "已恢复普通模式"
+		}
+	default:
+		return false, fmt.Errorf("未知的目标模式: %s", target)
+	}
+	_ = s.AddTextToTTSQueue(reply)
+	return true, nil
+}
+
+// speakIntentReply 播报回复并写入对话历史，保持后续 LLM 轮次的上下文连贯
+func (s *ChatSession) speakIntentReply(reply string) {
+	reply = strings.TrimSpace(reply)
+	if reply == "" {
+		return
+	}
+	s.clientState.AddMessage(schema.AssistantMessage(reply, nil))
+	if err := s.AddTextToTTSQueue(reply); err != nil {
+		log.Warnf("意图回复加入TTS队列失败: %v", err)
+	}
+}
+
+func (s *ChatSession) emitIntentMetric(ctx context.Context, match *intent.Match) {
+	data := chathooks.MetricData{
+		Stage: chathooks.MetricIntentHit,
+		Ts:    time.Now().UnixMilli(),
+		Intent: &chathooks.IntentHit{
+			Rule:      match.Rule.Name,
+			MatchType: match.Rule.MatchType,
+			Action:    match.Rule.Action,
+			Score:     match.Score,
+		},
+	}
+	if err := s.hookHub.EmitMetric(s.hookContext(ctx), data); err != nil {
+		log.Warnf("METRIC hook 执行失败: stage=%s err=%v", data.Stage, err)
+	}
+}
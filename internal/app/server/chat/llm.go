@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -17,11 +18,13 @@ import (
 	"xiaozhi-esp32-server-golang/internal/domain/chat/streamtransform"
 	config_types "xiaozhi-esp32-server-golang/internal/domain/config/types"
 	"xiaozhi-esp32-server-golang/internal/domain/eventbus"
+	"xiaozhi-esp32-server-golang/internal/domain/intent"
 	"xiaozhi-esp32-server-golang/internal/domain/llm"
 	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
 	"xiaozhi-esp32-server-golang/internal/domain/mcp"
 	"xiaozhi-esp32-server-golang/internal/domain/play_music"
 	"xiaozhi-esp32-server-golang/internal/domain/speaker"
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
 	"xiaozhi-esp32-server-golang/internal/pool"
 	"xiaozhi-esp32-server-golang/internal/util"
 	log "xiaozhi-esp32-server-golang/logger"
@@ -29,6 +32,7 @@ import (
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/schema"
 	mcp_go "github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -90,6 +94,14 @@ type LLMManager struct {
 	// key: role (user/assistant), value: MessageID
 	lastMessageID   map[string]string
 	lastMessageIDMu sync.RWMutex // 保护 lastMessageID 的并发访问
+
+	// 等待用户确认的工具调用（工具策略为 confirm 时）
+	pendingConfirm   *pendingToolConfirmation
+	pendingConfirmMu sync.Mutex
+
+	// 确认流程播报提问与继续 LLM 请求的入口，为空时使用 AddTextToTTSQueue / DoLLmRequest（测试中替换）
+	speakFunc       func(text string) error
+	continueLLMFunc func(ctx context.Context)
 }
 
 func NewLLMManager(clientState *ClientState, serverTransport *ServerTransport, ttsManager *TTSManager, session *ChatSession, transformRegistry *streamtransform.Registry) *LLMManager {
@@ -580,155 +592,144 @@ func (l *LLMManager) handleToolCallResponse(ctx context.Context, userMessage *sc
 
 	log.Infof("处理 %d 个工具调用", len(tools))
 
-	var invokeToolSuccess bool
-
-	// 从 context 中获取 chat_session_operator（如果存在）
-	// 如果不存在，说明没有需要 ChatSession 操作的工具，可以正常执行
-	var toolCtx context.Context = ctx
-	if chatSessionOperator, ok := ctx.Value("chat_session_operator").(ChatSessionOperator); ok {
-		// 在 context 中传递 chat_session_operator，供 local mcp tool 使用
-		toolCtx = context.WithValue(ctx, "chat_session_operator", chatSessionOperator)
-	}
-
-	var shouldStopLLMProcessing bool
-
-	var wg sync.WaitGroup
+	batch := &toolCallBatch{}
 
-	var messageList []*schema.Message
-
-	//messageList = append(messageList, userMessage)
-	// 只有当respMsg有内容（Content不为空或ToolCalls不为空）时才添加到messageList
+	// 只有当respMsg有内容（Content不为空或ToolCalls不为空）时才添加到batch
 	// 避免保存空的assistant消息导致后续LLM调用出现400错误
 	if respMsg != nil && (respMsg.Content != "" || len(respMsg.ToolCalls) > 0) {
-		messageList = append(messageList, respMsg)
+		batch.messages = append(batch.messages, toolBatchMessage{msg: respMsg})
 	}
 
-	addMessageFunc := func(toolCall schema.ToolCall, result string) {
-		toolResultMsg := &schema.Message{
-			Role:       schema.Tool,
-			ToolCallID: toolCall.ID,
-			Content:    result,
-		}
-		messageList = append(messageList, toolResultMsg)
-	}
-
-	var findExitTool bool
-
+	// 按智能体配置的工具策略分流：拒绝的直接返回原因，需确认的暂停等待用户回答
+	var confirmCalls []pendingToolCall
 	for _, toolCall := range tools {
-		toolName := toolCall.Function.Name
-		tool, ok := mcp.GetToolByName(state.DeviceID, state.AgentID, toolName, state.DeviceConfig.MCPServiceNames)
-		if !ok || tool == nil {
-			log.Errorf("未找到工具: %s", toolName)
-			addMessageFunc(toolCall, fmt.Sprintf("未找到工具: %s", toolName))
+		policy, hasPolicy := intent.MatchToolPolicy(state.DeviceConfig.ToolPolicies, toolCall.Function.Name)
+		if !hasPolicy {
+			// 未配置策略的工具按 allow 执行，同样记录审计结论
+			l.invokeToolCall(ctx, toolCall, batch,
+				toolPolicyAudit(toolCall.Function.Name, intent.ToolPolicyAllow, toolDecisionAllowed, "", ""))
 			continue
 		}
-		log.Infof("进行工具调用请求: %s, 参数: %+v", toolName, toolCall.Function.Arguments)
-		startTs := time.Now().UnixMilli()
-		fcResult, err := tool.InvokableRun(toolCtx, toolCall.Function.Arguments)
-		if err != nil {
-			log.Errorf("工具调用失败: %v", err)
-			addMessageFunc(toolCall, fmt.Sprintf("工具 %s 调用失败: %v", toolName, err))
-			continue
-		}
-		costTs := time.Now().UnixMilli() - startTs
-		invokeToolSuccess = true
-		if len(fcResult) > 2048 {
-			log.Infof("工具调用结果 len: %d, 耗时: %dms", len(fcResult), costTs)
-		} else {
-			log.Infof("工具调用结果 %s, 耗时: %dms", fcResult, costTs)
-		}
-
-		var result string = fcResult
-		var contentList []mcp_go.Content
-		if mcpResp, ok := l.handleLocalToolResult(fcResult); ok {
-			if mcpResp.GetType() == MCPResponseTypeAction {
-				if mcpResp.GetAction() == "exit_conversation" {
-					findExitTool = true
-				}
-			}
-			/*if mcpResp.IsTerminal() {
-				log.Infof("工具调用结果: %s, 终止: %t", fcResult, mcpResp.IsTerminal())
-				return invokeToolSuccess, nil
-			}*/
-			contentList = mcpResp.GetContent()
-		} else if toolCallResult, ok := l.handleToolResult(fcResult); ok {
-			if toolCallResult.IsError {
-				log.Errorf("工具调用失败: %s, 错误标记: %t", fcResult, toolCallResult.IsError)
-			}
-			contentList = toolCallResult.Content
-		}
-		if len(contentList) > 0 {
-			var mcpContent string
-			//如果有audio数据, 则进行播放
-			for _, content := range contentList {
-				if audioContent, ok := content.(mcp_go.AudioContent); ok {
-					log.Debugf("调用工具 %s 返回音频资源长度: %d", toolName, len(audioContent.Data))
-
-					mcpContent = "执行成功"
-					//播放音频资源,此时mcpContent是
-					err := l.handleAudioContent(ctx, mcpContent, audioContent, &wg)
-					if err != nil {
-						log.Errorf("mcp播放音频资源失败: %v", err)
-						mcpContent = "执行失败"
-					}
-					shouldStopLLMProcessing = true
-					break
-				} else if resourceLink, ok := content.(mcp_go.ResourceLink); ok {
-					log.Debugf("调用工具 %s 返回资源链接: %+v", toolName, resourceLink)
-					mcpContent = "执行成功"
-					err := l.handleResourceLink(ctx, resourceLink, tool, &wg)
-					if err != nil {
-						log.Errorf("mcp播放资源链接失败: %v", err)
-						mcpContent = "执行失败"
-					}
-
-					shouldStopLLMProcessing = true
-					break
-				} else if textContent, ok := content.(mcp_go.TextContent); ok {
-					log.Debugf("调用工具 %s 返回文本资源长度: %s", toolName, textContent.Text)
-					mcpContent += textContent.Text
-				}
-			}
-			if mcpContent != "" {
-				result = mcpContent
-			}
+		switch policy.Policy {
+		case intent.ToolPolicyDeny:
+			l.denyToolCall(toolCall, policy, batch)
+		case intent.ToolPolicyConfirm:
+			confirmCalls = append(confirmCalls, pendingToolCall{call: toolCall, policy: policy})
+		default:
+			l.invokeToolCall(ctx, toolCall, batch,
+				toolPolicyAudit(toolCall.Function.Name, policy.Policy, toolDecisionAllowed, "", ""))
 		}
-		addMessageFunc(toolCall, result)
 	}
 
-	if len(messageList) > 0 {
-		for _, msg := range messageList {
-			// 过滤掉Content为空的assistant消息，避免保存到历史记录中
-			// 空的assistant消息会导致后续LLM调用时出现400错误
-			if msg != nil && msg.Role == schema.Assistant && msg.Content == "" && len(msg.ToolCalls) == 0 {
-				log.Debugf("跳过保存空的assistant消息")
-				continue
-			}
-			l.AddLlmMessage(ctx, msg)
-		}
+	if len(confirmCalls) > 0 {
+		batch.wg.Wait()
+		l.awaitToolConfirmation(batch, confirmCalls)
+		// 已转入确认流程，不再播报本轮剩余文本
+		return true, nil
 	}
 
-	wg.Wait()
+	return l.finishToolCallBatch(ctx, batch), nil
+}
 
-	if findExitTool {
-		// 发布退出聊天事件
-		eventbus.Get().Publish(eventbus.TopicExitChat, &eventbus.ExitChatEvent{
-			ClientState: l.clientState,
-			Reason:      "工具调用退出",
-			TriggerType: "tool_call",
-			UserText:    "",
-			Timestamp:   time.Now(),
-		})
+// invokeToolCall 执行单个工具调用，结果（附带审计元数据）追加到 batch
+func (l *LLMManager) invokeToolCall(ctx context.Context, toolCall schema.ToolCall, batch *toolCallBatch, metadata map[string]interface{}) {
+	state := l.clientState
 
-		return invokeToolSuccess, nil
+	// 从 context 中获取 chat_session_operator（如果存在）
+	// 如果不存在，说明没有需要 ChatSession 操作的工具，可以正常执行
+	var toolCtx context.Context = ctx
+	if chatSessionOperator, ok := ctx.Value("chat_session_operator").(ChatSessionOperator); ok {
+		// 在 context 中传递 chat_session_operator，供 local mcp tool 使用
+		toolCtx = context.WithValue(ctx, "chat_session_operator", chatSessionOperator)
 	}
 
-	// 如果工具调用成功且没有被标记为停止处理，则继续LLM调用
-	if invokeToolSuccess && !shouldStopLLMProcessing {
-		l.DoLLmRequest(ctx, nil, l.einoTools, true, nil)
+	toolName := toolCall.Function.Name
+	tool, toolSource, ok := mcp.GetToolWithSource(state.DeviceID, state.AgentID, toolName, state.DeviceConfig.MCPServiceNames)
+	if !ok || tool == nil {
+		log.Errorf("未找到工具: %s", toolName)
+		batch.addResult(toolCall, fmt.Sprintf("未找到工具: %s", toolName), metadata)
+		return
 	}
+	log.Infof("进行工具调用请求: %s, 参数: %+v", toolName, toolCall.Function.Arguments)
+	startTs := time.Now().UnixMilli()
+	spanCtx, toolSpan := l.session.startTurnChildSpan(toolCtx, "tool.invoke",
+		attribute.String("tool.name", toolName),
+		attribute.String("tool.source", toolSource),
+	)
+	fcResult, err := tool.InvokableRun(spanCtx, toolCall.Function.Arguments)
+	tracing.End(toolSpan, err)
+	if err != nil {
+		log.Errorf("工具调用失败: %v", err)
+		batch.addResult(toolCall, fmt.Sprintf("工具 %s 调用失败: %v", toolName, err), metadata)
+		return
+	}
+	costTs := time.Now().UnixMilli() - startTs
+	batch.invokeSuccess = true
+	if len(fcResult) > 2048 {
+		log.Infof("工具调用结果 len: %d, 耗时: %dms", len(fcResult), costTs)
+	} else {
+		log.Infof("工具调用结果 %s, 耗时: %dms", fcResult, costTs)
+	}
+
+	var result string = fcResult
+	var contentList []mcp_go.Content
+	if mcpResp, ok := l.handleLocalToolResult(fcResult); ok {
+		if mcpResp.GetType() == MCPResponseTypeAction {
+			switch mcpResp.GetAction() {
+			case "exit_conversation":
+				batch.exit = true
+			case "transfer_to_agent", "return_to_agent":
+				batch.handoff = true
+			}
+		}
+		/*if mcpResp.IsTerminal() {
+			log.Infof("工具调用结果: %s, 终止: %t", fcResult, mcpResp.IsTerminal())
+			return invokeToolSuccess, nil
+		}*/
+		contentList = mcpResp.GetContent()
+	} else if toolCallResult, ok := l.handleToolResult(fcResult); ok {
+		if toolCallResult.IsError {
+			log.Errorf("工具调用失败: %s, 错误标记: %t", fcResult, toolCallResult.IsError)
+		}
+		contentList = toolCallResult.Content
+	}
+	if len(contentList) > 0 {
+		var mcpContent string
+		//如果有audio数据, 则进行播放
+		for _, content := range contentList {
+			if audioContent, ok := content.(mcp_go.AudioContent); ok {
+				log.Debugf("调用工具 %s 返回音频资源长度: %d", toolName, len(audioContent.Data))
+
+				mcpContent = "执行成功"
+				//播放音频资源,此时mcpContent是
+				err := l.handleAudioContent(ctx, mcpContent, audioContent, &batch.wg)
+				if err != nil {
+					log.Errorf("mcp播放音频资源失败: %v", err)
+					mcpContent = "执行失败"
+				}
+				batch.stopLLM = true
+				break
+			} else if resourceLink, ok := content.(mcp_go.ResourceLink); ok {
+				log.Debugf("调用工具 %s 返回资源链接: %+v", toolName, resourceLink)
+				mcpContent = "执行成功"
+				err := l.handleResourceLink(ctx, resourceLink, tool, &batch.wg)
+				if err != nil {
+					log.Errorf("mcp播放资源链接失败: %v", err)
+					mcpContent = "执行失败"
+				}
 
-	return invokeToolSuccess, nil
+				batch.stopLLM = true
+				break
+			} else if textContent, ok := content.(mcp_go.TextContent); ok {
+				log.Debugf("调用工具 %s 返回文本资源长度: %s", toolName, textContent.Text)
+				mcpContent += textContent.Text
+			}
+		}
+		if mcpContent != "" {
+			result = mcpContent
+		}
+	}
+	batch.addResult(toolCall, result, metadata)
 }
 
 func (l *LLMManager) handleResourceLink(ctx context.Context, resourceLink mcp_go.ResourceLink, toolCall tool.InvokableTool, wg *sync.WaitGroup) error {
@@ -958,11 +959,19 @@ func (l *LLMManager) handleLLMWithContextAndTools(
 	// 获取 provider
 	llmProvider := llmWrapper.GetProvider()
 
+	// 每轮 LLM 请求一个 span，provider 的出站请求会携带该 trace 上下文
+	llmCtx, llmSpan := l.session.startTurnChildSpan(ctx, "llm.round",
+		attribute.String("llm.provider", l.clientState.DeviceConfig.Llm.Provider),
+		attribute.Int("llm.tools", len(tools)),
+		attribute.Int("llm.messages", len(dialogue)),
+	)
+
 	// 调用 LLM provider
-	msgChan := llmProvider.ResponseWithContext(ctx, l.clientState.SessionID, dialogue, tools)
+	msgChan := llmProvider.ResponseWithContext(llmCtx, l.clientState.SessionID, dialogue, tools)
 
 	pipeline, err := l.openOutputPipeline(ctx)
 	if err != nil {
+		tracing.End(llmSpan, err)
 		pool.Release(llmWrapper)
 		return nil, fmt.Errorf("创建LLM输出流变换管线失败: %w", err)
 	}
@@ -975,7 +984,9 @@ func (l *LLMManager) handleLLMWithContextAndTools(
 
 	// 启动 goroutine 处理响应
 	go func() {
+		var spanErr error
 		defer func() {
+			tracing.End(llmSpan, spanErr)
 			log.Debugf("full Response with %d tools, fullText: %s", len(tools), rawFullText.String())
 			close(responseChannel)
 			if closeErr := pipeline.Close(); closeErr != nil {
@@ -1091,6 +1102,7 @@ func (l *LLMManager) handleLLMWithContextAndTools(
 			select {
 			case <-ctx.Done():
 				log.Infof("上下文已取消，停止LLM响应处理: %v, context done, exit", ctx.Err())
+				spanErr = ctx.Err()
 				return
 			case message, ok := <-msgChan:
 				if !ok {
@@ -1109,6 +1121,7 @@ func (l *LLMManager) handleLLMWithContextAndTools(
 				if llm.IsLLMErrorMessage(message) {
 					errMsg := llm.LLMErrorMessage(message)
 					log.Warnf("LLM 返回错误: %s", errMsg)
+					spanErr = errors.New(errMsg)
 					stop, pushErr := pushRawText(errMsg, true, nil)
 					if pushErr != nil {
 						log.Errorf("处理 LLM 错误输出失败: %v", pushErr)
@@ -1118,6 +1131,14 @@ func (l *LLMManager) handleLLMWithContextAndTools(
 					}
 					return
 				}
+				if meta := message.ResponseMeta; meta != nil && meta.Usage != nil {
+					llmSpan.SetAttributes(
+						attribute.String("llm.finish_reason", meta.FinishReason),
+						attribute.Int("llm.usage.prompt_tokens", meta.Usage.PromptTokens),
+						attribute.Int("llm.usage.completion_tokens", meta.Usage.CompletionTokens),
+						attribute.Int("llm.usage.total_tokens", meta.Usage.TotalTokens),
+					)
+				}
 				if message.Content != "" {
 					if !llmFirstTokenMarked {
 						firstTokenTs := time.Now().UnixMilli()
@@ -1125,6 +1146,7 @@ func (l *LLMManager) handleLLMWithContextAndTools(
 						if l.session != nil {
 							l.session.TraceLlmFirstToken(ctx, firstTokenTs)
 						}
+						llmSpan.AddEvent("first_token")
 						llmFirstTokenMarked = true
 					}
 					stop, pushErr := pushRawText(message.Content, false, nil)
@@ -1198,6 +1220,13 @@ func (l *LLMManager) DoLLmRequest(ctx context.Context, userMessage *schema.Messa
 		return fmt.Errorf("发送带工具的 LLM 请求失败: %v", err)
 	}
 
+	// 智能体转接后由目标/原智能体先播报转接提示
+	if l.session != nil {
+		if announcement := l.session.takeHandoffAnnouncement(); announcement != "" {
+			responseSentences = prependLLMResponseText(ctx, announcement, responseSentences)
+		}
+	}
+
 	log.Debugf("DoLLmRequest goroutine开始 - SessionID: %s, context状态: %v", l.clientState.SessionID, ctx.Err())
 
 	if isSync {
@@ -1222,6 +1251,11 @@ func (l *LLMManager) DoLLmRequest(ctx context.Context, userMessage *schema.Messa
 
 // AddMessage 添加消息到聊天历史（统一入口，适用于所有消息类型）
 func (l *LLMManager) AddMessage(ctx context.Context, msg *schema.Message) error {
+	return l.AddMessageWithMetadata(ctx, msg, nil)
+}
+
+// AddMessageWithMetadata 添加消息并附带保存到聊天历史的元数据
+func (l *LLMManager) AddMessageWithMetadata(ctx context.Context, msg *schema.Message, metadata map[string]interface{}) error {
 	if msg == nil {
 		log.Warnf("尝试添加 nil 消息到聊天历史")
 		return fmt.Errorf("消息不能为 nil")
@@ -1251,6 +1285,7 @@ func (l *LLMManager) AddMessage(ctx context.Context, msg *schema.Message) error
 			SampleRate:  0,
 			Channels:    0,
 			Timestamp:   time.Now(),
+			Metadata:    metadata,
 			IsUpdate:    false, // 一次性保存
 		})
 		return nil
@@ -1274,6 +1309,7 @@ func (l *LLMManager) AddMessage(ctx context.Context, msg *schema.Message) error
 		SampleRate:  0,
 		Channels:    0,
 		Timestamp:   time.Now(),
+		Metadata:    metadata,
 		IsUpdate:    false, // 新增消息
 	})
 
@@ -1298,8 +1334,10 @@ func (l *LLMManager) GetMessages(ctx context.Context, userMessage *schema.Messag
 		}
 	}
 
-	// 构建 system prompt
-	systemPrompt := l.clientState.SystemPrompt
+	// 构建 system prompt（提示词模板每轮渲染一次）
+	systemPrompt := renderSystemPrompt(ctx, l.clientState, speakerResult)
+	// 提示词模板渲染结果在会话内基本不变，作为提示词缓存前缀；之后追加的时间、记忆等每轮变化
+	staticPromptLen := len(systemPrompt)
 
 	// 添加当前时间和日期信息
 	now := time.Now()
@@ -1338,11 +1376,13 @@ func (l *LLMManager) GetMessages(ctx context.Context, userMessage *schema.Messag
 	}
 
 	systemPrompt += buildKnowledgeSearchRoutingPolicy(l.clientState.DeviceConfig.KnowledgeBases)
+	systemPrompt += buildPinnedResourceContext(ctx, l.clientState)
 
 	retMessage := make([]*schema.Message, 0)
 	retMessage = append(retMessage, &schema.Message{
 		Role:    schema.System,
 		Content: systemPrompt,
+		Extra:   map[string]any{llm.CacheControlExtraKey: staticPromptLen},
 	})
 	// 过滤掉空的assistant消息，避免发送给LLM API时出现400错误
 	// 空的assistant消息（Content为空且ToolCalls为空）会导致API错误
@@ -61,6 +61,18 @@ func InitChatLocalMCPTools() {
 			Params:      struct{}{},
 			Handle:      restoreDeviceDefaultRoleHandler,
 		},
+		"transfer_to_agent": {
+			Name:        "transfer_to_agent",
+			Description: "当用户的请求更适合由其它专属智能体处理（如家居控制、学习辅导）或用户明确要求找某个智能体时使用，参数 agent_name 支持模糊匹配；默认处理完本次请求后自动返回当前智能体",
+			Params:      TransferToAgentParams{},
+			Handle:      transferToAgentHandler,
+		},
+		"return_to_agent": {
+			Name:        "return_to_agent",
+			Description: "当前处于智能体转接状态、且用户的请求已处理完毕或用户要求回到原来的助手时使用，用于结束转接并返回原智能体",
+			Params:      struct{}{},
+			Handle:      returnToAgentHandler,
+		},
 		"search_knowledge": {
 			Name:        "search_knowledge",
 			Description: "当用户问题需要事实依据、流程规则、参数细节、文档条款时，检索当前智能体关联知识库并返回相关片段；可选传 knowledge_base_ids 仅查指定知识库；闲聊或纯创作场景不要调用",
@@ -114,6 +126,12 @@ type SwitchDeviceRoleParams struct {
 	RoleName string `json:"role_name" description:"目标角色名称，支持模糊匹配" required:"true"`
 }
 
+type TransferToAgentParams struct {
+	AgentName string `json:"agent_name" description:"目标智能体名称，支持模糊匹配" required:"true"`
+	Request   string `json:"request,omitempty" description:"需要目标智能体处理的用户请求，默认使用用户最近一句话"`
+	Stay      bool   `json:"stay,omitempty" description:"为 true 时转接后持续由目标智能体对话，直到用户要求返回；默认完成本次请求后自动返回"`
+}
+
 type SearchKnowledgeParams struct {
 	Query            string `json:"query" description:"要检索的查询内容" required:"true"`
 	TopK             int    `json:"top_k,omitempty" description:"返回条数，默认5"`
@@ -373,6 +391,83 @@ func restoreDeviceDefaultRoleHandler(ctx context.Context, argumentsInJSON string
 	return "", fmt.Errorf("从context中未找到chat_session_operator")
 }
 
+// transferToAgentHandler 转接智能体的处理函数
+func transferToAgentHandler(ctx context.Context, argumentsInJSON string) (string, error) {
+	log.Info("执行转接智能体工具")
+
+	var params TransferToAgentParams
+	if argumentsInJSON == "" {
+		response := NewErrorResponse("transfer_to_agent", "缺少参数 agent_name", "MISSING_AGENT_NAME", "请提供要转接的智能体名称")
+		return response.ToJSON()
+	}
+	if err := json.Unmarshal([]byte(argumentsInJSON), &params); err != nil {
+		response := NewErrorResponse("transfer_to_agent", "参数解析失败", "PARSE_ERROR", "请检查 agent_name 参数格式")
+		return response.ToJSON()
+	}
+	params.AgentName = strings.TrimSpace(params.AgentName)
+	if params.AgentName == "" {
+		response := NewErrorResponse("transfer_to_agent", "智能体名称不能为空", "INVALID_AGENT_NAME", "请提供有效的 agent_name")
+		return response.ToJSON()
+	}
+
+	if chatSessionOperatorValue := ctx.Value("chat_session_operator"); chatSessionOperatorValue != nil {
+		if chatSessionOperator, ok := chatSessionOperatorValue.(ChatSessionOperator); ok {
+			targetName, err := chatSessionOperator.LocalMcpTransferToAgent(ctx, params.AgentName, params.Request, params.Stay)
+			if err != nil {
+				log.Errorf("转接智能体失败: %v", err)
+				response := NewErrorResponse("transfer_to_agent", fmt.Sprintf("转接智能体失败: %v", err), "TRANSFER_FAILED", "请尝试更换智能体名称，或由当前智能体直接回答")
+				return response.ToJSON()
+			}
+
+			response := NewActionResponse(
+				"transfer_to_agent",
+				"transfer_to_agent",
+				fmt.Sprintf("已转接到智能体：%s", targetName),
+				"completed",
+				false,
+			)
+			response.Instruction = fmt.Sprintf("你现在是%s，请直接处理用户的请求，不要重复转接提示", targetName)
+			response.Metadata = map[string]string{
+				"requested_agent_name": params.AgentName,
+				"matched_agent_name":   targetName,
+				"stay":                 fmt.Sprintf("%v", params.Stay),
+			}
+			return response.ToJSON()
+		}
+		return "", fmt.Errorf("从context中获取的chat_session_operator不是ChatSessionOperator类型")
+	}
+
+	return "", fmt.Errorf("从context中未找到chat_session_operator")
+}
+
+// returnToAgentHandler 返回原智能体的处理函数
+func returnToAgentHandler(ctx context.Context, argumentsInJSON string) (string, error) {
+	log.Info("执行返回原智能体工具")
+
+	if chatSessionOperatorValue := ctx.Value("chat_session_operator"); chatSessionOperatorValue != nil {
+		if chatSessionOperator, ok := chatSessionOperatorValue.(ChatSessionOperator); ok {
+			originName, err := chatSessionOperator.LocalMcpReturnToAgent(ctx)
+			if err != nil {
+				response := NewErrorResponse("return_to_agent", fmt.Sprintf("返回原智能体失败: %v", err), "RETURN_FAILED", "当前无需返回，请继续回答用户")
+				return response.ToJSON()
+			}
+
+			response := NewActionResponse(
+				"return_to_agent",
+				"return_to_agent",
+				fmt.Sprintf("已返回智能体：%s", originName),
+				"completed",
+				false,
+			)
+			response.Instruction = "转接已结束，请以原智能体身份简短回应用户"
+			return response.ToJSON()
+		}
+		return "", fmt.Errorf("从context中获取的chat_session_operator不是ChatSessionOperator类型")
+	}
+
+	return "", fmt.Errorf("从context中未找到chat_session_operator")
+}
+
 func searchKnowledgeHandler(ctx context.Context, argumentsInJSON string) (string, error) {
 	log.Info("执行知识库检索工具")
 
@@ -0,0 +1,81 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultPinnedResourceMaxChars      = 2000
+	defaultPinnedResourceTotalMaxChars = 8000
+	pinnedResourceReadTimeout          = 3 * time.Second
+)
+
+// buildPinnedResourceContext 读取智能体固定的 MCP 资源并拼接为系统提示词片段。
+// 单个资源按 max_chars（默认 mcp.resources.max_chars）截断，总量不超过 mcp.resources.max_total_chars；
+// 读取失败的资源跳过，不影响对话
+func buildPinnedResourceContext(ctx context.Context, clientState *ClientState) string {
+	refs := clientState.DeviceConfig.MCPResources
+	if len(refs) == 0 {
+		return ""
+	}
+
+	defaultMax := viper.GetInt("mcp.resources.max_chars")
+	if defaultMax <= 0 {
+		defaultMax = defaultPinnedResourceMaxChars
+	}
+	remaining := viper.GetInt("mcp.resources.max_total_chars")
+	if remaining <= 0 {
+		remaining = defaultPinnedResourceTotalMaxChars
+	}
+
+	var b strings.Builder
+	for _, ref := range refs {
+		if remaining <= 0 {
+			log.Warnf("设备 %s 固定的MCP资源超出总长度限制，其余资源未注入", clientState.DeviceID)
+			break
+		}
+		readCtx, cancel := context.WithTimeout(ctx, pinnedResourceReadTimeout)
+		text, err := mcp.ReadPinnedResource(readCtx, clientState.DeviceID, clientState.AgentID, ref.Server, ref.URI)
+		cancel()
+		if err != nil {
+			log.Warnf("读取固定的MCP资源失败: server=%s uri=%s err=%v", ref.Server, ref.URI, err)
+			continue
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		limit := ref.MaxChars
+		if limit <= 0 {
+			limit = defaultMax
+		}
+		if limit > remaining {
+			limit = remaining
+		}
+		text, truncated := mcp.TruncateRunes(text, limit)
+		remaining -= len([]rune(text))
+		if truncated {
+			text += "…（内容过长已截断）"
+		}
+
+		name := strings.TrimSpace(ref.Name)
+		if name == "" {
+			name = ref.URI
+		}
+		fmt.Fprintf(&b, "\n【%s】\n%s\n", name, text)
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "\n以下是固定的参考资料，回答相关问题时请以此为准:" + b.String()
+}
@@ -0,0 +1,134 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+	"xiaozhi-esp32-server-golang/internal/domain/speaker"
+	log "xiaozhi-esp32-server-golang/logger"
+	"xiaozhi-esp32-server-golang/pkg/prompttpl"
+
+	mcp_go "github.com/mark3labs/mcp-go/mcp"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultWeatherArgs     = `{"city": "{{location}}"}`
+	defaultWeatherCacheTTL = 30 * time.Minute
+	defaultWeatherTimeout  = 3 * time.Second
+)
+
+type weatherCacheEntry struct {
+	text     string
+	expireAt time.Time
+}
+
+// weatherCache 按 工具名+地点 缓存天气，避免每轮对话都调用天气工具
+var weatherCache sync.Map
+
+// renderSystemPrompt 渲染当前轮次的系统提示词模板；渲染失败时记录告警并使用原文，不影响对话
+func renderSystemPrompt(ctx context.Context, clientState *ClientState, speakerResult *speaker.IdentifyResult) string {
+	text := clientState.SystemPrompt
+	if !prompttpl.IsTemplate(text) {
+		return text
+	}
+	deviceConfig := clientState.DeviceConfig
+	vars := prompttpl.Vars{
+		AssistantName: deviceConfig.AgentName,
+		DeviceID:      clientState.DeviceID,
+		DeviceName:    deviceConfig.PromptVars.DeviceName,
+		OwnerNickname: deviceConfig.PromptVars.OwnerNickname,
+		Location:      deviceConfig.PromptVars.Location,
+		Now:           prompttpl.NowIn(deviceConfig.PromptVars.Timezone),
+		Weather: func() string {
+			return fetchWeather(ctx, clientState)
+		},
+	}
+	if vars.DeviceName == "" {
+		vars.DeviceName = clientState.DeviceID
+	}
+	if speakerResult != nil && speakerResult.Identified {
+		vars.SpeakerName = speakerResult.SpeakerName
+	}
+
+	rendered, err := prompttpl.Render(text, deviceConfig.PromptSnippets, vars)
+	if err != nil {
+		log.Warnf("设备 %s 提示词模板渲染失败，使用原文: %v", clientState.DeviceID, err)
+		return text
+	}
+	return rendered
+}
+
+// fetchWeather 调用配置的天气工具获取设备所在地天气，未配置工具或调用失败时返回空字符串
+func fetchWeather(ctx context.Context, clientState *ClientState) string {
+	toolName := strings.TrimSpace(viper.GetString("prompt_template.weather_tool"))
+	location := clientState.DeviceConfig.PromptVars.Location
+	if toolName == "" {
+		return ""
+	}
+	cacheKey := toolName + "|" + location
+	if v, ok := weatherCache.Load(cacheKey); ok {
+		entry := v.(weatherCacheEntry)
+		if time.Now().Before(entry.expireAt) {
+			return entry.text
+		}
+	}
+
+	tool, ok := mcp.GetToolByName(clientState.DeviceID, clientState.AgentID, toolName, clientState.DeviceConfig.MCPServiceNames)
+	if !ok || tool == nil {
+		log.Warnf("未找到天气工具: %s", toolName)
+		return ""
+	}
+
+	argsTemplate := viper.GetString("prompt_template.weather_args")
+	if argsTemplate == "" {
+		argsTemplate = defaultWeatherArgs
+	}
+	// 地点写入 JSON 字符串，需转义
+	escaped, _ := json.Marshal(location)
+	args, err := prompttpl.Render(argsTemplate, nil, prompttpl.Vars{Location: string(escaped[1 : len(escaped)-1])})
+	if err != nil || !json.Valid([]byte(args)) {
+		log.Warnf("天气工具参数无效: %s, err: %v", args, err)
+		return ""
+	}
+
+	timeout := viper.GetDuration("prompt_template.weather_timeout")
+	if timeout <= 0 {
+		timeout = defaultWeatherTimeout
+	}
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result, err := tool.InvokableRun(callCtx, args)
+	if err != nil {
+		log.Warnf("调用天气工具 %s 失败: %v", toolName, err)
+		return ""
+	}
+
+	text := weatherResultText(result)
+	ttl := viper.GetDuration("prompt_template.weather_cache_ttl")
+	if ttl <= 0 {
+		ttl = defaultWeatherCacheTTL
+	}
+	weatherCache.Store(cacheKey, weatherCacheEntry{text: text, expireAt: time.Now().Add(ttl)})
+	return text
+}
+
+// weatherResultText 提取工具结果中的文本，非标准 MCP 结果按纯文本处理
+func weatherResultText(result string) string {
+	var toolResult mcp_go.CallToolResult
+	if err := json.Unmarshal([]byte(result), &toolResult); err != nil || len(toolResult.Content) == 0 {
+		return strings.TrimSpace(result)
+	}
+	parts := make([]string, 0, len(toolResult.Content))
+	for _, content := range toolResult.Content {
+		if textContent, ok := mcp_go.AsTextContent(content); ok && textContent.Text != "" {
+			parts = append(parts, textContent.Text)
+		}
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n"))
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -84,6 +85,10 @@ type ChatSession struct {
 	openClawWarmup   *openClawWarmupTask
 
 	hookHub *chathooks.Hub
+
+	turnTrace turnTraceState
+
+	handoff handoffState
 }
 
 type ChatSessionOption func(*ChatSession)
@@ -636,6 +641,8 @@ func (s *ChatSession) resetOpenClawModeOnHello(agentIDs ...string) {
 }
 
 func (s *ChatSession) refreshDeviceConfigOnHello() error {
+	s.exitHandoff("hello")
+
 	configProvider, err := user_config.GetProvider(viper.GetString("config_provider.type"))
 	if err != nil {
 		return fmt.Errorf("获取配置提供者失败: %w", err)
@@ -1385,6 +1392,9 @@ func (s *ChatSession) Close() {
 			s.hookHub.Close()
 		}
 
+		// 会话关闭时结束未完成的轮次 span，避免 span 泄漏
+		s.endTurnSpan(0, context.Canceled)
+
 		if s.clientState != nil {
 			eventbus.Get().Publish(eventbus.TopicSessionEnd, s.clientState)
 		}
@@ -1494,6 +1504,22 @@ func (s *ChatSession) actionDoChat(ctx context.Context, text string, speakerResu
 		}
 	}
 
+	// 工具调用确认：上一轮有等待确认的工具时，本轮回答用于确认或取消，无法判断时按新请求继续
+	if s.llmManager.handlePendingToolConfirmation(ctx, text) {
+		return nil
+	}
+
+	// 多智能体转接路由：返回关键词 / 路由关键词
+	if s.routeHandoff(ctx, text) {
+		return nil
+	}
+
+	// 意图路由：按智能体配置的规则直接调用工具、固定回复或切换智能体/模式，命中时跳过 LLM
+	handled, llmText := s.routeIntent(ctx, text)
+	if handled {
+		return nil
+	}
+
 	if s.checkExitWords(text) {
 		// 发布退出聊天事件
 		eventbus.Get().Publish(eventbus.TopicExitChat, &eventbus.ExitChatEvent{
@@ -1519,8 +1545,23 @@ func (s *ChatSession) actionDoChat(ctx context.Context, text string, speakerResu
 	// 直接创建Eino原生消息
 	userMessage := &schema.Message{
 		Role:    schema.User,
-		Content: text,
+		Content: llmText,
+	}
+
+	einoTools := s.buildEinoTools(ctx)
+
+	err := s.llmManager.DoLLmRequest(ctx, userMessage, einoTools, true, speakerResult)
+	s.finishHandoffTurn()
+	if err != nil {
+		log.Errorf("发送带工具的 LLM 请求失败, seesionID: %s, error: %v", sessionID, err)
+		return fmt.Errorf("发送带工具的 LLM 请求失败: %v", err)
 	}
+	return nil
+}
+
+// buildEinoTools 按当前智能体配置获取可用的 MCP 工具并转换为 Eino ToolInfo
+func (s *ChatSession) buildEinoTools(ctx context.Context) []*schema.ToolInfo {
+	clientState := s.clientState
 
 	// 获取全局MCP工具列表
 	mcpTools, err := mcp.GetToolsByDeviceId(clientState.DeviceID, clientState.AgentID, clientState.DeviceConfig.MCPServiceNames)
@@ -1534,6 +1575,10 @@ func (s *ChatSession) actionDoChat(ctx context.Context, text string, speakerResu
 			log.Infof("设备 %s 未关联可用知识库，已移除工具 search_knowledge", clientState.DeviceID)
 		}
 	}
+	// 未处于转接状态时不需要返回原智能体
+	if !s.IsHandoffActive() {
+		delete(mcpTools, "return_to_agent")
+	}
 
 	// 将MCP工具转换为接口格式以便传递给转换函数
 	mcpToolsInterface := make(map[string]interface{})
@@ -1555,13 +1600,7 @@ func (s *ChatSession) actionDoChat(ctx context.Context, text string, speakerResu
 
 	// 发送带工具的LLM请求
 	log.Infof("使用 %d 个MCP工具发送LLM请求, tools: %+v", len(einoTools), toolNameList)
-
-	err = s.llmManager.DoLLmRequest(ctx, userMessage, einoTools, true, speakerResult)
-	if err != nil {
-		log.Errorf("发送带工具的 LLM 请求失败, seesionID: %s, error: %v", sessionID, err)
-		return fmt.Errorf("发送带工具的 LLM 请求失败: %v", err)
-	}
-	return nil
+	return einoTools
 }
 
 func hasAvailableKnowledgeBase(knowledgeBases []types.KnowledgeBaseRef) bool {
@@ -1685,18 +1724,16 @@ func (s *ChatSession) switchTTSForSpeaker(speakerResult *speaker.IdentifyResult)
 }
 
 func (s *ChatSession) hookContext(ctx context.Context) chathooks.Context {
-	sessionID := ""
-	deviceID := ""
+	hookCtx := chathooks.Context{Ctx: ctx}
 	if s != nil && s.clientState != nil {
-		sessionID = s.clientState.SessionID
-		deviceID = s.clientState.DeviceID
-	}
-
-	return chathooks.Context{
-		Ctx:       ctx,
-		SessionID: sessionID,
-		DeviceID:  deviceID,
+		hookCtx.SessionID = s.clientState.SessionID
+		hookCtx.DeviceID = s.clientState.DeviceID
+		if exp := s.clientState.DeviceConfig.Experiment; exp != nil {
+			hookCtx.Experiment = strconv.FormatUint(uint64(exp.ID), 10)
+			hookCtx.Variant = exp.Variant
+		}
 	}
+	return hookCtx
 }
 
 func (s *ChatSession) emitMetricStage(ctx context.Context, stage chathooks.MetricStage, ts int64, err error) {
@@ -1704,17 +1741,39 @@ func (s *ChatSession) emitMetricStage(ctx context.Context, stage chathooks.Metri
 		return
 	}
 
-	hookErr := s.hookHub.EmitMetric(s.hookContext(ctx), chathooks.MetricData{Stage: stage, Ts: ts, Err: err})
+	hookErr := s.hookHub.EmitMetric(s.hookContext(ctx), chathooks.MetricData{Stage: stage, Ts: ts, Err: err, Provider: s.metricProvider(stage)})
 	if hookErr != nil {
 		log.Warnf("METRIC hook 执行失败: stage=%s err=%v", stage, hookErr)
 	}
 }
 
+// metricProvider 返回指标阶段对应的服务提供者，用于按 provider 维度统计延迟
+func (s *ChatSession) metricProvider(stage chathooks.MetricStage) string {
+	if s == nil || s.clientState == nil {
+		return ""
+	}
+	switch stage {
+	case chathooks.MetricAsrFirstText, chathooks.MetricAsrFinalText:
+		return s.clientState.DeviceConfig.Asr.Provider
+	case chathooks.MetricLlmStart, chathooks.MetricLlmFirstToken, chathooks.MetricLlmEnd:
+		return s.clientState.DeviceConfig.Llm.Provider
+	case chathooks.MetricTtsStart, chathooks.MetricTtsFirstFrame, chathooks.MetricTtsStop:
+		if provider, ok := s.clientState.SpeakerTTSConfig["provider"].(string); ok && provider != "" {
+			return provider
+		}
+		return s.clientState.DeviceConfig.Tts.Provider
+	default:
+		return ""
+	}
+}
+
 func (s *ChatSession) TraceTurnStart(ctx context.Context, ts int64) {
+	s.startTurnSpan(ctx, ts)
 	s.emitMetricStage(ctx, chathooks.MetricTurnStart, ts, nil)
 }
 
 func (s *ChatSession) TraceTurnEnd(ctx context.Context, ts int64, err error) {
+	s.endTurnSpan(ts, err)
 	s.emitMetricStage(ctx, chathooks.MetricTurnEnd, ts, err)
 }
 
@@ -1723,6 +1782,7 @@ func (s *ChatSession) TraceAsrFirstText(ctx context.Context, ts int64) {
 }
 
 func (s *ChatSession) TraceAsrFinalText(ctx context.Context, ts int64) {
+	s.endAsrSpan(ts)
 	s.emitMetricStage(ctx, chathooks.MetricAsrFinalText, ts, nil)
 }
 
@@ -169,6 +169,27 @@ func (c *ChatManager) LocalMcpRestoreDeviceDefaultRole(ctx context.Context) erro
 	return nil
 }
 
+// LocalMcpTransferToAgent 将对话转接给同一用户下的其它智能体
+func (c *ChatManager) LocalMcpTransferToAgent(ctx context.Context, agentName string, request string, stay bool) (string, error) {
+	if c == nil || c.session == nil {
+		return "", fmt.Errorf("会话状态不可用")
+	}
+	return c.session.enterHandoff(ctx, agentName, request, stay)
+}
+
+// LocalMcpReturnToAgent 结束转接并返回原智能体
+func (c *ChatManager) LocalMcpReturnToAgent(ctx context.Context) (string, error) {
+	if c == nil || c.session == nil {
+		return "", fmt.Errorf("会话状态不可用")
+	}
+	originName, ok := c.session.exitHandoff("tool")
+	if !ok {
+		return "", fmt.Errorf("当前未处于智能体转接状态")
+	}
+	c.session.setHandoffAnnouncement(fmt.Sprintf("已回到%s。", originName))
+	return originName, nil
+}
+
 // LocalMcpSearchKnowledge 检索当前智能体绑定的知识库
 func (c *ChatManager) LocalMcpSearchKnowledge(ctx context.Context, query string, topK int, knowledgeBaseIDs []uint) ([]config_types.KnowledgeSearchHit, error) {
 	if c == nil || c.clientState == nil {
@@ -0,0 +1,270 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+	"xiaozhi-esp32-server-golang/internal/domain/eventbus"
+	"xiaozhi-esp32-server-golang/internal/domain/intent"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// defaultToolConfirmTimeout 等待用户确认工具调用的默认时长（chat.tool_confirm_timeout）
+const defaultToolConfirmTimeout = 20 * time.Second
+
+// 工具调用策略的审计结论，记录在工具结果消息的 metadata.tool_policy 中
+const (
+	toolDecisionAllowed  = "allowed"  // 策略允许，直接执行
+	toolDecisionDenied   = "denied"   // 策略拒绝
+	toolDecisionApproved = "approved" // 用户确认后执行
+	toolDecisionRejected = "rejected" // 用户拒绝
+	toolDecisionUnclear  = "unclear"  // 回答无法判断，取消并按新请求处理
+	toolDecisionTimeout  = "timeout"  // 超时未回答，取消
+)
+
+// toolCallBatch 一次 LLM 回复中全部工具调用的处理结果。
+// 有工具等待确认时整批暂存，确认结束后一起写入历史，避免 assistant 工具调用与工具结果之间插入其它消息
+type toolCallBatch struct {
+	messages []toolBatchMessage
+	wg       sync.WaitGroup
+
+	invokeSuccess bool
+	stopLLM       bool // 工具已播放音频/资源，不再请求 LLM
+	exit          bool // 调用了退出对话工具
+	handoff       bool // 调用了转接/返回智能体工具
+	continueLLM   bool // 没有成功调用工具时也继续请求 LLM（用户拒绝后由 LLM 组织回复）
+}
+
+type toolBatchMessage struct {
+	msg      *schema.Message
+	metadata map[string]interface{}
+}
+
+func (b *toolCallBatch) addResult(toolCall schema.ToolCall, result string, metadata map[string]interface{}) {
+	b.messages = append(b.messages, toolBatchMessage{
+		msg: &schema.Message{
+			Role:       schema.Tool,
+			ToolCallID: toolCall.ID,
+			Content:    result,
+		},
+		metadata: metadata,
+	})
+}
+
+type pendingToolCall struct {
+	call   schema.ToolCall
+	policy types.ToolPolicy
+}
+
+// pendingToolConfirmation 等待用户确认的工具调用
+type pendingToolConfirmation struct {
+	batch    *toolCallBatch
+	calls    []pendingToolCall
+	question string
+	timer    *time.Timer
+}
+
+func toolConfirmTimeout() time.Duration {
+	if timeout := viper.GetDuration("chat.tool_confirm_timeout"); timeout > 0 {
+		return timeout
+	}
+	return defaultToolConfirmTimeout
+}
+
+func toolPolicyAudit(toolName, policy, decision, question, answer string) map[string]interface{} {
+	audit := map[string]interface{}{
+		"tool":       toolName,
+		"policy":     policy,
+		"decision":   decision,
+		"decided_at": time.Now().Format(time.RFC3339),
+	}
+	if question != "" {
+		audit["question"] = question
+	}
+	if answer != "" {
+		audit["answer"] = answer
+	}
+	return map[string]interface{}{"tool_policy": audit}
+}
+
+// buildToolConfirmQuestion 生成确认提问：只有一个待确认工具且配置了提问时使用配置，否则按工具名生成
+func buildToolConfirmQuestion(calls []pendingToolCall) string {
+	if len(calls) == 1 && strings.TrimSpace(calls[0].policy.Prompt) != "" {
+		return strings.TrimSpace(calls[0].policy.Prompt)
+	}
+	names := make([]string, 0, len(calls))
+	for _, pc := range calls {
+		names = append(names, pc.call.Function.Name)
+	}
+	return fmt.Sprintf("即将执行%s，确定吗？", strings.Join(names, "、"))
+}
+
+// denyToolCall 按策略拒绝工具调用，把原因作为工具结果交给 LLM
+func (l *LLMManager) denyToolCall(toolCall schema.ToolCall, policy types.ToolPolicy, batch *toolCallBatch) {
+	toolName := toolCall.Function.Name
+	reason := strings.TrimSpace(policy.Prompt)
+	if reason == "" {
+		reason = "该操作不被允许"
+	}
+	log.Infof("设备 %s 工具 %s 被策略拒绝调用", l.clientState.DeviceID, toolName)
+	batch.addResult(toolCall, fmt.Sprintf("工具 %s 已被禁止调用: %s", toolName, reason),
+		toolPolicyAudit(toolName, policy.Policy, toolDecisionDenied, "", ""))
+	// 让 LLM 把拒绝原因告诉用户
+	batch.continueLLM = true
+}
+
+// awaitToolConfirmation 播报确认提问并暂停工具调用，等待用户下一句回答或超时
+func (l *LLMManager) awaitToolConfirmation(batch *toolCallBatch, calls []pendingToolCall) {
+	pending := &pendingToolConfirmation{
+		batch:    batch,
+		calls:    calls,
+		question: buildToolConfirmQuestion(calls),
+	}
+
+	l.pendingConfirmMu.Lock()
+	previous := l.pendingConfirm
+	l.pendingConfirm = pending
+	pending.timer = time.AfterFunc(toolConfirmTimeout(), func() {
+		if l.takePendingToolConfirmation(pending) {
+			log.Infof("设备 %s 工具调用确认超时，已取消", l.clientState.DeviceID)
+			l.cancelPendingToolCalls(pending, toolDecisionTimeout, "", "用户未在规定时间内确认，操作已取消")
+			l.saveToolCallBatch(context.Background(), pending.batch)
+		}
+	})
+	l.pendingConfirmMu.Unlock()
+
+	if previous != nil {
+		previous.timer.Stop()
+		l.cancelPendingToolCalls(previous, toolDecisionUnclear, "", "用户未确认，操作已取消")
+		l.saveToolCallBatch(context.Background(), previous.batch)
+	}
+
+	log.Infof("设备 %s 等待用户确认工具调用: %s", l.clientState.DeviceID, pending.question)
+	if err := l.speakText(pending.question); err != nil {
+		log.Warnf("播报工具调用确认提问失败: %v", err)
+	}
+}
+
+// takePendingToolConfirmation 取走指定的待确认调用，已被其它路径处理时返回 false
+func (l *LLMManager) takePendingToolConfirmation(pending *pendingToolConfirmation) bool {
+	l.pendingConfirmMu.Lock()
+	defer l.pendingConfirmMu.Unlock()
+	if l.pendingConfirm != pending {
+		return false
+	}
+	l.pendingConfirm = nil
+	return true
+}
+
+// handlePendingToolConfirmation 用本轮用户回答处理待确认的工具调用。
+// 同意时执行并继续 LLM，拒绝时由 LLM 回复已取消，两者都返回 true；
+// 回答无法判断时取消待确认调用并返回 false，本轮按普通请求继续处理
+func (l *LLMManager) handlePendingToolConfirmation(ctx context.Context, text string) bool {
+	l.pendingConfirmMu.Lock()
+	pending := l.pendingConfirm
+	l.pendingConfirm = nil
+	l.pendingConfirmMu.Unlock()
+	if pending == nil {
+		return false
+	}
+	pending.timer.Stop()
+
+	switch intent.ClassifyConfirmation(text) {
+	case intent.ConfirmYes:
+		log.Infof("设备 %s 用户确认执行工具调用: answer=%q", l.clientState.DeviceID, text)
+		for _, pc := range pending.calls {
+			l.invokeToolCall(ctx, pc.call, pending.batch,
+				toolPolicyAudit(pc.call.Function.Name, pc.policy.Policy, toolDecisionApproved, pending.question, text))
+		}
+		l.finishToolCallBatch(ctx, pending.batch)
+		return true
+	case intent.ConfirmNo:
+		log.Infof("设备 %s 用户拒绝执行工具调用: answer=%q", l.clientState.DeviceID, text)
+		l.cancelPendingToolCalls(pending, toolDecisionRejected, text, "用户拒绝执行该操作")
+		pending.batch.continueLLM = true
+		l.finishToolCallBatch(ctx, pending.batch)
+		return true
+	default:
+		log.Infof("设备 %s 无法判断工具调用确认回答，已取消: answer=%q", l.clientState.DeviceID, text)
+		l.cancelPendingToolCalls(pending, toolDecisionUnclear, text, "用户未确认，操作已取消")
+		l.saveToolCallBatch(ctx, pending.batch)
+		return false
+	}
+}
+
+func (l *LLMManager) cancelPendingToolCalls(pending *pendingToolConfirmation, decision, answer, result string) {
+	for _, pc := range pending.calls {
+		pending.batch.addResult(pc.call, result,
+			toolPolicyAudit(pc.call.Function.Name, pc.policy.Policy, decision, pending.question, answer))
+	}
+}
+
+// saveToolCallBatch 写入本批工具调用的消息并等待音频/资源播放结束
+func (l *LLMManager) saveToolCallBatch(ctx context.Context, batch *toolCallBatch) {
+	for _, item := range batch.messages {
+		msg := item.msg
+		// 过滤掉Content为空的assistant消息，避免保存到历史记录中
+		// 空的assistant消息会导致后续LLM调用时出现400错误
+		if msg != nil && msg.Role == schema.Assistant && msg.Content == "" && len(msg.ToolCalls) == 0 {
+			log.Debugf("跳过保存空的assistant消息")
+			continue
+		}
+		l.AddMessageWithMetadata(ctx, msg, item.metadata)
+	}
+	batch.messages = nil
+
+	batch.wg.Wait()
+}
+
+// finishToolCallBatch 保存本批消息，处理退出/转接，并按需继续 LLM 调用
+func (l *LLMManager) finishToolCallBatch(ctx context.Context, batch *toolCallBatch) bool {
+	l.saveToolCallBatch(ctx, batch)
+
+	if batch.exit {
+		// 发布退出聊天事件
+		eventbus.Get().Publish(eventbus.TopicExitChat, &eventbus.ExitChatEvent{
+			ClientState: l.clientState,
+			Reason:      "工具调用退出",
+			TriggerType: "tool_call",
+			UserText:    "",
+			Timestamp:   time.Now(),
+		})
+
+		return batch.invokeSuccess
+	}
+
+	// 如果工具调用成功且没有被标记为停止处理，则继续LLM调用
+	if (batch.invokeSuccess || batch.continueLLM) && !batch.stopLLM {
+		if batch.handoff && l.session != nil {
+			l.session.continueAfterHandoff(ctx)
+		} else {
+			l.continueWithToolResults(ctx)
+		}
+	}
+
+	return batch.invokeSuccess
+}
+
+// speakText 把文本直接送入 TTS 播报
+func (l *LLMManager) speakText(text string) error {
+	if l.speakFunc != nil {
+		return l.speakFunc(text)
+	}
+	return l.AddTextToTTSQueue(text)
+}
+
+// continueWithToolResults 带着工具结果继续请求 LLM
+func (l *LLMManager) continueWithToolResults(ctx context.Context) {
+	if l.continueLLMFunc != nil {
+		l.continueLLMFunc(ctx)
+		return
+	}
+	l.DoLLmRequest(ctx, nil, l.einoTools, true, nil)
+}
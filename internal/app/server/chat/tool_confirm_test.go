@@ -0,0 +1,200 @@
+package chat
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/spf13/viper"
+
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+	"xiaozhi-esp32-server-golang/internal/domain/eventbus"
+	"xiaozhi-esp32-server-golang/internal/domain/intent"
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+)
+
+// toolConfirmRecorder 记录确认流程的播报、继续 LLM 次数与写入历史的消息
+type toolConfirmRecorder struct {
+	mu        sync.Mutex
+	spoken    []string
+	continued int
+	saved     []*eventbus.AddMessageEvent
+}
+
+func (r *toolConfirmRecorder) onAddMessage(event *eventbus.AddMessageEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.saved = append(r.saved, event)
+}
+
+func (r *toolConfirmRecorder) savedMessages() []*eventbus.AddMessageEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*eventbus.AddMessageEvent(nil), r.saved...)
+}
+
+func newToolConfirmTestManager(t *testing.T) (*LLMManager, *toolConfirmRecorder) {
+	t.Helper()
+	// 确认后执行的工具走真实查找路径，未注册的工具返回“未找到工具”
+	mcp.GetGlobalMCPManager()
+
+	rec := &toolConfirmRecorder{}
+	bus := eventbus.Get()
+	if err := bus.Subscribe(eventbus.TopicAddMessage, rec.onAddMessage); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bus.Unsubscribe(eventbus.TopicAddMessage, rec.onAddMessage) })
+
+	state := &ClientState{
+		DeviceID:  "dev-confirm",
+		SessionID: "session-confirm",
+		Dialogue:  &Dialogue{},
+	}
+	l := &LLMManager{
+		clientState:   state,
+		lastMessageID: make(map[string]string),
+		speakFunc: func(text string) error {
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			rec.spoken = append(rec.spoken, text)
+			return nil
+		},
+		continueLLMFunc: func(ctx context.Context) {
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			rec.continued++
+		},
+	}
+	return l, rec
+}
+
+// newConfirmBatch 一次回复中调用两个工具：lamp_status 直接执行，door_unlock 需要确认
+func newConfirmBatch() (*toolCallBatch, []pendingToolCall) {
+	allowed := schema.ToolCall{ID: "call-1", Function: schema.FunctionCall{Name: "lamp_status", Arguments: "{}"}}
+	confirm := schema.ToolCall{ID: "call-2", Function: schema.FunctionCall{Name: "door_unlock", Arguments: "{}"}}
+	batch := &toolCallBatch{}
+	batch.messages = append(batch.messages, toolBatchMessage{msg: &schema.Message{
+		Role:      schema.Assistant,
+		ToolCalls: []schema.ToolCall{allowed, confirm},
+	}})
+	batch.addResult(allowed, "灯已开", toolPolicyAudit(allowed.Function.Name, intent.ToolPolicyAllow, toolDecisionAllowed, "", ""))
+	calls := []pendingToolCall{{call: confirm, policy: types.ToolPolicy{Tool: "door_unlock", Policy: intent.ToolPolicyConfirm, Prompt: "确定要开门吗？"}}}
+	return batch, calls
+}
+
+func toolPolicyDecision(t *testing.T, event *eventbus.AddMessageEvent) map[string]interface{} {
+	t.Helper()
+	audit, ok := event.Metadata["tool_policy"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("message %q has no tool_policy metadata: %+v", event.Msg.Content, event.Metadata)
+	}
+	return audit
+}
+
+// assertConfirmBatchSaved 整批消息按 assistant 工具调用、直接执行结果、确认结果的顺序写入
+func assertConfirmBatchSaved(t *testing.T, saved []*eventbus.AddMessageEvent, decision, answer string) {
+	t.Helper()
+	if len(saved) != 3 {
+		t.Fatalf("expected 3 saved messages, got %d", len(saved))
+	}
+	if saved[0].Msg.Role != schema.Assistant || len(saved[0].Msg.ToolCalls) != 2 {
+		t.Fatalf("expected assistant tool call message first, got %+v", saved[0].Msg)
+	}
+	if saved[1].Msg.ToolCallID != "call-1" || toolPolicyDecision(t, saved[1])["decision"] != toolDecisionAllowed {
+		t.Fatalf("expected allowed result second, got %+v", saved[1].Msg)
+	}
+	audit := toolPolicyDecision(t, saved[2])
+	if saved[2].Msg.ToolCallID != "call-2" || audit["decision"] != decision {
+		t.Fatalf("expected %s result last, got %+v %+v", decision, saved[2].Msg, audit)
+	}
+	if audit["question"] != "确定要开门吗？" {
+		t.Fatalf("expected question in audit, got %+v", audit)
+	}
+	if answer != "" && audit["answer"] != answer {
+		t.Fatalf("expected answer %q in audit, got %+v", answer, audit)
+	}
+}
+
+func TestHandlePendingToolConfirmationYes(t *testing.T) {
+	l, rec := newToolConfirmTestManager(t)
+	batch, calls := newConfirmBatch()
+
+	l.awaitToolConfirmation(batch, calls)
+	if len(rec.spoken) != 1 || rec.spoken[0] != "确定要开门吗？" {
+		t.Fatalf("expected confirm question to be spoken, got %v", rec.spoken)
+	}
+	if len(rec.savedMessages()) != 0 {
+		t.Fatal("batch should not be saved while waiting for confirmation")
+	}
+
+	if !l.handlePendingToolConfirmation(context.Background(), "好的") {
+		t.Fatal("expected yes answer to be consumed")
+	}
+	saved := rec.savedMessages()
+	assertConfirmBatchSaved(t, saved, toolDecisionApproved, "好的")
+	if saved[2].Msg.Content != "未找到工具: door_unlock" {
+		t.Fatalf("expected confirmed tool to be invoked, got %q", saved[2].Msg.Content)
+	}
+	if l.handlePendingToolConfirmation(context.Background(), "好的") {
+		t.Fatal("pending confirmation should be cleared")
+	}
+}
+
+func TestHandlePendingToolConfirmationNo(t *testing.T) {
+	l, rec := newToolConfirmTestManager(t)
+	batch, calls := newConfirmBatch()
+
+	l.awaitToolConfirmation(batch, calls)
+	if !l.handlePendingToolConfirmation(context.Background(), "不要") {
+		t.Fatal("expected no answer to be consumed")
+	}
+	saved := rec.savedMessages()
+	assertConfirmBatchSaved(t, saved, toolDecisionRejected, "不要")
+	if saved[2].Msg.Content != "用户拒绝执行该操作" {
+		t.Fatalf("unexpected rejected result %q", saved[2].Msg.Content)
+	}
+	// 拒绝后由 LLM 组织回复
+	if rec.continued != 1 {
+		t.Fatalf("expected LLM to continue once, got %d", rec.continued)
+	}
+}
+
+func TestHandlePendingToolConfirmationUnclear(t *testing.T) {
+	l, rec := newToolConfirmTestManager(t)
+	batch, calls := newConfirmBatch()
+
+	l.awaitToolConfirmation(batch, calls)
+	if l.handlePendingToolConfirmation(context.Background(), "今天天气怎么样") {
+		t.Fatal("unclear answer should be handled as a new request")
+	}
+	assertConfirmBatchSaved(t, rec.savedMessages(), toolDecisionUnclear, "今天天气怎么样")
+	if rec.continued != 0 {
+		t.Fatalf("unclear answer should not continue the cancelled batch, got %d", rec.continued)
+	}
+}
+
+func TestAwaitToolConfirmationTimeout(t *testing.T) {
+	viper.Set("chat.tool_confirm_timeout", 20*time.Millisecond)
+	t.Cleanup(func() { viper.Set("chat.tool_confirm_timeout", nil) })
+
+	l, rec := newToolConfirmTestManager(t)
+	batch, calls := newConfirmBatch()
+
+	l.awaitToolConfirmation(batch, calls)
+	deadline := time.Now().Add(2 * time.Second)
+	for len(rec.savedMessages()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	saved := rec.savedMessages()
+	assertConfirmBatchSaved(t, saved, toolDecisionTimeout, "")
+	if saved[2].Msg.Content != "用户未在规定时间内确认，操作已取消" {
+		t.Fatalf("unexpected timeout result %q", saved[2].Msg.Content)
+	}
+	// 超时后迟到的回答按普通请求处理
+	if l.handlePendingToolConfirmation(context.Background(), "好的") {
+		t.Fatal("late answer should not be consumed after timeout")
+	}
+}
@@ -12,9 +12,12 @@ import (
 	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
 	"xiaozhi-esp32-server-golang/internal/domain/tts"
 	ttsstream "xiaozhi-esp32-server-golang/internal/domain/tts/streaming"
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
 	"xiaozhi-esp32-server-golang/internal/pool"
 	"xiaozhi-esp32-server-golang/internal/util"
 	log "xiaozhi-esp32-server-golang/logger"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // 会话级全局音频队列元素类型常量
@@ -1231,14 +1234,23 @@ func (t *TTSManager) generateTtsOnly(ctx context.Context, metricCycle uint64, ll
 	}
 	ttsProviderInstance := ttsWrapper.GetProvider()
 	t.markTtsMetricRequestStart(ctx, metricCycle)
-	ch, err := ttsProviderInstance.TextToSpeechStream(ctx, llmResponse.Text, t.clientState.OutputAudioFormat.SampleRate, t.clientState.OutputAudioFormat.Channels, t.clientState.OutputAudioFormat.FrameDuration)
+	// 每句一个 span，发送完成（releaseFunc）时结束
+	spanCtx, span := t.session.startTurnChildSpan(ctx, "tts.sentence",
+		attribute.String("tts.provider", t.session.metricProvider(chathooks.MetricTtsStart)),
+		attribute.Int("tts.text_len", len([]rune(llmResponse.Text))),
+	)
+	ch, err := ttsProviderInstance.TextToSpeechStream(spanCtx, llmResponse.Text, t.clientState.OutputAudioFormat.SampleRate, t.clientState.OutputAudioFormat.Channels, t.clientState.OutputAudioFormat.FrameDuration)
 	if err != nil {
+		tracing.End(span, err)
 		pool.Release(ttsWrapper)
 		t.finishTtsMetricRequest(ctx, metricCycle, err)
 		log.Errorf("生成 TTS 音频失败: %v", err)
 		return nil, nil, fmt.Errorf("生成 TTS 音频失败: %v", err)
 	}
-	return ch, func() { pool.Release(ttsWrapper) }, nil
+	return ch, func() {
+		span.End()
+		pool.Release(ttsWrapper)
+	}, nil
 }
 
 // handleDualStreamTts 真正的双流式 TTS：将 StreamChan 里的文本流式输入给 TTS provider，同时流式输出音频。
@@ -1263,7 +1275,11 @@ func (t *TTSManager) handleDualStreamTts(item TTSQueueItem) (bool, error) {
 
 	textChan := make(chan string, 16)
 	t.markTtsMetricRequestStart(item.ctx, item.metricCycle)
-	eventChan, err := dp.StreamingSynthesize(item.ctx, textChan,
+	spanCtx, span := t.session.startTurnChildSpan(item.ctx, "tts.stream",
+		attribute.String("tts.provider", t.session.metricProvider(chathooks.MetricTtsStart)),
+	)
+	defer span.End()
+	eventChan, err := dp.StreamingSynthesize(spanCtx, textChan,
 		t.clientState.OutputAudioFormat.SampleRate,
 		t.clientState.OutputAudioFormat.Channels,
 		t.clientState.OutputAudioFormat.FrameDuration)
@@ -0,0 +1,155 @@
+package chat
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	chathooks "xiaozhi-esp32-server-golang/internal/domain/chat/hooks"
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
+)
+
+// turnTraceState 保存当前轮次的 root span 以及跨回调的阶段 span（VAD 片段、ASR 流）
+type turnTraceState struct {
+	mu   sync.Mutex
+	turn trace.Span
+	asr  trace.Span
+	vad  trace.Span
+}
+
+// startTurnSpan 开启新一轮的 root span；上一轮若未结束则先关闭
+func (s *ChatSession) startTurnSpan(ctx context.Context, ts int64) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	startTime := msToTime(ts)
+
+	s.turnTrace.mu.Lock()
+	defer s.turnTrace.mu.Unlock()
+	if s.turnTrace.turn != nil {
+		s.turnTrace.turn.SetAttributes(attribute.Bool("turn.superseded", true))
+		s.endTurnSpansLocked(startTime, nil)
+	}
+
+	attrs := []attribute.KeyValue{}
+	if s.clientState != nil {
+		attrs = append(attrs,
+			attribute.String("device.id", s.clientState.DeviceID),
+			attribute.String("agent.id", s.clientState.AgentID),
+			attribute.String("session.id", s.clientState.SessionID),
+		)
+	}
+	turnCtx, turn := tracing.Tracer().Start(ctx, "chat.turn",
+		trace.WithNewRoot(),
+		trace.WithTimestamp(startTime),
+		trace.WithAttributes(attrs...),
+	)
+	s.turnTrace.turn = turn
+	_, s.turnTrace.asr = tracing.Tracer().Start(turnCtx, "asr.stream",
+		trace.WithTimestamp(startTime),
+		trace.WithAttributes(attribute.String("asr.provider", s.metricProvider(chathooks.MetricAsrFinalText))),
+	)
+}
+
+// endTurnSpan 结束当前轮次的 root span 及未关闭的阶段 span
+func (s *ChatSession) endTurnSpan(ts int64, err error) {
+	s.turnTrace.mu.Lock()
+	defer s.turnTrace.mu.Unlock()
+	s.endTurnSpansLocked(msToTime(ts), err)
+}
+
+func (s *ChatSession) endTurnSpansLocked(endTime time.Time, err error) {
+	for _, span := range []*trace.Span{&s.turnTrace.vad, &s.turnTrace.asr, &s.turnTrace.turn} {
+		if *span == nil {
+			continue
+		}
+		endSpanAt(*span, endTime, err)
+		*span = nil
+	}
+}
+
+// endAsrSpan 在拿到 ASR 最终结果时结束 ASR 流 span
+func (s *ChatSession) endAsrSpan(ts int64) {
+	s.turnTrace.mu.Lock()
+	defer s.turnTrace.mu.Unlock()
+	if s.turnTrace.asr != nil {
+		endSpanAt(s.turnTrace.asr, msToTime(ts), nil)
+		s.turnTrace.asr = nil
+	}
+}
+
+// startVadSegmentSpan 在 VAD 首次检测到语音时开启片段 span，已存在时忽略
+func (s *ChatSession) startVadSegmentSpan() {
+	if s == nil {
+		return
+	}
+	s.turnTrace.mu.Lock()
+	defer s.turnTrace.mu.Unlock()
+	if s.turnTrace.vad != nil || s.turnTrace.turn == nil {
+		return
+	}
+	ctx := trace.ContextWithSpan(context.Background(), s.turnTrace.turn)
+	_, s.turnTrace.vad = tracing.Tracer().Start(ctx, "vad.segment")
+}
+
+// endVadSegmentSpan 在判定语音结束（或语音过短被丢弃）时结束片段 span
+func (s *ChatSession) endVadSegmentSpan(discarded bool) {
+	if s == nil {
+		return
+	}
+	s.turnTrace.mu.Lock()
+	defer s.turnTrace.mu.Unlock()
+	if s.turnTrace.vad == nil {
+		return
+	}
+	s.turnTrace.vad.SetAttributes(attribute.Bool("vad.discarded", discarded))
+	s.turnTrace.vad.End()
+	s.turnTrace.vad = nil
+}
+
+// annotateVadSegmentSpan 给当前 VAD 片段 span 追加属性，span 不存在时忽略
+func (s *ChatSession) annotateVadSegmentSpan(attrs ...attribute.KeyValue) {
+	if s == nil {
+		return
+	}
+	s.turnTrace.mu.Lock()
+	defer s.turnTrace.mu.Unlock()
+	if s.turnTrace.vad != nil {
+		s.turnTrace.vad.SetAttributes(attrs...)
+	}
+}
+
+// startTurnChildSpan 创建阶段 span：ctx 中已有 span 时作为其子 span，否则挂到当前轮次下
+func (s *ChatSession) startTurnChildSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if s != nil && !trace.SpanContextFromContext(ctx).IsValid() {
+		s.turnTrace.mu.Lock()
+		turn := s.turnTrace.turn
+		s.turnTrace.mu.Unlock()
+		if turn != nil {
+			ctx = trace.ContextWithSpan(ctx, turn)
+		}
+	}
+	return tracing.Start(ctx, name, attrs...)
+}
+
+func endSpanAt(span trace.Span, endTime time.Time, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(trace.WithTimestamp(endTime))
+}
+
+func msToTime(ts int64) time.Time {
+	if ts <= 0 {
+		return time.Now()
+	}
+	return time.UnixMilli(ts)
+}
@@ -0,0 +1,50 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
+)
+
+func TestTurnSpanParentsStageSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracing.SetTracerProvider(tracing.NewTracerProvider(tracing.Config{}, sdktrace.WithSyncer(exporter)))
+
+	s := &ChatSession{clientState: &ClientState{DeviceID: "dev-1", AgentID: "agent-1"}}
+	start := time.Now().UnixMilli()
+	s.startTurnSpan(context.Background(), start)
+	s.startVadSegmentSpan()
+	s.endVadSegmentSpan(false)
+	s.endAsrSpan(time.Now().UnixMilli())
+	_, llmSpan := s.startTurnChildSpan(context.Background(), "llm.round")
+	llmSpan.End()
+	s.endTurnSpan(time.Now().UnixMilli(), nil)
+
+	spans := exporter.GetSpans()
+	byName := map[string]tracetest.SpanStub{}
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	turn, ok := byName["chat.turn"]
+	if !ok {
+		t.Fatalf("expected chat.turn span, got %d spans", len(spans))
+	}
+	for _, name := range []string{"vad.segment", "asr.stream", "llm.round"} {
+		span, ok := byName[name]
+		if !ok {
+			t.Fatalf("expected %s span", name)
+		}
+		if span.Parent.SpanID() != turn.SpanContext.SpanID() {
+			t.Fatalf("expected %s to be a child of chat.turn", name)
+		}
+	}
+	if turn.StartTime.UnixMilli() != start {
+		t.Fatalf("expected turn start %d, got %d", start, turn.StartTime.UnixMilli())
+	}
+}
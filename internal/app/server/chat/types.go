@@ -24,6 +24,12 @@ type ChatSessionOperator interface {
 	// LocalMcpRestoreDeviceDefaultRole 恢复设备默认角色
 	LocalMcpRestoreDeviceDefaultRole(ctx context.Context) error
 
+	// LocalMcpTransferToAgent 将对话转接给同一用户下的其它智能体，返回目标智能体名称
+	LocalMcpTransferToAgent(ctx context.Context, agentName string, request string, stay bool) (string, error)
+
+	// LocalMcpReturnToAgent 结束转接并返回原智能体，返回原智能体名称
+	LocalMcpReturnToAgent(ctx context.Context) (string, error)
+
 	// LocalMcpSearchKnowledge 检索当前智能体关联知识库
 	LocalMcpSearchKnowledge(ctx context.Context, query string, topK int, knowledgeBaseIDs []uint) ([]config_types.KnowledgeSearchHit, error)
 
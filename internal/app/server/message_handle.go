@@ -285,10 +285,17 @@ func (w *MessageWorker) saveMessageText(ctx context.Context, event *eventbus.Add
 		}
 	}
 
-	// 构建 Metadata（只保存时间戳）
+	// 构建 Metadata（时间戳与所属 A/B 实验分组）
 	metadata := map[string]interface{}{
 		"timestamp": event.Timestamp.Format(time.RFC3339),
 	}
+	if exp := event.ClientState.DeviceConfig.Experiment; exp != nil {
+		metadata["experiment_id"] = exp.ID
+		metadata["experiment_variant"] = exp.Variant
+	}
+	for k, v := range event.Metadata {
+		metadata[k] = v
+	}
 
 	// 准备工具调用相关字段
 	var toolCallID string
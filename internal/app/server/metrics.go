@@ -0,0 +1,228 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+
+	chathooks "xiaozhi-esp32-server-golang/internal/domain/chat/hooks"
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+	"xiaozhi-esp32-server-golang/internal/pkg/metrics"
+	"xiaozhi-esp32-server-golang/internal/pool"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const defaultMetricsPath = "/metrics"
+
+var (
+	activeSessionsDesc = prometheus.NewDesc(
+		"xiaozhi_active_sessions",
+		"Active chat sessions by transport.",
+		[]string{"transport"}, nil,
+	)
+	poolResourcesDesc = prometheus.NewDesc(
+		"xiaozhi_pool_resources",
+		"Resources held by each resource pool, by state.",
+		[]string{"type", "pool", "state"}, nil,
+	)
+	poolMaxSizeDesc = prometheus.NewDesc(
+		"xiaozhi_pool_max_size",
+		"Configured maximum size of each resource pool.",
+		[]string{"type", "pool"}, nil,
+	)
+	mcpGlobalServerUpDesc = prometheus.NewDesc(
+		"xiaozhi_mcp_global_server_up",
+		"Whether the global MCP server is connected (1) or not (0).",
+		[]string{"server"}, nil,
+	)
+	mcpDeviceSessionsDesc = prometheus.NewDesc(
+		"xiaozhi_mcp_device_sessions",
+		"Devices holding an MCP session.",
+		nil, nil,
+	)
+	mcpDeviceConnectionsDesc = prometheus.NewDesc(
+		"xiaozhi_mcp_device_connections",
+		"Device MCP connections by kind and state.",
+		[]string{"kind", "state"}, nil,
+	)
+	hookQueueLengthDesc = prometheus.NewDesc(
+		"xiaozhi_hook_async_queue_length",
+		"Pending tasks in the shared chat hook observer queue.",
+		nil, nil,
+	)
+	hookDroppedDesc = prometheus.NewDesc(
+		"xiaozhi_hook_async_dropped_total",
+		"Observer tasks dropped because the queue was full.",
+		nil, nil,
+	)
+	hookPluginInvocationsDesc = prometheus.NewDesc(
+		"xiaozhi_hook_plugin_invocations_total",
+		"Chat hook plugin invocations.",
+		[]string{"plugin"}, nil,
+	)
+	hookPluginErrorsDesc = prometheus.NewDesc(
+		"xiaozhi_hook_plugin_errors_total",
+		"Chat hook plugin errors.",
+		[]string{"plugin"}, nil,
+	)
+	hookPluginStopsDesc = prometheus.NewDesc(
+		"xiaozhi_hook_plugin_stops_total",
+		"Chat hook interceptor stops.",
+		[]string{"plugin"}, nil,
+	)
+	hookPluginTimeoutsDesc = prometheus.NewDesc(
+		"xiaozhi_hook_plugin_timeouts_total",
+		"Chat hook observer timeouts.",
+		[]string{"plugin"}, nil,
+	)
+	hookPluginDroppedDesc = prometheus.NewDesc(
+		"xiaozhi_hook_plugin_dropped_total",
+		"Chat hook observer tasks dropped per plugin.",
+		[]string{"plugin"}, nil,
+	)
+	hookPluginDurationDesc = prometheus.NewDesc(
+		"xiaozhi_hook_plugin_duration_seconds_total",
+		"Total time spent in each chat hook plugin.",
+		[]string{"plugin"}, nil,
+	)
+)
+
+// appCollector 在抓取时按需读取会话、资源池、MCP 与 hook 状态
+type appCollector struct {
+	app *App
+}
+
+func (c *appCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeSessionsDesc
+	ch <- poolResourcesDesc
+	ch <- poolMaxSizeDesc
+	ch <- mcpGlobalServerUpDesc
+	ch <- mcpDeviceSessionsDesc
+	ch <- mcpDeviceConnectionsDesc
+	ch <- hookQueueLengthDesc
+	ch <- hookDroppedDesc
+	ch <- hookPluginInvocationsDesc
+	ch <- hookPluginErrorsDesc
+	ch <- hookPluginStopsDesc
+	ch <- hookPluginTimeoutsDesc
+	ch <- hookPluginDroppedDesc
+	ch <- hookPluginDurationDesc
+}
+
+func (c *appCollector) Collect(ch chan<- prometheus.Metric) {
+	c.collectSessions(ch)
+	collectPools(ch)
+	collectMCP(ch)
+	collectHooks(ch)
+}
+
+func (c *appCollector) collectSessions(ch chan<- prometheus.Metric) {
+	counts := map[string]int{}
+	for _, manager := range c.app.GetAllChatManagers() {
+		transport := manager.GetTransportType()
+		if transport == "" {
+			transport = "unknown"
+		}
+		counts[transport]++
+	}
+	for transport, count := range counts {
+		ch <- prometheus.MustNewConstMetric(activeSessionsDesc, prometheus.GaugeValue, float64(count), transport)
+	}
+}
+
+func collectPools(ch chan<- prometheus.Metric) {
+	for poolKey, raw := range pool.GetStats() {
+		stats, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		resourceType := poolKey
+		if idx := strings.Index(poolKey, ":"); idx > 0 {
+			resourceType = poolKey[:idx]
+		}
+		for _, state := range []struct{ key, label string }{
+			{"total_resources", "total"},
+			{"available_resources", "available"},
+			{"in_use_resources", "in_use"},
+		} {
+			if v, ok := stats[state.key].(int); ok {
+				ch <- prometheus.MustNewConstMetric(poolResourcesDesc, prometheus.GaugeValue, float64(v), resourceType, poolKey, state.label)
+			}
+		}
+		if v, ok := stats["max_size"].(int); ok {
+			ch <- prometheus.MustNewConstMetric(poolMaxSizeDesc, prometheus.GaugeValue, float64(v), resourceType, poolKey)
+		}
+	}
+}
+
+func collectMCP(ch chan<- prometheus.Metric) {
+	for name, connected := range mcp.GetGlobalMCPManager().ServerStates() {
+		ch <- prometheus.MustNewConstMetric(mcpGlobalServerUpDesc, prometheus.GaugeValue, boolToFloat(connected), name)
+	}
+
+	stats := mcp.GetDeviceConnectionStats()
+	ch <- prometheus.MustNewConstMetric(mcpDeviceSessionsDesc, prometheus.GaugeValue, float64(stats.Devices))
+	ch <- prometheus.MustNewConstMetric(mcpDeviceConnectionsDesc, prometheus.GaugeValue, float64(stats.WsEndpointConnected), "ws_endpoint", "connected")
+	ch <- prometheus.MustNewConstMetric(mcpDeviceConnectionsDesc, prometheus.GaugeValue, float64(stats.WsEndpointDisconnected), "ws_endpoint", "disconnected")
+	ch <- prometheus.MustNewConstMetric(mcpDeviceConnectionsDesc, prometheus.GaugeValue, float64(stats.IotConnected), "iot_over_mcp", "connected")
+	ch <- prometheus.MustNewConstMetric(mcpDeviceConnectionsDesc, prometheus.GaugeValue, float64(stats.IotDisconnected), "iot_over_mcp", "disconnected")
+}
+
+func collectHooks(ch chan<- prometheus.Metric) {
+	stats := chathooks.AggregateStats()
+	ch <- prometheus.MustNewConstMetric(hookQueueLengthDesc, prometheus.GaugeValue, float64(stats.AsyncQueueLength))
+	ch <- prometheus.MustNewConstMetric(hookDroppedDesc, prometheus.CounterValue, float64(stats.DroppedAsync))
+
+	names := make([]string, 0, len(stats.Plugins))
+	for name := range stats.Plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		st := stats.Plugins[name]
+		ch <- prometheus.MustNewConstMetric(hookPluginInvocationsDesc, prometheus.CounterValue, float64(st.Invocations), name)
+		ch <- prometheus.MustNewConstMetric(hookPluginErrorsDesc, prometheus.CounterValue, float64(st.Errors), name)
+		ch <- prometheus.MustNewConstMetric(hookPluginStopsDesc, prometheus.CounterValue, float64(st.Stops), name)
+		ch <- prometheus.MustNewConstMetric(hookPluginTimeoutsDesc, prometheus.CounterValue, float64(st.Timeouts), name)
+		ch <- prometheus.MustNewConstMetric(hookPluginDroppedDesc, prometheus.CounterValue, float64(st.DroppedAsync), name)
+		ch <- prometheus.MustNewConstMetric(hookPluginDurationDesc, prometheus.CounterValue, float64(st.TotalDurationMs)/1000, name)
+	}
+}
+
+func boolToFloat(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// registerMetrics 按配置暴露 /metrics：需显式开启 server.metrics.enable；
+// 配置 server.metrics.listen 时在独立地址上监听，否则挂载在 websocket 端口上（该端口没有鉴权，公网部署建议使用独立地址）
+func (a *App) registerMetrics() {
+	if !viper.GetBool("server.metrics.enable") {
+		return
+	}
+	path := viper.GetString("server.metrics.path")
+	if path == "" {
+		path = defaultMetricsPath
+	}
+	metrics.MustRegister(&appCollector{app: a})
+
+	listen := strings.TrimSpace(viper.GetString("server.metrics.listen"))
+	if listen == "" {
+		http.Handle(path, metrics.Handler())
+		log.Infof("metrics 端点: http://0.0.0.0:%d%s", viper.GetInt("websocket.port"), path)
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle(path, metrics.Handler())
+	go func() {
+		log.Infof("metrics 端点: http://%s%s", listen, path)
+		if err := http.ListenAndServe(listen, mux); err != nil {
+			log.Errorf("metrics 服务启动失败: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,240 @@
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+)
+
+// 录制文件格式：gzip(magic + 记录...)，每条记录为
+// kind(1 字节) + 相对开始时间的微秒偏移(uvarint) + 数据长度(uvarint) + 数据
+const (
+	archiveMagic = "XZREC\x01"
+	FileExt      = ".xzrec"
+)
+
+// Kind 录制事件类型
+type Kind uint8
+
+const (
+	KindMeta     Kind = 1 // 录制元信息（JSON）
+	KindConfig   Kind = 2 // 解析后的 UConfig（JSON，已脱敏）
+	KindCmdIn    Kind = 3 // 设备 -> 服务端 信令
+	KindCmdOut   Kind = 4 // 服务端 -> 设备 信令
+	KindAudioIn  Kind = 5 // 设备 -> 服务端 音频帧
+	KindAudioOut Kind = 6 // 服务端 -> 设备 音频帧
+	KindClose    Kind = 7 // 连接关闭
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindMeta:
+		return "meta"
+	case KindConfig:
+		return "config"
+	case KindCmdIn:
+		return "cmd_in"
+	case KindCmdOut:
+		return "cmd_out"
+	case KindAudioIn:
+		return "audio_in"
+	case KindAudioOut:
+		return "audio_out"
+	case KindClose:
+		return "close"
+	default:
+		return fmt.Sprintf("kind(%d)", uint8(k))
+	}
+}
+
+// Meta 录制元信息
+type Meta struct {
+	DeviceID  string    `json:"device_id"`
+	Transport string    `json:"transport"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Event 一条录制事件
+type Event struct {
+	Kind   Kind
+	Offset time.Duration
+	Data   []byte
+}
+
+// Recording 读取后的完整录制内容
+type Recording struct {
+	Meta   Meta
+	Config *types.UConfig
+	Events []Event
+}
+
+// Writer 以追加方式写入录制事件，可并发调用
+type Writer struct {
+	mu     sync.Mutex
+	out    io.WriteCloser
+	gz     *gzip.Writer
+	start  time.Time
+	closed bool
+	header [1 + 2*binary.MaxVarintLen64]byte
+}
+
+// NewWriter 写入文件头与元信息，out 在 Close 时一并关闭
+func NewWriter(out io.WriteCloser, meta Meta) (*Writer, error) {
+	if meta.StartedAt.IsZero() {
+		meta.StartedAt = time.Now()
+	}
+	w := &Writer{
+		out:   out,
+		gz:    gzip.NewWriter(out),
+		start: meta.StartedAt,
+	}
+	if _, err := w.gz.Write([]byte(archiveMagic)); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Write(KindMeta, data); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write 写入一条事件，偏移量取当前时间
+func (w *Writer) Write(kind Kind, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return errors.New("recorder closed")
+	}
+	offset := time.Since(w.start)
+	if offset < 0 {
+		offset = 0
+	}
+	w.header[0] = byte(kind)
+	n := 1
+	n += binary.PutUvarint(w.header[n:], uint64(offset/time.Microsecond))
+	n += binary.PutUvarint(w.header[n:], uint64(len(data)))
+	if _, err := w.gz.Write(w.header[:n]); err != nil {
+		return err
+	}
+	_, err := w.gz.Write(data)
+	return err
+}
+
+// WriteJSON 以 JSON 形式写入一条事件
+func (w *Writer) WriteJSON(kind Kind, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return w.Write(kind, data)
+}
+
+// Close 刷新压缩流并关闭底层输出，可重复调用
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	gzErr := w.gz.Close()
+	outErr := w.out.Close()
+	if gzErr != nil {
+		return gzErr
+	}
+	return outErr
+}
+
+// ReadFile 读取录制文件
+func ReadFile(path string) (*Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Read 解析录制内容；文件尾部不完整（如进程异常退出）时返回已读出的部分
+func Read(r io.Reader) (*Recording, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("打开录制文件失败: %w", err)
+	}
+	defer gz.Close()
+	br := bufio.NewReader(gz)
+
+	magic := make([]byte, len(archiveMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, []byte(archiveMagic)) {
+		return nil, errors.New("不是有效的录制文件")
+	}
+
+	rec := &Recording{}
+	for {
+		event, err := readEvent(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if len(rec.Events) > 0 && (errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, gzip.ErrChecksum)) {
+				break
+			}
+			return nil, err
+		}
+		switch event.Kind {
+		case KindMeta:
+			if err := json.Unmarshal(event.Data, &rec.Meta); err != nil {
+				return nil, fmt.Errorf("解析录制元信息失败: %w", err)
+			}
+		case KindConfig:
+			cfg := types.UConfig{}
+			if err := json.Unmarshal(event.Data, &cfg); err != nil {
+				return nil, fmt.Errorf("解析录制配置失败: %w", err)
+			}
+			rec.Config = &cfg
+		default:
+			rec.Events = append(rec.Events, event)
+		}
+	}
+	return rec, nil
+}
+
+func readEvent(br *bufio.Reader) (Event, error) {
+	kind, err := br.ReadByte()
+	if err != nil {
+		return Event{}, err
+	}
+	offset, err := binary.ReadUvarint(br)
+	if err != nil {
+		return Event{}, unexpected(err)
+	}
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return Event{}, unexpected(err)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return Event{}, unexpected(err)
+	}
+	return Event{Kind: Kind(kind), Offset: time.Duration(offset) * time.Microsecond, Data: data}, nil
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,225 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/types"
+	config_types "xiaozhi-esp32-server-golang/internal/domain/config/types"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const defaultDir = "recordings"
+
+// Options 录制选项
+type Options struct {
+	Dir               string          // 录制文件目录
+	RecordOutputAudio bool            // 是否录制下行音频（体积较大，回放对比不依赖它）
+	Devices           map[string]bool // 仅录制这些设备，为空表示全部
+}
+
+// OptionsFromViper 读取 recorder 配置，未启用时返回 false
+func OptionsFromViper() (Options, bool) {
+	if !viper.GetBool("recorder.enable") {
+		return Options{}, false
+	}
+	opts := Options{
+		Dir:               viper.GetString("recorder.dir"),
+		RecordOutputAudio: !viper.IsSet("recorder.record_output_audio") || viper.GetBool("recorder.record_output_audio"),
+	}
+	if devices := viper.GetStringSlice("recorder.devices"); len(devices) > 0 {
+		opts.Devices = make(map[string]bool, len(devices))
+		for _, d := range devices {
+			if d = strings.TrimSpace(d); d != "" {
+				opts.Devices[d] = true
+			}
+		}
+	}
+	return opts, true
+}
+
+// ShouldRecord 判断设备是否在录制范围内
+func (o Options) ShouldRecord(deviceID string) bool {
+	return len(o.Devices) == 0 || o.Devices[deviceID]
+}
+
+// Conn 包装 types.IConn，将收发的信令与音频写入录制文件
+type Conn struct {
+	types.IConn
+
+	writer            *Writer
+	path              string
+	recordOutputAudio bool
+	closeOnce         sync.Once
+}
+
+var _ types.IConn = (*Conn)(nil)
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Wrap 为连接创建录制文件并返回包装后的连接
+func Wrap(conn types.IConn, opts Options) (*Conn, error) {
+	dir := opts.Dir
+	if dir == "" {
+		dir = defaultDir
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建录制目录失败: %w", err)
+	}
+	now := time.Now()
+	deviceID := conn.GetDeviceID()
+	name := fmt.Sprintf("%s_%s%s", unsafeFileChars.ReplaceAllString(deviceID, "_"), now.Format("20060102-150405.000"), FileExt)
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("创建录制文件失败: %w", err)
+	}
+	writer, err := NewWriter(f, Meta{DeviceID: deviceID, Transport: conn.GetTransportType(), StartedAt: now})
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("写入录制文件头失败: %w", err)
+	}
+	c := &Conn{
+		IConn:             conn,
+		writer:            writer,
+		path:              path,
+		recordOutputAudio: opts.RecordOutputAudio,
+	}
+	log.Infof("设备 %s 会话录制已开启: %s", deviceID, path)
+	return c, nil
+}
+
+// Path 返回录制文件路径
+func (c *Conn) Path() string {
+	return c.path
+}
+
+// SetConfig 记录会话解析后的用户配置，provider 配置中的密钥类字段会被脱敏
+func (c *Conn) SetConfig(cfg config_types.UConfig) {
+	c.record(KindConfig, nil, RedactConfig(cfg))
+}
+
+func (c *Conn) SendCmd(msg []byte) error {
+	err := c.IConn.SendCmd(msg)
+	if err == nil {
+		c.record(KindCmdOut, msg, nil)
+	}
+	return err
+}
+
+func (c *Conn) RecvCmd(ctx context.Context, timeout int) ([]byte, error) {
+	msg, err := c.IConn.RecvCmd(ctx, timeout)
+	if err == nil && msg != nil {
+		c.record(KindCmdIn, msg, nil)
+	}
+	return msg, err
+}
+
+func (c *Conn) SendAudio(audio []byte) error {
+	err := c.IConn.SendAudio(audio)
+	if err == nil && c.recordOutputAudio {
+		c.record(KindAudioOut, audio, nil)
+	}
+	return err
+}
+
+func (c *Conn) RecvAudio(ctx context.Context, timeout int) ([]byte, error) {
+	audio, err := c.IConn.RecvAudio(ctx, timeout)
+	if err == nil && audio != nil {
+		c.record(KindAudioIn, audio, nil)
+	}
+	return audio, err
+}
+
+func (c *Conn) Close() error {
+	err := c.IConn.Close()
+	c.finish()
+	return err
+}
+
+// OnClose 设备侧断开时同样需要落盘
+func (c *Conn) OnClose(fn func(deviceId string)) {
+	c.IConn.OnClose(func(deviceId string) {
+		c.finish()
+		if fn != nil {
+			fn(deviceId)
+		}
+	})
+}
+
+func (c *Conn) finish() {
+	c.closeOnce.Do(func() {
+		_ = c.writer.Write(KindClose, nil)
+		if err := c.writer.Close(); err != nil {
+			log.Warnf("关闭录制文件失败: %s, err: %v", c.path, err)
+			return
+		}
+		log.Infof("会话录制已保存: %s", c.path)
+	})
+}
+
+func (c *Conn) record(kind Kind, data []byte, v interface{}) {
+	var err error
+	if v != nil {
+		err = c.writer.WriteJSON(kind, v)
+	} else {
+		err = c.writer.Write(kind, data)
+	}
+	if err != nil {
+		log.Debugf("写入录制事件失败: kind=%s err=%v", kind, err)
+	}
+}
+
+// 以这些后缀结尾的字段视为密钥（api_key、access_token、secret 等），max_tokens 之类不受影响
+var sensitiveKeySuffixes = []string{"key", "secret", "token", "password", "passwd", "credential", "authorization"}
+
+// RedactConfig 返回脱敏后的配置副本，录制文件可能被带离现场，不能包含密钥
+func RedactConfig(cfg config_types.UConfig) config_types.UConfig {
+	cfg.Asr.Config = redactMap(cfg.Asr.Config)
+	cfg.Tts.Config = redactMap(cfg.Tts.Config)
+	cfg.Llm.Config = redactMap(cfg.Llm.Config)
+	cfg.Vad.Config = redactMap(cfg.Vad.Config)
+	cfg.Memory.Config = redactMap(cfg.Memory.Config)
+	return cfg
+}
+
+func redactMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if isSensitiveKey(k) {
+			if s, ok := v.(string); ok && s == "" {
+				out[k] = s
+			} else {
+				out[k] = "***"
+			}
+			continue
+		}
+		if nested, ok := v.(map[string]interface{}); ok {
+			out[k] = redactMap(nested)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func isSensitiveKey(key string) bool {
+	lower := strings.ToLower(key)
+	for _, suffix := range sensitiveKeySuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package recorder
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// CommandSignature 将信令归一化为稳定的签名（type[.state][.method]），
+// 去掉 session_id、文本内容等每次运行都会变化的字段，便于对比回放前后的信令流
+func CommandSignature(msg []byte) string {
+	var cmd struct {
+		Type    string `json:"type"`
+		State   string `json:"state"`
+		Payload struct {
+			Method string `json:"method"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(msg, &cmd); err != nil || cmd.Type == "" {
+		return "<invalid>"
+	}
+	parts := []string{cmd.Type}
+	if cmd.State != "" {
+		parts = append(parts, cmd.State)
+	}
+	if cmd.Payload.Method != "" {
+		parts = append(parts, cmd.Payload.Method)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Signatures 提取指定类型信令事件的签名序列
+func Signatures(events []Event, kind Kind) []string {
+	out := make([]string, 0)
+	for _, e := range events {
+		if e.Kind == kind {
+			out = append(out, CommandSignature(e.Data))
+		}
+	}
+	return out
+}
+
+// Diff 基于最长公共子序列输出逐行差异（" " 相同，"-" 仅原始录制，"+" 仅回放），
+// 第二个返回值表示两者是否存在差异
+func Diff(want, got []string) ([]string, bool) {
+	n, m := len(want), len(got)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if want[i] == got[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := make([]string, 0, n+m)
+	changed := false
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case want[i] == got[j]:
+			lines = append(lines, "  "+want[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, "- "+want[i])
+			changed = true
+			i++
+		default:
+			lines = append(lines, "+ "+got[j])
+			changed = true
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		lines = append(lines, "- "+want[i])
+		changed = true
+	}
+	for ; j < m; j++ {
+		lines = append(lines, "+ "+got[j])
+		changed = true
+	}
+	return lines, changed
+}
@@ -0,0 +1,189 @@
+package recorder
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	config_types "xiaozhi-esp32-server-golang/internal/domain/config/types"
+)
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestArchiveRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(nopWriteCloser{&buf}, Meta{DeviceID: "dev-1", Transport: "websocket"})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	cfg := config_types.UConfig{AgentId: "agent-1"}
+	if err := w.WriteJSON(KindConfig, cfg); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	_ = w.Write(KindCmdIn, []byte(`{"type":"hello"}`))
+	_ = w.Write(KindAudioIn, []byte{0x01, 0x02, 0x03})
+	_ = w.Write(KindCmdOut, []byte(`{"type":"tts","state":"start"}`))
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	rec, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if rec.Meta.DeviceID != "dev-1" || rec.Meta.Transport != "websocket" {
+		t.Fatalf("unexpected meta: %+v", rec.Meta)
+	}
+	if rec.Config == nil || rec.Config.AgentId != "agent-1" {
+		t.Fatalf("expected config to be restored, got %+v", rec.Config)
+	}
+	if len(rec.Events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(rec.Events))
+	}
+	if rec.Events[1].Kind != KindAudioIn || !bytes.Equal(rec.Events[1].Data, []byte{0x01, 0x02, 0x03}) {
+		t.Fatalf("unexpected audio event: %+v", rec.Events[1])
+	}
+	for i := 1; i < len(rec.Events); i++ {
+		if rec.Events[i].Offset < rec.Events[i-1].Offset {
+			t.Fatal("expected offsets to be monotonic")
+		}
+	}
+}
+
+func TestReadRejectsNonRecording(t *testing.T) {
+	if _, err := Read(strings.NewReader("not a recording")); err == nil {
+		t.Fatal("expected error for invalid input")
+	}
+}
+
+func TestRedactConfigMasksSecrets(t *testing.T) {
+	cfg := config_types.UConfig{
+		Llm: config_types.LlmConfig{Config: map[string]interface{}{
+			"api_key":    "sk-123",
+			"max_tokens": 512,
+			"base_url":   "https://example.com",
+			"extra":      map[string]interface{}{"access_token": "t"},
+		}},
+	}
+	redacted := RedactConfig(cfg)
+	if redacted.Llm.Config["api_key"] != "***" {
+		t.Fatalf("expected api_key to be masked, got %v", redacted.Llm.Config["api_key"])
+	}
+	if redacted.Llm.Config["max_tokens"] != 512 || redacted.Llm.Config["base_url"] != "https://example.com" {
+		t.Fatal("expected non-secret fields to be kept")
+	}
+	if redacted.Llm.Config["extra"].(map[string]interface{})["access_token"] != "***" {
+		t.Fatal("expected nested secrets to be masked")
+	}
+	if cfg.Llm.Config["api_key"] != "sk-123" {
+		t.Fatal("expected original config to be left untouched")
+	}
+}
+
+func TestCommandSignatureAndDiff(t *testing.T) {
+	if got := CommandSignature([]byte(`{"type":"tts","state":"sentence_start","text":"你好","session_id":"x"}`)); got != "tts.sentence_start" {
+		t.Fatalf("unexpected signature %q", got)
+	}
+	if got := CommandSignature([]byte(`{"type":"mcp","payload":{"method":"tools/list"}}`)); got != "mcp.tools/list" {
+		t.Fatalf("unexpected signature %q", got)
+	}
+
+	want := []string{"hello", "stt", "tts.start", "tts.stop"}
+	if _, changed := Diff(want, want); changed {
+		t.Fatal("expected identical streams to produce no diff")
+	}
+	lines, changed := Diff(want, []string{"hello", "tts.start", "llm", "tts.stop"})
+	if !changed {
+		t.Fatal("expected diff to be detected")
+	}
+	joined := strings.Join(lines, "\n")
+	if !strings.Contains(joined, "- stt") || !strings.Contains(joined, "+ llm") {
+		t.Fatalf("unexpected diff output:\n%s", joined)
+	}
+}
+
+type fakeConn struct {
+	cmdIn    [][]byte
+	audioIn  [][]byte
+	sent     [][]byte
+	onClose  func(string)
+	closeErr error
+}
+
+func (f *fakeConn) SendCmd(msg []byte) error { f.sent = append(f.sent, msg); return nil }
+func (f *fakeConn) RecvCmd(ctx context.Context, timeout int) ([]byte, error) {
+	if len(f.cmdIn) == 0 {
+		return nil, io.EOF
+	}
+	msg := f.cmdIn[0]
+	f.cmdIn = f.cmdIn[1:]
+	return msg, nil
+}
+func (f *fakeConn) SendAudio(audio []byte) error { return nil }
+func (f *fakeConn) RecvAudio(ctx context.Context, timeout int) ([]byte, error) {
+	if len(f.audioIn) == 0 {
+		return nil, io.EOF
+	}
+	audio := f.audioIn[0]
+	f.audioIn = f.audioIn[1:]
+	return audio, nil
+}
+func (f *fakeConn) GetDeviceID() string                     { return "aa:bb:cc" }
+func (f *fakeConn) Close() error                            { return f.closeErr }
+func (f *fakeConn) OnClose(fn func(deviceId string))        { f.onClose = fn }
+func (f *fakeConn) CloseAudioChannel() error                { return nil }
+func (f *fakeConn) GetTransportType() string                { return "websocket" }
+func (f *fakeConn) GetData(key string) (interface{}, error) { return nil, nil }
+
+func TestConnRecordsTrafficUntilDeviceCloses(t *testing.T) {
+	base := &fakeConn{
+		cmdIn:   [][]byte{[]byte(`{"type":"hello"}`)},
+		audioIn: [][]byte{{0x09}},
+	}
+	conn, err := Wrap(base, Options{Dir: t.TempDir(), RecordOutputAudio: false})
+	if err != nil {
+		t.Fatalf("Wrap: %v", err)
+	}
+	closed := ""
+	conn.OnClose(func(deviceID string) { closed = deviceID })
+	conn.SetConfig(config_types.UConfig{AgentId: "agent-9"})
+
+	ctx := context.Background()
+	if _, err := conn.RecvCmd(ctx, 1); err != nil {
+		t.Fatalf("RecvCmd: %v", err)
+	}
+	if _, err := conn.RecvAudio(ctx, 1); err != nil {
+		t.Fatalf("RecvAudio: %v", err)
+	}
+	_ = conn.SendCmd([]byte(`{"type":"hello","transport":"websocket"}`))
+	_ = conn.SendAudio([]byte{0x07})
+	base.onClose("aa:bb:cc")
+
+	if closed != "aa:bb:cc" {
+		t.Fatal("expected the wrapped OnClose callback to run")
+	}
+	rec, err := ReadFile(conn.Path())
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if rec.Config == nil || rec.Config.AgentId != "agent-9" {
+		t.Fatal("expected config to be recorded")
+	}
+	kinds := make([]Kind, 0, len(rec.Events))
+	for _, e := range rec.Events {
+		kinds = append(kinds, e.Kind)
+	}
+	want := []Kind{KindCmdIn, KindAudioIn, KindCmdOut, KindClose}
+	if len(kinds) != len(want) {
+		t.Fatalf("expected kinds %v, got %v", want, kinds)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Fatalf("expected kinds %v, got %v", want, kinds)
+		}
+	}
+}
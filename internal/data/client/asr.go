@@ -33,6 +33,8 @@ type Asr struct {
 
 	// 当前这轮ASR是否已经收到首个非空文本
 	ReceivedTextInTurn bool
+	// 当前这轮ASR最近一次返回的非空文本（含中间结果），供语义断句使用
+	partialText string
 }
 
 func (a *Asr) Reset() {
@@ -84,6 +86,9 @@ func (a *Asr) RetireAsrResult(ctx context.Context) (asr_types.StreamingResult, b
 					// 调用回调函数通知首次字符
 					a.ClientState.OnAsrFirstTextCallback(result.Text, result.IsFinal)
 				}
+				if result.Text != "" {
+					a.setPartialText(result.Text)
+				}
 
 				if a.AsrType == "funasr" &&
 					strings.EqualFold(a.Mode, "2pass") &&
@@ -123,6 +128,20 @@ func (a *Asr) ResetReceivedText() {
 	a.lock.Lock()
 	defer a.lock.Unlock()
 	a.ReceivedTextInTurn = false
+	a.partialText = ""
+}
+
+func (a *Asr) setPartialText(text string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.partialText = text
+}
+
+// GetPartialText 返回当前这轮ASR最近一次识别到的文本
+func (a *Asr) GetPartialText() string {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.partialText
 }
 
 func (a *Asr) StopWithReason(reason string) {
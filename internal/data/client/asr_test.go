@@ -83,6 +83,13 @@ func TestRetireAsrResult_NonFinalResultsOnlyTriggerFirstTextOnce(t *testing.T) {
 	if len(firstTexts) != 1 || firstTexts[0] != "你在" {
 		t.Fatalf("unexpected first text callbacks: %v", firstTexts)
 	}
+	if got := a.GetPartialText(); got != "你在干啥呢？" {
+		t.Fatalf("expected partial text %q, got %q", "你在干啥呢？", got)
+	}
+	a.ResetReceivedText()
+	if got := a.GetPartialText(); got != "" {
+		t.Fatalf("expected partial text to be cleared, got %q", got)
+	}
 }
 
 func TestRetireAsrResult_FinalOnlyStillTriggersFirstText(t *testing.T) {
@@ -0,0 +1,178 @@
+package experiment
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/components/http"
+	"xiaozhi-esp32-server-golang/internal/pkg/metrics"
+	"xiaozhi-esp32-server-golang/internal/util"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/spf13/viper"
+)
+
+// 单次上报的最大条数，以及 manager 不可用时内存中最多积压的条数（超出丢弃最旧的）
+const (
+	maxBatchSize = 200
+	maxPending   = 5000
+)
+
+// TurnReport 一轮对话的实验结果样本，上报到 manager 用于按分组汇总
+type TurnReport struct {
+	ExperimentID    uint      `json:"experiment_id"`
+	Variant         string    `json:"variant"`
+	DeviceID        string    `json:"device_id"`
+	SessionID       string    `json:"session_id"`
+	TurnLatencyMs   int64     `json:"turn_latency_ms"`
+	AsrFirstTextMs  int64     `json:"asr_first_text_ms"`
+	LlmFirstTokenMs int64     `json:"llm_first_token_ms"`
+	TtsFirstFrameMs int64     `json:"tts_first_frame_ms"`
+	Interrupted     bool      `json:"interrupted"`
+	Error           string    `json:"error,omitempty"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// Reporter 实验轮次上报器：订阅轮次指标，批量异步上报到 manager
+type Reporter struct {
+	client *http.ManagerClient
+
+	mu      sync.Mutex
+	pending []TurnReport
+}
+
+var (
+	globalReporter *Reporter
+	reporterOnce   sync.Once
+)
+
+// GetReporter 获取全局实验上报器（单例）
+func GetReporter() *Reporter {
+	reporterOnce.Do(func() {
+		baseURL := util.GetBackendURL()
+		if baseURL == "" {
+			baseURL = "http://localhost:8080" // 默认值
+		}
+		globalReporter = &Reporter{
+			client: http.NewManagerClient(http.ManagerClientConfig{
+				BaseURL:    baseURL,
+				Timeout:    5 * time.Second,
+				MaxRetries: 2,
+			}),
+		}
+	})
+	return globalReporter
+}
+
+// Add 记录一轮对话样本，未参与实验的轮次直接忽略
+func (r *Reporter) Add(sample metrics.TurnSample) {
+	if sample.Experiment == "" {
+		return
+	}
+	experimentID, err := strconv.ParseUint(sample.Experiment, 10, 64)
+	if err != nil {
+		return
+	}
+	report := TurnReport{
+		ExperimentID:    uint(experimentID),
+		Variant:         sample.Variant,
+		DeviceID:        sample.DeviceID,
+		SessionID:       sample.SessionID,
+		TurnLatencyMs:   sample.TurnEnd.Milliseconds(),
+		AsrFirstTextMs:  sample.AsrFirstText.Milliseconds(),
+		LlmFirstTokenMs: sample.LlmFirstToken.Milliseconds(),
+		TtsFirstFrameMs: sample.TtsFirstFrame.Milliseconds(),
+		Interrupted:     sample.Interrupted,
+		Error:           sample.Error,
+		Timestamp:       time.Now(),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) >= maxPending {
+		r.pending = r.pending[1:]
+	}
+	r.pending = append(r.pending, report)
+}
+
+// take 取出一批待上报样本
+func (r *Reporter) take() []TurnReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := len(r.pending)
+	if n == 0 {
+		return nil
+	}
+	if n > maxBatchSize {
+		n = maxBatchSize
+	}
+	batch := make([]TurnReport, n)
+	copy(batch, r.pending[:n])
+	r.pending = r.pending[n:]
+	return batch
+}
+
+// requeue 上报失败时放回队首，等待下次重试
+func (r *Reporter) requeue(batch []TurnReport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	merged := append(batch, r.pending...)
+	if len(merged) > maxPending {
+		merged = merged[len(merged)-maxPending:]
+	}
+	r.pending = merged
+}
+
+// flush 上报积压的全部样本，失败时保留剩余样本
+func (r *Reporter) flush(ctx context.Context) {
+	for {
+		batch := r.take()
+		if len(batch) == 0 {
+			return
+		}
+		// DoRequestRaw 会校验 HTTP 状态码，manager 返回错误时保留样本重试
+		_, err := r.client.DoRequestRaw(ctx, http.RequestOptions{
+			Method: "POST",
+			Path:   "/api/internal/experiments/turns",
+			Body:   map[string]interface{}{"turns": batch},
+		})
+		if err != nil {
+			r.requeue(batch)
+			log.Warnf("实验轮次上报失败: %v", err)
+			return
+		}
+	}
+}
+
+// Start 订阅轮次指标并定期上报（默认每 10 秒）
+func (r *Reporter) Start(ctx context.Context) {
+	metrics.OnTurn(r.Add)
+
+	interval := viper.GetDuration("experiment.report_interval")
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				// 退出前尽量把剩余样本送出
+				flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				r.flush(flushCtx)
+				cancel()
+				return
+			case <-ticker.C:
+				r.flush(ctx)
+			}
+		}
+	}()
+}
+
+// StartReporter 启动全局实验上报器（便捷函数）
+func StartReporter(ctx context.Context) {
+	GetReporter().Start(ctx)
+}
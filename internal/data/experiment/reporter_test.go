@@ -0,0 +1,76 @@
+package experiment
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	managerhttp "xiaozhi-esp32-server-golang/internal/components/http"
+	"xiaozhi-esp32-server-golang/internal/pkg/metrics"
+)
+
+func newTestReporter(url string) *Reporter {
+	return &Reporter{
+		client: managerhttp.NewManagerClient(managerhttp.ManagerClientConfig{
+			BaseURL:    url,
+			Timeout:    time.Second,
+			MaxRetries: 0,
+		}),
+	}
+}
+
+func TestReporterFlushesExperimentTurns(t *testing.T) {
+	var received atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/internal/experiments/turns" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var body struct {
+			Turns []TurnReport `json:"turns"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		for _, turn := range body.Turns {
+			if turn.ExperimentID != 3 || turn.Variant != "B" || turn.TurnLatencyMs != 1500 {
+				t.Errorf("unexpected turn %+v", turn)
+			}
+		}
+		received.Add(int32(len(body.Turns)))
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	r := newTestReporter(srv.URL)
+	r.Add(metrics.TurnSample{TurnEnd: time.Second})
+	for i := 0; i < maxBatchSize+5; i++ {
+		r.Add(metrics.TurnSample{Experiment: "3", Variant: "B", DeviceID: "d", TurnEnd: 1500 * time.Millisecond})
+	}
+	r.flush(context.Background())
+
+	if got := received.Load(); got != maxBatchSize+5 {
+		t.Fatalf("received %d turns, want %d", got, maxBatchSize+5)
+	}
+	if len(r.pending) != 0 {
+		t.Fatalf("pending = %d after flush, want 0", len(r.pending))
+	}
+}
+
+func TestReporterKeepsTurnsWhenManagerFails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	r := newTestReporter(srv.URL)
+	r.Add(metrics.TurnSample{Experiment: "3", Variant: "A", Interrupted: true})
+	r.flush(context.Background())
+
+	if len(r.pending) != 1 || !r.pending[0].Interrupted {
+		t.Fatalf("failed batch should be kept for retry, pending = %+v", r.pending)
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 	"xiaozhi-esp32-server-golang/constants"
 	"xiaozhi-esp32-server-golang/internal/domain/asr/types"
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -67,7 +68,7 @@ func (a *AliyunFunASR) getConn(ctx context.Context) (*websocket.Conn, error) {
 	}
 	header := make(http.Header)
 	header.Add("Authorization", fmt.Sprintf("bearer %s", apiKey))
-	conn, _, err := a.dialer.DialContext(ctx, a.config.WsURL, header)
+	conn, _, err := a.dialer.DialContext(ctx, a.config.WsURL, tracing.InjectHeader(ctx, header))
 	if err != nil {
 		return nil, fmt.Errorf("connect websocket failed: %w", err)
 	}
@@ -12,6 +12,7 @@ import (
 
 	"xiaozhi-esp32-server-golang/constants"
 	"xiaozhi-esp32-server-golang/internal/domain/asr/types"
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
 	"xiaozhi-esp32-server-golang/internal/util"
 	log "xiaozhi-esp32-server-golang/logger"
 
@@ -122,7 +123,7 @@ func (a *AliyunQwen3ASR) StreamingRecognize(ctx context.Context, audioStream <-c
 	a.connMu.Unlock()
 	if conn == nil {
 		log.Debugf("[aliyun_qwen3] connecting to: %s", wsURL)
-		conn, _, err = a.dialer.DialContext(ctx, wsURL, header)
+		conn, _, err = a.dialer.DialContext(ctx, wsURL, tracing.InjectHeader(ctx, header))
 		if err != nil {
 			unlock()
 			return nil, fmt.Errorf("connect websocket failed: %w", err)
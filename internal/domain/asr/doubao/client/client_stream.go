@@ -14,6 +14,7 @@ import (
 	"xiaozhi-esp32-server-golang/internal/domain/asr/doubao/response"
 	"xiaozhi-esp32-server-golang/internal/util"
 
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
 	log "xiaozhi-esp32-server-golang/logger"
 )
 
@@ -82,7 +83,7 @@ func firstNonEmptyUtteranceText(payload *response.AsrResponsePayload) string {
 
 func (c *AsrWsClient) CreateConnection(ctx context.Context) error {
 	header := request.NewAuthHeader(c.appId, c.accessKey, c.resourceID, c.connectID)
-	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, c.url, header)
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, c.url, tracing.InjectHeader(ctx, header))
 	if err != nil {
 		if resp != nil {
 			var body string
@@ -18,6 +18,7 @@ import (
 
 	"xiaozhi-esp32-server-golang/internal/data/audio"
 	"xiaozhi-esp32-server-golang/internal/domain/asr/types"
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
 )
 
 // FunasrConfig 配置结构体
@@ -119,7 +120,7 @@ func (f *Funasr) getConnection(ctx context.Context) (*websocket.Conn, error) {
 
 	// 创建新连接
 	url := fmt.Sprintf("ws://%s:%s/", f.config.Host, f.config.Port)
-	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, tracing.InjectHeader(ctx, nil))
 	if err != nil {
 		return nil, fmt.Errorf("连接到FunASR服务失败: %v", err)
 	}
@@ -0,0 +1,180 @@
+package openai
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultBaseURL           = "https://api.openai.com/v1"
+	defaultModel             = "whisper-1"
+	defaultRealtimeModel     = "gpt-4o-transcribe"
+	defaultLanguage          = "zh"
+	defaultSampleRate        = 16000
+	defaultSilenceMs         = 500
+	defaultMaxSegmentSeconds = 15
+	defaultTimeoutSeconds    = 30
+
+	// RealtimeAuto 先尝试实时转写 WebSocket，握手失败时回退到分段上传
+	RealtimeAuto = "auto"
+	// RealtimeOn 只使用实时转写 WebSocket
+	RealtimeOn = "on"
+	// RealtimeOff 只使用 /audio/transcriptions 分段上传
+	RealtimeOff = "off"
+)
+
+// Config OpenAI 兼容语音转写配置
+type Config struct {
+	APIKey            string
+	BaseURL           string
+	Model             string
+	Language          string
+	Prompt            string
+	SampleRate        int
+	Realtime          string
+	RealtimeURL       string
+	RealtimeModel     string
+	SilenceMs         int // 轮内停顿切段时长，实时转写时作为服务端 VAD 的静音时长
+	MaxSegmentSeconds int
+	Timeout           time.Duration
+}
+
+// DefaultConfig 返回默认配置
+func DefaultConfig() Config {
+	return Config{
+		BaseURL:           defaultBaseURL,
+		Model:             defaultModel,
+		Language:          defaultLanguage,
+		SampleRate:        defaultSampleRate,
+		Realtime:          RealtimeAuto,
+		RealtimeModel:     defaultRealtimeModel,
+		SilenceMs:         defaultSilenceMs,
+		MaxSegmentSeconds: defaultMaxSegmentSeconds,
+		Timeout:           time.Duration(defaultTimeoutSeconds) * time.Second,
+	}
+}
+
+// ConfigFromMap 从配置 map 合并生成配置（支持配置文件 + 内控系统）
+func ConfigFromMap(cfg map[string]interface{}) Config {
+	conf := DefaultConfig()
+
+	// 先合并配置文件中的默认值
+	applyViperDefaults(&conf)
+
+	// 兼容老格式：若传入 { openai: { ... } }，则优先取内部 map
+	if nested, ok := cfg["openai"].(map[string]interface{}); ok {
+		cfg = nested
+	}
+
+	applyMapOverrides(&conf, cfg)
+
+	// api_key 允许为空时回退环境变量；自建服务通常不需要
+	if conf.APIKey == "" {
+		conf.APIKey = os.Getenv("OPENAI_API_KEY")
+	}
+	conf.BaseURL = strings.TrimRight(strings.TrimSpace(conf.BaseURL), "/")
+	conf.Realtime = strings.ToLower(strings.TrimSpace(conf.Realtime))
+
+	return conf
+}
+
+func applyViperDefaults(conf *Config) {
+	const prefix = "asr.openai."
+	if viper.IsSet(prefix + "api_key") {
+		conf.APIKey = viper.GetString(prefix + "api_key")
+	}
+	if viper.IsSet(prefix + "base_url") {
+		conf.BaseURL = viper.GetString(prefix + "base_url")
+	}
+	if viper.IsSet(prefix + "model") {
+		conf.Model = viper.GetString(prefix + "model")
+	}
+	if viper.IsSet(prefix + "language") {
+		conf.Language = viper.GetString(prefix + "language")
+	}
+	if viper.IsSet(prefix + "prompt") {
+		conf.Prompt = viper.GetString(prefix + "prompt")
+	}
+	if viper.IsSet(prefix + "sample_rate") {
+		if sr := viper.GetInt(prefix + "sample_rate"); sr > 0 {
+			conf.SampleRate = sr
+		}
+	}
+	if viper.IsSet(prefix + "realtime") {
+		conf.Realtime = viper.GetString(prefix + "realtime")
+	}
+	if viper.IsSet(prefix + "realtime_url") {
+		conf.RealtimeURL = viper.GetString(prefix + "realtime_url")
+	}
+	if viper.IsSet(prefix + "realtime_model") {
+		conf.RealtimeModel = viper.GetString(prefix + "realtime_model")
+	}
+	if viper.IsSet(prefix + "silence_ms") {
+		conf.SilenceMs = viper.GetInt(prefix + "silence_ms")
+	}
+	if viper.IsSet(prefix + "max_segment_seconds") {
+		conf.MaxSegmentSeconds = viper.GetInt(prefix + "max_segment_seconds")
+	}
+	if viper.IsSet(prefix + "timeout") {
+		if t := viper.GetInt(prefix + "timeout"); t > 0 {
+			conf.Timeout = time.Duration(t) * time.Second
+		}
+	}
+}
+
+func applyMapOverrides(conf *Config, cfg map[string]interface{}) {
+	if v, ok := cfg["api_key"].(string); ok && v != "" {
+		conf.APIKey = v
+	}
+	if v, ok := cfg["base_url"].(string); ok && v != "" {
+		conf.BaseURL = v
+	}
+	if v, ok := cfg["model"].(string); ok && v != "" {
+		conf.Model = v
+	}
+	if v, ok := cfg["language"].(string); ok {
+		conf.Language = v
+	}
+	if v, ok := cfg["prompt"].(string); ok {
+		conf.Prompt = v
+	}
+	if v, ok := intValue(cfg["sample_rate"]); ok && v > 0 {
+		conf.SampleRate = v
+	}
+	if v, ok := cfg["realtime"].(string); ok && v != "" {
+		conf.Realtime = v
+	} else if v, ok := cfg["realtime"].(bool); ok {
+		conf.Realtime = RealtimeOff
+		if v {
+			conf.Realtime = RealtimeOn
+		}
+	}
+	if v, ok := cfg["realtime_url"].(string); ok && v != "" {
+		conf.RealtimeURL = v
+	}
+	if v, ok := cfg["realtime_model"].(string); ok && v != "" {
+		conf.RealtimeModel = v
+	}
+	if v, ok := intValue(cfg["silence_ms"]); ok && v > 0 {
+		conf.SilenceMs = v
+	}
+	if v, ok := intValue(cfg["max_segment_seconds"]); ok && v > 0 {
+		conf.MaxSegmentSeconds = v
+	}
+	if v, ok := intValue(cfg["timeout"]); ok && v > 0 {
+		conf.Timeout = time.Duration(v) * time.Second
+	}
+}
+
+func intValue(raw interface{}) (int, bool) {
+	switch v := raw.(type) {
+	case int:
+		return v, true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,357 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"xiaozhi-esp32-server-golang/constants"
+	"xiaozhi-esp32-server-golang/internal/domain/asr/types"
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
+	"xiaozhi-esp32-server-golang/internal/util"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/gorilla/websocket"
+)
+
+// promptCarryRunes 携带到下一片段 prompt 中的上文长度（whisper prompt 上限约 224 token）
+const promptCarryRunes = 200
+
+// realtimeRetryInterval auto 模式下实时转写握手失败后，在该时长内直接走分段上传，之后再重新尝试
+const realtimeRetryInterval = 5 * time.Minute
+
+// OpenAIASR OpenAI 兼容语音转写引擎（OpenAI Whisper API / faster-whisper 等自建服务）
+type OpenAIASR struct {
+	config Config
+	client *http.Client
+	dialer *websocket.Dialer
+
+	// realtimeRetryAt auto 模式下实时转写握手失败后记录的重试时间（UnixNano），此前直接走分段上传
+	realtimeRetryAt atomic.Int64
+}
+
+// NewOpenAIASR 创建实例
+func NewOpenAIASR(config Config) (*OpenAIASR, error) {
+	if config.BaseURL == "" {
+		return nil, fmt.Errorf("base_url is empty")
+	}
+	if config.SampleRate == 0 {
+		config.SampleRate = defaultSampleRate
+	}
+	if config.SampleRate != 16000 {
+		return nil, fmt.Errorf("main program currently only supports 16000 sample_rate")
+	}
+	switch config.Realtime {
+	case "":
+		config.Realtime = RealtimeAuto
+	case RealtimeAuto, RealtimeOn, RealtimeOff:
+	default:
+		return nil, fmt.Errorf("realtime must be one of auto/on/off, got: %s", config.Realtime)
+	}
+	if config.RealtimeURL == "" {
+		config.RealtimeURL = deriveRealtimeURL(config.BaseURL)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultConfig().Timeout
+	}
+	if config.SilenceMs <= 0 {
+		config.SilenceMs = defaultSilenceMs
+	}
+
+	return &OpenAIASR{
+		config: config,
+		client: &http.Client{},
+		dialer: websocket.DefaultDialer,
+	}, nil
+}
+
+// StreamingRecognize 流式识别：优先实时转写 WebSocket，否则按说话停顿分段上传
+func (a *OpenAIASR) StreamingRecognize(ctx context.Context, audioStream <-chan []float32) (chan types.StreamingResult, error) {
+	if a.config.Realtime == RealtimeOn || (a.config.Realtime == RealtimeAuto && time.Now().UnixNano() >= a.realtimeRetryAt.Load()) {
+		resultChan, err := a.streamRealtime(ctx, audioStream)
+		if err == nil {
+			return resultChan, nil
+		}
+		if a.config.Realtime == RealtimeOn || ctx.Err() != nil {
+			return nil, err
+		}
+		a.realtimeRetryAt.Store(time.Now().Add(realtimeRetryInterval).UnixNano())
+		log.Warnf("[openai_asr] 实时转写不可用，%v 内回退为分段上传: %v", realtimeRetryInterval, err)
+	}
+	return a.streamSegments(ctx, audioStream), nil
+}
+
+// streamSegments 按停顿切分音频，逐段调用 /audio/transcriptions，并把已识别文本作为下一段的 prompt
+func (a *OpenAIASR) streamSegments(ctx context.Context, audioStream <-chan []float32) chan types.StreamingResult {
+	resultChan := make(chan types.StreamingResult, 20)
+	segCh := make(chan []float32, 16)
+	workerDone := make(chan struct{})
+
+	// 读取音频并切段；转写放在另一个 goroutine，避免阻塞上游送音频
+	go func() {
+		defer close(segCh)
+		seg := newSegmenter(a.config)
+		push := func(pcm []float32) bool {
+			select {
+			case segCh <- pcm:
+				return true
+			case <-workerDone:
+				return false
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-workerDone:
+				return
+			case pcm, ok := <-audioStream:
+				if !ok {
+					if last := seg.Flush(); last != nil {
+						push(last)
+					}
+					return
+				}
+				for _, s := range seg.Push(pcm) {
+					if !push(s) {
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	go func() {
+		defer close(resultChan)
+		defer close(workerDone)
+
+		var text string
+		for pcm := range segCh {
+			if ctx.Err() != nil {
+				break
+			}
+			segText, err := a.transcribe(ctx, pcm, a.promptWithContext(text))
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				resultChan <- types.StreamingResult{
+					Error:   err,
+					IsFinal: true,
+					AsrType: constants.AsrTypeOpenAI,
+				}
+				return
+			}
+			log.Debugf("[openai_asr] 片段识别结果: %q", segText)
+			if segText == "" {
+				continue
+			}
+			text = joinTranscript(text, segText)
+			sendInterim(resultChan, types.StreamingResult{
+				Text:    text,
+				IsFinal: false,
+				AsrType: constants.AsrTypeOpenAI,
+				Mode:    "online",
+			})
+		}
+
+		if err := ctx.Err(); err != nil {
+			resultChan <- types.StreamingResult{
+				Error:   err,
+				IsFinal: true,
+				AsrType: constants.AsrTypeOpenAI,
+			}
+			return
+		}
+		resultChan <- finalResult(text)
+	}()
+
+	return resultChan
+}
+
+// transcribe 将一段 PCM 编码为 WAV 并上传转写
+func (a *OpenAIASR) transcribe(ctx context.Context, pcm []float32, prompt string) (string, error) {
+	wavData, err := util.PCMFloat32BytesToWav(util.Float32SliceToBytes(pcm), a.config.SampleRate, 1)
+	if err != nil {
+		return "", fmt.Errorf("encode wav failed: %w", err)
+	}
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, err := mw.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return "", err
+	}
+	if _, err := fw.Write(wavData); err != nil {
+		return "", err
+	}
+	fields := [][2]string{
+		{"model", a.config.Model},
+		{"response_format", "json"},
+		{"language", a.config.Language},
+		{"prompt", prompt},
+	}
+	for _, f := range fields {
+		if f[1] == "" {
+			continue
+		}
+		if err := mw.WriteField(f[0], f[1]); err != nil {
+			return "", err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, a.config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, a.config.BaseURL+"/audio/transcriptions", body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if a.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+a.config.APIKey)
+	}
+	req.Header = tracing.InjectHeader(ctx, req.Header)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("transcription request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		errBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return "", fmt.Errorf("transcription http %d: %s", resp.StatusCode, strings.TrimSpace(string(errBody)))
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decode transcription response failed: %w", err)
+	}
+	return strings.TrimSpace(result.Text), nil
+}
+
+// promptWithContext 在配置的 prompt 后拼接已识别文本的末尾，帮助模型保持上下文连贯
+func (a *OpenAIASR) promptWithContext(text string) string {
+	if n := utf8.RuneCountInString(text); n > promptCarryRunes {
+		text = string([]rune(text)[n-promptCarryRunes:])
+	}
+	return strings.TrimSpace(a.config.Prompt + " " + text)
+}
+
+// Process 使用流式接口完成一次整段识别
+func (a *OpenAIASR) Process(pcmData []float32) (string, error) {
+	ctx := context.Background()
+	if a.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.config.Timeout)
+		defer cancel()
+	}
+
+	audioStream := make(chan []float32, 1)
+	audioStream <- pcmData
+	close(audioStream)
+
+	resultChan, err := a.StreamingRecognize(ctx, audioStream)
+	if err != nil {
+		return "", err
+	}
+
+	var finalText string
+	for result := range resultChan {
+		if result.Error != nil {
+			return "", result.Error
+		}
+		if result.Text != "" {
+			finalText = result.Text
+		}
+		if result.IsFinal {
+			return finalText, nil
+		}
+	}
+
+	if finalText != "" {
+		return finalText, nil
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	return "", fmt.Errorf("no asr result")
+}
+
+// Close 释放资源；每次识别使用独立请求/连接，无需额外清理
+func (a *OpenAIASR) Close() error {
+	return nil
+}
+
+// IsValid 检查实例是否可用
+func (a *OpenAIASR) IsValid() bool {
+	return a != nil
+}
+
+func finalResult(text string) types.StreamingResult {
+	result := types.StreamingResult{
+		Text:    text,
+		IsFinal: true,
+		AsrType: constants.AsrTypeOpenAI,
+		Mode:    "online",
+	}
+	if text == "" {
+		result.EmptyReason = types.EmptyReasonProviderEmptyFinal
+	}
+	return result
+}
+
+// sendInterim 发送中间结果，通道满时直接丢弃，不影响最终结果
+func sendInterim(resultChan chan types.StreamingResult, r types.StreamingResult) {
+	select {
+	case resultChan <- r:
+	default:
+	}
+}
+
+// joinTranscript 拼接片段文本：中文直接相连，两侧都是字母数字时补空格
+func joinTranscript(prev, next string) string {
+	if prev == "" {
+		return next
+	}
+	if next == "" {
+		return prev
+	}
+	last, _ := utf8.DecodeLastRuneInString(prev)
+	first, _ := utf8.DecodeRuneInString(next)
+	if isWordRune(last) && isWordRune(first) || unicode.IsPunct(last) && last < utf8.RuneSelf && isWordRune(first) {
+		return prev + " " + next
+	}
+	return prev + next
+}
+
+func isWordRune(r rune) bool {
+	return r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// deriveRealtimeURL 由 base_url 推导实时转写地址，如 https://api.openai.com/v1 -> wss://api.openai.com/v1/realtime?intent=transcription
+func deriveRealtimeURL(baseURL string) string {
+	u := baseURL
+	switch {
+	case strings.HasPrefix(u, "https://"):
+		u = "wss://" + strings.TrimPrefix(u, "https://")
+	case strings.HasPrefix(u, "http://"):
+		u = "ws://" + strings.TrimPrefix(u, "http://")
+	}
+	return strings.TrimRight(u, "/") + "/realtime?intent=transcription"
+}
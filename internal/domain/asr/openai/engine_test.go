@@ -0,0 +1,358 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/domain/asr/types"
+
+	"github.com/gorilla/websocket"
+)
+
+const testRate = 16000
+
+func tone(ms int) []float32 {
+	return noise(ms, 0.3)
+}
+
+func noise(ms int, amp float32) []float32 {
+	out := make([]float32, testRate*ms/1000)
+	for i := range out {
+		if i%2 == 0 {
+			out[i] = amp
+		} else {
+			out[i] = -amp
+		}
+	}
+	return out
+}
+
+func silence(ms int) []float32 {
+	return make([]float32, testRate*ms/1000)
+}
+
+func testConfig(baseURL string) Config {
+	conf := DefaultConfig()
+	conf.BaseURL = baseURL
+	conf.Realtime = RealtimeOff
+	conf.Timeout = 5 * time.Second
+	return conf
+}
+
+func collect(t *testing.T, ch chan types.StreamingResult) []types.StreamingResult {
+	t.Helper()
+	var results []types.StreamingResult
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case r, ok := <-ch:
+			if !ok {
+				return results
+			}
+			results = append(results, r)
+		case <-timeout:
+			t.Fatal("timed out waiting for results")
+		}
+	}
+}
+
+func TestSegmenterCutsOnPause(t *testing.T) {
+	seg := newSegmenter(testConfig("http://unused"))
+
+	var segments [][]float32
+	segments = append(segments, seg.Push(silence(200))...)
+	segments = append(segments, seg.Push(tone(400))...)
+	segments = append(segments, seg.Push(silence(600))...)
+	if len(segments) != 1 {
+		t.Fatalf("segments after pause = %d, want 1", len(segments))
+	}
+	// 片段保留 200ms 前导静音、语音和 200ms 尾部静音
+	if got, want := len(segments[0]), testRate*800/1000; got != want {
+		t.Fatalf("first segment length = %d, want %d", got, want)
+	}
+
+	if got := seg.Push(tone(300)); len(got) != 0 {
+		t.Fatalf("unexpected cut while speaking: %d", len(got))
+	}
+	if last := seg.Flush(); len(last) < testRate*300/1000 {
+		t.Fatalf("flushed length = %d, want the trailing speech", len(last))
+	}
+}
+
+func TestSegmenterAdaptsToNoiseFloor(t *testing.T) {
+	seg := newSegmenter(testConfig("http://unused"))
+
+	// 底噪约 -34 dBFS，固定的静音阈值会把它当成语音；自适应底噪下停顿仍能切段
+	var segments [][]float32
+	segments = append(segments, seg.Push(noise(200, 0.02))...)
+	segments = append(segments, seg.Push(tone(400))...)
+	segments = append(segments, seg.Push(noise(600, 0.02))...)
+	if len(segments) != 1 {
+		t.Fatalf("segments = %d, want 1", len(segments))
+	}
+	// 停顿后没有再开口，剩余的只是噪声
+	if last := seg.Flush(); last != nil {
+		t.Fatalf("flush after pause = %d samples, want nil", len(last))
+	}
+}
+
+func TestSegmenterUploadsTurnWithoutPause(t *testing.T) {
+	seg := newSegmenter(testConfig("http://unused"))
+
+	// 会话 VAD 已判定有人声，没有停顿时整轮在输入结束时上传
+	if got := seg.Push(tone(800)); len(got) != 0 {
+		t.Fatalf("segments before flush = %d, want 0", len(got))
+	}
+	if got, want := len(seg.Flush()), testRate*800/1000; got != want {
+		t.Fatalf("flushed length = %d, want %d", got, want)
+	}
+	if last := seg.Flush(); last != nil {
+		t.Fatal("second flush should be empty")
+	}
+}
+
+func TestSegmenterForcesCutAtMaxLength(t *testing.T) {
+	conf := testConfig("http://unused")
+	conf.MaxSegmentSeconds = 1
+	seg := newSegmenter(conf)
+	if got := len(seg.Push(tone(2500))); got != 2 {
+		t.Fatalf("segments = %d, want 2", got)
+	}
+	if got, want := len(seg.Flush()), testRate/2; got != want {
+		t.Fatalf("remaining length = %d, want %d", got, want)
+	}
+}
+
+func TestStreamingRecognizeSegmentsWithPromptCarryOver(t *testing.T) {
+	var mu sync.Mutex
+	var prompts []string
+	replies := []string{"今天天气", "怎么样"}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/transcriptions" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-test" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if err := r.ParseMultipartForm(10 << 20); err != nil {
+			t.Errorf("parse multipart: %v", err)
+		}
+		if r.FormValue("model") != "whisper-1" || r.FormValue("language") != "zh" || r.FormValue("response_format") != "json" {
+			t.Errorf("unexpected form fields: %v", r.MultipartForm.Value)
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("missing file: %v", err)
+		} else {
+			buf := make([]byte, 4)
+			_, _ = file.Read(buf)
+			if string(buf) != "RIFF" || !strings.HasSuffix(header.Filename, ".wav") {
+				t.Errorf("upload is not a wav file: %q %q", buf, header.Filename)
+			}
+		}
+
+		mu.Lock()
+		idx := len(prompts)
+		prompts = append(prompts, r.FormValue("prompt"))
+		mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]string{"text": replies[idx]})
+	}))
+	defer srv.Close()
+
+	conf := testConfig(srv.URL + "/v1")
+	conf.APIKey = "sk-test"
+	conf.Prompt = "小智"
+	engine, err := NewOpenAIASR(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	audio := make(chan []float32, 8)
+	ch, err := engine.StreamingRecognize(context.Background(), audio)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 轮内停顿后立即上传第一段并输出中间结果，不必等整轮结束
+	audio <- silence(200)
+	audio <- tone(600)
+	audio <- silence(600)
+	select {
+	case interim := <-ch:
+		if interim.IsFinal || interim.Text != "今天天气" {
+			t.Fatalf("interim = %+v", interim)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no interim result after mid-turn pause")
+	}
+
+	audio <- tone(400)
+	close(audio)
+	results := collect(t, ch)
+	if len(results) == 0 {
+		t.Fatal("no results after interim")
+	}
+	final := results[len(results)-1]
+	if !final.IsFinal || final.Error != nil || final.Text != "今天天气怎么样" {
+		t.Fatalf("final = %+v", final)
+	}
+	if len(prompts) != 2 || prompts[0] != "小智" || prompts[1] != "小智 今天天气" {
+		t.Fatalf("prompts = %q", prompts)
+	}
+}
+
+func TestStreamingRecognizeEmptyFinal(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("empty input should not be uploaded")
+	}))
+	defer srv.Close()
+
+	engine, err := NewOpenAIASR(testConfig(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio := make(chan []float32)
+	close(audio)
+
+	ch, _ := engine.StreamingRecognize(context.Background(), audio)
+	results := collect(t, ch)
+	if len(results) != 1 || results[0].EmptyReason != types.EmptyReasonProviderEmptyFinal {
+		t.Fatalf("results = %+v", results)
+	}
+}
+
+func TestStreamingRecognizeHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"bad key"}}`, http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	engine, _ := NewOpenAIASR(testConfig(srv.URL))
+	text, err := engine.Process(tone(500))
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("Process() = %q, %v; want 401 error", text, err)
+	}
+}
+
+func TestRealtimeTranscription(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/realtime" || r.URL.Query().Get("intent") != "transcription" {
+			http.NotFound(w, r)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var update map[string]interface{}
+		if err := conn.ReadJSON(&update); err != nil || update["type"] != "session.update" {
+			t.Errorf("first event = %v, %v", update, err)
+			return
+		}
+		session := update["session"].(map[string]interface{})
+		input := session["audio"].(map[string]interface{})["input"].(map[string]interface{})
+		if rate := input["format"].(map[string]interface{})["rate"]; rate != float64(realtimeSampleRate) {
+			t.Errorf("format rate = %v", rate)
+		}
+		_ = conn.WriteJSON(map[string]string{"type": "session.updated"})
+
+		appended := 0
+		for {
+			var event map[string]interface{}
+			if err := conn.ReadJSON(&event); err != nil {
+				return
+			}
+			switch event["type"] {
+			case "input_audio_buffer.append":
+				appended++
+			case "input_audio_buffer.commit":
+				if appended == 0 {
+					t.Error("no audio appended before commit")
+				}
+				_ = conn.WriteJSON(map[string]string{"type": "input_audio_buffer.committed", "item_id": "item_1"})
+				_ = conn.WriteJSON(map[string]string{"type": "conversation.item.input_audio_transcription.delta", "item_id": "item_1", "delta": "你好"})
+				_ = conn.WriteJSON(map[string]string{"type": "conversation.item.input_audio_transcription.completed", "item_id": "item_1", "transcript": "你好小智"})
+			}
+		}
+	}))
+	defer srv.Close()
+
+	conf := testConfig(srv.URL + "/v1")
+	conf.Realtime = RealtimeOn
+	engine, err := NewOpenAIASR(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "ws" + strings.TrimPrefix(srv.URL, "http") + "/v1/realtime?intent=transcription"; engine.config.RealtimeURL != want {
+		t.Fatalf("RealtimeURL = %q, want %q", engine.config.RealtimeURL, want)
+	}
+
+	text, err := engine.Process(tone(300))
+	if err != nil || text != "你好小智" {
+		t.Fatalf("Process() = %q, %v", text, err)
+	}
+}
+
+func TestRealtimeAutoFallsBackToHTTP(t *testing.T) {
+	var realtimeHits, uploads int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/realtime":
+			realtimeHits++
+			http.NotFound(w, r)
+		case "/audio/transcriptions":
+			uploads++
+			fmt.Fprint(w, `{"text":"hello"}`)
+		}
+	}))
+	defer srv.Close()
+
+	conf := testConfig(srv.URL)
+	conf.Realtime = RealtimeAuto
+	engine, _ := NewOpenAIASR(conf)
+	for i := 0; i < 2; i++ {
+		text, err := engine.Process(tone(300))
+		if err != nil || text != "hello" {
+			t.Fatalf("Process() = %q, %v", text, err)
+		}
+	}
+	if realtimeHits != 1 || uploads != 2 {
+		t.Fatalf("realtimeHits = %d, uploads = %d; want 1, 2", realtimeHits, uploads)
+	}
+
+	// 到达重试时间后重新尝试实时转写
+	engine.realtimeRetryAt.Store(time.Now().Add(-time.Second).UnixNano())
+	if _, err := engine.Process(tone(300)); err != nil {
+		t.Fatal(err)
+	}
+	if realtimeHits != 2 || uploads != 3 {
+		t.Fatalf("after retry: realtimeHits = %d, uploads = %d; want 2, 3", realtimeHits, uploads)
+	}
+}
+
+func TestJoinTranscript(t *testing.T) {
+	cases := []struct{ prev, next, want string }{
+		{"", "你好", "你好"},
+		{"今天", "天气", "今天天气"},
+		{"hello", "world", "hello world"},
+		{"hello.", "World", "hello. World"},
+		{"你好", "world", "你好world"},
+	}
+	for _, c := range cases {
+		if got := joinTranscript(c.prev, c.next); got != c.want {
+			t.Errorf("joinTranscript(%q, %q) = %q, want %q", c.prev, c.next, got, c.want)
+		}
+	}
+}
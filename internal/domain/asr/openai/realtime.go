@@ -0,0 +1,275 @@
+package openai
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"xiaozhi-esp32-server-golang/constants"
+	"xiaozhi-esp32-server-golang/internal/domain/asr/types"
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
+	"xiaozhi-esp32-server-golang/internal/util"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/gorilla/websocket"
+)
+
+// realtimeSampleRate 实时转写接口要求的 PCM16 采样率
+const realtimeSampleRate = 24000
+
+// errCodeCommitEmpty 服务端 VAD 已提交全部音频时，手动 commit 会返回该错误，可忽略
+const errCodeCommitEmpty = "input_audio_buffer_commit_empty"
+
+type realtimeEvent struct {
+	Type       string `json:"type"`
+	ItemID     string `json:"item_id,omitempty"`
+	Delta      string `json:"delta,omitempty"`
+	Transcript string `json:"transcript,omitempty"`
+	Error      *struct {
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// transcriptState 按提交顺序拼接各语音条目的转写文本
+type transcriptState struct {
+	order     []string
+	partial   map[string]string
+	completed map[string]bool
+}
+
+func newTranscriptState() *transcriptState {
+	return &transcriptState{partial: map[string]string{}, completed: map[string]bool{}}
+}
+
+func (s *transcriptState) track(itemID string) {
+	if _, ok := s.partial[itemID]; ok {
+		return
+	}
+	s.partial[itemID] = ""
+	s.order = append(s.order, itemID)
+}
+
+func (s *transcriptState) delta(itemID, delta string) {
+	s.track(itemID)
+	s.partial[itemID] += delta
+}
+
+func (s *transcriptState) complete(itemID, transcript string) {
+	s.track(itemID)
+	s.partial[itemID] = strings.TrimSpace(transcript)
+	s.completed[itemID] = true
+}
+
+func (s *transcriptState) pending() int {
+	return len(s.order) - len(s.completed)
+}
+
+func (s *transcriptState) text() string {
+	var text string
+	for _, id := range s.order {
+		text = joinTranscript(text, strings.TrimSpace(s.partial[id]))
+	}
+	return text
+}
+
+// streamRealtime 使用实时转写 WebSocket；握手（含 session.update）失败时返回 error，由调用方决定是否回退
+func (a *OpenAIASR) streamRealtime(ctx context.Context, audioStream <-chan []float32) (chan types.StreamingResult, error) {
+	conn, err := a.dialRealtime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resultChan := make(chan types.StreamingResult, 20)
+	var inputClosed, commitSent atomic.Bool
+	var closeOnce sync.Once
+	closeConn := func() {
+		closeOnce.Do(func() { _ = conn.Close() })
+	}
+
+	// 发送音频
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				closeConn()
+				return
+			case pcm, ok := <-audioStream:
+				if !ok {
+					inputClosed.Store(true)
+					commitSent.Store(true)
+					if err := conn.WriteJSON(map[string]string{"type": "input_audio_buffer.commit"}); err != nil {
+						log.Debugf("[openai_asr] commit 发送失败: %v", err)
+					}
+					// 最多等待 timeout 让剩余条目转写完成，超时由接收方按已有结果收尾
+					_ = conn.SetReadDeadline(time.Now().Add(a.config.Timeout))
+					return
+				}
+				if a.config.SampleRate != realtimeSampleRate {
+					pcm = util.ResampleLinearFloat32(pcm, a.config.SampleRate, realtimeSampleRate)
+				}
+				pcmBytes := make([]byte, len(pcm)*2)
+				util.Float32ToPCMBytes(pcm, pcmBytes)
+				event := map[string]string{
+					"type":  "input_audio_buffer.append",
+					"audio": base64.StdEncoding.EncodeToString(pcmBytes),
+				}
+				if err := conn.WriteJSON(event); err != nil {
+					log.Debugf("[openai_asr] 音频发送失败: %v", err)
+					closeConn()
+					return
+				}
+			}
+		}
+	}()
+
+	// 接收转写事件
+	go func() {
+		defer close(resultChan)
+		defer closeConn()
+
+		state := newTranscriptState()
+		commitAcked := false
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				if ctx.Err() != nil {
+					resultChan <- types.StreamingResult{Error: ctx.Err(), IsFinal: true, AsrType: constants.AsrTypeOpenAI}
+					return
+				}
+				if inputClosed.Load() {
+					log.Debugf("[openai_asr] 等待转写结束时连接结束: %v", err)
+					resultChan <- finalResult(state.text())
+					return
+				}
+				resultChan <- types.StreamingResult{
+					Error:   fmt.Errorf("read message failed: %w", err),
+					IsFinal: true,
+					AsrType: constants.AsrTypeOpenAI,
+				}
+				return
+			}
+
+			var event realtimeEvent
+			if err := json.Unmarshal(message, &event); err != nil {
+				log.Debugf("[openai_asr] 解析事件失败: %v", err)
+				continue
+			}
+
+			switch event.Type {
+			case "input_audio_buffer.committed":
+				state.track(event.ItemID)
+				if commitSent.Load() {
+					commitAcked = true
+				}
+			case "conversation.item.input_audio_transcription.delta":
+				state.delta(event.ItemID, event.Delta)
+				sendInterim(resultChan, types.StreamingResult{
+					Text:    state.text(),
+					AsrType: constants.AsrTypeOpenAI,
+					Mode:    "online",
+				})
+			case "conversation.item.input_audio_transcription.completed":
+				state.complete(event.ItemID, event.Transcript)
+				sendInterim(resultChan, types.StreamingResult{
+					Text:    state.text(),
+					AsrType: constants.AsrTypeOpenAI,
+					Mode:    "online",
+				})
+			case "error":
+				if event.Error != nil && event.Error.Code == errCodeCommitEmpty {
+					commitAcked = true
+					break
+				}
+				errMsg := "unknown error"
+				if event.Error != nil {
+					errMsg = event.Error.Message
+				}
+				resultChan <- types.StreamingResult{
+					Error:   fmt.Errorf("openai realtime error: %s", errMsg),
+					IsFinal: true,
+					AsrType: constants.AsrTypeOpenAI,
+				}
+				return
+			}
+
+			if commitAcked && state.pending() == 0 {
+				resultChan <- finalResult(state.text())
+				return
+			}
+		}
+	}()
+
+	return resultChan, nil
+}
+
+// dialRealtime 建立连接并完成 session.update，收到 session.updated 才视为端点支持实时转写
+func (a *OpenAIASR) dialRealtime(ctx context.Context) (*websocket.Conn, error) {
+	header := make(http.Header)
+	if a.config.APIKey != "" {
+		header.Set("Authorization", "Bearer "+a.config.APIKey)
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, a.config.Timeout)
+	defer cancel()
+	conn, _, err := a.dialer.DialContext(dialCtx, a.config.RealtimeURL, tracing.InjectHeader(ctx, header))
+	if err != nil {
+		return nil, fmt.Errorf("connect realtime websocket failed: %w", err)
+	}
+
+	transcription := map[string]interface{}{"model": a.config.RealtimeModel}
+	if a.config.Language != "" {
+		transcription["language"] = a.config.Language
+	}
+	if a.config.Prompt != "" {
+		transcription["prompt"] = a.config.Prompt
+	}
+	update := map[string]interface{}{
+		"type": "session.update",
+		"session": map[string]interface{}{
+			"type": "transcription",
+			"audio": map[string]interface{}{
+				"input": map[string]interface{}{
+					"format":        map[string]interface{}{"type": "audio/pcm", "rate": realtimeSampleRate},
+					"transcription": transcription,
+					"turn_detection": map[string]interface{}{
+						"type":                "server_vad",
+						"silence_duration_ms": a.config.SilenceMs,
+					},
+				},
+			},
+		},
+	}
+	if err := conn.WriteJSON(update); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("send session.update failed: %w", err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(a.config.Timeout))
+	for {
+		var event realtimeEvent
+		if err := conn.ReadJSON(&event); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("wait session.updated failed: %w", err)
+		}
+		switch event.Type {
+		case "session.updated", "transcription_session.updated":
+			_ = conn.SetReadDeadline(time.Time{})
+			log.Debugf("[openai_asr] 实时转写会话已建立: %s", a.config.RealtimeURL)
+			return conn, nil
+		case "error":
+			conn.Close()
+			errMsg := "unknown error"
+			if event.Error != nil {
+				errMsg = event.Error.Message
+			}
+			return nil, fmt.Errorf("session.update rejected: %s", errMsg)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package openai
+
+import "math"
+
+const (
+	frameMs = 20
+	// leadInMs 片段前后保留的静音，避免切掉首尾字
+	leadInMs = 200
+	// minSpeechMs 片段内语音帧不足该时长时不在停顿处切段，避免把咳嗽、杂音单独上传
+	minSpeechMs = 100
+	// speechOverFloorDB 帧能量高出噪声底噪该分贝数才视为语音
+	speechOverFloorDB = 10
+	// floorRiseDBPerSec 底噪估计的上升速度；遇到更安静的帧时立即下降
+	floorRiseDBPerSec = 3
+	// minFloor 底噪估计下限（约 -80 dBFS），避免数字静音把阈值压到 0
+	minFloor = 1e-4
+)
+
+// segmenter 在一轮语音内部按说话停顿切段，便于逐段上传并输出中间结果。
+// 一轮何时开始、何时结束仍由会话的 VAD 决定（空闲超过静音阈值时关闭音频流），
+// 这里只找轮内的停顿：用随设备噪声自适应的底噪估计区分语音帧与停顿帧，不依赖固定能量阈值
+type segmenter struct {
+	frameSamples     int
+	pauseSamples     int
+	minSpeechSamples int
+	maxSamples       int
+	leadInSamples    int
+	speechRatio      float64
+	floorRise        float64
+
+	pending         []float32 // 不足一帧的尾部
+	buf             []float32 // 当前片段
+	floor           float64   // 噪声底噪估计（RMS），0 表示尚未初始化
+	speechSamples   int
+	trailingSilence int
+	afterPause      bool // 上一段在停顿处切出，当前缓冲只有停顿的静音
+}
+
+func newSegmenter(conf Config) *segmenter {
+	perMs := conf.SampleRate / 1000
+	return &segmenter{
+		frameSamples:     perMs * frameMs,
+		pauseSamples:     perMs * conf.SilenceMs,
+		minSpeechSamples: perMs * minSpeechMs,
+		maxSamples:       conf.SampleRate * conf.MaxSegmentSeconds,
+		leadInSamples:    perMs * leadInMs,
+		speechRatio:      math.Pow(10, speechOverFloorDB/20.0),
+		floorRise:        math.Pow(10, floorRiseDBPerSec*frameMs/1000.0/20),
+	}
+}
+
+// Push 写入音频，返回因停顿或超长而切出的完整片段
+func (s *segmenter) Push(pcm []float32) [][]float32 {
+	var segments [][]float32
+	s.pending = append(s.pending, pcm...)
+	for len(s.pending) >= s.frameSamples {
+		if seg := s.pushFrame(s.pending[:s.frameSamples]); seg != nil {
+			segments = append(segments, seg)
+		}
+		s.pending = s.pending[s.frameSamples:]
+	}
+	return segments
+}
+
+// Flush 输入结束时取出剩余音频。会话 VAD 已判定本轮有人声，即使未检出语音帧也照常上传；
+// 只有停顿处切段之后再没开口时，剩下的只是静音，返回 nil
+func (s *segmenter) Flush() []float32 {
+	s.buf = append(s.buf, s.pending...)
+	s.pending = nil
+	if len(s.buf) == 0 || (s.afterPause && s.speechSamples == 0) {
+		s.buf = s.buf[:0]
+		return nil
+	}
+	return s.cut(len(s.buf), false)
+}
+
+func (s *segmenter) pushFrame(frame []float32) []float32 {
+	s.buf = append(s.buf, frame...)
+	if s.isSpeech(frameRMS(frame)) {
+		s.speechSamples += len(frame)
+		s.trailingSilence = 0
+	} else {
+		s.trailingSilence += len(frame)
+	}
+
+	if s.afterPause && s.speechSamples == 0 {
+		// 停顿之后还没重新开口，只保留最近一小段静音作为下一段开头
+		if over := len(s.buf) - s.leadInSamples; over > 0 {
+			s.buf = append(s.buf[:0], s.buf[over:]...)
+		}
+		return nil
+	}
+	if s.speechSamples >= s.minSpeechSamples && s.trailingSilence >= s.pauseSamples {
+		return s.cut(len(s.buf)-s.trailingSilence+s.leadInSamples, true)
+	}
+	if s.maxSamples > 0 && len(s.buf) >= s.maxSamples {
+		return s.cut(len(s.buf), false)
+	}
+	return nil
+}
+
+// isSpeech 更新底噪估计并判断当前帧是否为语音：底噪遇到更安静的帧立即下降，否则缓慢上升
+func (s *segmenter) isSpeech(rms float64) bool {
+	if s.floor == 0 || rms < s.floor {
+		s.floor = math.Max(rms, minFloor)
+	} else {
+		s.floor *= s.floorRise
+	}
+	return rms >= s.floor*s.speechRatio
+}
+
+// cut 取出当前片段的前 end 个采样，剩余部分（停顿的静音）留作下一段开头
+func (s *segmenter) cut(end int, pause bool) []float32 {
+	if end > len(s.buf) {
+		end = len(s.buf)
+	}
+	seg := make([]float32, end)
+	copy(seg, s.buf[:end])
+	s.buf = append(s.buf[:0], s.buf[end:]...)
+	s.speechSamples = 0
+	s.trailingSilence = 0
+	s.afterPause = pause
+	return seg
+}
+
+func frameRMS(frame []float32) float64 {
+	if len(frame) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range frame {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum / float64(len(frame)))
+}
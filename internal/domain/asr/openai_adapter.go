@@ -0,0 +1,49 @@
+package asr
+
+import (
+	"context"
+
+	"xiaozhi-esp32-server-golang/internal/domain/asr/openai"
+	"xiaozhi-esp32-server-golang/internal/domain/asr/types"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// OpenAIAdapter adapts OpenAI-compatible speech-to-text to AsrProvider.
+type OpenAIAdapter struct {
+	engine *openai.OpenAIASR
+}
+
+// NewOpenAIAdapter creates the adapter.
+func NewOpenAIAdapter(config map[string]interface{}) (AsrProvider, error) {
+	openaiConfig := openai.ConfigFromMap(config)
+	log.Log().Infof("openai asr config: base_url=%s model=%s realtime=%s", openaiConfig.BaseURL, openaiConfig.Model, openaiConfig.Realtime)
+
+	engine, err := openai.NewOpenAIASR(openaiConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &OpenAIAdapter{engine: engine}, nil
+}
+
+// Process implements AsrProvider.
+func (a *OpenAIAdapter) Process(pcmData []float32) (string, error) {
+	return a.engine.Process(pcmData)
+}
+
+// StreamingRecognize implements AsrProvider.
+func (a *OpenAIAdapter) StreamingRecognize(ctx context.Context, audioStream <-chan []float32) (chan types.StreamingResult, error) {
+	return a.engine.StreamingRecognize(ctx, audioStream)
+}
+
+// Close releases resources.
+func (a *OpenAIAdapter) Close() error {
+	if a.engine != nil {
+		return a.engine.Close()
+	}
+	return nil
+}
+
+// IsValid validates the instance.
+func (a *OpenAIAdapter) IsValid() bool {
+	return a != nil && a.engine != nil && a.engine.IsValid()
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/gorilla/websocket"
 
 	asrtypes "xiaozhi-esp32-server-golang/internal/domain/asr/types"
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
 	log "xiaozhi-esp32-server-golang/logger"
 )
 
@@ -81,7 +82,7 @@ func (a *ASR) StreamingRecognize(ctx context.Context, audioStream <-chan []float
 
 	dialer := websocket.DefaultDialer
 	h := http.Header{}
-	conn, _, err := dialer.DialContext(ctx, wsURL, h)
+	conn, _, err := dialer.DialContext(ctx, wsURL, tracing.InjectHeader(ctx, h))
 	if err != nil {
 		return nil, fmt.Errorf("xunfei dial failed: %w", err)
 	}
@@ -0,0 +1,83 @@
+package dsp
+
+import "math"
+
+// agcPeakLimit 输出峰值上限，增益过大时按帧压低避免削波
+const agcPeakLimit = 0.95
+
+// agc 自动增益控制：按帧 RMS 把语音电平拉向目标值，静音段保持增益不变；
+// 帧内线性插值过渡增益，避免增益跳变产生咔嗒声
+type agc struct {
+	sampleRate int
+	targetDB   float64
+	maxGainDB  float64
+	gateDB     float64
+	attackMs   float64
+	releaseMs  float64
+	gainDB     float64
+}
+
+func newAGC(sampleRate int, conf AGCConfig) *agc {
+	return &agc{
+		sampleRate: sampleRate,
+		targetDB:   conf.TargetDBFS,
+		maxGainDB:  conf.MaxGainDB,
+		gateDB:     conf.NoiseGateDBFS,
+		attackMs:   conf.AttackMs,
+		releaseMs:  conf.ReleaseMs,
+	}
+}
+
+func (a *agc) name() string { return stageAGC }
+
+func (a *agc) process(frame []float32) {
+	var sum, peak float64
+	for _, v := range frame {
+		x := float64(v)
+		sum += x * x
+		if ax := math.Abs(x); ax > peak {
+			peak = ax
+		}
+	}
+	levelDB := 10 * math.Log10(sum/float64(len(frame))+1e-12)
+
+	prevGainDB := a.gainDB
+	if levelDB > a.gateDB {
+		desired := math.Max(-a.maxGainDB, math.Min(a.maxGainDB, a.targetDB-levelDB))
+		tau := a.releaseMs
+		if desired < a.gainDB {
+			tau = a.attackMs
+		}
+		frameMs := float64(len(frame)) * 1000 / float64(a.sampleRate)
+		a.gainDB += (desired - a.gainDB) * (1 - math.Exp(-frameMs/tau))
+	}
+
+	from := dbToLinear(prevGainDB)
+	to := dbToLinear(a.gainDB)
+	if peak > 0 {
+		if limit := agcPeakLimit / peak; to > limit {
+			to = limit
+			a.gainDB = 20 * math.Log10(limit)
+		}
+		if limit := agcPeakLimit / peak; from > limit {
+			from = limit
+		}
+	}
+	step := (to - from) / float64(len(frame))
+	for i, v := range frame {
+		frame[i] = float32(float64(v) * (from + step*float64(i+1)))
+	}
+}
+
+// bypass 无延迟，直通即不改动数据
+func (a *agc) bypass(frame []float32) {}
+
+func (a *agc) latency() int { return 0 }
+
+func (a *agc) reset() {
+	a.gainDB = 0
+}
+
+func dbToLinear(db float64) float64 {
+	return math.Pow(10, db/20)
+}
@@ -0,0 +1,166 @@
+package dsp
+
+import (
+	"time"
+
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const (
+	stageHighPass         = "high_pass"
+	stageNoiseSuppression = "noise_suppression"
+	stageDereverb         = "dereverb"
+	stageAGC              = "agc"
+
+	// costSmoothing 处理耗时占比的指数平滑系数
+	costSmoothing = 0.05
+	// budgetWarmupFrames 前若干帧不做预算判断（首帧分配内存、CPU 冷启动）
+	budgetWarmupFrames = 20
+	// bypassDuration 超预算后直通的时长，到期后重新尝试处理
+	bypassDuration = 5 * time.Second
+)
+
+// stage 处理链中的一级，均为原地处理
+type stage interface {
+	name() string
+	process(frame []float32)
+	// bypass 超出 CPU 预算时调用，不做处理但须保持与 process 相同的延迟
+	bypass(frame []float32)
+	// latency 引入的固定延迟（采样数）
+	latency() int
+	reset()
+}
+
+// StageStats 单级处理统计
+type StageStats struct {
+	Name           string
+	Frames         int           // 实际处理的帧数
+	BypassedFrames int           // 因超出预算直通的帧数
+	BypassEvents   int           // 触发直通的次数
+	Cost           time.Duration // 累计处理耗时
+}
+
+type stageRunner struct {
+	stage       stage
+	budget      float64
+	costRatio   float64
+	bypassUntil int // 直通截止的累计采样数
+	stats       StageStats
+}
+
+// Chain 上行音频前端处理链：高通 -> 降噪 -> 去混响 -> AGC，作用于 VAD/ASR 之前的单声道 float32 帧。
+// 每级按处理耗时占音频时长的比例做 CPU 预算，平滑后超出预算的级会暂时直通，避免拖慢实时链路。
+// 不是并发安全的，每路会话各自创建。
+type Chain struct {
+	sampleRate int
+	samples    int // 已处理的累计采样数
+	stages     []*stageRunner
+}
+
+// NewChain 按配置创建处理链；未启用或没有启用任何一级时返回 nil，nil 链的方法均为空操作
+func NewChain(sampleRate int, conf Config) *Chain {
+	if !conf.Enabled || sampleRate <= 0 {
+		return nil
+	}
+	c := &Chain{sampleRate: sampleRate}
+	if conf.HighPass.Enabled {
+		c.add(newHighPass(sampleRate, conf.HighPass.CutoffHz), conf.HighPass.Budget)
+	}
+	if conf.NoiseSuppression.Enabled {
+		c.add(newDenoiser(sampleRate, conf.NoiseSuppression), conf.NoiseSuppression.Budget)
+	}
+	if conf.Dereverb.Enabled {
+		c.add(newDereverb(sampleRate, conf.Dereverb), conf.Dereverb.Budget)
+	}
+	if conf.AGC.Enabled {
+		c.add(newAGC(sampleRate, conf.AGC), conf.AGC.Budget)
+	}
+	if len(c.stages) == 0 {
+		return nil
+	}
+	return c
+}
+
+func (c *Chain) add(s stage, budget float64) {
+	c.stages = append(c.stages, &stageRunner{
+		stage:  s,
+		budget: budget,
+		stats:  StageStats{Name: s.name()},
+	})
+}
+
+// Process 原地处理一帧
+func (c *Chain) Process(frame []float32) {
+	if c == nil || len(frame) == 0 {
+		return
+	}
+	frameSeconds := float64(len(frame)) / float64(c.sampleRate)
+	c.samples += len(frame)
+	for _, r := range c.stages {
+		if c.samples <= r.bypassUntil {
+			r.stage.bypass(frame)
+			r.stats.BypassedFrames++
+			continue
+		}
+
+		start := time.Now()
+		r.stage.process(frame)
+		cost := time.Since(start)
+		r.stats.Frames++
+		r.stats.Cost += cost
+
+		r.costRatio += costSmoothing * (cost.Seconds()/frameSeconds - r.costRatio)
+		if r.budget > 0 && r.stats.Frames > budgetWarmupFrames && r.costRatio > r.budget {
+			r.bypassUntil = c.samples + int(bypassDuration.Seconds()*float64(c.sampleRate))
+			r.stats.BypassEvents++
+			log.Warnf("音频前端 %s 处理耗时占比 %.1f%% 超出预算 %.1f%%，直通 %v", r.stage.name(), r.costRatio*100, r.budget*100, bypassDuration)
+			r.costRatio = 0
+		}
+	}
+}
+
+// Latency 处理链引入的总延迟
+func (c *Chain) Latency() time.Duration {
+	if c == nil {
+		return 0
+	}
+	samples := 0
+	for _, r := range c.stages {
+		samples += r.stage.latency()
+	}
+	return time.Duration(samples) * time.Second / time.Duration(c.sampleRate)
+}
+
+// Stats 返回各级处理统计
+func (c *Chain) Stats() []StageStats {
+	if c == nil {
+		return nil
+	}
+	stats := make([]StageStats, 0, len(c.stages))
+	for _, r := range c.stages {
+		stats = append(stats, r.stats)
+	}
+	return stats
+}
+
+// Stages 返回启用的各级名称
+func (c *Chain) Stages() []string {
+	if c == nil {
+		return nil
+	}
+	names := make([]string, 0, len(c.stages))
+	for _, r := range c.stages {
+		names = append(names, r.stage.name())
+	}
+	return names
+}
+
+// Reset 清空各级内部状态（噪声估计、增益、延迟线），用于新的一段音频
+func (c *Chain) Reset() {
+	if c == nil {
+		return
+	}
+	for _, r := range c.stages {
+		r.stage.reset()
+	}
+}
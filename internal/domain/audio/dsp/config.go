@@ -0,0 +1,240 @@
+package dsp
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// Config 上行音频前端处理配置，全局默认值来自配置文件 audio_frontend，智能体配置可逐项覆盖
+type Config struct {
+	Enabled          bool
+	HighPass         HighPassConfig
+	NoiseSuppression NoiseSuppressionConfig
+	AGC              AGCConfig
+	Dereverb         DereverbConfig
+}
+
+// HighPassConfig 二阶巴特沃斯高通，同时去除直流偏置
+type HighPassConfig struct {
+	Enabled  bool
+	CutoffHz float64
+	Budget   float64 // CPU 预算：处理耗时占音频时长的比例上限，0 表示不限制
+}
+
+// NoiseSuppressionConfig 谱减法降噪
+type NoiseSuppressionConfig struct {
+	Enabled         bool
+	OverSubtraction float64 // 过减因子，越大降噪越强、语音失真越多
+	Floor           float64 // 最小增益（线性），避免“音乐噪声”
+	Budget          float64
+}
+
+// AGCConfig 自动增益控制
+type AGCConfig struct {
+	Enabled       bool
+	TargetDBFS    float64 // 目标电平
+	MaxGainDB     float64 // 最大增益（衰减同样以此为限）
+	NoiseGateDBFS float64 // 低于该电平视为静音，保持增益不变，避免放大底噪
+	AttackMs      float64 // 降低增益的时间常数
+	ReleaseMs     float64 // 提高增益的时间常数
+	Budget        float64
+}
+
+// DereverbConfig 晚期混响抑制
+type DereverbConfig struct {
+	Enabled bool
+	T60Ms   float64 // 房间混响时间
+	DelayMs float64 // 早期反射保留时长，之后的能量视为晚期混响
+	Floor   float64
+	Budget  float64
+}
+
+// DefaultConfig 返回默认配置（整体默认关闭）
+func DefaultConfig() Config {
+	return Config{
+		HighPass: HighPassConfig{
+			Enabled:  true,
+			CutoffHz: 80,
+			Budget:   0.02,
+		},
+		NoiseSuppression: NoiseSuppressionConfig{
+			Enabled:         true,
+			OverSubtraction: 2,
+			Floor:           0.1,
+			Budget:          0.15,
+		},
+		AGC: AGCConfig{
+			Enabled:       true,
+			TargetDBFS:    -20,
+			MaxGainDB:     18,
+			NoiseGateDBFS: -50,
+			AttackMs:      20,
+			ReleaseMs:     800,
+			Budget:        0.02,
+		},
+		Dereverb: DereverbConfig{
+			Enabled: false,
+			T60Ms:   500,
+			DelayMs: 48,
+			Floor:   0.3,
+			Budget:  0.15,
+		},
+	}
+}
+
+// ConfigFromMap 依次合并默认值、配置文件 audio_frontend 与传入 map（智能体配置），cfg 可以为 nil
+func ConfigFromMap(cfg map[string]interface{}) Config {
+	conf := DefaultConfig()
+	applyMapOverrides(&conf, viper.GetStringMap("audio_frontend"))
+	applyMapOverrides(&conf, cfg)
+	return conf
+}
+
+// ValidateMap 在默认值基础上合并智能体级配置后检查参数范围，不读取配置文件
+func ValidateMap(cfg map[string]interface{}) error {
+	conf := DefaultConfig()
+	applyMapOverrides(&conf, cfg)
+	return conf.Validate()
+}
+
+// Validate 检查参数范围
+func (c Config) Validate() error {
+	if c.HighPass.CutoffHz < 20 || c.HighPass.CutoffHz > 400 {
+		return fmt.Errorf("high_pass.cutoff_hz 需在 20~400 之间: %v", c.HighPass.CutoffHz)
+	}
+	if c.NoiseSuppression.OverSubtraction < 1 || c.NoiseSuppression.OverSubtraction > 6 {
+		return fmt.Errorf("noise_suppression.over_subtraction 需在 1~6 之间: %v", c.NoiseSuppression.OverSubtraction)
+	}
+	if c.NoiseSuppression.Floor <= 0 || c.NoiseSuppression.Floor > 1 {
+		return fmt.Errorf("noise_suppression.floor 需在 (0, 1] 之间: %v", c.NoiseSuppression.Floor)
+	}
+	if c.AGC.TargetDBFS < -40 || c.AGC.TargetDBFS > -3 {
+		return fmt.Errorf("agc.target_dbfs 需在 -40~-3 之间: %v", c.AGC.TargetDBFS)
+	}
+	if c.AGC.MaxGainDB < 0 || c.AGC.MaxGainDB > 40 {
+		return fmt.Errorf("agc.max_gain_db 需在 0~40 之间: %v", c.AGC.MaxGainDB)
+	}
+	if c.AGC.AttackMs <= 0 || c.AGC.ReleaseMs <= 0 {
+		return fmt.Errorf("agc.attack_ms 与 agc.release_ms 必须大于 0")
+	}
+	if c.Dereverb.T60Ms < 100 || c.Dereverb.T60Ms > 3000 {
+		return fmt.Errorf("dereverb.t60_ms 需在 100~3000 之间: %v", c.Dereverb.T60Ms)
+	}
+	if c.Dereverb.Floor <= 0 || c.Dereverb.Floor > 1 {
+		return fmt.Errorf("dereverb.floor 需在 (0, 1] 之间: %v", c.Dereverb.Floor)
+	}
+	budgets := []struct {
+		name   string
+		budget float64
+	}{
+		{stageHighPass, c.HighPass.Budget},
+		{stageNoiseSuppression, c.NoiseSuppression.Budget},
+		{stageAGC, c.AGC.Budget},
+		{stageDereverb, c.Dereverb.Budget},
+	}
+	for _, b := range budgets {
+		if b.budget < 0 || b.budget > 1 {
+			return fmt.Errorf("%s.budget 需在 0~1 之间: %v", b.name, b.budget)
+		}
+	}
+	return nil
+}
+
+func applyMapOverrides(conf *Config, cfg map[string]interface{}) {
+	if len(cfg) == 0 {
+		return
+	}
+	setBool(&conf.Enabled, cfg["enabled"])
+
+	if m := stageMap(cfg, "high_pass"); m != nil {
+		setBool(&conf.HighPass.Enabled, m["enabled"])
+		setFloat(&conf.HighPass.CutoffHz, m["cutoff_hz"])
+		setFloat(&conf.HighPass.Budget, m["budget"])
+	}
+	if m := stageMap(cfg, "noise_suppression"); m != nil {
+		setBool(&conf.NoiseSuppression.Enabled, m["enabled"])
+		setFloat(&conf.NoiseSuppression.OverSubtraction, m["over_subtraction"])
+		setFloat(&conf.NoiseSuppression.Floor, m["floor"])
+		setFloat(&conf.NoiseSuppression.Budget, m["budget"])
+	}
+	if m := stageMap(cfg, "agc"); m != nil {
+		setBool(&conf.AGC.Enabled, m["enabled"])
+		setFloat(&conf.AGC.TargetDBFS, m["target_dbfs"])
+		setFloat(&conf.AGC.MaxGainDB, m["max_gain_db"])
+		setFloat(&conf.AGC.NoiseGateDBFS, m["noise_gate_dbfs"])
+		setFloat(&conf.AGC.AttackMs, m["attack_ms"])
+		setFloat(&conf.AGC.ReleaseMs, m["release_ms"])
+		setFloat(&conf.AGC.Budget, m["budget"])
+	}
+	if m := stageMap(cfg, "dereverb"); m != nil {
+		setBool(&conf.Dereverb.Enabled, m["enabled"])
+		setFloat(&conf.Dereverb.T60Ms, m["t60_ms"])
+		setFloat(&conf.Dereverb.DelayMs, m["delay_ms"])
+		setFloat(&conf.Dereverb.Floor, m["floor"])
+		setFloat(&conf.Dereverb.Budget, m["budget"])
+	}
+}
+
+// MergeMaps 按级合并两份覆盖项，override 中出现的键覆盖 base，各级内未出现的参数沿用 base；不修改入参
+func MergeMaps(base, override map[string]interface{}) map[string]interface{} {
+	if len(override) == 0 {
+		return base
+	}
+	out := make(map[string]interface{}, len(base)+len(override))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range override {
+		baseStage, overStage := stageMap(base, k), stageMap(override, k)
+		if baseStage == nil || overStage == nil {
+			out[k] = v
+			continue
+		}
+		merged := make(map[string]interface{}, len(baseStage)+len(overStage))
+		for sk, sv := range baseStage {
+			merged[sk] = sv
+		}
+		for sk, sv := range overStage {
+			merged[sk] = sv
+		}
+		out[k] = merged
+	}
+	return out
+}
+
+// stageMap 取出某一级的配置；viper 解析 yaml 时键为 map[string]interface{}，json 同理
+func stageMap(cfg map[string]interface{}, key string) map[string]interface{} {
+	switch m := cfg[key].(type) {
+	case map[string]interface{}:
+		return m
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			if ks, ok := k.(string); ok {
+				out[ks] = v
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func setBool(dst *bool, raw interface{}) {
+	if v, ok := raw.(bool); ok {
+		*dst = v
+	}
+}
+
+func setFloat(dst *float64, raw interface{}) {
+	switch v := raw.(type) {
+	case float64:
+		*dst = v
+	case float32:
+		*dst = float64(v)
+	case int:
+		*dst = float64(v)
+	case int64:
+		*dst = float64(v)
+	}
+}
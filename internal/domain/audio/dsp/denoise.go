@@ -0,0 +1,90 @@
+package dsp
+
+import "math"
+
+const (
+	// noiseInitBlocks 起始若干块直接平均作为初始噪声估计（约 0.1~0.2 秒），首块含补零不计入
+	noiseInitBlocks = 8
+	// noiseUpdateRatio 当前功率低于噪声估计的该倍数时视为噪声频点，按 noiseSmoothing 更新估计
+	noiseUpdateRatio = 4.0
+	noiseSmoothing   = 0.9
+	// noiseRiseDBPerSecond 当前功率高于噪声估计时缓慢上调，说话期间不会把语音当作噪声
+	noiseRiseDBPerSecond = 3.0
+	// gainSmoothing 增益时间平滑，抑制“音乐噪声”
+	gainSmoothing = 0.5
+)
+
+// denoiser 谱减法降噪：逐频点跟踪噪声功率（类噪声频点平滑更新，语音频点只缓慢上调），按后验信噪比计算增益
+type denoiser struct {
+	stft       *stft
+	over       float64
+	floor      float64
+	riseFactor float64
+	noise      []float64
+	gain       []float64
+	blocks     int
+}
+
+func newDenoiser(sampleRate int, conf NoiseSuppressionConfig) *denoiser {
+	d := &denoiser{
+		over:  conf.OverSubtraction,
+		floor: conf.Floor,
+	}
+	d.stft = newSTFT(sampleRate, d.processSpectrum)
+	hopSeconds := float64(d.stft.hop) / float64(sampleRate)
+	d.riseFactor = math.Pow(10, noiseRiseDBPerSecond*hopSeconds/10)
+	d.noise = make([]float64, d.stft.bins())
+	d.gain = make([]float64, d.stft.bins())
+	d.resetState()
+	return d
+}
+
+func (d *denoiser) name() string { return stageNoiseSuppression }
+
+func (d *denoiser) process(frame []float32) { d.stft.push(frame, false) }
+
+func (d *denoiser) bypass(frame []float32) { d.stft.push(frame, true) }
+
+func (d *denoiser) latency() int { return d.stft.latency() }
+
+func (d *denoiser) reset() {
+	d.stft.reset()
+	d.resetState()
+}
+
+func (d *denoiser) resetState() {
+	d.blocks = 0
+	for k := range d.noise {
+		d.noise[k] = 0
+		d.gain[k] = 1
+	}
+}
+
+func (d *denoiser) processSpectrum(spec []complex128) {
+	d.blocks++
+	if d.blocks == 1 {
+		return
+	}
+	for k, x := range spec {
+		p := real(x)*real(x) + imag(x)*imag(x)
+
+		switch {
+		case d.blocks <= noiseInitBlocks+1:
+			d.noise[k] += (p - d.noise[k]) / float64(d.blocks-1)
+		case p < noiseUpdateRatio*d.noise[k]:
+			d.noise[k] = noiseSmoothing*d.noise[k] + (1-noiseSmoothing)*p
+		default:
+			d.noise[k] = math.Min(d.noise[k]*d.riseFactor, p)
+		}
+
+		g := d.floor
+		if p > 0 {
+			if g2 := 1 - d.over*d.noise[k]/p; g2 > d.floor*d.floor {
+				g = math.Sqrt(g2)
+			}
+		}
+		g = gainSmoothing*d.gain[k] + (1-gainSmoothing)*g
+		d.gain[k] = g
+		spec[k] = complex(real(x)*g, imag(x)*g)
+	}
+}
@@ -0,0 +1,86 @@
+package dsp
+
+import "math"
+
+// psdSmoothing 混响估计所用功率谱的时间平滑系数
+const psdSmoothing = 0.5
+
+// dereverb 晚期混响抑制（Lebart 统计模型）：把 delay 之前的平滑功率谱按 T60 指数衰减后作为
+// 当前帧的晚期混响功率，再做谱减。早期反射（delay 之内）保留，对语音清晰度影响小。
+type dereverb struct {
+	stft    *stft
+	floor   float64
+	decay   float64     // delay 内的功率衰减系数
+	history [][]float64 // 平滑功率谱的环形缓冲
+	pos     int
+	gain    []float64
+}
+
+func newDereverb(sampleRate int, conf DereverbConfig) *dereverb {
+	d := &dereverb{floor: conf.Floor}
+	d.stft = newSTFT(sampleRate, d.processSpectrum)
+	hopMs := float64(d.stft.hop) * 1000 / float64(sampleRate)
+	delayBlocks := int(math.Round(conf.DelayMs / hopMs))
+	if delayBlocks < 1 {
+		delayBlocks = 1
+	}
+	// 幅度按 60dB/T60 衰减，功率衰减系数 exp(-2δt)，δ = 3ln10/T60
+	delta := 3 * math.Ln10 / (conf.T60Ms / 1000)
+	d.decay = math.Exp(-2 * delta * float64(delayBlocks) * hopMs / 1000)
+	d.history = make([][]float64, delayBlocks)
+	for i := range d.history {
+		d.history[i] = make([]float64, d.stft.bins())
+	}
+	d.gain = make([]float64, d.stft.bins())
+	d.resetState()
+	return d
+}
+
+func (d *dereverb) name() string { return stageDereverb }
+
+func (d *dereverb) process(frame []float32) { d.stft.push(frame, false) }
+
+func (d *dereverb) bypass(frame []float32) { d.stft.push(frame, true) }
+
+func (d *dereverb) latency() int { return d.stft.latency() }
+
+func (d *dereverb) reset() {
+	d.stft.reset()
+	d.resetState()
+}
+
+func (d *dereverb) resetState() {
+	for _, h := range d.history {
+		for k := range h {
+			h[k] = 0
+		}
+	}
+	for k := range d.gain {
+		d.gain[k] = 1
+	}
+	d.pos = 0
+}
+
+func (d *dereverb) processSpectrum(spec []complex128) {
+	// history[pos] 是 delay 块之前的平滑功率谱，读取后覆盖为当前块
+	delayed := d.history[d.pos]
+	prev := d.history[(d.pos+len(d.history)-1)%len(d.history)]
+	for k, x := range spec {
+		p := real(x)*real(x) + imag(x)*imag(x)
+		late := d.decay * delayed[k]
+
+		g := 1.0
+		if p > 0 {
+			g = d.floor
+			if g2 := 1 - late/p; g2 > d.floor*d.floor {
+				g = math.Sqrt(g2)
+			}
+		}
+		g = gainSmoothing*d.gain[k] + (1-gainSmoothing)*g
+		d.gain[k] = g
+		spec[k] = complex(real(x)*g, imag(x)*g)
+
+		delayed[k] = psdSmoothing*prev[k] + (1-psdSmoothing)*p
+	}
+	d.pos = (d.pos + 1) % len(d.history)
+}
@@ -0,0 +1,514 @@
+package dsp
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-audio/wav"
+	"github.com/spf13/viper"
+)
+
+const testRate = 16000
+
+// speechLike 生成 400ms 有声 / 400ms 静音交替的类语音信号（160Hz 基频谐波 + 颤音），返回信号与有声掩码
+func speechLike(seconds float64, rms float64) ([]float32, []bool) {
+	n := int(seconds * testRate)
+	out := make([]float32, n)
+	voiced := make([]bool, n)
+	burst := testRate * 400 / 1000
+	var phase float64
+	for i := 0; i < n; i++ {
+		t := float64(i) / testRate
+		f0 := 160 + 20*math.Sin(2*math.Pi*3*t)
+		phase += 2 * math.Pi * f0 / testRate
+		if (i/burst)%2 == 0 {
+			continue
+		}
+		pos := float64(i%burst) / float64(burst)
+		env := math.Sin(math.Pi * pos) // 起止平滑
+		var v float64
+		for h := 1; h <= 15; h++ {
+			v += math.Sin(float64(h)*phase) / float64(h)
+		}
+		out[i] = float32(v * env)
+		voiced[i] = true
+	}
+	scaleToRMS(out, voiced, rms)
+	return out, voiced
+}
+
+func scaleToRMS(x []float32, mask []bool, rms float64) {
+	var sum float64
+	var count int
+	for i, v := range x {
+		if mask == nil || mask[i] {
+			sum += float64(v) * float64(v)
+			count++
+		}
+	}
+	scale := rms / math.Sqrt(sum/float64(count))
+	for i := range x {
+		x[i] = float32(float64(x[i]) * scale)
+	}
+}
+
+func whiteNoise(n int, rms float64, seed int64) []float32 {
+	r := rand.New(rand.NewSource(seed))
+	out := make([]float32, n)
+	for i := range out {
+		out[i] = float32(r.NormFloat64() * rms)
+	}
+	return out
+}
+
+func mix(a, b []float32) []float32 {
+	out := make([]float32, len(a))
+	for i := range a {
+		out[i] = a[i] + b[i]
+	}
+	return out
+}
+
+// run 以 20ms 帧流式处理并去掉处理链延迟，使输出与输入对齐
+func run(c *Chain, in []float32) []float32 {
+	out := make([]float32, 0, len(in))
+	frame := testRate * 20 / 1000
+	padded := append(append([]float32(nil), in...), make([]float32, int(c.Latency().Seconds()*testRate)+frame)...)
+	for start := 0; start+frame <= len(padded); start += frame {
+		f := append([]float32(nil), padded[start:start+frame]...)
+		c.Process(f)
+		out = append(out, f...)
+	}
+	delay := int(c.Latency().Seconds() * testRate)
+	return out[delay : delay+len(in)]
+}
+
+// energyDB 统计 from 秒之后、掩码为 want 的样本能量；guard 为掩码边界两侧排除的样本数
+func energyDB(x []float32, mask []bool, want bool, from float64, guard int) float64 {
+	var sum float64
+	var count int
+	for i := int(from * testRate); i < len(x); i++ {
+		if mask[i] != want || nearEdge(mask, i, guard) {
+			continue
+		}
+		sum += float64(x[i]) * float64(x[i])
+		count++
+	}
+	return 10 * math.Log10(sum/float64(count)+1e-20)
+}
+
+func nearEdge(mask []bool, i, guard int) bool {
+	for _, j := range []int{i - guard, i + guard} {
+		if j >= 0 && j < len(mask) && mask[j] != mask[i] {
+			return true
+		}
+	}
+	return false
+}
+
+func onlyStage(enable func(*Config)) Config {
+	conf := DefaultConfig()
+	conf.Enabled = true
+	conf.HighPass.Enabled = false
+	conf.NoiseSuppression.Enabled = false
+	conf.AGC.Enabled = false
+	conf.Dereverb.Enabled = false
+	enable(&conf)
+	return conf
+}
+
+func TestSTFTReconstructsWithAndWithoutBypass(t *testing.T) {
+	s := newSTFT(testRate, func([]complex128) {})
+	in := whiteNoise(testRate, 0.3, 1)
+	out := make([]float32, 0, len(in))
+	sizes := []int{320, 960, 160, 480}
+	for start, i := 0, 0; start < len(in); i++ {
+		end := start + sizes[i%len(sizes)]
+		if end > len(in) {
+			end = len(in)
+		}
+		f := append([]float32(nil), in[start:end]...)
+		s.push(f, i%7 >= 4) // 处理与直通交替切换
+		out = append(out, f...)
+		start = end
+	}
+	delay := s.latency()
+	for i := delay; i < len(in); i++ {
+		if math.Abs(float64(out[i]-in[i-delay])) > 1e-5 {
+			t.Fatalf("sample %d: got %v, want %v", i, out[i], in[i-delay])
+		}
+	}
+}
+
+func TestHighPassRemovesDCAndHum(t *testing.T) {
+	c := NewChain(testRate, onlyStage(func(c *Config) { c.HighPass.Enabled = true }))
+	n := 2 * testRate
+	in := make([]float32, n)
+	tone := make([]float32, n)
+	for i := range in {
+		ts := float64(i) / testRate
+		tone[i] = float32(0.1 * math.Sin(2*math.Pi*1000*ts))
+		in[i] = 0.2 + float32(0.1*math.Sin(2*math.Pi*30*ts)) + tone[i]
+	}
+	out := run(c, in)
+
+	tail := out[testRate:]
+	var mean float64
+	for _, v := range tail {
+		mean += float64(v)
+	}
+	mean /= float64(len(tail))
+	if math.Abs(mean) > 1e-3 {
+		t.Fatalf("DC not removed: mean = %v", mean)
+	}
+	all := make([]bool, n)
+	for i := range all {
+		all[i] = true
+	}
+	if diff := energyDB(out, all, true, 1, 0) - energyDB(tone, all, true, 1, 0); math.Abs(diff) > 1 {
+		t.Fatalf("output vs 1kHz tone = %.2f dB, want within 1 dB (hum removed, speech band kept)", diff)
+	}
+}
+
+func TestNoiseSuppressionImprovesSNR(t *testing.T) {
+	speech, voiced := speechLike(6, 0.1)
+	noisy := mix(speech, whiteNoise(len(speech), 0.1/math.Pow(10, 5.0/20), 2)) // 5dB SNR
+	c := NewChain(testRate, onlyStage(func(c *Config) { c.NoiseSuppression.Enabled = true }))
+	out := run(c, noisy)
+
+	guard := testRate * 40 / 1000
+	noiseIn := energyDB(noisy, voiced, false, 1, guard)
+	noiseOut := energyDB(out, voiced, false, 1, guard)
+	speechIn := energyDB(noisy, voiced, true, 1, guard)
+	speechOut := energyDB(out, voiced, true, 1, guard)
+	t.Logf("noise %.1f -> %.1f dB, speech %.1f -> %.1f dB", noiseIn, noiseOut, speechIn, speechOut)
+
+	if reduction := noiseIn - noiseOut; reduction < 10 {
+		t.Fatalf("noise reduced by %.1f dB, want >= 10 dB", reduction)
+	}
+	if loss := speechIn - speechOut; loss > 3 {
+		t.Fatalf("speech attenuated by %.1f dB, want <= 3 dB", loss)
+	}
+	if gain := (speechOut - noiseOut) - (speechIn - noiseIn); gain < 8 {
+		t.Fatalf("SNR improved by %.1f dB, want >= 8 dB", gain)
+	}
+}
+
+func TestAGCLevelsQuietSpeechWithoutBoostingSilence(t *testing.T) {
+	speech, voiced := speechLike(6, math.Pow(10, -34.0/20))
+	floor := whiteNoise(len(speech), math.Pow(10, -75.0/20), 3)
+	in := mix(speech, floor)
+	c := NewChain(testRate, onlyStage(func(c *Config) { c.AGC.Enabled = true }))
+	out := run(c, in)
+
+	guard := testRate * 40 / 1000
+	level := energyDB(out, voiced, true, 3, guard)
+	if math.Abs(level-(-20)) > 3 {
+		t.Fatalf("speech level = %.1f dBFS, want -20±3", level)
+	}
+	// 第一段语音之前只有底噪，增益应保持 0dB
+	lead := out[:testRate*300/1000]
+	var sum float64
+	for _, v := range lead {
+		sum += float64(v) * float64(v)
+	}
+	if leadDB := 10 * math.Log10(sum/float64(len(lead))); leadDB > -72 {
+		t.Fatalf("leading silence boosted to %.1f dBFS", leadDB)
+	}
+}
+
+func TestAGCDoesNotClip(t *testing.T) {
+	speech, _ := speechLike(3, 0.5)
+	c := NewChain(testRate, onlyStage(func(c *Config) { c.AGC.Enabled = true }))
+	for _, v := range run(c, speech) {
+		if math.Abs(float64(v)) > agcPeakLimit+1e-3 {
+			t.Fatalf("sample %v exceeds limit", v)
+		}
+	}
+}
+
+func TestDereverbReducesLateTail(t *testing.T) {
+	dry, voiced := speechLike(6, 0.1)
+	// 指数衰减噪声冲激响应，T60 = 500ms
+	r := rand.New(rand.NewSource(4))
+	ir := make([]float64, testRate/2)
+	ir[0] = 1
+	for i := 1; i < len(ir); i++ {
+		ir[i] = 0.3 * r.NormFloat64() * math.Exp(-3*math.Ln10*float64(i)/testRate/0.5)
+	}
+	wet := make([]float32, len(dry))
+	for i := range dry {
+		if dry[i] == 0 {
+			continue
+		}
+		for j, h := range ir {
+			if i+j >= len(wet) {
+				break
+			}
+			wet[i+j] += float32(float64(dry[i]) * h)
+		}
+	}
+
+	plain := run(NewChain(testRate, onlyStage(func(c *Config) { c.HighPass.Enabled = true })), wet)
+	c := NewChain(testRate, onlyStage(func(c *Config) {
+		c.HighPass.Enabled = true
+		c.Dereverb.Enabled = true
+	}))
+	out := run(c, wet)
+
+	guard := testRate * 60 / 1000
+	tailPlain := energyDB(plain, voiced, false, 1, guard)
+	tailOut := energyDB(out, voiced, false, 1, guard)
+	speechPlain := energyDB(plain, voiced, true, 1, guard)
+	speechOut := energyDB(out, voiced, true, 1, guard)
+	t.Logf("tail %.1f -> %.1f dB, speech %.1f -> %.1f dB", tailPlain, tailOut, speechPlain, speechOut)
+	if tailPlain-tailOut < 3 {
+		t.Fatalf("reverb tail reduced by %.1f dB, want >= 3 dB", tailPlain-tailOut)
+	}
+	if speechPlain-speechOut > 3 {
+		t.Fatalf("speech attenuated by %.1f dB, want <= 3 dB", speechPlain-speechOut)
+	}
+}
+
+type slowStage struct {
+	cost      time.Duration
+	processed int
+	bypassed  int
+}
+
+func (s *slowStage) name() string { return "slow" }
+func (s *slowStage) process([]float32) {
+	s.processed++
+	time.Sleep(s.cost)
+}
+func (s *slowStage) bypass([]float32) { s.bypassed++ }
+func (s *slowStage) latency() int     { return 0 }
+func (s *slowStage) reset()           {}
+
+func TestStageOverBudgetIsBypassed(t *testing.T) {
+	slow := &slowStage{cost: 2 * time.Millisecond}
+	free := &slowStage{cost: 2 * time.Millisecond}
+	c := &Chain{sampleRate: testRate}
+	c.add(slow, 0.05) // 10ms 帧耗时 2ms，占比 20%
+	c.add(free, 0)    // 不限制
+	frame := make([]float32, testRate*10/1000)
+	for i := 0; i < budgetWarmupFrames+30; i++ {
+		c.Process(frame)
+	}
+
+	stats := c.Stats()
+	if stats[0].BypassEvents != 1 || slow.bypassed == 0 {
+		t.Fatalf("slow stage stats = %+v, bypassed = %d", stats[0], slow.bypassed)
+	}
+	if stats[0].Frames+stats[0].BypassedFrames != budgetWarmupFrames+30 {
+		t.Fatalf("frame accounting = %+v", stats[0])
+	}
+	if stats[1].BypassEvents != 0 || free.bypassed != 0 {
+		t.Fatalf("unbudgeted stage should never bypass: %+v", stats[1])
+	}
+}
+
+func TestNewChain(t *testing.T) {
+	var nilChain *Chain
+	nilChain.Process(make([]float32, 10))
+	if nilChain.Latency() != 0 || nilChain.Stats() != nil {
+		t.Fatal("nil chain should be a no-op")
+	}
+	if NewChain(testRate, DefaultConfig()) != nil {
+		t.Fatal("chain is disabled by default")
+	}
+	if NewChain(testRate, onlyStage(func(*Config) {})) != nil {
+		t.Fatal("chain without stages should be nil")
+	}
+
+	conf := DefaultConfig()
+	conf.Enabled = true
+	conf.Dereverb.Enabled = true
+	c := NewChain(testRate, conf)
+	want := []string{stageHighPass, stageNoiseSuppression, stageDereverb, stageAGC}
+	if got := c.Stages(); len(got) != len(want) {
+		t.Fatalf("stages = %v, want %v", got, want)
+	}
+	if c.Latency() != 64*time.Millisecond {
+		t.Fatalf("latency = %v, want 64ms (two 512-point STFT stages)", c.Latency())
+	}
+}
+
+func TestConfigFromMap(t *testing.T) {
+	viper.Set("audio_frontend", map[string]interface{}{
+		"enabled": true,
+		"agc":     map[string]interface{}{"target_dbfs": -24},
+	})
+	defer viper.Set("audio_frontend", nil)
+
+	conf := ConfigFromMap(map[string]interface{}{
+		"noise_suppression": map[string]interface{}{"enabled": false, "over_subtraction": 3},
+		"agc":               map[string]interface{}{"max_gain_db": 12.5},
+		"dereverb":          map[interface{}]interface{}{"enabled": true},
+	})
+	if !conf.Enabled || conf.NoiseSuppression.Enabled || conf.NoiseSuppression.OverSubtraction != 3 {
+		t.Fatalf("noise suppression = %+v", conf.NoiseSuppression)
+	}
+	if conf.AGC.TargetDBFS != -24 || conf.AGC.MaxGainDB != 12.5 || !conf.AGC.Enabled {
+		t.Fatalf("agc = %+v", conf.AGC)
+	}
+	if !conf.Dereverb.Enabled || conf.HighPass.CutoffHz != 80 {
+		t.Fatalf("conf = %+v", conf)
+	}
+	if err := conf.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	conf.AGC.TargetDBFS = 0
+	if conf.Validate() == nil {
+		t.Fatal("target_dbfs 0 should be rejected")
+	}
+	conf = DefaultConfig()
+	conf.NoiseSuppression.Budget = 2
+	if conf.Validate() == nil {
+		t.Fatal("budget > 1 should be rejected")
+	}
+}
+
+func TestMergeMaps(t *testing.T) {
+	agent := map[string]interface{}{
+		"enabled": true,
+		"agc":     map[string]interface{}{"enabled": true, "max_gain_db": 12},
+	}
+	device := map[string]interface{}{
+		"agc":      map[interface{}]interface{}{"max_gain_db": 20},
+		"dereverb": map[string]interface{}{"enabled": true},
+	}
+	merged := MergeMaps(agent, device)
+	conf := ConfigFromMap(merged)
+	if !conf.Enabled || !conf.AGC.Enabled || conf.AGC.MaxGainDB != 20 || !conf.Dereverb.Enabled {
+		t.Fatalf("merged conf = %+v", conf)
+	}
+	if stageMap(agent, "agc")["max_gain_db"] != 12 || agent["dereverb"] != nil {
+		t.Fatalf("agent map modified: %+v", agent)
+	}
+	if got := MergeMaps(agent, nil); got["enabled"] != true {
+		t.Fatalf("nil override = %+v", got)
+	}
+}
+
+// TestSampleFiles 对 test/test_audio 下的 16k 单声道 wav 样本跑完整处理链：
+// 输出不能出现 NaN/削波，底噪（能量最低 10% 的帧）不应被抬高。
+// 样本由 test/mqtt_udp/test_24000.wav 前 3 秒重采样到 16k 得到，分别为原始语音、叠加白噪声、叠加 50Hz 工频干扰
+func TestSampleFiles(t *testing.T) {
+	files, _ := filepath.Glob(filepath.Join("..", "..", "..", "..", "test", "test_audio", "*_16k.wav"))
+	if len(files) == 0 {
+		t.Fatal("test/test_audio 下缺少 16k wav 样本")
+	}
+	conf := DefaultConfig()
+	conf.Enabled = true
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			in := readWav(t, file)
+			out := run(NewChain(testRate, conf), in)
+			for i, v := range out {
+				if math.IsNaN(float64(v)) || math.Abs(float64(v)) > 1 {
+					t.Fatalf("sample %d invalid: %v", i, v)
+				}
+			}
+			floorIn, floorOut := noiseFloorDB(in), noiseFloorDB(out)
+			t.Logf("noise floor %.1f -> %.1f dBFS", floorIn, floorOut)
+			if floorOut > floorIn+1 {
+				t.Fatalf("noise floor raised from %.1f to %.1f dBFS", floorIn, floorOut)
+			}
+		})
+	}
+}
+
+func readWav(t *testing.T, path string) []float32 {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dec := wav.NewDecoder(f)
+	buf, err := dec.FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(dec.SampleRate) != testRate || dec.NumChans != 1 || dec.BitDepth != 16 {
+		t.Fatalf("样本须为 16k/单声道/16bit: %dHz %dch %dbit", dec.SampleRate, dec.NumChans, dec.BitDepth)
+	}
+	out := make([]float32, len(buf.Data))
+	for i, v := range buf.Data {
+		out[i] = float32(v) / 32768
+	}
+	return out
+}
+
+func noiseFloorDB(x []float32) float64 {
+	frame := testRate * 20 / 1000
+	var levels []float64
+	for start := 0; start+frame <= len(x); start += frame {
+		var sum float64
+		for _, v := range x[start : start+frame] {
+			sum += float64(v) * float64(v)
+		}
+		levels = append(levels, 10*math.Log10(sum/float64(frame)+1e-12))
+	}
+	if len(levels) == 0 {
+		return -120
+	}
+	// 取最低 10% 帧的平均电平
+	for i := 1; i < len(levels); i++ {
+		for j := i; j > 0 && levels[j] < levels[j-1]; j-- {
+			levels[j], levels[j-1] = levels[j-1], levels[j]
+		}
+	}
+	n := len(levels)/10 + 1
+	var sum float64
+	for _, l := range levels[:n] {
+		sum += l
+	}
+	return sum / float64(n)
+}
+
+func benchmarkStage(b *testing.B, enable func(*Config)) {
+	c := NewChain(testRate, onlyStage(enable))
+	frame := testRate * 20 / 1000
+	in := mix(whiteNoise(testRate, 0.05, 5), make([]float32, testRate))
+	buf := make([]float32, frame)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := (i * frame) % (len(in) - frame)
+		copy(buf, in[start:start+frame])
+		c.Process(buf)
+	}
+	// rtf: 处理耗时占 20ms 音频的比例，即 CPU 预算的对照值
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/float64(20*time.Millisecond), "rtf")
+}
+
+func BenchmarkHighPass(b *testing.B) {
+	benchmarkStage(b, func(c *Config) { c.HighPass.Enabled = true })
+}
+
+func BenchmarkNoiseSuppression(b *testing.B) {
+	benchmarkStage(b, func(c *Config) { c.NoiseSuppression.Enabled = true })
+}
+
+func BenchmarkDereverb(b *testing.B) {
+	benchmarkStage(b, func(c *Config) { c.Dereverb.Enabled = true })
+}
+
+func BenchmarkAGC(b *testing.B) {
+	benchmarkStage(b, func(c *Config) { c.AGC.Enabled = true })
+}
+
+func BenchmarkFullChain(b *testing.B) {
+	benchmarkStage(b, func(c *Config) {
+		c.HighPass.Enabled = true
+		c.NoiseSuppression.Enabled = true
+		c.Dereverb.Enabled = true
+		c.AGC.Enabled = true
+	})
+}
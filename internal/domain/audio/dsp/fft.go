@@ -0,0 +1,63 @@
+package dsp
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// fft 固定长度的基 2 复数 FFT，预先计算位反转表与旋转因子，可重复使用
+type fft struct {
+	n       int
+	rev     []int
+	twiddle []complex128
+}
+
+func newFFT(n int) *fft {
+	if n < 2 || n&(n-1) != 0 {
+		panic("dsp: fft size must be a power of two")
+	}
+	bits := 0
+	for 1<<bits < n {
+		bits++
+	}
+	rev := make([]int, n)
+	for i := range rev {
+		r := 0
+		for b := 0; b < bits; b++ {
+			if i&(1<<b) != 0 {
+				r |= 1 << (bits - 1 - b)
+			}
+		}
+		rev[i] = r
+	}
+	twiddle := make([]complex128, n/2)
+	for i := range twiddle {
+		twiddle[i] = cmplx.Exp(complex(0, -2*math.Pi*float64(i)/float64(n)))
+	}
+	return &fft{n: n, rev: rev, twiddle: twiddle}
+}
+
+// transform 原地变换；inverse 时不做 1/n 归一化，由调用方处理
+func (f *fft) transform(x []complex128, inverse bool) {
+	for i, r := range f.rev {
+		if i < r {
+			x[i], x[r] = x[r], x[i]
+		}
+	}
+	for size := 2; size <= f.n; size <<= 1 {
+		half := size / 2
+		step := f.n / size
+		for start := 0; start < f.n; start += size {
+			for k := 0; k < half; k++ {
+				w := f.twiddle[k*step]
+				if inverse {
+					w = cmplx.Conj(w)
+				}
+				a := x[start+k]
+				b := x[start+k+half] * w
+				x[start+k] = a + b
+				x[start+k+half] = a - b
+			}
+		}
+	}
+}
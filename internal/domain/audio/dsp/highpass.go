@@ -0,0 +1,47 @@
+package dsp
+
+import "math"
+
+// highPass 二阶巴特沃斯高通（RBJ biquad，转置直接 II 型），去除直流偏置与低频嗡声
+type highPass struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func newHighPass(sampleRate int, cutoffHz float64) *highPass {
+	if nyquist := float64(sampleRate) / 2; cutoffHz >= nyquist {
+		cutoffHz = nyquist / 2
+	}
+	w0 := 2 * math.Pi * cutoffHz / float64(sampleRate)
+	cosW0 := math.Cos(w0)
+	alpha := math.Sin(w0) / math.Sqrt2 // sin(w0)/(2Q)，Q = 1/sqrt(2)
+	a0 := 1 + alpha
+	return &highPass{
+		b0: (1 + cosW0) / 2 / a0,
+		b1: -(1 + cosW0) / a0,
+		b2: (1 + cosW0) / 2 / a0,
+		a1: -2 * cosW0 / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
+
+func (h *highPass) name() string { return stageHighPass }
+
+func (h *highPass) process(frame []float32) {
+	for i, v := range frame {
+		x := float64(v)
+		y := h.b0*x + h.z1
+		h.z1 = h.b1*x - h.a1*y + h.z2
+		h.z2 = h.b2*x - h.a2*y
+		frame[i] = float32(y)
+	}
+}
+
+// bypass 无延迟，直通时不改动数据；滤波器状态保留，恢复后短暂过渡即可
+func (h *highPass) bypass(frame []float32) {}
+
+func (h *highPass) latency() int { return 0 }
+
+func (h *highPass) reset() {
+	h.z1, h.z2 = 0, 0
+}
@@ -0,0 +1,118 @@
+package dsp
+
+import "math"
+
+// stftWindowMs 频域处理的分析窗长，按采样率取不小于该时长的 2 的幂
+const stftWindowMs = 32
+
+// stft 流式短时傅里叶变换：50% 重叠、sqrt-Hann 分析/合成窗，overlap-add 完美重建。
+// 输入帧长可以任意，输出与输入等长，整体固定延迟 size 个采样。
+type stft struct {
+	size, hop int
+	window    []float64 // sqrt-Hann
+	power     []float64 // window²，直通时用于保持 overlap-add 状态一致
+	buf       []float64 // 当前分析窗
+	ola       []float64 // overlap-add 累加区
+	spec      []complex128
+	fft       *fft
+
+	inFIFO  []float32
+	outFIFO []float32
+
+	// process 修改 0..size/2 的频点，其余由共轭对称补齐
+	process func(spec []complex128)
+}
+
+func newSTFT(sampleRate int, process func(spec []complex128)) *stft {
+	size := 2
+	for size < sampleRate*stftWindowMs/1000 {
+		size <<= 1
+	}
+	hop := size / 2
+	s := &stft{
+		size:    size,
+		hop:     hop,
+		window:  make([]float64, size),
+		power:   make([]float64, size),
+		buf:     make([]float64, size),
+		ola:     make([]float64, size),
+		spec:    make([]complex128, size),
+		fft:     newFFT(size),
+		outFIFO: make([]float32, hop),
+		process: process,
+	}
+	for i := range s.window {
+		hann := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size))
+		s.window[i] = math.Sqrt(hann)
+		s.power[i] = hann
+	}
+	return s
+}
+
+// bins 单边频谱的频点数
+func (s *stft) bins() int {
+	return s.size/2 + 1
+}
+
+// latency 固定延迟（采样数）
+func (s *stft) latency() int {
+	return s.size
+}
+
+// push 原地处理一帧；bypass 时跳过频域运算但保持相同延迟，切换前后信号连续
+func (s *stft) push(frame []float32, bypass bool) {
+	s.inFIFO = append(s.inFIFO, frame...)
+	consumed := 0
+	for len(s.inFIFO)-consumed >= s.hop {
+		s.block(s.inFIFO[consumed:consumed+s.hop], bypass)
+		consumed += s.hop
+	}
+	s.inFIFO = append(s.inFIFO[:0], s.inFIFO[consumed:]...)
+
+	copy(frame, s.outFIFO[:len(frame)])
+	s.outFIFO = append(s.outFIFO[:0], s.outFIFO[len(frame):]...)
+}
+
+func (s *stft) block(in []float32, bypass bool) {
+	copy(s.buf, s.buf[s.hop:])
+	for i, v := range in {
+		s.buf[s.size-s.hop+i] = float64(v)
+	}
+
+	if bypass {
+		for i, v := range s.buf {
+			s.ola[i] += s.power[i] * v
+		}
+	} else {
+		for i, v := range s.buf {
+			s.spec[i] = complex(v*s.window[i], 0)
+		}
+		s.fft.transform(s.spec, false)
+		s.process(s.spec[:s.bins()])
+		for i := 1; i < s.size/2; i++ {
+			s.spec[s.size-i] = complex(real(s.spec[i]), -imag(s.spec[i]))
+		}
+		s.fft.transform(s.spec, true)
+		scale := 1 / float64(s.size)
+		for i := range s.ola {
+			s.ola[i] += real(s.spec[i]) * scale * s.window[i]
+		}
+	}
+
+	for _, v := range s.ola[:s.hop] {
+		s.outFIFO = append(s.outFIFO, float32(v))
+	}
+	copy(s.ola, s.ola[s.hop:])
+	for i := s.size - s.hop; i < s.size; i++ {
+		s.ola[i] = 0
+	}
+}
+
+func (s *stft) reset() {
+	for i := range s.buf {
+		s.buf[i] = 0
+		s.ola[i] = 0
+	}
+	s.inFIFO = s.inFIFO[:0]
+	s.outFIFO = append(s.outFIFO[:0], make([]float32, s.hop)...)
+}
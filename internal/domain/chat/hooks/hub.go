@@ -3,6 +3,7 @@ package hooks
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	pkghooks "xiaozhi-esp32-server-golang/internal/pkg/hooks"
 	log "xiaozhi-esp32-server-golang/logger"
@@ -14,16 +15,63 @@ type AsyncHandler func(Context, any)
 type Hub struct {
 	hub        *pkghooks.Hub
 	lifecycles []Lifecycle
+	closeOnce  sync.Once
 }
 
+// hubTracker 记录进程内所有会话级 Hub，关闭时把统计折叠进 retired，保证聚合计数单调递增
+var hubTracker = struct {
+	mu      sync.Mutex
+	live    map[*Hub]struct{}
+	retired pkghooks.Stats
+}{live: make(map[*Hub]struct{})}
+
 func NewHub(parent context.Context, opts ...pkghooks.HubOption) *Hub {
-	return &Hub{hub: pkghooks.NewHub(parent, opts...)}
+	h := &Hub{hub: pkghooks.NewHub(parent, opts...)}
+	hubTracker.mu.Lock()
+	hubTracker.live[h] = struct{}{}
+	hubTracker.mu.Unlock()
+	return h
+}
+
+// AggregateStats 汇总所有会话 Hub（含已关闭的）的插件统计
+func AggregateStats() pkghooks.Stats {
+	hubTracker.mu.Lock()
+	defer hubTracker.mu.Unlock()
+
+	out := pkghooks.Stats{}
+	mergeStats(&out, hubTracker.retired)
+	for h := range hubTracker.live {
+		mergeStats(&out, h.Stats())
+	}
+	return out
+}
+
+func mergeStats(dst *pkghooks.Stats, src pkghooks.Stats) {
+	if dst.Plugins == nil {
+		dst.Plugins = make(map[string]pkghooks.PluginStats)
+	}
+	// 会话 Hub 共享同一个 observer executor，队列长度取最大值而不是求和
+	if src.AsyncQueueLength > dst.AsyncQueueLength {
+		dst.AsyncQueueLength = src.AsyncQueueLength
+	}
+	dst.DroppedAsync += src.DroppedAsync
+	for name, st := range src.Plugins {
+		cur := dst.Plugins[name]
+		cur.Invocations += st.Invocations
+		cur.Errors += st.Errors
+		cur.Stops += st.Stops
+		cur.Timeouts += st.Timeouts
+		cur.DroppedAsync += st.DroppedAsync
+		cur.TotalDurationMs += st.TotalDurationMs
+		dst.Plugins[name] = cur
+	}
 }
 
 func (h *Hub) Close() {
 	if h == nil || h.hub == nil {
 		return
 	}
+	h.closeOnce.Do(h.retire)
 	h.hub.Close()
 	for i := len(h.lifecycles) - 1; i >= 0; i-- {
 		if err := h.lifecycles[i].Close(); err != nil {
@@ -32,6 +80,15 @@ func (h *Hub) Close() {
 	}
 }
 
+func (h *Hub) retire() {
+	stats := h.hub.Stats()
+	stats.AsyncQueueLength = 0
+	hubTracker.mu.Lock()
+	delete(hubTracker.live, h)
+	mergeStats(&hubTracker.retired, stats)
+	hubTracker.mu.Unlock()
+}
+
 func (h *Hub) InitLifecycle(ctx context.Context, lc Lifecycle) error {
 	if h == nil || lc == nil {
 		return nil
@@ -2,9 +2,12 @@ package hooks
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
+	"xiaozhi-esp32-server-golang/internal/pkg/metrics"
 	log "xiaozhi-esp32-server-golang/logger"
 )
 
@@ -21,6 +24,19 @@ type turnMetric struct {
 	ttsStartTs      int64
 	ttsFirstFrameTs int64
 	ttsStopTs       int64
+
+	asrProvider string
+	llmProvider string
+	ttsProvider string
+
+	intent    *IntentHit
+	endOfTurn *EndOfTurn
+
+	deviceID   string
+	experiment string
+	variant    string
+	// err 本轮首个阶段错误，context.Canceled 视为用户打断
+	err error
 }
 
 type statisticPlugin struct {
@@ -51,7 +67,7 @@ func BuiltinRegistrations() []Registration {
 	meta := PluginMeta{
 		Name:        "statistic_plugin",
 		Version:     "v1",
-		Description: "Track only the latest turn metrics and log on turn end",
+		Description: "Track only the latest turn metrics, log and export them on turn end",
 		Priority:    100,
 		Enabled:     true,
 		Kind:        PluginKindObserver,
@@ -82,12 +98,14 @@ func (p *statisticPlugin) onMetric(ctx Context, payload any) {
 	tm := p.getTurnForStageLocked(ctx.SessionID, data.Stage)
 	var completed *turnMetric
 	if tm != nil {
+		applyContextLocked(tm, ctx)
 		completed = p.applyMetricLocked(ctx.SessionID, tm, data)
 	}
 	p.mu.Unlock()
 
 	if completed != nil {
 		p.logTurnMetric(ctx.SessionID, completed)
+		p.observeTurnMetric(ctx.SessionID, completed)
 	}
 }
 
@@ -139,6 +157,11 @@ func (p *statisticPlugin) applyMetricLocked(sessionID string, tm *turnMetric, da
 		return nil
 	}
 
+	applyProviderLocked(tm, data)
+	if data.Err != nil && tm.err == nil {
+		tm.err = data.Err
+	}
+
 	switch data.Stage {
 	case MetricTurnStart:
 		if tm.turnStartTs == 0 || (data.Ts > 0 && data.Ts < tm.turnStartTs) {
@@ -183,10 +206,43 @@ func (p *statisticPlugin) applyMetricLocked(sessionID string, tm *turnMetric, da
 		if tm.ttsStartTs > 0 && tm.ttsStopTs == 0 {
 			tm.ttsStopTs = data.Ts
 		}
+	case MetricIntentHit:
+		if data.Intent != nil {
+			hit := *data.Intent
+			tm.intent = &hit
+		}
+	case MetricEndOfTurn:
+		if data.EndOfTurn != nil {
+			eot := *data.EndOfTurn
+			tm.endOfTurn = &eot
+		}
 	}
 	return nil
 }
 
+// applyContextLocked 记录轮次所属设备与实验分组，会话中途切换配置时以最新值为准
+func applyContextLocked(tm *turnMetric, ctx Context) {
+	if ctx.DeviceID != "" {
+		tm.deviceID = ctx.DeviceID
+	}
+	tm.experiment = ctx.Experiment
+	tm.variant = ctx.Variant
+}
+
+func applyProviderLocked(tm *turnMetric, data MetricData) {
+	if data.Provider == "" {
+		return
+	}
+	switch data.Stage {
+	case MetricAsrFirstText, MetricAsrFinalText:
+		tm.asrProvider = data.Provider
+	case MetricLlmStart, MetricLlmFirstToken, MetricLlmEnd:
+		tm.llmProvider = data.Provider
+	case MetricTtsStart, MetricTtsFirstFrame, MetricTtsStop:
+		tm.ttsProvider = data.Provider
+	}
+}
+
 func calcDelta(start, end int64) int64 {
 	if start <= 0 || end <= 0 || end < start {
 		return 0
@@ -200,10 +256,26 @@ func (p *statisticPlugin) logTurnMetric(sessionID string, tm *turnMetric) {
 		e2eTotalEndTs = tm.ttsStopTs
 	}
 
+	intent := "-"
+	if tm.intent != nil {
+		intent = tm.intent.Rule + "/" + tm.intent.Action
+	}
+	experiment := "-"
+	if tm.experiment != "" {
+		experiment = tm.experiment + "/" + tm.variant
+	}
+	endOfTurn := "-"
+	if tm.endOfTurn != nil {
+		endOfTurn = fmt.Sprintf("%s/%dms", tm.endOfTurn.Reason, tm.endOfTurn.Wait)
+	}
+
 	log.Infof(
-		"metric turn=%d session=%s asr_first=%dms asr_final=%dms llm_first=%dms llm_total=%dms tts_first=%dms tts_total=%dms e2e_first=%dms e2e_total=%dms",
+		"metric turn=%d session=%s intent=%s experiment=%s eot=%s asr_first=%dms asr_final=%dms llm_first=%dms llm_total=%dms tts_first=%dms tts_total=%dms e2e_first=%dms e2e_total=%dms",
 		tm.turnID,
 		sessionID,
+		intent,
+		experiment,
+		endOfTurn,
 		calcDelta(tm.turnStartTs, tm.asrFirstTextTs),
 		calcDelta(tm.asrFirstTextTs, tm.asrFinalTextTs),
 		calcDelta(tm.llmStartTs, tm.llmFirstTokenTs),
@@ -215,6 +287,43 @@ func (p *statisticPlugin) logTurnMetric(sessionID string, tm *turnMetric) {
 	)
 }
 
+func (p *statisticPlugin) observeTurnMetric(sessionID string, tm *turnMetric) {
+	turnEndTs := tm.turnEndTs
+	if turnEndTs == 0 {
+		turnEndTs = tm.ttsStopTs
+	}
+
+	sample := metrics.TurnSample{
+		AsrProvider:   tm.asrProvider,
+		LlmProvider:   tm.llmProvider,
+		TtsProvider:   tm.ttsProvider,
+		AsrFirstText:  time.Duration(calcDelta(tm.turnStartTs, tm.asrFirstTextTs)) * time.Millisecond,
+		LlmFirstToken: time.Duration(calcDelta(tm.llmStartTs, tm.llmFirstTokenTs)) * time.Millisecond,
+		TtsFirstFrame: time.Duration(calcDelta(tm.ttsStartTs, tm.ttsFirstFrameTs)) * time.Millisecond,
+		TurnEnd:       time.Duration(calcDelta(tm.turnStartTs, turnEndTs)) * time.Millisecond,
+		DeviceID:      tm.deviceID,
+		SessionID:     sessionID,
+		Experiment:    tm.experiment,
+		Variant:       tm.variant,
+	}
+	if tm.err != nil {
+		if errors.Is(tm.err, context.Canceled) {
+			sample.Interrupted = true
+		} else {
+			sample.Error = tm.err.Error()
+		}
+	}
+	if tm.intent != nil {
+		sample.IntentMatchType = tm.intent.MatchType
+		sample.IntentAction = tm.intent.Action
+	}
+	if tm.endOfTurn != nil {
+		sample.EndOfTurnReason = tm.endOfTurn.Reason
+		sample.EndOfTurnWait = time.Duration(tm.endOfTurn.Wait) * time.Millisecond
+	}
+	metrics.ObserveTurn(sample)
+}
+
 func (p *statisticPlugin) cleanupStaleLocked(nowTs int64) {
 	const ttl = int64(2 * 60 * 1000)
 
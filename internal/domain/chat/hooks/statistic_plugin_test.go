@@ -142,3 +142,79 @@ func TestStatisticPluginDoesNotCrossOldTurnEndIntoNewTurn(t *testing.T) {
 		t.Fatalf("turnEndTs = %d, want 0", tm.turnEndTs)
 	}
 }
+
+func TestStatisticPluginRecordsStageProviders(t *testing.T) {
+	plugin := newStatisticPlugin()
+	ctx := testHookContext("session-providers")
+
+	plugin.onMetric(ctx, MetricData{Stage: MetricTurnStart, Ts: 10})
+	plugin.onMetric(ctx, MetricData{Stage: MetricAsrFirstText, Ts: 20, Provider: "funasr"})
+	plugin.onMetric(ctx, MetricData{Stage: MetricLlmStart, Ts: 30, Provider: "openai"})
+	plugin.onMetric(ctx, MetricData{Stage: MetricTtsStart, Ts: 40, Provider: "edge"})
+
+	tm := plugin.current[ctx.SessionID]
+	if tm == nil {
+		t.Fatalf("expected active turn for session %q", ctx.SessionID)
+	}
+	if tm.asrProvider != "funasr" || tm.llmProvider != "openai" || tm.ttsProvider != "edge" {
+		t.Fatalf("providers = %q/%q/%q, want funasr/openai/edge", tm.asrProvider, tm.llmProvider, tm.ttsProvider)
+	}
+}
+
+func TestStatisticPluginRecordsIntentHit(t *testing.T) {
+	plugin := newStatisticPlugin()
+	ctx := testHookContext("session-intent")
+
+	plugin.onMetric(ctx, MetricData{Stage: MetricTurnStart, Ts: 10})
+	plugin.onMetric(ctx, MetricData{Stage: MetricAsrFinalText, Ts: 20, Provider: "funasr"})
+	plugin.onMetric(ctx, MetricData{Stage: MetricIntentHit, Ts: 25, Intent: &IntentHit{Rule: "关灯", MatchType: "keyword", Action: "tool", Score: 1}})
+
+	tm := plugin.current[ctx.SessionID]
+	if tm == nil || tm.intent == nil {
+		t.Fatalf("expected intent hit to be recorded")
+	}
+	if tm.intent.Rule != "关灯" || tm.intent.Action != "tool" {
+		t.Fatalf("intent = %+v, want 关灯/tool", tm.intent)
+	}
+	if tm.llmStartTs != 0 {
+		t.Fatalf("llmStartTs = %d, want 0 for a turn routed without LLM", tm.llmStartTs)
+	}
+}
+
+func TestStatisticPluginRecordsEndOfTurn(t *testing.T) {
+	plugin := newStatisticPlugin()
+	ctx := testHookContext("session-eot")
+
+	plugin.onMetric(ctx, MetricData{Stage: MetricTurnStart, Ts: 10})
+	plugin.onMetric(ctx, MetricData{Stage: MetricEndOfTurn, Ts: 900, EndOfTurn: &EndOfTurn{Reason: "trailing_linker", Source: "rule", Wait: 1600, Silence: 1620}})
+
+	tm := plugin.current[ctx.SessionID]
+	if tm == nil || tm.endOfTurn == nil {
+		t.Fatalf("expected end of turn decision to be recorded")
+	}
+	if tm.endOfTurn.Reason != "trailing_linker" || tm.endOfTurn.Wait != 1600 {
+		t.Fatalf("endOfTurn = %+v, want trailing_linker/1600", tm.endOfTurn)
+	}
+}
+
+func TestStatisticPluginTagsExperimentAndOutcome(t *testing.T) {
+	plugin := newStatisticPlugin()
+	ctx := testHookContext("session-experiment")
+	ctx.Experiment = "3"
+	ctx.Variant = "B"
+
+	plugin.onMetric(ctx, MetricData{Stage: MetricTurnStart, Ts: 10})
+	plugin.onMetric(ctx, MetricData{Stage: MetricTtsStart, Ts: 20})
+	plugin.onMetric(ctx, MetricData{Stage: MetricTtsStop, Ts: 30, Err: context.Canceled})
+
+	tm := plugin.current[ctx.SessionID]
+	if tm == nil {
+		t.Fatalf("expected active turn for session %q", ctx.SessionID)
+	}
+	if tm.experiment != "3" || tm.variant != "B" || tm.deviceID != "device-test" {
+		t.Fatalf("turn tags = %q/%q/%q, want 3/B/device-test", tm.experiment, tm.variant, tm.deviceID)
+	}
+	if tm.err != context.Canceled {
+		t.Fatalf("err = %v, want context.Canceled", tm.err)
+	}
+}
@@ -12,6 +12,9 @@ type Context struct {
 	Ctx       context.Context
 	SessionID string
 	DeviceID  string
+	// Experiment / Variant 设备命中的 A/B 实验 ID 与分组，未参与实验时为空
+	Experiment string
+	Variant    string
 }
 
 type PluginKind string
@@ -156,10 +159,36 @@ const (
 	MetricTtsStart      MetricStage = "tts_start"
 	MetricTtsFirstFrame MetricStage = "tts_first_frame"
 	MetricTtsStop       MetricStage = "tts_stop"
+	// MetricIntentHit 意图路由命中规则（命中后可能跳过 LLM）
+	MetricIntentHit MetricStage = "intent_hit"
+	// MetricEndOfTurn 语义断句判定用户说完
+	MetricEndOfTurn MetricStage = "end_of_turn"
 )
 
 type MetricData struct {
 	Stage MetricStage
 	Ts    int64
 	Err   error
+	// Provider 产生该阶段的服务提供者（asr/llm/tts 阶段填写）
+	Provider string
+	// Intent 命中的意图规则（intent_hit 阶段填写）
+	Intent *IntentHit
+	// EndOfTurn 断句判定信息（end_of_turn 阶段填写）
+	EndOfTurn *EndOfTurn
+}
+
+// EndOfTurn 语义断句判定信息
+type EndOfTurn struct {
+	Reason  string // 判定依据，如 question、trailing_linker、classifier_complete
+	Source  string // rule / classifier
+	Wait    int64  // 本句的自适应等待时长（毫秒）
+	Silence int64  // 判定时的静音时长（毫秒）
+}
+
+// IntentHit 意图路由命中信息
+type IntentHit struct {
+	Rule      string
+	MatchType string
+	Action    string
+	Score     float64
 }
@@ -2,18 +2,33 @@ package user_config
 
 import (
 	"fmt"
+	"sync"
 
+	file_config "xiaozhi-esp32-server-golang/internal/domain/config/file"
 	"xiaozhi-esp32-server-golang/internal/domain/config/manager"
+	"xiaozhi-esp32-server-golang/internal/domain/config/memory"
 	userconfig_redis "xiaozhi-esp32-server-golang/internal/domain/config/redis"
 	"xiaozhi-esp32-server-golang/internal/util"
 )
 
 // Config 用户配置提供者配置结构
 type Config struct {
-	Type       string                 `json:"type"`       // 存储类型: "redis", "memory", "file"
+	Type       string                 `json:"type"`       // 存储类型: "redis", "manager", "memory", "file"
 	Parameters map[string]interface{} `json:"parameters"` // 存储相关配置参数
 }
 
+var (
+	registeredProvidersMu sync.RWMutex
+	registeredProviders   = map[string]UserConfigProvider{}
+)
+
+// RegisterProvider 注册自定义的用户配置提供者实例（如回放工具使用的静态配置），同名时优先于内置类型
+func RegisterProvider(providerType string, provider UserConfigProvider) {
+	registeredProvidersMu.Lock()
+	defer registeredProvidersMu.Unlock()
+	registeredProviders[providerType] = provider
+}
+
 func GetProvider(sType string) (UserConfigProvider, error) {
 	config := make(map[string]interface{})
 	if sType == "manager" {
@@ -33,7 +48,7 @@ func GetProvider(sType string) (UserConfigProvider, error) {
 
 // GetUserConfigProvider 创建用户配置提供者
 // 根据传入的存储类型和配置参数创建对应的提供者实例
-// providerType: 提供者类型，支持 "redis", "memory", "file"
+// providerType: 提供者类型，支持 "redis", "manager", "memory", "file"
 // config: 提供者配置参数
 // 返回UserConfigProvider接口，支持完整的CRUD操作
 func GetUserConfigProvider(providerType string, config map[string]interface{}) (UserConfigProvider, error) {
@@ -41,6 +56,13 @@ func GetUserConfigProvider(providerType string, config map[string]interface{}) (
 		config = make(map[string]interface{})
 	}
 
+	registeredProvidersMu.RLock()
+	provider, ok := registeredProviders[providerType]
+	registeredProvidersMu.RUnlock()
+	if ok {
+		return provider, nil
+	}
+
 	switch providerType {
 	case "redis":
 		// 创建Redis用户配置提供者
@@ -56,6 +78,20 @@ func GetUserConfigProvider(providerType string, config map[string]interface{}) (
 			return nil, fmt.Errorf("创建后端管理系统用户配置提供者失败: %v", err)
 		}
 		return provider, nil
+	case "memory":
+		// 创建内存用户配置提供者（测试或临时场景）
+		provider, err := memory.NewMemoryUserConfigProvider(config)
+		if err != nil {
+			return nil, fmt.Errorf("创建内存用户配置提供者失败: %v", err)
+		}
+		return provider, nil
+	case "file":
+		// 声明式文件配置提供者为全局单例（负责目录监听与热更新），参数来自 config_provider.file
+		provider, err := file_config.GetProvider()
+		if err != nil {
+			return nil, fmt.Errorf("创建文件用户配置提供者失败: %v", err)
+		}
+		return provider, nil
 	default:
 		return nil, fmt.Errorf("不支持的用户配置提供者: %s", providerType)
 	}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	log "xiaozhi-esp32-server-golang/logger"
 
+	file_config "xiaozhi-esp32-server-golang/internal/domain/config/file"
 	"xiaozhi-esp32-server-golang/internal/domain/config/manager"
 	"xiaozhi-esp32-server-golang/internal/domain/config/memory"
 	redis_config "xiaozhi-esp32-server-golang/internal/domain/config/redis"
@@ -47,6 +48,8 @@ func InitConfigSystem(ctx context.Context) error {
 		return redis_config.Init(ctx)
 	case "memory":
 		return memory.Init(ctx)
+	case "file":
+		return file_config.Init(ctx)
 	default:
 		return fmt.Errorf("unsupported config provider type: %s", providerType)
 	}
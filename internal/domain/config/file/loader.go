@@ -0,0 +1,233 @@
+package file_config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+)
+
+var (
+	defaultOpenClawEnterKeywords = []string{"打开龙虾", "进入龙虾"}
+	defaultOpenClawExitKeywords  = []string{"关闭龙虾", "退出龙虾"}
+)
+
+// snapshot 一次成功加载的只读配置快照，热更新时整体替换
+type snapshot struct {
+	doc      *Document
+	files    []string
+	loadedAt time.Time
+
+	system  string                            // system 的 JSON，空表示不覆盖
+	agents  map[string]*AgentSpec             // 按 ID
+	configs map[string]types.UConfig          // 按智能体 ID 预先构建好的配置
+	devices map[string]string                 // 设备 ID -> 智能体 ID
+	audio   map[string]map[string]interface{} // 设备 ID -> 设备级音频前端覆盖项
+	roles   map[string]RoleSpec               // 按名称
+}
+
+func isConfigFile(name string) bool {
+	if strings.HasPrefix(filepath.Base(name), ".") {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// loadDir 读取目录下所有 YAML/JSON 文件（按文件名排序）合并、校验并构建快照
+func loadDir(dir string) (*snapshot, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置目录 %s 失败: %w", dir, err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || !isConfigFile(entry.Name()) {
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+	sort.Strings(files)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("配置目录 %s 中没有 YAML/JSON 文件", dir)
+	}
+
+	merged := &Document{}
+	for _, path := range files {
+		doc, err := parseFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := merged.merge(doc, filepath.Base(path)); err != nil {
+			return nil, err
+		}
+	}
+	if err := merged.Validate(); err != nil {
+		return nil, err
+	}
+	return buildSnapshot(merged, files)
+}
+
+// parseFile 解析单个文件。YAML 先转换为 JSON，再统一按 JSON 严格解码（禁止未知字段）
+func parseFile(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 失败: %w", path, err)
+	}
+	name := filepath.Base(path)
+
+	if strings.ToLower(filepath.Ext(path)) != ".json" {
+		var raw interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("%s: YAML 解析失败: %w", name, err)
+		}
+		if raw == nil {
+			return &Document{}, nil
+		}
+		if data, err = json.Marshal(raw); err != nil {
+			return nil, fmt.Errorf("%s: YAML 转换失败: %w", name, err)
+		}
+	}
+
+	var doc Document
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return &doc, nil
+}
+
+func buildSnapshot(doc *Document, files []string) (*snapshot, error) {
+	snap := &snapshot{
+		doc:      doc,
+		files:    files,
+		loadedAt: time.Now(),
+		agents:   make(map[string]*AgentSpec, len(doc.Agents)),
+		configs:  make(map[string]types.UConfig, len(doc.Agents)),
+		devices:  make(map[string]string, len(doc.Devices)),
+		audio:    make(map[string]map[string]interface{}),
+		roles:    make(map[string]RoleSpec, len(doc.Roles)),
+	}
+	if len(doc.System) > 0 {
+		data, err := json.Marshal(doc.System)
+		if err != nil {
+			return nil, fmt.Errorf("序列化 system 配置失败: %w", err)
+		}
+		snap.system = string(data)
+	}
+
+	kbByName := make(map[string]types.KnowledgeBaseRef, len(doc.KnowledgeBases))
+	for _, kb := range doc.KnowledgeBases {
+		if kb.Status == "" {
+			kb.Status = "active"
+		}
+		kbByName[kb.Name] = kb
+	}
+
+	for i := range doc.Agents {
+		agent := &doc.Agents[i]
+		snap.agents[agent.ID] = agent
+		snap.configs[agent.ID] = doc.agentConfig(agent, kbByName)
+	}
+	for _, device := range doc.Devices {
+		snap.devices[device.ID] = device.Agent
+		if len(device.AudioFrontend) > 0 {
+			snap.audio[device.ID] = device.AudioFrontend
+		}
+	}
+	for _, role := range doc.Roles {
+		snap.roles[role.Name] = role
+	}
+	return snap, nil
+}
+
+func (d *Document) agentConfig(agent *AgentSpec, kbByName map[string]types.KnowledgeBaseRef) types.UConfig {
+	asr := d.resolveProvider(d.Providers.Asr, agent.Asr)
+	tts := d.resolveProvider(d.Providers.Tts, agent.Tts)
+	llm := d.resolveProvider(d.Providers.Llm, agent.Llm)
+	vad := d.resolveProvider(d.Providers.Vad, agent.Vad)
+	memory := d.resolveProvider(d.Providers.Memory, agent.Memory)
+
+	cfg := types.UConfig{
+		SystemPrompt:    d.prompt(agent.Prompt, agent.PromptRef),
+		Asr:             types.AsrConfig{Provider: asr.Provider, Config: cloneMap(asr.Config)},
+		Tts:             types.TtsConfig{Provider: tts.Provider, Config: cloneMap(tts.Config)},
+		Llm:             types.LlmConfig{Provider: llm.Provider, Config: cloneMap(llm.Config)},
+		Vad:             types.VadConfig{Provider: vad.Provider, Config: cloneMap(vad.Config)},
+		Memory:          types.MemoryConfig{Provider: memory.Provider, Config: cloneMap(memory.Config)},
+		MemoryMode:      agent.MemoryMode,
+		AsrSpeed:        agent.AsrSpeed,
+		AgentId:         agent.ID,
+		AgentName:       agent.Name,
+		MCPServiceNames: strings.Join(agent.MCPServices, ","),
+		IntentRules:     agent.IntentRules,
+		MCPResources:    agent.MCPResources,
+		ToolPolicies:    agent.ToolPolicies,
+		AudioFrontend:   agent.AudioFrontend,
+		OpenClaw: types.OpenClawConfig{
+			EnterKeywords: append([]string(nil), defaultOpenClawEnterKeywords...),
+			ExitKeywords:  append([]string(nil), defaultOpenClawExitKeywords...),
+		},
+	}
+	if cfg.MemoryMode == "" {
+		cfg.MemoryMode = "short"
+	}
+	if agent.OpenClaw != nil {
+		cfg.OpenClaw.Allowed = agent.OpenClaw.Allowed
+		if len(agent.OpenClaw.EnterKeywords) > 0 {
+			cfg.OpenClaw.EnterKeywords = agent.OpenClaw.EnterKeywords
+		}
+		if len(agent.OpenClaw.ExitKeywords) > 0 {
+			cfg.OpenClaw.ExitKeywords = agent.OpenClaw.ExitKeywords
+		}
+	}
+	for _, name := range agent.KnowledgeBases {
+		cfg.KnowledgeBases = append(cfg.KnowledgeBases, kbByName[name])
+	}
+	return cfg
+}
+
+// resolveProvider 按名称引用取配置，未指定时取 default 配置（只有一个配置时即为默认）
+func (d *Document) resolveProvider(set map[string]ProviderSpec, ref string) ProviderSpec {
+	if ref != "" {
+		return set[ref]
+	}
+	if len(set) == 1 {
+		for _, spec := range set {
+			return spec
+		}
+	}
+	for _, spec := range set {
+		if spec.Default {
+			return spec
+		}
+	}
+	return ProviderSpec{}
+}
+
+func (d *Document) prompt(prompt, ref string) string {
+	if ref != "" {
+		return d.Prompts[ref]
+	}
+	return prompt
+}
+
+func cloneMap(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
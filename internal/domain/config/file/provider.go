@@ -0,0 +1,378 @@
+package file_config
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/internal/domain/audio/dsp"
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const (
+	defaultConfigDir = "config/declarative"
+	defaultStateFile = "data/file_provider_state.json"
+
+	activationTTL  = 300 * time.Second
+	reloadDebounce = 300 * time.Millisecond
+)
+
+// FileUserConfigProvider 声明式文件配置提供者：从目录加载设备、智能体、提示词、服务提供者、知识库与 MCP 选择，
+// 校验通过后原子替换快照；监听目录变化自动热更新，校验失败时保留旧快照。无需管理后台与 Redis。
+type FileUserConfigProvider struct {
+	dir          string
+	autoActivate bool
+
+	current atomic.Pointer[snapshot]
+	store   *stateStore
+
+	reloadMu sync.Mutex
+	watcher  *fsnotify.Watcher
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// Options 文件配置提供者参数
+type Options struct {
+	Dir       string
+	StateFile string
+	// AutoActivate 为 true 时未声明的设备完成 challenge 校验后自动激活（使用 default_agent）
+	AutoActivate bool
+}
+
+// New 加载配置目录并创建提供者，首次加载失败时返回错误
+func New(opts Options) (*FileUserConfigProvider, error) {
+	if strings.TrimSpace(opts.Dir) == "" {
+		opts.Dir = defaultConfigDir
+	}
+	store, err := openStateStore(opts.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	p := &FileUserConfigProvider{
+		dir:          opts.Dir,
+		autoActivate: opts.AutoActivate,
+		store:        store,
+		stop:         make(chan struct{}),
+	}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+var (
+	defaultProvider    *FileUserConfigProvider
+	defaultProviderErr error
+	providerOnce       sync.Once
+)
+
+// GetProvider 返回按 config_provider.file 配置创建并开启目录监听的全局提供者
+func GetProvider() (*FileUserConfigProvider, error) {
+	providerOnce.Do(func() {
+		stateFile := defaultStateFile
+		if viper.IsSet("config_provider.file.state_file") {
+			stateFile = viper.GetString("config_provider.file.state_file")
+		}
+		defaultProvider, defaultProviderErr = New(Options{
+			Dir:          viper.GetString("config_provider.file.dir"),
+			StateFile:    stateFile,
+			AutoActivate: viper.GetBool("config_provider.file.auto_activate"),
+		})
+		if defaultProviderErr != nil {
+			return
+		}
+		if !viper.IsSet("config_provider.file.watch") || viper.GetBool("config_provider.file.watch") {
+			if err := defaultProvider.Watch(); err != nil {
+				log.Warnf("监听配置目录 %s 失败，热更新不可用: %v", defaultProvider.dir, err)
+			}
+		}
+	})
+	return defaultProvider, defaultProviderErr
+}
+
+// Init 初始化文件配置提供者，配置目录无效时启动失败
+func Init(ctx context.Context) error {
+	p, err := GetProvider()
+	if err != nil {
+		return err
+	}
+	snap := p.current.Load()
+	log.Infof("File config provider initialized: dir=%s files=%d agents=%d devices=%d", p.dir, len(snap.files), len(snap.agents), len(snap.devices))
+	return nil
+}
+
+// Reload 重新加载配置目录，校验通过后原子替换快照；失败时保留当前快照并返回错误
+func (p *FileUserConfigProvider) Reload() error {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+	snap, err := loadDir(p.dir)
+	if err != nil {
+		return err
+	}
+	p.current.Store(snap)
+	log.Infof("声明式配置已加载: dir=%s files=%d agents=%d devices=%d", p.dir, len(snap.files), len(snap.agents), len(snap.devices))
+	return nil
+}
+
+// Watch 监听配置目录，文件变化后防抖重新加载。监听目录而非文件，兼容 ConfigMap/git-sync 的软链接整体替换
+func (p *FileUserConfigProvider) Watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(p.dir); err != nil {
+		watcher.Close()
+		return err
+	}
+	p.watcher = watcher
+
+	go func() {
+		var timer *time.Timer
+		reload := make(chan struct{}, 1)
+		for {
+			select {
+			case <-p.stop:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !isConfigFile(event.Name) && !strings.HasPrefix(filepath.Base(event.Name), "..") {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(reloadDebounce, func() {
+					select {
+					case reload <- struct{}{}:
+					default:
+					}
+				})
+			case <-reload:
+				if err := p.Reload(); err != nil {
+					log.Errorf("声明式配置重新加载失败，继续使用旧配置: %v", err)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warnf("配置目录监听出错: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Close 停止目录监听
+func (p *FileUserConfigProvider) Close() error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+		if p.watcher != nil {
+			p.watcher.Close()
+		}
+	})
+	return nil
+}
+
+// IsDeviceActivated 在配置文件中声明的设备或已通过本地激活的设备视为已激活
+func (p *FileUserConfigProvider) IsDeviceActivated(ctx context.Context, deviceId string, clientId string) (bool, error) {
+	if _, ok := p.current.Load().devices[deviceId]; ok {
+		return true, nil
+	}
+	return p.store.isActivated(deviceId), nil
+}
+
+// GetActivationInfo 返回激活码、challenge、提示语与超时时间（秒），同一设备在有效期内复用
+func (p *FileUserConfigProvider) GetActivationInfo(ctx context.Context, deviceId string, clientId string) (string, string, string, int) {
+	info, err := p.store.pending(deviceId, activationTTL, func() pendingChallenge {
+		return pendingChallenge{
+			Code:      fmt.Sprintf("%06d", rand.Intn(1000000)),
+			Challenge: uuid.New().String(),
+			CreatedAt: time.Now(),
+		}
+	})
+	if err != nil {
+		log.Warnf("保存设备 %s 激活信息失败: %v", deviceId, err)
+	}
+	if !p.autoActivate {
+		log.Infof("设备 %s 等待激活（激活码 %s），请在配置文件 devices 中添加该设备", deviceId, info.Code)
+	}
+	return info.Code, info.Challenge, fmt.Sprintf("xiaozhi\n%s", info.Code), int(activationTTL.Seconds())
+}
+
+// VerifyChallenge 已声明的设备直接通过；未声明的设备仅在开启 auto_activate 时按 challenge 激活
+func (p *FileUserConfigProvider) VerifyChallenge(ctx context.Context, deviceId string, clientId string, activationPayload types.ActivationPayload) (bool, error) {
+	if activated, _ := p.IsDeviceActivated(ctx, deviceId, clientId); activated {
+		return true, nil
+	}
+	if p.autoActivate && p.current.Load().doc.DefaultAgent == "" {
+		log.Warnf("设备 %s 无法自动激活：未配置 default_agent", deviceId)
+		return false, nil
+	}
+	return p.store.activate(deviceId, activationPayload.Challenge, p.autoActivate)
+}
+
+// GetUserConfig 返回设备绑定智能体的配置，已切换角色时叠加角色的提示词与 LLM/TTS
+func (p *FileUserConfigProvider) GetUserConfig(ctx context.Context, deviceID string) (types.UConfig, error) {
+	snap := p.current.Load()
+	agentID, ok := snap.devices[deviceID]
+	if !ok {
+		if !p.store.isActivated(deviceID) || snap.doc.DefaultAgent == "" {
+			return types.UConfig{}, fmt.Errorf("设备 %s 未在配置文件中声明", deviceID)
+		}
+		agentID = snap.doc.DefaultAgent
+	}
+	cfg := snap.agentConfig(agentID)
+	cfg.AudioFrontend = dsp.MergeMaps(cfg.AudioFrontend, snap.audio[deviceID])
+	if roleName := p.store.role(deviceID); roleName != "" {
+		if role, ok := snap.roles[roleName]; ok {
+			snap.applyRole(&cfg, role)
+		}
+	}
+	return cfg, nil
+}
+
+// SwitchDeviceRoleByName 按角色名（支持模糊匹配）切换设备角色，切换结果保存在本地状态中
+func (p *FileUserConfigProvider) SwitchDeviceRoleByName(ctx context.Context, deviceID string, roleName string) (string, error) {
+	snap := p.current.Load()
+	names := make([]string, 0, len(snap.roles))
+	for name := range snap.roles {
+		names = append(names, name)
+	}
+	matched := matchName(roleName, names)
+	if matched == "" {
+		return "", fmt.Errorf("未找到匹配的角色: %s", roleName)
+	}
+	if err := p.store.setRole(deviceID, matched); err != nil {
+		return "", err
+	}
+	return matched, nil
+}
+
+// RestoreDeviceDefaultRole 清除设备的角色覆盖
+func (p *FileUserConfigProvider) RestoreDeviceDefaultRole(ctx context.Context, deviceID string) error {
+	return p.store.setRole(deviceID, "")
+}
+
+// GetAgentConfig 在设备所属智能体的同一 owner 下按名称（支持模糊匹配）查找其它智能体
+func (p *FileUserConfigProvider) GetAgentConfig(ctx context.Context, deviceID string, agentName string) (types.UConfig, error) {
+	snap := p.current.Load()
+	currentID, ok := snap.devices[deviceID]
+	if !ok {
+		currentID = snap.doc.DefaultAgent
+	}
+	current, ok := snap.agents[currentID]
+	if !ok {
+		return types.UConfig{}, fmt.Errorf("设备 %s 未绑定智能体", deviceID)
+	}
+
+	names := make([]string, 0)
+	byName := make(map[string]string)
+	for _, agent := range snap.doc.Agents {
+		if agent.ID == current.ID || agent.Owner != current.Owner {
+			continue
+		}
+		names = append(names, agent.Name)
+		byName[agent.Name] = agent.ID
+	}
+	matched := matchName(agentName, names)
+	if matched == "" {
+		return types.UConfig{}, fmt.Errorf("未找到匹配的智能体: %s", agentName)
+	}
+	cfg := snap.agentConfig(byName[matched])
+	cfg.AudioFrontend = dsp.MergeMaps(cfg.AudioFrontend, snap.audio[deviceID])
+	return cfg, nil
+}
+
+// GetSystemConfig 返回配置文件中 system 部分的 JSON，由主程序合并到 viper
+func (p *FileUserConfigProvider) GetSystemConfig(ctx context.Context) (string, error) {
+	return p.current.Load().system, nil
+}
+
+func (p *FileUserConfigProvider) NotifyDeviceEvent(ctx context.Context, eventType string, eventData map[string]interface{}) {
+	// 没有管理后台，无需上报设备事件
+}
+
+func (p *FileUserConfigProvider) RegisterMessageEventHandler(ctx context.Context, eventType string, eventHandler types.EventHandler) {
+	// 没有管理后台下行通道，不支持消息注入
+}
+
+// agentConfig 复制预先构建的智能体配置，未在文件中指定的服务提供者回退到主配置文件的全局配置
+func (s *snapshot) agentConfig(agentID string) types.UConfig {
+	cfg := s.configs[agentID]
+	cfg.Asr.Config = cloneMap(cfg.Asr.Config)
+	cfg.Tts.Config = cloneMap(cfg.Tts.Config)
+	cfg.Llm.Config = cloneMap(cfg.Llm.Config)
+	cfg.Vad.Config = cloneMap(cfg.Vad.Config)
+	cfg.Memory.Config = cloneMap(cfg.Memory.Config)
+	fillFromViper("asr", &cfg.Asr.Provider, &cfg.Asr.Config)
+	fillFromViper("tts", &cfg.Tts.Provider, &cfg.Tts.Config)
+	fillFromViper("llm", &cfg.Llm.Provider, &cfg.Llm.Config)
+	fillFromViper("vad", &cfg.Vad.Provider, &cfg.Vad.Config)
+	fillFromViper("memory", &cfg.Memory.Provider, &cfg.Memory.Config)
+	return cfg
+}
+
+func (s *snapshot) applyRole(cfg *types.UConfig, role RoleSpec) {
+	if prompt := s.doc.prompt(role.Prompt, role.PromptRef); prompt != "" {
+		cfg.SystemPrompt = prompt
+	}
+	if role.Llm != "" {
+		spec := s.doc.Providers.Llm[role.Llm]
+		cfg.Llm = types.LlmConfig{Provider: spec.Provider, Config: cloneMap(spec.Config)}
+	}
+	if role.Tts != "" {
+		spec := s.doc.Providers.Tts[role.Tts]
+		cfg.Tts = types.TtsConfig{Provider: spec.Provider, Config: cloneMap(spec.Config)}
+	}
+}
+
+func fillFromViper(kind string, provider *string, config *map[string]interface{}) {
+	if *provider != "" {
+		return
+	}
+	*provider = viper.GetString(kind + ".provider")
+	if *provider != "" {
+		*config = viper.GetStringMap(kind + "." + *provider)
+	}
+}
+
+// matchName 名称匹配：完全一致优先，其次互相包含（忽略大小写与空白），多个候选时取名称最短的
+func matchName(query string, names []string) string {
+	q := normalizeName(query)
+	if q == "" {
+		return ""
+	}
+	best := ""
+	for _, name := range names {
+		n := normalizeName(name)
+		if n == "" {
+			continue
+		}
+		if n == q {
+			return name
+		}
+		if strings.Contains(n, q) || strings.Contains(q, n) {
+			if best == "" || len(name) < len(best) {
+				best = name
+			}
+		}
+	}
+	return best
+}
+
+func normalizeName(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), ""))
+}
@@ -0,0 +1,296 @@
+package file_config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/domain/audio/dsp"
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+)
+
+const testProviders = `
+providers:
+  llm:
+    qwen: {provider: openai, config: {model_name: qwen-plus}, default: true}
+    deepseek: {provider: openai, config: {model_name: deepseek-chat}}
+  tts:
+    edge: {provider: edge, config: {voice: zh-CN-XiaoxiaoNeural}}
+  asr:
+    funasr: {provider: funasr, config: {host: 127.0.0.1}}
+  vad:
+    silero: {provider: silero_vad}
+  memory:
+    none: {provider: nomemo}
+prompts:
+  xiaozhi: 你是小智
+knowledge_bases:
+  - {name: 家居手册, provider: dify, external_kb_id: kb-1}
+`
+
+const testAgents = `
+default_agent: "1"
+agents:
+  - id: "1"
+    name: 小智
+    owner: alice
+    prompt_ref: xiaozhi
+    mcp_services: [home, music]
+    knowledge_bases: [家居手册]
+    intent_rules:
+      - {name: 关灯, match_type: keyword, patterns: [关灯], action: reply, reply: 好的}
+  - id: "2"
+    name: 家居控制
+    owner: alice
+    prompt: 你是家居控制助手
+    llm: deepseek
+    memory_mode: none
+    audio_frontend: {enabled: true, agc: {enabled: true, max_gain_db: 12}}
+  - id: "3"
+    name: 家居助理
+    owner: bob
+    prompt: 另一个用户的智能体
+roles:
+  - {name: 英语老师, prompt: You are an English teacher, llm: deepseek}
+devices:
+  - {id: "aa:bb", agent: "1"}
+  - {id: "a1:b2", agent: "2", audio_frontend: {agc: {max_gain_db: 20}, dereverb: {enabled: true}}}
+system:
+  ota: {test: {websocket: {url: "ws://127.0.0.1:8989/xiaozhi/v1/"}}}
+`
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestProvider(t *testing.T, autoActivate bool) (*FileUserConfigProvider, string) {
+	t.Helper()
+	dir := t.TempDir()
+	writeFile(t, dir, "00-providers.yaml", testProviders)
+	writeFile(t, dir, "10-agents.yml", testAgents)
+	writeFile(t, dir, "README.md", "ignored")
+	p, err := New(Options{Dir: dir, StateFile: filepath.Join(t.TempDir(), "state.json"), AutoActivate: autoActivate})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p, dir
+}
+
+func TestGetUserConfigResolvesReferences(t *testing.T) {
+	p, _ := newTestProvider(t, false)
+
+	cfg, err := p.GetUserConfig(context.Background(), "aa:bb")
+	if err != nil {
+		t.Fatalf("GetUserConfig: %v", err)
+	}
+	if cfg.AgentId != "1" || cfg.AgentName != "小智" || cfg.SystemPrompt != "你是小智" {
+		t.Fatalf("unexpected agent: %+v", cfg)
+	}
+	if cfg.Llm.Provider != "openai" || cfg.Llm.Config["model_name"] != "qwen-plus" {
+		t.Fatalf("expected default llm, got %+v", cfg.Llm)
+	}
+	if cfg.Tts.Provider != "edge" || cfg.Asr.Provider != "funasr" || cfg.Vad.Provider != "silero_vad" {
+		t.Fatalf("expected single providers to be used as default: %+v %+v %+v", cfg.Tts, cfg.Asr, cfg.Vad)
+	}
+	if cfg.MCPServiceNames != "home,music" || cfg.MemoryMode != "short" {
+		t.Fatalf("unexpected mcp=%q memory_mode=%q", cfg.MCPServiceNames, cfg.MemoryMode)
+	}
+	if len(cfg.KnowledgeBases) != 1 || cfg.KnowledgeBases[0].ExternalKBID != "kb-1" || cfg.KnowledgeBases[0].Status != "active" {
+		t.Fatalf("unexpected knowledge bases: %+v", cfg.KnowledgeBases)
+	}
+	if len(cfg.IntentRules) != 1 || cfg.IntentRules[0].Reply != "好的" {
+		t.Fatalf("unexpected intent rules: %+v", cfg.IntentRules)
+	}
+
+	// 返回值是副本，修改不影响快照
+	cfg.Llm.Config["model_name"] = "changed"
+	again, _ := p.GetUserConfig(context.Background(), "aa:bb")
+	if again.Llm.Config["model_name"] != "qwen-plus" {
+		t.Fatal("expected snapshot to be isolated from callers")
+	}
+
+	system, err := p.GetSystemConfig(context.Background())
+	if err != nil || !strings.Contains(system, `"ota"`) {
+		t.Fatalf("unexpected system config %q err=%v", system, err)
+	}
+	if _, err := p.GetUserConfig(context.Background(), "unknown"); err == nil {
+		t.Fatal("expected error for undeclared device")
+	}
+}
+
+func TestDeviceAudioFrontendOverride(t *testing.T) {
+	p, _ := newTestProvider(t, false)
+
+	cfg, err := p.GetUserConfig(context.Background(), "a1:b2")
+	if err != nil {
+		t.Fatalf("GetUserConfig: %v", err)
+	}
+	conf := dsp.ConfigFromMap(cfg.AudioFrontend)
+	if !conf.Enabled || !conf.AGC.Enabled || conf.AGC.MaxGainDB != 20 || !conf.Dereverb.Enabled {
+		t.Fatalf("expected device override on top of agent config, got %+v", conf)
+	}
+	// 其他设备切换到同一智能体时不受该设备覆盖影响
+	agentCfg, err := p.GetAgentConfig(context.Background(), "aa:bb", "家居控制")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf := dsp.ConfigFromMap(agentCfg.AudioFrontend); conf.AGC.MaxGainDB != 12 || conf.Dereverb.Enabled {
+		t.Fatalf("agent config modified by device override: %+v", conf)
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	cases := map[string]string{
+		"unknown field":     "agents:\n  - {id: \"1\", name: a, promt: typo}\n",
+		"missing reference": "agents:\n  - {id: \"1\", name: a, llm: missing}\n",
+		"unknown agent":     "agents:\n  - {id: \"1\", name: a}\ndevices:\n  - {id: d, agent: \"9\"}\n",
+		"bad regex":         "agents:\n  - id: \"1\"\n    name: a\n    intent_rules: [{name: r, match_type: regex, patterns: [\"(\"], action: llm}]\n",
+		"prompt no target":  "agents:\n  - id: \"1\"\n    name: a\n    intent_rules: [{name: r, match_type: keyword, patterns: [x], action: prompt, tool_name: p}]\n",
+		"resource no uri":   "agents:\n  - id: \"1\"\n    name: a\n    mcp_resources: [{server: docs}]\n",
+		"bad tool policy":   "agents:\n  - id: \"1\"\n    name: a\n    tool_policies: [{tool: light_off, policy: ask}]\n",
+		"bad audio gain":    "agents:\n  - id: \"1\"\n    name: a\n    audio_frontend: {enabled: true, agc: {max_gain_db: 90}}\n",
+		"bad device audio":  "agents:\n  - {id: \"1\", name: a}\ndevices:\n  - {id: d, agent: \"1\", audio_frontend: {agc: {max_gain_db: 90}}}\n",
+		"bad asr speed":     "agents:\n  - id: \"1\"\n    name: a\n    asr_speed: slow\n",
+	}
+	for name, content := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, dir, "config.yaml", content)
+			if _, err := New(Options{Dir: dir}); err == nil {
+				t.Fatal("expected validation error")
+			}
+		})
+	}
+
+	dir := t.TempDir()
+	writeFile(t, dir, "a.yaml", "prompts: {p: one}\n")
+	writeFile(t, dir, "b.json", `{"prompts": {"p": "two"}}`)
+	if _, err := New(Options{Dir: dir}); err == nil || !strings.Contains(err.Error(), "prompts.p") {
+		t.Fatalf("expected duplicate definition error, got %v", err)
+	}
+}
+
+func TestReloadKeepsSnapshotOnInvalidConfig(t *testing.T) {
+	p, dir := newTestProvider(t, false)
+
+	writeFile(t, dir, "10-agents.yml", strings.Replace(testAgents, "prompt_ref: xiaozhi", "prompt_ref: missing", 1))
+	if err := p.Reload(); err == nil {
+		t.Fatal("expected reload to fail")
+	}
+	cfg, err := p.GetUserConfig(context.Background(), "aa:bb")
+	if err != nil || cfg.SystemPrompt != "你是小智" {
+		t.Fatalf("expected previous snapshot to be kept, got %q err=%v", cfg.SystemPrompt, err)
+	}
+
+	writeFile(t, dir, "10-agents.yml", strings.Replace(testAgents, "name: 小智", "name: 小智同学", 1))
+	if err := p.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if cfg, _ := p.GetUserConfig(context.Background(), "aa:bb"); cfg.AgentName != "小智同学" {
+		t.Fatalf("expected new snapshot, got %q", cfg.AgentName)
+	}
+}
+
+func TestWatchReloadsOnChange(t *testing.T) {
+	p, dir := newTestProvider(t, false)
+	if err := p.Watch(); err != nil {
+		t.Skipf("fsnotify unavailable: %v", err)
+	}
+
+	writeFile(t, dir, "20-devices.yaml", "devices:\n  - {id: \"cc:dd\", agent: \"2\"}\n")
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if cfg, err := p.GetUserConfig(context.Background(), "cc:dd"); err == nil {
+			if cfg.AgentId != "2" {
+				t.Fatalf("unexpected agent %s", cfg.AgentId)
+			}
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("expected new device after file change")
+}
+
+func TestActivationState(t *testing.T) {
+	ctx := context.Background()
+	p, _ := newTestProvider(t, true)
+
+	if ok, _ := p.IsDeviceActivated(ctx, "aa:bb", ""); !ok {
+		t.Fatal("expected declared device to be activated")
+	}
+	if ok, _ := p.IsDeviceActivated(ctx, "ee:ff", ""); ok {
+		t.Fatal("expected undeclared device to need activation")
+	}
+
+	code, challenge, msg, timeout := p.GetActivationInfo(ctx, "ee:ff", "")
+	if len(code) != 6 || challenge == "" || !strings.Contains(msg, code) || timeout != 300 {
+		t.Fatalf("unexpected activation info: %s %s %q %d", code, challenge, msg, timeout)
+	}
+	if code2, challenge2, _, _ := p.GetActivationInfo(ctx, "ee:ff", ""); code2 != code || challenge2 != challenge {
+		t.Fatal("expected pending activation to be reused")
+	}
+
+	if ok, _ := p.VerifyChallenge(ctx, "ee:ff", "", types.ActivationPayload{Challenge: "wrong"}); ok {
+		t.Fatal("expected wrong challenge to fail")
+	}
+	if ok, err := p.VerifyChallenge(ctx, "ee:ff", "", types.ActivationPayload{Challenge: challenge}); !ok || err != nil {
+		t.Fatalf("expected activation, err=%v", err)
+	}
+
+	// 激活状态持久化，重新打开后仍有效，并使用 default_agent
+	reopened, err := New(Options{Dir: p.dir, StateFile: p.store.path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := reopened.IsDeviceActivated(ctx, "ee:ff", ""); !ok {
+		t.Fatal("expected activation to survive restart")
+	}
+	if cfg, err := reopened.GetUserConfig(ctx, "ee:ff"); err != nil || cfg.AgentId != "1" {
+		t.Fatalf("expected default agent, got %+v err=%v", cfg.AgentId, err)
+	}
+}
+
+func TestActivationRequiresDeclarationWithoutAutoActivate(t *testing.T) {
+	ctx := context.Background()
+	p, _ := newTestProvider(t, false)
+
+	_, challenge, _, _ := p.GetActivationInfo(ctx, "ee:ff", "")
+	if ok, _ := p.VerifyChallenge(ctx, "ee:ff", "", types.ActivationPayload{Challenge: challenge}); ok {
+		t.Fatal("expected undeclared device not to be activated")
+	}
+}
+
+func TestSwitchRoleAndAgentLookup(t *testing.T) {
+	ctx := context.Background()
+	p, _ := newTestProvider(t, false)
+
+	name, err := p.SwitchDeviceRoleByName(ctx, "aa:bb", "英语")
+	if err != nil || name != "英语老师" {
+		t.Fatalf("SwitchDeviceRoleByName: %q %v", name, err)
+	}
+	cfg, _ := p.GetUserConfig(ctx, "aa:bb")
+	if cfg.SystemPrompt != "You are an English teacher" || cfg.Llm.Config["model_name"] != "deepseek-chat" {
+		t.Fatalf("expected role override, got %q %+v", cfg.SystemPrompt, cfg.Llm)
+	}
+	if err := p.RestoreDeviceDefaultRole(ctx, "aa:bb"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, _ := p.GetUserConfig(ctx, "aa:bb"); cfg.SystemPrompt != "你是小智" {
+		t.Fatalf("expected default prompt after restore, got %q", cfg.SystemPrompt)
+	}
+
+	agent, err := p.GetAgentConfig(ctx, "aa:bb", "家居")
+	if err != nil || agent.AgentId != "2" || agent.MemoryMode != "none" {
+		t.Fatalf("expected same-owner agent 2, got %+v err=%v", agent.AgentId, err)
+	}
+	if _, err := p.GetAgentConfig(ctx, "aa:bb", "家居助理"); err == nil {
+		t.Fatal("expected agents of other owners to be invisible")
+	}
+}
@@ -0,0 +1,350 @@
+package file_config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"xiaozhi-esp32-server-golang/internal/domain/audio/dsp"
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+)
+
+// Document 声明式配置文件的结构，目录下的多个 YAML/JSON 文件按文件名顺序合并为一个 Document。
+// 解析时禁止未知字段，字段拼写错误会直接报错而不是被静默忽略。
+type Document struct {
+	// System 系统配置（mqtt, mqtt_server, udp, ota, vision 等），通过 GetSystemConfig 合并到 viper
+	System map[string]interface{} `json:"system"`
+	// DefaultAgent 未在 devices 中声明的设备（自动激活后）使用的智能体 ID
+	DefaultAgent string `json:"default_agent"`
+
+	Providers      ProviderSets             `json:"providers"`
+	Prompts        map[string]string        `json:"prompts"`
+	KnowledgeBases []types.KnowledgeBaseRef `json:"knowledge_bases"`
+	Roles          []RoleSpec               `json:"roles"`
+	Agents         []AgentSpec              `json:"agents"`
+	Devices        []DeviceSpec             `json:"devices"`
+}
+
+// ProviderSets 按类型命名的服务提供者配置，智能体通过名称引用
+type ProviderSets struct {
+	Asr    map[string]ProviderSpec `json:"asr"`
+	Tts    map[string]ProviderSpec `json:"tts"`
+	Llm    map[string]ProviderSpec `json:"llm"`
+	Vad    map[string]ProviderSpec `json:"vad"`
+	Memory map[string]ProviderSpec `json:"memory"`
+}
+
+type ProviderSpec struct {
+	Provider string                 `json:"provider"`
+	Config   map[string]interface{} `json:"config"`
+	// Default 智能体未指定该类型时使用；只有一个配置时自动作为默认
+	Default bool `json:"default"`
+}
+
+// AgentSpec 智能体：提示词、各服务提供者引用、MCP 服务、知识库与意图规则
+type AgentSpec struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Owner 所属用户，同一 owner 下的智能体之间可以转接
+	Owner     string `json:"owner"`
+	Prompt    string `json:"prompt"`
+	PromptRef string `json:"prompt_ref"` // 引用 prompts 中的提示词，与 prompt 二选一
+
+	Asr    string `json:"asr"`
+	Tts    string `json:"tts"`
+	Llm    string `json:"llm"`
+	Vad    string `json:"vad"`
+	Memory string `json:"memory"`
+
+	MemoryMode     string                 `json:"memory_mode"`     // none / short / long，默认 short
+	AsrSpeed       string                 `json:"asr_speed"`       // normal / patient / fast，默认 normal
+	MCPServices    []string               `json:"mcp_services"`    // 为空表示使用全部已启用的全局 MCP 服务
+	KnowledgeBases []string               `json:"knowledge_bases"` // 引用 knowledge_bases 中的名称
+	OpenClaw       *OpenClawSpec          `json:"openclaw"`
+	IntentRules    []types.IntentRule     `json:"intent_rules"`
+	MCPResources   []types.MCPResourceRef `json:"mcp_resources"`  // 固定为上下文的 MCP 资源
+	ToolPolicies   []types.ToolPolicy     `json:"tool_policies"`  // 工具调用策略 allow / confirm / deny
+	AudioFrontend  map[string]interface{} `json:"audio_frontend"` // 上行音频前端处理覆盖项
+}
+
+type OpenClawSpec struct {
+	Allowed       bool     `json:"allowed"`
+	EnterKeywords []string `json:"enter_keywords"`
+	ExitKeywords  []string `json:"exit_keywords"`
+}
+
+// RoleSpec 角色：设备可通过语音按名称切换，覆盖智能体的提示词与 LLM/TTS
+type RoleSpec struct {
+	Name      string `json:"name"`
+	Prompt    string `json:"prompt"`
+	PromptRef string `json:"prompt_ref"`
+	Llm       string `json:"llm"`
+	Tts       string `json:"tts"`
+}
+
+// DeviceSpec 设备与智能体的绑定，声明即视为已激活
+type DeviceSpec struct {
+	ID            string                 `json:"id"`
+	Agent         string                 `json:"agent"`
+	AudioFrontend map[string]interface{} `json:"audio_frontend"` // 设备级音频前端覆盖项，逐项覆盖智能体配置
+}
+
+var (
+	validMemoryModes  = map[string]bool{"": true, "none": true, "short": true, "long": true}
+	validAsrSpeeds    = map[string]bool{"": true, "normal": true, "patient": true, "fast": true}
+	validMatchTypes   = map[string]bool{"keyword": true, "regex": true, "embedding": true}
+	validIntentAction = map[string]bool{"tool": true, "reply": true, "agent": true, "mode": true, "llm": true, "prompt": true}
+	validToolPolicy   = map[string]bool{"allow": true, "confirm": true, "deny": true}
+)
+
+// validationErrors 收集所有校验错误，一次性返回便于修正
+type validationErrors []string
+
+func (v *validationErrors) add(format string, args ...interface{}) {
+	*v = append(*v, fmt.Sprintf(format, args...))
+}
+
+func (v validationErrors) err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return fmt.Errorf("配置校验失败:\n  %s", strings.Join(v, "\n  "))
+}
+
+// Validate 校验引用完整性、唯一性与枚举取值
+func (d *Document) Validate() error {
+	var errs validationErrors
+
+	for kind, set := range d.Providers.sets() {
+		defaults := 0
+		for name, spec := range set {
+			if strings.TrimSpace(spec.Provider) == "" {
+				errs.add("providers.%s.%s: provider 不能为空", kind, name)
+			}
+			if spec.Default {
+				defaults++
+			}
+		}
+		if defaults > 1 {
+			errs.add("providers.%s: 只能有一个 default 配置", kind)
+		}
+	}
+
+	kbNames := make(map[string]bool)
+	for i, kb := range d.KnowledgeBases {
+		name := strings.TrimSpace(kb.Name)
+		switch {
+		case name == "":
+			errs.add("knowledge_bases[%d]: name 不能为空", i)
+		case kbNames[name]:
+			errs.add("knowledge_bases[%d]: 名称 %s 重复", i, name)
+		}
+		kbNames[name] = true
+		if strings.TrimSpace(kb.ExternalKBID) == "" {
+			errs.add("knowledge_bases[%d] %s: external_kb_id 不能为空", i, name)
+		}
+	}
+
+	roleNames := make(map[string]bool)
+	for i, role := range d.Roles {
+		name := strings.TrimSpace(role.Name)
+		switch {
+		case name == "":
+			errs.add("roles[%d]: name 不能为空", i)
+		case roleNames[name]:
+			errs.add("roles[%d]: 名称 %s 重复", i, name)
+		}
+		roleNames[name] = true
+		d.checkPrompt(&errs, fmt.Sprintf("roles[%d] %s", i, name), role.Prompt, role.PromptRef)
+		d.checkProviderRef(&errs, fmt.Sprintf("roles[%d] %s", i, name), "llm", role.Llm)
+		d.checkProviderRef(&errs, fmt.Sprintf("roles[%d] %s", i, name), "tts", role.Tts)
+	}
+
+	agentIDs := make(map[string]bool)
+	for i, agent := range d.Agents {
+		id := strings.TrimSpace(agent.ID)
+		where := fmt.Sprintf("agents[%d] %s", i, id)
+		switch {
+		case id == "":
+			errs.add("agents[%d]: id 不能为空", i)
+		case agentIDs[id]:
+			errs.add("agents[%d]: id %s 重复", i, id)
+		}
+		agentIDs[id] = true
+		if strings.TrimSpace(agent.Name) == "" {
+			errs.add("%s: name 不能为空", where)
+		}
+		d.checkPrompt(&errs, where, agent.Prompt, agent.PromptRef)
+		d.checkProviderRef(&errs, where, "asr", agent.Asr)
+		d.checkProviderRef(&errs, where, "tts", agent.Tts)
+		d.checkProviderRef(&errs, where, "llm", agent.Llm)
+		d.checkProviderRef(&errs, where, "vad", agent.Vad)
+		d.checkProviderRef(&errs, where, "memory", agent.Memory)
+		if !validMemoryModes[agent.MemoryMode] {
+			errs.add("%s: memory_mode 无效: %s", where, agent.MemoryMode)
+		}
+		if !validAsrSpeeds[agent.AsrSpeed] {
+			errs.add("%s: asr_speed 无效: %s", where, agent.AsrSpeed)
+		}
+		for _, kb := range agent.KnowledgeBases {
+			if !kbNames[kb] {
+				errs.add("%s: 引用的知识库 %s 不存在", where, kb)
+			}
+		}
+		for j, rule := range agent.IntentRules {
+			validateIntentRule(&errs, fmt.Sprintf("%s intent_rules[%d]", where, j), rule)
+		}
+		for j, res := range agent.MCPResources {
+			if strings.TrimSpace(res.Server) == "" || strings.TrimSpace(res.URI) == "" {
+				errs.add("%s mcp_resources[%d]: server 与 uri 不能为空", where, j)
+			}
+		}
+		for j, policy := range agent.ToolPolicies {
+			if strings.TrimSpace(policy.Tool) == "" {
+				errs.add("%s tool_policies[%d]: tool 不能为空", where, j)
+			} else if _, err := path.Match(policy.Tool, ""); err != nil {
+				errs.add("%s tool_policies[%d]: tool 通配格式错误: %s", where, j, policy.Tool)
+			}
+			if !validToolPolicy[policy.Policy] {
+				errs.add("%s tool_policies[%d]: policy 无效: %s", where, j, policy.Policy)
+			}
+		}
+		if err := dsp.ValidateMap(agent.AudioFrontend); err != nil {
+			errs.add("%s audio_frontend: %v", where, err)
+		}
+	}
+
+	if d.DefaultAgent != "" && !agentIDs[d.DefaultAgent] {
+		errs.add("default_agent: 智能体 %s 不存在", d.DefaultAgent)
+	}
+
+	deviceIDs := make(map[string]bool)
+	for i, device := range d.Devices {
+		id := strings.TrimSpace(device.ID)
+		switch {
+		case id == "":
+			errs.add("devices[%d]: id 不能为空", i)
+		case deviceIDs[id]:
+			errs.add("devices[%d]: id %s 重复", i, id)
+		}
+		deviceIDs[id] = true
+		if !agentIDs[device.Agent] {
+			errs.add("devices[%d] %s: 绑定的智能体 %s 不存在", i, id, device.Agent)
+		}
+		if err := dsp.ValidateMap(device.AudioFrontend); err != nil {
+			errs.add("devices[%d] %s audio_frontend: %v", i, id, err)
+		}
+	}
+
+	return errs.err()
+}
+
+func (d *Document) checkPrompt(errs *validationErrors, where, prompt, ref string) {
+	if ref == "" {
+		return
+	}
+	if prompt != "" {
+		errs.add("%s: prompt 与 prompt_ref 只能二选一", where)
+	}
+	if _, ok := d.Prompts[ref]; !ok {
+		errs.add("%s: 引用的提示词 %s 不存在", where, ref)
+	}
+}
+
+func (d *Document) checkProviderRef(errs *validationErrors, where, kind, ref string) {
+	if ref == "" {
+		return
+	}
+	if _, ok := d.Providers.sets()[kind][ref]; !ok {
+		errs.add("%s: 引用的 %s 配置 %s 不存在", where, kind, ref)
+	}
+}
+
+func validateIntentRule(errs *validationErrors, where string, rule types.IntentRule) {
+	if strings.TrimSpace(rule.Name) == "" {
+		errs.add("%s: name 不能为空", where)
+	}
+	if !validMatchTypes[rule.MatchType] {
+		errs.add("%s: match_type 无效: %s", where, rule.MatchType)
+	}
+	if !validIntentAction[rule.Action] {
+		errs.add("%s: action 无效: %s", where, rule.Action)
+	}
+	if len(rule.Patterns) == 0 {
+		errs.add("%s: patterns 不能为空", where)
+	}
+	if rule.MatchType == "regex" {
+		for _, p := range rule.Patterns {
+			if _, err := regexp.Compile(p); err != nil {
+				errs.add("%s: 正则 %q 无效: %v", where, p, err)
+			}
+		}
+	}
+	if rule.Action == "tool" && strings.TrimSpace(rule.ToolName) == "" {
+		errs.add("%s: tool 动作需要 tool_name", where)
+	}
+	if rule.Action == "prompt" && (strings.TrimSpace(rule.ToolName) == "" || strings.TrimSpace(rule.Target) == "") {
+		errs.add("%s: prompt 动作需要 tool_name（提示词名）与 target（MCP 服务名）", where)
+	}
+}
+
+func (p ProviderSets) sets() map[string]map[string]ProviderSpec {
+	return map[string]map[string]ProviderSpec{
+		"asr":    p.Asr,
+		"tts":    p.Tts,
+		"llm":    p.Llm,
+		"vad":    p.Vad,
+		"memory": p.Memory,
+	}
+}
+
+// merge 将 other 合并到 d：列表追加，命名集合出现重复名称时报错
+func (d *Document) merge(other *Document, source string) error {
+	for k, v := range other.System {
+		if d.System == nil {
+			d.System = make(map[string]interface{})
+		}
+		if _, ok := d.System[k]; ok {
+			return fmt.Errorf("%s: system.%s 重复定义", source, k)
+		}
+		d.System[k] = v
+	}
+	if other.DefaultAgent != "" {
+		if d.DefaultAgent != "" && d.DefaultAgent != other.DefaultAgent {
+			return fmt.Errorf("%s: default_agent 重复定义", source)
+		}
+		d.DefaultAgent = other.DefaultAgent
+	}
+
+	dst := []*map[string]ProviderSpec{&d.Providers.Asr, &d.Providers.Tts, &d.Providers.Llm, &d.Providers.Vad, &d.Providers.Memory}
+	src := []map[string]ProviderSpec{other.Providers.Asr, other.Providers.Tts, other.Providers.Llm, other.Providers.Vad, other.Providers.Memory}
+	kinds := []string{"asr", "tts", "llm", "vad", "memory"}
+	for i := range dst {
+		for name, spec := range src[i] {
+			if *dst[i] == nil {
+				*dst[i] = make(map[string]ProviderSpec)
+			}
+			if _, ok := (*dst[i])[name]; ok {
+				return fmt.Errorf("%s: providers.%s.%s 重复定义", source, kinds[i], name)
+			}
+			(*dst[i])[name] = spec
+		}
+	}
+
+	for name, prompt := range other.Prompts {
+		if d.Prompts == nil {
+			d.Prompts = make(map[string]string)
+		}
+		if _, ok := d.Prompts[name]; ok {
+			return fmt.Errorf("%s: prompts.%s 重复定义", source, name)
+		}
+		d.Prompts[name] = prompt
+	}
+
+	d.KnowledgeBases = append(d.KnowledgeBases, other.KnowledgeBases...)
+	d.Roles = append(d.Roles, other.Roles...)
+	d.Agents = append(d.Agents, other.Agents...)
+	d.Devices = append(d.Devices, other.Devices...)
+	return nil
+}
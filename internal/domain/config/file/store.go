@@ -0,0 +1,135 @@
+package file_config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// stateStore 本地状态存储：设备激活、待激活的验证码/challenge、设备角色覆盖。
+// 这些状态由运行时产生，不适合写回声明式配置文件，持久化到单个 JSON 文件（写临时文件后 rename 保证原子性）。
+type stateStore struct {
+	mu   sync.Mutex
+	path string
+	data stateData
+}
+
+type stateData struct {
+	Activated map[string]time.Time        `json:"activated"`
+	Pending   map[string]pendingChallenge `json:"pending"`
+	Roles     map[string]string           `json:"roles"` // 设备 ID -> 角色名
+}
+
+type pendingChallenge struct {
+	Code      string    `json:"code"`
+	Challenge string    `json:"challenge"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// openStateStore 打开状态文件，path 为空时仅保存在内存中
+func openStateStore(path string) (*stateStore, error) {
+	s := &stateStore{path: path}
+	s.data.init()
+	if path == "" {
+		return s, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("读取状态文件 %s 失败: %w", path, err)
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &s.data); err != nil {
+			return nil, fmt.Errorf("解析状态文件 %s 失败: %w", path, err)
+		}
+		s.data.init()
+	}
+	return s, nil
+}
+
+func (d *stateData) init() {
+	if d.Activated == nil {
+		d.Activated = make(map[string]time.Time)
+	}
+	if d.Pending == nil {
+		d.Pending = make(map[string]pendingChallenge)
+	}
+	if d.Roles == nil {
+		d.Roles = make(map[string]string)
+	}
+}
+
+func (s *stateStore) isActivated(deviceID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.data.Activated[deviceID]
+	return ok
+}
+
+// pending 返回设备未过期的待激活信息，不存在时用 create 生成并保存
+func (s *stateStore) pending(deviceID string, ttl time.Duration, create func() pendingChallenge) (pendingChallenge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.data.Pending[deviceID]; ok && time.Since(p.CreatedAt) < ttl {
+		return p, nil
+	}
+	p := create()
+	s.data.Pending[deviceID] = p
+	return p, s.saveLocked()
+}
+
+// activate 校验 challenge 并标记设备已激活；allow 为 false 时只校验不激活
+func (s *stateStore) activate(deviceID string, challenge string, allow bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.data.Pending[deviceID]
+	if !ok || p.Challenge == "" || p.Challenge != challenge || !allow {
+		return false, nil
+	}
+	s.data.Activated[deviceID] = time.Now()
+	delete(s.data.Pending, deviceID)
+	return true, s.saveLocked()
+}
+
+func (s *stateStore) role(deviceID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Roles[deviceID]
+}
+
+func (s *stateStore) setRole(deviceID string, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if role == "" {
+		delete(s.data.Roles, deviceID)
+	} else {
+		s.data.Roles[deviceID] = role
+	}
+	return s.saveLocked()
+}
+
+func (s *stateStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	raw, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("创建状态目录失败: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return fmt.Errorf("写入状态文件失败: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("替换状态文件失败: %w", err)
+	}
+	return nil
+}
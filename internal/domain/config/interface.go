@@ -25,6 +25,9 @@ type UserConfigProvider interface {
 	// RestoreDeviceDefaultRole 恢复设备默认角色（清空设备绑定角色）
 	RestoreDeviceDefaultRole(ctx context.Context, deviceID string) error
 
+	// GetAgentConfig 按智能体名称（支持模糊匹配）获取设备所属用户下指定智能体的配置，用于多智能体转接
+	GetAgentConfig(ctx context.Context, deviceID string, agentName string) (types.UConfig, error)
+
 	// 获取 mqtt, mqtt_server, udp, ota, vision配置
 	GetSystemConfig(ctx context.Context) (string, error)
 
@@ -0,0 +1,97 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+
+	"xiaozhi-esp32-server-golang/internal/domain/llm"
+	"xiaozhi-esp32-server-golang/internal/pool"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const (
+	defaultAgentAskTimeoutMs = 60 * 1000
+	maxAgentAskTimeoutMs     = 5 * 60 * 1000
+)
+
+// handleAgentAskRequest 以智能体的 LLM 配置和提示词回答一段文本（manager 对外 MCP 服务的 ask_agent 工具）
+// 请求体：agent_id、llm{config_id, config}、system_prompt、message、timeout_ms
+func (c *WebSocketClient) handleAgentAskRequest(request *WebSocketRequest) {
+	agentID, _ := request.Body["agent_id"].(string)
+	message, _ := request.Body["message"].(string)
+	systemPrompt, _ := request.Body["system_prompt"].(string)
+	llmBody, _ := request.Body["llm"].(map[string]interface{})
+	configID, _ := llmBody["config_id"].(string)
+	llmConfig, _ := llmBody["config"].(map[string]interface{})
+
+	message = strings.TrimSpace(message)
+	if message == "" {
+		_ = c.SendResponse(request.ID, 400, nil, "缺少 message")
+		return
+	}
+	if configID == "" || llmConfig == nil {
+		_ = c.SendResponse(request.ID, 400, nil, "缺少智能体的 LLM 配置")
+		return
+	}
+
+	timeoutMs := defaultAgentAskTimeoutMs
+	if v, ok := request.Body["timeout_ms"].(float64); ok && v > 0 {
+		timeoutMs = int(v)
+	}
+	if timeoutMs > maxAgentAskTimeoutMs {
+		timeoutMs = maxAgentAskTimeoutMs
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutMs)*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	content, err := askAgentLLM(ctx, agentID, configID, llmConfig, systemPrompt, message)
+	if err != nil {
+		log.Warnf("智能体 %s 回答失败: %v", agentID, err)
+		_ = c.SendResponse(request.ID, 500, nil, err.Error())
+		return
+	}
+	_ = c.SendResponse(request.ID, 200, map[string]interface{}{
+		"agent_id":   agentID,
+		"content":    content,
+		"elapsed_ms": time.Since(start).Milliseconds(),
+	}, "")
+}
+
+func askAgentLLM(ctx context.Context, agentID, configID string, llmConfig map[string]interface{}, systemPrompt, message string) (string, error) {
+	wrapper, err := pool.Acquire[llm.LLMProvider]("llm", configID, llmConfig)
+	if err != nil {
+		return "", fmt.Errorf("获取LLM失败: %w", err)
+	}
+	defer pool.Release(wrapper)
+
+	dialogue := make([]*schema.Message, 0, 2)
+	if strings.TrimSpace(systemPrompt) != "" {
+		dialogue = append(dialogue, schema.SystemMessage(systemPrompt))
+	}
+	dialogue = append(dialogue, schema.UserMessage(message))
+	msgChan := wrapper.GetProvider().ResponseWithContext(ctx, "agent_ask:"+agentID, dialogue, nil)
+
+	var builder strings.Builder
+	for {
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("LLM响应超时")
+		case msg, ok := <-msgChan:
+			if !ok {
+				return strings.TrimSpace(builder.String()), nil
+			}
+			if msg == nil {
+				continue
+			}
+			if llm.IsLLMErrorMessage(msg) {
+				return "", fmt.Errorf("LLM返回错误: %s", llm.LLMErrorMessage(msg))
+			}
+			builder.WriteString(msg.Content)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package manager
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+)
+
+// experimentProviderConfig 实验分组覆盖的服务配置，结构与 /api/configs 中的 llm/tts 一致
+type experimentProviderConfig struct {
+	Provider string `json:"provider"`
+	JsonData string `json:"json_data"`
+}
+
+// experimentVariant 实验分组，未设置的字段沿用智能体配置
+type experimentVariant struct {
+	Key    string                    `json:"key"`
+	Name   string                    `json:"name"`
+	Weight int                       `json:"weight"`
+	Prompt *string                   `json:"prompt"`
+	LLM    *experimentProviderConfig `json:"llm"`
+	TTS    *experimentProviderConfig `json:"tts"`
+}
+
+// experimentConfig 智能体正在运行的实验
+type experimentConfig struct {
+	ID       uint                `json:"id"`
+	Name     string              `json:"name"`
+	Variants []experimentVariant `json:"variants"`
+}
+
+// pickExperimentVariant 按设备哈希在各分组间按权重分流，同一设备在同一实验中始终落在同一分组
+func pickExperimentVariant(deviceID string, exp *experimentConfig) *experimentVariant {
+	if exp == nil || deviceID == "" {
+		return nil
+	}
+	total := 0
+	for _, v := range exp.Variants {
+		if v.Weight > 0 {
+			total += v.Weight
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+
+	h := fnv.New32a()
+	// 混入实验 ID，避免不同实验的分组完全相关
+	fmt.Fprintf(h, "%d:%s", exp.ID, deviceID)
+	bucket := int(h.Sum32() % uint32(total))
+	for i := range exp.Variants {
+		v := &exp.Variants[i]
+		if v.Weight <= 0 {
+			continue
+		}
+		if bucket < v.Weight {
+			return v
+		}
+		bucket -= v.Weight
+	}
+	return nil
+}
+
+// applyExperiment 解析设备命中的分组并覆盖配置，同时在配置上标记实验与分组
+func applyExperiment(config *types.UConfig, deviceID string, exp *experimentConfig, parseJsonData func(string) map[string]interface{}) {
+	variant := pickExperimentVariant(deviceID, exp)
+	if variant == nil {
+		return
+	}
+	if variant.Prompt != nil {
+		config.SystemPrompt = *variant.Prompt
+	}
+	if variant.LLM != nil && variant.LLM.Provider != "" {
+		config.Llm = types.LlmConfig{
+			Provider: variant.LLM.Provider,
+			Config:   parseJsonData(variant.LLM.JsonData),
+		}
+	}
+	if variant.TTS != nil && variant.TTS.Provider != "" {
+		config.Tts = types.TtsConfig{
+			Provider: variant.TTS.Provider,
+			Config:   parseJsonData(variant.TTS.JsonData),
+		}
+	}
+	config.Experiment = &types.ExperimentAssignment{
+		ID:      exp.ID,
+		Name:    exp.Name,
+		Variant: variant.Key,
+	}
+}
@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"fmt"
+	"testing"
+
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+)
+
+func TestPickExperimentVariant(t *testing.T) {
+	exp := &experimentConfig{
+		ID: 7,
+		Variants: []experimentVariant{
+			{Key: "A", Weight: 50},
+			{Key: "B", Weight: 50},
+			{Key: "off", Weight: 0},
+		},
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		deviceID := fmt.Sprintf("aa:bb:cc:00:%02x:%02x", i/256, i%256)
+		v := pickExperimentVariant(deviceID, exp)
+		if v == nil {
+			t.Fatalf("device %s not assigned", deviceID)
+		}
+		if again := pickExperimentVariant(deviceID, exp); again.Key != v.Key {
+			t.Fatalf("device %s assignment not stable: %s vs %s", deviceID, v.Key, again.Key)
+		}
+		counts[v.Key]++
+	}
+	if counts["off"] != 0 {
+		t.Fatalf("zero-weight variant should never be picked, got %d", counts["off"])
+	}
+	if counts["A"] < 800 || counts["B"] < 800 {
+		t.Fatalf("traffic split too uneven: %v", counts)
+	}
+
+	if pickExperimentVariant("", exp) != nil {
+		t.Fatal("empty device id should not be assigned")
+	}
+	if pickExperimentVariant("d", &experimentConfig{ID: 1}) != nil {
+		t.Fatal("experiment without variants should not assign")
+	}
+}
+
+func TestApplyExperiment(t *testing.T) {
+	prompt := "variant prompt"
+	exp := &experimentConfig{
+		ID:   3,
+		Name: "prompt test",
+		Variants: []experimentVariant{
+			{Key: "B", Weight: 1, Prompt: &prompt, LLM: &experimentProviderConfig{Provider: "openai", JsonData: `{"model":"m2"}`}},
+		},
+	}
+	config := types.UConfig{
+		SystemPrompt: "base",
+		Llm:          types.LlmConfig{Provider: "ollama"},
+		Tts:          types.TtsConfig{Provider: "edge"},
+	}
+	parse := func(s string) map[string]interface{} {
+		return map[string]interface{}{"raw": s}
+	}
+
+	applyExperiment(&config, "device-1", exp, parse)
+
+	if config.SystemPrompt != prompt || config.Llm.Provider != "openai" || config.Llm.Config["raw"] != `{"model":"m2"}` {
+		t.Fatalf("overrides not applied: %+v", config)
+	}
+	if config.Tts.Provider != "edge" {
+		t.Fatalf("tts should keep agent config, got %s", config.Tts.Provider)
+	}
+	if config.Experiment == nil || config.Experiment.ID != 3 || config.Experiment.Variant != "B" {
+		t.Fatalf("experiment tag missing: %+v", config.Experiment)
+	}
+}
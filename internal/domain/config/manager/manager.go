@@ -61,6 +61,30 @@ func NewManagerUserConfigProvider(config map[string]interface{}) (*ConfigManager
 }
 
 func (c *ConfigManager) GetUserConfig(ctx context.Context, deviceID string) (types.UConfig, error) {
+	return c.fetchConfig(ctx, map[string]string{
+		"device_id": deviceID,
+	})
+}
+
+// GetAgentConfig 按智能体名称（支持模糊匹配）获取设备所属用户下指定智能体的配置
+func (c *ConfigManager) GetAgentConfig(ctx context.Context, deviceID string, agentName string) (types.UConfig, error) {
+	deviceID = strings.TrimSpace(deviceID)
+	agentName = strings.TrimSpace(agentName)
+	if deviceID == "" {
+		return types.UConfig{}, fmt.Errorf("deviceID 不能为空")
+	}
+	if agentName == "" {
+		return types.UConfig{}, fmt.Errorf("agentName 不能为空")
+	}
+	return c.fetchConfig(ctx, map[string]string{
+		"device_id":  deviceID,
+		"agent_name": agentName,
+	})
+}
+
+// fetchConfig 调用 /api/configs 并转换为 UConfig
+func (c *ConfigManager) fetchConfig(ctx context.Context, queryParams map[string]string) (types.UConfig, error) {
+	deviceID := queryParams["device_id"]
 	// 解析响应
 	var response struct {
 		Data struct {
@@ -95,31 +119,42 @@ func (c *ConfigManager) GetUserConfig(ctx context.Context, deviceID string) (typ
 				VoiceModelOverride *string  `json:"voice_model_override"`
 			} `json:"voice_identify"`
 			KnowledgeBases  []types.KnowledgeBaseRef `json:"knowledge_bases"`
+			IntentRules     []types.IntentRule       `json:"intent_rules"`
+			MCPResources    []types.MCPResourceRef   `json:"mcp_resources"`
+			ToolPolicies    []types.ToolPolicy       `json:"tool_policies"`
+			AudioFrontend   map[string]interface{}   `json:"audio_frontend"`
 			Prompt          string                   `json:"prompt"`
 			AgentId         string                   `json:"agent_id"`
+			AgentName       string                   `json:"agent_name"`
 			MemoryMode      string                   `json:"memory_mode"`
+			AsrSpeed        string                   `json:"asr_speed"`
 			MCPServiceNames string                   `json:"mcp_service_names"`
 			OpenClaw        struct {
 				Allowed       bool     `json:"allowed"`
 				EnterKeywords []string `json:"enter_keywords"`
 				ExitKeywords  []string `json:"exit_keywords"`
 			} `json:"openclaw"`
+			Experiment     *experimentConfig `json:"experiment"`
+			PromptVars     types.PromptVars  `json:"prompt_vars"`
+			PromptSnippets map[string]string `json:"prompt_snippets"`
 		} `json:"data"`
+		Error string `json:"error"`
 	}
 
 	// 发送HTTP请求
 	err := c.client.DoRequest(ctx, http.RequestOptions{
-		Method: "GET",
-		Path:   "/api/configs",
-		QueryParams: map[string]string{
-			"device_id": deviceID,
-		},
-		Response: &response,
+		Method:      "GET",
+		Path:        "/api/configs",
+		QueryParams: queryParams,
+		Response:    &response,
 	})
 	if err != nil {
-		log.Log().Error("获取用户配置失败", "error", err, "device_id", deviceID)
+		log.Log().Error("获取用户配置失败", "error", err, "device_id", deviceID, "agent_name", queryParams["agent_name"])
 		return types.UConfig{}, err
 	}
+	if response.Error != "" {
+		return types.UConfig{}, fmt.Errorf("获取配置失败: %s", response.Error)
+	}
 
 	// 解析JSON配置数据的辅助函数
 	parseJsonData := func(jsonStr string) map[string]interface{} {
@@ -186,19 +221,30 @@ func (c *ConfigManager) GetUserConfig(ctx context.Context, deviceID string) (typ
 			Config:   parseJsonData(response.Data.Memory.JsonData),
 		},
 		KnowledgeBases:  response.Data.KnowledgeBases,
+		IntentRules:     response.Data.IntentRules,
+		MCPResources:    response.Data.MCPResources,
+		ToolPolicies:    response.Data.ToolPolicies,
+		AudioFrontend:   response.Data.AudioFrontend,
 		VoiceIdentify:   voiceIdentifyData,
 		MemoryMode:      response.Data.MemoryMode,
+		AsrSpeed:        response.Data.AsrSpeed,
 		AgentId:         response.Data.AgentId,
+		AgentName:       response.Data.AgentName,
 		MCPServiceNames: strings.TrimSpace(response.Data.MCPServiceNames),
 		OpenClaw: types.OpenClawConfig{
 			Allowed:       response.Data.OpenClaw.Allowed,
 			EnterKeywords: enterKeywords,
 			ExitKeywords:  exitKeywords,
 		},
+		PromptVars:     response.Data.PromptVars,
+		PromptSnippets: response.Data.PromptSnippets,
 	}
 	if strings.TrimSpace(config.MemoryMode) == "" {
 		config.MemoryMode = "short"
 	}
+	if response.Data.Experiment != nil {
+		applyExperiment(&config, deviceID, response.Data.Experiment, parseJsonData)
+	}
 
 	log.Log().Infof("成功获取设备配置: deviceId: %s, config: %+v", deviceID, config)
 	return config, nil
@@ -727,12 +727,20 @@ func (c *WebSocketClient) handleDefaultRequest(request *WebSocketRequest) {
 		// 处理MCP工具调用请求
 		c.handleMcpToolCallRequest(request)
 
+	case "/api/mcp/resources":
+		// 处理MCP资源与提示词列表请求
+		c.handleMcpCatalogRequest(request)
+
 	case "/api/openclaw/status":
 		c.handleOpenClawStatusRequest(request)
 
 	case "/api/openclaw/chat":
 		c.handleOpenClawChatRequest(request)
 
+	case "/api/agent/ask":
+		// LLM 调用耗时较长，放入独立 goroutine 避免阻塞读循环
+		go c.handleAgentAskRequest(request)
+
 	case "/api/server/info":
 		// 返回服务器信息
 		response := map[string]interface{}{
@@ -1103,6 +1111,25 @@ func (c *WebSocketClient) handleMcpToolListRequest(request *WebSocketRequest) {
 	}
 }
 
+// handleMcpCatalogRequest 处理MCP资源与提示词列表请求：全局服务按 mcp_service_names 过滤，
+// 另含 agent_id/device_id 对应的设备侧 MCP 上报的资源与提示词
+func (c *WebSocketClient) handleMcpCatalogRequest(request *WebSocketRequest) {
+	agentID, _ := request.Body["agent_id"].(string)
+	deviceID, _ := request.Body["device_id"].(string)
+	serviceNames, _ := request.Body["mcp_service_names"].(string)
+
+	resources, prompts := mcp.ListCatalog(deviceID, agentID, serviceNames)
+	response := map[string]interface{}{
+		"agent_id":  agentID,
+		"device_id": deviceID,
+		"resources": resources,
+		"prompts":   prompts,
+	}
+	if err := c.SendResponse(request.ID, 200, response, ""); err != nil {
+		log.Errorf("发送MCP资源列表响应失败: %v", err)
+	}
+}
+
 // 全局便捷方法（异步版本）
 func SendManagerRequestAsync(ctx context.Context, method, path string, body map[string]interface{}) (string, error) {
 	return GetDefaultClient().SendRequestAsync(ctx, method, path, body)
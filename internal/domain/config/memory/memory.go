@@ -137,6 +137,42 @@ func (m *MemoryUserConfigProvider) GetSystemConfig(ctx context.Context) (string,
 	return "", nil
 }
 
+// IsDeviceActivated 内存配置提供者不做设备激活校验
+func (m *MemoryUserConfigProvider) IsDeviceActivated(ctx context.Context, deviceId string, clientId string) (bool, error) {
+	return true, nil
+}
+
+// GetActivationInfo 内存配置提供者无激活流程
+func (m *MemoryUserConfigProvider) GetActivationInfo(ctx context.Context, deviceId string, clientId string) (string, string, string, int) {
+	return "", "", "", 0
+}
+
+// VerifyChallenge 内存配置提供者不做设备激活校验
+func (m *MemoryUserConfigProvider) VerifyChallenge(ctx context.Context, deviceId string, clientId string, activationPayload types.ActivationPayload) (bool, error) {
+	return true, nil
+}
+
+// SwitchDeviceRoleByName 内存模式不支持设备角色切换
+func (m *MemoryUserConfigProvider) SwitchDeviceRoleByName(ctx context.Context, deviceID string, roleName string) (string, error) {
+	return "", fmt.Errorf("memory 配置提供者不支持按角色名切换设备角色")
+}
+
+// RestoreDeviceDefaultRole 内存模式不支持恢复默认角色
+func (m *MemoryUserConfigProvider) RestoreDeviceDefaultRole(ctx context.Context, deviceID string) error {
+	return fmt.Errorf("memory 配置提供者不支持恢复设备默认角色")
+}
+
+// GetAgentConfig 内存模式不支持多智能体转接
+func (m *MemoryUserConfigProvider) GetAgentConfig(ctx context.Context, deviceID string, agentName string) (types.UConfig, error) {
+	return types.UConfig{}, fmt.Errorf("memory 配置提供者不支持按智能体名称获取配置")
+}
+
+func (m *MemoryUserConfigProvider) NotifyDeviceEvent(ctx context.Context, eventType string, eventData map[string]interface{}) {
+}
+
+func (m *MemoryUserConfigProvider) RegisterMessageEventHandler(ctx context.Context, eventType string, eventHandler types.EventHandler) {
+}
+
 // Init 初始化Memory配置提供者
 func Init(ctx context.Context) error {
 	log.Log().Info("Memory config provider initialized successfully")
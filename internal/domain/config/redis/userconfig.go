@@ -212,6 +212,11 @@ func (u *UserConfig) RestoreDeviceDefaultRole(ctx context.Context, deviceID stri
 	return fmt.Errorf("redis 配置提供者不支持恢复设备默认角色")
 }
 
+// GetAgentConfig Redis 模式不支持多智能体转接
+func (u *UserConfig) GetAgentConfig(ctx context.Context, deviceID string, agentName string) (types.UConfig, error) {
+	return types.UConfig{}, fmt.Errorf("redis 配置提供者不支持按智能体名称获取配置")
+}
+
 func (u *UserConfig) NotifyDeviceEvent(ctx context.Context, eventType string, eventData map[string]interface{}) {
 	// 实现设备事件通知逻辑
 	return
@@ -59,6 +59,36 @@ type OpenClawConfig struct {
 	ExitKeywords  []string `json:"exit_keywords"`
 }
 
+// IntentRule 意图路由规则，由管理后台按智能体下发，在 LLM 之前匹配用户原话
+type IntentRule struct {
+	ID        uint     `json:"id"`
+	Name      string   `json:"name"`
+	MatchType string   `json:"match_type"` // keyword / regex / embedding
+	Patterns  []string `json:"patterns"`   // 关键词 / 正则 / 语义示例句
+	Threshold float64  `json:"threshold"`  // 语义相似度阈值，0 表示使用全局默认值
+	Action    string   `json:"action"`     // tool / reply / agent / mode / llm / prompt
+	ToolName  string   `json:"tool_name"`  // tool: 工具名；prompt: MCP 提示词名
+	ToolArgs  string   `json:"tool_args"`  // JSON 对象，支持 {{text}} 与正则命名分组占位符
+	Reply     string   `json:"reply"`
+	Target    string   `json:"target"` // agent: 目标智能体名称；mode: openclaw / normal；prompt: MCP 服务名（device 表示设备侧）
+	Priority  int      `json:"priority"`
+}
+
+// MCPResourceRef 智能体固定为上下文的 MCP 资源，内容注入系统提示词
+type MCPResourceRef struct {
+	Server   string `json:"server"` // 全局 MCP 服务名，device 表示设备/智能体接入的 MCP
+	URI      string `json:"uri"`
+	Name     string `json:"name"`
+	MaxChars int    `json:"max_chars"` // 注入的最大字符数，0 表示使用全局默认值
+}
+
+// ToolPolicy LLM 发起工具调用时的策略，按 tool 匹配工具名（支持 * 通配）
+type ToolPolicy struct {
+	Tool   string `json:"tool"`   // 工具名，例如 light_off、device_*
+	Policy string `json:"policy"` // allow / confirm / deny
+	Prompt string `json:"prompt"` // confirm: 确认提问，留空时自动生成；deny: 告知 LLM 的拒绝原因
+}
+
 type UConfig struct {
 	SystemPrompt    string                      `json:"system_prompt"`
 	Asr             AsrConfig                   `json:"asr"`
@@ -68,10 +98,34 @@ type UConfig struct {
 	Memory          MemoryConfig                `json:"memory"`
 	VoiceIdentify   map[string]SpeakerGroupInfo `json:"voice_identify"`    // 声纹识别配置
 	MemoryMode      string                      `json:"memory_mode"`       // 记忆模式: none/short/long
+	AsrSpeed        string                      `json:"asr_speed"`         // 语音识别速度: normal/patient/fast，缩放语义断句的等待时长
 	AgentId         string                      `json:"agent_id"`          // 所属agent_id
+	AgentName       string                      `json:"agent_name"`        // 智能体名称
 	MCPServiceNames string                      `json:"mcp_service_names"` // 逗号分隔的MCP服务名，空=使用全部已启用全局MCP服务
 	OpenClaw        OpenClawConfig              `json:"openclaw"`          // OpenClaw 配置
 	KnowledgeBases  []KnowledgeBaseRef          `json:"knowledge_bases"`
+	IntentRules     []IntentRule                `json:"intent_rules"`         // 意图路由规则（按优先级排序）
+	MCPResources    []MCPResourceRef            `json:"mcp_resources"`        // 固定为上下文的 MCP 资源
+	ToolPolicies    []ToolPolicy                `json:"tool_policies"`        // 工具调用策略（允许/确认/拒绝）
+	AudioFrontend   map[string]interface{}      `json:"audio_frontend"`       // 上行音频前端处理覆盖项，nil 表示使用全局配置
+	Experiment      *ExperimentAssignment       `json:"experiment,omitempty"` // 命中的 A/B 实验分组，nil 表示未参与实验
+	PromptVars      PromptVars                  `json:"prompt_vars"`          // 提示词模板的设备变量
+	PromptSnippets  map[string]string           `json:"prompt_snippets"`      // 提示词模板可引用的共享片段
+}
+
+// PromptVars 提示词模板的设备变量，由管理后台按设备下发
+type PromptVars struct {
+	DeviceName    string `json:"device_name"`
+	OwnerNickname string `json:"owner_nickname"`
+	Location      string `json:"location"`
+	Timezone      string `json:"timezone"` // IANA 时区，空表示服务器时区
+}
+
+// ExperimentAssignment 设备命中的 A/B 实验分组，获取配置时按设备哈希确定
+type ExperimentAssignment struct {
+	ID      uint   `json:"id"`
+	Name    string `json:"name"`
+	Variant string `json:"variant"`
 }
 
 type TtsConfigItem struct {
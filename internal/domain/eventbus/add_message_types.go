@@ -35,7 +35,8 @@ type AddMessageEvent struct {
 
 	// 元数据（不属于 schema.Message 标准格式）
 	Timestamp   time.Time
-	TTSDuration int // TTS 耗时（毫秒）
+	TTSDuration int                    // TTS 耗时（毫秒）
+	Metadata    map[string]interface{} // 附加元数据，保存时合并到消息 metadata（如工具调用策略审计）
 
 	// 阶段标识
 	IsUpdate bool // true=更新音频，false=新增消息
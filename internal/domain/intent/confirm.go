@@ -0,0 +1,110 @@
+package intent
+
+import (
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+)
+
+// 工具调用策略
+const (
+	ToolPolicyAllow   = "allow"   // 直接执行
+	ToolPolicyConfirm = "confirm" // 先向用户确认，回答“是”后执行
+	ToolPolicyDeny    = "deny"    // 拒绝执行，把原因返回给 LLM
+)
+
+// Confirmation 用户对确认提问的回答
+type Confirmation int
+
+const (
+	ConfirmUnknown Confirmation = iota // 无法判断，视为未确认
+	ConfirmYes
+	ConfirmNo
+)
+
+// maxConfirmationRunes 超过该长度的回答通常是新的请求，不按是/否理解
+const maxConfirmationRunes = 12
+
+var (
+	// 含肯定字但表示拒绝的说法（如“好的不用了”），最先判断
+	confirmNoOverrides = []string{"不用了", "不需要", "不必了", "先不"}
+	// 含否定字但表示同意的说法，优先于否定词判断
+	confirmYesOverrides = []string{"没问题", "没有问题", "没什么问题", "没啥问题", "不错", "没错", "不用问", "不介意"}
+	confirmNoWords      = []string{"不", "别", "取消", "算了", "否", "停", "没有", "拒绝"}
+	confirmYesWords     = []string{"是", "好", "确认", "确定", "可以", "对", "行", "执行", "嗯", "要", "同意", "继续"}
+	confirmNoEnglish    = []string{"no", "nope", "cancel", "stop"}
+	confirmYesEnglish   = []string{"yes", "yeah", "yep", "sure", "ok", "okay", "confirm"}
+)
+
+// MatchToolPolicy 返回匹配工具名的策略：精确匹配优先，其次按配置顺序取第一条通配（path.Match 语法）匹配；
+// 未匹配时返回 false，调用方按 allow 处理
+func MatchToolPolicy(policies []types.ToolPolicy, toolName string) (types.ToolPolicy, bool) {
+	for _, p := range policies {
+		if p.Tool == toolName {
+			return p, true
+		}
+	}
+	for _, p := range policies {
+		if !strings.ContainsAny(p.Tool, "*?[") {
+			continue
+		}
+		if ok, err := path.Match(p.Tool, toolName); err == nil && ok {
+			return p, true
+		}
+	}
+	return types.ToolPolicy{}, false
+}
+
+// ClassifyConfirmation 判断用户对确认提问的回答是同意、拒绝还是无法判断
+func ClassifyConfirmation(text string) Confirmation {
+	normalized := normalizeText(text)
+	if normalized == "" || utf8.RuneCountInString(normalized) > maxConfirmationRunes {
+		return ConfirmUnknown
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) || r > unicode.MaxASCII
+	})
+	if containsWord(words, confirmNoEnglish) {
+		return ConfirmNo
+	}
+	if containsWord(words, confirmYesEnglish) {
+		return ConfirmYes
+	}
+
+	for _, w := range confirmNoOverrides {
+		if strings.Contains(normalized, w) {
+			return ConfirmNo
+		}
+	}
+	for _, w := range confirmYesOverrides {
+		if strings.Contains(normalized, w) {
+			return ConfirmYes
+		}
+	}
+	for _, w := range confirmNoWords {
+		if strings.Contains(normalized, w) {
+			return ConfirmNo
+		}
+	}
+	for _, w := range confirmYesWords {
+		if strings.Contains(normalized, w) {
+			return ConfirmYes
+		}
+	}
+	return ConfirmUnknown
+}
+
+func containsWord(words []string, candidates []string) bool {
+	for _, w := range words {
+		for _, c := range candidates {
+			if w == c {
+				return true
+			}
+		}
+	}
+	return false
+}
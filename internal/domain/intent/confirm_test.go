@@ -0,0 +1,51 @@
+package intent
+
+import (
+	"testing"
+
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+)
+
+func TestMatchToolPolicyExactBeforeWildcard(t *testing.T) {
+	policies := []types.ToolPolicy{
+		{Tool: "device_*", Policy: ToolPolicyConfirm},
+		{Tool: "device_status", Policy: ToolPolicyAllow},
+		{Tool: "[", Policy: ToolPolicyDeny},
+	}
+	if p, ok := MatchToolPolicy(policies, "device_status"); !ok || p.Policy != ToolPolicyAllow {
+		t.Fatalf("expected exact allow, got %+v %v", p, ok)
+	}
+	if p, ok := MatchToolPolicy(policies, "device_reboot"); !ok || p.Policy != ToolPolicyConfirm {
+		t.Fatalf("expected wildcard confirm, got %+v %v", p, ok)
+	}
+	if _, ok := MatchToolPolicy(policies, "weather"); ok {
+		t.Fatal("expected no policy")
+	}
+}
+
+func TestClassifyConfirmation(t *testing.T) {
+	cases := map[string]Confirmation{
+		"好的":          ConfirmYes,
+		"确定，执行吧":      ConfirmYes,
+		"没问题":         ConfirmYes,
+		"没有问题":        ConfirmYes,
+		"没什么问题，开吧":    ConfirmYes,
+		"不用问，直接开":     ConfirmYes,
+		"好的不用了":       ConfirmNo,
+		"好，先不开了":      ConfirmNo,
+		"不要":          ConfirmNo,
+		"算了吧":         ConfirmNo,
+		"不可以":         ConfirmNo,
+		"Yes, please": ConfirmYes,
+		"No.":         ConfirmNo,
+		"I know":      ConfirmUnknown,
+		"":            ConfirmUnknown,
+		"今天天气怎么样":     ConfirmUnknown,
+		"好的，顺便帮我把客厅空调也打开": ConfirmUnknown,
+	}
+	for text, want := range cases {
+		if got := ClassifyConfirmation(text); got != want {
+			t.Errorf("ClassifyConfirmation(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package intent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// Embedder 文本向量化接口，返回结果与输入一一对应
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// newEmbedderFromViper 按 intent_router.embedding 配置创建带缓存的 OpenAI 兼容向量客户端，未配置时返回 nil
+func newEmbedderFromViper() Embedder {
+	baseURL := strings.TrimSpace(viper.GetString("intent_router.embedding.base_url"))
+	model := strings.TrimSpace(viper.GetString("intent_router.embedding.model"))
+	if baseURL == "" || model == "" {
+		return nil
+	}
+	timeout := viper.GetDuration("intent_router.embedding.timeout")
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	log.Infof("意图路由已启用语义匹配: base_url=%s model=%s", baseURL, model)
+	return NewCachedEmbedder(&OpenAIEmbedder{
+		BaseURL: baseURL,
+		APIKey:  strings.TrimSpace(viper.GetString("intent_router.embedding.api_key")),
+		Model:   model,
+		Client:  &http.Client{Timeout: timeout},
+	}, viper.GetInt("intent_router.embedding.cache_size"))
+}
+
+// OpenAIEmbedder 调用 OpenAI 兼容的 /embeddings 接口
+type OpenAIEmbedder struct {
+	BaseURL string
+	APIKey  string
+	Model   string
+	Client  *http.Client
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"model": e.Model,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(e.BaseURL, "/")+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.APIKey)
+	}
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embeddings 请求失败: status=%d body=%s", resp.StatusCode, truncate(string(respBody), 256))
+	}
+
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("解析 embeddings 响应失败: %w", err)
+	}
+	if len(result.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings 返回数量不匹配: want=%d got=%d", len(texts), len(result.Data))
+	}
+	vecs := make([][]float32, len(texts))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("embeddings 返回下标越界: %d", item.Index)
+		}
+		vecs[item.Index] = item.Embedding
+	}
+	return vecs, nil
+}
+
+const defaultEmbeddingCacheSize = 1024
+
+// CachedEmbedder 缓存文本向量：规则示例句在每轮对话都会参与计算，缓存后只需请求用户原话
+type CachedEmbedder struct {
+	next Embedder
+	size int
+
+	mu    sync.Mutex
+	cache map[string][]float32
+	order []string
+}
+
+func NewCachedEmbedder(next Embedder, size int) *CachedEmbedder {
+	if size <= 0 {
+		size = defaultEmbeddingCacheSize
+	}
+	return &CachedEmbedder{
+		next:  next,
+		size:  size,
+		cache: make(map[string][]float32),
+	}
+}
+
+func (c *CachedEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vecs := make([][]float32, len(texts))
+	var missing []string
+	var missingIdx []int
+
+	c.mu.Lock()
+	for i, text := range texts {
+		if vec, ok := c.cache[text]; ok {
+			vecs[i] = vec
+			continue
+		}
+		missing = append(missing, text)
+		missingIdx = append(missingIdx, i)
+	}
+	c.mu.Unlock()
+
+	if len(missing) == 0 {
+		return vecs, nil
+	}
+	fetched, err := c.next.Embed(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	if len(fetched) != len(missing) {
+		return nil, fmt.Errorf("embeddings 返回数量不匹配: want=%d got=%d", len(missing), len(fetched))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for j, i := range missingIdx {
+		vecs[i] = fetched[j]
+		c.putLocked(missing[j], fetched[j])
+	}
+	return vecs, nil
+}
+
+// putLocked 按写入顺序淘汰最早的缓存项
+func (c *CachedEmbedder) putLocked(text string, vec []float32) {
+	if _, ok := c.cache[text]; ok {
+		return
+	}
+	for len(c.order) >= c.size {
+		delete(c.cache, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.cache[text] = vec
+	c.order = append(c.order, text)
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
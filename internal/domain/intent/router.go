@@ -0,0 +1,249 @@
+package intent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// 匹配方式
+const (
+	MatchKeyword   = "keyword"
+	MatchRegex     = "regex"
+	MatchEmbedding = "embedding"
+)
+
+// 命中后的动作
+const (
+	ActionTool   = "tool"   // 直接调用 MCP 工具
+	ActionReply  = "reply"  // 播报固定回复
+	ActionAgent  = "agent"  // 转接到其它智能体
+	ActionMode   = "mode"   // 切换模式（openclaw / normal）
+	ActionLLM    = "llm"    // 交给 LLM，不再匹配后续规则
+	ActionPrompt = "prompt" // 展开 MCP 提示词作为本轮 LLM 输入
+)
+
+// 模式动作的目标
+const (
+	ModeOpenClaw = "openclaw"
+	ModeNormal   = "normal"
+)
+
+const defaultEmbeddingThreshold = 0.85
+
+// Match 一次规则命中的结果
+type Match struct {
+	Rule types.IntentRule
+	// Pattern 命中的关键词 / 正则 / 示例句
+	Pattern string
+	// Score 语义相似度，关键词与正则命中时为 1
+	Score float64
+	// Groups 正则命名分组，用于渲染工具参数
+	Groups map[string]string
+}
+
+// Router 在 LLM 之前按智能体配置的规则匹配用户原话
+type Router struct {
+	embedder Embedder
+
+	regexMu sync.RWMutex
+	regexes map[string]*regexp.Regexp
+}
+
+// NewRouter 创建路由器，embedder 为空时跳过语义相似度规则
+func NewRouter(embedder Embedder) *Router {
+	return &Router{
+		embedder: embedder,
+		regexes:  make(map[string]*regexp.Regexp),
+	}
+}
+
+var (
+	defaultRouter *Router
+	routerOnce    sync.Once
+)
+
+// GetRouter 返回按 intent_router 配置创建的全局路由器
+func GetRouter() *Router {
+	routerOnce.Do(func() {
+		defaultRouter = NewRouter(newEmbedderFromViper())
+	})
+	return defaultRouter
+}
+
+// Enabled 意图路由是否开启（默认开启，未配置规则时不产生任何开销）
+func Enabled() bool {
+	return !viper.IsSet("intent_router.enabled") || viper.GetBool("intent_router.enabled")
+}
+
+// Match 按顺序匹配规则（调用方保证已按优先级排序），返回第一条命中的规则；未命中返回 nil。
+// 语义相似度规则只在需要时计算一次用户原话的向量，向量服务出错时跳过这些规则。
+func (r *Router) Match(ctx context.Context, text string, rules []types.IntentRule) *Match {
+	text = strings.TrimSpace(text)
+	if text == "" || len(rules) == 0 {
+		return nil
+	}
+
+	normalizedText := normalizeText(text)
+	var queryVec []float32
+	embeddingFailed := false
+
+	for _, rule := range rules {
+		var m *Match
+		switch strings.ToLower(rule.MatchType) {
+		case MatchKeyword:
+			m = matchKeyword(normalizedText, rule)
+		case MatchRegex:
+			m = r.matchRegex(text, rule)
+		case MatchEmbedding:
+			if r.embedder == nil || embeddingFailed {
+				continue
+			}
+			if queryVec == nil {
+				vecs, err := r.embedder.Embed(ctx, []string{text})
+				if err != nil || len(vecs) != 1 {
+					log.Warnf("意图路由计算文本向量失败，跳过语义规则: %v", err)
+					embeddingFailed = true
+					continue
+				}
+				queryVec = vecs[0]
+			}
+			m = r.matchEmbedding(ctx, queryVec, rule)
+		default:
+			log.Debugf("意图规则 %s 匹配方式未知: %s", rule.Name, rule.MatchType)
+		}
+		if m != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+func matchKeyword(normalizedText string, rule types.IntentRule) *Match {
+	if normalizedText == "" {
+		return nil
+	}
+	for _, pattern := range rule.Patterns {
+		keyword := normalizeText(pattern)
+		if keyword != "" && strings.Contains(normalizedText, keyword) {
+			return &Match{Rule: rule, Pattern: pattern, Score: 1}
+		}
+	}
+	return nil
+}
+
+func (r *Router) matchRegex(text string, rule types.IntentRule) *Match {
+	for _, pattern := range rule.Patterns {
+		re, err := r.compile(pattern)
+		if err != nil {
+			log.Warnf("意图规则 %s 正则无效: %q, err=%v", rule.Name, pattern, err)
+			continue
+		}
+		sub := re.FindStringSubmatch(text)
+		if sub == nil {
+			continue
+		}
+		groups := make(map[string]string)
+		for i, name := range re.SubexpNames() {
+			if i > 0 && name != "" {
+				groups[name] = sub[i]
+			}
+		}
+		return &Match{Rule: rule, Pattern: pattern, Score: 1, Groups: groups}
+	}
+	return nil
+}
+
+func (r *Router) compile(pattern string) (*regexp.Regexp, error) {
+	r.regexMu.RLock()
+	re, ok := r.regexes[pattern]
+	r.regexMu.RUnlock()
+	if ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	r.regexMu.Lock()
+	r.regexes[pattern] = re
+	r.regexMu.Unlock()
+	return re, nil
+}
+
+func (r *Router) matchEmbedding(ctx context.Context, queryVec []float32, rule types.IntentRule) *Match {
+	threshold := rule.Threshold
+	if threshold <= 0 {
+		threshold = embeddingThresholdFromViper()
+	}
+	vecs, err := r.embedder.Embed(ctx, rule.Patterns)
+	if err != nil || len(vecs) != len(rule.Patterns) {
+		log.Warnf("意图规则 %s 计算示例句向量失败: %v", rule.Name, err)
+		return nil
+	}
+	var best *Match
+	for i, vec := range vecs {
+		score := cosineSimilarity(queryVec, vec)
+		if score >= threshold && (best == nil || score > best.Score) {
+			best = &Match{Rule: rule, Pattern: rule.Patterns[i], Score: score}
+		}
+	}
+	return best
+}
+
+func embeddingThresholdFromViper() float64 {
+	if t := viper.GetFloat64("intent_router.embedding.threshold"); t > 0 && t <= 1 {
+		return t
+	}
+	return defaultEmbeddingThreshold
+}
+
+// RenderToolArgs 渲染工具参数模板：{{text}} 替换为用户原话，{{name}} 替换为正则命名分组。
+// 替换值按 JSON 字符串转义，模板为空时返回 "{}"。
+func RenderToolArgs(tmpl string, text string, groups map[string]string) (string, error) {
+	tmpl = strings.TrimSpace(tmpl)
+	if tmpl == "" {
+		return "{}", nil
+	}
+	values := map[string]string{"text": text}
+	for k, v := range groups {
+		values[k] = v
+	}
+	out := placeholderPattern.ReplaceAllStringFunc(tmpl, func(ph string) string {
+		name := strings.TrimSpace(ph[2 : len(ph)-2])
+		v, ok := values[name]
+		if !ok {
+			return ph
+		}
+		escaped, _ := json.Marshal(v)
+		return string(escaped[1 : len(escaped)-1])
+	})
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &args); err != nil {
+		return "", fmt.Errorf("工具参数不是合法的 JSON 对象: %w", err)
+	}
+	return out, nil
+}
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*[A-Za-z_][A-Za-z0-9_]*\s*\}\}`)
+
+// normalizeText 统一大小写并去除空白与标点，避免 ASR 标点差异影响关键词匹配
+func normalizeText(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
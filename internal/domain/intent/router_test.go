@@ -0,0 +1,121 @@
+package intent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+)
+
+// fakeEmbedder 按预设表返回向量，并记录每次请求的文本
+type fakeEmbedder struct {
+	vecs  map[string][]float32
+	calls [][]string
+	err   error
+}
+
+func (f *fakeEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	f.calls = append(f.calls, texts)
+	if f.err != nil {
+		return nil, f.err
+	}
+	out := make([][]float32, len(texts))
+	for i, t := range texts {
+		out[i] = f.vecs[t]
+	}
+	return out, nil
+}
+
+func TestMatchKeywordIgnoresPunctuationAndCase(t *testing.T) {
+	r := NewRouter(nil)
+	rules := []types.IntentRule{
+		{Name: "关灯", MatchType: MatchKeyword, Patterns: []string{"关灯"}, Action: ActionReply, Reply: "好的"},
+	}
+	m := r.Match(context.Background(), "帮我关，灯！", rules)
+	if m == nil || m.Rule.Name != "关灯" || m.Pattern != "关灯" {
+		t.Fatalf("expected keyword hit, got %+v", m)
+	}
+	if r.Match(context.Background(), "开灯", rules) != nil {
+		t.Fatal("expected no hit")
+	}
+}
+
+func TestMatchFirstRuleWins(t *testing.T) {
+	r := NewRouter(nil)
+	rules := []types.IntentRule{
+		{Name: "兜底", MatchType: MatchKeyword, Patterns: []string{"天气"}, Action: ActionLLM},
+		{Name: "天气", MatchType: MatchKeyword, Patterns: []string{"天气"}, Action: ActionReply},
+	}
+	m := r.Match(context.Background(), "今天天气怎么样", rules)
+	if m == nil || m.Rule.Name != "兜底" {
+		t.Fatalf("expected first rule to win, got %+v", m)
+	}
+}
+
+func TestMatchRegexGroupsAndRenderToolArgs(t *testing.T) {
+	r := NewRouter(nil)
+	rules := []types.IntentRule{
+		{Name: "开关灯", MatchType: MatchRegex, Patterns: []string{`(?P<room>客厅|卧室)的?灯(?P<op>开|关)`}, Action: ActionTool, ToolName: "light"},
+	}
+	m := r.Match(context.Background(), "把卧室的灯关了", rules)
+	if m == nil {
+		t.Fatal("expected regex hit")
+	}
+	if m.Groups["room"] != "卧室" || m.Groups["op"] != "关" {
+		t.Fatalf("unexpected groups: %+v", m.Groups)
+	}
+
+	args, err := RenderToolArgs(`{"room": "{{room}}", "op": "{{ op }}", "raw": "{{text}}", "keep": "{{unknown}}"}`, `说"关"`, m.Groups)
+	if err != nil {
+		t.Fatalf("RenderToolArgs: %v", err)
+	}
+	want := `{"room": "卧室", "op": "关", "raw": "说\"关\"", "keep": "{{unknown}}"}`
+	if args != want {
+		t.Fatalf("unexpected args:\n got %s\nwant %s", args, want)
+	}
+
+	if args, err := RenderToolArgs("", "x", nil); err != nil || args != "{}" {
+		t.Fatalf("expected empty template to render {}, got %q err=%v", args, err)
+	}
+	if _, err := RenderToolArgs("not json", "x", nil); err == nil {
+		t.Fatal("expected invalid template to fail")
+	}
+}
+
+func TestMatchEmbeddingThresholdAndCache(t *testing.T) {
+	fake := &fakeEmbedder{vecs: map[string][]float32{
+		"太黑了":   {1, 0.1},
+		"把灯打开":  {1, 0},
+		"播放音乐":  {0, 1},
+		"今天星期几": {0.7, 0.7},
+	}}
+	r := NewRouter(NewCachedEmbedder(fake, 8))
+	rules := []types.IntentRule{
+		{Name: "开灯", MatchType: MatchEmbedding, Patterns: []string{"把灯打开", "播放音乐"}, Threshold: 0.9, Action: ActionReply},
+	}
+
+	m := r.Match(context.Background(), "太黑了", rules)
+	if m == nil || m.Pattern != "把灯打开" || m.Score < 0.9 {
+		t.Fatalf("expected embedding hit on 把灯打开, got %+v", m)
+	}
+	if r.Match(context.Background(), "今天星期几", rules) != nil {
+		t.Fatal("expected score below threshold to miss")
+	}
+	// 示例句向量已缓存，第二次只请求用户原话
+	if len(fake.calls) != 3 || len(fake.calls[2]) != 1 || fake.calls[2][0] != "今天星期几" {
+		t.Fatalf("expected cached pattern embeddings, calls=%v", fake.calls)
+	}
+}
+
+func TestMatchEmbeddingErrorSkipsSemanticRules(t *testing.T) {
+	r := NewRouter(&fakeEmbedder{err: errors.New("unavailable")})
+	rules := []types.IntentRule{
+		{Name: "语义", MatchType: MatchEmbedding, Patterns: []string{"把灯打开"}, Action: ActionReply},
+		{Name: "关键词", MatchType: MatchKeyword, Patterns: []string{"灯"}, Action: ActionReply},
+	}
+	m := r.Match(context.Background(), "开灯", rules)
+	if m == nil || m.Rule.Name != "关键词" {
+		t.Fatalf("expected fallback to keyword rule, got %+v", m)
+	}
+}
@@ -0,0 +1,644 @@
+package anthropic_llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/cloudwego/eino/schema"
+	sse "github.com/tmaxmax/go-sse"
+
+	"xiaozhi-esp32-server-golang/internal/domain/llm/common"
+)
+
+const (
+	defaultAnthropicBaseURL = "https://api.anthropic.com/v1"
+	defaultAnthropicVersion = "2023-06-01"
+	defaultMaxTokens        = 500
+	defaultThinkingEffort   = "medium"
+
+	// CacheControlExtraKey system 消息 Extra 中的缓存提示：值为 true 时在该段系统提示词上设置 cache_control；
+	// 值为 int 时表示前 n 字节是各轮不变的前缀，只在该前缀上设置 cache_control，其余内容单独成块
+	CacheControlExtraKey = "cache_control"
+
+	// maxThinkingCacheSize 缓存的思考块条数上限（按工具调用 ID 索引）
+	maxThinkingCacheSize = 256
+)
+
+// thinkingCache 开启思考后，带工具调用的 assistant 回复在下一轮请求中必须原样带回思考块（含签名），
+// 而对话历史只保存文本和工具调用，这里按第一个工具调用 ID 暂存思考块，转换消息时补回
+var thinkingCache = common.NewBoundedCache[[]contentBlock](maxThinkingCacheSize)
+
+// AnthropicLLMProvider 直接调用 Anthropic Messages API（流式）的 LLM 提供者
+type AnthropicLLMProvider struct {
+	apiKey      string
+	baseURL     string
+	version     string
+	modelName   string
+	maxTokens   int
+	temperature *float32
+	topP        *float32
+	thinking    thinkingConfig
+	promptCache bool
+	httpClient  *http.Client
+}
+
+type thinkingConfig struct {
+	Mode         string `json:"mode"`
+	BudgetTokens *int   `json:"budget_tokens,omitempty"`
+	Effort       string `json:"effort,omitempty"`
+}
+
+type anthropicConfig struct {
+	APIKey           string          `json:"api_key"`
+	BaseURL          string          `json:"base_url"`
+	AnthropicVersion string          `json:"anthropic_version"`
+	ModelName        string          `json:"model_name"`
+	MaxTokens        *int            `json:"max_tokens,omitempty"`
+	Temperature      *float32        `json:"temperature,omitempty"`
+	TopP             *float32        `json:"top_p,omitempty"`
+	Thinking         *thinkingConfig `json:"thinking,omitempty"`
+	PromptCache      *bool           `json:"prompt_cache,omitempty"`
+}
+
+type messagesRequest struct {
+	Model        string                 `json:"model"`
+	MaxTokens    int                    `json:"max_tokens"`
+	System       []contentBlock         `json:"system,omitempty"`
+	Messages     []message              `json:"messages"`
+	Tools        []toolDefinition       `json:"tools,omitempty"`
+	Temperature  *float32               `json:"temperature,omitempty"`
+	TopP         *float32               `json:"top_p,omitempty"`
+	Thinking     map[string]interface{} `json:"thinking,omitempty"`
+	OutputConfig map[string]interface{} `json:"output_config,omitempty"`
+	Stream       bool                   `json:"stream"`
+}
+
+type message struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+}
+
+type contentBlock struct {
+	Type         string          `json:"type"`
+	Text         string          `json:"text,omitempty"`
+	Source       *imageSource    `json:"source,omitempty"`
+	ID           string          `json:"id,omitempty"`
+	Name         string          `json:"name,omitempty"`
+	Input        json.RawMessage `json:"input,omitempty"`
+	ToolUseID    string          `json:"tool_use_id,omitempty"`
+	Content      string          `json:"content,omitempty"`
+	Thinking     string          `json:"thinking,omitempty"`
+	Signature    string          `json:"signature,omitempty"`
+	Data         string          `json:"data,omitempty"`
+	CacheControl *cacheControl   `json:"cache_control,omitempty"`
+}
+
+type imageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type cacheControl struct {
+	Type string `json:"type"`
+}
+
+type toolDefinition struct {
+	Name         string          `json:"name"`
+	Description  string          `json:"description,omitempty"`
+	InputSchema  json.RawMessage `json:"input_schema"`
+	CacheControl *cacheControl   `json:"cache_control,omitempty"`
+}
+
+type streamEvent struct {
+	Type         string        `json:"type"`
+	Index        int           `json:"index"`
+	ContentBlock *contentBlock `json:"content_block,omitempty"`
+	Delta        *streamDelta  `json:"delta,omitempty"`
+	Message      *struct {
+		Model string      `json:"model"`
+		Usage streamUsage `json:"usage"`
+	} `json:"message,omitempty"`
+	Usage *streamUsage `json:"usage,omitempty"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+type streamDelta struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	PartialJSON string `json:"partial_json"`
+	Thinking    string `json:"thinking"`
+	Signature   string `json:"signature"`
+	StopReason  string `json:"stop_reason"`
+}
+
+type streamUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// NewAnthropicLLMProvider 创建 Anthropic Messages API 提供者
+func NewAnthropicLLMProvider(config map[string]interface{}) (*AnthropicLLMProvider, error) {
+	var parsed anthropicConfig
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("解析LLM配置失败: %v", err)
+	}
+	if err := json.Unmarshal(payload, &parsed); err != nil {
+		return nil, fmt.Errorf("解析LLM配置失败: %v", err)
+	}
+
+	apiKey := strings.TrimSpace(parsed.APIKey)
+	if apiKey == "" {
+		return nil, fmt.Errorf("anthropic api_key不能为空")
+	}
+	modelName := strings.TrimSpace(parsed.ModelName)
+	if modelName == "" {
+		return nil, fmt.Errorf("model_name不能为空")
+	}
+
+	baseURL := strings.TrimRight(strings.TrimSpace(parsed.BaseURL), "/")
+	if baseURL == "" {
+		baseURL = defaultAnthropicBaseURL
+	}
+	// Messages API 挂在 /v1 下
+	if !strings.HasSuffix(strings.ToLower(baseURL), "/v1") {
+		baseURL += "/v1"
+	}
+
+	version := strings.TrimSpace(parsed.AnthropicVersion)
+	if version == "" {
+		version = defaultAnthropicVersion
+	}
+
+	// Messages API 要求必须传 max_tokens
+	maxTokens := defaultMaxTokens
+	if parsed.MaxTokens != nil && *parsed.MaxTokens > 0 {
+		maxTokens = *parsed.MaxTokens
+	}
+
+	promptCache := true
+	if parsed.PromptCache != nil {
+		promptCache = *parsed.PromptCache
+	}
+
+	var thinking thinkingConfig
+	if parsed.Thinking != nil {
+		thinking = thinkingConfig{
+			Mode:         strings.ToLower(strings.TrimSpace(parsed.Thinking.Mode)),
+			BudgetTokens: parsed.Thinking.BudgetTokens,
+			Effort:       strings.ToLower(strings.TrimSpace(parsed.Thinking.Effort)),
+		}
+	}
+
+	return &AnthropicLLMProvider{
+		apiKey:      apiKey,
+		baseURL:     baseURL,
+		version:     version,
+		modelName:   modelName,
+		maxTokens:   maxTokens,
+		temperature: parsed.Temperature,
+		topP:        parsed.TopP,
+		thinking:    thinking,
+		promptCache: promptCache,
+		httpClient:  common.StreamHTTPClient(),
+	}, nil
+}
+
+// ResponseWithContext 流式请求 Messages API：文本增量逐段输出，工具调用在参数完整后作为一条消息输出
+func (p *AnthropicLLMProvider) ResponseWithContext(ctx context.Context, sessionID string, dialogue []*schema.Message, functions []*schema.ToolInfo) chan *schema.Message {
+	out := make(chan *schema.Message, 200)
+
+	go func() {
+		defer close(out)
+
+		reqBody, err := p.buildRequest(dialogue, functions)
+		if err != nil {
+			common.SendLLMError(out, err)
+			return
+		}
+		bodyBytes, err := json.Marshal(reqBody)
+		if err != nil {
+			common.SendLLMError(out, err)
+			return
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/messages", bytes.NewReader(bodyBytes))
+		if err != nil {
+			common.SendLLMError(out, err)
+			return
+		}
+		req.Header.Set("x-api-key", p.apiKey)
+		req.Header.Set("anthropic-version", p.version)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "text/event-stream")
+
+		resp, err := p.httpClient.Do(req)
+		if err != nil {
+			common.SendLLMError(out, fmt.Errorf("anthropic请求失败: %w", err))
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			errBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+			common.SendLLMError(out, fmt.Errorf("anthropic请求失败 status=%d body=%s", resp.StatusCode, strings.TrimSpace(string(errBody))))
+			return
+		}
+
+		p.readStream(ctx, sessionID, resp.Body, out)
+	}()
+
+	return out
+}
+
+// streamBlock 流中正在拼装的内容块
+type streamBlock struct {
+	block contentBlock
+	input strings.Builder
+}
+
+func (p *AnthropicLLMProvider) readStream(ctx context.Context, sessionID string, body io.Reader, out chan *schema.Message) {
+	blocks := make(map[int]*streamBlock)
+	var thinkingBlocks []contentBlock
+	var toolUseIDs []string
+	defer func() {
+		// 开启思考时，带工具调用的回复需要在下一轮原样带回思考块
+		if len(thinkingBlocks) > 0 && len(toolUseIDs) > 0 {
+			thinkingCache.Put(toolUseIDs[0], thinkingBlocks)
+		}
+	}()
+
+	for event, eventErr := range sse.Read(body, nil) {
+		if eventErr != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			common.SendLLMError(out, fmt.Errorf("anthropic流读取失败: %w", eventErr))
+			return
+		}
+
+		data := strings.TrimSpace(event.Data)
+		if data == "" {
+			continue
+		}
+		var ev streamEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			log.Warnf("解析anthropic流事件失败: %v, data=%s", err, common.PreviewString(data, 256))
+			continue
+		}
+
+		switch ev.Type {
+		case "message_start":
+			if ev.Message != nil {
+				u := ev.Message.Usage
+				log.Debugf("[Anthropic-LLM] SessionID: %s, input_tokens=%d, cache_read=%d, cache_creation=%d",
+					sessionID, u.InputTokens, u.CacheReadInputTokens, u.CacheCreationInputTokens)
+			}
+		case "content_block_start":
+			if ev.ContentBlock == nil {
+				continue
+			}
+			sb := &streamBlock{block: *ev.ContentBlock}
+			sb.block.Input = nil
+			blocks[ev.Index] = sb
+			if sb.block.Type == "text" && sb.block.Text != "" {
+				out <- &schema.Message{Role: schema.Assistant, Content: sb.block.Text}
+			}
+		case "content_block_delta":
+			sb := blocks[ev.Index]
+			if sb == nil || ev.Delta == nil {
+				continue
+			}
+			switch ev.Delta.Type {
+			case "text_delta":
+				if ev.Delta.Text != "" {
+					out <- &schema.Message{Role: schema.Assistant, Content: ev.Delta.Text}
+				}
+			case "input_json_delta":
+				sb.input.WriteString(ev.Delta.PartialJSON)
+			case "thinking_delta":
+				sb.block.Thinking += ev.Delta.Thinking
+			case "signature_delta":
+				sb.block.Signature += ev.Delta.Signature
+			}
+		case "content_block_stop":
+			sb := blocks[ev.Index]
+			if sb == nil {
+				continue
+			}
+			delete(blocks, ev.Index)
+			switch sb.block.Type {
+			case "tool_use":
+				args := strings.TrimSpace(sb.input.String())
+				if args == "" {
+					args = "{}"
+				}
+				toolUseIDs = append(toolUseIDs, sb.block.ID)
+				out <- &schema.Message{
+					Role: schema.Assistant,
+					ToolCalls: []schema.ToolCall{{
+						ID:   sb.block.ID,
+						Type: "function",
+						Function: schema.FunctionCall{
+							Name:      sb.block.Name,
+							Arguments: args,
+						},
+					}},
+				}
+			case "thinking", "redacted_thinking":
+				thinkingBlocks = append(thinkingBlocks, sb.block)
+			}
+		case "message_delta":
+			if ev.Delta != nil && ev.Delta.StopReason == "max_tokens" {
+				log.Warnf("[Anthropic-LLM] SessionID: %s, 回复达到 max_tokens 被截断", sessionID)
+			}
+		case "message_stop":
+			return
+		case "error":
+			msg := "anthropic返回错误"
+			if ev.Error != nil && ev.Error.Message != "" {
+				msg = fmt.Sprintf("anthropic返回错误: %s: %s", ev.Error.Type, ev.Error.Message)
+			}
+			common.SendLLMError(out, errors.New(msg))
+			return
+		}
+	}
+}
+
+func (p *AnthropicLLMProvider) buildRequest(dialogue []*schema.Message, functions []*schema.ToolInfo) (*messagesRequest, error) {
+	system, messages := p.convertMessages(dialogue)
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("anthropic请求消息不能为空")
+	}
+	tools, err := p.convertTools(functions)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &messagesRequest{
+		Model:     p.modelName,
+		MaxTokens: p.maxTokens,
+		System:    system,
+		Messages:  messages,
+		Tools:     tools,
+		Stream:    true,
+	}
+	// 开启思考时接口不接受自定义 temperature/top_p
+	if !p.applyThinking(req) {
+		req.Temperature = p.temperature
+		req.TopP = p.topP
+	}
+	return req, nil
+}
+
+func (p *AnthropicLLMProvider) applyThinking(req *messagesRequest) bool {
+	switch p.thinking.Mode {
+	case "enabled":
+		if p.thinking.BudgetTokens == nil || *p.thinking.BudgetTokens <= 0 {
+			return false
+		}
+		req.Thinking = map[string]interface{}{
+			"type":          "enabled",
+			"budget_tokens": *p.thinking.BudgetTokens,
+		}
+		return true
+	case "adaptive":
+		effort := p.thinking.Effort
+		switch effort {
+		case "low", "medium", "high", "max":
+		default:
+			effort = defaultThinkingEffort
+		}
+		req.Thinking = map[string]interface{}{"type": "adaptive"}
+		req.OutputConfig = map[string]interface{}{"effort": effort}
+		return true
+	}
+	return false
+}
+
+// convertMessages 把对话转换为 system 块和 user/assistant 交替的消息列表：
+// 工具结果作为 user 消息中的 tool_result 块，相邻同角色消息合并
+func (p *AnthropicLLMProvider) convertMessages(dialogue []*schema.Message) ([]contentBlock, []message) {
+	var system []contentBlock
+	var messages []message
+
+	appendBlocks := func(role string, blocks []contentBlock) {
+		if len(blocks) == 0 {
+			return
+		}
+		if n := len(messages); n > 0 && messages[n-1].Role == role {
+			messages[n-1].Content = append(messages[n-1].Content, blocks...)
+			return
+		}
+		messages = append(messages, message{Role: role, Content: blocks})
+	}
+
+	for _, msg := range dialogue {
+		if msg == nil {
+			continue
+		}
+		switch msg.Role {
+		case schema.System:
+			system = append(system, systemBlocks(msg, p.promptCache)...)
+		case schema.User:
+			appendBlocks("user", userBlocks(msg))
+		case schema.Assistant:
+			appendBlocks("assistant", assistantBlocks(msg))
+		case schema.Tool:
+			appendBlocks("user", []contentBlock{{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   msg.Content,
+			}})
+		}
+	}
+
+	// 未单独标注缓存提示时，整段系统提示词作为缓存前缀
+	if p.promptCache && len(system) > 0 && !hasCacheControl(system) {
+		system[len(system)-1].CacheControl = &cacheControl{Type: "ephemeral"}
+	}
+	return system, messages
+}
+
+func userBlocks(msg *schema.Message) []contentBlock {
+	if len(msg.MultiContent) == 0 {
+		if msg.Content == "" {
+			return nil
+		}
+		return []contentBlock{{Type: "text", Text: msg.Content}}
+	}
+
+	blocks := make([]contentBlock, 0, len(msg.MultiContent))
+	for _, part := range msg.MultiContent {
+		switch part.Type {
+		case schema.ChatMessagePartTypeText:
+			if part.Text != "" {
+				blocks = append(blocks, contentBlock{Type: "text", Text: part.Text})
+			}
+		case schema.ChatMessagePartTypeImageURL:
+			if part.ImageURL == nil {
+				continue
+			}
+			if source := imageSourceFromURL(part.ImageURL.URL); source != nil {
+				blocks = append(blocks, contentBlock{Type: "image", Source: source})
+			}
+		}
+	}
+	return blocks
+}
+
+// imageSourceFromURL data URL 转为 base64 图片，其它地址按 url 图片传递
+func imageSourceFromURL(raw string) *imageSource {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	if !strings.HasPrefix(raw, "data:") {
+		return &imageSource{Type: "url", URL: raw}
+	}
+	meta, data, ok := strings.Cut(strings.TrimPrefix(raw, "data:"), ",")
+	if !ok || !strings.HasSuffix(meta, ";base64") {
+		return nil
+	}
+	return &imageSource{
+		Type:      "base64",
+		MediaType: strings.TrimSuffix(meta, ";base64"),
+		Data:      data,
+	}
+}
+
+func assistantBlocks(msg *schema.Message) []contentBlock {
+	var blocks []contentBlock
+	if len(msg.ToolCalls) > 0 {
+		blocks = append(blocks, thinkingCache.Get(msg.ToolCalls[0].ID)...)
+	}
+	if msg.Content != "" {
+		blocks = append(blocks, contentBlock{Type: "text", Text: msg.Content})
+	}
+	for _, tc := range msg.ToolCalls {
+		input := strings.TrimSpace(tc.Function.Arguments)
+		if input == "" || !json.Valid([]byte(input)) {
+			input = "{}"
+		}
+		blocks = append(blocks, contentBlock{
+			Type:  "tool_use",
+			ID:    tc.ID,
+			Name:  tc.Function.Name,
+			Input: json.RawMessage(input),
+		})
+	}
+	return blocks
+}
+
+func (p *AnthropicLLMProvider) convertTools(functions []*schema.ToolInfo) ([]toolDefinition, error) {
+	tools := make([]toolDefinition, 0, len(functions))
+	for _, fn := range functions {
+		if fn == nil || fn.Name == "" {
+			continue
+		}
+		inputSchema := json.RawMessage(`{"type":"object","properties":{}}`)
+		if fn.ParamsOneOf != nil {
+			openAPISchema, err := fn.ParamsOneOf.ToOpenAPIV3()
+			if err != nil {
+				return nil, fmt.Errorf("转换工具 %s 参数失败: %v", fn.Name, err)
+			}
+			if openAPISchema != nil {
+				raw, err := json.Marshal(openAPISchema)
+				if err != nil {
+					return nil, fmt.Errorf("转换工具 %s 参数失败: %v", fn.Name, err)
+				}
+				inputSchema = raw
+			}
+		}
+		tools = append(tools, toolDefinition{
+			Name:        fn.Name,
+			Description: fn.Desc,
+			InputSchema: inputSchema,
+		})
+	}
+	// 工具定义位于系统提示词之前，在最后一个工具上设置缓存断点
+	if p.promptCache && len(tools) > 0 {
+		tools[len(tools)-1].CacheControl = &cacheControl{Type: "ephemeral"}
+	}
+	return tools, nil
+}
+
+// systemBlocks 按 CacheControlExtraKey 把系统提示词拆成带缓存断点的固定前缀与其余内容，关闭 prompt_cache 时忽略提示
+func systemBlocks(msg *schema.Message, promptCache bool) []contentBlock {
+	var blocks []contentBlock
+	appendText := func(text string, cache bool) {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return
+		}
+		block := contentBlock{Type: "text", Text: text}
+		if cache && promptCache {
+			block.CacheControl = &cacheControl{Type: "ephemeral"}
+		}
+		blocks = append(blocks, block)
+	}
+
+	switch hint := msg.Extra[CacheControlExtraKey].(type) {
+	case bool:
+		appendText(msg.Content, hint)
+	case int:
+		if hint <= 0 || hint > len(msg.Content) {
+			appendText(msg.Content, false)
+			break
+		}
+		appendText(msg.Content[:hint], true)
+		appendText(msg.Content[hint:], false)
+	default:
+		appendText(msg.Content, false)
+	}
+	return blocks
+}
+
+func hasCacheControl(blocks []contentBlock) bool {
+	for _, b := range blocks {
+		if b.CacheControl != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ResponseWithVllm 图片识别，图片以 base64 块随问题一起发送
+func (p *AnthropicLLMProvider) ResponseWithVllm(ctx context.Context, file []byte, text string, mimeType string) (string, error) {
+	log.Infof("[Anthropic-LLM] 开始进行VLLM请求 - MIMEType: %s, file length: %d", mimeType, len(file))
+	return common.CollectText(ctx, p.ResponseWithContext(ctx, "", common.VisionDialogue(file, text, mimeType), nil))
+}
+
+func (p *AnthropicLLMProvider) GetModelInfo() map[string]interface{} {
+	return map[string]interface{}{
+		"type":         "anthropic",
+		"provider":     "anthropic",
+		"model_name":   p.modelName,
+		"base_url":     p.baseURL,
+		"max_tokens":   p.maxTokens,
+		"prompt_cache": p.promptCache,
+	}
+}
+
+func (p *AnthropicLLMProvider) Close() error {
+	return nil
+}
+
+func (p *AnthropicLLMProvider) IsValid() bool {
+	return p != nil && p.apiKey != "" && p.baseURL != "" && p.modelName != ""
+}
@@ -0,0 +1,330 @@
+package anthropic_llm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"xiaozhi-esp32-server-golang/internal/domain/llm/common"
+	"xiaozhi-esp32-server-golang/internal/domain/llm/common/llmtest"
+)
+
+// newStandIn 启动一个模拟 Messages API 的 SSE 服务，记录收到的请求体
+func newStandIn(t *testing.T, events []llmtest.Event, captured *map[string]interface{}) *httptest.Server {
+	return llmtest.StandIn{
+		Check: func(t *testing.T, r *http.Request) {
+			assert.Equal(t, "/v1/messages", r.URL.Path)
+			assert.Equal(t, llmtest.APIKey, r.Header.Get("x-api-key"))
+			assert.Equal(t, defaultAnthropicVersion, r.Header.Get("anthropic-version"))
+		},
+		Captured: captured,
+	}.Start(t, events)
+}
+
+func newTestProvider(t *testing.T, baseURL string, extra map[string]interface{}) *AnthropicLLMProvider {
+	t.Helper()
+	provider, err := NewAnthropicLLMProvider(llmtest.Config(baseURL, "claude-test", extra))
+	require.NoError(t, err)
+	return provider
+}
+
+func TestNewAnthropicLLMProvider(t *testing.T) {
+	_, err := NewAnthropicLLMProvider(map[string]interface{}{"model_name": "claude-test"})
+	assert.Error(t, err)
+
+	_, err = NewAnthropicLLMProvider(map[string]interface{}{"api_key": "test-key"})
+	assert.Error(t, err)
+
+	provider, err := NewAnthropicLLMProvider(map[string]interface{}{
+		"api_key":    "test-key",
+		"model_name": "claude-test",
+		"base_url":   "https://api.anthropic.com/v1/",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://api.anthropic.com/v1", provider.baseURL)
+	assert.Equal(t, defaultMaxTokens, provider.maxTokens)
+	assert.True(t, provider.promptCache)
+	assert.True(t, provider.IsValid())
+
+	provider, err = NewAnthropicLLMProvider(map[string]interface{}{
+		"api_key":    "test-key",
+		"model_name": "claude-test",
+		"base_url":   "https://proxy.example.com",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://proxy.example.com/v1", provider.baseURL)
+}
+
+func TestResponseWithContextStreamsText(t *testing.T) {
+	server := newStandIn(t, []llmtest.Event{
+		{Name: "message_start", Data: `{"type":"message_start","message":{"model":"claude-test","usage":{"input_tokens":12,"cache_read_input_tokens":10}}}`},
+		{Name: "content_block_start", Data: `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`},
+		{Name: "ping", Data: `{"type":"ping"}`},
+		{Name: "content_block_delta", Data: `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"你好"}}`},
+		{Name: "content_block_delta", Data: `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"，世界"}}`},
+		{Name: "content_block_stop", Data: `{"type":"content_block_stop","index":0}`},
+		{Name: "message_delta", Data: `{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":4}}`},
+		{Name: "message_stop", Data: `{"type":"message_stop"}`},
+	}, nil)
+
+	provider := newTestProvider(t, server.URL, nil)
+	msgs := llmtest.Collect(provider.ResponseWithContext(context.Background(), "s1", []*schema.Message{
+		schema.UserMessage("你好"),
+	}, nil))
+
+	require.Len(t, msgs, 2)
+	assert.Equal(t, schema.Assistant, msgs[0].Role)
+	assert.Equal(t, "你好", msgs[0].Content)
+	assert.Equal(t, "，世界", msgs[1].Content)
+}
+
+func TestResponseWithContextToolUse(t *testing.T) {
+	server := newStandIn(t, []llmtest.Event{
+		{Name: "message_start", Data: `{"type":"message_start","message":{"usage":{"input_tokens":30}}}`},
+		{Name: "content_block_start", Data: `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`},
+		{Name: "content_block_delta", Data: `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"我来查一下"}}`},
+		{Name: "content_block_stop", Data: `{"type":"content_block_stop","index":0}`},
+		{Name: "content_block_start", Data: `{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_01","name":"get_weather","input":{}}}`},
+		{Name: "content_block_delta", Data: `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":""}}`},
+		{Name: "content_block_delta", Data: `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\": \"北"}}`},
+		{Name: "content_block_delta", Data: `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"京\"}"}}`},
+		{Name: "content_block_stop", Data: `{"type":"content_block_stop","index":1}`},
+		{Name: "content_block_start", Data: `{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_02","name":"get_time","input":{}}}`},
+		{Name: "content_block_stop", Data: `{"type":"content_block_stop","index":2}`},
+		{Name: "message_delta", Data: `{"type":"message_delta","delta":{"stop_reason":"tool_use"}}`},
+		{Name: "message_stop", Data: `{"type":"message_stop"}`},
+	}, nil)
+
+	provider := newTestProvider(t, server.URL, nil)
+	msgs := llmtest.Collect(provider.ResponseWithContext(context.Background(), "s1", []*schema.Message{
+		schema.UserMessage("北京天气怎么样"),
+	}, nil))
+
+	require.Len(t, msgs, 3)
+	assert.Equal(t, "我来查一下", msgs[0].Content)
+	require.Len(t, msgs[1].ToolCalls, 1)
+	assert.Equal(t, "toolu_01", msgs[1].ToolCalls[0].ID)
+	assert.Equal(t, "get_weather", msgs[1].ToolCalls[0].Function.Name)
+	assert.JSONEq(t, `{"city":"北京"}`, msgs[1].ToolCalls[0].Function.Arguments)
+	require.Len(t, msgs[2].ToolCalls, 1)
+	assert.Equal(t, "get_time", msgs[2].ToolCalls[0].Function.Name)
+	assert.Equal(t, "{}", msgs[2].ToolCalls[0].Function.Arguments)
+}
+
+func TestResponseWithContextRequestConversion(t *testing.T) {
+	var captured map[string]interface{}
+	server := newStandIn(t, []llmtest.Event{
+		{Name: "message_stop", Data: `{"type":"message_stop"}`},
+	}, &captured)
+
+	provider := newTestProvider(t, server.URL, map[string]interface{}{
+		"max_tokens":  800,
+		"temperature": 0.5,
+	})
+	tools := []*schema.ToolInfo{
+		{
+			Name: "get_weather",
+			Desc: "查询天气",
+			ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+				"city": {Type: schema.String, Desc: "城市", Required: true},
+			}),
+		},
+		{Name: "get_time", Desc: "查询时间"},
+	}
+	dialogue := []*schema.Message{
+		schema.SystemMessage("你是小智"),
+		schema.UserMessage("北京天气怎么样"),
+		{
+			Role: schema.Assistant,
+			ToolCalls: []schema.ToolCall{
+				{ID: "toolu_01", Function: schema.FunctionCall{Name: "get_weather", Arguments: `{"city":"北京"}`}},
+				{ID: "toolu_02", Function: schema.FunctionCall{Name: "get_time"}},
+			},
+		},
+		schema.ToolMessage("晴", "toolu_01"),
+		schema.ToolMessage("10点", "toolu_02"),
+		schema.UserMessage("谢谢"),
+	}
+	llmtest.Collect(provider.ResponseWithContext(context.Background(), "s1", dialogue, tools))
+	require.NotNil(t, captured)
+
+	assert.Equal(t, "claude-test", captured["model"])
+	assert.Equal(t, float64(800), captured["max_tokens"])
+	assert.Equal(t, 0.5, captured["temperature"])
+	assert.Equal(t, true, captured["stream"])
+
+	system := captured["system"].([]interface{})
+	require.Len(t, system, 1)
+	assert.Equal(t, "你是小智", system[0].(map[string]interface{})["text"])
+	assert.Equal(t, map[string]interface{}{"type": "ephemeral"}, system[0].(map[string]interface{})["cache_control"])
+
+	messages := captured["messages"].([]interface{})
+	require.Len(t, messages, 3)
+	assert.Equal(t, "user", messages[0].(map[string]interface{})["role"])
+
+	assistant := messages[1].(map[string]interface{})
+	assert.Equal(t, "assistant", assistant["role"])
+	toolUse := assistant["content"].([]interface{})
+	require.Len(t, toolUse, 2)
+	assert.Equal(t, "tool_use", toolUse[0].(map[string]interface{})["type"])
+	assert.Equal(t, map[string]interface{}{"city": "北京"}, toolUse[0].(map[string]interface{})["input"])
+	assert.Equal(t, map[string]interface{}{}, toolUse[1].(map[string]interface{})["input"])
+
+	// 连续的工具结果与随后的用户消息合并为同一条 user 消息
+	results := messages[2].(map[string]interface{})
+	assert.Equal(t, "user", results["role"])
+	blocks := results["content"].([]interface{})
+	require.Len(t, blocks, 3)
+	assert.Equal(t, "tool_result", blocks[0].(map[string]interface{})["type"])
+	assert.Equal(t, "toolu_01", blocks[0].(map[string]interface{})["tool_use_id"])
+	assert.Equal(t, "晴", blocks[0].(map[string]interface{})["content"])
+	assert.Equal(t, "toolu_02", blocks[1].(map[string]interface{})["tool_use_id"])
+	assert.Equal(t, "text", blocks[2].(map[string]interface{})["type"])
+
+	toolDefs := captured["tools"].([]interface{})
+	require.Len(t, toolDefs, 2)
+	weather := toolDefs[0].(map[string]interface{})
+	assert.Equal(t, "get_weather", weather["name"])
+	inputSchema := weather["input_schema"].(map[string]interface{})
+	assert.Equal(t, "object", inputSchema["type"])
+	assert.Contains(t, inputSchema["properties"], "city")
+	assert.Nil(t, weather["cache_control"])
+	timeTool := toolDefs[1].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}, timeTool["input_schema"])
+	assert.Equal(t, map[string]interface{}{"type": "ephemeral"}, timeTool["cache_control"])
+}
+
+func TestConvertMessagesCacheHints(t *testing.T) {
+	provider := &AnthropicLLMProvider{promptCache: true}
+	hinted := []*schema.Message{
+		{Role: schema.System, Content: "固定人设", Extra: map[string]any{CacheControlExtraKey: true}},
+		schema.SystemMessage("当前时间"),
+		schema.UserMessage("你好"),
+	}
+	system, _ := provider.convertMessages(hinted)
+	require.Len(t, system, 2)
+	assert.NotNil(t, system[0].CacheControl)
+	assert.Nil(t, system[1].CacheControl)
+
+	// 关闭 prompt_cache 时忽略缓存提示
+	disabled := &AnthropicLLMProvider{promptCache: false}
+	system, _ = disabled.convertMessages(hinted)
+	assert.Nil(t, system[0].CacheControl)
+	system, _ = disabled.convertMessages([]*schema.Message{schema.SystemMessage("人设"), schema.UserMessage("你好")})
+	assert.Nil(t, system[0].CacheControl)
+
+	// int 提示只缓存固定前缀，每轮变化的内容单独成块
+	prompt := "固定人设"
+	system, _ = provider.convertMessages([]*schema.Message{
+		{Role: schema.System, Content: prompt + "\n当前时间: 12:00", Extra: map[string]any{CacheControlExtraKey: len(prompt)}},
+		schema.UserMessage("你好"),
+	})
+	require.Len(t, system, 2)
+	assert.Equal(t, "固定人设", system[0].Text)
+	assert.NotNil(t, system[0].CacheControl)
+	assert.Equal(t, "当前时间: 12:00", system[1].Text)
+	assert.Nil(t, system[1].CacheControl)
+}
+
+func TestThinkingBlocksReplayedWithToolUse(t *testing.T) {
+	server := newStandIn(t, []llmtest.Event{
+		{Name: "content_block_start", Data: `{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`},
+		{Name: "content_block_delta", Data: `{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"需要查天气"}}`},
+		{Name: "content_block_delta", Data: `{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig-1"}}`},
+		{Name: "content_block_stop", Data: `{"type":"content_block_stop","index":0}`},
+		{Name: "content_block_start", Data: `{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_think","name":"get_weather","input":{}}}`},
+		{Name: "content_block_stop", Data: `{"type":"content_block_stop","index":1}`},
+		{Name: "message_stop", Data: `{"type":"message_stop"}`},
+	}, nil)
+
+	budget := 1024
+	provider := newTestProvider(t, server.URL, map[string]interface{}{
+		"temperature": 0.5,
+		"thinking":    map[string]interface{}{"mode": "enabled", "budget_tokens": budget},
+	})
+	msgs := llmtest.Collect(provider.ResponseWithContext(context.Background(), "s1", []*schema.Message{
+		schema.UserMessage("天气"),
+	}, nil))
+	require.Len(t, msgs, 1)
+	require.Len(t, msgs[0].ToolCalls, 1)
+
+	req, err := provider.buildRequest([]*schema.Message{
+		schema.UserMessage("天气"),
+		{Role: schema.Assistant, ToolCalls: msgs[0].ToolCalls},
+		schema.ToolMessage("晴", "toolu_think"),
+	}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, req.Temperature)
+	assert.Equal(t, "enabled", req.Thinking["type"])
+
+	blocks := req.Messages[1].Content
+	require.Len(t, blocks, 2)
+	assert.Equal(t, "thinking", blocks[0].Type)
+	assert.Equal(t, "需要查天气", blocks[0].Thinking)
+	assert.Equal(t, "sig-1", blocks[0].Signature)
+	assert.Equal(t, "tool_use", blocks[1].Type)
+}
+
+func TestResponseWithContextErrors(t *testing.T) {
+	server := newStandIn(t, []llmtest.Event{
+		{Name: "content_block_start", Data: `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`},
+		{Name: "content_block_delta", Data: `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"部分"}}`},
+		{Name: "error", Data: `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`},
+	}, nil)
+	provider := newTestProvider(t, server.URL, nil)
+	msgs := llmtest.Collect(provider.ResponseWithContext(context.Background(), "s1", []*schema.Message{schema.UserMessage("你好")}, nil))
+	require.Len(t, msgs, 2)
+	errMsg, _ := msgs[1].Extra[common.LLMExtraErrorKey].(string)
+	assert.Contains(t, errMsg, "overloaded_error")
+
+	statusServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`))
+	}))
+	defer statusServer.Close()
+	provider = newTestProvider(t, statusServer.URL, nil)
+	msgs = llmtest.Collect(provider.ResponseWithContext(context.Background(), "s1", []*schema.Message{schema.UserMessage("你好")}, nil))
+	require.Len(t, msgs, 1)
+	errMsg, _ = msgs[0].Extra[common.LLMExtraErrorKey].(string)
+	assert.Contains(t, errMsg, "status=401")
+}
+
+func TestResponseWithVllm(t *testing.T) {
+	var captured map[string]interface{}
+	server := newStandIn(t, []llmtest.Event{
+		{Name: "content_block_start", Data: `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`},
+		{Name: "content_block_delta", Data: `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"一只猫"}}`},
+		{Name: "content_block_stop", Data: `{"type":"content_block_stop","index":0}`},
+		{Name: "message_stop", Data: `{"type":"message_stop"}`},
+	}, &captured)
+
+	provider := newTestProvider(t, server.URL, nil)
+	result, err := provider.ResponseWithVllm(context.Background(), []byte("fake-jpeg"), "图里是什么", "image/jpeg")
+	require.NoError(t, err)
+	assert.Equal(t, "一只猫", result)
+
+	messages := captured["messages"].([]interface{})
+	require.Len(t, messages, 1)
+	content := messages[0].(map[string]interface{})["content"].([]interface{})
+	require.Len(t, content, 2)
+	image := content[0].(map[string]interface{})
+	assert.Equal(t, "image", image["type"])
+	source := image["source"].(map[string]interface{})
+	assert.Equal(t, "base64", source["type"])
+	assert.Equal(t, "image/jpeg", source["media_type"])
+	assert.Equal(t, "ZmFrZS1qcGVn", source["data"])
+	assert.True(t, strings.Contains(content[1].(map[string]interface{})["text"].(string), "图里是什么"))
+}
+
+func TestImageSourceFromURL(t *testing.T) {
+	assert.Equal(t, &imageSource{Type: "url", URL: "https://example.com/a.png"}, imageSourceFromURL("https://example.com/a.png"))
+	assert.Equal(t, &imageSource{Type: "base64", MediaType: "image/png", Data: "AAAA"}, imageSourceFromURL("data:image/png;base64,AAAA"))
+	assert.Nil(t, imageSourceFromURL("data:image/png,AAAA"))
+	assert.Nil(t, imageSourceFromURL(""))
+}
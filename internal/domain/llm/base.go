@@ -8,13 +8,19 @@ import (
 	"github.com/cloudwego/eino/schema"
 
 	"xiaozhi-esp32-server-golang/constants"
+	"xiaozhi-esp32-server-golang/internal/domain/llm/anthropic_llm"
+	"xiaozhi-esp32-server-golang/internal/domain/llm/common"
 	"xiaozhi-esp32-server-golang/internal/domain/llm/coze_llm"
 	"xiaozhi-esp32-server-golang/internal/domain/llm/dify_llm"
 	"xiaozhi-esp32-server-golang/internal/domain/llm/eino_llm"
+	"xiaozhi-esp32-server-golang/internal/domain/llm/gemini_llm"
 )
 
 // LLMExtraErrorKey 错误透传约定：ResponseWithContext 失败时在 Message.Extra 中使用的 key
-const LLMExtraErrorKey = "error"
+const LLMExtraErrorKey = common.LLMExtraErrorKey
+
+// CacheControlExtraKey system 消息 Extra 中的提示词缓存提示，值为各轮不变前缀的字节数，目前由 Anthropic 原生接口使用
+const CacheControlExtraKey = anthropic_llm.CacheControlExtraKey
 
 // IsLLMErrorMessage 判断是否为 LLM 透传的错误消息（Extra 中含 error）
 func IsLLMErrorMessage(msg *schema.Message) bool {
@@ -81,7 +87,7 @@ func GetLLMProvider(providerName string, config map[string]interface{}) (LLMProv
 	llmType := resolveLLMType(providerName, cfg)
 	cfg["type"] = llmType
 	providerKey := resolveLLMProviderName(providerName, cfg, llmType)
-	if defaultBaseURL := resolveDefaultBaseURL(providerKey); defaultBaseURL != "" {
+	if defaultBaseURL := resolveDefaultBaseURL(providerKey, llmType); defaultBaseURL != "" {
 		cfg["base_url"] = defaultBaseURL
 	} else if baseURL, _ := cfg["base_url"].(string); strings.TrimSpace(baseURL) == "" {
 		delete(cfg, "base_url")
@@ -107,6 +113,18 @@ func GetLLMProvider(providerName string, config map[string]interface{}) (LLMProv
 			return nil, fmt.Errorf("创建Coze LLM提供者失败: %v", err)
 		}
 		return provider, nil
+	case constants.LlmTypeAnthropic:
+		provider, err := anthropic_llm.NewAnthropicLLMProvider(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("创建Anthropic LLM提供者失败: %v", err)
+		}
+		return provider, nil
+	case constants.LlmTypeGemini:
+		provider, err := gemini_llm.NewGeminiLLMProvider(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("创建Gemini LLM提供者失败: %v", err)
+		}
+		return provider, nil
 	}
 	return nil, fmt.Errorf("不支持的LLM提供者: %s", llmType)
 }
@@ -131,10 +149,16 @@ func resolveLLMProviderName(providerName string, config map[string]interface{},
 	return provider
 }
 
-func resolveDefaultBaseURL(provider string) string {
+func resolveDefaultBaseURL(provider, llmType string) string {
 	switch provider {
 	case "anthropic":
 		return "https://api.anthropic.com/v1/"
+	case "gemini":
+		// OpenAI 兼容接口的地址由用户填写，原生接口才使用默认地址
+		if llmType == constants.LlmTypeGemini {
+			return "https://generativelanguage.googleapis.com/v1beta"
+		}
+		return ""
 	case "zhipu":
 		return "https://open.bigmodel.cn/api/paas/v4"
 	case "aliyun":
@@ -179,7 +203,13 @@ func resolveLLMType(providerName string, config map[string]interface{}) string {
 		return constants.LlmTypeDify
 	case "coze":
 		return constants.LlmTypeCoze
-	case "openai", "azure", "anthropic", "zhipu", "aliyun", "doubao", "siliconflow", "deepseek":
+	case "anthropic", "gemini":
+		// 仅 type 显式为 anthropic/gemini 时走原生接口，否则保持原有的 OpenAI 兼容接口
+		if llmType == provider {
+			return llmType
+		}
+		return constants.LlmTypeOpenai
+	case "openai", "azure", "zhipu", "aliyun", "doubao", "siliconflow", "deepseek":
 		return constants.LlmTypeOpenai
 	}
 
@@ -190,6 +220,10 @@ func resolveLLMType(providerName string, config map[string]interface{}) string {
 		return constants.LlmTypeDify
 	case constants.LlmTypeCoze:
 		return constants.LlmTypeCoze
+	case constants.LlmTypeAnthropic:
+		return constants.LlmTypeAnthropic
+	case constants.LlmTypeGemini:
+		return constants.LlmTypeGemini
 	case constants.LlmTypeOpenai, constants.LlmTypeEinoLLM, constants.LlmTypeEino:
 		return constants.LlmTypeOpenai
 	default:
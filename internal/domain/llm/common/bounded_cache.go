@@ -0,0 +1,44 @@
+package common
+
+import "sync"
+
+// BoundedCache 按写入顺序淘汰的并发安全缓存，供原生提供者按工具调用 ID 暂存下一轮请求需要原样带回的数据
+type BoundedCache[V any] struct {
+	mu    sync.Mutex
+	limit int
+	items map[string]V
+	order []string
+}
+
+// NewBoundedCache 创建最多保留 limit 条的缓存
+func NewBoundedCache[V any](limit int) *BoundedCache[V] {
+	return &BoundedCache[V]{
+		limit: limit,
+		items: make(map[string]V),
+	}
+}
+
+// Put 写入或覆盖 key 对应的值，key 为空时忽略；超出上限时淘汰最早写入的条目
+func (c *BoundedCache[V]) Put(key string, value V) {
+	if key == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.items[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.items[key] = value
+	for len(c.order) > c.limit {
+		delete(c.items, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// Get 取出 key 对应的值，不存在时返回零值
+func (c *BoundedCache[V]) Get(key string) V {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.items[key]
+}
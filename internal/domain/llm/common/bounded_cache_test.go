@@ -0,0 +1,22 @@
+package common
+
+import "testing"
+
+func TestBoundedCacheEvictsOldest(t *testing.T) {
+	cache := NewBoundedCache[string](2)
+	cache.Put("", "ignored")
+	cache.Put("a", "1")
+	cache.Put("b", "2")
+	cache.Put("a", "3")
+	cache.Put("c", "4")
+
+	if got := cache.Get("a"); got != "" {
+		t.Fatalf("oldest key should be evicted, got %q", got)
+	}
+	if cache.Get("b") != "2" || cache.Get("c") != "4" {
+		t.Fatalf("unexpected cache contents: b=%q c=%q", cache.Get("b"), cache.Get("c"))
+	}
+	if got := cache.Get(""); got != "" {
+		t.Fatalf("empty key should be ignored, got %q", got)
+	}
+}
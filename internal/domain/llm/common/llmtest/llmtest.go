@@ -0,0 +1,88 @@
+// Package llmtest 原生 HTTP LLM 提供者测试共用的 SSE 替身服务与辅助函数
+package llmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/require"
+)
+
+// APIKey 替身服务期望的密钥
+const APIKey = "test-key"
+
+// Event 替身服务返回的一条 SSE 事件，Name 为空时不输出 event 行
+type Event struct {
+	Name string
+	Data string
+}
+
+// StandIn 模拟上游流式接口的 SSE 服务
+type StandIn struct {
+	// Check 校验请求路径、参数与鉴权头
+	Check func(t *testing.T, r *http.Request)
+	// Captured 非空时记录收到的请求体
+	Captured *map[string]interface{}
+	// Newline 事件行分隔符，默认 "\n"
+	Newline string
+}
+
+// Start 启动替身服务，每个请求都依次返回 events，测试结束时自动关闭
+func (s StandIn) Start(t *testing.T, events []Event) *httptest.Server {
+	t.Helper()
+	newline := s.Newline
+	if newline == "" {
+		newline = "\n"
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Check != nil {
+			s.Check(t, r)
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		if s.Captured != nil {
+			require.NoError(t, json.Unmarshal(body, s.Captured))
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher, _ := w.(http.Flusher)
+		for _, ev := range events {
+			if ev.Name != "" {
+				fmt.Fprintf(w, "event: %s%s", ev.Name, newline)
+			}
+			fmt.Fprintf(w, "data: %s%s%s", ev.Data, newline, newline)
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Config 构造指向替身服务的提供者配置，extra 中的项覆盖默认值
+func Config(baseURL, modelName string, extra map[string]interface{}) map[string]interface{} {
+	config := map[string]interface{}{
+		"api_key":    APIKey,
+		"base_url":   baseURL,
+		"model_name": modelName,
+	}
+	for k, v := range extra {
+		config[k] = v
+	}
+	return config
+}
+
+// Collect 读完响应通道
+func Collect(ch chan *schema.Message) []*schema.Message {
+	var out []*schema.Message
+	for msg := range ch {
+		out = append(out, msg)
+	}
+	return out
+}
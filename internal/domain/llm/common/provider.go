@@ -0,0 +1,104 @@
+package common
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// LLMExtraErrorKey 错误透传约定：ResponseWithContext 失败时在 Message.Extra 中使用的 key
+const LLMExtraErrorKey = "error"
+
+// visionSystemPrompt 图片识别时使用的系统提示词
+const visionSystemPrompt = "你是一个专业的图片识别专家，请根据图片内容使用中文回答用户的问题。"
+
+var (
+	streamHTTPClientOnce sync.Once
+	streamHTTPClientInst *http.Client
+)
+
+// StreamHTTPClient 返回原生 HTTP 提供者共用的客户端；流式输出由 ctx 控制请求生命周期，不设置整体超时
+func StreamHTTPClient() *http.Client {
+	streamHTTPClientOnce.Do(func() {
+		transport := &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:        200,
+			MaxIdleConnsPerHost: 50,
+			IdleConnTimeout:     90 * time.Second,
+			DisableKeepAlives:   false,
+		}
+		streamHTTPClientInst = &http.Client{
+			Transport: transport,
+			Timeout:   0,
+		}
+	})
+	return streamHTTPClientInst
+}
+
+// SendLLMError 按 LLMExtraErrorKey 约定向响应通道写入错误消息
+func SendLLMError(ch chan *schema.Message, err error) {
+	ch <- &schema.Message{
+		Role:  schema.System,
+		Extra: map[string]any{LLMExtraErrorKey: err.Error()},
+	}
+}
+
+// PreviewString 截取前 n 字节用于日志
+func PreviewString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// VisionDialogue 构造图片识别请求：图片以 data URL 形式与问题放在同一条用户消息中
+func VisionDialogue(file []byte, text string, mimeType string) []*schema.Message {
+	return []*schema.Message{
+		{
+			Role:    schema.System,
+			Content: visionSystemPrompt,
+		},
+		{
+			Role: schema.User,
+			MultiContent: []schema.ChatMessagePart{
+				{
+					Type: schema.ChatMessagePartTypeImageURL,
+					ImageURL: &schema.ChatMessageImageURL{
+						URL: fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(file)),
+					},
+				},
+				{
+					Type: schema.ChatMessagePartTypeText,
+					Text: text,
+				},
+			},
+		},
+	}
+}
+
+// CollectText 读完响应通道并拼接文本，遇到透传的错误消息时返回该错误
+func CollectText(ctx context.Context, ch chan *schema.Message) (string, error) {
+	var result strings.Builder
+	for msg := range ch {
+		if errMsg, ok := msg.Extra[LLMExtraErrorKey].(string); ok {
+			return "", errors.New(errMsg)
+		}
+		result.WriteString(msg.Content)
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	return result.String(), nil
+}
@@ -0,0 +1,605 @@
+package gemini_llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+	sse "github.com/tmaxmax/go-sse"
+
+	"xiaozhi-esp32-server-golang/internal/domain/llm/common"
+)
+
+const (
+	defaultGeminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+	defaultMaxTokens     = 500
+
+	// SafetyRatingsExtraKey 结束消息 Extra 中携带的安全评级（[]SafetyRating）
+	SafetyRatingsExtraKey = "safety_ratings"
+
+	// maxSignatureCacheSize 缓存的思考签名条数上限（按工具调用 ID 索引）
+	maxSignatureCacheSize = 256
+)
+
+// signatureCache 开启思考的模型会在函数调用上附带 thoughtSignature，下一轮请求必须原样带回，
+// 而对话历史只保存工具调用本身，这里按工具调用 ID 暂存签名，转换消息时补回
+var signatureCache = common.NewBoundedCache[string](maxSignatureCacheSize)
+
+// GeminiLLMProvider 直接调用 Gemini streamGenerateContent 接口的 LLM 提供者
+type GeminiLLMProvider struct {
+	apiKey         string
+	baseURL        string
+	modelName      string
+	maxTokens      int
+	temperature    *float32
+	topP           *float32
+	thinking       thinkingConfig
+	safetySettings []SafetySetting
+	httpClient     *http.Client
+}
+
+type thinkingConfig struct {
+	Mode         string `json:"mode"`
+	BudgetTokens *int   `json:"budget_tokens,omitempty"`
+}
+
+// SafetySetting 请求级安全过滤阈值，原样透传给 Gemini
+type SafetySetting struct {
+	Category  string `json:"category"`
+	Threshold string `json:"threshold"`
+}
+
+// SafetyRating Gemini 对回复内容给出的安全评级
+type SafetyRating struct {
+	Category    string `json:"category"`
+	Probability string `json:"probability"`
+	Blocked     bool   `json:"blocked,omitempty"`
+}
+
+type geminiConfig struct {
+	APIKey         string          `json:"api_key"`
+	BaseURL        string          `json:"base_url"`
+	ModelName      string          `json:"model_name"`
+	MaxTokens      *int            `json:"max_tokens,omitempty"`
+	Temperature    *float32        `json:"temperature,omitempty"`
+	TopP           *float32        `json:"top_p,omitempty"`
+	Thinking       *thinkingConfig `json:"thinking,omitempty"`
+	SafetySettings []SafetySetting `json:"safety_settings,omitempty"`
+}
+
+type generateRequest struct {
+	SystemInstruction *content          `json:"systemInstruction,omitempty"`
+	Contents          []content         `json:"contents"`
+	Tools             []tool            `json:"tools,omitempty"`
+	GenerationConfig  *generationConfig `json:"generationConfig,omitempty"`
+	SafetySettings    []SafetySetting   `json:"safetySettings,omitempty"`
+}
+
+type content struct {
+	Role  string `json:"role,omitempty"`
+	Parts []part `json:"parts"`
+}
+
+type part struct {
+	Text             string            `json:"text,omitempty"`
+	Thought          bool              `json:"thought,omitempty"`
+	InlineData       *blob             `json:"inlineData,omitempty"`
+	FileData         *fileData         `json:"fileData,omitempty"`
+	FunctionCall     *functionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *functionResponse `json:"functionResponse,omitempty"`
+	ThoughtSignature string            `json:"thoughtSignature,omitempty"`
+}
+
+type blob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type fileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type functionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type functionResponse struct {
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+type tool struct {
+	FunctionDeclarations []functionDeclaration `json:"functionDeclarations"`
+}
+
+type functionDeclaration struct {
+	Name                 string          `json:"name"`
+	Description          string          `json:"description,omitempty"`
+	ParametersJSONSchema json.RawMessage `json:"parametersJsonSchema,omitempty"`
+}
+
+type generationConfig struct {
+	MaxOutputTokens int                     `json:"maxOutputTokens,omitempty"`
+	Temperature     *float32                `json:"temperature,omitempty"`
+	TopP            *float32                `json:"topP,omitempty"`
+	ThinkingConfig  *generationThinkingSpec `json:"thinkingConfig,omitempty"`
+}
+
+type generationThinkingSpec struct {
+	ThinkingBudget *int `json:"thinkingBudget,omitempty"`
+}
+
+type generateResponse struct {
+	Candidates []struct {
+		Content       content        `json:"content"`
+		FinishReason  string         `json:"finishReason"`
+		SafetyRatings []SafetyRating `json:"safetyRatings"`
+	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason   string         `json:"blockReason"`
+		SafetyRatings []SafetyRating `json:"safetyRatings"`
+	} `json:"promptFeedback,omitempty"`
+	UsageMetadata *struct {
+		PromptTokenCount        int `json:"promptTokenCount"`
+		CandidatesTokenCount    int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+		CachedContentTokenCount int `json:"cachedContentTokenCount"`
+		TotalTokenCount         int `json:"totalTokenCount"`
+	} `json:"usageMetadata,omitempty"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error,omitempty"`
+}
+
+// NewGeminiLLMProvider 创建 Gemini 提供者
+func NewGeminiLLMProvider(config map[string]interface{}) (*GeminiLLMProvider, error) {
+	var parsed geminiConfig
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("解析LLM配置失败: %v", err)
+	}
+	if err := json.Unmarshal(payload, &parsed); err != nil {
+		return nil, fmt.Errorf("解析LLM配置失败: %v", err)
+	}
+
+	apiKey := strings.TrimSpace(parsed.APIKey)
+	if apiKey == "" {
+		return nil, fmt.Errorf("gemini api_key不能为空")
+	}
+	// 兼容填写 models/gemini-xxx 的写法
+	modelName := strings.TrimPrefix(strings.TrimSpace(parsed.ModelName), "models/")
+	if modelName == "" {
+		return nil, fmt.Errorf("model_name不能为空")
+	}
+
+	baseURL := strings.TrimRight(strings.TrimSpace(parsed.BaseURL), "/")
+	if baseURL == "" {
+		baseURL = defaultGeminiBaseURL
+	}
+
+	maxTokens := defaultMaxTokens
+	if parsed.MaxTokens != nil && *parsed.MaxTokens > 0 {
+		maxTokens = *parsed.MaxTokens
+	}
+
+	var thinking thinkingConfig
+	if parsed.Thinking != nil {
+		thinking = thinkingConfig{
+			Mode:         strings.ToLower(strings.TrimSpace(parsed.Thinking.Mode)),
+			BudgetTokens: parsed.Thinking.BudgetTokens,
+		}
+	}
+
+	return &GeminiLLMProvider{
+		apiKey:         apiKey,
+		baseURL:        baseURL,
+		modelName:      modelName,
+		maxTokens:      maxTokens,
+		temperature:    parsed.Temperature,
+		topP:           parsed.TopP,
+		thinking:       thinking,
+		safetySettings: parsed.SafetySettings,
+		httpClient:     common.StreamHTTPClient(),
+	}, nil
+}
+
+// ResponseWithContext 流式请求 streamGenerateContent：文本逐段输出，函数调用逐条输出，
+// 结束时额外输出一条带 ResponseMeta（结束原因、用量）的空消息
+func (p *GeminiLLMProvider) ResponseWithContext(ctx context.Context, sessionID string, dialogue []*schema.Message, functions []*schema.ToolInfo) chan *schema.Message {
+	out := make(chan *schema.Message, 200)
+
+	go func() {
+		defer close(out)
+
+		reqBody, err := p.buildRequest(dialogue, functions)
+		if err != nil {
+			common.SendLLMError(out, err)
+			return
+		}
+		bodyBytes, err := json.Marshal(reqBody)
+		if err != nil {
+			common.SendLLMError(out, err)
+			return
+		}
+
+		url := fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse", p.baseURL, p.modelName)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(bodyBytes))
+		if err != nil {
+			common.SendLLMError(out, err)
+			return
+		}
+		req.Header.Set("x-goog-api-key", p.apiKey)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "text/event-stream")
+
+		resp, err := p.httpClient.Do(req)
+		if err != nil {
+			common.SendLLMError(out, fmt.Errorf("gemini请求失败: %w", err))
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			errBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+			common.SendLLMError(out, fmt.Errorf("gemini请求失败 status=%d body=%s", resp.StatusCode, strings.TrimSpace(string(errBody))))
+			return
+		}
+
+		p.readStream(ctx, sessionID, resp.Body, out)
+	}()
+
+	return out
+}
+
+func (p *GeminiLLMProvider) readStream(ctx context.Context, sessionID string, body io.Reader, out chan *schema.Message) {
+	var (
+		finishReason  string
+		safetyRatings []SafetyRating
+		usage         *schema.TokenUsage
+		hasOutput     bool
+		hasToolCalls  bool
+	)
+
+	for event, eventErr := range sse.Read(body, nil) {
+		if eventErr != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			common.SendLLMError(out, fmt.Errorf("gemini流读取失败: %w", eventErr))
+			return
+		}
+
+		data := strings.TrimSpace(event.Data)
+		if data == "" {
+			continue
+		}
+		var chunk generateResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			log.Warnf("解析gemini流事件失败: %v, data=%s", err, common.PreviewString(data, 256))
+			continue
+		}
+
+		if chunk.Error != nil {
+			common.SendLLMError(out, fmt.Errorf("gemini返回错误: %s: %s", chunk.Error.Status, chunk.Error.Message))
+			return
+		}
+		if chunk.PromptFeedback != nil && chunk.PromptFeedback.BlockReason != "" {
+			log.Warnf("[Gemini-LLM] SessionID: %s, 请求被拦截: %s, safety=%+v", sessionID, chunk.PromptFeedback.BlockReason, chunk.PromptFeedback.SafetyRatings)
+			common.SendLLMError(out, fmt.Errorf("gemini拦截了请求: %s", chunk.PromptFeedback.BlockReason))
+			return
+		}
+		if u := chunk.UsageMetadata; u != nil {
+			usage = &schema.TokenUsage{
+				PromptTokens:     u.PromptTokenCount,
+				CompletionTokens: u.CandidatesTokenCount + u.ThoughtsTokenCount,
+				TotalTokens:      u.TotalTokenCount,
+			}
+			if u.CachedContentTokenCount > 0 {
+				log.Debugf("[Gemini-LLM] SessionID: %s, cached_tokens=%d", sessionID, u.CachedContentTokenCount)
+			}
+		}
+		if len(chunk.Candidates) == 0 {
+			continue
+		}
+
+		candidate := chunk.Candidates[0]
+		if candidate.FinishReason != "" {
+			finishReason = candidate.FinishReason
+		}
+		if len(candidate.SafetyRatings) > 0 {
+			safetyRatings = candidate.SafetyRatings
+		}
+		for _, pt := range candidate.Content.Parts {
+			switch {
+			case pt.FunctionCall != nil:
+				call := toToolCall(pt.FunctionCall)
+				if pt.ThoughtSignature != "" {
+					signatureCache.Put(call.ID, pt.ThoughtSignature)
+				}
+				hasOutput, hasToolCalls = true, true
+				out <- &schema.Message{Role: schema.Assistant, ToolCalls: []schema.ToolCall{call}}
+			case pt.Thought:
+				// 思考摘要不参与播报
+			case pt.Text != "":
+				hasOutput = true
+				out <- &schema.Message{Role: schema.Assistant, Content: pt.Text}
+			}
+		}
+	}
+
+	reason := mapFinishReason(finishReason, hasToolCalls)
+	if reason == "content_filter" {
+		log.Warnf("[Gemini-LLM] SessionID: %s, 回复被安全策略拦截: %s, safety=%+v", sessionID, finishReason, safetyRatings)
+		if !hasOutput {
+			common.SendLLMError(out, fmt.Errorf("gemini拦截了回复: %s", finishReason))
+			return
+		}
+	}
+	if reason == "" && usage == nil {
+		return
+	}
+	final := &schema.Message{
+		Role:         schema.Assistant,
+		ResponseMeta: &schema.ResponseMeta{FinishReason: reason, Usage: usage},
+	}
+	if len(safetyRatings) > 0 {
+		final.Extra = map[string]any{SafetyRatingsExtraKey: safetyRatings}
+	}
+	out <- final
+}
+
+// mapFinishReason 转换为与 OpenAI 一致的结束原因
+func mapFinishReason(reason string, hasToolCalls bool) string {
+	switch reason {
+	case "":
+		return ""
+	case "STOP":
+		if hasToolCalls {
+			return "tool_calls"
+		}
+		return "stop"
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
+	default:
+		return strings.ToLower(reason)
+	}
+}
+
+func toToolCall(fc *functionCall) schema.ToolCall {
+	id := fc.ID
+	if id == "" {
+		// Gemini 通常不返回调用 ID，这里生成一个用于关联工具结果
+		id = "call_" + uuid.NewString()
+	}
+	args := strings.TrimSpace(string(fc.Args))
+	if args == "" || args == "null" {
+		args = "{}"
+	}
+	return schema.ToolCall{
+		ID:   id,
+		Type: "function",
+		Function: schema.FunctionCall{
+			Name:      fc.Name,
+			Arguments: args,
+		},
+	}
+}
+
+func (p *GeminiLLMProvider) buildRequest(dialogue []*schema.Message, functions []*schema.ToolInfo) (*generateRequest, error) {
+	system, contents := convertMessages(dialogue)
+	if len(contents) == 0 {
+		return nil, fmt.Errorf("gemini请求消息不能为空")
+	}
+	tools, err := convertTools(functions)
+	if err != nil {
+		return nil, err
+	}
+
+	genConfig := &generationConfig{
+		MaxOutputTokens: p.maxTokens,
+		Temperature:     p.temperature,
+		TopP:            p.topP,
+	}
+	switch p.thinking.Mode {
+	case "enabled":
+		if p.thinking.BudgetTokens != nil && *p.thinking.BudgetTokens > 0 {
+			genConfig.ThinkingConfig = &generationThinkingSpec{ThinkingBudget: p.thinking.BudgetTokens}
+		}
+	case "disabled":
+		zero := 0
+		genConfig.ThinkingConfig = &generationThinkingSpec{ThinkingBudget: &zero}
+	}
+
+	return &generateRequest{
+		SystemInstruction: system,
+		Contents:          contents,
+		Tools:             tools,
+		GenerationConfig:  genConfig,
+		SafetySettings:    p.safetySettings,
+	}, nil
+}
+
+// convertMessages 转换为 systemInstruction 和 user/model 交替的 contents：
+// 工具结果作为 user 角色的 functionResponse，相邻同角色消息合并
+func convertMessages(dialogue []*schema.Message) (*content, []content) {
+	var systemParts []part
+	var contents []content
+	// 工具结果只带调用 ID，functionResponse 需要函数名
+	toolNames := make(map[string]string)
+
+	appendParts := func(role string, parts []part) {
+		if len(parts) == 0 {
+			return
+		}
+		if n := len(contents); n > 0 && contents[n-1].Role == role {
+			contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+			return
+		}
+		contents = append(contents, content{Role: role, Parts: parts})
+	}
+
+	for _, msg := range dialogue {
+		if msg == nil {
+			continue
+		}
+		switch msg.Role {
+		case schema.System:
+			if text := strings.TrimSpace(msg.Content); text != "" {
+				systemParts = append(systemParts, part{Text: text})
+			}
+		case schema.User:
+			appendParts("user", userParts(msg))
+		case schema.Assistant:
+			var parts []part
+			if msg.Content != "" {
+				parts = append(parts, part{Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				toolNames[tc.ID] = tc.Function.Name
+				args := strings.TrimSpace(tc.Function.Arguments)
+				if args == "" || !json.Valid([]byte(args)) {
+					args = "{}"
+				}
+				parts = append(parts, part{
+					FunctionCall:     &functionCall{Name: tc.Function.Name, Args: json.RawMessage(args)},
+					ThoughtSignature: signatureCache.Get(tc.ID),
+				})
+			}
+			appendParts("model", parts)
+		case schema.Tool:
+			name := toolNames[msg.ToolCallID]
+			if name == "" {
+				name = msg.Name
+			}
+			appendParts("user", []part{{
+				FunctionResponse: &functionResponse{Name: name, Response: toolResponse(msg.Content)},
+			}})
+		}
+	}
+
+	var system *content
+	if len(systemParts) > 0 {
+		system = &content{Parts: systemParts}
+	}
+	return system, contents
+}
+
+// toolResponse functionResponse.response 必须是对象：JSON 对象原样传递，其它内容包装为 {"result": ...}
+func toolResponse(result string) json.RawMessage {
+	trimmed := strings.TrimSpace(result)
+	if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed)
+	}
+	wrapped, _ := json.Marshal(map[string]string{"result": result})
+	return wrapped
+}
+
+func userParts(msg *schema.Message) []part {
+	if len(msg.MultiContent) == 0 {
+		if msg.Content == "" {
+			return nil
+		}
+		return []part{{Text: msg.Content}}
+	}
+
+	parts := make([]part, 0, len(msg.MultiContent))
+	for _, mc := range msg.MultiContent {
+		switch mc.Type {
+		case schema.ChatMessagePartTypeText:
+			if mc.Text != "" {
+				parts = append(parts, part{Text: mc.Text})
+			}
+		case schema.ChatMessagePartTypeImageURL:
+			if mc.ImageURL == nil {
+				continue
+			}
+			if pt, ok := imagePart(mc.ImageURL.URL, mc.ImageURL.MIMEType); ok {
+				parts = append(parts, pt)
+			}
+		}
+	}
+	return parts
+}
+
+// imagePart data URL 转为 inlineData，其它地址按 fileData 传递
+func imagePart(raw, mimeType string) (part, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return part{}, false
+	}
+	if !strings.HasPrefix(raw, "data:") {
+		return part{FileData: &fileData{MimeType: mimeType, FileURI: raw}}, true
+	}
+	meta, data, ok := strings.Cut(strings.TrimPrefix(raw, "data:"), ",")
+	if !ok || !strings.HasSuffix(meta, ";base64") {
+		return part{}, false
+	}
+	return part{InlineData: &blob{MimeType: strings.TrimSuffix(meta, ";base64"), Data: data}}, true
+}
+
+func convertTools(functions []*schema.ToolInfo) ([]tool, error) {
+	declarations := make([]functionDeclaration, 0, len(functions))
+	for _, fn := range functions {
+		if fn == nil || fn.Name == "" {
+			continue
+		}
+		decl := functionDeclaration{Name: fn.Name, Description: fn.Desc}
+		if fn.ParamsOneOf != nil {
+			openAPISchema, err := fn.ParamsOneOf.ToOpenAPIV3()
+			if err != nil {
+				return nil, fmt.Errorf("转换工具 %s 参数失败: %v", fn.Name, err)
+			}
+			if openAPISchema != nil {
+				raw, err := json.Marshal(openAPISchema)
+				if err != nil {
+					return nil, fmt.Errorf("转换工具 %s 参数失败: %v", fn.Name, err)
+				}
+				decl.ParametersJSONSchema = raw
+			}
+		}
+		declarations = append(declarations, decl)
+	}
+	if len(declarations) == 0 {
+		return nil, nil
+	}
+	return []tool{{FunctionDeclarations: declarations}}, nil
+}
+
+// ResponseWithVllm 图片识别，图片以 inlineData 随问题一起发送
+func (p *GeminiLLMProvider) ResponseWithVllm(ctx context.Context, file []byte, text string, mimeType string) (string, error) {
+	log.Infof("[Gemini-LLM] 开始进行VLLM请求 - MIMEType: %s, file length: %d", mimeType, len(file))
+	return common.CollectText(ctx, p.ResponseWithContext(ctx, "", common.VisionDialogue(file, text, mimeType), nil))
+}
+
+func (p *GeminiLLMProvider) GetModelInfo() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "gemini",
+		"provider":   "gemini",
+		"model_name": p.modelName,
+		"base_url":   p.baseURL,
+		"max_tokens": p.maxTokens,
+	}
+}
+
+func (p *GeminiLLMProvider) Close() error {
+	return nil
+}
+
+func (p *GeminiLLMProvider) IsValid() bool {
+	return p != nil && p.apiKey != "" && p.baseURL != "" && p.modelName != ""
+}
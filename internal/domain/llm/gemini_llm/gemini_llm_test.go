@@ -0,0 +1,250 @@
+package gemini_llm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"xiaozhi-esp32-server-golang/internal/domain/llm/common"
+	"xiaozhi-esp32-server-golang/internal/domain/llm/common/llmtest"
+)
+
+// newStandIn 启动一个模拟 streamGenerateContent 的 SSE 服务，记录收到的请求体；Gemini 以 CRLF 分隔事件
+func newStandIn(t *testing.T, chunks []string, captured *map[string]interface{}) *httptest.Server {
+	events := make([]llmtest.Event, 0, len(chunks))
+	for _, chunk := range chunks {
+		events = append(events, llmtest.Event{Data: chunk})
+	}
+	return llmtest.StandIn{
+		Check: func(t *testing.T, r *http.Request) {
+			assert.Equal(t, "/v1beta/models/gemini-test:streamGenerateContent", r.URL.Path)
+			assert.Equal(t, "sse", r.URL.Query().Get("alt"))
+			assert.Equal(t, llmtest.APIKey, r.Header.Get("x-goog-api-key"))
+		},
+		Captured: captured,
+		Newline:  "\r\n",
+	}.Start(t, events)
+}
+
+func newTestProvider(t *testing.T, baseURL string, extra map[string]interface{}) *GeminiLLMProvider {
+	t.Helper()
+	provider, err := NewGeminiLLMProvider(llmtest.Config(baseURL+"/v1beta/", "models/gemini-test", extra))
+	require.NoError(t, err)
+	return provider
+}
+
+func TestNewGeminiLLMProvider(t *testing.T) {
+	_, err := NewGeminiLLMProvider(map[string]interface{}{"model_name": "gemini-test"})
+	assert.Error(t, err)
+
+	_, err = NewGeminiLLMProvider(map[string]interface{}{"api_key": "test-key"})
+	assert.Error(t, err)
+
+	provider, err := NewGeminiLLMProvider(map[string]interface{}{
+		"api_key":    "test-key",
+		"model_name": "gemini-2.5-flash",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, defaultGeminiBaseURL, provider.baseURL)
+	assert.Equal(t, defaultMaxTokens, provider.maxTokens)
+	assert.True(t, provider.IsValid())
+}
+
+func TestResponseWithContextStreamsTextAndUsage(t *testing.T) {
+	server := newStandIn(t, []string{
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"先想想","thought":true}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"你好"}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"，世界"}]},"finishReason":"STOP","safetyRatings":[{"category":"HARM_CATEGORY_HARASSMENT","probability":"NEGLIGIBLE"}]}],"usageMetadata":{"promptTokenCount":12,"candidatesTokenCount":4,"thoughtsTokenCount":3,"totalTokenCount":19}}`,
+	}, nil)
+
+	provider := newTestProvider(t, server.URL, nil)
+	msgs := llmtest.Collect(provider.ResponseWithContext(context.Background(), "s1", []*schema.Message{
+		schema.UserMessage("你好"),
+	}, nil))
+
+	require.Len(t, msgs, 3)
+	assert.Equal(t, "你好", msgs[0].Content)
+	assert.Equal(t, "，世界", msgs[1].Content)
+
+	final := msgs[2]
+	assert.Empty(t, final.Content)
+	require.NotNil(t, final.ResponseMeta)
+	assert.Equal(t, "stop", final.ResponseMeta.FinishReason)
+	assert.Equal(t, &schema.TokenUsage{PromptTokens: 12, CompletionTokens: 7, TotalTokens: 19}, final.ResponseMeta.Usage)
+	ratings, ok := final.Extra[SafetyRatingsExtraKey].([]SafetyRating)
+	require.True(t, ok)
+	assert.Equal(t, "HARM_CATEGORY_HARASSMENT", ratings[0].Category)
+}
+
+func TestResponseWithContextFunctionCalls(t *testing.T) {
+	server := newStandIn(t, []string{
+		`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"北京"}},"thoughtSignature":"sig-1"},{"functionCall":{"name":"get_time"}}]},"finishReason":"STOP"}]}`,
+	}, nil)
+
+	provider := newTestProvider(t, server.URL, nil)
+	msgs := llmtest.Collect(provider.ResponseWithContext(context.Background(), "s1", []*schema.Message{
+		schema.UserMessage("北京天气和时间"),
+	}, nil))
+
+	require.Len(t, msgs, 3)
+	weather := msgs[0].ToolCalls[0]
+	assert.True(t, strings.HasPrefix(weather.ID, "call_"))
+	assert.Equal(t, "get_weather", weather.Function.Name)
+	assert.JSONEq(t, `{"city":"北京"}`, weather.Function.Arguments)
+	assert.Equal(t, "{}", msgs[1].ToolCalls[0].Function.Arguments)
+	assert.NotEqual(t, weather.ID, msgs[1].ToolCalls[0].ID)
+	assert.Equal(t, "tool_calls", msgs[2].ResponseMeta.FinishReason)
+
+	// 下一轮请求带回思考签名，工具结果按函数名回填
+	req, err := provider.buildRequest([]*schema.Message{
+		schema.UserMessage("北京天气和时间"),
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{weather, msgs[1].ToolCalls[0]}},
+		schema.ToolMessage(`{"weather":"晴"}`, weather.ID),
+		schema.ToolMessage("10点", msgs[1].ToolCalls[0].ID),
+	}, nil)
+	require.NoError(t, err)
+	require.Len(t, req.Contents, 3)
+	modelParts := req.Contents[1].Parts
+	assert.Equal(t, "model", req.Contents[1].Role)
+	assert.Equal(t, "sig-1", modelParts[0].ThoughtSignature)
+	assert.Empty(t, modelParts[1].ThoughtSignature)
+
+	responses := req.Contents[2].Parts
+	assert.Equal(t, "user", req.Contents[2].Role)
+	require.Len(t, responses, 2)
+	assert.Equal(t, "get_weather", responses[0].FunctionResponse.Name)
+	assert.JSONEq(t, `{"weather":"晴"}`, string(responses[0].FunctionResponse.Response))
+	assert.Equal(t, "get_time", responses[1].FunctionResponse.Name)
+	assert.JSONEq(t, `{"result":"10点"}`, string(responses[1].FunctionResponse.Response))
+}
+
+func TestResponseWithContextRequestConversion(t *testing.T) {
+	var captured map[string]interface{}
+	server := newStandIn(t, []string{
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"好的"}]},"finishReason":"STOP"}]}`,
+	}, &captured)
+
+	budget := 1024
+	provider := newTestProvider(t, server.URL, map[string]interface{}{
+		"max_tokens":      800,
+		"temperature":     0.5,
+		"thinking":        map[string]interface{}{"mode": "enabled", "budget_tokens": budget},
+		"safety_settings": []map[string]string{{"category": "HARM_CATEGORY_HARASSMENT", "threshold": "BLOCK_ONLY_HIGH"}},
+	})
+	tools := []*schema.ToolInfo{
+		{
+			Name: "get_weather",
+			Desc: "查询天气",
+			ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+				"city": {Type: schema.String, Desc: "城市", Required: true},
+			}),
+		},
+		{Name: "get_time", Desc: "查询时间"},
+	}
+	llmtest.Collect(provider.ResponseWithContext(context.Background(), "s1", []*schema.Message{
+		schema.SystemMessage("你是小智"),
+		schema.UserMessage("你好"),
+		schema.AssistantMessage("你好呀", nil),
+		schema.UserMessage("讲个笑话"),
+	}, tools))
+	require.NotNil(t, captured)
+
+	system := captured["systemInstruction"].(map[string]interface{})
+	assert.Equal(t, "你是小智", system["parts"].([]interface{})[0].(map[string]interface{})["text"])
+
+	contents := captured["contents"].([]interface{})
+	require.Len(t, contents, 3)
+	assert.Equal(t, "user", contents[0].(map[string]interface{})["role"])
+	assert.Equal(t, "model", contents[1].(map[string]interface{})["role"])
+
+	genConfig := captured["generationConfig"].(map[string]interface{})
+	assert.Equal(t, float64(800), genConfig["maxOutputTokens"])
+	assert.Equal(t, 0.5, genConfig["temperature"])
+	assert.Equal(t, map[string]interface{}{"thinkingBudget": float64(1024)}, genConfig["thinkingConfig"])
+
+	safety := captured["safetySettings"].([]interface{})
+	assert.Equal(t, "BLOCK_ONLY_HIGH", safety[0].(map[string]interface{})["threshold"])
+
+	declarations := captured["tools"].([]interface{})[0].(map[string]interface{})["functionDeclarations"].([]interface{})
+	require.Len(t, declarations, 2)
+	weather := declarations[0].(map[string]interface{})
+	assert.Equal(t, "get_weather", weather["name"])
+	params := weather["parametersJsonSchema"].(map[string]interface{})
+	assert.Equal(t, "object", params["type"])
+	assert.Contains(t, params["properties"], "city")
+	assert.Nil(t, declarations[1].(map[string]interface{})["parametersJsonSchema"])
+}
+
+func TestResponseWithContextSafetyBlocks(t *testing.T) {
+	server := newStandIn(t, []string{
+		`{"promptFeedback":{"blockReason":"SAFETY","safetyRatings":[{"category":"HARM_CATEGORY_DANGEROUS_CONTENT","probability":"HIGH","blocked":true}]}}`,
+	}, nil)
+	provider := newTestProvider(t, server.URL, nil)
+	msgs := llmtest.Collect(provider.ResponseWithContext(context.Background(), "s1", []*schema.Message{schema.UserMessage("你好")}, nil))
+	require.Len(t, msgs, 1)
+	errMsg, _ := msgs[0].Extra[common.LLMExtraErrorKey].(string)
+	assert.Contains(t, errMsg, "SAFETY")
+
+	server = newStandIn(t, []string{
+		`{"candidates":[{"finishReason":"SAFETY","safetyRatings":[{"category":"HARM_CATEGORY_HARASSMENT","probability":"HIGH","blocked":true}]}]}`,
+	}, nil)
+	provider = newTestProvider(t, server.URL, nil)
+	msgs = llmtest.Collect(provider.ResponseWithContext(context.Background(), "s1", []*schema.Message{schema.UserMessage("你好")}, nil))
+	require.Len(t, msgs, 1)
+	errMsg, _ = msgs[0].Extra[common.LLMExtraErrorKey].(string)
+	assert.Contains(t, errMsg, "SAFETY")
+}
+
+func TestResponseWithContextHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"code":400,"message":"API key not valid","status":"INVALID_ARGUMENT"}}`))
+	}))
+	defer server.Close()
+
+	provider := newTestProvider(t, server.URL, nil)
+	msgs := llmtest.Collect(provider.ResponseWithContext(context.Background(), "s1", []*schema.Message{schema.UserMessage("你好")}, nil))
+	require.Len(t, msgs, 1)
+	errMsg, _ := msgs[0].Extra[common.LLMExtraErrorKey].(string)
+	assert.Contains(t, errMsg, "status=400")
+}
+
+func TestResponseWithVllm(t *testing.T) {
+	var captured map[string]interface{}
+	server := newStandIn(t, []string{
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"一只猫"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":300,"candidatesTokenCount":3,"totalTokenCount":303}}`,
+	}, &captured)
+
+	provider := newTestProvider(t, server.URL, nil)
+	result, err := provider.ResponseWithVllm(context.Background(), []byte("fake-jpeg"), "图里是什么", "image/jpeg")
+	require.NoError(t, err)
+	assert.Equal(t, "一只猫", result)
+
+	contents := captured["contents"].([]interface{})
+	require.Len(t, contents, 1)
+	parts := contents[0].(map[string]interface{})["parts"].([]interface{})
+	require.Len(t, parts, 2)
+	inline := parts[0].(map[string]interface{})["inlineData"].(map[string]interface{})
+	assert.Equal(t, "image/jpeg", inline["mimeType"])
+	assert.Equal(t, "ZmFrZS1qcGVn", inline["data"])
+	assert.Equal(t, "图里是什么", parts[1].(map[string]interface{})["text"])
+}
+
+func TestImagePart(t *testing.T) {
+	pt, ok := imagePart("https://example.com/a.png", "image/png")
+	require.True(t, ok)
+	assert.Equal(t, &fileData{MimeType: "image/png", FileURI: "https://example.com/a.png"}, pt.FileData)
+
+	pt, ok = imagePart("data:image/png;base64,AAAA", "")
+	require.True(t, ok)
+	assert.Equal(t, &blob{MimeType: "image/png", Data: "AAAA"}, pt.InlineData)
+
+	_, ok = imagePart("data:image/png,AAAA", "")
+	assert.False(t, ok)
+}
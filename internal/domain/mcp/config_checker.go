@@ -3,6 +3,7 @@ package mcp
 import (
 	"fmt"
 	"net/url"
+	"os"
 	"strings"
 
 	log "xiaozhi-esp32-server-golang/logger"
@@ -61,6 +62,13 @@ func CheckMCPConfig() {
 			status = "❌"
 			issues = append(issues, err.Error())
 			problemCount++
+		} else if transportType == "stdio" {
+			if strings.TrimSpace(config.WorkDir) != "" {
+				if info, statErr := os.Stat(config.WorkDir); statErr != nil || !info.IsDir() {
+					status = "⚠️"
+					issues = append(issues, "工作目录不存在")
+				}
+			}
 		} else {
 			if _, parseErr := url.ParseRequestURI(endpoint); parseErr != nil {
 				status = "❌"
@@ -32,6 +32,7 @@ func (dcs *DeviceMcpSession) AddWsEndPointMcp(mcpClient *McpClientInstance) {
 	mcpClient.SetOnCloseHandler(dcs.handleMcpClientClose)
 
 	mcpClient.refreshTools()
+	mcpClient.catalog.refresh(mcpClient.Ctx, mcpClient.mcpClient, mcpClient.serverName)
 }
 
 // todo
@@ -48,6 +49,7 @@ func (dcs *DeviceMcpSession) SetIotOverMcp(mcpClient *McpClientInstance) {
 	mcpClient.SetOnCloseHandler(dcs.handleMcpClientClose)
 
 	mcpClient.refreshTools()
+	mcpClient.catalog.refresh(mcpClient.Ctx, mcpClient.mcpClient, mcpClient.serverName)
 }
 
 func (dcs *DeviceMcpSession) RemoveWsEndPointMcp(mcpClient *McpClientInstance) {
@@ -88,6 +90,8 @@ type McpClientInstance struct {
 
 	// 添加关闭回调
 	onCloseHandler func(instance *McpClientInstance, reason string)
+
+	catalog mcpCatalog // 上报的资源与提示词
 }
 
 // NewDeviceMCPClient 创建新的MCP客户端
@@ -273,8 +277,8 @@ func (dc *McpClientInstance) handleJSONRPCNotification(notification mcp.JSONRPCN
 		//handleProgressNotification(notification)
 	case "notifications/message":
 		//handleMessageNotification(notification)
-	case "notifications/resources/updated":
-		//handleResourceUpdateNotification(notification)
+	case mcp.MethodNotificationResourceUpdated, mcp.MethodNotificationResourcesListChanged, mcp.MethodNotificationPromptsListChanged:
+		handleCatalogNotification(dc.serverName, dc.mcpClient, &dc.catalog, notification)
 	case "notifications/tools/updated":
 		// 收到工具更新通知，刷新工具列表
 		logger.Infof("收到工具更新通知，刷新工具列表")
@@ -303,6 +307,7 @@ func (dc *McpClientInstance) handleTransportClose(reason string) {
 
 	// 标记连接已断开
 	dc.connected = false
+	pinnedResources.dropSource(dc.serverName)
 
 	// 取消上下文
 	dc.cancel()
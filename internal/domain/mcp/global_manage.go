@@ -32,6 +32,13 @@ type MCPServerConfig struct {
 	AuthRef      string            `json:"auth_ref,omitempty" mapstructure:"auth_ref"`
 	Headers      map[string]string `json:"headers,omitempty" mapstructure:"headers"`
 	AllowedTools []string          `json:"allowed_tools,omitempty" mapstructure:"allowed_tools"`
+
+	// stdio 类型：以子进程方式启动本地 MCP 服务器
+	Command string            `json:"command,omitempty" mapstructure:"command"`
+	Args    []string          `json:"args,omitempty" mapstructure:"args"`
+	Env     map[string]string `json:"env,omitempty" mapstructure:"env"`
+	WorkDir string            `json:"work_dir,omitempty" mapstructure:"work_dir"`
+	Limits  StdioLimits       `json:"limits,omitempty" mapstructure:"limits"`
 }
 
 // GlobalMCPManager 全局MCP管理器
@@ -61,6 +68,12 @@ type MCPServerConnection struct {
 	lastError  error
 	retryCount int
 	lastPing   time.Time
+
+	stdio        *stdioTransport // stdio 类型当前的子进程传输
+	restartCount int             // stdio 进程连续异常退出次数，用于重启退避
+	restarting   bool            // stdio 重启循环是否在运行，避免重复启动
+
+	catalog mcpCatalog // 服务器上报的资源与提示词
 }
 
 var (
@@ -211,15 +224,20 @@ func (g *GlobalMCPManager) connectToServer(config MCPServerConfig) error {
 
 	// 连接到服务器
 	if err := conn.connect(); err != nil {
+		// stdio 进程首次启动失败（如初始化前退出）同样按退避策略重启
+		if conn.isStdio() {
+			go g.restartStdio(conn)
+		}
 		return fmt.Errorf("连接MCP服务器失败: %v", err)
 	}
+	g.superviseIfStdio(conn)
 
 	log.Infof("已连接到MCP服务器: %s", config.Name)
 	return nil
 }
 
 // connect 连接到MCP服务器
-func (conn *MCPServerConnection) connect() error {
+func (conn *MCPServerConnection) connect() (err error) {
 	// 使用背景上下文，不设置超时，让SSE连接长期保持
 	ctx := context.Background()
 
@@ -230,13 +248,34 @@ func (conn *MCPServerConnection) connect() error {
 
 	// 使用 client.NewClient 创建 MCP 客户端
 	mcpClient := client.NewClient(transportInstance)
+	mcpClient.OnNotification(func(notification mcp.JSONRPCNotification) {
+		handleCatalogNotification(conn.config.Name, mcpClient, &conn.catalog, notification)
+	})
 
 	conn.client = mcpClient
 
+	// stdio 子进程在初始化失败时必须回收，否则会残留进程
+	stdio, isStdio := transportInstance.(*stdioTransport)
+	if isStdio {
+		conn.mu.Lock()
+		conn.stdio = stdio
+		conn.mu.Unlock()
+		defer func() {
+			if err != nil {
+				stdio.Close()
+				conn.mu.Lock()
+				if conn.stdio == stdio {
+					conn.stdio = nil
+				}
+				conn.mu.Unlock()
+			}
+		}()
+	}
+
 	log.Infof("开始连接MCP服务器: %s, %s URL: %s", conn.config.Name, conn.config.Type, endpoint)
 
 	// 启动客户端
-	if err := conn.client.Start(ctx); err != nil {
+	if err = conn.client.Start(ctx); err != nil {
 		log.Errorf("启动MCP客户端失败，服务器: %s, 错误: %v", conn.config.Name, err)
 		return fmt.Errorf("启动客户端失败: %v", err)
 	}
@@ -258,7 +297,8 @@ func (conn *MCPServerConnection) connect() error {
 	}
 
 	log.Infof("正在初始化MCP服务器: %s", conn.config.Name)
-	initResult, err := conn.client.Initialize(ctx, initRequest)
+	var initResult *mcp.InitializeResult
+	initResult, err = conn.client.Initialize(ctx, initRequest)
 	if err != nil {
 		log.Errorf("初始化MCP服务器失败，服务器: %s, 错误: %v", conn.config.Name, err)
 		return fmt.Errorf("初始化失败: %v", err)
@@ -271,6 +311,9 @@ func (conn *MCPServerConnection) connect() error {
 		log.Errorf("获取工具列表失败: %v", err)
 		// 不直接返回错误，因为工具列表获取失败不应该阻止连接建立
 	}
+	// 新连接上没有旧的资源订阅，缓存需要重新读取
+	pinnedResources.dropSource(conn.config.Name)
+	conn.catalog.refresh(ctx, conn.client, conn.config.Name)
 
 	conn.mu.Lock()
 	conn.connected = true
@@ -282,10 +325,117 @@ func (conn *MCPServerConnection) connect() error {
 	return nil
 }
 
+// superviseStdio 监督 stdio 子进程：异常退出后按退避策略重启，
+// 连续重启次数超过 max_reconnect_attempts 后放弃；主动关闭（停止、重连）时不重启
+func (g *GlobalMCPManager) superviseStdio(conn *MCPServerConnection, stdio *stdioTransport) {
+	select {
+	case <-g.ctx.Done():
+		return
+	case <-stdio.Exited():
+	}
+	exitErr, uptime, closing := stdio.exitInfo()
+	if closing {
+		return
+	}
+	name := conn.config.Name
+	log.Warnf("MCP服务器 %s 进程异常退出（运行 %s）: %v", name, uptime.Round(time.Second), exitErr)
+
+	conn.mu.Lock()
+	conn.connected = false
+	conn.lastError = fmt.Errorf("进程退出: %v", exitErr)
+	if uptime >= stdioStableUptime {
+		conn.restartCount = 0
+	}
+	conn.mu.Unlock()
+	g.updateGlobalTools(name, nil)
+
+	g.restartStdio(conn)
+}
+
+// isStdio 判断连接是否为 stdio 类型
+func (conn *MCPServerConnection) isStdio() bool {
+	transportType, _, _ := endpointForConfig(conn.config)
+	return transportType == "stdio"
+}
+
+// restartStdio 按退避策略重启 stdio 服务器，直到成功、超过 max_reconnect_attempts 或服务器被移除；
+// 同一连接同时只运行一个重启循环，重启成功后交给新的 superviseStdio 继续监督
+func (g *GlobalMCPManager) restartStdio(conn *MCPServerConnection) {
+	name := conn.config.Name
+	conn.mu.Lock()
+	if conn.restarting {
+		conn.mu.Unlock()
+		return
+	}
+	conn.restarting = true
+	conn.mu.Unlock()
+	finish := func() {
+		conn.mu.Lock()
+		conn.restarting = false
+		conn.mu.Unlock()
+	}
+
+	for {
+		conn.mu.Lock()
+		conn.restartCount++
+		attempt := conn.restartCount
+		conn.mu.Unlock()
+
+		if g.reconnectConf.MaxAttempts > 0 && attempt > g.reconnectConf.MaxAttempts {
+			log.Errorf("MCP服务器 %s 已连续重启 %d 次仍失败，停止重启", name, g.reconnectConf.MaxAttempts)
+			finish()
+			return
+		}
+		delay := stdioRestartDelay(g.reconnectConf.Interval, attempt)
+		log.Infof("MCP服务器 %s 将在 %s 后第 %d 次重启", name, delay, attempt)
+		select {
+		case <-g.ctx.Done():
+			finish()
+			return
+		case <-time.After(delay):
+		}
+
+		// 期间服务器被移除或替换（热更）时不再重启
+		g.mu.RLock()
+		current := g.servers[name]
+		g.mu.RUnlock()
+		if current != conn {
+			finish()
+			return
+		}
+
+		conn.disconnect()
+		if err := conn.connect(); err != nil {
+			log.Errorf("MCP服务器 %s 重启失败: %v", name, err)
+			conn.mu.Lock()
+			conn.lastError = err
+			conn.mu.Unlock()
+			continue
+		}
+		log.Infof("MCP服务器 %s 已重启", name)
+		// 先结束本循环再启动监督，进程立即再次退出时监督协程才能重新进入重启循环
+		finish()
+		g.superviseIfStdio(conn)
+		return
+	}
+}
+
+// superviseIfStdio 连接成功后为 stdio 服务器启动进程监督
+func (g *GlobalMCPManager) superviseIfStdio(conn *MCPServerConnection) {
+	conn.mu.RLock()
+	stdio := conn.stdio
+	conn.mu.RUnlock()
+	if stdio != nil {
+		go g.superviseStdio(conn, stdio)
+	}
+}
+
 func normalizeMCPTransportType(t string) string {
 	switch strings.ToLower(strings.TrimSpace(t)) {
 	case "sse":
 		return "sse"
+	case "stdio":
+		return "stdio"
 	case "streamable_http", "streamable-http", "http":
 		return "streamablehttp"
 	default:
@@ -300,6 +450,8 @@ func endpointForConfig(config MCPServerConfig) (string, string, error) {
 			transportType = "sse"
 		} else if strings.TrimSpace(config.Url) != "" {
 			transportType = "streamablehttp"
+		} else if strings.TrimSpace(config.Command) != "" {
+			transportType = "stdio"
 		}
 	}
 
@@ -320,6 +472,11 @@ func endpointForConfig(config MCPServerConfig) (string, string, error) {
 			return transportType, strings.TrimSpace(config.SSEUrl), nil
 		}
 		return "", "", fmt.Errorf("MCP服务器 %s 缺少StreamableHTTP URL", config.Name)
+	case "stdio":
+		if strings.TrimSpace(config.Command) == "" {
+			return "", "", fmt.Errorf("MCP服务器 %s 缺少启动命令", config.Name)
+		}
+		return transportType, stdioCommandLine(config), nil
 	default:
 		return "", "", fmt.Errorf("MCP服务器 %s 类型不支持: %s", config.Name, config.Type)
 	}
@@ -338,6 +495,11 @@ func buildMCPTransport(config MCPServerConfig) (transport.Interface, string, err
 		}
 		headers[strings.TrimSpace(k)] = v
 	}
+	// auth_ref=oauth：每次请求前从 manager 获取访问令牌，令牌刷新无需重建连接
+	var oauthHeaders transport.HTTPHeaderFunc
+	if strings.EqualFold(strings.TrimSpace(config.AuthRef), authRefOAuth) {
+		oauthHeaders = newOAuthTokenSource(config.Name).headers
+	}
 
 	switch transportType {
 	case "sse":
@@ -345,6 +507,9 @@ func buildMCPTransport(config MCPServerConfig) (transport.Interface, string, err
 		if len(headers) > 0 {
 			opts = append(opts, transport.WithHeaders(headers))
 		}
+		if oauthHeaders != nil {
+			opts = append(opts, transport.WithHeaderFunc(oauthHeaders))
+		}
 		sseTransport, err := transport.NewSSE(endpoint, opts...)
 		if err != nil {
 			return nil, "", fmt.Errorf("创建SSE传输层失败: %v", err)
@@ -355,11 +520,16 @@ func buildMCPTransport(config MCPServerConfig) (transport.Interface, string, err
 		if len(headers) > 0 {
 			opts = append(opts, transport.WithHTTPHeaders(headers))
 		}
+		if oauthHeaders != nil {
+			opts = append(opts, transport.WithHTTPHeaderFunc(oauthHeaders))
+		}
 		httpTransport, err := transport.NewStreamableHTTP(endpoint, opts...)
 		if err != nil {
 			return nil, "", fmt.Errorf("创建StreamableHTTP传输层失败: %v", err)
 		}
 		return httpTransport, endpoint, nil
+	case "stdio":
+		return newStdioTransport(config), endpoint, nil
 	default:
 		return nil, "", fmt.Errorf("不支持的MCP传输类型: %s", transportType)
 	}
@@ -463,9 +633,12 @@ func (conn *MCPServerConnection) disconnect() error {
 		}
 		conn.client = nil
 	}
+	conn.stdio = nil
 
 	conn.connected = false
 	conn.tools = make(map[string]tool.InvokableTool)
+	conn.catalog.reset()
+	pinnedResources.dropSource(conn.config.Name)
 
 	return nil
 }
@@ -542,6 +715,18 @@ func (g *GlobalMCPManager) monitorConnections() {
 					defer cancel()
 
 					if err := conn.ping(ctx); err != nil {
+						// stdio 由 superviseStdio / restartStdio 负责重启：仍在运行但无响应的进程结束掉触发重启，
+						// 已退出或启动失败的由重启循环按退避处理，这里不再重连
+						if conn.isStdio() {
+							conn.mu.RLock()
+							stdio := conn.stdio
+							conn.mu.RUnlock()
+							if stdio != nil {
+								log.Warnf("MCP服务器 %s ping失败，结束进程后由监督协程重启: %v", name, err)
+								stdio.kill()
+							}
+							return
+						}
 						log.Warnf("MCP服务器 %s ping失败，开始重连: %v", name, err)
 						// ping失败时直接标记为断开并触发重连
 						conn.mu.Lock()
@@ -577,6 +762,14 @@ func (g *GlobalMCPManager) reconnectServer(serverName string) (*client.Client, e
 		return nil, fmt.Errorf("未找到服务器连接: %s", serverName)
 	}
 
+	// stdio 重启循环正在运行时交由它处理，避免并发启动两个进程
+	conn.mu.RLock()
+	restarting := conn.restarting
+	conn.mu.RUnlock()
+	if restarting {
+		return nil, fmt.Errorf("MCP服务器 %s 正在重启", serverName)
+	}
+
 	// 断开连接
 	if err := conn.disconnect(); err != nil {
 		log.Errorf("断开连接失败: %v", err)
@@ -587,8 +780,12 @@ func (g *GlobalMCPManager) reconnectServer(serverName string) (*client.Client, e
 
 	// 重新连接
 	if err := conn.connect(); err != nil {
+		if conn.isStdio() {
+			go g.restartStdio(conn)
+		}
 		return nil, fmt.Errorf("重连失败: %v", err)
 	}
+	g.superviseIfStdio(conn)
 
 	return conn.client, nil
 }
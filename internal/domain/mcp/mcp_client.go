@@ -9,6 +9,13 @@ import (
 	mcp_go "github.com/mark3labs/mcp-go/mcp"
 )
 
+// 工具来源，用于日志与链路追踪区分本地/全局/设备 MCP 工具
+const (
+	ToolSourceLocal  = "local"
+	ToolSourceGlobal = "global"
+	ToolSourceDevice = "device"
+)
+
 func parseSelectedMCPServiceNames(raw string) map[string]struct{} {
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
@@ -61,11 +68,17 @@ func filterGlobalToolsBySelectedServices(globalTools map[string]tool.InvokableTo
 }
 
 func GetToolByName(deviceId string, agentId string, toolName string, selectedMCPServiceNames string) (tool.InvokableTool, bool) {
+	invokable, _, ok := GetToolWithSource(deviceId, agentId, toolName, selectedMCPServiceNames)
+	return invokable, ok
+}
+
+// GetToolWithSource 与 GetToolByName 查找顺序一致，同时返回工具来源（local/global/device）
+func GetToolWithSource(deviceId string, agentId string, toolName string, selectedMCPServiceNames string) (tool.InvokableTool, string, bool) {
 	// 优先从本地管理器获取
 	localManager := GetLocalMCPManager()
 	tool, ok := localManager.GetToolByName(toolName)
 	if ok {
-		return tool, ok
+		return tool, ToolSourceLocal, ok
 	}
 
 	// 其次从全局管理器获取
@@ -73,20 +86,20 @@ func GetToolByName(deviceId string, agentId string, toolName string, selectedMCP
 	if len(selected) == 0 {
 		tool, ok = globalManager.GetToolByName(toolName)
 		if ok {
-			return tool, ok
+			return tool, ToolSourceGlobal, ok
 		}
 	} else {
 		globalTools := globalManager.GetAllTools()
 
 		// 兼容直接传入 "server_tool" 的场景
 		if invokable, exists := globalTools[toolName]; exists && isGlobalToolAllowed(toolName, selected) {
-			return invokable, true
+			return invokable, ToolSourceGlobal, true
 		}
 
 		for serviceName := range selected {
 			candidate := serviceName + "_" + toolName
 			if invokable, exists := globalTools[candidate]; exists {
-				return invokable, true
+				return invokable, ToolSourceGlobal, true
 			}
 		}
 	}
@@ -94,16 +107,16 @@ func GetToolByName(deviceId string, agentId string, toolName string, selectedMCP
 	// 最后从设备MCP客户端池获取
 	tool, ok = mcpClientPool.GetToolByDeviceId(deviceId, toolName)
 	if ok {
-		return tool, true
+		return tool, ToolSourceDevice, true
 	}
 	// 兼容 AgentID 上报的 MCP 工具
 	if agentId != "" && agentId != deviceId {
 		tool, ok = mcpClientPool.GetToolByDeviceId(agentId, toolName)
 		if ok {
-			return tool, true
+			return tool, ToolSourceDevice, true
 		}
 	}
-	return nil, false
+	return nil, "", false
 }
 
 func GetDeviceMcpClient(deviceId string) *DeviceMcpSession {
@@ -0,0 +1,125 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	httpclient "xiaozhi-esp32-server-golang/internal/components/http"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const (
+	// authRefOAuth auth_ref 取该值时，访问令牌由 manager 完成 OAuth 授权后托管，按服务器名称获取
+	authRefOAuth = "oauth"
+	// oauthTokenRefreshSkew 令牌到期前多久重新向 manager 获取
+	oauthTokenRefreshSkew = 30 * time.Second
+	// oauthTokenMaxCache 未返回到期时间的令牌最长缓存时间
+	oauthTokenMaxCache = 5 * time.Minute
+	// oauthInternalSecretHeader 获取令牌时携带 manager.internal_secret，与 manager 的 server.internal_secret 对应
+	oauthInternalSecretHeader = "X-Internal-Secret"
+)
+
+// oauthTokenSource 从 manager 获取 OAuth 访问令牌并缓存到临近到期，刷新由 manager 负责
+type oauthTokenSource struct {
+	serverName     string
+	client         *httpclient.ManagerClient
+	internalSecret string
+
+	mu            sync.Mutex
+	authorization string
+	expiresAt     time.Time
+}
+
+func newOAuthTokenSource(serverName string) *oauthTokenSource {
+	// 与 util.GetBackendURL 相同的取值顺序；util 包依赖音频编解码库，这里不直接引用
+	baseURL := os.Getenv("BACKEND_URL")
+	if baseURL == "" {
+		baseURL = viper.GetString("manager.backend_url")
+	}
+	if baseURL == "" {
+		baseURL = "http://localhost:8080" // 默认值
+	}
+	return &oauthTokenSource{
+		serverName:     serverName,
+		internalSecret: oauthInternalSecret(),
+		client: httpclient.NewManagerClient(httpclient.ManagerClientConfig{
+			BaseURL:    baseURL,
+			Timeout:    10 * time.Second,
+			MaxRetries: 1,
+		}),
+	}
+}
+
+// oauthInternalSecret 内部接口共享密钥，环境变量 INTERNAL_SECRET 优先，便于与 manager 容器共用
+func oauthInternalSecret() string {
+	if secret := os.Getenv("INTERNAL_SECRET"); secret != "" {
+		return secret
+	}
+	return viper.GetString("manager.internal_secret")
+}
+
+// headers 作为 HTTPHeaderFunc 在每个请求前调用；获取失败时不带令牌，由服务器返回 401 触发重连
+func (s *oauthTokenSource) headers(ctx context.Context) map[string]string {
+	value, err := s.authorizationHeader(ctx)
+	if err != nil {
+		log.Warnf("MCP服务器 %s 获取OAuth令牌失败: %v", s.serverName, err)
+		return nil
+	}
+	return map[string]string{"Authorization": value}
+}
+
+func (s *oauthTokenSource) authorizationHeader(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.authorization != "" && time.Until(s.expiresAt) > oauthTokenRefreshSkew {
+		return s.authorization, nil
+	}
+
+	var resp struct {
+		Data *struct {
+			AccessToken string     `json:"access_token"`
+			TokenType   string     `json:"token_type"`
+			ExpiresAt   *time.Time `json:"expires_at"`
+		} `json:"data"`
+		Error string `json:"error"`
+	}
+	var headers map[string]string
+	if s.internalSecret != "" {
+		headers = map[string]string{oauthInternalSecretHeader: s.internalSecret}
+	}
+	err := s.client.DoRequest(ctx, httpclient.RequestOptions{
+		Method:      "GET",
+		Path:        "/api/internal/mcp-oauth/token",
+		QueryParams: map[string]string{"server": s.serverName},
+		Headers:     headers,
+		Response:    &resp,
+	})
+	if err != nil {
+		return "", err
+	}
+	if resp.Data == nil || resp.Data.AccessToken == "" {
+		if resp.Error == "" {
+			resp.Error = "manager 未返回访问令牌"
+		}
+		// 需要重新授权时清空缓存，管理员重新授权后即可恢复
+		s.authorization = ""
+		return "", fmt.Errorf("%s", resp.Error)
+	}
+
+	tokenType := strings.TrimSpace(resp.Data.TokenType)
+	if tokenType == "" {
+		tokenType = "Bearer"
+	}
+	s.authorization = tokenType + " " + resp.Data.AccessToken
+	s.expiresAt = time.Now().Add(oauthTokenMaxCache)
+	if resp.Data.ExpiresAt != nil && resp.Data.ExpiresAt.Before(s.expiresAt) {
+		s.expiresAt = *resp.Data.ExpiresAt
+	}
+	return s.authorization, nil
+}
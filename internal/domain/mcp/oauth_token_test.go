@@ -0,0 +1,82 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOAuthTokenSource(t *testing.T) {
+	var calls atomic.Int32
+	var reauth atomic.Bool
+	manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path != "/api/internal/mcp-oauth/token" || r.URL.Query().Get("server") != "remote" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("X-Internal-Secret") != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "内部服务密钥无效"})
+			return
+		}
+		if reauth.Load() {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": "OAuth 令牌已失效，需要重新授权"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+			"access_token": "at-1",
+			"token_type":   "Bearer",
+			"expires_at":   time.Now().Add(time.Hour),
+		}})
+	}))
+	defer manager.Close()
+	t.Setenv("BACKEND_URL", manager.URL)
+	t.Setenv("INTERNAL_SECRET", "s3cret")
+
+	// 远端 MCP 服务器只接受带正确令牌的请求
+	s := server.NewMCPServer("remote", "1.0.0")
+	s.AddTool(mcp.NewTool("echo"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("ok"), nil
+	})
+	mcpHandler := server.NewStreamableHTTPServer(s)
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer at-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mcpHandler.ServeHTTP(w, r)
+	}))
+	defer remote.Close()
+
+	tr, _, err := buildMCPTransport(MCPServerConfig{Name: "remote", Type: "streamablehttp", Url: remote.URL + "/mcp", AuthRef: "oauth"})
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c := client.NewClient(tr)
+	require.NoError(t, c.Start(ctx))
+	defer c.Close()
+	_, err = c.Initialize(ctx, mcp.InitializeRequest{Params: mcp.InitializeParams{ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION}})
+	require.NoError(t, err)
+	tools, err := c.ListTools(ctx, mcp.ListToolsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, tools.Tools, 1)
+	// 令牌在到期前复用缓存
+	assert.Equal(t, int32(1), calls.Load())
+
+	// manager 要求重新授权时不再携带令牌
+	reauth.Store(true)
+	src := newOAuthTokenSource("remote")
+	assert.Nil(t, src.headers(ctx))
+}
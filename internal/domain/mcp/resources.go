@@ -0,0 +1,462 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/spf13/viper"
+
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// DeviceServerName 资源/提示词引用中表示设备（或智能体 WebSocket 端点）接入的 MCP 服务
+const DeviceServerName = "device"
+
+const (
+	// maxPinnedResourceChars 单个资源缓存的最大字符数，注入提示词时再按智能体配置截断
+	maxPinnedResourceChars = 64 * 1024
+	// defaultPinnedResourceTTL 服务器不支持订阅时固定资源的缓存时间
+	defaultPinnedResourceTTL = 5 * time.Minute
+	// pinnedResourceRefreshTimeout 收到资源更新通知后重新读取的超时时间
+	pinnedResourceRefreshTimeout = 30 * time.Second
+)
+
+// ResourceInfo MCP 服务上报的资源
+type ResourceInfo struct {
+	Server      string `json:"server"`
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mime_type,omitempty"`
+}
+
+// PromptInfo MCP 服务上报的提示词
+type PromptInfo struct {
+	Server      string               `json:"server"`
+	Name        string               `json:"name"`
+	Description string               `json:"description,omitempty"`
+	Arguments   []mcp.PromptArgument `json:"arguments,omitempty"`
+}
+
+// mcpCatalog 一个 MCP 连接上报的资源与提示词列表
+type mcpCatalog struct {
+	mu        sync.RWMutex
+	resources []mcp.Resource
+	prompts   []mcp.Prompt
+}
+
+// refresh 按服务器声明的能力拉取资源与提示词列表，未声明的能力不发请求
+func (c *mcpCatalog) refresh(ctx context.Context, cli *client.Client, source string) {
+	if cli == nil {
+		return
+	}
+	caps := cli.GetServerCapabilities()
+
+	var resources []mcp.Resource
+	if caps.Resources != nil {
+		result, err := cli.ListResources(ctx, mcp.ListResourcesRequest{})
+		if err != nil {
+			log.Warnf("获取MCP资源列表失败: %s, %v", source, err)
+		} else {
+			resources = result.Resources
+		}
+	}
+	var prompts []mcp.Prompt
+	if caps.Prompts != nil {
+		result, err := cli.ListPrompts(ctx, mcp.ListPromptsRequest{})
+		if err != nil {
+			log.Warnf("获取MCP提示词列表失败: %s, %v", source, err)
+		} else {
+			prompts = result.Prompts
+		}
+	}
+
+	c.mu.Lock()
+	c.resources = resources
+	c.prompts = prompts
+	c.mu.Unlock()
+	if len(resources) > 0 || len(prompts) > 0 {
+		log.Infof("MCP服务 %s 资源/提示词列表已更新，资源 %d 个，提示词 %d 个", source, len(resources), len(prompts))
+	}
+}
+
+func (c *mcpCatalog) reset() {
+	c.mu.Lock()
+	c.resources = nil
+	c.prompts = nil
+	c.mu.Unlock()
+}
+
+func (c *mcpCatalog) snapshot() ([]mcp.Resource, []mcp.Prompt) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]mcp.Resource(nil), c.resources...), append([]mcp.Prompt(nil), c.prompts...)
+}
+
+func (c *mcpCatalog) hasResource(uri string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, r := range c.resources {
+		if r.URI == uri {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *mcpCatalog) hasPrompt(name string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, p := range c.prompts {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// handleCatalogNotification 处理资源/提示词相关通知，返回 false 表示不是此类通知
+func handleCatalogNotification(source string, cli *client.Client, catalog *mcpCatalog, notification mcp.JSONRPCNotification) bool {
+	switch notification.Method {
+	case mcp.MethodNotificationResourceUpdated:
+		uri, _ := notification.Params.AdditionalFields["uri"].(string)
+		if uri != "" {
+			log.Infof("收到MCP资源更新通知: %s, uri: %s", source, uri)
+			pinnedResources.refresh(pinnedResourceKey(source, uri))
+		}
+	case mcp.MethodNotificationResourcesListChanged, mcp.MethodNotificationPromptsListChanged:
+		go catalog.refresh(context.Background(), cli, source)
+	default:
+		return false
+	}
+	return true
+}
+
+// catalogSource 一个可提供资源/提示词的 MCP 连接
+type catalogSource struct {
+	name    string // 连接名，用作缓存键前缀
+	server  string // 对外的服务名：全局服务名或 device
+	client  *client.Client
+	catalog *mcpCatalog
+}
+
+// findCatalogSources 按服务名查找连接：device 为当前设备与智能体接入的 MCP，其余为全局 MCP 服务
+func findCatalogSources(deviceID, agentID, server string) []*catalogSource {
+	server = strings.TrimSpace(server)
+	if server == DeviceServerName {
+		return deviceCatalogSources(deviceID, agentID)
+	}
+	if conn := GetGlobalMCPManager().getServer(server); conn != nil {
+		if src := conn.catalogSource(); src != nil {
+			return []*catalogSource{src}
+		}
+	}
+	return nil
+}
+
+func deviceCatalogSources(deviceID, agentID string) []*catalogSource {
+	var sources []*catalogSource
+	seen := make(map[string]bool)
+	for _, id := range []string{deviceID, agentID} {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		session := mcpClientPool.GetMcpClient(id)
+		if session == nil {
+			continue
+		}
+		for _, instance := range session.instances() {
+			sources = append(sources, &catalogSource{
+				name:    instance.serverName,
+				server:  DeviceServerName,
+				client:  instance.mcpClient,
+				catalog: &instance.catalog,
+			})
+		}
+	}
+	return sources
+}
+
+// ListCatalog 汇总全局 MCP 服务（按智能体选择的服务过滤）与设备/智能体接入的 MCP 上报的资源和提示词
+func ListCatalog(deviceID, agentID, selectedMCPServiceNames string) ([]ResourceInfo, []PromptInfo) {
+	resources := make([]ResourceInfo, 0)
+	prompts := make([]PromptInfo, 0)
+	collect := func(src *catalogSource) {
+		rs, ps := src.catalog.snapshot()
+		for _, r := range rs {
+			resources = append(resources, ResourceInfo{Server: src.server, URI: r.URI, Name: r.Name, Description: r.Description, MimeType: r.MIMEType})
+		}
+		for _, p := range ps {
+			prompts = append(prompts, PromptInfo{Server: src.server, Name: p.Name, Description: p.Description, Arguments: p.Arguments})
+		}
+	}
+
+	selected := parseSelectedMCPServiceNames(selectedMCPServiceNames)
+	for _, conn := range GetGlobalMCPManager().connections() {
+		if len(selected) > 0 {
+			if _, ok := selected[conn.config.Name]; !ok {
+				continue
+			}
+		}
+		if src := conn.catalogSource(); src != nil {
+			collect(src)
+		}
+	}
+	for _, src := range deviceCatalogSources(deviceID, agentID) {
+		collect(src)
+	}
+	return resources, prompts
+}
+
+// ReadPinnedResource 读取智能体固定的资源文本。内容会被缓存：服务器支持订阅时持续有效并在
+// notifications/resources/updated 时刷新，否则按 mcp.resources.cache_ttl 过期后重新读取
+func ReadPinnedResource(ctx context.Context, deviceID, agentID, server, uri string) (string, error) {
+	sources := findCatalogSources(deviceID, agentID, server)
+	if len(sources) == 0 {
+		return "", fmt.Errorf("MCP服务 %s 不可用", server)
+	}
+
+	var lastErr error
+	for _, src := range sources {
+		// 设备侧可能有多个连接，只读取上报了该资源的连接
+		if src.server == DeviceServerName && !src.catalog.hasResource(uri) {
+			continue
+		}
+		key := pinnedResourceKey(src.name, uri)
+		if text, ok := pinnedResources.get(key); ok {
+			return text, nil
+		}
+
+		cli := src.client
+		read := func(ctx context.Context) (string, error) {
+			return readResourceText(ctx, cli, uri)
+		}
+		text, err := read(ctx)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		subscribed := false
+		if caps := cli.GetServerCapabilities(); caps.Resources != nil && caps.Resources.Subscribe {
+			if err := cli.Subscribe(ctx, mcp.SubscribeRequest{Params: mcp.SubscribeParams{URI: uri}}); err != nil {
+				log.Warnf("订阅MCP资源失败，改为定时刷新: %s, uri: %s, %v", src.name, uri, err)
+			} else {
+				subscribed = true
+			}
+		}
+		pinnedResources.set(key, &pinnedResource{text: text, fetchedAt: time.Now(), subscribed: subscribed, read: read})
+		return text, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("未找到资源: %s", uri)
+	}
+	return "", lastErr
+}
+
+// GetPrompt 获取 MCP 提示词并按参数展开
+func GetPrompt(ctx context.Context, deviceID, agentID, server, name string, args map[string]string) (*mcp.GetPromptResult, error) {
+	sources := findCatalogSources(deviceID, agentID, server)
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("MCP服务 %s 不可用", server)
+	}
+
+	var lastErr error
+	for _, src := range sources {
+		if src.server == DeviceServerName && !src.catalog.hasPrompt(name) {
+			continue
+		}
+		result, err := src.client.GetPrompt(ctx, mcp.GetPromptRequest{Params: mcp.GetPromptParams{Name: name, Arguments: args}})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return result, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("未找到提示词: %s", name)
+	}
+	return nil, lastErr
+}
+
+// PromptText 将提示词消息中的文本（含内嵌文本资源）拼接为一段文字
+func PromptText(result *mcp.GetPromptResult) string {
+	if result == nil {
+		return ""
+	}
+	parts := make([]string, 0, len(result.Messages))
+	for _, msg := range result.Messages {
+		switch c := msg.Content.(type) {
+		case mcp.TextContent:
+			parts = append(parts, c.Text)
+		case mcp.EmbeddedResource:
+			if text, ok := c.Resource.(mcp.TextResourceContents); ok {
+				parts = append(parts, text.Text)
+			}
+		}
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n\n"))
+}
+
+func readResourceText(ctx context.Context, cli *client.Client, uri string) (string, error) {
+	result, err := cli.ReadResource(ctx, mcp.ReadResourceRequest{Params: mcp.ReadResourceParams{URI: uri}})
+	if err != nil {
+		return "", fmt.Errorf("读取资源 %s 失败: %w", uri, err)
+	}
+	parts := make([]string, 0, len(result.Contents))
+	for _, content := range result.Contents {
+		// 二进制内容无法注入提示词，直接跳过
+		if text, ok := content.(mcp.TextResourceContents); ok {
+			parts = append(parts, text.Text)
+		}
+	}
+	text, _ := TruncateRunes(strings.Join(parts, "\n"), maxPinnedResourceChars)
+	return text, nil
+}
+
+// TruncateRunes 按字符数截断文本，返回是否发生截断
+func TruncateRunes(s string, max int) (string, bool) {
+	if max <= 0 {
+		return s, false
+	}
+	count := 0
+	for i := range s {
+		if count == max {
+			return s[:i], true
+		}
+		count++
+	}
+	return s, false
+}
+
+// pinnedResource 固定资源的缓存内容
+type pinnedResource struct {
+	text       string
+	fetchedAt  time.Time
+	subscribed bool
+	read       func(ctx context.Context) (string, error)
+}
+
+type pinnedResourceCache struct {
+	mu      sync.Mutex
+	entries map[string]*pinnedResource
+}
+
+var pinnedResources = &pinnedResourceCache{entries: make(map[string]*pinnedResource)}
+
+func pinnedResourceKey(source, uri string) string {
+	return source + "|" + uri
+}
+
+func pinnedResourceTTL() time.Duration {
+	if ttl := viper.GetInt("mcp.resources.cache_ttl"); ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return defaultPinnedResourceTTL
+}
+
+func (c *pinnedResourceCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if !entry.subscribed && time.Since(entry.fetchedAt) > pinnedResourceTTL() {
+		delete(c.entries, key)
+		return "", false
+	}
+	return entry.text, true
+}
+
+func (c *pinnedResourceCache) set(key string, entry *pinnedResource) {
+	c.mu.Lock()
+	c.entries[key] = entry
+	c.mu.Unlock()
+}
+
+// refresh 资源更新后重新读取；读取失败时丢弃缓存，下次使用时再拉取
+func (c *pinnedResourceCache) refresh(key string) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), pinnedResourceRefreshTimeout)
+		defer cancel()
+		text, err := entry.read(ctx)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.entries[key] != entry {
+			return
+		}
+		if err != nil {
+			log.Warnf("刷新MCP资源失败，已清除缓存: %s, %v", key, err)
+			delete(c.entries, key)
+			return
+		}
+		c.entries[key] = &pinnedResource{text: text, fetchedAt: time.Now(), subscribed: entry.subscribed, read: entry.read}
+	}()
+}
+
+// dropSource 连接断开后订阅随之失效，清除该连接的全部缓存
+func (c *pinnedResourceCache) dropSource(source string) {
+	prefix := source + "|"
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// connections 返回按名称排序的全局 MCP 连接
+func (g *GlobalMCPManager) connections() []*MCPServerConnection {
+	g.mu.RLock()
+	conns := make([]*MCPServerConnection, 0, len(g.servers))
+	for _, conn := range g.servers {
+		conns = append(conns, conn)
+	}
+	g.mu.RUnlock()
+	sort.Slice(conns, func(i, j int) bool { return conns[i].config.Name < conns[j].config.Name })
+	return conns
+}
+
+func (g *GlobalMCPManager) getServer(name string) *MCPServerConnection {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.servers[name]
+}
+
+func (conn *MCPServerConnection) catalogSource() *catalogSource {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	if !conn.connected || conn.client == nil {
+		return nil
+	}
+	return &catalogSource{name: conn.config.Name, server: conn.config.Name, client: conn.client, catalog: &conn.catalog}
+}
+
+// instances 返回设备会话下的全部 MCP 连接
+func (dcs *DeviceMcpSession) instances() []*McpClientInstance {
+	var result []*McpClientInstance
+	dcs.wsEndPointMcp.Range(func(_, value interface{}) bool {
+		result = append(result, value.(*McpClientInstance))
+		return true
+	})
+	dcs.iotMux.RLock()
+	if dcs.iotOverMcp != nil {
+		result = append(result, dcs.iotOverMcp)
+	}
+	dcs.iotMux.RUnlock()
+	return result
+}
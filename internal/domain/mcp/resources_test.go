@@ -0,0 +1,97 @@
+package mcp
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinnedResourcesAndPrompts(t *testing.T) {
+	var version atomic.Int32
+	version.Store(1)
+	s := server.NewMCPServer("docs", "1.0.0",
+		server.WithResourceCapabilities(false, true),
+		server.WithPromptCapabilities(true),
+	)
+	s.AddResource(mcp.NewResource("docs://faq", "常见问题", mcp.WithMIMEType("text/plain")),
+		func(ctx context.Context, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			text := "营业时间 9 点"
+			if version.Load() > 1 {
+				text = "营业时间 10 点"
+			}
+			return []mcp.ResourceContents{mcp.TextResourceContents{URI: req.Params.URI, Text: text}}, nil
+		})
+	s.AddPrompt(mcp.NewPrompt("weather", mcp.WithPromptDescription("天气播报"), mcp.WithArgument("city", mcp.RequiredArgument())),
+		func(ctx context.Context, req mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			return mcp.NewGetPromptResult("天气", []mcp.PromptMessage{
+				mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent("请播报"+req.Params.Arguments["city"]+"的天气")),
+			}), nil
+		})
+	remote := httptest.NewServer(server.NewStreamableHTTPServer(s))
+	defer remote.Close()
+
+	g := GetGlobalMCPManager()
+	require.NoError(t, g.connectToServer(MCPServerConfig{Name: "docs", Type: "streamablehttp", Url: remote.URL + "/mcp", Enabled: true}))
+	conn := g.getServer("docs")
+	defer func() {
+		conn.disconnect()
+		g.mu.Lock()
+		delete(g.servers, "docs")
+		g.mu.Unlock()
+	}()
+
+	resources, prompts := ListCatalog("", "", "")
+	require.Len(t, resources, 1)
+	assert.Equal(t, ResourceInfo{Server: "docs", URI: "docs://faq", Name: "常见问题", MimeType: "text/plain"}, resources[0])
+	require.Len(t, prompts, 1)
+	assert.Equal(t, "weather", prompts[0].Name)
+	assert.True(t, prompts[0].Arguments[0].Required)
+
+	// 智能体未选择该服务时不返回
+	resources, _ = ListCatalog("", "", "other")
+	assert.Empty(t, resources)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	text, err := ReadPinnedResource(ctx, "", "", "docs", "docs://faq")
+	require.NoError(t, err)
+	assert.Equal(t, "营业时间 9 点", text)
+
+	// 内容变化后在收到更新通知前仍使用缓存
+	version.Store(2)
+	text, _ = ReadPinnedResource(ctx, "", "", "docs", "docs://faq")
+	assert.Equal(t, "营业时间 9 点", text)
+
+	notification := mcp.JSONRPCNotification{Notification: mcp.Notification{
+		Method: mcp.MethodNotificationResourceUpdated,
+		Params: mcp.NotificationParams{AdditionalFields: map[string]any{"uri": "docs://faq"}},
+	}}
+	require.True(t, handleCatalogNotification("docs", conn.client, &conn.catalog, notification))
+	require.Eventually(t, func() bool {
+		text, _ := ReadPinnedResource(ctx, "", "", "docs", "docs://faq")
+		return text == "营业时间 10 点"
+	}, 2*time.Second, 20*time.Millisecond)
+
+	result, err := GetPrompt(ctx, "", "", "docs", "weather", map[string]string{"city": "上海"})
+	require.NoError(t, err)
+	assert.Equal(t, "请播报上海的天气", PromptText(result))
+
+	_, err = ReadPinnedResource(ctx, "", "", "missing", "docs://faq")
+	assert.Error(t, err)
+}
+
+func TestTruncateRunes(t *testing.T) {
+	out, truncated := TruncateRunes("你好世界", 2)
+	assert.Equal(t, "你好", out)
+	assert.True(t, truncated)
+	out, truncated = TruncateRunes("你好", 2)
+	assert.Equal(t, "你好", out)
+	assert.False(t, truncated)
+}
@@ -0,0 +1,54 @@
+package mcp
+
+// DeviceConnectionStats 设备侧MCP连接统计
+type DeviceConnectionStats struct {
+	Devices                int
+	WsEndpointConnected    int
+	WsEndpointDisconnected int
+	IotConnected           int
+	IotDisconnected        int
+}
+
+// ServerStates 返回全局MCP服务器的连接状态（服务器名 -> 是否已连接）
+func (g *GlobalMCPManager) ServerStates() map[string]bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	states := make(map[string]bool, len(g.servers))
+	for name, conn := range g.servers {
+		conn.mu.RLock()
+		states[name] = conn.connected
+		conn.mu.RUnlock()
+	}
+	return states
+}
+
+// GetDeviceConnectionStats 汇总所有设备的MCP连接状态
+func GetDeviceConnectionStats() DeviceConnectionStats {
+	stats := DeviceConnectionStats{}
+	for item := range mcpClientPool.device2McpClient.IterBuffered() {
+		session := item.Val
+		if session == nil {
+			continue
+		}
+		stats.Devices++
+		session.wsEndPointMcp.Range(func(_, value interface{}) bool {
+			if instance, ok := value.(*McpClientInstance); ok && instance.IsConnected() {
+				stats.WsEndpointConnected++
+			} else {
+				stats.WsEndpointDisconnected++
+			}
+			return true
+		})
+		session.iotMux.RLock()
+		if session.iotOverMcp != nil {
+			if session.iotOverMcp.IsConnected() {
+				stats.IotConnected++
+			} else {
+				stats.IotDisconnected++
+			}
+		}
+		session.iotMux.RUnlock()
+	}
+	return stats
+}
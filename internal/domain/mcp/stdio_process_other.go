@@ -0,0 +1,18 @@
+//go:build !unix
+
+package mcp
+
+import (
+	"os/exec"
+)
+
+func configureStdioProcess(cmd *exec.Cmd) {}
+
+// terminateStdioProcess 非 unix 平台没有进程组信号，直接结束进程
+func terminateStdioProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+func killStdioProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
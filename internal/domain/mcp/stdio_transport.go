@@ -0,0 +1,304 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	log "xiaozhi-esp32-server-golang/logger"
+	"xiaozhi-esp32-server-golang/pkg/mcpstdio"
+)
+
+const (
+	// stdioStopTimeout 关闭 stdin 后等待进程自行退出的时间，超时后发送 SIGTERM
+	stdioStopTimeout = 5 * time.Second
+	// stdioKillTimeout 发送 SIGTERM 后等待的时间，超时后强制结束整个进程组
+	stdioKillTimeout = 3 * time.Second
+	// stdioStableUptime 进程运行超过该时长后退出视为偶发故障，重启退避从头计算
+	stdioStableUptime = time.Minute
+	// stdioMinRestartDelay 首次重启的等待时间，之后按 2 倍递增，上限为 reconnect_interval
+	stdioMinRestartDelay = time.Second
+	// stdioDefaultMaxRestartDelay 未配置 reconnect_interval 时的退避上限
+	stdioDefaultMaxRestartDelay = 30 * time.Second
+)
+
+// StdioLimits stdio 子进程的资源限制，设置失败只记录告警，不阻止进程启动
+type StdioLimits = mcpstdio.Limits
+
+// stdioTransport 以子进程方式运行本地 MCP 服务器（npx/uvx/二进制），通过 stdin/stdout 传输 JSON-RPC。
+// 进程由本结构自行启动与回收：stderr 按行写入日志，Close 时先关闭 stdin 等待进程退出，超时再依次 SIGTERM/SIGKILL 整个进程组
+type stdioTransport struct {
+	config MCPServerConfig
+
+	mu                  sync.Mutex
+	inner               *transport.Stdio
+	cmd                 *exec.Cmd
+	stdout              *os.File
+	startedAt           time.Time
+	closing             bool
+	exited              chan struct{}
+	exitErr             error
+	notificationHandler func(mcp.JSONRPCNotification)
+	requestHandler      transport.RequestHandler
+}
+
+var _ transport.BidirectionalInterface = (*stdioTransport)(nil)
+
+func newStdioTransport(config MCPServerConfig) *stdioTransport {
+	return &stdioTransport{config: config, exited: make(chan struct{})}
+}
+
+// stdioCommandLine 用于日志展示的命令行
+func stdioCommandLine(config MCPServerConfig) string {
+	parts := append([]string{strings.TrimSpace(config.Command)}, config.Args...)
+	return strings.Join(parts, " ")
+}
+
+// Start 启动子进程并开始读取 stdout
+func (t *stdioTransport) Start(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cmd != nil {
+		return fmt.Errorf("stdio 传输已启动")
+	}
+
+	// 资源限制优先在 exec 目标命令前设置，无法包装时退回启动后 prlimit
+	command, args, limited := mcpstdio.WrapLimits(strings.TrimSpace(t.config.Command), t.config.Args, t.config.Limits)
+
+	// 不使用 CommandContext：进程生命周期由 Close 与监督协程管理，不随调用方 ctx 结束
+	cmd := exec.Command(command, args...)
+	cmd.Env = mcpstdio.Env(t.config.Env)
+	cmd.Dir = strings.TrimSpace(t.config.WorkDir)
+	configureStdioProcess(cmd)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("创建 stdin 管道失败: %w", err)
+	}
+	// stdout/stderr 使用自建管道：cmd.Wait 不会关闭读端，避免进程退出时丢失最后的输出
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("创建 stdout 管道失败: %w", err)
+	}
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		stdoutR.Close()
+		stdoutW.Close()
+		return fmt.Errorf("创建 stderr 管道失败: %w", err)
+	}
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
+
+	err = cmd.Start()
+	stdoutW.Close()
+	stderrW.Close()
+	if err != nil {
+		stdoutR.Close()
+		stderrR.Close()
+		return fmt.Errorf("启动进程失败(%s): %w", stdioCommandLine(t.config), err)
+	}
+	t.cmd = cmd
+	t.stdout = stdoutR
+	t.startedAt = time.Now()
+	log.Infof("MCP服务器 %s 进程已启动: pid=%d, 命令: %s", t.config.Name, cmd.Process.Pid, stdioCommandLine(t.config))
+
+	if !limited {
+		if err := mcpstdio.ApplyLimits(cmd.Process.Pid, t.config.Limits); err != nil {
+			log.Warnf("MCP服务器 %s 设置资源限制失败: %v", t.config.Name, err)
+		}
+	}
+
+	go t.pumpStderr(stderrR)
+	go func() {
+		err := cmd.Wait()
+		t.mu.Lock()
+		t.exitErr = err
+		t.mu.Unlock()
+		close(t.exited)
+	}()
+
+	inner := transport.NewIO(stdoutR, stdin, io.NopCloser(strings.NewReader("")))
+	if t.notificationHandler != nil {
+		inner.SetNotificationHandler(t.notificationHandler)
+	}
+	if t.requestHandler != nil {
+		inner.SetRequestHandler(t.requestHandler)
+	}
+	t.inner = inner
+	return inner.Start(ctx)
+}
+
+// pumpStderr 将子进程 stderr 按行写入日志
+func (t *stdioTransport) pumpStderr(r io.ReadCloser) {
+	defer r.Close()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+			log.Infof("[MCP:%s stderr] %s", t.config.Name, line)
+		}
+	}
+}
+
+func (t *stdioTransport) getInner() (*transport.Stdio, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.inner == nil {
+		return nil, fmt.Errorf("stdio 传输未启动")
+	}
+	return t.inner, nil
+}
+
+func (t *stdioTransport) SendRequest(ctx context.Context, request transport.JSONRPCRequest) (*transport.JSONRPCResponse, error) {
+	inner, err := t.getInner()
+	if err != nil {
+		return nil, err
+	}
+	// 进程在请求途中退出（如 initialize 之前崩溃）时不会再有响应，不能一直等到 ctx 结束
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-t.exited:
+			cancel()
+		case <-reqCtx.Done():
+		}
+	}()
+	resp, err := inner.SendRequest(reqCtx, request)
+	if err != nil && ctx.Err() == nil {
+		select {
+		case <-t.exited:
+			return nil, fmt.Errorf("MCP服务器进程已退出")
+		default:
+		}
+	}
+	return resp, err
+}
+
+func (t *stdioTransport) SendNotification(ctx context.Context, notification mcp.JSONRPCNotification) error {
+	inner, err := t.getInner()
+	if err != nil {
+		return err
+	}
+	return inner.SendNotification(ctx, notification)
+}
+
+func (t *stdioTransport) SetNotificationHandler(handler func(notification mcp.JSONRPCNotification)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.notificationHandler = handler
+	if t.inner != nil {
+		t.inner.SetNotificationHandler(handler)
+	}
+}
+
+func (t *stdioTransport) SetRequestHandler(handler transport.RequestHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.requestHandler = handler
+	if t.inner != nil {
+		t.inner.SetRequestHandler(handler)
+	}
+}
+
+func (t *stdioTransport) GetSessionId() string {
+	return ""
+}
+
+// Close 主动关闭：关闭 stdin 通知进程退出，超时后依次 SIGTERM、SIGKILL 整个进程组
+func (t *stdioTransport) Close() error {
+	t.mu.Lock()
+	if t.closing {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closing = true
+	inner, cmd, stdout := t.inner, t.cmd, t.stdout
+	t.mu.Unlock()
+
+	if cmd == nil {
+		return nil
+	}
+	if inner != nil {
+		// stdin 可能已随进程退出被关闭，忽略错误
+		_ = inner.Close()
+	}
+	// 进程退出后再关闭 stdout 读端，让读取协程先读到 EOF
+	defer stdout.Close()
+
+	select {
+	case <-t.exited:
+		return nil
+	case <-time.After(stdioStopTimeout):
+	}
+	log.Warnf("MCP服务器 %s 进程未在 %s 内退出，发送 SIGTERM", t.config.Name, stdioStopTimeout)
+	if err := terminateStdioProcess(cmd); err != nil {
+		log.Warnf("MCP服务器 %s 发送 SIGTERM 失败: %v", t.config.Name, err)
+	}
+
+	select {
+	case <-t.exited:
+		return nil
+	case <-time.After(stdioKillTimeout):
+	}
+	log.Warnf("MCP服务器 %s 进程未响应 SIGTERM，强制结束", t.config.Name)
+	if err := killStdioProcess(cmd); err != nil {
+		return fmt.Errorf("结束进程失败: %w", err)
+	}
+	<-t.exited
+	return nil
+}
+
+// Exited 进程退出时关闭
+func (t *stdioTransport) Exited() <-chan struct{} {
+	return t.exited
+}
+
+// exitInfo 返回退出原因、运行时长以及是否为主动关闭
+func (t *stdioTransport) exitInfo() (err error, uptime time.Duration, closing bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.exitErr, time.Since(t.startedAt), t.closing
+}
+
+// kill 强制结束进程（用于进程失去响应），随后由监督协程按退避策略重启
+func (t *stdioTransport) kill() {
+	t.mu.Lock()
+	cmd := t.cmd
+	t.mu.Unlock()
+	if cmd == nil {
+		return
+	}
+	select {
+	case <-t.exited:
+		return
+	default:
+	}
+	if err := killStdioProcess(cmd); err != nil {
+		log.Warnf("MCP服务器 %s 结束进程失败: %v", t.config.Name, err)
+	}
+}
+
+// stdioRestartDelay 第 attempt 次重启前的等待时间：1s 起按 2 倍递增，上限为 reconnect_interval
+func stdioRestartDelay(maxDelay time.Duration, attempt int) time.Duration {
+	if maxDelay <= 0 {
+		maxDelay = stdioDefaultMaxRestartDelay
+	}
+	delay := stdioMinRestartDelay
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
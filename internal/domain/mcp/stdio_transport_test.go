@@ -0,0 +1,186 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStdioHelperProcess 作为 stdio MCP 服务器子进程运行（由其它测试通过环境变量拉起）
+func TestStdioHelperProcess(t *testing.T) {
+	if os.Getenv("MCP_STDIO_HELPER") != "1" {
+		return
+	}
+	// HELPER_FAIL_ONCE 指向的标记文件不存在时，创建它并在 initialize 之前退出，模拟首次启动失败
+	if marker := os.Getenv("HELPER_FAIL_ONCE"); marker != "" {
+		if _, err := os.Stat(marker); os.IsNotExist(err) {
+			os.WriteFile(marker, nil, 0o644)
+			os.Exit(2)
+		}
+	}
+	fmt.Fprintln(os.Stderr, "helper ready, dir="+mustGetwd())
+	s := server.NewMCPServer("stdio-helper", "1.0.0")
+	s.AddTool(mcp.NewTool("echo", mcp.WithString("text")), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText(req.GetString("text", "") + "|" + os.Getenv("HELPER_GREETING")), nil
+	})
+	s.AddTool(mcp.NewTool("crash"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		os.Exit(3)
+		return nil, nil
+	})
+	server.ServeStdio(s)
+	os.Exit(0)
+}
+
+func mustGetwd() string {
+	wd, _ := os.Getwd()
+	return wd
+}
+
+func helperServerConfig(name string) MCPServerConfig {
+	return MCPServerConfig{
+		Name:    name,
+		Type:    "stdio",
+		Enabled: true,
+		Command: os.Args[0],
+		Args:    []string{"-test.run=^TestStdioHelperProcess$"},
+		Env:     map[string]string{"MCP_STDIO_HELPER": "1", "HELPER_GREETING": "hi"},
+		WorkDir: os.TempDir(),
+		Limits:  StdioLimits{MaxOpenFiles: 256},
+	}
+}
+
+func TestStdioTransport_ListAndCall(t *testing.T) {
+	tr, endpoint, err := buildMCPTransport(helperServerConfig("helper"))
+	require.NoError(t, err)
+	assert.Contains(t, endpoint, "TestStdioHelperProcess")
+	stdio := tr.(*stdioTransport)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c := client.NewClient(tr)
+	require.NoError(t, c.Start(ctx))
+	_, err = c.Initialize(ctx, mcp.InitializeRequest{Params: mcp.InitializeParams{ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION}})
+	require.NoError(t, err)
+
+	tools, err := c.ListTools(ctx, mcp.ListToolsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, tools.Tools, 2)
+
+	req := mcp.CallToolRequest{}
+	req.Params.Name = "echo"
+	req.Params.Arguments = map[string]any{"text": "ping"}
+	res, err := c.CallTool(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "ping|hi", res.Content[0].(mcp.TextContent).Text)
+
+	// 关闭 stdin 后进程应自行退出，Close 不应等到 SIGTERM
+	start := time.Now()
+	require.NoError(t, c.Close())
+	assert.Less(t, time.Since(start), stdioStopTimeout)
+	select {
+	case <-stdio.Exited():
+	default:
+		t.Fatal("process should have exited after Close")
+	}
+}
+
+func TestStdioTransport_MissingCommand(t *testing.T) {
+	_, _, err := buildMCPTransport(MCPServerConfig{Name: "x", Type: "stdio"})
+	assert.Error(t, err)
+
+	tr, _, err := buildMCPTransport(MCPServerConfig{Name: "x", Type: "stdio", Command: "/nonexistent/mcp-server"})
+	require.NoError(t, err)
+	assert.Error(t, tr.Start(context.Background()))
+	assert.NoError(t, tr.Close())
+}
+
+func TestStdioRestartDelay(t *testing.T) {
+	assert.Equal(t, time.Second, stdioRestartDelay(10*time.Second, 1))
+	assert.Equal(t, 4*time.Second, stdioRestartDelay(10*time.Second, 3))
+	assert.Equal(t, 10*time.Second, stdioRestartDelay(10*time.Second, 8))
+	assert.Equal(t, stdioDefaultMaxRestartDelay, stdioRestartDelay(0, 100))
+}
+
+func TestGlobalMCPManager_StdioSupervision(t *testing.T) {
+	viper.Set("mcp.global.enabled", false)
+	manager := GetGlobalMCPManager()
+	require.NoError(t, manager.Start())
+	manager.reconnectConf = ReconnectConfig{Interval: 2 * time.Second, MaxAttempts: 3}
+	defer manager.Stop()
+
+	require.NoError(t, manager.connectToServer(helperServerConfig("sup")))
+	_, ok := manager.GetToolByName("echo")
+	require.True(t, ok)
+
+	manager.mu.RLock()
+	conn := manager.servers["sup"]
+	manager.mu.RUnlock()
+	conn.mu.RLock()
+	first := conn.stdio
+	conn.mu.RUnlock()
+
+	// 进程崩溃后由监督协程重启
+	crash := mcp.CallToolRequest{}
+	crash.Params.Name = "crash"
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	conn.client.CallTool(ctx, crash)
+	cancel()
+	<-first.Exited()
+
+	require.Eventually(t, func() bool {
+		conn.mu.RLock()
+		defer conn.mu.RUnlock()
+		return conn.connected && conn.stdio != nil && conn.stdio != first
+	}, 10*time.Second, 100*time.Millisecond)
+	conn.mu.RLock()
+	assert.Equal(t, 1, conn.restartCount)
+	second := conn.stdio
+	conn.mu.RUnlock()
+	_, ok = manager.GetToolByName("echo")
+	assert.True(t, ok)
+
+	// Stop 时进程被回收且不再重启
+	require.NoError(t, manager.Stop())
+	select {
+	case <-second.Exited():
+	case <-time.After(stdioStopTimeout + stdioKillTimeout):
+		t.Fatal("process not stopped")
+	}
+}
+
+func TestGlobalMCPManager_StdioRestartAfterFailedStart(t *testing.T) {
+	viper.Set("mcp.global.enabled", false)
+	manager := GetGlobalMCPManager()
+	require.NoError(t, manager.Start())
+	manager.reconnectConf = ReconnectConfig{Interval: 2 * time.Second, MaxAttempts: 3}
+	defer manager.Stop()
+
+	config := helperServerConfig("flaky")
+	config.Env["HELPER_FAIL_ONCE"] = t.TempDir() + "/started"
+
+	// 首次启动时进程在 initialize 之前退出，连接失败但应按退避策略重启
+	require.Error(t, manager.connectToServer(config))
+	manager.mu.RLock()
+	conn := manager.servers["flaky"]
+	manager.mu.RUnlock()
+
+	require.Eventually(t, func() bool {
+		conn.mu.RLock()
+		defer conn.mu.RUnlock()
+		return conn.connected && conn.stdio != nil && !conn.restarting
+	}, 10*time.Second, 100*time.Millisecond)
+	conn.mu.RLock()
+	assert.Equal(t, 1, conn.restartCount)
+	conn.mu.RUnlock()
+	_, ok := manager.GetToolByName("echo")
+	assert.True(t, ok)
+}
@@ -11,9 +11,11 @@ import (
 	"time"
 
 	config_types "xiaozhi-esp32-server-golang/internal/domain/config/types"
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
 	log "xiaozhi-esp32-server-golang/logger"
 
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -31,6 +33,23 @@ func Search(
 	topK int,
 	knowledgeBases []config_types.KnowledgeBaseRef,
 	knowledgeBaseIDs []uint,
+) ([]config_types.KnowledgeSearchHit, error) {
+	ctx, span := tracing.Start(ctx, "rag.search",
+		attribute.Int("rag.top_k", topK),
+		attribute.Int("rag.knowledge_bases", len(knowledgeBases)),
+	)
+	hits, err := search(ctx, query, topK, knowledgeBases, knowledgeBaseIDs)
+	span.SetAttributes(attribute.Int("rag.hits", len(hits)))
+	tracing.End(span, err)
+	return hits, err
+}
+
+func search(
+	ctx context.Context,
+	query string,
+	topK int,
+	knowledgeBases []config_types.KnowledgeBaseRef,
+	knowledgeBaseIDs []uint,
 ) ([]config_types.KnowledgeSearchHit, error) {
 	q := strings.TrimSpace(query)
 	if q == "" {
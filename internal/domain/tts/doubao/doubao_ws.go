@@ -16,6 +16,7 @@ import (
 	"sync"
 	"time"
 
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
 	"xiaozhi-esp32-server-golang/internal/util"
 	log "xiaozhi-esp32-server-golang/logger"
 
@@ -314,7 +315,7 @@ func (p *DoubaoWSProvider) getConnection(ctx context.Context) (*websocket.Conn,
 	}
 
 	// 创建新连接
-	conn, _, err := wsDialer.DialContext(ctx, p.WSURL.String(), p.Header)
+	conn, _, err := wsDialer.DialContext(ctx, p.WSURL.String(), tracing.InjectHeader(ctx, p.Header))
 	if err != nil {
 		return nil, fmt.Errorf("WebSocket连接失败: %v", err)
 	}
@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
 	"xiaozhi-esp32-server-golang/internal/util"
 	log "xiaozhi-esp32-server-golang/logger"
 
@@ -75,7 +76,7 @@ func (p *EdgeOfflineTTSProvider) getConnection(ctx context.Context) (*websocket.
 	dialer := &websocket.Dialer{
 		HandshakeTimeout: p.HandshakeTimeout,
 	}
-	conn, _, err := dialer.DialContext(ctx, p.ServerURL, nil)
+	conn, _, err := dialer.DialContext(ctx, p.ServerURL, tracing.InjectHeader(ctx, nil))
 	if err != nil {
 		return nil, fmt.Errorf("WebSocket连接失败: %v", err)
 	}
@@ -10,6 +10,7 @@ import (
 	"sync"
 	"time"
 
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
 	"xiaozhi-esp32-server-golang/internal/util"
 	log "xiaozhi-esp32-server-golang/logger"
 
@@ -439,7 +440,7 @@ func (p *MinimaxTTSProvider) getConnection(ctx context.Context) (*websocket.Conn
 	header.Set("Authorization", fmt.Sprintf("Bearer %s", p.APIKey))
 
 	// 创建新连接
-	conn, resp, err := wsDialer.DialContext(ctx, wsURL, header)
+	conn, resp, err := wsDialer.DialContext(ctx, wsURL, tracing.InjectHeader(ctx, header))
 	if err != nil {
 		if resp != nil {
 			log.Errorf("WebSocket连接失败，状态码: %d", resp.StatusCode)
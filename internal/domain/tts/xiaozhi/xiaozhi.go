@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
 	log "xiaozhi-esp32-server-golang/logger"
 
 	"github.com/gorilla/websocket"
@@ -167,7 +168,7 @@ func (p *XiaozhiProvider) createWSConnection(ctx context.Context) (*websocket.Co
 	p.Header.Set("Device-Id", selectedDeviceId)
 
 	// 创建新连接
-	conn, _, err := websocket.DefaultDialer.DialContext(ctx, p.ServerAddr, p.Header)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, p.ServerAddr, tracing.InjectHeader(ctx, p.Header))
 	if err != nil {
 		log.Errorf("创建WebSocket连接失败: %v, 设备ID: %s", err, selectedDeviceId)
 		blockDeviceId(selectedDeviceId) // 将失败的deviceId加入禁用列表
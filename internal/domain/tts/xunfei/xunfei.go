@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"xiaozhi-esp32-server-golang/internal/data/audio"
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
 	"xiaozhi-esp32-server-golang/internal/util"
 	log "xiaozhi-esp32-server-golang/logger"
 
@@ -476,7 +477,7 @@ func (p *XunfeiTTSProvider) dial(ctx context.Context) (*websocket.Conn, error) {
 		dialer.HandshakeTimeout = time.Duration(p.ConnectTimeout) * time.Second
 	}
 
-	conn, resp, err := dialer.DialContext(ctx, signedURL, nil)
+	conn, resp, err := dialer.DialContext(ctx, signedURL, tracing.InjectHeader(ctx, nil))
 	if err != nil {
 		if resp != nil {
 			body, _ := io.ReadAll(resp.Body)
@@ -19,6 +19,7 @@ import (
 
 	"xiaozhi-esp32-server-golang/internal/data/audio"
 	"xiaozhi-esp32-server-golang/internal/domain/tts/streaming"
+	"xiaozhi-esp32-server-golang/internal/pkg/tracing"
 	"xiaozhi-esp32-server-golang/internal/util"
 	log "xiaozhi-esp32-server-golang/logger"
 
@@ -693,7 +694,7 @@ func (p *XunfeiSuperTTSProvider) dial(ctx context.Context) (*websocket.Conn, err
 		dialer.HandshakeTimeout = time.Duration(p.ConnectTimeout) * time.Second
 	}
 
-	conn, resp, err := dialer.DialContext(ctx, signedURL, nil)
+	conn, resp, err := dialer.DialContext(ctx, signedURL, tracing.InjectHeader(ctx, nil))
 	if err != nil {
 		if resp != nil {
 			body, _ := io.ReadAll(resp.Body)
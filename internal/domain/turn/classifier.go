@@ -0,0 +1,139 @@
+package turn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const defaultClassifierTimeout = 800 * time.Millisecond
+
+const classifierPrompt = "你是语音助手的断句判断器。用户正在说话，下面是语音识别到的文本，用户此刻停顿了。" +
+	"判断这句话是否已经完整、助手可以开始回复。只回答 yes 或 no，不要输出其他内容。"
+
+// Classifier 判断一句话是否已说完
+type Classifier interface {
+	Classify(ctx context.Context, text string) (Verdict, error)
+}
+
+var (
+	defaultClassifier     Classifier
+	defaultClassifierOnce sync.Once
+)
+
+// DefaultClassifier 返回按 chat.end_of_turn.classifier 配置创建的全局分类器，未配置时返回 nil
+func DefaultClassifier() Classifier {
+	defaultClassifierOnce.Do(func() {
+		baseURL := strings.TrimSpace(viper.GetString("chat.end_of_turn.classifier.base_url"))
+		model := strings.TrimSpace(viper.GetString("chat.end_of_turn.classifier.model"))
+		if baseURL == "" || model == "" {
+			return
+		}
+		timeout := viper.GetDuration("chat.end_of_turn.classifier.timeout")
+		if timeout <= 0 {
+			timeout = defaultClassifierTimeout
+		}
+		log.Infof("语义断句已启用 LLM 分类: base_url=%s model=%s timeout=%v", baseURL, model, timeout)
+		defaultClassifier = &OpenAIClassifier{
+			BaseURL: baseURL,
+			APIKey:  strings.TrimSpace(viper.GetString("chat.end_of_turn.classifier.api_key")),
+			Model:   model,
+			Client:  &http.Client{Timeout: timeout},
+		}
+	})
+	return defaultClassifier
+}
+
+// OpenAIClassifier 调用 OpenAI 兼容的 /chat/completions 接口，适合使用响应快的小模型
+type OpenAIClassifier struct {
+	BaseURL string
+	APIKey  string
+	Model   string
+	Client  *http.Client
+}
+
+func (c *OpenAIClassifier) Classify(ctx context.Context, text string) (Verdict, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model": c.Model,
+		"messages": []map[string]string{
+			{"role": "system", "content": classifierPrompt},
+			{"role": "user", "content": text},
+		},
+		"temperature": 0,
+		"max_tokens":  3,
+		"stream":      false,
+	})
+	if err != nil {
+		return VerdictUnknown, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(c.BaseURL, "/")+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return VerdictUnknown, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return VerdictUnknown, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return VerdictUnknown, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return VerdictUnknown, fmt.Errorf("chat/completions 请求失败: status=%d body=%s", resp.StatusCode, truncate(string(respBody), 256))
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return VerdictUnknown, fmt.Errorf("解析 chat/completions 响应失败: %w", err)
+	}
+	if len(result.Choices) == 0 {
+		return VerdictUnknown, fmt.Errorf("chat/completions 未返回结果")
+	}
+	return parseVerdict(result.Choices[0].Message.Content), nil
+}
+
+// parseVerdict 解析模型回答，无法识别时返回 VerdictUnknown
+func parseVerdict(answer string) Verdict {
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	switch {
+	case strings.HasPrefix(answer, "yes"), strings.HasPrefix(answer, "是"):
+		return VerdictComplete
+	case strings.HasPrefix(answer, "no"), strings.HasPrefix(answer, "否"), strings.HasPrefix(answer, "不"):
+		return VerdictIncomplete
+	default:
+		return VerdictUnknown
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
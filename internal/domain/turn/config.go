@@ -0,0 +1,91 @@
+package turn
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultBaseWait = 400 * time.Millisecond
+	defaultMinWait  = 250 * time.Millisecond
+	defaultMaxWait  = 1600 * time.Millisecond
+	// defaultClassifierGrace 等待分类结果时在基础等待时长上额外延长的时间
+	defaultClassifierGrace = 300 * time.Millisecond
+)
+
+// 智能体的语音识别速度（asr_speed），对等待时长整体缩放
+const (
+	SpeedNormal  = "normal"
+	SpeedPatient = "patient"
+	SpeedFast    = "fast"
+)
+
+// Config 语义断句配置，对应 chat.end_of_turn
+type Config struct {
+	Enabled bool
+	// BaseWait 无法从文本判断时的等待时长，沿用 chat.chat_max_silence_duration
+	BaseWait time.Duration
+	// MinWait 文本看起来已说完（句末标点、语气词）时的等待时长
+	MinWait time.Duration
+	// MaxWait 文本明显未说完（连词、逗号、语气停顿）时的等待时长
+	MaxWait time.Duration
+	// Speed 智能体的语音识别速度：fast 缩短等待，patient 延长等待
+	Speed string
+	// ClassifierGrace 分类请求未返回时在 BaseWait 基础上额外等待的时长
+	ClassifierGrace time.Duration
+}
+
+// ConfigFromViper 读取 chat.end_of_turn 配置；baseWait 为当前会话的静音阈值，speed 为智能体的 asr_speed
+func ConfigFromViper(baseWait time.Duration, speed string) Config {
+	conf := Config{
+		Enabled:         viper.GetBool("chat.end_of_turn.enabled"),
+		BaseWait:        baseWait,
+		MinWait:         defaultMinWait,
+		MaxWait:         defaultMaxWait,
+		Speed:           speed,
+		ClassifierGrace: defaultClassifierGrace,
+	}
+	if v := viper.GetInt64("chat.end_of_turn.min_wait_ms"); v > 0 {
+		conf.MinWait = time.Duration(v) * time.Millisecond
+	}
+	if v := viper.GetInt64("chat.end_of_turn.max_wait_ms"); v > 0 {
+		conf.MaxWait = time.Duration(v) * time.Millisecond
+	}
+	if v := viper.GetInt64("chat.end_of_turn.classifier.grace_ms"); v > 0 {
+		conf.ClassifierGrace = time.Duration(v) * time.Millisecond
+	}
+	return conf.normalized()
+}
+
+// normalized 补齐默认值并保证 MinWait <= BaseWait <= MaxWait
+func (c Config) normalized() Config {
+	if c.BaseWait <= 0 {
+		c.BaseWait = defaultBaseWait
+	}
+	if c.MinWait <= 0 {
+		c.MinWait = defaultMinWait
+	}
+	if c.MaxWait <= 0 {
+		c.MaxWait = defaultMaxWait
+	}
+	if c.MinWait > c.BaseWait {
+		c.MinWait = c.BaseWait
+	}
+	if c.MaxWait < c.BaseWait {
+		c.MaxWait = c.BaseWait
+	}
+	return c
+}
+
+// speedFactor 按智能体语音识别速度缩放等待时长
+func speedFactor(speed string) float64 {
+	switch speed {
+	case SpeedFast:
+		return 0.75
+	case SpeedPatient:
+		return 1.5
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,160 @@
+package turn
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// 判定来源
+const (
+	SourceRule       = "rule"
+	SourceClassifier = "classifier"
+)
+
+// 分类器参与时的判定依据
+const (
+	ReasonClassifierComplete   = "classifier_complete"
+	ReasonClassifierIncomplete = "classifier_incomplete"
+	ReasonClassifierPending    = "classifier_pending"
+)
+
+// Decision 一次断句判定结果
+type Decision struct {
+	End     bool
+	Wait    time.Duration // 本句的自适应等待时长
+	Silence time.Duration // 当前已静音时长
+	Verdict Verdict
+	Reason  string
+	Source  string
+	Text    string
+}
+
+// Detector 语义断句：结合静音时长、ASR 中间文本的结尾特征与可选的 LLM 分类结果，为每句话计算等待时长，
+// 看起来已说完的句子尽快结束，说到一半停顿的句子多等一会儿。
+// Evaluate 只应在同一个音频处理协程中调用，分类请求在后台执行。
+type Detector struct {
+	conf       Config
+	classifier Classifier
+
+	mu      sync.Mutex
+	text    string // 最近一次分类请求对应的文本
+	pending bool
+	verdict Verdict
+	cancel  context.CancelFunc
+}
+
+// NewDetector 创建断句器，classifier 为 nil 时只使用规则
+func NewDetector(conf Config, classifier Classifier) *Detector {
+	return &Detector{
+		conf:       conf.normalized(),
+		classifier: classifier,
+	}
+}
+
+// Evaluate 根据当前识别文本与静音时长判断是否结束本轮语音输入
+func (d *Detector) Evaluate(ctx context.Context, text string, silence time.Duration) Decision {
+	text = strings.TrimSpace(text)
+	verdict, reason := Analyze(text)
+	decision := Decision{
+		Silence: silence,
+		Verdict: verdict,
+		Reason:  reason,
+		Source:  SourceRule,
+		Text:    text,
+	}
+
+	wait := d.waitFor(verdict)
+	if verdict == VerdictUnknown && text != "" && d.classifier != nil {
+		classified, pending := d.classify(ctx, text)
+		switch {
+		case classified == VerdictComplete:
+			decision.Verdict, decision.Reason, decision.Source = classified, ReasonClassifierComplete, SourceClassifier
+			wait = d.waitFor(classified)
+		case classified == VerdictIncomplete:
+			decision.Verdict, decision.Reason, decision.Source = classified, ReasonClassifierIncomplete, SourceClassifier
+			wait = d.waitFor(classified)
+		case pending:
+			// 分类结果未返回时适当多等，超时后按基础等待时长结束
+			decision.Reason = ReasonClassifierPending
+			wait = d.conf.BaseWait + d.conf.ClassifierGrace
+			if wait > d.conf.MaxWait {
+				wait = d.conf.MaxWait
+			}
+		}
+	}
+
+	decision.Wait = time.Duration(float64(wait) * speedFactor(d.conf.Speed))
+	decision.End = silence >= decision.Wait
+	return decision
+}
+
+// Reset 一轮语音输入结束后清空分类状态，取消未完成的分类请求
+func (d *Detector) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel != nil {
+		d.cancel()
+		d.cancel = nil
+	}
+	d.text = ""
+	d.pending = false
+	d.verdict = VerdictUnknown
+}
+
+func (d *Detector) waitFor(verdict Verdict) time.Duration {
+	switch verdict {
+	case VerdictComplete:
+		return d.conf.MinWait
+	case VerdictIncomplete:
+		return d.conf.MaxWait
+	default:
+		return d.conf.BaseWait
+	}
+}
+
+// classify 返回 text 的分类结果；文本变化时取消旧请求并发起新请求，pending 表示结果尚未返回
+func (d *Detector) classify(ctx context.Context, text string) (Verdict, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.text == text {
+		return d.verdict, d.pending
+	}
+
+	if d.cancel != nil {
+		d.cancel()
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	reqCtx, cancel := context.WithCancel(ctx)
+	d.text = text
+	d.pending = true
+	d.verdict = VerdictUnknown
+	d.cancel = cancel
+
+	go func() {
+		defer cancel()
+		start := time.Now()
+		verdict, err := d.classifier.Classify(reqCtx, text)
+		if err != nil {
+			if reqCtx.Err() == nil {
+				log.Debugf("断句分类失败，按规则处理: text=%s, error=%v", text, err)
+			}
+			verdict = VerdictUnknown
+		} else {
+			log.Debugf("断句分类结果: text=%s, verdict=%s, cost=%v", text, verdict, time.Since(start))
+		}
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.text == text {
+			d.pending = false
+			d.verdict = verdict
+		}
+	}()
+	return VerdictUnknown, true
+}
@@ -0,0 +1,168 @@
+package turn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAnalyze(t *testing.T) {
+	cases := []struct {
+		text    string
+		verdict Verdict
+		reason  string
+	}{
+		{"", VerdictUnknown, ReasonNoText},
+		{"今天天气怎么样？", VerdictComplete, ReasonQuestion},
+		{"帮我关灯。", VerdictComplete, ReasonTerminalPunct},
+		{"你能听到我说话吗", VerdictComplete, ReasonFinalParticle},
+		{"我想去北京，", VerdictIncomplete, ReasonTrailingPause},
+		{"我明天要去上海然后", VerdictIncomplete, ReasonTrailingLinker},
+		{"帮我把", VerdictIncomplete, ReasonTrailingLinker},
+		{"我想订一张机票嗯", VerdictIncomplete, ReasonTrailingLinker},
+		{"嗯", VerdictUnknown, ReasonNeutral},
+		{"打开客厅灯", VerdictUnknown, ReasonNeutral},
+		{"I want to go to the", VerdictIncomplete, ReasonTrailingLinker},
+		{"What time is it", VerdictUnknown, ReasonNeutral},
+		{"turn off the light.", VerdictComplete, ReasonTerminalPunct},
+	}
+	for _, c := range cases {
+		verdict, reason := Analyze(c.text)
+		if verdict != c.verdict || reason != c.reason {
+			t.Errorf("Analyze(%q) = %s/%s, want %s/%s", c.text, verdict, reason, c.verdict, c.reason)
+		}
+	}
+}
+
+func testConfig(speed string) Config {
+	return Config{
+		Enabled:         true,
+		BaseWait:        400 * time.Millisecond,
+		MinWait:         200 * time.Millisecond,
+		MaxWait:         1200 * time.Millisecond,
+		Speed:           speed,
+		ClassifierGrace: 300 * time.Millisecond,
+	}
+}
+
+func TestDetectorAdaptiveWait(t *testing.T) {
+	d := NewDetector(testConfig(SpeedNormal), nil)
+	ctx := context.Background()
+
+	if got := d.Evaluate(ctx, "现在几点了？", 250*time.Millisecond); !got.End || got.Wait != 200*time.Millisecond {
+		t.Fatalf("完整问句应在最短等待后结束: %+v", got)
+	}
+	if got := d.Evaluate(ctx, "我想问一下因为", 800*time.Millisecond); got.End || got.Wait != 1200*time.Millisecond {
+		t.Fatalf("以连词结尾应继续等待: %+v", got)
+	}
+	if got := d.Evaluate(ctx, "打开客厅灯", 450*time.Millisecond); !got.End || got.Reason != ReasonNeutral {
+		t.Fatalf("无法判断时按基础等待时长结束: %+v", got)
+	}
+
+	fast := NewDetector(testConfig(SpeedFast), nil)
+	if got := fast.Evaluate(ctx, "打开客厅灯", 310*time.Millisecond); !got.End || got.Wait != 300*time.Millisecond {
+		t.Fatalf("fast 应缩短等待: %+v", got)
+	}
+	patient := NewDetector(testConfig(SpeedPatient), nil)
+	if got := patient.Evaluate(ctx, "打开客厅灯", 500*time.Millisecond); got.End || got.Wait != 600*time.Millisecond {
+		t.Fatalf("patient 应延长等待: %+v", got)
+	}
+}
+
+type fakeClassifier struct {
+	verdict Verdict
+	delay   time.Duration
+	calls   int
+}
+
+func (f *fakeClassifier) Classify(ctx context.Context, text string) (Verdict, error) {
+	f.calls++
+	select {
+	case <-time.After(f.delay):
+		return f.verdict, nil
+	case <-ctx.Done():
+		return VerdictUnknown, ctx.Err()
+	}
+}
+
+func TestDetectorClassifier(t *testing.T) {
+	ctx := context.Background()
+	classifier := &fakeClassifier{verdict: VerdictIncomplete, delay: 20 * time.Millisecond}
+	d := NewDetector(testConfig(SpeedNormal), classifier)
+
+	got := d.Evaluate(ctx, "打开客厅灯", 450*time.Millisecond)
+	if got.End || got.Reason != ReasonClassifierPending || got.Wait != 700*time.Millisecond {
+		t.Fatalf("分类结果返回前应多等: %+v", got)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		got = d.Evaluate(ctx, "打开客厅灯", 800*time.Millisecond)
+		if got.Source == SourceClassifier || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got.End || got.Reason != ReasonClassifierIncomplete || got.Wait != 1200*time.Millisecond {
+		t.Fatalf("分类为未说完时应按最长等待: %+v", got)
+	}
+	if classifier.calls != 1 {
+		t.Fatalf("同一文本只应请求一次分类, calls=%d", classifier.calls)
+	}
+
+	// 规则可以判断时不请求分类
+	d.Reset()
+	if got := d.Evaluate(ctx, "好的谢谢", 250*time.Millisecond); !got.End || got.Source != SourceRule {
+		t.Fatalf("规则已判断为说完: %+v", got)
+	}
+	if classifier.calls != 1 {
+		t.Fatalf("规则命中时不应请求分类, calls=%d", classifier.calls)
+	}
+
+	// 分类器一直不返回时，最多等待 BaseWait + ClassifierGrace
+	slow := NewDetector(testConfig(SpeedNormal), &fakeClassifier{verdict: VerdictIncomplete, delay: time.Hour})
+	defer slow.Reset()
+	slow.Evaluate(ctx, "播放周杰伦", 0)
+	if got := slow.Evaluate(ctx, "播放周杰伦", 710*time.Millisecond); !got.End || got.Reason != ReasonClassifierPending {
+		t.Fatalf("分类超时后应结束: %+v", got)
+	}
+}
+
+func TestOpenAIClassifier(t *testing.T) {
+	answer := "yes"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer sk-test" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var req struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Messages) != 2 || req.Messages[1].Content != "打开客厅灯" {
+			http.Error(w, "bad body", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": answer}}},
+		})
+	}))
+	defer server.Close()
+
+	c := &OpenAIClassifier{BaseURL: server.URL + "/v1/", APIKey: "sk-test", Model: "small"}
+	if v, err := c.Classify(context.Background(), "打开客厅灯"); err != nil || v != VerdictComplete {
+		t.Fatalf("Classify = %s, %v", v, err)
+	}
+	answer = "No."
+	if v, err := c.Classify(context.Background(), "打开客厅灯"); err != nil || v != VerdictIncomplete {
+		t.Fatalf("Classify = %s, %v", v, err)
+	}
+	c.APIKey = "wrong"
+	if _, err := c.Classify(context.Background(), "打开客厅灯"); err == nil {
+		t.Fatal("鉴权失败应返回错误")
+	}
+}
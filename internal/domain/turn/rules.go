@@ -0,0 +1,126 @@
+package turn
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Verdict 对当前识别文本是否已说完的判断
+type Verdict int
+
+const (
+	VerdictUnknown Verdict = iota
+	VerdictComplete
+	VerdictIncomplete
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case VerdictComplete:
+		return "complete"
+	case VerdictIncomplete:
+		return "incomplete"
+	default:
+		return "unknown"
+	}
+}
+
+// 规则判定依据，同时作为 Decision.Reason 与指标标签
+const (
+	ReasonNoText         = "no_text"
+	ReasonTerminalPunct  = "terminal_punct"
+	ReasonQuestion       = "question"
+	ReasonFinalParticle  = "final_particle"
+	ReasonTrailingPause  = "trailing_pause"
+	ReasonTrailingLinker = "trailing_linker"
+	ReasonNeutral        = "neutral"
+)
+
+var (
+	// questionMarks 句末为问号时视为已说完
+	questionMarks = "?？"
+	// terminalPunct 句末标点
+	terminalPunct = "。！!.…~～"
+	// pausePunct 句中停顿标点，说明后面还有内容
+	pausePunct = "，,、；;：:-—"
+
+	// zhFinalParticles 句末语气词，通常表示一句话说完
+	zhFinalParticles = []string{"吗", "呢", "吧", "了", "啦", "呀", "哦", "嘛", "啊", "哈", "喔", "谢谢", "好的", "可以"}
+
+	// zhLinkers 句末的连词、介词与半句话，说明用户还在组织语言
+	zhLinkers = []string{
+		"然后", "而且", "并且", "但是", "可是", "不过", "因为", "所以", "如果", "要是", "或者", "还是", "以及",
+		"还有", "就是", "那个", "这个", "那么", "比如", "的话", "另外", "接着", "之后", "和", "跟", "与", "或",
+		"把", "给", "从", "向", "让", "被", "我想", "我要", "帮我", "请",
+	}
+
+	// zhFillers 犹豫词：跟在其他内容之后表示停顿思考，单独出现时多为应答（“嗯”）
+	zhFillers = []string{"嗯", "呃", "额", "唔"}
+
+	// enLinkers 英文句末的连词、冠词、介词与犹豫词
+	enLinkers = map[string]bool{
+		"and": true, "but": true, "or": true, "so": true, "because": true, "if": true, "then": true,
+		"the": true, "a": true, "an": true, "to": true, "of": true, "for": true, "with": true, "in": true,
+		"on": true, "at": true, "about": true, "my": true, "your": true, "is": true, "are": true,
+		"um": true, "uh": true, "like": true, "i": true, "we": true, "please": true,
+	}
+)
+
+// Analyze 根据 ASR 文本的结尾判断用户是否已说完。只看结尾，对流式识别的累计文本与增量片段同样适用
+func Analyze(text string) (Verdict, string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return VerdictUnknown, ReasonNoText
+	}
+
+	last, _ := utf8.DecodeLastRuneInString(text)
+	switch {
+	case strings.ContainsRune(questionMarks, last):
+		return VerdictComplete, ReasonQuestion
+	case strings.ContainsRune(terminalPunct, last):
+		return VerdictComplete, ReasonTerminalPunct
+	case strings.ContainsRune(pausePunct, last):
+		return VerdictIncomplete, ReasonTrailingPause
+	}
+
+	if isLatin(last) {
+		if enLinkers[strings.ToLower(lastWord(text))] {
+			return VerdictIncomplete, ReasonTrailingLinker
+		}
+		return VerdictUnknown, ReasonNeutral
+	}
+	for _, w := range zhLinkers {
+		if strings.HasSuffix(text, w) {
+			return VerdictIncomplete, ReasonTrailingLinker
+		}
+	}
+	for _, w := range zhFillers {
+		if strings.HasSuffix(text, w) {
+			if strings.Trim(text, strings.Join(zhFillers, "")) == "" {
+				return VerdictUnknown, ReasonNeutral
+			}
+			return VerdictIncomplete, ReasonTrailingLinker
+		}
+	}
+	for _, w := range zhFinalParticles {
+		if strings.HasSuffix(text, w) {
+			return VerdictComplete, ReasonFinalParticle
+		}
+	}
+	return VerdictUnknown, ReasonNeutral
+}
+
+func isLatin(r rune) bool {
+	return r < unicode.MaxLatin1 && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+func lastWord(text string) string {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return !isLatin(r) && r != '\''
+	})
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[len(fields)-1]
+}
@@ -0,0 +1,252 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "xiaozhi"
+
+// 轮次延迟分桶（秒），覆盖首字/首帧的百毫秒级到整轮对话的数十秒
+var latencyBuckets = []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.75, 1, 1.5, 2, 3, 5, 8, 13, 21, 34}
+
+var (
+	registry = prometheus.NewRegistry()
+
+	asrFirstText = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "turn",
+		Name:      "asr_first_text_seconds",
+		Help:      "Latency from turn start to the first ASR text.",
+		Buckets:   latencyBuckets,
+	}, []string{"provider"})
+
+	llmFirstToken = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "turn",
+		Name:      "llm_first_token_seconds",
+		Help:      "Latency from LLM request start to the first token.",
+		Buckets:   latencyBuckets,
+	}, []string{"provider"})
+
+	ttsFirstFrame = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "turn",
+		Name:      "tts_first_frame_seconds",
+		Help:      "Latency from TTS start to the first audio frame.",
+		Buckets:   latencyBuckets,
+	}, []string{"provider"})
+
+	turnEnd = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "turn",
+		Name:      "end_seconds",
+		Help:      "Latency from turn start to turn end.",
+		Buckets:   latencyBuckets,
+	}, []string{"asr_provider", "llm_provider", "tts_provider"})
+
+	intentHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "turn",
+		Name:      "intent_hits_total",
+		Help:      "Turns routed by an intent rule before the LLM.",
+	}, []string{"match_type", "action"})
+
+	endOfTurnWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "turn",
+		Name:      "end_of_turn_wait_seconds",
+		Help:      "Adaptive silence wait chosen by end-of-turn detection, by decision reason.",
+		Buckets:   []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.8, 1, 1.2, 1.6, 2, 2.5, 3},
+	}, []string{"reason"})
+
+	experimentTurns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "experiment",
+		Name:      "turns_total",
+		Help:      "Turns of devices enrolled in an A/B experiment, by outcome (ok, interrupted, error).",
+	}, []string{"experiment", "variant", "outcome"})
+
+	experimentTurnEnd = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "experiment",
+		Name:      "turn_end_seconds",
+		Help:      "Latency from turn start to turn end for devices enrolled in an A/B experiment.",
+		Buckets:   latencyBuckets,
+	}, []string{"experiment", "variant"})
+
+	audioFrontendSeconds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "audio_frontend",
+		Name:      "stage_seconds_total",
+		Help:      "CPU time spent in each uplink audio front-end stage.",
+	}, []string{"stage"})
+
+	audioFrontendFrames = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "audio_frontend",
+		Name:      "frames_total",
+		Help:      "Frames seen by each uplink audio front-end stage, by mode (processed, bypassed).",
+	}, []string{"stage", "mode"})
+
+	handlerOnce sync.Once
+	handler     http.Handler
+
+	turnObserversMu sync.RWMutex
+	turnObservers   []func(TurnSample)
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		asrFirstText,
+		llmFirstToken,
+		ttsFirstFrame,
+		turnEnd,
+		intentHits,
+		endOfTurnWait,
+		experimentTurns,
+		experimentTurnEnd,
+		audioFrontendSeconds,
+		audioFrontendFrames,
+	)
+}
+
+// TurnSample 一轮对话的各阶段耗时，零值表示该阶段未发生
+type TurnSample struct {
+	AsrProvider string
+	LlmProvider string
+	TtsProvider string
+
+	AsrFirstText  time.Duration
+	LlmFirstToken time.Duration
+	TtsFirstFrame time.Duration
+	TurnEnd       time.Duration
+
+	// IntentMatchType / IntentAction 本轮命中的意图规则，为空表示未命中
+	IntentMatchType string
+	IntentAction    string
+
+	// EndOfTurnReason / EndOfTurnWait 语义断句的判定依据与等待时长，为空表示按固定静音阈值结束
+	EndOfTurnReason string
+	EndOfTurnWait   time.Duration
+
+	// DeviceID / SessionID 仅供轮次订阅方使用，不作为指标标签
+	DeviceID  string
+	SessionID string
+	// Experiment / Variant 本轮所属的 A/B 实验 ID 与分组，为空表示未参与实验
+	Experiment string
+	Variant    string
+	// Interrupted 本轮被用户打断；Error 本轮失败原因（打断不计为失败）
+	Interrupted bool
+	Error       string
+}
+
+// Outcome 本轮结果：ok / interrupted / error
+func (s TurnSample) Outcome() string {
+	switch {
+	case s.Error != "":
+		return "error"
+	case s.Interrupted:
+		return "interrupted"
+	default:
+		return "ok"
+	}
+}
+
+// ObserveTurn 记录一轮对话的延迟指标
+func ObserveTurn(sample TurnSample) {
+	if sample.AsrFirstText > 0 {
+		asrFirstText.WithLabelValues(labelValue(sample.AsrProvider)).Observe(sample.AsrFirstText.Seconds())
+	}
+	if sample.LlmFirstToken > 0 {
+		llmFirstToken.WithLabelValues(labelValue(sample.LlmProvider)).Observe(sample.LlmFirstToken.Seconds())
+	}
+	if sample.TtsFirstFrame > 0 {
+		ttsFirstFrame.WithLabelValues(labelValue(sample.TtsProvider)).Observe(sample.TtsFirstFrame.Seconds())
+	}
+	if sample.TurnEnd > 0 {
+		turnEnd.WithLabelValues(
+			labelValue(sample.AsrProvider),
+			labelValue(sample.LlmProvider),
+			labelValue(sample.TtsProvider),
+		).Observe(sample.TurnEnd.Seconds())
+	}
+	if sample.IntentAction != "" {
+		intentHits.WithLabelValues(labelValue(sample.IntentMatchType), sample.IntentAction).Inc()
+	}
+	if sample.EndOfTurnReason != "" {
+		endOfTurnWait.WithLabelValues(sample.EndOfTurnReason).Observe(sample.EndOfTurnWait.Seconds())
+	}
+	if sample.Experiment != "" {
+		variant := labelValue(sample.Variant)
+		experimentTurns.WithLabelValues(sample.Experiment, variant, sample.Outcome()).Inc()
+		if sample.TurnEnd > 0 {
+			experimentTurnEnd.WithLabelValues(sample.Experiment, variant).Observe(sample.TurnEnd.Seconds())
+		}
+	}
+
+	turnObserversMu.RLock()
+	observers := turnObservers
+	turnObserversMu.RUnlock()
+	for _, fn := range observers {
+		fn(sample)
+	}
+}
+
+// ObserveAudioFrontend 累加一路会话中某一级音频前端处理的耗时与帧数，bypassedFrames 为超出 CPU 预算被直通的帧
+func ObserveAudioFrontend(stage string, cost time.Duration, frames, bypassedFrames int) {
+	stage = labelValue(stage)
+	if cost > 0 {
+		audioFrontendSeconds.WithLabelValues(stage).Add(cost.Seconds())
+	}
+	if processed := frames - bypassedFrames; processed > 0 {
+		audioFrontendFrames.WithLabelValues(stage, "processed").Add(float64(processed))
+	}
+	if bypassedFrames > 0 {
+		audioFrontendFrames.WithLabelValues(stage, "bypassed").Add(float64(bypassedFrames))
+	}
+}
+
+// OnTurn 订阅每轮对话的完整样本（如实验结果上报），回调在指标协程中同步执行，需尽快返回
+func OnTurn(fn func(TurnSample)) {
+	if fn == nil {
+		return
+	}
+	turnObserversMu.Lock()
+	defer turnObserversMu.Unlock()
+	turnObservers = append(turnObservers, fn)
+}
+
+// MustRegister 注册额外的采集器（资源池、会话等按需拉取的指标）
+func MustRegister(cs ...prometheus.Collector) {
+	registry.MustRegister(cs...)
+}
+
+// Registry 返回内部注册表，便于测试读取
+func Registry() *prometheus.Registry {
+	return registry
+}
+
+// Handler 返回 /metrics 的 HTTP 处理器，支持 Prometheus 文本格式与 OpenMetrics 协商
+func Handler() http.Handler {
+	handlerOnce.Do(func() {
+		handler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+			EnableOpenMetrics: true,
+		})
+	})
+	return handler
+}
+
+func labelValue(v string) string {
+	if v == "" {
+		return "unknown"
+	}
+	return v
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveTurnSkipsMissingStages(t *testing.T) {
+	before := testutil.CollectAndCount(ttsFirstFrame)
+
+	ObserveTurn(TurnSample{
+		AsrProvider:   "funasr",
+		LlmProvider:   "openai",
+		AsrFirstText:  300 * time.Millisecond,
+		LlmFirstToken: 500 * time.Millisecond,
+		TurnEnd:       2 * time.Second,
+	})
+
+	if got := testutil.CollectAndCount(ttsFirstFrame); got != before {
+		t.Fatalf("tts_first_frame series = %d, want %d", got, before)
+	}
+	if got := testutil.CollectAndCount(asrFirstText); got == 0 {
+		t.Fatalf("expected asr_first_text to be observed")
+	}
+}
+
+func TestHandlerExposesTurnHistograms(t *testing.T) {
+	ObserveTurn(TurnSample{LlmProvider: "ollama", LlmFirstToken: 120 * time.Millisecond})
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rec.Body.String()
+	if !strings.Contains(body, `xiaozhi_turn_llm_first_token_seconds_bucket{provider="ollama"`) {
+		t.Fatalf("metrics output missing llm first token histogram:\n%s", body)
+	}
+}
+
+func TestObserveTurnTagsExperiment(t *testing.T) {
+	var got []TurnSample
+	OnTurn(func(s TurnSample) { got = append(got, s) })
+
+	ObserveTurn(TurnSample{Experiment: "3", Variant: "B", TurnEnd: time.Second})
+	ObserveTurn(TurnSample{Experiment: "3", Variant: "B", Interrupted: true})
+
+	if v := testutil.ToFloat64(experimentTurns.WithLabelValues("3", "B", "ok")); v != 1 {
+		t.Fatalf("ok turns = %v, want 1", v)
+	}
+	if v := testutil.ToFloat64(experimentTurns.WithLabelValues("3", "B", "interrupted")); v != 1 {
+		t.Fatalf("interrupted turns = %v, want 1", v)
+	}
+	if len(got) != 2 || got[1].Outcome() != "interrupted" {
+		t.Fatalf("turn observers got %+v", got)
+	}
+}
+
+func TestObserveAudioFrontend(t *testing.T) {
+	ObserveAudioFrontend("noise_suppression", 30*time.Millisecond, 100, 40)
+
+	if v := testutil.ToFloat64(audioFrontendFrames.WithLabelValues("noise_suppression", "processed")); v != 60 {
+		t.Fatalf("processed frames = %v, want 60", v)
+	}
+	if v := testutil.ToFloat64(audioFrontendFrames.WithLabelValues("noise_suppression", "bypassed")); v != 40 {
+		t.Fatalf("bypassed frames = %v, want 40", v)
+	}
+	if v := testutil.ToFloat64(audioFrontendSeconds.WithLabelValues("noise_suppression")); v < 0.029 || v > 0.031 {
+		t.Fatalf("stage seconds = %v, want 0.03", v)
+	}
+}
+
+func TestObserveTurnRecordsEndOfTurnWait(t *testing.T) {
+	ObserveTurn(TurnSample{EndOfTurnReason: "question", EndOfTurnWait: 250 * time.Millisecond})
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `xiaozhi_turn_end_of_turn_wait_seconds_count{reason="question"} 1`) {
+		t.Fatalf("metrics output missing end of turn histogram:\n%s", body)
+	}
+}
@@ -0,0 +1,168 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "xiaozhi-esp32-server-golang"
+
+	defaultServiceName = "xiaozhi-esp32-server"
+	defaultEndpoint    = "localhost:4318"
+)
+
+// Config 链路追踪配置（对应 config.yaml 中的 tracing 段）
+type Config struct {
+	Enable      bool
+	Endpoint    string            // OTLP/HTTP 地址，host:port
+	URLPath     string            // 默认 /v1/traces
+	Insecure    bool              // 是否使用 http 而非 https
+	Headers     map[string]string // 额外请求头，如鉴权 token
+	SampleRatio float64           // 采样率 0~1，<=0 时按 1 处理
+	ServiceName string
+}
+
+// ConfigFromViper 从 viper 读取 tracing 配置
+func ConfigFromViper() Config {
+	cfg := Config{
+		Enable:      viper.GetBool("tracing.enable"),
+		Endpoint:    viper.GetString("tracing.endpoint"),
+		URLPath:     viper.GetString("tracing.url_path"),
+		Insecure:    viper.GetBool("tracing.insecure"),
+		Headers:     viper.GetStringMapString("tracing.headers"),
+		SampleRatio: viper.GetFloat64("tracing.sample_ratio"),
+		ServiceName: viper.GetString("tracing.service_name"),
+	}
+	return cfg
+}
+
+var (
+	transportOnce sync.Once
+	enabled       atomic.Bool
+)
+
+// Init 初始化全局 TracerProvider 与 W3C 传播器，返回用于退出时刷新导出的 shutdown 函数。
+// 未启用时只设置传播器，span 由 otel 默认的 noop provider 丢弃。
+func Init(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !cfg.Enable {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+	if cfg.URLPath != "" {
+		opts = append(opts, otlptracehttp.WithURLPath(cfg.URLPath))
+	}
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("创建 OTLP 导出器失败: %w", err)
+	}
+
+	tp := NewTracerProvider(cfg, sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(5*time.Second)))
+	SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// NewTracerProvider 按配置的服务名与采样率创建 TracerProvider，测试可传入内存导出器
+func NewTracerProvider(cfg Config, opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	ratio := cfg.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+	res := resource.NewSchemaless(semconv.ServiceName(serviceName))
+	base := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	}
+	return sdktrace.NewTracerProvider(append(base, opts...)...)
+}
+
+// SetTracerProvider 设置全局 TracerProvider，并让默认 HTTP 客户端携带 trace 上下文
+func SetTracerProvider(tp trace.TracerProvider) {
+	otel.SetTracerProvider(tp)
+	enabled.Store(true)
+	transportOnce.Do(func() {
+		// 大部分 provider 直接使用默认 Transport，这里统一包一层以传播 traceparent
+		http.DefaultTransport = HTTPTransport(http.DefaultTransport)
+	})
+}
+
+// Tracer 返回本服务使用的 tracer
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start 创建子 span，父 span 取自 ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End 结束 span，err 非空时记录错误并标记状态
+func End(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// HTTPTransport 包装 RoundTripper，为出站 HTTP 请求创建 client span 并注入 traceparent
+func HTTPTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(base, otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return "HTTP " + r.Method + " " + r.URL.Host
+	}))
+}
+
+// InjectHeader 返回注入了 trace 上下文的请求头副本，供 WebSocket 握手使用；
+// 未启用追踪或 ctx 中没有有效 span 时原样返回，不修改传入的 header。
+func InjectHeader(ctx context.Context, header http.Header) http.Header {
+	if !enabled.Load() || ctx == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+		return header
+	}
+	out := http.Header{}
+	for k, v := range header {
+		out[k] = append([]string(nil), v...)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(out))
+	return out
+}
@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func setupInMemory(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	if _, err := Init(context.Background(), Config{}); err != nil {
+		t.Fatalf("init propagator: %v", err)
+	}
+	SetTracerProvider(NewTracerProvider(Config{ServiceName: "test"}, sdktrace.WithSyncer(exporter)))
+	return exporter
+}
+
+func TestEndRecordsErrorStatus(t *testing.T) {
+	exporter := setupInMemory(t)
+
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child")
+	End(child, errors.New("boom"))
+	End(parent, nil)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	childSpan, parentSpan := spans[0], spans[1]
+	if childSpan.Parent.SpanID() != parentSpan.SpanContext.SpanID() {
+		t.Fatalf("expected child to be parented to %s", parentSpan.Name)
+	}
+	if childSpan.Status.Code != codes.Error || len(childSpan.Events) == 0 {
+		t.Fatalf("expected child error status and event, got %+v", childSpan.Status)
+	}
+	if parentSpan.Status.Code == codes.Error {
+		t.Fatal("expected parent status to stay unset")
+	}
+}
+
+func TestInjectHeaderCopiesAndAddsTraceparent(t *testing.T) {
+	setupInMemory(t)
+
+	original := http.Header{"Authorization": []string{"Bearer x"}}
+	if got := InjectHeader(context.Background(), original); got.Get("traceparent") != "" {
+		t.Fatal("expected no traceparent without an active span")
+	}
+
+	ctx, span := Start(context.Background(), "dial")
+	defer span.End()
+	injected := InjectHeader(ctx, original)
+	if injected.Get("traceparent") == "" {
+		t.Fatal("expected traceparent to be injected")
+	}
+	if injected.Get("Authorization") != "Bearer x" {
+		t.Fatal("expected existing headers to be kept")
+	}
+	if original.Get("traceparent") != "" {
+		t.Fatal("expected original header to be left untouched")
+	}
+}
@@ -0,0 +1,52 @@
+// dbmigrate 将管理后台数据从一个数据库完整复制到另一个数据库，典型用法是 SQLite/MySQL 迁移到 PostgreSQL：
+//
+//	go run ./cmd/dbmigrate -from config/config.json -to config/config.postgres.json
+//
+// 两个配置文件只读取 database 段。目标库会自动建表，默认要求目标库为空，-truncate 可清空后覆盖。
+package main
+
+import (
+	"flag"
+	"log"
+	"xiaozhi/manager/backend/config"
+	"xiaozhi/manager/backend/database"
+)
+
+func main() {
+	var fromFile, toFile string
+	var opts database.CopyOptions
+	flag.StringVar(&fromFile, "from", "config/config.json", "源数据库所在的配置文件")
+	flag.StringVar(&toFile, "to", "", "目标数据库所在的配置文件")
+	flag.IntVar(&opts.BatchSize, "batch", 500, "每批复制的行数")
+	flag.BoolVar(&opts.Truncate, "truncate", false, "目标库已有数据时先清空")
+	flag.Parse()
+
+	if toFile == "" {
+		log.Fatal("请通过 -to 指定目标数据库配置文件")
+	}
+
+	srcCfg := config.LoadFromFile(fromFile).Database
+	dstCfg := config.LoadFromFile(toFile).Database
+	log.Printf("源数据库: %s (%s) -> 目标数据库: %s (%s)", srcCfg.GetStorageType(), fromFile, dstCfg.GetStorageType(), toFile)
+
+	src, err := database.Open(srcCfg)
+	if err != nil {
+		log.Fatalf("连接源数据库失败: %v", err)
+	}
+	defer database.Close(src)
+	dst, err := database.Open(dstCfg)
+	if err != nil {
+		log.Fatalf("连接目标数据库失败: %v", err)
+	}
+	defer database.Close(dst)
+
+	results, err := database.CopyData(src, dst, opts)
+	if err != nil {
+		log.Fatalf("数据迁移失败: %v", err)
+	}
+	var total int64
+	for _, r := range results {
+		total += r.Rows
+	}
+	log.Printf("数据迁移完成，共 %d 张表、%d 条记录", len(results), total)
+}
@@ -14,22 +14,33 @@ type Config struct {
 	SpeakerService SpeakerServiceConfig `json:"speaker_service"`
 	Storage        StorageConfig        `json:"storage"`
 	History        HistoryConfig        `json:"history"`
+	Webhook        WebhookConfig        `json:"webhook"`
+	SSO            SSOConfig            `json:"sso"`
+
+	Path string `json:"-"` // 加载时使用的配置文件路径，安装向导保存数据库选择时回写
 }
 
 type ServerConfig struct {
 	Port string `json:"port"`
 	Mode string `json:"mode"`
+	// TrustedProxies 可信反向代理的 IP/CIDR，只有来自这些地址的请求才采信 X-Forwarded-For / X-Real-IP；
+	// 为空时一律使用连接来源地址，避免伪造请求头绕过 API Token 的 IP 白名单
+	TrustedProxies []string `json:"trusted_proxies"`
+	// InternalSecret 主程序调用敏感内部接口（如获取 MCP OAuth 令牌）时携带的共享密钥，需与主程序 manager.internal_secret 一致；
+	// 为空时这些接口仅允许本机访问
+	InternalSecret string `json:"internal_secret"`
 }
 
 type DatabaseConfig struct {
-	Type   string        `json:"type"`             // "mysql" 或 "sqlite"，决定使用哪种数据库
-	MySQL  *MySQLConfig  `json:"mysql,omitempty"`
-	SQLite *SQLiteConfig `json:"sqlite,omitempty"`
+	Type     string          `json:"type"`             // "mysql"、"sqlite" 或 "postgres"，决定使用哪种数据库
+	MySQL    *MySQLConfig    `json:"mysql,omitempty"`
+	SQLite   *SQLiteConfig   `json:"sqlite,omitempty"`
+	Postgres *PostgresConfig `json:"postgres,omitempty"`
 }
 
 // GetStorageType 获取当前配置的存储类型
 func (c *DatabaseConfig) GetStorageType() string {
-	if c.Type == "sqlite" || c.Type == "mysql" {
+	if c.Type == "sqlite" || c.Type == "mysql" || c.Type == "postgres" {
 		return c.Type
 	}
 	// 未设置 type 时，根据已有配置推断
@@ -51,6 +62,18 @@ type MySQLConfig struct {
 	Database string `json:"database"`
 }
 
+// PostgresConfig PostgreSQL 数据库配置
+type PostgresConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Database string `json:"database"`
+	SSLMode  string `json:"sslmode,omitempty"` // disable/require/verify-full，默认 disable
+	Schema   string `json:"schema,omitempty"`  // 默认 public
+	TimeZone string `json:"timezone,omitempty"`
+}
+
 // SQLiteConfig SQLite 数据库配置
 type SQLiteConfig struct {
 	FilePath string `json:"file_path"` // 数据库文件路径，如 ./data/xiaozhi.db
@@ -76,12 +99,74 @@ type HistoryConfig struct {
 	MaxFileSize   int64  `json:"max_file_size"`   // 最大文件大小(字节)，默认10MB
 }
 
+// WebhookConfig 外部事件推送，未配置的字段使用默认值
+type WebhookConfig struct {
+	MaxAttempts        int `json:"max_attempts"`         // 最大投递次数，超过后进入死信，默认6
+	BaseBackoffSeconds int `json:"base_backoff_seconds"` // 首次重试间隔，之后指数递增，默认10
+	TimeoutSeconds     int `json:"timeout_seconds"`      // 单次请求超时，默认10
+	RetentionDays      int `json:"retention_days"`       // 成功投递记录保留天数，默认30
+	// AllowPrivateNetwork 允许投递到内网/回环/链路本地地址，默认 false；仅在接收方部署在内网时开启
+	AllowPrivateNetwork bool `json:"allow_private_network"`
+}
+
+// SSOConfig 单点登录：OIDC（授权码 + PKCE）与 LDAP 绑定，首次登录自动创建用户，IdP 分组映射到系统角色与组织
+type SSOConfig struct {
+	PublicURL         string               `json:"public_url"`          // manager 对外访问地址，用于拼接回调地址；为空时按请求推断
+	OIDC              []OIDCProviderConfig `json:"oidc"`                // 可配置多个 OIDC 身份提供方
+	LDAP              LDAPConfig           `json:"ldap"`                // LDAP 绑定登录
+	GroupMappings     []SSOGroupMapping    `json:"group_mappings"`      // IdP 分组映射
+	DefaultRole       string               `json:"default_role"`        // 未命中映射时的系统角色，默认 user
+	LinkByEmail       bool                 `json:"link_by_email"`       // 邮箱已验证且与本地用户一致时关联到该用户
+	DisableLocalLogin bool                 `json:"disable_local_login"` // 配置了单点登录时禁用本地密码登录与注册（管理员账号除外，便于应急）
+}
+
+// OIDCProviderConfig 单个 OIDC 身份提供方
+type OIDCProviderConfig struct {
+	Name          string   `json:"name"`         // 标识，出现在回调地址中：/api/auth/oidc/{name}/callback
+	DisplayName   string   `json:"display_name"` // 登录页按钮文字
+	Issuer        string   `json:"issuer"`       // 例如 https://keycloak.example.com/realms/xiaozhi
+	ClientID      string   `json:"client_id"`
+	ClientSecret  string   `json:"client_secret"`  // 公共客户端可留空，仅依赖 PKCE
+	Scopes        []string `json:"scopes"`         // 默认 openid profile email
+	UsernameClaim string   `json:"username_claim"` // 默认 preferred_username
+	GroupsClaim   string   `json:"groups_claim"`   // 默认 groups
+}
+
+// LDAPConfig LDAP 绑定登录：先用服务账号查找用户 DN，再以用户密码绑定校验
+type LDAPConfig struct {
+	Enabled            bool   `json:"enabled"`
+	URL                string `json:"url"` // ldap://host:389 或 ldaps://host:636
+	StartTLS           bool   `json:"start_tls"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	BindDN             string `json:"bind_dn"` // 服务账号，为空时匿名查找
+	BindPassword       string `json:"bind_password"`
+	BaseDN             string `json:"base_dn"`
+	UserFilter         string `json:"user_filter"`          // 默认 (uid=%s)，%s 为转义后的用户名
+	UsernameAttribute  string `json:"username_attribute"`   // 默认 uid
+	EmailAttribute     string `json:"email_attribute"`      // 默认 mail
+	GroupAttribute     string `json:"group_attribute"`      // 用户条目上的分组属性，默认 memberOf（取 DN 中第一个 RDN 的值）
+	GroupBaseDN        string `json:"group_base_dn"`        // 设置后按 group_filter 额外搜索分组
+	GroupFilter        string `json:"group_filter"`         // 默认 (member=%s)，%s 为转义后的用户 DN
+	GroupNameAttribute string `json:"group_name_attribute"` // 默认 cn
+}
+
+// SSOGroupMapping IdP 分组映射：Role 映射系统角色（admin/user），Org 映射组织成员角色。
+// 组织按 OrgKey 匹配由单点登录创建的组织，不会匹配用户自建的同名组织
+type SSOGroupMapping struct {
+	Group   string `json:"group"`
+	Role    string `json:"role,omitempty"`     // 系统角色
+	Org     string `json:"org,omitempty"`      // 组织名称，对应组织不存在时以该名称自动创建
+	OrgKey  string `json:"org_key,omitempty"`  // 组织的稳定标识，默认与 org 相同；修改 org 显示名称时保持不变即可沿用原组织
+	OrgRole string `json:"org_role,omitempty"` // owner/editor/operator/viewer，默认 viewer
+}
+
 func Load() *Config {
 	return LoadWithPath("config/config.json")
 }
 
 func LoadWithPath(configPath string) *Config {
 	config := LoadFromFile(configPath)
+	config.Path = configPath
 
 	// 仅当使用 MySQL 时，确保有 MySQL 配置并应用环境变量覆盖
 	if config.Database.GetStorageType() == "mysql" {
@@ -107,6 +192,33 @@ func LoadWithPath(configPath string) *Config {
 		}
 	}
 
+	// PostgreSQL 复用同一组 DB_* 环境变量
+	if config.Database.GetStorageType() == "postgres" {
+		if config.Database.Postgres == nil {
+			config.Database.Postgres = &PostgresConfig{}
+		}
+		if host := os.Getenv("DB_HOST"); host != "" {
+			config.Database.Postgres.Host = host
+		}
+		if port := os.Getenv("DB_PORT"); port != "" {
+			var p int
+			fmt.Sscanf(port, "%d", &p)
+			config.Database.Postgres.Port = p
+		}
+		if username := os.Getenv("DB_USER"); username != "" {
+			config.Database.Postgres.Username = username
+		}
+		if password := os.Getenv("DB_PASSWORD"); password != "" {
+			config.Database.Postgres.Password = password
+		}
+		if database := os.Getenv("DB_NAME"); database != "" {
+			config.Database.Postgres.Database = database
+		}
+		if sslMode := os.Getenv("DB_SSLMODE"); sslMode != "" {
+			config.Database.Postgres.SSLMode = sslMode
+		}
+	}
+
 	// 优先使用环境变量覆盖声纹服务配置
 	if serviceURL := os.Getenv("SPEAKER_SERVICE_URL"); serviceURL != "" {
 		config.SpeakerService.URL = serviceURL
@@ -115,6 +227,10 @@ func LoadWithPath(configPath string) *Config {
 	if audioBasePath := os.Getenv("AUDIO_BASE_PATH"); audioBasePath != "" {
 		config.History.AudioBasePath = audioBasePath
 	}
+	// 内部接口共享密钥，容器部署时与主程序使用同一个 INTERNAL_SECRET
+	if secret := os.Getenv("INTERNAL_SECRET"); secret != "" {
+		config.Server.InternalSecret = secret
+	}
 
 	fmt.Println("config", config)
 
@@ -136,3 +252,25 @@ func LoadFromFile(configPath string) *Config {
 
 	return &config
 }
+
+// SaveDatabaseConfig 仅替换配置文件中的 database 段，其余配置原样保留
+func SaveDatabaseConfig(configPath string, dbConfig DatabaseConfig) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("解析配置文件失败: %w", err)
+	}
+	section, err := json.Marshal(dbConfig)
+	if err != nil {
+		return err
+	}
+	raw["database"] = section
+	out, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(configPath, append(out, '\n'), 0644)
+}
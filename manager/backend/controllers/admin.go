@@ -53,6 +53,18 @@ func normalizeAgentMemoryMode(mode string) string {
 	}
 }
 
+// normalizeAgentASRSpeed 规范化智能体语音识别速度，未知值按 normal 处理
+func normalizeAgentASRSpeed(speed string) string {
+	switch strings.ToLower(strings.TrimSpace(speed)) {
+	case "patient":
+		return "patient"
+	case "fast":
+		return "fast"
+	default:
+		return "normal"
+	}
+}
+
 type AdminController struct {
 	DB                  *gorm.DB
 	WebSocketController *WebSocketController
@@ -99,12 +111,22 @@ func (ac *AdminController) GetDeviceConfigs(c *gin.Context) {
 		Memory          models.Config               `json:"memory"`
 		VoiceIdentify   map[string]SpeakerGroupInfo `json:"voice_identify"`
 		KnowledgeBases  []KnowledgeBaseInfo         `json:"knowledge_bases"`
+		IntentRules     []IntentRuleInfo            `json:"intent_rules"`
+		MCPResources    []agentMCPResource          `json:"mcp_resources"`
+		ToolPolicies    []agentToolPolicy           `json:"tool_policies"`
+		AudioFrontend   *agentAudioFrontend         `json:"audio_frontend,omitempty"`
 		Prompt          string                      `json:"prompt"`
 		AgentID         string                      `json:"agent_id"`
+		AgentName       string                      `json:"agent_name"`
 		MemoryMode      string                      `json:"memory_mode"`
+		AsrSpeed        string                      `json:"asr_speed"`
 		MCPServiceNames string                      `json:"mcp_service_names"`
 		OpenClaw        OpenClawConfigResponse      `json:"openclaw"`
-		ConfigSource    string                      `json:"config_source"` // 新增：配置来源
+		ConfigSource    string                      `json:"config_source"`             // 新增：配置来源
+		AgentRevision   int                         `json:"agent_revision,omitempty"`  // 下发的智能体已发布版本号，0 表示当前配置
+		Experiment      *experimentConfigInfo       `json:"experiment,omitempty"`      // 智能体运行中的 A/B 实验
+		PromptVars      *promptVarsResponse         `json:"prompt_vars,omitempty"`     // 提示词模板的设备变量
+		PromptSnippets  map[string]string           `json:"prompt_snippets,omitempty"` // 组织共享的提示词片段
 	}
 
 	var response ConfigResponse
@@ -150,10 +172,57 @@ func (ac *AdminController) GetDeviceConfigs(c *gin.Context) {
 		}
 	}
 
+	// 多智能体转接：agent_name 指定设备所属组织下的其它智能体，按该智能体配置下发（设备绑定角色不参与）
+	if agentName := strings.TrimSpace(c.Query("agent_name")); agentName != "" {
+		if device.ID == 0 || device.UserID == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "设备不存在或未绑定用户，无法转接智能体"})
+			return
+		}
+		agentQuery := ac.DB.Where("org_id = ?", device.OrgID)
+		if device.OrgID == 0 {
+			agentQuery = ac.DB.Where("user_id = ?", device.UserID)
+		}
+		var agents []models.Agent
+		if err := agentQuery.Order("id ASC").Find(&agents).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query agents"})
+			return
+		}
+		target := matchAgentByName(agentName, agents, device.AgentID)
+		if target == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("未找到匹配的智能体: %s", agentName)})
+			return
+		}
+		agent = *target
+		deviceFound = true
+		configSource = ""
+		device.RoleID = nil
+		response.AgentID = fmt.Sprintf("%d", agent.ID)
+		log.Printf("设备 %s 转接智能体: 请求=%s, 匹配=%s(%d)", deviceID, agentName, agent.Name, agent.ID)
+	}
+
+	// 智能体设置了已发布版本时按发布快照下发；draft=true 用于草稿测试，始终使用当前配置
+	var publishedKBIDs []uint
+	usePublished := false
+	if deviceFound && agent.ID != 0 && agent.PublishedRevisionID != nil && c.Query("draft") != "true" {
+		if snap, rev, err := publishedAgentSnapshot(ac.DB, agent); err == nil {
+			snap.ApplyToAgent(&agent)
+			publishedKBIDs = snap.KnowledgeBaseIDs
+			usePublished = true
+			response.AgentRevision = rev.Version
+		} else {
+			log.Printf("读取智能体 %d 已发布版本失败，使用当前配置: %v", agent.ID, err)
+		}
+	}
+
 	if deviceFound && agent.ID != 0 {
+		response.AgentName = agent.Name
 		response.MemoryMode = normalizeAgentMemoryMode(agent.MemoryMode)
+		response.AsrSpeed = normalizeAgentASRSpeed(agent.ASRSpeed)
 		response.MCPServiceNames = normalizeMCPServiceNamesCSV(agent.MCPServiceNames)
 		response.OpenClaw = buildOpenClawConfigFromAgent(agent)
+		response.MCPResources = parseAgentMCPResources(agent.MCPResources)
+		response.ToolPolicies = parseAgentToolPolicies(agent.ToolPolicies)
+		response.AudioFrontend = parseAgentAudioFrontend(agent.AudioFrontend)
 	}
 
 	cloneVoiceCache := make(map[string]bool)
@@ -172,11 +241,11 @@ func (ac *AdminController) GetDeviceConfigs(c *gin.Context) {
 
 		var count int64
 		err := ac.DB.Model(&models.VoiceClone{}).
-			Where("user_id = ? AND provider = ? AND tts_config_id = ? AND provider_voice_id = ? AND status = ?",
-				device.UserID, "aliyun_qwen", ttsConfigID, voiceID, voiceCloneStatusActive).
+			Where("org_id = ? AND provider = ? AND tts_config_id = ? AND provider_voice_id = ? AND status = ?",
+				device.OrgID, "aliyun_qwen", ttsConfigID, voiceID, voiceCloneStatusActive).
 			Count(&count).Error
 		if err != nil {
-			log.Printf("检测千问复刻音色失败: user_id=%d tts_config_id=%s voice_id=%s err=%v", device.UserID, ttsConfigID, voiceID, err)
+			log.Printf("检测千问复刻音色失败: org_id=%d tts_config_id=%s voice_id=%s err=%v", device.OrgID, ttsConfigID, voiceID, err)
 			cloneVoiceCache[cacheKey] = false
 			return false
 		}
@@ -305,6 +374,23 @@ func (ac *AdminController) GetDeviceConfigs(c *gin.Context) {
 				}
 			}
 		}
+
+		// 智能体有运行中的实验时一并下发各分组覆盖项，由主程序按设备选择分组
+		response.Experiment = buildRunningExperimentConfig(ac.DB, agent, response.TTS, func(cfg *models.Config, voice *string) {
+			var ttsConfigData map[string]interface{}
+			if err := json.Unmarshal([]byte(cfg.JsonData), &ttsConfigData); err != nil {
+				return
+			}
+			if cfg.Provider == "cosyvoice" {
+				ttsConfigData["spk_id"] = *voice
+			} else {
+				ttsConfigData["voice"] = *voice
+			}
+			applyAliyunQwenCloneModel(cfg.Provider, cfg.ConfigID, voice, ttsConfigData)
+			if updatedJsonData, err := json.Marshal(ttsConfigData); err == nil {
+				cfg.JsonData = string(updatedJsonData)
+			}
+		})
 	}
 
 	// 3. 使用默认全局角色（兜底）
@@ -370,6 +456,15 @@ func (ac *AdminController) GetDeviceConfigs(c *gin.Context) {
 	// 记录配置来源
 	response.ConfigSource = configSource
 
+	// 提示词模板变量与共享片段，主程序每轮对话渲染提示词时使用
+	if device.ID != 0 {
+		// 设备级音频前端配置逐项覆盖智能体配置
+		response.AudioFrontend = mergeAudioFrontend(response.AudioFrontend, parseAgentAudioFrontend(device.AudioFrontend))
+		vars := buildPromptVars(device)
+		response.PromptVars = &vars
+		response.PromptSnippets = loadPromptSnippets(ac.DB, device.OrgID)
+	}
+
 	// ==================== 其他配置（VAD、ASR、Memory、VoiceIdentify） ====================
 
 	// 获取VAD默认配置
@@ -465,7 +560,15 @@ func (ac *AdminController) GetDeviceConfigs(c *gin.Context) {
 	response.KnowledgeBases = make([]KnowledgeBaseInfo, 0)
 	if deviceFound && agent.ID != 0 {
 		var links []models.AgentKnowledgeBase
-		if err := ac.DB.Where("agent_id = ?", agent.ID).Order("id ASC").Find(&links).Error; err == nil && len(links) > 0 {
+		var linkErr error
+		if usePublished {
+			for _, kbID := range publishedKBIDs {
+				links = append(links, models.AgentKnowledgeBase{AgentID: agent.ID, KnowledgeBaseID: kbID})
+			}
+		} else {
+			linkErr = ac.DB.Where("agent_id = ?", agent.ID).Order("id ASC").Find(&links).Error
+		}
+		if linkErr == nil && len(links) > 0 {
 			kbIDs := make([]uint, 0, len(links))
 			for _, link := range links {
 				kbIDs = append(kbIDs, link.KnowledgeBaseID)
@@ -510,6 +613,16 @@ func (ac *AdminController) GetDeviceConfigs(c *gin.Context) {
 		}
 	}
 
+	// 下发智能体意图路由规则（仅启用的规则，按优先级排序）
+	response.IntentRules = make([]IntentRuleInfo, 0)
+	if deviceFound && agent.ID != 0 {
+		if rules, err := loadAgentIntentRules(ac.DB, agent.ID, true); err == nil {
+			response.IntentRules = rules
+		} else {
+			log.Printf("加载智能体 %d 意图规则失败: %v", agent.ID, err)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"data": response})
 }
 
@@ -1337,6 +1450,11 @@ func (ac *AdminController) getConfigItemByTypeAndID(typ, configID string) map[st
 	if err := ac.DB.Where("type = ? AND config_id = ?", typ, configID).First(&config).Error; err != nil {
 		return nil
 	}
+	return buildConfigItem(config)
+}
+
+// buildConfigItem 将配置记录展开为主程序资源池使用的配置 map（JsonData 字段 + name/is_default/provider）
+func buildConfigItem(config models.Config) map[string]interface{} {
 	configData := make(map[string]interface{})
 	if config.JsonData != "" {
 		_ = json.Unmarshal([]byte(config.JsonData), &configData)
@@ -2282,7 +2400,14 @@ func (ac *AdminController) UpdateUser(c *gin.Context) {
 
 func (ac *AdminController) DeleteUser(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	if err := ac.DB.Delete(&models.User{}, id).Error; err != nil {
+	err := ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.User{}, id).Error; err != nil {
+			return err
+		}
+		// 移除组织成员身份；个人组织及其资源保留，便于管理员后续迁移
+		return tx.Where("user_id = ?", id).Delete(&models.OrganizationMember{}).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除用户失败"})
 		return
 	}
@@ -2666,7 +2791,10 @@ func (ac *AdminController) CreateDevice(c *gin.Context) {
 	if req.DeviceCode != "" {
 		var existingDevice models.Device
 		if err := ac.DB.Where("device_code = ?", req.DeviceCode).First(&existingDevice).Error; err == nil {
-			// 设备代码已存在，更新设备信息
+			// 设备代码已存在，更新设备信息（归属用户变化时重新归入其个人组织）
+			if existingDevice.UserID != req.UserID {
+				existingDevice.OrgID = 0
+			}
 			existingDevice.UserID = req.UserID
 			if req.DeviceName != "" {
 				existingDevice.DeviceName = req.DeviceName
@@ -2727,6 +2855,8 @@ func (ac *AdminController) UpdateDevice(c *gin.Context) {
 		DeviceName string `json:"device_name"`
 		Activated  bool   `json:"activated"`
 		AgentID    uint   `json:"agent_id"`
+		devicePromptVarsRequest
+		AudioFrontend *agentAudioFrontend `json:"audio_frontend"` // 未提交时保留原有的设备级覆盖
 	}
 
 	if err := c.ShouldBindJSON(&updateData); err != nil {
@@ -2734,12 +2864,27 @@ func (ac *AdminController) UpdateDevice(c *gin.Context) {
 		return
 	}
 
-	// 更新设备信息
+	// 更新设备信息（归属用户变化时重新归入其个人组织）
+	if device.UserID != updateData.UserID {
+		device.OrgID = 0
+	}
 	device.UserID = updateData.UserID
 	device.DeviceCode = updateData.DeviceCode
 	device.DeviceName = updateData.DeviceName
 	device.Activated = updateData.Activated
 	device.AgentID = updateData.AgentID
+	if err := updateData.apply(&device); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if updateData.AudioFrontend != nil {
+		normalized, err := normalizeAgentAudioFrontend(updateData.AudioFrontend)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		device.AudioFrontend = normalized
+	}
 
 	if err := ac.DB.Save(&device).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设备失败"})
@@ -3123,8 +3268,9 @@ func (ac *AdminController) CreateAgent(c *gin.Context) {
 	}
 
 	var openClawPayload struct {
-		OpenClaw       *OpenClawConfigResponse `json:"openclaw"`
-		OpenClawConfig *string                 `json:"openclaw_config"`
+		OpenClaw        *OpenClawConfigResponse `json:"openclaw"`
+		OpenClawConfig  *string                 `json:"openclaw_config"`
+		RevisionComment string                  `json:"revision_comment"`
 	}
 	if err := c.ShouldBindBodyWith(&openClawPayload, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -3138,6 +3284,18 @@ func (ac *AdminController) CreateAgent(c *gin.Context) {
 		return
 	}
 	agent.MCPServiceNames = normalizedMCPServiceNames
+	if agent.MCPResources, err = normalizeAgentMCPResourcesJSON(agent.MCPResources); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if agent.ToolPolicies, err = normalizeAgentToolPoliciesJSON(agent.ToolPolicies); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if agent.AudioFrontend, err = normalizeAgentAudioFrontendJSON(agent.AudioFrontend); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	var openClawCfg OpenClawConfigResponse
 	switch {
@@ -3157,6 +3315,11 @@ func (ac *AdminController) CreateAgent(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建智能体失败"})
 		return
 	}
+	comment := openClawPayload.RevisionComment
+	if strings.TrimSpace(comment) == "" {
+		comment = "创建智能体"
+	}
+	recordAgentRevision(ac.DB, c, &agent, nil, comment)
 
 	c.JSON(http.StatusCreated, gin.H{"data": agent})
 }
@@ -3177,8 +3340,9 @@ func (ac *AdminController) UpdateAgent(c *gin.Context) {
 	}
 
 	var openClawPayload struct {
-		OpenClaw       *OpenClawConfigResponse `json:"openclaw"`
-		OpenClawConfig *string                 `json:"openclaw_config"`
+		OpenClaw        *OpenClawConfigResponse `json:"openclaw"`
+		OpenClawConfig  *string                 `json:"openclaw_config"`
+		RevisionComment string                  `json:"revision_comment"`
 	}
 	if err := c.ShouldBindBodyWith(&openClawPayload, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -3192,6 +3356,18 @@ func (ac *AdminController) UpdateAgent(c *gin.Context) {
 		return
 	}
 	agent.MCPServiceNames = normalizedMCPServiceNames
+	if agent.MCPResources, err = normalizeAgentMCPResourcesJSON(agent.MCPResources); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if agent.ToolPolicies, err = normalizeAgentToolPoliciesJSON(agent.ToolPolicies); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if agent.AudioFrontend, err = normalizeAgentAudioFrontendJSON(agent.AudioFrontend); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	var openClawCfg OpenClawConfigResponse
 	switch {
@@ -3207,10 +3383,12 @@ func (ac *AdminController) UpdateAgent(c *gin.Context) {
 	}
 	applyOpenClawConfigToAgent(&agent, openClawCfg)
 
+	before := captureAgentRevisionBase(ac.DB, agent.ID)
 	if err := ac.DB.Save(&agent).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新智能体失败"})
 		return
 	}
+	recordAgentRevision(ac.DB, c, &agent, before, openClawPayload.RevisionComment)
 
 	c.JSON(http.StatusOK, gin.H{"data": agent})
 }
@@ -3221,6 +3399,7 @@ func (ac *AdminController) DeleteAgent(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除智能体失败"})
 		return
 	}
+	_ = ac.DB.Where("agent_id = ?", id).Delete(&models.AgentIntentRule{}).Error
 	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
 }
 
@@ -5019,8 +5198,13 @@ func (ac *AdminController) GetGlobalRolesNew(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": globalRoles})
 }
 
+// roleInCurrentOrg 用户角色归属组织，组织成员按组织权限访问；全局角色不属于任何组织
+func roleInCurrentOrg(c *gin.Context, role *models.Role) bool {
+	return role.RoleType != "global" && role.OrgID != 0 && role.OrgID == currentOrgID(c)
+}
+
 // GetRolesNew 获取角色列表（全局角色 + 用户角色）
-// 管理员可以查看所有角色，普通用户只能查看全局角色和自己的角色
+// 管理员可以查看所有角色，普通用户只能查看全局角色和当前组织的角色
 func (ac *AdminController) GetRolesNew(c *gin.Context) {
 	// 从JWT中获取用户ID和角色
 	userID, exists := c.Get("user_id")
@@ -5045,9 +5229,9 @@ func (ac *AdminController) GetRolesNew(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户角色失败"})
 			return
 		}
-	} else if exists {
-		// 普通用户只查看自己的角色
-		if err := ac.DB.Where("user_id = ? AND role_type = ?", userID, "user").
+	} else if exists && userID != nil {
+		// 普通用户只查看当前组织的角色
+		if err := ac.DB.Where("org_id = ? AND role_type = ?", currentOrgID(c), "user").
 			Order("created_at DESC").
 			Find(&userRoles).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户角色失败"})
@@ -5077,20 +5261,10 @@ func (ac *AdminController) GetRoleNew(c *gin.Context) {
 		return
 	}
 
-	// 权限检查：用户角色只能查看自己的角色
-	if role.UserID != nil {
-		userID, exists := c.Get("user_id")
-		userRole, roleExists := c.Get("role")
-
-		if roleExists && userRole.(string) != "admin" {
-			if exists && userID != nil {
-				uid := userID.(uint)
-				if uid != *role.UserID {
-					c.JSON(http.StatusForbidden, gin.H{"error": "无权访问此角色"})
-					return
-				}
-			}
-		}
+	// 权限检查：用户角色只能在所属组织内查看
+	if role.RoleType != "global" && c.GetString("role") != "admin" && !roleInCurrentOrg(c, &role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问此角色"})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"data": role})
@@ -5121,10 +5295,11 @@ func (ac *AdminController) CreateRoleNew(c *gin.Context) {
 		role.RoleType = "global"
 		role.UserID = nil
 	} else if exists {
-		// 普通用户创建自己的角色
+		// 普通用户在当前组织创建角色
 		role.RoleType = "user"
 		uid := userID.(uint)
 		role.UserID = &uid
+		role.OrgID = currentOrgID(c)
 		// 用户角色不能设为默认
 		role.IsDefault = false
 	} else {
@@ -5159,6 +5334,7 @@ func (ac *AdminController) CreateRoleNew(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建角色失败"})
 		return
 	}
+	recordRoleRevision(ac.DB, c, &role, nil, "创建角色")
 
 	c.JSON(http.StatusCreated, gin.H{"data": role})
 }
@@ -5182,19 +5358,17 @@ func (ac *AdminController) UpdateRoleNew(c *gin.Context) {
 	userRole, roleExists := c.Get("role")
 
 	isAdmin := roleExists && userRole.(string) == "admin"
-	isOwner := false
-	if exists && role.UserID != nil {
-		if uid, ok := userID.(uint); ok {
-			isOwner = uid == *role.UserID
-		}
-	}
+	isOwner := exists && userID != nil && roleInCurrentOrg(c, &role)
 
 	if !isAdmin && !isOwner {
 		c.JSON(http.StatusForbidden, gin.H{"error": "无权修改此角色"})
 		return
 	}
 
-	var updateData models.Role
+	var updateData struct {
+		models.Role
+		RevisionComment string `json:"revision_comment"` // 本次修改的版本说明
+	}
 	if err := c.ShouldBindJSON(&updateData); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -5232,10 +5406,12 @@ func (ac *AdminController) UpdateRoleNew(c *gin.Context) {
 		role.IsDefault = updateData.IsDefault
 	}
 
+	before := captureRoleRevisionBase(ac.DB, role.ID)
 	if err := ac.DB.Save(&role).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新角色失败"})
 		return
 	}
+	recordRoleRevision(ac.DB, c, &role, before, updateData.RevisionComment)
 
 	c.JSON(http.StatusOK, gin.H{"data": role})
 }
@@ -5259,12 +5435,7 @@ func (ac *AdminController) DeleteRoleNew(c *gin.Context) {
 	userRole, roleExists := c.Get("role")
 
 	isAdmin := roleExists && userRole.(string) == "admin"
-	isOwner := false
-	if exists && role.UserID != nil {
-		if uid, ok := userID.(uint); ok {
-			isOwner = uid == *role.UserID
-		}
-	}
+	isOwner := exists && userID != nil && roleInCurrentOrg(c, &role)
 
 	if !isAdmin && !isOwner {
 		c.JSON(http.StatusForbidden, gin.H{"error": "无权删除此角色"})
@@ -5308,12 +5479,7 @@ func (ac *AdminController) ToggleRoleStatus(c *gin.Context) {
 	userRole, roleExists := c.Get("role")
 
 	isAdmin := roleExists && userRole.(string) == "admin"
-	isOwner := false
-	if exists && role.UserID != nil {
-		if uid, ok := userID.(uint); ok {
-			isOwner = uid == *role.UserID
-		}
-	}
+	isOwner := exists && userID != nil && roleInCurrentOrg(c, &role)
 
 	if !isAdmin && !isOwner {
 		c.JSON(http.StatusForbidden, gin.H{"error": "无权修改此角色"})
@@ -5449,6 +5615,33 @@ func matchDeviceRoleByName(requestedRoleName string, roles []models.Role) (*mode
 	return bestRole, bestMatchType
 }
 
+// matchAgentByName 按名称（模糊匹配）在候选智能体中选出最匹配的一个，跳过 excludeID 与非 active 智能体
+func matchAgentByName(requestedAgentName string, agents []models.Agent, excludeID uint) *models.Agent {
+	bestScore := -1
+	var bestAgent *models.Agent
+
+	for i := range agents {
+		agent := &agents[i]
+		if agent.ID == excludeID {
+			continue
+		}
+		if status := strings.TrimSpace(agent.Status); status != "" && status != "active" {
+			continue
+		}
+
+		score, _ := calcRoleMatchScore(requestedAgentName, agent.Name)
+		if score > bestScore {
+			bestScore = score
+			bestAgent = agent
+		}
+	}
+
+	if bestScore < 0 {
+		return nil
+	}
+	return bestAgent
+}
+
 func getRequestUserInfo(c *gin.Context) (uint, bool, bool) {
 	var uid uint
 	userID, hasUserID := c.Get("user_id")
@@ -5483,9 +5676,9 @@ func (ac *AdminController) ApplyRoleToDevice(c *gin.Context) {
 		return
 	}
 
-	uid, hasUserID, isAdmin := getRequestUserInfo(c)
+	_, hasUserID, isAdmin := getRequestUserInfo(c)
 	if !isAdmin {
-		if !hasUserID || device.UserID != uid {
+		if !hasUserID || device.OrgID != currentOrgID(c) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "无权操作该设备"})
 			return
 		}
@@ -5509,14 +5702,10 @@ func (ac *AdminController) ApplyRoleToDevice(c *gin.Context) {
 			}
 		}
 
-		// 普通用户只允许使用全局角色或自己的用户角色
-		if !isAdmin {
-			if role.RoleType != "global" {
-				if role.UserID == nil || *role.UserID != uid {
-					c.JSON(http.StatusForbidden, gin.H{"error": "无权使用该角色"})
-					return
-				}
-			}
+		// 普通用户只允许使用全局角色或设备所属组织的角色
+		if !isAdmin && role.RoleType != "global" && role.OrgID != device.OrgID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权使用该角色"})
+			return
 		}
 	}
 
@@ -5561,7 +5750,7 @@ func (ac *AdminController) SwitchDeviceRoleByNameInternal(c *gin.Context) {
 
 	var roles []models.Role
 	if err := ac.DB.
-		Where("(role_type = ? OR (role_type = ? AND user_id = ?))", "global", "user", device.UserID).
+		Where("(role_type = ? OR (role_type = ? AND org_id = ?))", "global", "user", device.OrgID).
 		Order("sort_order ASC, id ASC").
 		Find(&roles).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询角色失败"})
@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// agentAudioFrontend 智能体（或设备）的上行音频前端处理配置，只保存与全局 audio_frontend 不同的项，未设置的字段沿用全局配置
+type agentAudioFrontend struct {
+	Enabled          *bool                               `json:"enabled,omitempty"`
+	HighPass         *agentAudioFrontendHighPass         `json:"high_pass,omitempty"`
+	NoiseSuppression *agentAudioFrontendNoiseSuppression `json:"noise_suppression,omitempty"`
+	Dereverb         *agentAudioFrontendDereverb         `json:"dereverb,omitempty"`
+	AGC              *agentAudioFrontendAGC              `json:"agc,omitempty"`
+}
+
+type agentAudioFrontendHighPass struct {
+	Enabled  *bool    `json:"enabled,omitempty"`
+	CutoffHz *float64 `json:"cutoff_hz,omitempty"`
+	Budget   *float64 `json:"budget,omitempty"`
+}
+
+type agentAudioFrontendNoiseSuppression struct {
+	Enabled         *bool    `json:"enabled,omitempty"`
+	OverSubtraction *float64 `json:"over_subtraction,omitempty"`
+	Floor           *float64 `json:"floor,omitempty"`
+	Budget          *float64 `json:"budget,omitempty"`
+}
+
+type agentAudioFrontendDereverb struct {
+	Enabled *bool    `json:"enabled,omitempty"`
+	T60Ms   *float64 `json:"t60_ms,omitempty"`
+	DelayMs *float64 `json:"delay_ms,omitempty"`
+	Floor   *float64 `json:"floor,omitempty"`
+	Budget  *float64 `json:"budget,omitempty"`
+}
+
+type agentAudioFrontendAGC struct {
+	Enabled       *bool    `json:"enabled,omitempty"`
+	TargetDBFS    *float64 `json:"target_dbfs,omitempty"`
+	MaxGainDB     *float64 `json:"max_gain_db,omitempty"`
+	NoiseGateDBFS *float64 `json:"noise_gate_dbfs,omitempty"`
+	AttackMs      *float64 `json:"attack_ms,omitempty"`
+	ReleaseMs     *float64 `json:"release_ms,omitempty"`
+	Budget        *float64 `json:"budget,omitempty"`
+}
+
+// parseAgentAudioFrontend 解析智能体保存的音频前端配置，为空或格式错误时返回 nil（使用全局配置）
+func parseAgentAudioFrontend(raw string) *agentAudioFrontend {
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	var cfg agentAudioFrontend
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		log.Printf("解析智能体音频前端配置失败: %v", err)
+		return nil
+	}
+	return &cfg
+}
+
+// normalizeAgentAudioFrontend 校验参数范围（与服务端 audio/dsp 保持一致），返回入库的 JSON 字符串，全部未设置时返回空
+func normalizeAgentAudioFrontend(cfg *agentAudioFrontend) (string, error) {
+	if cfg == nil {
+		return "", nil
+	}
+	var budgets []*float64
+	if hp := cfg.HighPass; hp != nil {
+		if err := checkAudioFrontendRange("high_pass.cutoff_hz", hp.CutoffHz, 20, 400, false); err != nil {
+			return "", err
+		}
+		budgets = append(budgets, hp.Budget)
+	}
+	if ns := cfg.NoiseSuppression; ns != nil {
+		if err := checkAudioFrontendRange("noise_suppression.over_subtraction", ns.OverSubtraction, 1, 6, false); err != nil {
+			return "", err
+		}
+		if err := checkAudioFrontendRange("noise_suppression.floor", ns.Floor, 0, 1, true); err != nil {
+			return "", err
+		}
+		budgets = append(budgets, ns.Budget)
+	}
+	if dr := cfg.Dereverb; dr != nil {
+		if err := checkAudioFrontendRange("dereverb.t60_ms", dr.T60Ms, 100, 3000, false); err != nil {
+			return "", err
+		}
+		if err := checkAudioFrontendRange("dereverb.delay_ms", dr.DelayMs, 0, 500, false); err != nil {
+			return "", err
+		}
+		if err := checkAudioFrontendRange("dereverb.floor", dr.Floor, 0, 1, true); err != nil {
+			return "", err
+		}
+		budgets = append(budgets, dr.Budget)
+	}
+	if agc := cfg.AGC; agc != nil {
+		if err := checkAudioFrontendRange("agc.target_dbfs", agc.TargetDBFS, -40, -3, false); err != nil {
+			return "", err
+		}
+		if err := checkAudioFrontendRange("agc.max_gain_db", agc.MaxGainDB, 0, 40, false); err != nil {
+			return "", err
+		}
+		if err := checkAudioFrontendRange("agc.noise_gate_dbfs", agc.NoiseGateDBFS, -90, 0, false); err != nil {
+			return "", err
+		}
+		if err := checkAudioFrontendRange("agc.attack_ms", agc.AttackMs, 0, 10000, true); err != nil {
+			return "", err
+		}
+		if err := checkAudioFrontendRange("agc.release_ms", agc.ReleaseMs, 0, 10000, true); err != nil {
+			return "", err
+		}
+		budgets = append(budgets, agc.Budget)
+	}
+	for _, b := range budgets {
+		if err := checkAudioFrontendRange("budget", b, 0, 1, false); err != nil {
+			return "", err
+		}
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	if string(data) == "{}" {
+		return "", nil
+	}
+	return string(data), nil
+}
+
+// normalizeAgentAudioFrontendJSON 校验以 JSON 字符串提交的音频前端配置（管理员接口直接绑定模型）
+func normalizeAgentAudioFrontendJSON(raw string) (string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return "", nil
+	}
+	var cfg agentAudioFrontend
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		return "", fmt.Errorf("音频前端配置格式错误: %v", err)
+	}
+	return normalizeAgentAudioFrontend(&cfg)
+}
+
+// mergeAudioFrontend 设备级配置逐项覆盖智能体配置，未设置的项沿用智能体；两者都为空时返回 nil
+func mergeAudioFrontend(agent, device *agentAudioFrontend) *agentAudioFrontend {
+	if device == nil {
+		return agent
+	}
+	if agent == nil {
+		return device
+	}
+	merged := *agent
+	overrideAudioFrontendField(&merged.Enabled, device.Enabled)
+	if d := device.HighPass; d != nil {
+		hp := agentAudioFrontendHighPass{}
+		if agent.HighPass != nil {
+			hp = *agent.HighPass
+		}
+		overrideAudioFrontendField(&hp.Enabled, d.Enabled)
+		overrideAudioFrontendField(&hp.CutoffHz, d.CutoffHz)
+		overrideAudioFrontendField(&hp.Budget, d.Budget)
+		merged.HighPass = &hp
+	}
+	if d := device.NoiseSuppression; d != nil {
+		ns := agentAudioFrontendNoiseSuppression{}
+		if agent.NoiseSuppression != nil {
+			ns = *agent.NoiseSuppression
+		}
+		overrideAudioFrontendField(&ns.Enabled, d.Enabled)
+		overrideAudioFrontendField(&ns.OverSubtraction, d.OverSubtraction)
+		overrideAudioFrontendField(&ns.Floor, d.Floor)
+		overrideAudioFrontendField(&ns.Budget, d.Budget)
+		merged.NoiseSuppression = &ns
+	}
+	if d := device.Dereverb; d != nil {
+		dr := agentAudioFrontendDereverb{}
+		if agent.Dereverb != nil {
+			dr = *agent.Dereverb
+		}
+		overrideAudioFrontendField(&dr.Enabled, d.Enabled)
+		overrideAudioFrontendField(&dr.T60Ms, d.T60Ms)
+		overrideAudioFrontendField(&dr.DelayMs, d.DelayMs)
+		overrideAudioFrontendField(&dr.Floor, d.Floor)
+		overrideAudioFrontendField(&dr.Budget, d.Budget)
+		merged.Dereverb = &dr
+	}
+	if d := device.AGC; d != nil {
+		agc := agentAudioFrontendAGC{}
+		if agent.AGC != nil {
+			agc = *agent.AGC
+		}
+		overrideAudioFrontendField(&agc.Enabled, d.Enabled)
+		overrideAudioFrontendField(&agc.TargetDBFS, d.TargetDBFS)
+		overrideAudioFrontendField(&agc.MaxGainDB, d.MaxGainDB)
+		overrideAudioFrontendField(&agc.NoiseGateDBFS, d.NoiseGateDBFS)
+		overrideAudioFrontendField(&agc.AttackMs, d.AttackMs)
+		overrideAudioFrontendField(&agc.ReleaseMs, d.ReleaseMs)
+		overrideAudioFrontendField(&agc.Budget, d.Budget)
+		merged.AGC = &agc
+	}
+	return &merged
+}
+
+func overrideAudioFrontendField[T any](dst **T, v *T) {
+	if v != nil {
+		*dst = v
+	}
+}
+
+// UpdateDeviceAudioFrontend 设置设备级音频前端处理覆盖项，提交空对象时清除覆盖、沿用智能体配置
+func (uc *UserController) UpdateDeviceAudioFrontend(c *gin.Context) {
+	var device models.Device
+	if err := uc.DB.Where("id = ? AND org_id = ?", c.Param("id"), currentOrgID(c)).First(&device).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "设备不存在或不属于当前组织"})
+		return
+	}
+	var req agentAudioFrontend
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	normalized, err := normalizeAgentAudioFrontend(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := uc.DB.Model(&device).Update("audio_frontend", normalized).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设备音频前端配置失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "设备音频前端配置已更新", "data": parseAgentAudioFrontend(normalized)})
+}
+
+// checkAudioFrontendRange 未设置时跳过；openMin 表示下限不含 min 本身
+func checkAudioFrontendRange(name string, v *float64, min, max float64, openMin bool) error {
+	if v == nil {
+		return nil
+	}
+	if *v > max || *v < min || (openMin && *v == min) {
+		if openMin {
+			return fmt.Errorf("音频前端参数 %s 需在 (%v, %v] 之间", name, min, max)
+		}
+		return fmt.Errorf("音频前端参数 %s 需在 %v~%v 之间", name, min, max)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package controllers
+
+import "testing"
+
+func TestNormalizeAgentAudioFrontend(t *testing.T) {
+	raw, err := normalizeAgentAudioFrontendJSON(`{"enabled":true,"noise_suppression":{"over_subtraction":3},"agc":{}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw != `{"enabled":true,"noise_suppression":{"over_subtraction":3},"agc":{}}` {
+		t.Fatalf("规范化结果 = %s", raw)
+	}
+	if raw, _ := normalizeAgentAudioFrontend(&agentAudioFrontend{}); raw != "" {
+		t.Fatalf("未设置任何项应保存为空字符串, got %q", raw)
+	}
+	if cfg := parseAgentAudioFrontend(""); cfg != nil {
+		t.Fatalf("空配置应解析为 nil, got %+v", cfg)
+	}
+	for name, body := range map[string]string{
+		"截止频率过高": `{"high_pass":{"cutoff_hz":1000}}`,
+		"降噪强度过低": `{"noise_suppression":{"over_subtraction":0.5}}`,
+		"增益下限为0": `{"noise_suppression":{"floor":0}}`,
+		"目标电平过高": `{"agc":{"target_dbfs":0}}`,
+		"预算越界":   `{"dereverb":{"budget":2}}`,
+		"非法JSON": `{`,
+	} {
+		if _, err := normalizeAgentAudioFrontendJSON(body); err == nil {
+			t.Fatalf("%s: 应返回错误", name)
+		}
+	}
+}
+
+func TestMergeAudioFrontend(t *testing.T) {
+	agent := parseAgentAudioFrontend(`{"enabled":true,"noise_suppression":{"enabled":true,"over_subtraction":3},"agc":{"target_dbfs":-18}}`)
+	device := parseAgentAudioFrontend(`{"noise_suppression":{"over_subtraction":4},"dereverb":{"enabled":true}}`)
+
+	merged := mergeAudioFrontend(agent, device)
+	if merged.Enabled == nil || !*merged.Enabled {
+		t.Fatal("设备未设置 enabled 时应沿用智能体")
+	}
+	ns := merged.NoiseSuppression
+	if ns == nil || ns.Enabled == nil || !*ns.Enabled || *ns.OverSubtraction != 4 {
+		t.Fatalf("降噪应逐项覆盖, got %+v", ns)
+	}
+	if merged.Dereverb == nil || !*merged.Dereverb.Enabled || *merged.AGC.TargetDBFS != -18 {
+		t.Fatalf("合并结果 = %+v", merged)
+	}
+	if *agent.NoiseSuppression.OverSubtraction != 3 {
+		t.Fatal("合并不应修改智能体配置")
+	}
+
+	if got := mergeAudioFrontend(nil, device); got != device {
+		t.Fatal("智能体未配置时直接使用设备配置")
+	}
+	if got := mergeAudioFrontend(agent, nil); got != agent {
+		t.Fatal("设备未配置时沿用智能体配置")
+	}
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxAgentMCPResources    = 20
+	maxAgentMCPResourceSize = 20000
+)
+
+// agentMCPResource 智能体固定为上下文的 MCP 资源，server 为全局 MCP 服务名，device 表示设备/智能体接入的 MCP
+type agentMCPResource struct {
+	Server   string `json:"server"`
+	URI      string `json:"uri"`
+	Name     string `json:"name"`
+	MaxChars int    `json:"max_chars"` // 注入的最大字符数，0 表示使用主程序默认值
+}
+
+// parseAgentMCPResources 解析智能体保存的资源列表，格式错误时视为空
+func parseAgentMCPResources(raw string) []agentMCPResource {
+	items := make([]agentMCPResource, 0)
+	if strings.TrimSpace(raw) == "" {
+		return items
+	}
+	if err := json.Unmarshal([]byte(raw), &items); err != nil {
+		log.Printf("解析智能体固定MCP资源失败: %v", err)
+		return make([]agentMCPResource, 0)
+	}
+	return items
+}
+
+// normalizeAgentMCPResources 校验并规范化资源列表（去空格、按 server+uri 去重），返回入库的 JSON 字符串
+func normalizeAgentMCPResources(items []agentMCPResource) (string, error) {
+	result := make([]agentMCPResource, 0, len(items))
+	seen := make(map[string]bool)
+	for _, item := range items {
+		item.Server = strings.TrimSpace(item.Server)
+		item.URI = strings.TrimSpace(item.URI)
+		item.Name = strings.TrimSpace(item.Name)
+		if item.Server == "" || item.URI == "" {
+			return "", fmt.Errorf("固定的MCP资源需要指定服务与URI")
+		}
+		if item.MaxChars < 0 || item.MaxChars > maxAgentMCPResourceSize {
+			return "", fmt.Errorf("资源 %s 的最大字符数需在 0~%d 之间", item.URI, maxAgentMCPResourceSize)
+		}
+		key := item.Server + "|" + item.URI
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, item)
+	}
+	if len(result) > maxAgentMCPResources {
+		return "", fmt.Errorf("最多固定 %d 个MCP资源", maxAgentMCPResources)
+	}
+	if len(result) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// normalizeAgentMCPResourcesJSON 校验以 JSON 字符串提交的资源列表（管理员接口直接绑定模型）
+func normalizeAgentMCPResourcesJSON(raw string) (string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return "", nil
+	}
+	var items []agentMCPResource
+	if err := json.Unmarshal([]byte(raw), &items); err != nil {
+		return "", fmt.Errorf("固定的MCP资源格式错误: %v", err)
+	}
+	return normalizeAgentMCPResources(items)
+}
+
+// mcpCatalogRequester 向主程序请求 MCP 资源与提示词列表
+type mcpCatalogRequester interface {
+	RequestMcpCatalogFromClient(ctx context.Context, body map[string]interface{}) (map[string]interface{}, error)
+}
+
+// GetAgentMcpCatalogCommon 获取智能体可用的 MCP 资源与提示词（全局服务按智能体选择过滤，另含设备侧上报），
+// 主程序不可达时返回空列表
+func GetAgentMcpCatalogCommon(c *gin.Context, agent models.Agent, ws mcpCatalogRequester) {
+	data := gin.H{
+		"resources": []interface{}{},
+		"prompts":   []interface{}{},
+		"pinned":    parseAgentMCPResources(agent.MCPResources),
+	}
+	if ws == nil {
+		c.JSON(http.StatusOK, gin.H{"data": data})
+		return
+	}
+	body := map[string]interface{}{
+		"agent_id":          fmt.Sprintf("%d", agent.ID),
+		"mcp_service_names": normalizeMCPServiceNamesCSV(agent.MCPServiceNames),
+	}
+	result, err := ws.RequestMcpCatalogFromClient(c.Request.Context(), body)
+	if err != nil {
+		log.Printf("获取MCP资源与提示词失败: %v", err)
+		c.JSON(http.StatusOK, gin.H{"data": data})
+		return
+	}
+	if resources, ok := result["resources"]; ok && resources != nil {
+		data["resources"] = resources
+	}
+	if prompts, ok := result["prompts"]; ok && prompts != nil {
+		data["prompts"] = prompts
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// GetAgentMcpCatalog 获取智能体可用的 MCP 资源与提示词（用户版本）
+func (uc *UserController) GetAgentMcpCatalog(c *gin.Context) {
+	orgID := currentOrgID(c)
+	var agent models.Agent
+	if err := uc.DB.Where("id = ? AND org_id = ?", c.Param("id"), orgID).First(&agent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在"})
+		return
+	}
+	GetAgentMcpCatalogCommon(c, agent, uc.WebSocketController)
+}
+
+// GetAgentMcpCatalog 获取智能体可用的 MCP 资源与提示词（管理员版本）
+func (ac *AdminController) GetAgentMcpCatalog(c *gin.Context) {
+	var agent models.Agent
+	if err := ac.DB.First(&agent, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在"})
+		return
+	}
+	if ac.WebSocketController == nil {
+		GetAgentMcpCatalogCommon(c, agent, nil)
+		return
+	}
+	GetAgentMcpCatalogCommon(c, agent, ac.WebSocketController)
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"xiaozhi/manager/backend/database"
+	"xiaozhi/manager/backend/database/dbtest"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNormalizeAgentMCPResources(t *testing.T) {
+	raw, err := normalizeAgentMCPResources([]agentMCPResource{
+		{Server: " docs ", URI: "docs://faq", Name: "常见问题", MaxChars: 500},
+		{Server: "docs", URI: "docs://faq"},
+		{Server: "device", URI: "file:///status"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw != `[{"server":"docs","uri":"docs://faq","name":"常见问题","max_chars":500},{"server":"device","uri":"file:///status","name":"","max_chars":0}]` {
+		t.Fatalf("规范化结果 = %s", raw)
+	}
+	if raw, _ := normalizeAgentMCPResources(nil); raw != "" {
+		t.Fatalf("空列表应保存为空字符串, got %q", raw)
+	}
+	for name, items := range map[string][]agentMCPResource{
+		"缺少URI": {{Server: "docs"}},
+		"字符数超限": {{Server: "docs", URI: "docs://a", MaxChars: maxAgentMCPResourceSize + 1}},
+	} {
+		if _, err := normalizeAgentMCPResources(items); err == nil {
+			t.Fatalf("%s: 应返回错误", name)
+		}
+	}
+	if _, err := normalizeAgentMCPResourcesJSON("{"); err == nil {
+		t.Fatal("非法 JSON 应返回错误")
+	}
+}
+
+func TestGetAgentMcpCatalog(t *testing.T) {
+	db := dbtest.Open(t, database.Models()...)
+	db.Create(&models.Agent{ID: 7, UserID: 1, OrgID: 1, Name: "小智", MCPServiceNames: "docs, weather",
+		MCPResources: `[{"server":"docs","uri":"docs://faq","name":"常见问题","max_chars":500}]`})
+
+	ws := &fakeAgentMCPWS{}
+	uc := &UserController{DB: db, WebSocketController: ws}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("org_id", uint(1)) })
+	r.GET("/agents/:id/mcp-resources", uc.GetAgentMcpCatalog)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/agents/7/mcp-resources", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			Resources []map[string]interface{} `json:"resources"`
+			Prompts   []map[string]interface{} `json:"prompts"`
+			Pinned    []agentMCPResource       `json:"pinned"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if ws.catalogBody["agent_id"] != "7" || ws.catalogBody["mcp_service_names"] != "docs,weather" {
+		t.Fatalf("请求主程序参数 = %v", ws.catalogBody)
+	}
+	if len(resp.Data.Resources) != 1 || len(resp.Data.Prompts) != 1 {
+		t.Fatalf("资源/提示词 = %+v", resp.Data)
+	}
+	if len(resp.Data.Pinned) != 1 || resp.Data.Pinned[0].MaxChars != 500 {
+		t.Fatalf("固定资源 = %+v", resp.Data.Pinned)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/agents/8/mcp-resources", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("不存在的智能体 status = %d", w.Code)
+	}
+}
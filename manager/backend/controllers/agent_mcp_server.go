@@ -0,0 +1,444 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"xiaozhi-esp32-server-golang/pkg/prompttpl"
+	"xiaozhi/manager/backend/middleware"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// 智能体对外 MCP 服务的内置工具
+const (
+	agentMCPToolSpeak   = "speak_on_device"
+	agentMCPToolAsk     = "ask_agent"
+	agentMCPToolHistory = "get_conversation_history"
+	agentMCPToolSearch  = "search_knowledge"
+
+	agentMCPAskTimeout = 25 * time.Second
+)
+
+// agentMCPSession 一次 MCP 请求内的智能体上下文，工具按 API Token 的访问范围和组织角色权限注册
+type agentMCPSession struct {
+	uc    *UserController
+	c     *gin.Context
+	agent models.Agent
+	// 已发布版本生效时为快照中的知识库；nil 表示使用当前关联
+	publishedKBIDs []uint
+}
+
+// ServeAgentMCP 以 streamable HTTP MCP 服务器的形式对外提供智能体：设备上报的工具 + 内置工具
+// 无状态模式，每个请求按当前设备在线情况和令牌权限生成工具列表
+func (uc *UserController) ServeAgentMCP(c *gin.Context) {
+	orgID := currentOrgID(c)
+	var agent models.Agent
+	if err := uc.DB.Where("id = ? AND org_id = ?", c.Param("id"), orgID).First(&agent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在或不属于当前组织"})
+		return
+	}
+
+	sess := &agentMCPSession{uc: uc, c: c, agent: agent}
+	if agent.PublishedRevisionID != nil {
+		if snap, _, err := publishedAgentSnapshot(uc.DB, agent); err == nil {
+			snap.ApplyToAgent(&sess.agent)
+			sess.publishedKBIDs = snap.KnowledgeBaseIDs
+		} else {
+			log.Printf("[AgentMCP] 读取智能体 %d 已发布版本失败，使用当前配置: %v", agent.ID, err)
+		}
+	}
+
+	s := server.NewMCPServer(
+		"xiaozhi-agent-"+strconv.FormatUint(uint64(agent.ID), 10),
+		"1.0.0",
+		server.WithToolCapabilities(false),
+		server.WithRecovery(),
+		server.WithInstructions(fmt.Sprintf("小智智能体「%s」。可调用设备上报的工具控制设备，或使用内置工具让设备播报、向智能体提问、查询对话记录和知识库。", agent.Name)),
+	)
+	// 设备工具需要向主程序查询，只在列出或调用工具时加载
+	if method := peekJSONRPCMethod(c); method == string(mcp.MethodToolsList) || method == string(mcp.MethodToolsCall) {
+		s.AddTools(sess.tools(c.Request.Context())...)
+	}
+
+	server.NewStreamableHTTPServer(s, server.WithStateLess(true)).ServeHTTP(c.Writer, c.Request)
+}
+
+// peekJSONRPCMethod 读取 POST 请求体中的 JSON-RPC 方法名，并还原请求体
+func peekJSONRPCMethod(c *gin.Context) string {
+	if c.Request.Method != http.MethodPost || c.Request.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	var msg struct {
+		Method string `json:"method"`
+	}
+	_ = json.Unmarshal(body, &msg)
+	return msg.Method
+}
+
+// allowed 同时校验 API Token 访问范围与组织角色权限（JWT 请求只校验角色权限）
+func (s *agentMCPSession) allowed(scope, perm string) bool {
+	if r := middleware.TokenRestriction(s.c); r != nil && !r.HasScope(scope) {
+		return false
+	}
+	return middleware.HasPermission(s.c.GetString("org_role"), perm)
+}
+
+func (s *agentMCPSession) tools(ctx context.Context) []server.ServerTool {
+	var tools []server.ServerTool
+	if devices := s.devices(); len(devices) > 0 && s.allowed(middleware.ScopeDevicesInject, middleware.PermDeviceOperate) {
+		tools = append(tools, s.speakTool(devices))
+	}
+	if s.allowed(middleware.ScopeHistoryRead, middleware.PermHistoryRead) {
+		tools = append(tools, s.historyTool())
+	}
+	if !s.allowed(middleware.ScopeMCPCall, middleware.PermAgentOperate) {
+		return tools
+	}
+	tools = append(tools, s.askTool())
+	if kbs := s.knowledgeBases(); len(kbs) > 0 {
+		tools = append(tools, s.searchTool(kbs))
+	}
+
+	builtin := make(map[string]bool, len(tools))
+	for _, t := range tools {
+		builtin[t.Tool.Name] = true
+	}
+	if s.uc.WebSocketController == nil {
+		return tools
+	}
+	for _, t := range s.reportedTools(ctx) {
+		if builtin[t.Name] {
+			log.Printf("[AgentMCP] 设备工具 %s 与内置工具重名，已忽略", t.Name)
+			continue
+		}
+		tools = append(tools, s.reportedTool(t.MCPTool, t.deviceID))
+	}
+	return tools
+}
+
+// agentMCPReportedTool 设备上报的工具；deviceID 非空时只在该设备上调用
+type agentMCPReportedTool struct {
+	MCPTool
+	deviceID string
+}
+
+// reportedTools 获取设备上报的工具。API Token 限定了设备时只查询允许的设备，
+// 同名工具取第一台上报的设备，调用时按设备定位，不会落到令牌无权访问的设备上
+func (s *agentMCPSession) reportedTools(ctx context.Context) []agentMCPReportedTool {
+	if r := middleware.TokenRestriction(s.c); r != nil && r.DeviceNames != nil {
+		var out []agentMCPReportedTool
+		seen := make(map[string]bool)
+		for _, deviceID := range s.devices() {
+			reported, err := s.uc.WebSocketController.RequestDeviceMcpToolDetailsFromClient(ctx, deviceID)
+			if err != nil {
+				log.Printf("[AgentMCP] 获取设备 %s 工具失败: %v", deviceID, err)
+				continue
+			}
+			for _, t := range reported {
+				if !seen[t.Name] {
+					seen[t.Name] = true
+					out = append(out, agentMCPReportedTool{MCPTool: t, deviceID: deviceID})
+				}
+			}
+		}
+		return out
+	}
+
+	reported, err := s.uc.WebSocketController.RequestMcpToolDetailsFromClient(ctx, strconv.FormatUint(uint64(s.agent.ID), 10))
+	if err != nil {
+		log.Printf("[AgentMCP] 获取智能体 %d 设备工具失败: %v", s.agent.ID, err)
+		return nil
+	}
+	out := make([]agentMCPReportedTool, 0, len(reported))
+	for _, t := range reported {
+		out = append(out, agentMCPReportedTool{MCPTool: t})
+	}
+	return out
+}
+
+// devices 智能体下当前令牌可访问的设备
+func (s *agentMCPSession) devices() []string {
+	var devices []models.Device
+	query := s.uc.DB.Where("agent_id = ? AND org_id = ?", s.agent.ID, s.agent.OrgID)
+	query = restrictDevicesByToken(s.c, query, "device_name")
+	if err := query.Order("id ASC").Find(&devices).Error; err != nil {
+		log.Printf("[AgentMCP] 查询智能体 %d 设备失败: %v", s.agent.ID, err)
+		return nil
+	}
+	names := make([]string, 0, len(devices))
+	for _, d := range devices {
+		if d.DeviceName != "" {
+			names = append(names, d.DeviceName)
+		}
+	}
+	return names
+}
+
+func (s *agentMCPSession) reportedTool(t MCPTool, deviceID string) server.ServerTool {
+	schema := t.InputSchema
+	if schema == nil {
+		schema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+	raw, _ := json.Marshal(schema)
+	name := t.Name
+	return server.ServerTool{
+		Tool: mcp.NewToolWithRawSchema(name, t.Description, raw),
+		Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			body := map[string]interface{}{
+				"tool_name": name,
+				"arguments": req.GetArguments(),
+			}
+			if deviceID != "" {
+				body["device_id"] = deviceID
+			} else {
+				body["agent_id"] = strconv.FormatUint(uint64(s.agent.ID), 10)
+			}
+			result, err := s.uc.WebSocketController.CallMcpToolFromClient(ctx, body)
+			if err != nil {
+				return mcp.NewToolResultError("调用设备工具失败: " + err.Error()), nil
+			}
+			text, _ := result["result"].(string)
+			return mcp.NewToolResultText(text), nil
+		},
+	}
+}
+
+func (s *agentMCPSession) speakTool(devices []string) server.ServerTool {
+	tool := mcp.NewTool(agentMCPToolSpeak,
+		mcp.WithDescription("让设备播报一段文字；skip_llm 为 false 时把文字作为用户输入交给智能体回答后再播报"),
+		mcp.WithString("device_id", mcp.Required(), mcp.Enum(devices...), mcp.Description("设备标识")),
+		mcp.WithString("text", mcp.Required(), mcp.Description("要播报的文字")),
+		mcp.WithBoolean("skip_llm", mcp.DefaultBool(true), mcp.Description("是否直接播报，不经过智能体")),
+		mcp.WithDestructiveHintAnnotation(false),
+	)
+	return server.ServerTool{Tool: tool, Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		deviceID, err := req.RequireString("device_id")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		text := strings.TrimSpace(req.GetString("text", ""))
+		if text == "" {
+			return mcp.NewToolResultError("text 不能为空"), nil
+		}
+		if !contains(devices, deviceID) {
+			return mcp.NewToolResultError("设备不存在或无权访问: " + deviceID), nil
+		}
+		if s.uc.WebSocketController == nil {
+			return mcp.NewToolResultError("主程序未连接"), nil
+		}
+		if err := s.uc.WebSocketController.InjectMessageToDevice(ctx, deviceID, text, req.GetBool("skip_llm", true)); err != nil {
+			return mcp.NewToolResultError("消息注入失败: " + err.Error()), nil
+		}
+		return mcp.NewToolResultText("已发送到设备 " + deviceID), nil
+	}}
+}
+
+func (s *agentMCPSession) askTool() server.ServerTool {
+	tool := mcp.NewTool(agentMCPToolAsk,
+		mcp.WithDescription(fmt.Sprintf("向智能体「%s」提问，使用其提示词和语言模型以文字回答，不会在设备上播报", s.agent.Name)),
+		mcp.WithString("message", mcp.Required(), mcp.Description("问题或指令")),
+		mcp.WithReadOnlyHintAnnotation(true),
+	)
+	return server.ServerTool{Tool: tool, Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		message, err := req.RequireString("message")
+		if err != nil || strings.TrimSpace(message) == "" {
+			return mcp.NewToolResultError("message 不能为空"), nil
+		}
+		if s.uc.WebSocketController == nil {
+			return mcp.NewToolResultError("主程序未连接"), nil
+		}
+		// 与设备下发配置一致：智能体的 LLM 配置不可用时回退到默认配置
+		var llmConfig models.Config
+		found := false
+		if s.agent.LLMConfigID != nil && *s.agent.LLMConfigID != "" {
+			found = s.uc.DB.Where("config_id = ? AND type = ? AND enabled = ?", *s.agent.LLMConfigID, "llm", true).First(&llmConfig).Error == nil
+		}
+		if !found && s.uc.DB.Where("type = ? AND is_default = ? AND enabled = ?", "llm", true, true).First(&llmConfig).Error != nil {
+			return mcp.NewToolResultError("智能体未配置可用的语言模型"), nil
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, agentMCPAskTimeout+5*time.Second)
+		defer cancel()
+		result, err := s.uc.WebSocketController.AskAgentFromClient(ctx, map[string]interface{}{
+			"agent_id":      strconv.FormatUint(uint64(s.agent.ID), 10),
+			"llm":           map[string]interface{}{"config_id": llmConfig.ConfigID, "config": buildConfigItem(llmConfig)},
+			"system_prompt": s.systemPrompt(),
+			"message":       message,
+			"timeout_ms":    agentMCPAskTimeout.Milliseconds(),
+		})
+		if err != nil {
+			return mcp.NewToolResultError("智能体回答失败: " + err.Error()), nil
+		}
+		content, _ := result["content"].(string)
+		return mcp.NewToolResultText(content), nil
+	}}
+}
+
+// systemPrompt 渲染智能体提示词；没有设备上下文，设备相关变量为空
+func (s *agentMCPSession) systemPrompt() string {
+	rendered, err := prompttpl.Render(s.agent.CustomPrompt, loadPromptSnippets(s.uc.DB, s.agent.OrgID), prompttpl.Vars{
+		AssistantName: s.agent.Name,
+		Now:           time.Now(),
+	})
+	if err != nil {
+		log.Printf("[AgentMCP] 渲染智能体 %d 提示词失败，使用原文: %v", s.agent.ID, err)
+		return strings.ReplaceAll(s.agent.CustomPrompt, "{{assistant_name}}", s.agent.Name)
+	}
+	return rendered
+}
+
+type agentMCPHistoryMessage struct {
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	DeviceID  string    `json:"device_id"`
+	SessionID string    `json:"session_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s *agentMCPSession) historyTool() server.ServerTool {
+	tool := mcp.NewTool(agentMCPToolHistory,
+		mcp.WithDescription("查询智能体最近的对话记录（按时间正序）"),
+		mcp.WithString("device_id", mcp.Description("只看指定设备")),
+		mcp.WithString("session_id", mcp.Description("只看指定会话")),
+		mcp.WithNumber("limit", mcp.DefaultNumber(20), mcp.Min(1), mcp.Max(100), mcp.Description("返回条数")),
+		mcp.WithReadOnlyHintAnnotation(true),
+	)
+	return server.ServerTool{Tool: tool, Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		limit := req.GetInt("limit", 20)
+		if limit <= 0 {
+			limit = 20
+		}
+		if limit > 100 {
+			limit = 100
+		}
+		query := s.uc.DB.Model(&models.ChatMessage{}).
+			Where("org_id = ? AND agent_id = ? AND is_deleted = ?", s.agent.OrgID, strconv.FormatUint(uint64(s.agent.ID), 10), false).
+			Where("role IN ?", []string{"user", "assistant"})
+		query = restrictDevicesByToken(s.c, query, "device_id")
+		if deviceID := strings.TrimSpace(req.GetString("device_id", "")); deviceID != "" {
+			query = query.Where("device_id = ?", deviceID)
+		}
+		if sessionID := strings.TrimSpace(req.GetString("session_id", "")); sessionID != "" {
+			query = query.Where("session_id = ?", sessionID)
+		}
+		var rows []models.ChatMessage
+		if err := query.Order("created_at DESC").Order("id DESC").Limit(limit).Find(&rows).Error; err != nil {
+			return mcp.NewToolResultError("查询对话记录失败"), nil
+		}
+		messages := make([]agentMCPHistoryMessage, 0, len(rows))
+		for i := len(rows) - 1; i >= 0; i-- {
+			messages = append(messages, agentMCPHistoryMessage{
+				Role:      rows[i].Role,
+				Content:   rows[i].Content,
+				DeviceID:  rows[i].DeviceID,
+				SessionID: rows[i].SessionID,
+				CreatedAt: rows[i].CreatedAt,
+			})
+		}
+		return agentMCPJSONResult(messages)
+	}}
+}
+
+// knowledgeBases 智能体关联且已同步到外部 provider 的知识库，知识库功能未启用时为空
+func (s *agentMCPSession) knowledgeBases() []models.KnowledgeBase {
+	if enabled, err := isKnowledgeFeatureEnabled(s.uc.DB); err != nil || !enabled {
+		return nil
+	}
+	ids := s.publishedKBIDs
+	if ids == nil {
+		var err error
+		if ids, err = s.uc.listAgentKnowledgeBaseIDs(s.agent.ID); err != nil {
+			log.Printf("[AgentMCP] 查询智能体 %d 知识库失败: %v", s.agent.ID, err)
+			return nil
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	var kbs []models.KnowledgeBase
+	if err := s.uc.DB.Where("id IN ? AND org_id = ? AND external_kb_id <> ''", ids, s.agent.OrgID).Order("id ASC").Find(&kbs).Error; err != nil {
+		log.Printf("[AgentMCP] 查询智能体 %d 知识库失败: %v", s.agent.ID, err)
+		return nil
+	}
+	return kbs
+}
+
+type agentMCPKnowledgeHit struct {
+	KnowledgeBase string `json:"knowledge_base"`
+	knowledgeSearchTestHit
+}
+
+func (s *agentMCPSession) searchTool(kbs []models.KnowledgeBase) server.ServerTool {
+	names := make([]string, 0, len(kbs))
+	for _, kb := range kbs {
+		names = append(names, kb.Name)
+	}
+	tool := mcp.NewTool(agentMCPToolSearch,
+		mcp.WithDescription("检索智能体关联的知识库："+strings.Join(names, "、")),
+		mcp.WithString("query", mcp.Required(), mcp.Description("检索内容")),
+		mcp.WithNumber("top_k", mcp.DefaultNumber(5), mcp.Min(1), mcp.Max(20), mcp.Description("返回条数")),
+		mcp.WithReadOnlyHintAnnotation(true),
+	)
+	return server.ServerTool{Tool: tool, Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		query := strings.TrimSpace(req.GetString("query", ""))
+		if query == "" {
+			return mcp.NewToolResultError("query 不能为空"), nil
+		}
+		topK := req.GetInt("top_k", 5)
+		if topK <= 0 {
+			topK = 5
+		}
+		if topK > 20 {
+			topK = 20
+		}
+		var hits []agentMCPKnowledgeHit
+		var lastErr error
+		for i := range kbs {
+			_, kbHits, _, err := searchKnowledgeBase(s.uc.DB, &kbs[i], nil, query, topK)
+			if err != nil {
+				log.Printf("[AgentMCP] 知识库 %d 检索失败: %v", kbs[i].ID, err)
+				lastErr = err
+				continue
+			}
+			for _, hit := range kbHits {
+				hits = append(hits, agentMCPKnowledgeHit{KnowledgeBase: kbs[i].Name, knowledgeSearchTestHit: hit})
+			}
+		}
+		if len(hits) == 0 && lastErr != nil {
+			return mcp.NewToolResultError("知识库检索失败: " + lastErr.Error()), nil
+		}
+		sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+		if len(hits) > topK {
+			hits = hits[:topK]
+		}
+		if hits == nil {
+			hits = []agentMCPKnowledgeHit{}
+		}
+		return agentMCPJSONResult(hits)
+	}}
+}
+
+func agentMCPJSONResult(v interface{}) (*mcp.CallToolResult, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return mcp.NewToolResultText(string(data)), nil
+}
@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"xiaozhi/manager/backend/database"
+	"xiaozhi/manager/backend/database/dbtest"
+	"xiaozhi/manager/backend/middleware"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// fakeAgentMCPWS 模拟主程序：设备上报一个 light_on 工具，记录注入与提问请求
+type fakeAgentMCPWS struct {
+	injected    []string
+	asked       map[string]interface{}
+	catalogBody map[string]interface{}
+}
+
+func (f *fakeAgentMCPWS) RequestMcpToolDetailsFromClient(ctx context.Context, agentID string) ([]MCPTool, error) {
+	return []MCPTool{
+		{Name: "light_on", Description: "开灯", InputSchema: map[string]interface{}{"type": "object", "properties": map[string]interface{}{"room": map[string]interface{}{"type": "string"}}}},
+		{Name: agentMCPToolAsk, Description: "与内置工具重名"},
+	}, nil
+}
+
+// RequestDeviceMcpToolDetailsFromClient 只有 cc:dd 上报了 light_on
+func (f *fakeAgentMCPWS) RequestDeviceMcpToolDetailsFromClient(ctx context.Context, deviceID string) ([]MCPTool, error) {
+	if deviceID != "cc:dd" {
+		return nil, nil
+	}
+	return []MCPTool{{Name: "light_on", Description: "开灯"}}, nil
+}
+
+func (f *fakeAgentMCPWS) CallMcpToolFromClient(ctx context.Context, body map[string]interface{}) (map[string]interface{}, error) {
+	args, _ := body["arguments"].(map[string]interface{})
+	target, _ := body["agent_id"].(string)
+	if deviceID, ok := body["device_id"].(string); ok {
+		target = "device:" + deviceID
+	}
+	room, _ := args["room"].(string)
+	return map[string]interface{}{"result": "ok:" + target + ":" + room}, nil
+}
+
+func (f *fakeAgentMCPWS) RequestOpenClawStatusFromClient(ctx context.Context, agentID string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (f *fakeAgentMCPWS) CallOpenClawChatFromClient(ctx context.Context, body map[string]interface{}) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (f *fakeAgentMCPWS) CallOpenClawChatStreamFromClient(ctx context.Context, body map[string]interface{}, onResponse func(*WebSocketResponse) error) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (f *fakeAgentMCPWS) InjectMessageToDevice(ctx context.Context, deviceID, message string, skipLlm bool) error {
+	f.injected = append(f.injected, deviceID+":"+message)
+	return nil
+}
+
+func (f *fakeAgentMCPWS) AskAgentFromClient(ctx context.Context, body map[string]interface{}) (map[string]interface{}, error) {
+	f.asked = body
+	return map[string]interface{}{"content": "我是小智"}, nil
+}
+
+func (f *fakeAgentMCPWS) RequestMcpCatalogFromClient(ctx context.Context, body map[string]interface{}) (map[string]interface{}, error) {
+	f.catalogBody = body
+	return map[string]interface{}{
+		"resources": []interface{}{map[string]interface{}{"server": "docs", "uri": "docs://faq", "name": "常见问题"}},
+		"prompts":   []interface{}{map[string]interface{}{"server": "docs", "name": "weather"}},
+	}, nil
+}
+
+func newAgentMCPTestServer(t *testing.T, restriction *middleware.APITokenRestriction) (*httptest.Server, *fakeAgentMCPWS) {
+	t.Helper()
+	db := dbtest.Open(t, database.Models()...)
+
+	llmID := "llm_main"
+	db.Create(&models.Config{Type: "llm", ConfigID: llmID, Name: "主模型", Provider: "openai", JsonData: `{"model":"gpt"}`, Enabled: true})
+	db.Create(&models.Agent{ID: 7, UserID: 1, OrgID: 1, Name: "小智", CustomPrompt: "你是{{assistant_name}}", LLMConfigID: &llmID})
+	db.Create(&models.Agent{ID: 8, UserID: 1, OrgID: 2, Name: "别人的"})
+	db.Create(&models.Device{UserID: 1, OrgID: 1, AgentID: 7, DeviceCode: "100001", DeviceName: "aa:bb"})
+	db.Create(&models.Device{UserID: 1, OrgID: 1, AgentID: 7, DeviceCode: "100002", DeviceName: "cc:dd"})
+	base := time.Now().Add(-time.Minute)
+	for i, m := range []models.ChatMessage{
+		{MessageID: "m1", DeviceID: "aa:bb", AgentID: "7", OrgID: 1, Role: "user", Content: "你好"},
+		{MessageID: "m2", DeviceID: "aa:bb", AgentID: "7", OrgID: 1, Role: "tool", Content: "{}"},
+		{MessageID: "m3", DeviceID: "aa:bb", AgentID: "7", OrgID: 1, Role: "assistant", Content: "你好呀"},
+		{MessageID: "m4", DeviceID: "cc:dd", AgentID: "7", OrgID: 1, Role: "user", Content: "另一台"},
+	} {
+		m.CreatedAt = base.Add(time.Duration(i) * time.Second)
+		db.Create(&m)
+	}
+
+	ws := &fakeAgentMCPWS{}
+	uc := &UserController{DB: db, WebSocketController: ws}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", uint(1))
+		c.Set("org_id", uint(1))
+		c.Set("org_role", models.OrgRoleOwner)
+		if restriction != nil {
+			c.Set("api_token_restriction", restriction)
+		}
+	})
+	r.Any("/agents/:id/mcp", uc.ServeAgentMCP)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv, ws
+}
+
+func connectAgentMCP(t *testing.T, url string) *client.Client {
+	t.Helper()
+	tr, err := transport.NewStreamableHTTP(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.NewClient(tr)
+	ctx := context.Background()
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if _, err := c.Initialize(ctx, mcp.InitializeRequest{Params: mcp.InitializeParams{ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION}}); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func callAgentMCPTool(t *testing.T, c *client.Client, name string, args map[string]interface{}) (string, bool) {
+	t.Helper()
+	res, err := c.CallTool(context.Background(), mcp.CallToolRequest{Params: mcp.CallToolParams{Name: name, Arguments: args}})
+	if err != nil {
+		t.Fatalf("调用 %s 失败: %v", name, err)
+	}
+	var texts []string
+	for _, content := range res.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	return strings.Join(texts, ""), res.IsError
+}
+
+func TestServeAgentMCP(t *testing.T) {
+	srv, ws := newAgentMCPTestServer(t, nil)
+	c := connectAgentMCP(t, srv.URL+"/agents/7/mcp")
+
+	tools, err := c.ListTools(context.Background(), mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tool := range tools.Tools {
+		names = append(names, tool.Name)
+	}
+	// 没有关联知识库时不提供 search_knowledge；与内置工具重名的设备工具被忽略
+	if got := strings.Join(names, ","); got != "ask_agent,get_conversation_history,light_on,speak_on_device" {
+		t.Fatalf("工具列表 = %s", got)
+	}
+
+	if out, isErr := callAgentMCPTool(t, c, "light_on", map[string]interface{}{"room": "客厅"}); isErr || out != "ok:7:客厅" {
+		t.Fatalf("设备工具结果 = %q, isErr=%v", out, isErr)
+	}
+
+	if _, isErr := callAgentMCPTool(t, c, agentMCPToolSpeak, map[string]interface{}{"device_id": "aa:bb", "text": "开饭了"}); isErr {
+		t.Fatal("speak_on_device 失败")
+	}
+	if _, isErr := callAgentMCPTool(t, c, agentMCPToolSpeak, map[string]interface{}{"device_id": "zz:zz", "text": "x"}); !isErr {
+		t.Fatal("不属于智能体的设备应当拒绝")
+	}
+	if len(ws.injected) != 1 || ws.injected[0] != "aa:bb:开饭了" {
+		t.Fatalf("注入记录 = %v", ws.injected)
+	}
+
+	if out, isErr := callAgentMCPTool(t, c, agentMCPToolAsk, map[string]interface{}{"message": "你是谁"}); isErr || out != "我是小智" {
+		t.Fatalf("ask_agent 结果 = %q", out)
+	}
+	if ws.asked["system_prompt"] != "你是小智" {
+		t.Fatalf("system_prompt = %v", ws.asked["system_prompt"])
+	}
+	llm, _ := ws.asked["llm"].(map[string]interface{})
+	if llm["config_id"] != "llm_main" || llm["config"].(map[string]interface{})["provider"] != "openai" {
+		t.Fatalf("llm = %v", llm)
+	}
+
+	out, isErr := callAgentMCPTool(t, c, agentMCPToolHistory, map[string]interface{}{"device_id": "aa:bb"})
+	if isErr {
+		t.Fatal(out)
+	}
+	var history []agentMCPHistoryMessage
+	if err := json.Unmarshal([]byte(out), &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Content != "你好" || history[1].Content != "你好呀" {
+		t.Fatalf("对话记录 = %+v", history)
+	}
+
+	// 其它组织的智能体不可访问
+	tr, _ := transport.NewStreamableHTTP(srv.URL + "/agents/8/mcp")
+	other := client.NewClient(tr)
+	defer other.Close()
+	if err := other.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Initialize(context.Background(), mcp.InitializeRequest{}); err == nil {
+		t.Fatal("其它组织的智能体应返回错误")
+	}
+}
+
+func TestServeAgentMCPTokenScopes(t *testing.T) {
+	// 只有 mcp:read 与 history:read，且仅允许 cc:dd 设备
+	srv, _ := newAgentMCPTestServer(t, &middleware.APITokenRestriction{
+		Scopes:      map[string]bool{middleware.ScopeMCPRead: true, middleware.ScopeHistoryRead: true},
+		DeviceNames: map[string]bool{"cc:dd": true},
+	})
+	c := connectAgentMCP(t, srv.URL+"/agents/7/mcp")
+
+	tools, err := c.ListTools(context.Background(), mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tools.Tools) != 1 || tools.Tools[0].Name != agentMCPToolHistory {
+		t.Fatalf("工具列表 = %+v", tools.Tools)
+	}
+	out, _ := callAgentMCPTool(t, c, agentMCPToolHistory, nil)
+	var history []agentMCPHistoryMessage
+	if err := json.Unmarshal([]byte(out), &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].DeviceID != "cc:dd" {
+		t.Fatalf("对话记录 = %+v", history)
+	}
+}
+
+func TestServeAgentMCPReportedToolsRespectDeviceRestriction(t *testing.T) {
+	callScopes := map[string]bool{middleware.ScopeMCPRead: true, middleware.ScopeMCPCall: true}
+
+	// 允许的设备上报了工具：按设备调用，而不是按智能体广播
+	srv, _ := newAgentMCPTestServer(t, &middleware.APITokenRestriction{Scopes: callScopes, DeviceNames: map[string]bool{"cc:dd": true}})
+	c := connectAgentMCP(t, srv.URL+"/agents/7/mcp")
+	if out, isErr := callAgentMCPTool(t, c, "light_on", map[string]interface{}{"room": "卧室"}); isErr || out != "ok:device:cc:dd:卧室" {
+		t.Fatalf("设备工具结果 = %q, isErr=%v", out, isErr)
+	}
+
+	// 允许的设备都没有上报该工具：不列出，也不能调用
+	srv, _ = newAgentMCPTestServer(t, &middleware.APITokenRestriction{Scopes: callScopes, DeviceNames: map[string]bool{"aa:bb": true}})
+	c = connectAgentMCP(t, srv.URL+"/agents/7/mcp")
+	tools, err := c.ListTools(context.Background(), mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tool := range tools.Tools {
+		if tool.Name == "light_on" {
+			t.Fatal("令牌无权访问的设备上报的工具不应列出")
+		}
+	}
+	res, err := c.CallTool(context.Background(), mcp.CallToolRequest{Params: mcp.CallToolParams{Name: "light_on", Arguments: map[string]interface{}{"room": "卧室"}}})
+	if err == nil && !res.IsError {
+		t.Fatal("令牌无权访问的设备上报的工具不应可调用")
+	}
+}
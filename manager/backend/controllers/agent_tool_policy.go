@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxAgentToolPolicies     = 50
+	maxAgentToolPolicyPrompt = 200
+	agentToolPolicyAllow     = "allow"
+	agentToolPolicyConfirm   = "confirm"
+	agentToolPolicyDeny      = "deny"
+)
+
+// agentToolPolicy 智能体对 LLM 工具调用的策略，tool 支持 * 通配；
+// confirm 时先播报 prompt（留空自动生成）并等待用户确认，deny 时 prompt 作为拒绝原因告知 LLM
+type agentToolPolicy struct {
+	Tool   string `json:"tool"`
+	Policy string `json:"policy"`
+	Prompt string `json:"prompt"`
+}
+
+// parseAgentToolPolicies 解析智能体保存的工具策略，格式错误时视为空
+func parseAgentToolPolicies(raw string) []agentToolPolicy {
+	items := make([]agentToolPolicy, 0)
+	if strings.TrimSpace(raw) == "" {
+		return items
+	}
+	if err := json.Unmarshal([]byte(raw), &items); err != nil {
+		log.Printf("解析智能体工具策略失败: %v", err)
+		return make([]agentToolPolicy, 0)
+	}
+	return items
+}
+
+// normalizeAgentToolPolicies 校验并规范化工具策略，同一工具只能配置一条，返回入库的 JSON 字符串
+func normalizeAgentToolPolicies(items []agentToolPolicy) (string, error) {
+	if len(items) > maxAgentToolPolicies {
+		return "", fmt.Errorf("最多配置 %d 条工具策略", maxAgentToolPolicies)
+	}
+	result := make([]agentToolPolicy, 0, len(items))
+	seen := make(map[string]bool)
+	for _, item := range items {
+		item.Tool = strings.TrimSpace(item.Tool)
+		item.Policy = strings.ToLower(strings.TrimSpace(item.Policy))
+		item.Prompt = strings.TrimSpace(item.Prompt)
+		if item.Tool == "" {
+			return "", fmt.Errorf("工具策略需要指定工具名")
+		}
+		if _, err := path.Match(item.Tool, ""); err != nil {
+			return "", fmt.Errorf("工具名通配格式错误: %s", item.Tool)
+		}
+		switch item.Policy {
+		case agentToolPolicyAllow, agentToolPolicyConfirm, agentToolPolicyDeny:
+		default:
+			return "", fmt.Errorf("工具 %s 的策略需为 allow、confirm 或 deny", item.Tool)
+		}
+		if utf8.RuneCountInString(item.Prompt) > maxAgentToolPolicyPrompt {
+			return "", fmt.Errorf("工具 %s 的提示语不能超过 %d 个字符", item.Tool, maxAgentToolPolicyPrompt)
+		}
+		if seen[item.Tool] {
+			return "", fmt.Errorf("工具 %s 重复配置了策略", item.Tool)
+		}
+		seen[item.Tool] = true
+		result = append(result, item)
+	}
+	if len(result) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// normalizeAgentToolPoliciesJSON 校验以 JSON 字符串提交的工具策略（管理员接口直接绑定模型）
+func normalizeAgentToolPoliciesJSON(raw string) (string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return "", nil
+	}
+	var items []agentToolPolicy
+	if err := json.Unmarshal([]byte(raw), &items); err != nil {
+		return "", fmt.Errorf("工具策略格式错误: %v", err)
+	}
+	return normalizeAgentToolPolicies(items)
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import "testing"
+
+func TestNormalizeAgentToolPolicies(t *testing.T) {
+	raw, err := normalizeAgentToolPolicies([]agentToolPolicy{
+		{Tool: " device_* ", Policy: "Confirm", Prompt: "确定要操作设备吗？"},
+		{Tool: "exit_conversation", Policy: "deny"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw != `[{"tool":"device_*","policy":"confirm","prompt":"确定要操作设备吗？"},{"tool":"exit_conversation","policy":"deny","prompt":""}]` {
+		t.Fatalf("规范化结果 = %s", raw)
+	}
+	if raw, _ := normalizeAgentToolPolicies(nil); raw != "" {
+		t.Fatalf("空列表应保存为空字符串, got %q", raw)
+	}
+	for name, items := range map[string][]agentToolPolicy{
+		"缺少工具名": {{Policy: "allow"}},
+		"未知策略":  {{Tool: "a", Policy: "ask"}},
+		"通配错误":  {{Tool: "a[", Policy: "deny"}},
+		"重复工具":  {{Tool: "a", Policy: "deny"}, {Tool: "a", Policy: "allow"}},
+	} {
+		if _, err := normalizeAgentToolPolicies(items); err == nil {
+			t.Fatalf("%s: 应返回错误", name)
+		}
+	}
+	if _, err := normalizeAgentToolPoliciesJSON("["); err == nil {
+		t.Fatal("非法 JSON 应返回错误")
+	}
+}
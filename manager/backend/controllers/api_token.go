@@ -4,34 +4,186 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
+	"xiaozhi/manager/backend/middleware"
 	"xiaozhi/manager/backend/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type APITokenResponse struct {
-	ID          uint       `json:"id"`
-	Name        string     `json:"name"`
-	TokenPrefix string     `json:"token_prefix"`
-	IsActive    bool       `json:"is_active"`
-	LastUsedAt  *time.Time `json:"last_used_at"`
-	ExpiresAt   *time.Time `json:"expires_at"`
-	CreatedAt   time.Time  `json:"created_at"`
+	ID                 uint       `json:"id"`
+	Name               string     `json:"name"`
+	UserID             uint       `json:"user_id"` // 创建者
+	OrgID              uint       `json:"org_id"`
+	TokenPrefix        string     `json:"token_prefix"`
+	IsActive           bool       `json:"is_active"`
+	Scopes             []string   `json:"scopes"`
+	AgentIDs           []string   `json:"agent_ids"`
+	DeviceNames        []string   `json:"device_names"`
+	AllowedCIDRs       []string   `json:"allowed_cidrs"`
+	RateLimitPerMinute int        `json:"rate_limit_per_minute"`
+	RequestCount       int64      `json:"request_count"`
+	RateLimitedCount   int64      `json:"rate_limited_count"`
+	DeniedCount        int64      `json:"denied_count"`
+	LastUsedIP         string     `json:"last_used_ip"`
+	LastUsedAt         *time.Time `json:"last_used_at"`
+	ExpiresAt          *time.Time `json:"expires_at"`
+	CreatedAt          time.Time  `json:"created_at"`
 }
 
 func toAPITokenResponse(t models.APIToken) APITokenResponse {
+	scopes := models.SplitList(t.Scopes)
+	if len(scopes) == 0 {
+		scopes = []string{middleware.ScopeAll}
+	}
 	return APITokenResponse{
-		ID:          t.ID,
-		Name:        t.Name,
-		TokenPrefix: t.TokenPrefix,
-		IsActive:    t.IsActive,
-		LastUsedAt:  t.LastUsedAt,
-		ExpiresAt:   t.ExpiresAt,
-		CreatedAt:   t.CreatedAt,
+		ID:                 t.ID,
+		UserID:             t.UserID,
+		Name:               t.Name,
+		OrgID:              t.OrgID,
+		TokenPrefix:        t.TokenPrefix,
+		IsActive:           t.IsActive,
+		Scopes:             scopes,
+		AgentIDs:           models.SplitList(t.AgentIDs),
+		DeviceNames:        models.SplitList(t.DeviceNames),
+		AllowedCIDRs:       models.SplitList(t.AllowedCIDRs),
+		RateLimitPerMinute: t.RateLimitPerMinute,
+		RequestCount:       t.RequestCount,
+		RateLimitedCount:   t.RateLimitedCount,
+		DeniedCount:        t.DeniedCount,
+		LastUsedIP:         t.LastUsedIP,
+		LastUsedAt:         t.LastUsedAt,
+		ExpiresAt:          t.ExpiresAt,
+		CreatedAt:          t.CreatedAt,
+	}
+}
+
+// apiTokenRestrictionRequest API Token 的访问范围与限制
+type apiTokenRestrictionRequest struct {
+	Scopes             []string `json:"scopes"`
+	AgentIDs           []uint   `json:"agent_ids"`
+	DeviceNames        []string `json:"device_names"`
+	AllowedCIDRs       []string `json:"allowed_cidrs"`
+	RateLimitPerMinute int      `json:"rate_limit_per_minute"`
+}
+
+const maxAPITokenRateLimit = 6000
+
+// applyAPITokenRestriction 校验并写入访问限制，智能体与设备必须属于令牌所在组织
+func (uc *UserController) applyAPITokenRestriction(req apiTokenRestrictionRequest, token *models.APIToken) error {
+	if len(req.Scopes) == 0 {
+		return fmt.Errorf("至少选择一个访问范围")
+	}
+	for _, scope := range req.Scopes {
+		if !middleware.ValidScope(scope) {
+			return fmt.Errorf("无效的访问范围: %s", scope)
+		}
+	}
+	if req.RateLimitPerMinute < 0 || req.RateLimitPerMinute > maxAPITokenRateLimit {
+		return fmt.Errorf("每分钟请求上限需在 0-%d 之间", maxAPITokenRateLimit)
+	}
+
+	agentIDs := make([]string, 0, len(req.AgentIDs))
+	if len(req.AgentIDs) > 0 {
+		var count int64
+		uc.DB.Model(&models.Agent{}).Where("id IN ? AND org_id = ?", req.AgentIDs, token.OrgID).Count(&count)
+		if int(count) != len(uniqueUints(req.AgentIDs)) {
+			return fmt.Errorf("智能体不存在或不属于当前组织")
+		}
+		for _, id := range uniqueUints(req.AgentIDs) {
+			agentIDs = append(agentIDs, strconv.FormatUint(uint64(id), 10))
+		}
+	}
+
+	deviceNames := make([]string, 0, len(req.DeviceNames))
+	for _, name := range req.DeviceNames {
+		if name = strings.TrimSpace(name); name != "" {
+			deviceNames = append(deviceNames, name)
+		}
+	}
+	if len(deviceNames) > 0 {
+		var count int64
+		uc.DB.Model(&models.Device{}).Where("device_name IN ? AND org_id = ?", deviceNames, token.OrgID).Count(&count)
+		if int(count) != len(deviceNames) {
+			return fmt.Errorf("设备不存在或不属于当前组织")
+		}
+	}
+
+	cidrs := make([]string, 0, len(req.AllowedCIDRs))
+	for _, cidr := range req.AllowedCIDRs {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		if !middleware.ValidateIPOrCIDR(cidr) {
+			return fmt.Errorf("无效的IP或CIDR: %s", cidr)
+		}
+		cidrs = append(cidrs, cidr)
+	}
+
+	token.Scopes = strings.Join(req.Scopes, ",")
+	token.AgentIDs = strings.Join(agentIDs, ",")
+	token.DeviceNames = strings.Join(deviceNames, ",")
+	token.AllowedCIDRs = strings.Join(cidrs, ",")
+	token.RateLimitPerMinute = req.RateLimitPerMinute
+	return nil
+}
+
+func uniqueUints(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	result := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// restrictAgentsByToken 按 API Token 的智能体白名单过滤查询，JWT 请求不过滤
+func restrictAgentsByToken(c *gin.Context, query *gorm.DB, column string) *gorm.DB {
+	if r := middleware.TokenRestriction(c); r != nil && r.AgentIDs != nil {
+		return query.Where(column+" IN ?", r.AgentIDList())
+	}
+	return query
+}
+
+// restrictDevicesByToken 按 API Token 的设备白名单过滤查询，JWT 请求不过滤
+func restrictDevicesByToken(c *gin.Context, query *gorm.DB, column string) *gorm.DB {
+	if r := middleware.TokenRestriction(c); r != nil && r.DeviceNames != nil {
+		return query.Where(column+" IN ?", r.DeviceNameList())
+	}
+	return query
+}
+
+// restrictMessagesByToken 按 API Token 的智能体与设备白名单过滤聊天记录（聊天记录中的 agent_id 为字符串）
+func restrictMessagesByToken(c *gin.Context, query *gorm.DB) *gorm.DB {
+	r := middleware.TokenRestriction(c)
+	if r == nil {
+		return query
+	}
+	if r.AgentIDs != nil {
+		ids := make([]string, 0, len(r.AgentIDs))
+		for _, id := range r.AgentIDList() {
+			ids = append(ids, strconv.FormatUint(uint64(id), 10))
+		}
+		query = query.Where("agent_id IN ?", ids)
 	}
+	return restrictDevicesByToken(c, query, "device_id")
+}
+
+// ListAPITokenScopes 获取可分配的访问范围
+func (uc *UserController) ListAPITokenScopes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"scopes":             middleware.AllScopes,
+		"default_rate_limit": middleware.DefaultAPITokenRateLimit,
+	}})
 }
 
 func generateAPIToken() (string, string, string, error) {
@@ -49,7 +201,7 @@ func generateAPIToken() (string, string, string, error) {
 	return raw, raw[:prefixLen], hash, nil
 }
 
-// CreateAPIToken 创建当前用户的API Token（明文仅返回一次）
+// CreateAPIToken 创建当前用户的API Token（明文仅返回一次），令牌绑定到当前组织，需指定访问范围
 func (uc *UserController) CreateAPIToken(c *gin.Context) {
 	userIDRaw, _ := c.Get("user_id")
 	userID, ok := userIDRaw.(uint)
@@ -59,6 +211,7 @@ func (uc *UserController) CreateAPIToken(c *gin.Context) {
 	}
 
 	var req struct {
+		apiTokenRestrictionRequest
 		Name      string `json:"name" binding:"required,min=2,max=100"`
 		ExpiresIn int    `json:"expires_in_days"`
 	}
@@ -81,12 +234,17 @@ func (uc *UserController) CreateAPIToken(c *gin.Context) {
 
 	token := models.APIToken{
 		UserID:      userID,
+		OrgID:       currentOrgID(c),
 		Name:        strings.TrimSpace(req.Name),
 		TokenPrefix: prefix,
 		TokenHash:   hash,
 		IsActive:    true,
 		ExpiresAt:   expiresAt,
 	}
+	if err := uc.applyAPITokenRestriction(req.apiTokenRestrictionRequest, &token); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err := uc.DB.Create(&token).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存API Token失败"})
 		return
@@ -101,17 +259,10 @@ func (uc *UserController) CreateAPIToken(c *gin.Context) {
 	})
 }
 
-// ListAPITokens 获取当前用户的API Token列表（不返回明文）
+// ListAPITokens 获取当前组织的API Token列表（不返回明文）
 func (uc *UserController) ListAPITokens(c *gin.Context) {
-	userIDRaw, _ := c.Get("user_id")
-	userID, ok := userIDRaw.(uint)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效用户上下文"})
-		return
-	}
-
 	var tokens []models.APIToken
-	if err := uc.DB.Where("user_id = ?", userID).Order("id DESC").Find(&tokens).Error; err != nil {
+	if err := uc.DB.Where("org_id = ?", currentOrgID(c)).Order("id DESC").Find(&tokens).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取API Token列表失败"})
 		return
 	}
@@ -124,18 +275,36 @@ func (uc *UserController) ListAPITokens(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": result})
 }
 
-// RevokeAPIToken 吊销当前用户的API Token
-func (uc *UserController) RevokeAPIToken(c *gin.Context) {
-	userIDRaw, _ := c.Get("user_id")
-	userID, ok := userIDRaw.(uint)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效用户上下文"})
+// UpdateAPIToken 修改当前组织内API Token的访问范围、白名单与限流
+func (uc *UserController) UpdateAPIToken(c *gin.Context) {
+	var req apiTokenRestrictionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	var token models.APIToken
+	if err := uc.DB.Where("id = ? AND org_id = ?", c.Param("id"), currentOrgID(c)).First(&token).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API Token不存在"})
+		return
+	}
+	if err := uc.applyAPITokenRestriction(req, &token); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := uc.DB.Model(&token).Select("scopes", "agent_ids", "device_names", "allowed_cidrs", "rate_limit_per_minute").Updates(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新API Token失败"})
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{"message": "API Token已更新", "data": toAPITokenResponse(token)})
+}
+
+// RevokeAPIToken 吊销当前组织内的API Token
+func (uc *UserController) RevokeAPIToken(c *gin.Context) {
 	tokenID := c.Param("id")
 	res := uc.DB.Model(&models.APIToken{}).
-		Where("id = ? AND user_id = ?", tokenID, userID).
+		Where("id = ? AND org_id = ?", tokenID, currentOrgID(c)).
 		Updates(map[string]interface{}{"is_active": false})
 	if res.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "吊销API Token失败"})
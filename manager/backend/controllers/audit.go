@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 单次导出的最大条数，避免一次性拉取全表
+const auditExportLimit = 10000
+
+// AuditController 管理员查询与导出审计日志（只读）
+type AuditController struct {
+	DB *gorm.DB
+}
+
+// parseAuditTime 支持 RFC3339 与 2006-01-02，日期格式的结束时间包含整天
+func parseAuditTime(value string, endOfDay bool) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		if endOfDay {
+			t = t.Add(24 * time.Hour)
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// auditQuery 按查询参数构建过滤条件
+func (ac *AuditController) auditQuery(c *gin.Context) *gorm.DB {
+	query := ac.DB.Model(&models.AuditLog{})
+	for param, column := range map[string]string{
+		"org_id":        "org_id",
+		"actor_id":      "actor_id",
+		"actor_role":    "actor_role",
+		"action":        "action",
+		"resource_type": "resource_type",
+		"resource_id":   "resource_id",
+	} {
+		if v := strings.TrimSpace(c.Query(param)); v != "" {
+			query = query.Where(column+" = ?", v)
+		}
+	}
+	if v := strings.TrimSpace(c.Query("actor_name")); v != "" {
+		query = query.Where("actor_name LIKE ?", "%"+v+"%")
+	}
+	switch c.Query("result") {
+	case "success":
+		query = query.Where("status_code < ?", http.StatusBadRequest)
+	case "failed":
+		query = query.Where("status_code >= ?", http.StatusBadRequest)
+	}
+	if v := c.Query("start_time"); v != "" {
+		if t, ok := parseAuditTime(v, false); ok {
+			query = query.Where("created_at >= ?", t)
+		}
+	}
+	if v := c.Query("end_time"); v != "" {
+		if t, ok := parseAuditTime(v, true); ok {
+			query = query.Where("created_at < ?", t)
+		}
+	}
+	return query
+}
+
+// ListAuditLogs 分页查询审计日志
+func (ac *AuditController) ListAuditLogs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := ac.auditQuery(c)
+	var total int64
+	query.Count(&total)
+	var logs []models.AuditLog
+	if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审计日志失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": logs, "total": total, "page": page, "page_size": pageSize})
+}
+
+// GetAuditLog 获取单条审计日志详情
+func (ac *AuditController) GetAuditLog(c *gin.Context) {
+	var entry models.AuditLog
+	if err := ac.DB.First(&entry, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "审计日志不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": entry})
+}
+
+// ListAuditFacets 获取已出现过的动作与资源类型，供筛选下拉使用
+func (ac *AuditController) ListAuditFacets(c *gin.Context) {
+	var actions, resourceTypes []string
+	ac.DB.Model(&models.AuditLog{}).Distinct().Order("action").Pluck("action", &actions)
+	ac.DB.Model(&models.AuditLog{}).Distinct().Order("resource_type").Pluck("resource_type", &resourceTypes)
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"actions": actions, "resource_types": resourceTypes}})
+}
+
+// ExportAuditLogs 按筛选条件导出审计日志，format=json（默认）或 csv
+func (ac *AuditController) ExportAuditLogs(c *gin.Context) {
+	var logs []models.AuditLog
+	if err := ac.auditQuery(c).Order("id ASC").Limit(auditExportLimit).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导出失败"})
+		return
+	}
+
+	filename := "audit_logs_" + time.Now().Format("20060102_150405")
+	if c.Query("format") != "csv" {
+		c.Header("Content-Disposition", "attachment; filename="+filename+".json")
+		c.JSON(http.StatusOK, gin.H{
+			"export_time": time.Now().Format("2006-01-02 15:04:05"),
+			"total":       len(logs),
+			"truncated":   len(logs) == auditExportLimit,
+			"logs":        logs,
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", "attachment; filename="+filename+".csv")
+	c.Status(http.StatusOK)
+	// 写入 UTF-8 BOM，便于 Excel 正确识别中文
+	c.Writer.Write([]byte("\xEF\xBB\xBF"))
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "created_at", "org_id", "actor_id", "actor_name", "actor_role", "action", "resource_type", "resource_id", "method", "path", "status_code", "ip", "user_agent", "before", "after", "diff"})
+	for _, l := range logs {
+		w.Write([]string{
+			strconv.FormatUint(uint64(l.ID), 10),
+			l.CreatedAt.Format(time.RFC3339),
+			strconv.FormatUint(uint64(l.OrgID), 10),
+			strconv.FormatUint(uint64(l.ActorID), 10),
+			l.ActorName,
+			l.ActorRole,
+			l.Action,
+			l.ResourceType,
+			l.ResourceID,
+			l.Method,
+			l.Path,
+			strconv.Itoa(l.StatusCode),
+			l.IP,
+			l.UserAgent,
+			l.Before,
+			l.After,
+			l.Diff,
+		})
+	}
+	w.Flush()
+}
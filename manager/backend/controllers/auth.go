@@ -13,6 +13,8 @@ import (
 
 type AuthController struct {
 	DB *gorm.DB
+	// LocalLoginDisabled 启用单点登录后禁止普通用户使用本地密码登录，管理员仍可登录以便应急
+	LocalLoginDisabled bool
 }
 
 type LoginRequest struct {
@@ -49,6 +51,10 @@ func (ac *AuthController) Login(c *gin.Context) {
 
 			if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err == nil {
 				log.Printf("[Login] ✅ 密码验证成功 - 用户: %s", req.Username)
+				if ac.LocalLoginDisabled && user.Role != "admin" {
+					c.JSON(http.StatusForbidden, gin.H{"error": "已禁用本地账号登录，请使用单点登录"})
+					return
+				}
 				token, err := middleware.GenerateToken(user.ID, user.Username, user.Role)
 				if err != nil {
 					log.Printf("[Login] ❌ 生成token失败: %v", err)
@@ -103,6 +109,10 @@ func (ac *AuthController) Login(c *gin.Context) {
 
 // 用户注册
 func (ac *AuthController) Register(c *gin.Context) {
+	if ac.LocalLoginDisabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "已禁用本地账号注册，请使用单点登录"})
+		return
+	}
 	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
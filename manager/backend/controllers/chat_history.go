@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"time"
 	"xiaozhi/manager/backend/models"
+	"xiaozhi/manager/backend/services/webhook"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -77,6 +78,7 @@ func (c *ChatHistoryController) SaveMessage(ctx *gin.Context) {
 		DeviceID:      req.DeviceID,
 		AgentID:       agentID,
 		UserID:        device.UserID,
+		OrgID:         device.OrgID,
 		SessionID:     req.SessionID,
 		Role:          req.Role,
 		Content:       req.Content,
@@ -174,12 +176,36 @@ func (c *ChatHistoryController) SaveMessage(ctx *gin.Context) {
 		return
 	}
 
+	publishMessageWebhookEvent(message, device)
 	ctx.JSON(http.StatusCreated, message)
 }
 
+// publishMessageWebhookEvent 带工具调用的助手消息发布 tool.called，其余助手消息视为一轮对话结束
+func publishMessageWebhookEvent(message *models.ChatMessage, device models.Device) {
+	if message.Role != "assistant" {
+		return
+	}
+	agentID, _ := strconv.ParseUint(message.AgentID, 10, 64)
+	data := map[string]interface{}{
+		"device_id":  message.DeviceID,
+		"session_id": message.SessionID,
+		"message_id": message.MessageID,
+	}
+	if message.ToolCallsJSON != nil && *message.ToolCallsJSON != "" {
+		var toolCalls []map[string]interface{}
+		if err := json.Unmarshal([]byte(*message.ToolCallsJSON), &toolCalls); err == nil {
+			data["tool_calls"] = toolCalls
+		}
+		webhook.Publish(webhook.Event{Type: webhook.EventToolCalled, OrgID: device.OrgID, AgentID: uint(agentID), Data: data})
+		return
+	}
+	data["content"] = message.Content
+	webhook.Publish(webhook.Event{Type: webhook.EventConversationTurnEnded, OrgID: device.OrgID, AgentID: uint(agentID), Data: data})
+}
+
 // GetMessages 获取消息列表（按agentId汇总）
 func (c *ChatHistoryController) GetMessages(ctx *gin.Context) {
-	userID, exists := ctx.Get("user_id")
+	_, exists := ctx.Get("user_id")
 	if !exists {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
 		return
@@ -194,7 +220,8 @@ func (c *ChatHistoryController) GetMessages(ctx *gin.Context) {
 
 	// 构建查询
 	query := c.DB.Model(&models.ChatMessage{}).
-		Where("user_id = ? AND is_deleted = ?", userID, false)
+		Where("org_id = ? AND is_deleted = ?", currentOrgID(ctx), false)
+	query = restrictMessagesByToken(ctx, query)
 
 	if agentID != "" {
 		query = query.Where("agent_id = ?", agentID)
@@ -233,7 +260,7 @@ func (c *ChatHistoryController) GetMessages(ctx *gin.Context) {
 func (c *ChatHistoryController) DeleteMessage(ctx *gin.Context) {
 	id := ctx.Param("id")
 
-	userID, exists := ctx.Get("user_id")
+	_, exists := ctx.Get("user_id")
 	if !exists {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
 		return
@@ -241,7 +268,7 @@ func (c *ChatHistoryController) DeleteMessage(ctx *gin.Context) {
 
 	// 获取消息信息
 	var message models.ChatMessage
-	if err := c.DB.Where("id = ? AND user_id = ?", id, userID).First(&message).Error; err != nil {
+	if err := c.DB.Where("id = ? AND org_id = ?", id, currentOrgID(ctx)).First(&message).Error; err != nil {
 		ctx.JSON(http.StatusNotFound, gin.H{"error": "消息不存在"})
 		return
 	}
@@ -267,7 +294,7 @@ func (c *ChatHistoryController) DeleteMessage(ctx *gin.Context) {
 
 // GetMessagesByAgent 按AgentID获取消息汇总（支持筛选）
 func (c *ChatHistoryController) GetMessagesByAgent(ctx *gin.Context) {
-	userID, exists := ctx.Get("user_id")
+	_, exists := ctx.Get("user_id")
 	if !exists {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
 		return
@@ -283,7 +310,7 @@ func (c *ChatHistoryController) GetMessagesByAgent(ctx *gin.Context) {
 
 	// 构建查询
 	query := c.DB.Model(&models.ChatMessage{}).
-		Where("user_id = ? AND agent_id = ? AND is_deleted = ?", userID, agentID, false)
+		Where("org_id = ? AND agent_id = ? AND is_deleted = ?", currentOrgID(ctx), agentID, false)
 
 	// 角色筛选
 	if role != "" {
@@ -333,7 +360,7 @@ func (c *ChatHistoryController) GetMessagesByAgent(ctx *gin.Context) {
 
 // ExportMessages 导出聊天记录（JSON格式）
 func (c *ChatHistoryController) ExportMessages(ctx *gin.Context) {
-	userID, exists := ctx.Get("user_id")
+	_, exists := ctx.Get("user_id")
 	if !exists {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
 		return
@@ -346,7 +373,8 @@ func (c *ChatHistoryController) ExportMessages(ctx *gin.Context) {
 
 	// 构建查询
 	query := c.DB.Model(&models.ChatMessage{}).
-		Where("user_id = ? AND is_deleted = ?", userID, false)
+		Where("org_id = ? AND is_deleted = ?", currentOrgID(ctx), false)
+	query = restrictMessagesByToken(ctx, query)
 
 	if agentID != "" {
 		query = query.Where("agent_id = ?", agentID)
@@ -432,7 +460,7 @@ func (c *ChatHistoryController) deleteAudioFile(relativePath string) error {
 func (c *ChatHistoryController) GetAudioFile(ctx *gin.Context) {
 	id := ctx.Param("id")
 
-	userID, exists := ctx.Get("user_id")
+	_, exists := ctx.Get("user_id")
 	if !exists {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
 		return
@@ -440,7 +468,7 @@ func (c *ChatHistoryController) GetAudioFile(ctx *gin.Context) {
 
 	// 获取消息信息
 	var message models.ChatMessage
-	if err := c.DB.Where("id = ? AND user_id = ? AND is_deleted = ?", id, userID, false).First(&message).Error; err != nil {
+	if err := c.DB.Where("id = ? AND org_id = ? AND is_deleted = ?", id, currentOrgID(ctx), false).First(&message).Error; err != nil {
 		ctx.JSON(http.StatusNotFound, gin.H{"error": "消息不存在"})
 		return
 	}
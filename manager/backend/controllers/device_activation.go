@@ -7,8 +7,10 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"xiaozhi/manager/backend/models"
+	"xiaozhi/manager/backend/services/audit"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -262,6 +264,23 @@ func (dac *DeviceActivationController) ActivateDevice(c *gin.Context) {
 		return
 	}
 
+	// 设备激活由设备自身发起，不经过 JWT，显式写入审计日志
+	audit.Record(dac.DB, audit.Entry{
+		OrgID:        device.OrgID,
+		ActorName:    "device:" + device.DeviceName,
+		ActorRole:    audit.ActorRoleDevice,
+		Action:       audit.ActionActivate,
+		ResourceType: "devices",
+		ResourceID:   strconv.FormatUint(uint64(device.ID), 10),
+		Method:       c.Request.Method,
+		Path:         c.Request.URL.Path,
+		StatusCode:   http.StatusOK,
+		Before:       map[string]interface{}{"activated": false},
+		After:        map[string]interface{}{"activated": true, "client_id": req.ClientId, "serial_number": req.SerialNumber},
+		IP:           c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+	})
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "设备激活成功",
@@ -0,0 +1,410 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"xiaozhi/manager/backend/models"
+	"xiaozhi/manager/backend/services/experiment"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ExperimentController 管理当前组织智能体的 A/B 实验
+type ExperimentController struct {
+	DB *gorm.DB
+}
+
+type experimentVariantRequest struct {
+	Key         string  `json:"key"`
+	Name        string  `json:"name"`
+	Weight      int     `json:"weight"`
+	Prompt      *string `json:"prompt"`
+	LLMConfigID *string `json:"llm_config_id"`
+	TTSConfigID *string `json:"tts_config_id"`
+	Voice       *string `json:"voice"`
+}
+
+type experimentRequest struct {
+	Name        string                     `json:"name" binding:"required,min=2,max=100"`
+	Description string                     `json:"description"`
+	AgentID     uint                       `json:"agent_id" binding:"required"`
+	Variants    []experimentVariantRequest `json:"variants"`
+}
+
+// trimOptional 去除首尾空白，空字符串视为未设置（沿用智能体配置）
+func trimOptional(v *string) *string {
+	if v == nil {
+		return nil
+	}
+	s := strings.TrimSpace(*v)
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// validate 校验请求：智能体属于当前组织，覆盖的 LLM/TTS 配置存在且启用
+func (ec *ExperimentController) validate(c *gin.Context, req experimentRequest, exp *models.Experiment) error {
+	var count int64
+	ec.DB.Model(&models.Agent{}).Where("id = ? AND org_id = ?", req.AgentID, currentOrgID(c)).Count(&count)
+	if count == 0 {
+		return errors.New("智能体不存在或不属于当前组织")
+	}
+
+	variants := make([]models.ExperimentVariant, 0, len(req.Variants))
+	for _, v := range req.Variants {
+		variant := models.ExperimentVariant{
+			Key:         strings.TrimSpace(v.Key),
+			Name:        strings.TrimSpace(v.Name),
+			Weight:      v.Weight,
+			LLMConfigID: trimOptional(v.LLMConfigID),
+			TTSConfigID: trimOptional(v.TTSConfigID),
+			Voice:       trimOptional(v.Voice),
+		}
+		// 提示词保留原样，仅空白时视为未设置
+		if v.Prompt != nil && strings.TrimSpace(*v.Prompt) != "" {
+			variant.Prompt = v.Prompt
+		}
+		for typ, id := range map[string]*string{"llm": variant.LLMConfigID, "tts": variant.TTSConfigID} {
+			if id == nil {
+				continue
+			}
+			ec.DB.Model(&models.Config{}).Where("config_id = ? AND type = ? AND enabled = ?", *id, typ, true).Count(&count)
+			if count == 0 {
+				return errors.New("分组 " + variant.Key + " 的 " + strings.ToUpper(typ) + " 配置不存在或未启用")
+			}
+		}
+		variants = append(variants, variant)
+	}
+	if err := experiment.ValidateVariants(variants); err != nil {
+		return err
+	}
+
+	exp.Name = strings.TrimSpace(req.Name)
+	exp.Description = strings.TrimSpace(req.Description)
+	exp.AgentID = req.AgentID
+	exp.Variants = variants
+	return nil
+}
+
+func (ec *ExperimentController) loadExperiment(c *gin.Context) (*models.Experiment, bool) {
+	var exp models.Experiment
+	err := ec.DB.Preload("Variants", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") }).
+		Where("id = ? AND org_id = ?", c.Param("id"), currentOrgID(c)).First(&exp).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "实验不存在"})
+		return nil, false
+	}
+	return &exp, true
+}
+
+// ListExperiments 获取当前组织的实验列表，可按 agent_id 过滤
+func (ec *ExperimentController) ListExperiments(c *gin.Context) {
+	query := ec.DB.Preload("Variants", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") }).
+		Where("org_id = ?", currentOrgID(c))
+	if agentID := c.Query("agent_id"); agentID != "" {
+		query = query.Where("agent_id = ?", agentID)
+	}
+	var exps []models.Experiment
+	if err := query.Order("id DESC").Find(&exps).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取实验列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": exps})
+}
+
+// GetExperiment 获取实验详情
+func (ec *ExperimentController) GetExperiment(c *gin.Context) {
+	exp, ok := ec.loadExperiment(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": exp})
+}
+
+// CreateExperiment 创建实验，创建后为草稿状态，启动后才开始分流
+func (ec *ExperimentController) CreateExperiment(c *gin.Context) {
+	var req experimentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	exp := models.Experiment{OrgID: currentOrgID(c), UserID: currentUserID(c), Status: models.ExperimentStatusDraft}
+	if err := ec.validate(c, req, &exp); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := ec.DB.Create(&exp).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建实验失败"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "实验创建成功", "data": exp})
+}
+
+// UpdateExperiment 更新实验定义；运行中的实验需先停止，避免同一实验前后数据口径不一致
+func (ec *ExperimentController) UpdateExperiment(c *gin.Context) {
+	exp, ok := ec.loadExperiment(c)
+	if !ok {
+		return
+	}
+	if exp.Status == models.ExperimentStatusRunning {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "运行中的实验不能修改，请先停止"})
+		return
+	}
+	var req experimentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if err := ec.validate(c, req, exp); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err := ec.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(exp).Select("name", "description", "agent_id").Updates(exp).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("experiment_id = ?", exp.ID).Delete(&models.ExperimentVariant{}).Error; err != nil {
+			return err
+		}
+		for i := range exp.Variants {
+			exp.Variants[i].ExperimentID = exp.ID
+		}
+		return tx.Create(&exp.Variants).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新实验失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "实验已更新", "data": exp})
+}
+
+// DeleteExperiment 删除实验及其分组与结果数据
+func (ec *ExperimentController) DeleteExperiment(c *gin.Context) {
+	exp, ok := ec.loadExperiment(c)
+	if !ok {
+		return
+	}
+	err := ec.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("experiment_id = ?", exp.ID).Delete(&models.ExperimentTurn{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("experiment_id = ?", exp.ID).Delete(&models.ExperimentVariant{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(exp).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除实验失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "实验已删除"})
+}
+
+// StartExperiment 启动实验，同一智能体同时只能运行一个实验
+func (ec *ExperimentController) StartExperiment(c *gin.Context) {
+	exp, ok := ec.loadExperiment(c)
+	if !ok {
+		return
+	}
+	if exp.Status == models.ExperimentStatusRunning {
+		c.JSON(http.StatusOK, gin.H{"message": "实验已在运行中", "data": exp})
+		return
+	}
+	var running int64
+	ec.DB.Model(&models.Experiment{}).
+		Where("agent_id = ? AND status = ? AND id <> ?", exp.AgentID, models.ExperimentStatusRunning, exp.ID).
+		Count(&running)
+	if running > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "该智能体已有运行中的实验，请先停止"})
+		return
+	}
+	now := time.Now()
+	updates := map[string]interface{}{"status": models.ExperimentStatusRunning, "stopped_at": nil}
+	if exp.StartedAt == nil {
+		updates["started_at"] = now
+	}
+	if err := ec.DB.Model(exp).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "启动实验失败"})
+		return
+	}
+	ec.DB.First(exp, exp.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "实验已启动，设备下次获取配置时生效", "data": exp})
+}
+
+// StopExperiment 停止实验，设备恢复使用智能体配置，已收集的结果保留
+func (ec *ExperimentController) StopExperiment(c *gin.Context) {
+	exp, ok := ec.loadExperiment(c)
+	if !ok {
+		return
+	}
+	if exp.Status != models.ExperimentStatusRunning {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "实验未在运行"})
+		return
+	}
+	if err := ec.DB.Model(exp).Updates(map[string]interface{}{"status": models.ExperimentStatusStopped, "stopped_at": time.Now()}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "停止实验失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "实验已停止", "data": exp})
+}
+
+// GetExperimentResults 按分组汇总延迟、轮次数、打断率与错误数
+func (ec *ExperimentController) GetExperimentResults(c *gin.Context) {
+	exp, ok := ec.loadExperiment(c)
+	if !ok {
+		return
+	}
+	results, err := experiment.Results(ec.DB, exp)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "汇总实验结果失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"experiment": exp, "variants": results}})
+}
+
+type experimentTurnReport struct {
+	ExperimentID    uint      `json:"experiment_id"`
+	Variant         string    `json:"variant"`
+	DeviceID        string    `json:"device_id"`
+	SessionID       string    `json:"session_id"`
+	TurnLatencyMs   int64     `json:"turn_latency_ms"`
+	AsrFirstTextMs  int64     `json:"asr_first_text_ms"`
+	LlmFirstTokenMs int64     `json:"llm_first_token_ms"`
+	TtsFirstFrameMs int64     `json:"tts_first_frame_ms"`
+	Interrupted     bool      `json:"interrupted"`
+	Error           string    `json:"error"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// ReportExperimentTurns 接收主程序上报的实验轮次结果（内部服务接口），忽略不存在的实验
+func (ec *ExperimentController) ReportExperimentTurns(c *gin.Context) {
+	var req struct {
+		Turns []experimentTurnReport `json:"turns"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	ids := make([]uint, 0)
+	for _, t := range req.Turns {
+		ids = append(ids, t.ExperimentID)
+	}
+	var known []uint
+	if len(ids) > 0 {
+		ec.DB.Model(&models.Experiment{}).Where("id IN ?", ids).Pluck("id", &known)
+	}
+	knownSet := make(map[uint]bool, len(known))
+	for _, id := range known {
+		knownSet[id] = true
+	}
+
+	turns := make([]models.ExperimentTurn, 0, len(req.Turns))
+	for _, t := range req.Turns {
+		if !knownSet[t.ExperimentID] || t.Variant == "" {
+			continue
+		}
+		turn := models.ExperimentTurn{
+			ExperimentID:    t.ExperimentID,
+			Variant:         truncateRunes(t.Variant, 32),
+			DeviceID:        truncateRunes(t.DeviceID, 100),
+			SessionID:       truncateRunes(t.SessionID, 100),
+			TurnLatencyMs:   t.TurnLatencyMs,
+			AsrFirstTextMs:  t.AsrFirstTextMs,
+			LlmFirstTokenMs: t.LlmFirstTokenMs,
+			TtsFirstFrameMs: t.TtsFirstFrameMs,
+			Interrupted:     t.Interrupted,
+			ErrorMessage:    truncateRunes(t.Error, 500),
+			CreatedAt:       t.Timestamp,
+		}
+		if turn.CreatedAt.IsZero() {
+			turn.CreatedAt = time.Now()
+		}
+		turns = append(turns, turn)
+	}
+	if len(turns) > 0 {
+		if err := ec.DB.CreateInBatches(&turns, 100).Error; err != nil {
+			log.Printf("保存实验轮次失败: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存实验轮次失败"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "ok", "data": gin.H{"accepted": len(turns)}})
+}
+
+// experimentProviderInfo 分组覆盖的服务配置，结构与设备配置中的 llm/tts 一致
+type experimentProviderInfo struct {
+	Provider string `json:"provider"`
+	JsonData string `json:"json_data"`
+}
+
+type experimentVariantInfo struct {
+	Key    string                  `json:"key"`
+	Name   string                  `json:"name"`
+	Weight int                     `json:"weight"`
+	Prompt *string                 `json:"prompt,omitempty"`
+	LLM    *experimentProviderInfo `json:"llm,omitempty"`
+	TTS    *experimentProviderInfo `json:"tts,omitempty"`
+}
+
+// experimentConfigInfo 随设备配置下发的运行中实验，主程序按设备哈希选择分组
+type experimentConfigInfo struct {
+	ID       uint                    `json:"id"`
+	Name     string                  `json:"name"`
+	Variants []experimentVariantInfo `json:"variants"`
+}
+
+// buildRunningExperimentConfig 解析智能体运行中实验的各分组覆盖项；baseTTS 为智能体当前 TTS，
+// 分组只改音色时在其基础上覆盖；applyVoice 与智能体音色的处理方式保持一致
+func buildRunningExperimentConfig(db *gorm.DB, agent models.Agent, baseTTS models.Config, applyVoice func(cfg *models.Config, voice *string)) *experimentConfigInfo {
+	var exp models.Experiment
+	err := db.Preload("Variants", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") }).
+		Where("agent_id = ? AND status = ?", agent.ID, models.ExperimentStatusRunning).
+		Order("id DESC").First(&exp).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("查询智能体 %d 运行中实验失败: %v", agent.ID, err)
+		}
+		return nil
+	}
+
+	info := &experimentConfigInfo{ID: exp.ID, Name: exp.Name, Variants: make([]experimentVariantInfo, 0, len(exp.Variants))}
+	for _, v := range exp.Variants {
+		variant := experimentVariantInfo{Key: v.Key, Name: v.Name, Weight: v.Weight}
+		if v.Prompt != nil {
+			prompt := strings.ReplaceAll(*v.Prompt, "{{assistant_name}}", agent.Name)
+			variant.Prompt = &prompt
+		}
+		if v.LLMConfigID != nil {
+			var llm models.Config
+			if err := db.Where("config_id = ? AND type = ? AND enabled = ?", *v.LLMConfigID, "llm", true).First(&llm).Error; err == nil {
+				variant.LLM = &experimentProviderInfo{Provider: llm.Provider, JsonData: llm.JsonData}
+			} else {
+				log.Printf("实验 %d 分组 %s 的 LLM 配置 %s 不可用，沿用智能体配置", exp.ID, v.Key, *v.LLMConfigID)
+			}
+		}
+		if v.TTSConfigID != nil || v.Voice != nil {
+			tts := baseTTS
+			usable := true
+			if v.TTSConfigID != nil {
+				if err := db.Where("config_id = ? AND type = ? AND enabled = ?", *v.TTSConfigID, "tts", true).First(&tts).Error; err != nil {
+					log.Printf("实验 %d 分组 %s 的 TTS 配置 %s 不可用，沿用智能体配置", exp.ID, v.Key, *v.TTSConfigID)
+					usable = false
+				}
+			}
+			if usable {
+				if v.Voice != nil {
+					applyVoice(&tts, v.Voice)
+				}
+				variant.TTS = &experimentProviderInfo{Provider: tts.Provider, JsonData: tts.JsonData}
+			}
+		}
+		info.Variants = append(info.Variants, variant)
+	}
+	return info
+}
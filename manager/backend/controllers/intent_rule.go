@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	intentMatchKeyword   = "keyword"
+	intentMatchRegex     = "regex"
+	intentMatchEmbedding = "embedding"
+
+	intentActionTool   = "tool"
+	intentActionReply  = "reply"
+	intentActionAgent  = "agent"
+	intentActionMode   = "mode"
+	intentActionLLM    = "llm"
+	intentActionPrompt = "prompt" // 展开 MCP 提示词（tool_name 为提示词名，target 为服务名）作为本轮 LLM 输入
+)
+
+var intentModeTargets = map[string]bool{"openclaw": true, "normal": true}
+
+// IntentRuleInfo 意图路由规则（请求/响应及下发给主程序的结构）
+type IntentRuleInfo struct {
+	ID        uint     `json:"id"`
+	Name      string   `json:"name"`
+	MatchType string   `json:"match_type"`
+	Patterns  []string `json:"patterns"`
+	Threshold float64  `json:"threshold"`
+	Action    string   `json:"action"`
+	ToolName  string   `json:"tool_name"`
+	ToolArgs  string   `json:"tool_args"`
+	Reply     string   `json:"reply"`
+	Target    string   `json:"target"`
+	Priority  int      `json:"priority"`
+	Enabled   bool     `json:"enabled"`
+}
+
+func intentRuleInfoFromModel(rule models.AgentIntentRule) IntentRuleInfo {
+	patterns := make([]string, 0)
+	if strings.TrimSpace(rule.Patterns) != "" {
+		_ = json.Unmarshal([]byte(rule.Patterns), &patterns)
+	}
+	return IntentRuleInfo{
+		ID:        rule.ID,
+		Name:      rule.Name,
+		MatchType: rule.MatchType,
+		Patterns:  patterns,
+		Threshold: rule.Threshold,
+		Action:    rule.Action,
+		ToolName:  rule.ToolName,
+		ToolArgs:  rule.ToolArgs,
+		Reply:     rule.Reply,
+		Target:    rule.Target,
+		Priority:  rule.Priority,
+		Enabled:   rule.Enabled,
+	}
+}
+
+// validateIntentRule 校验并规范化规则，返回可直接入库的模型
+func validateIntentRule(agentID uint, info IntentRuleInfo) (models.AgentIntentRule, error) {
+	name := strings.TrimSpace(info.Name)
+	if name == "" {
+		return models.AgentIntentRule{}, fmt.Errorf("规则名称不能为空")
+	}
+
+	patterns := make([]string, 0, len(info.Patterns))
+	for _, p := range info.Patterns {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	if len(patterns) == 0 {
+		return models.AgentIntentRule{}, fmt.Errorf("规则 %s 至少需要一个匹配项", name)
+	}
+
+	matchType := strings.ToLower(strings.TrimSpace(info.MatchType))
+	switch matchType {
+	case intentMatchKeyword:
+	case intentMatchRegex:
+		for _, p := range patterns {
+			if _, err := regexp.Compile(p); err != nil {
+				return models.AgentIntentRule{}, fmt.Errorf("规则 %s 的正则 %q 无效: %v", name, p, err)
+			}
+		}
+	case intentMatchEmbedding:
+		if info.Threshold < 0 || info.Threshold > 1 {
+			return models.AgentIntentRule{}, fmt.Errorf("规则 %s 的相似度阈值必须在 0~1 之间", name)
+		}
+	default:
+		return models.AgentIntentRule{}, fmt.Errorf("规则 %s 的匹配类型无效: %s", name, info.MatchType)
+	}
+
+	action := strings.ToLower(strings.TrimSpace(info.Action))
+	target := strings.TrimSpace(info.Target)
+	toolArgs := strings.TrimSpace(info.ToolArgs)
+	switch action {
+	case intentActionTool:
+		if strings.TrimSpace(info.ToolName) == "" {
+			return models.AgentIntentRule{}, fmt.Errorf("规则 %s 需要指定工具名称", name)
+		}
+		if toolArgs != "" {
+			var args map[string]interface{}
+			if err := json.Unmarshal([]byte(toolArgs), &args); err != nil {
+				return models.AgentIntentRule{}, fmt.Errorf("规则 %s 的工具参数必须是 JSON 对象: %v", name, err)
+			}
+		}
+	case intentActionPrompt:
+		if strings.TrimSpace(info.ToolName) == "" {
+			return models.AgentIntentRule{}, fmt.Errorf("规则 %s 需要指定MCP提示词名称", name)
+		}
+		if target == "" {
+			return models.AgentIntentRule{}, fmt.Errorf("规则 %s 需要指定提示词所属的MCP服务", name)
+		}
+		if toolArgs != "" {
+			var args map[string]interface{}
+			if err := json.Unmarshal([]byte(toolArgs), &args); err != nil {
+				return models.AgentIntentRule{}, fmt.Errorf("规则 %s 的提示词参数必须是 JSON 对象: %v", name, err)
+			}
+		}
+	case intentActionReply:
+		if strings.TrimSpace(info.Reply) == "" {
+			return models.AgentIntentRule{}, fmt.Errorf("规则 %s 需要填写回复内容", name)
+		}
+	case intentActionAgent:
+		if target == "" {
+			return models.AgentIntentRule{}, fmt.Errorf("规则 %s 需要指定目标智能体", name)
+		}
+	case intentActionMode:
+		target = strings.ToLower(target)
+		if !intentModeTargets[target] {
+			return models.AgentIntentRule{}, fmt.Errorf("规则 %s 的目标模式无效: %s", name, info.Target)
+		}
+	case intentActionLLM:
+	default:
+		return models.AgentIntentRule{}, fmt.Errorf("规则 %s 的动作无效: %s", name, info.Action)
+	}
+
+	patternsJSON, _ := json.Marshal(patterns)
+	return models.AgentIntentRule{
+		AgentID:   agentID,
+		Name:      name,
+		MatchType: matchType,
+		Patterns:  string(patternsJSON),
+		Threshold: info.Threshold,
+		Action:    action,
+		ToolName:  strings.TrimSpace(info.ToolName),
+		ToolArgs:  toolArgs,
+		Reply:     strings.TrimSpace(info.Reply),
+		Target:    target,
+		Priority:  info.Priority,
+		Enabled:   info.Enabled,
+	}, nil
+}
+
+// loadAgentIntentRules 按优先级（高在前）加载智能体的意图规则，onlyEnabled 为 true 时只返回启用的规则
+func loadAgentIntentRules(db *gorm.DB, agentID uint, onlyEnabled bool) ([]IntentRuleInfo, error) {
+	query := db.Where("agent_id = ?", agentID)
+	if onlyEnabled {
+		query = query.Where("enabled = ?", true)
+	}
+	var rules []models.AgentIntentRule
+	if err := query.Order("priority DESC, id ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	items := make([]IntentRuleInfo, 0, len(rules))
+	for _, rule := range rules {
+		items = append(items, intentRuleInfoFromModel(rule))
+	}
+	return items, nil
+}
+
+func (uc *UserController) GetAgentIntentRules(c *gin.Context) {
+	orgID := currentOrgID(c)
+	agentID, _ := strconv.Atoi(c.Param("id"))
+	if agentID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的智能体ID"})
+		return
+	}
+	if err := uc.assertAgentOwnership(orgID, uint(agentID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	items, err := loadAgentIntentRules(uc.DB, uint(agentID), false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取意图规则失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": items})
+}
+
+// UpdateAgentIntentRules 整体替换智能体的意图规则
+func (uc *UserController) UpdateAgentIntentRules(c *gin.Context) {
+	orgID := currentOrgID(c)
+	agentID, _ := strconv.Atoi(c.Param("id"))
+	if agentID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的智能体ID"})
+		return
+	}
+	if err := uc.assertAgentOwnership(orgID, uint(agentID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	var req struct {
+		Rules []IntentRuleInfo `json:"rules"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	rules := make([]models.AgentIntentRule, 0, len(req.Rules))
+	for _, info := range req.Rules {
+		rule, err := validateIntentRule(uint(agentID), info)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rules = append(rules, rule)
+	}
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].Priority > rules[j].Priority })
+
+	err := uc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("agent_id = ?", agentID).Delete(&models.AgentIntentRule{}).Error; err != nil {
+			return err
+		}
+		for i := range rules {
+			if err := tx.Create(&rules[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新意图规则失败"})
+		return
+	}
+
+	items := make([]IntentRuleInfo, 0, len(rules))
+	for _, rule := range rules {
+		items = append(items, intentRuleInfoFromModel(rule))
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功", "data": items})
+}
@@ -454,9 +454,9 @@ func buildWeknoraModelListCandidateEndpoints(baseURL string) []string {
 }
 
 func (uc *UserController) GetKnowledgeBases(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	var items []models.KnowledgeBase
-	if err := uc.DB.Where("user_id = ?", userID).Order("id DESC").Find(&items).Error; err != nil {
+	if err := uc.DB.Where("org_id = ?", orgID).Order("id DESC").Find(&items).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取知识库列表失败"})
 		return
 	}
@@ -505,6 +505,7 @@ func (uc *UserController) CreateKnowledgeBase(c *gin.Context) {
 		return
 	}
 	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	var req struct {
 		Name                   string   `json:"name" binding:"required,min=1,max=100"`
 		Description            string   `json:"description"`
@@ -528,6 +529,7 @@ func (uc *UserController) CreateKnowledgeBase(c *gin.Context) {
 
 	item := models.KnowledgeBase{
 		UserID:             userID.(uint),
+		OrgID:              orgID,
 		Name:               req.Name,
 		Description:        req.Description,
 		Content:            req.Content,
@@ -557,10 +559,10 @@ func (uc *UserController) CreateKnowledgeBase(c *gin.Context) {
 }
 
 func (uc *UserController) GetKnowledgeBase(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	id := c.Param("id")
 	var item models.KnowledgeBase
-	if err := uc.DB.Where("id = ? AND user_id = ?", id, userID).First(&item).Error; err != nil {
+	if err := uc.DB.Where("id = ? AND org_id = ?", id, orgID).First(&item).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "知识库不存在"})
 		return
 	}
@@ -571,10 +573,10 @@ func (uc *UserController) UpdateKnowledgeBase(c *gin.Context) {
 	if !ensureKnowledgeFeatureEnabled(c, uc.DB) {
 		return
 	}
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	id := c.Param("id")
 	var item models.KnowledgeBase
-	if err := uc.DB.Where("id = ? AND user_id = ?", id, userID).First(&item).Error; err != nil {
+	if err := uc.DB.Where("id = ? AND org_id = ?", id, orgID).First(&item).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "知识库不存在"})
 		return
 	}
@@ -627,7 +629,7 @@ func (uc *UserController) UpdateKnowledgeBase(c *gin.Context) {
 }
 
 func (uc *UserController) DeleteKnowledgeBase(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	id, _ := strconv.Atoi(c.Param("id"))
 	if id <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的知识库ID"})
@@ -635,7 +637,7 @@ func (uc *UserController) DeleteKnowledgeBase(c *gin.Context) {
 	}
 
 	var item models.KnowledgeBase
-	if err := uc.DB.Where("id = ? AND user_id = ?", id, userID).First(&item).Error; err != nil {
+	if err := uc.DB.Where("id = ? AND org_id = ?", id, orgID).First(&item).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "知识库不存在"})
 		return
 	}
@@ -646,7 +648,7 @@ func (uc *UserController) DeleteKnowledgeBase(c *gin.Context) {
 	}
 
 	err := uc.DB.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("id = ? AND user_id = ?", id, userID).Delete(&models.KnowledgeBase{}).Error; err != nil {
+		if err := tx.Where("id = ? AND org_id = ?", id, orgID).Delete(&models.KnowledgeBase{}).Error; err != nil {
 			return err
 		}
 		if err := tx.Where("knowledge_base_id = ?", id).Delete(&models.KnowledgeBaseDocument{}).Error; err != nil {
@@ -683,7 +685,7 @@ func (uc *UserController) DeleteKnowledgeBase(c *gin.Context) {
 }
 
 func (uc *UserController) SyncKnowledgeBase(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	id, _ := strconv.Atoi(c.Param("id"))
 	if id <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的知识库ID"})
@@ -691,7 +693,7 @@ func (uc *UserController) SyncKnowledgeBase(c *gin.Context) {
 	}
 
 	var item models.KnowledgeBase
-	if err := uc.DB.Where("id = ? AND user_id = ?", id, userID).First(&item).Error; err != nil {
+	if err := uc.DB.Where("id = ? AND org_id = ?", id, orgID).First(&item).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "知识库不存在"})
 		return
 	}
@@ -725,6 +727,7 @@ func (uc *UserController) SyncKnowledgeBase(c *gin.Context) {
 
 func (uc *UserController) TestKnowledgeBaseSearch(c *gin.Context) {
 	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	userIDUint := userID.(uint)
 	startAt := time.Now()
 	kbID, _ := strconv.Atoi(c.Param("id"))
@@ -732,7 +735,7 @@ func (uc *UserController) TestKnowledgeBaseSearch(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的知识库ID"})
 		return
 	}
-	kb, err := uc.getOwnedKnowledgeBase(userIDUint, uint(kbID))
+	kb, err := uc.getOwnedKnowledgeBase(orgID, uint(kbID))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -810,13 +813,11 @@ func (uc *UserController) TestKnowledgeBaseSearch(c *gin.Context) {
 		topK,
 	)
 
-	provider, _, providerData, err := resolveKnowledgeProviderForKB(uc.DB, kb)
+	provider, hits, status, err := searchKnowledgeBase(uc.DB, kb, req.Threshold, query, topK)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
-
-	provider = strings.ToLower(strings.TrimSpace(provider))
 	log.Printf(
 		"[KnowledgeTest] ProviderResolved user_id=%d kb_id=%d resolved_provider=%s kb_sync_provider=%s",
 		userIDUint,
@@ -824,47 +825,6 @@ func (uc *UserController) TestKnowledgeBaseSearch(c *gin.Context) {
 		provider,
 		strings.TrimSpace(kb.SyncProvider),
 	)
-	client := &http.Client{Timeout: 12 * time.Second}
-
-	var hits []knowledgeSearchTestHit
-	switch provider {
-	case "dify":
-		cfg, err := parseDifyKnowledgeSyncConfig(providerData)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		hits, err = queryKnowledgeTestByDify(client, cfg, req.Threshold, kb.RetrievalThreshold, providerData, datasetID, strings.TrimSpace(kb.Name), query, topK)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-	case "ragflow":
-		cfg, err := parseRagflowKnowledgeSyncConfig(providerData)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		hits, err = queryKnowledgeTestByRagflow(client, cfg, req.Threshold, kb.RetrievalThreshold, providerData, datasetID, strings.TrimSpace(kb.Name), query, topK)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-	case "weknora":
-		cfg, err := parseWeknoraKnowledgeSyncConfig(providerData)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		hits, err = queryKnowledgeTestByWeknora(client, cfg, req.Threshold, kb.RetrievalThreshold, providerData, datasetID, strings.TrimSpace(kb.Name), query, topK)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("当前 provider %s 暂不支持测试检索", provider)})
-		return
-	}
 
 	log.Printf(
 		"[KnowledgeTest] Finish user_id=%d kb_id=%d provider=%s dataset_id=%s retrieval_threshold=%s request_threshold=%s query=%q top_k=%d hits=%d docs(total=%d synced=%d pending=%d failed=%d)",
@@ -906,14 +866,62 @@ func (uc *UserController) TestKnowledgeBaseSearch(c *gin.Context) {
 	})
 }
 
+// searchKnowledgeBase 在知识库同步的外部 provider 中检索，返回 provider、命中结果，出错时附带建议的 HTTP 状态码
+func searchKnowledgeBase(db *gorm.DB, kb *models.KnowledgeBase, threshold *float64, query string, topK int) (string, []knowledgeSearchTestHit, int, error) {
+	datasetID := strings.TrimSpace(kb.ExternalKBID)
+	if datasetID == "" {
+		return "", nil, http.StatusBadRequest, fmt.Errorf("知识库尚未同步到外部 provider（external_kb_id 为空）")
+	}
+	provider, _, providerData, err := resolveKnowledgeProviderForKB(db, kb)
+	if err != nil {
+		return "", nil, http.StatusBadRequest, err
+	}
+	provider = strings.ToLower(strings.TrimSpace(provider))
+	client := &http.Client{Timeout: 12 * time.Second}
+
+	var hits []knowledgeSearchTestHit
+	switch provider {
+	case "dify":
+		cfg, err := parseDifyKnowledgeSyncConfig(providerData)
+		if err != nil {
+			return provider, nil, http.StatusBadRequest, err
+		}
+		hits, err = queryKnowledgeTestByDify(client, cfg, threshold, kb.RetrievalThreshold, providerData, datasetID, strings.TrimSpace(kb.Name), query, topK)
+		if err != nil {
+			return provider, nil, http.StatusInternalServerError, err
+		}
+	case "ragflow":
+		cfg, err := parseRagflowKnowledgeSyncConfig(providerData)
+		if err != nil {
+			return provider, nil, http.StatusBadRequest, err
+		}
+		hits, err = queryKnowledgeTestByRagflow(client, cfg, threshold, kb.RetrievalThreshold, providerData, datasetID, strings.TrimSpace(kb.Name), query, topK)
+		if err != nil {
+			return provider, nil, http.StatusInternalServerError, err
+		}
+	case "weknora":
+		cfg, err := parseWeknoraKnowledgeSyncConfig(providerData)
+		if err != nil {
+			return provider, nil, http.StatusBadRequest, err
+		}
+		hits, err = queryKnowledgeTestByWeknora(client, cfg, threshold, kb.RetrievalThreshold, providerData, datasetID, strings.TrimSpace(kb.Name), query, topK)
+		if err != nil {
+			return provider, nil, http.StatusInternalServerError, err
+		}
+	default:
+		return provider, nil, http.StatusBadRequest, fmt.Errorf("当前 provider %s 暂不支持测试检索", provider)
+	}
+	return provider, hits, http.StatusOK, nil
+}
+
 func (uc *UserController) GetKnowledgeBaseDocuments(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	kbID, _ := strconv.Atoi(c.Param("id"))
 	if kbID <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的知识库ID"})
 		return
 	}
-	kb, err := uc.getOwnedKnowledgeBase(userID.(uint), uint(kbID))
+	kb, err := uc.getOwnedKnowledgeBase(orgID, uint(kbID))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -928,13 +936,13 @@ func (uc *UserController) GetKnowledgeBaseDocuments(c *gin.Context) {
 }
 
 func (uc *UserController) CreateKnowledgeBaseDocument(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	kbID, _ := strconv.Atoi(c.Param("id"))
 	if kbID <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的知识库ID"})
 		return
 	}
-	kb, err := uc.getOwnedKnowledgeBase(userID.(uint), uint(kbID))
+	kb, err := uc.getOwnedKnowledgeBase(orgID, uint(kbID))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -970,13 +978,13 @@ func (uc *UserController) CreateKnowledgeBaseDocument(c *gin.Context) {
 }
 
 func (uc *UserController) CreateKnowledgeBaseDocumentByUpload(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	kbID, _ := strconv.Atoi(c.Param("id"))
 	if kbID <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的知识库ID"})
 		return
 	}
-	kb, err := uc.getOwnedKnowledgeBase(userID.(uint), uint(kbID))
+	kb, err := uc.getOwnedKnowledgeBase(orgID, uint(kbID))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -1051,14 +1059,14 @@ func (uc *UserController) createKnowledgeBaseDocumentRecord(kbID uint, name, con
 }
 
 func (uc *UserController) UpdateKnowledgeBaseDocument(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	kbID, _ := strconv.Atoi(c.Param("id"))
 	docID, _ := strconv.Atoi(c.Param("doc_id"))
 	if kbID <= 0 || docID <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的参数"})
 		return
 	}
-	kb, err := uc.getOwnedKnowledgeBase(userID.(uint), uint(kbID))
+	kb, err := uc.getOwnedKnowledgeBase(orgID, uint(kbID))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -1109,14 +1117,14 @@ func (uc *UserController) UpdateKnowledgeBaseDocument(c *gin.Context) {
 }
 
 func (uc *UserController) DeleteKnowledgeBaseDocument(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	kbID, _ := strconv.Atoi(c.Param("id"))
 	docID, _ := strconv.Atoi(c.Param("doc_id"))
 	if kbID <= 0 || docID <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的参数"})
 		return
 	}
-	kb, err := uc.getOwnedKnowledgeBase(userID.(uint), uint(kbID))
+	kb, err := uc.getOwnedKnowledgeBase(orgID, uint(kbID))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -1144,14 +1152,14 @@ func (uc *UserController) DeleteKnowledgeBaseDocument(c *gin.Context) {
 }
 
 func (uc *UserController) SyncKnowledgeBaseDocument(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	kbID, _ := strconv.Atoi(c.Param("id"))
 	docID, _ := strconv.Atoi(c.Param("doc_id"))
 	if kbID <= 0 || docID <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的参数"})
 		return
 	}
-	kb, err := uc.getOwnedKnowledgeBase(userID.(uint), uint(kbID))
+	kb, err := uc.getOwnedKnowledgeBase(orgID, uint(kbID))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -1191,13 +1199,13 @@ func (uc *UserController) SyncKnowledgeBaseDocument(c *gin.Context) {
 }
 
 func (uc *UserController) GetAgentKnowledgeBases(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	agentID, _ := strconv.Atoi(c.Param("id"))
 	if agentID <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的智能体ID"})
 		return
 	}
-	if err := uc.assertAgentOwnership(userID.(uint), uint(agentID)); err != nil {
+	if err := uc.assertAgentOwnership(orgID, uint(agentID)); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
@@ -1208,7 +1216,7 @@ func (uc *UserController) GetAgentKnowledgeBases(c *gin.Context) {
 	}
 	var items []models.KnowledgeBase
 	if len(ids) > 0 {
-		if err := uc.DB.Where("id IN ? AND user_id = ?", ids, userID).Find(&items).Error; err != nil {
+		if err := uc.DB.Where("id IN ? AND org_id = ?", ids, orgID).Find(&items).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取知识库详情失败"})
 			return
 		}
@@ -1217,13 +1225,13 @@ func (uc *UserController) GetAgentKnowledgeBases(c *gin.Context) {
 }
 
 func (uc *UserController) UpdateAgentKnowledgeBases(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	agentID, _ := strconv.Atoi(c.Param("id"))
 	if agentID <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的智能体ID"})
 		return
 	}
-	if err := uc.assertAgentOwnership(userID.(uint), uint(agentID)); err != nil {
+	if err := uc.assertAgentOwnership(orgID, uint(agentID)); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
@@ -1234,10 +1242,11 @@ func (uc *UserController) UpdateAgentKnowledgeBases(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
 		return
 	}
-	if err := uc.validateKnowledgeBaseOwnership(userID.(uint), req.KnowledgeBaseIDs); err != nil {
+	if err := uc.validateKnowledgeBaseOwnership(orgID, req.KnowledgeBaseIDs); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	before := captureAgentRevisionBase(uc.DB, uint(agentID))
 	err := uc.DB.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Where("agent_id = ?", agentID).Delete(&models.AgentKnowledgeBase{}).Error; err != nil {
 			return err
@@ -1254,12 +1263,13 @@ func (uc *UserController) UpdateAgentKnowledgeBases(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新智能体知识库关联失败"})
 		return
 	}
+	recordAgentRevision(uc.DB, c, &models.Agent{ID: uint(agentID), OrgID: orgID}, before, "更新知识库关联")
 	c.JSON(http.StatusOK, gin.H{"message": "更新成功", "data": gin.H{"knowledge_base_ids": uniqueUintSlice(req.KnowledgeBaseIDs)}})
 }
 
-func (uc *UserController) getOwnedKnowledgeBase(userID uint, kbID uint) (*models.KnowledgeBase, error) {
+func (uc *UserController) getOwnedKnowledgeBase(orgID uint, kbID uint) (*models.KnowledgeBase, error) {
 	var kb models.KnowledgeBase
-	if err := uc.DB.Where("id = ? AND user_id = ?", kbID, userID).First(&kb).Error; err != nil {
+	if err := uc.DB.Where("id = ? AND org_id = ?", kbID, orgID).First(&kb).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, fmt.Errorf("知识库不存在")
 		}
@@ -1268,24 +1278,24 @@ func (uc *UserController) getOwnedKnowledgeBase(userID uint, kbID uint) (*models
 	return &kb, nil
 }
 
-func (uc *UserController) assertAgentOwnership(userID uint, agentID uint) error {
+func (uc *UserController) assertAgentOwnership(orgID uint, agentID uint) error {
 	var count int64
-	if err := uc.DB.Model(&models.Agent{}).Where("id = ? AND user_id = ?", agentID, userID).Count(&count).Error; err != nil {
+	if err := uc.DB.Model(&models.Agent{}).Where("id = ? AND org_id = ?", agentID, orgID).Count(&count).Error; err != nil {
 		return err
 	}
 	if count == 0 {
-		return fmt.Errorf("智能体不存在或不属于当前用户")
+		return fmt.Errorf("智能体不存在或不属于当前组织")
 	}
 	return nil
 }
 
-func (uc *UserController) validateKnowledgeBaseOwnership(userID uint, knowledgeBaseIDs []uint) error {
+func (uc *UserController) validateKnowledgeBaseOwnership(orgID uint, knowledgeBaseIDs []uint) error {
 	if len(knowledgeBaseIDs) == 0 {
 		return nil
 	}
 	uniqueIDs := uniqueUintSlice(knowledgeBaseIDs)
 	var count int64
-	if err := uc.DB.Model(&models.KnowledgeBase{}).Where("user_id = ? AND id IN ?", userID, uniqueIDs).Count(&count).Error; err != nil {
+	if err := uc.DB.Model(&models.KnowledgeBase{}).Where("org_id = ? AND id IN ?", orgID, uniqueIDs).Count(&count).Error; err != nil {
 		return err
 	}
 	if count != int64(len(uniqueIDs)) {
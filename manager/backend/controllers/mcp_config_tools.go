@@ -2,19 +2,31 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"os/exec"
 	"strings"
 	"time"
 
+	"xiaozhi-esp32-server-golang/pkg/mcpstdio"
 	"xiaozhi/manager/backend/models"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mark3labs/mcp-go/client/transport"
 )
 
+const mcpTransportStdio = "stdio"
+
 type discoverMCPConfigToolsRequest struct {
 	Transport string            `json:"transport" binding:"required"`
-	URL       string            `json:"url" binding:"required"`
+	URL       string            `json:"url"`
 	Headers   map[string]string `json:"headers"`
+	// stdio 类型
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	Env     map[string]string `json:"env"`
+	WorkDir string            `json:"work_dir"`
+	Limits  mcpstdio.Limits   `json:"limits"`
 }
 
 func (ac *AdminController) DiscoverMCPConfigTools(c *gin.Context) {
@@ -24,16 +36,23 @@ func (ac *AdminController) DiscoverMCPConfigTools(c *gin.Context) {
 		return
 	}
 
-	service := models.MCPMarketService{
-		Transport:   strings.TrimSpace(req.Transport),
-		URL:         strings.TrimSpace(req.URL),
-		HeadersJSON: encodeHeadersJSON(req.Headers),
-	}
-
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 20*time.Second)
 	defer cancel()
 
-	tools, err := listImportedServiceTools(ctx, service)
+	var (
+		tools []mcpMarketImportedToolView
+		err   error
+	)
+	if strings.EqualFold(strings.TrimSpace(req.Transport), mcpTransportStdio) {
+		tools, err = listStdioTools(ctx, req)
+	} else {
+		service := models.MCPMarketService{
+			Transport:   strings.TrimSpace(req.Transport),
+			URL:         strings.TrimSpace(req.URL),
+			HeadersJSON: encodeHeadersJSON(req.Headers),
+		}
+		tools, err = listImportedServiceTools(ctx, service)
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -43,3 +62,29 @@ func (ac *AdminController) DiscoverMCPConfigTools(c *gin.Context) {
 		"tools": tools,
 	}})
 }
+
+// listStdioTools 在管理后台本机临时拉起 stdio MCP 服务器并列出工具，进程随 ctx 超时结束。
+// 环境变量与资源限制和主程序启动该服务器时一致
+func listStdioTools(ctx context.Context, req discoverMCPConfigToolsRequest) ([]mcpMarketImportedToolView, error) {
+	command := strings.TrimSpace(req.Command)
+	if command == "" {
+		return nil, fmt.Errorf("command 不能为空")
+	}
+	workDir := strings.TrimSpace(req.WorkDir)
+
+	// 探测进程无法在启动后补设限制，包装失败时不运行不受限的第三方命令
+	command, args, limited := mcpstdio.WrapLimits(command, req.Args, req.Limits)
+	if !limited && !req.Limits.IsZero() {
+		return nil, fmt.Errorf("当前环境无法为 stdio 进程设置资源限制")
+	}
+
+	stdioTransport := transport.NewStdioWithOptions(command, mcpstdio.Env(req.Env), args,
+		transport.WithCommandFunc(func(ctx context.Context, command string, env []string, args []string) (*exec.Cmd, error) {
+			cmd := exec.CommandContext(ctx, command, args...)
+			cmd.Env = env
+			cmd.Dir = workDir
+			return cmd, nil
+		}),
+	)
+	return listTransportTools(ctx, stdioTransport)
+}
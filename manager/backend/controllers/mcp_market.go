@@ -772,6 +772,18 @@ type mcpServerConfig struct {
 	AuthRef      string            `json:"auth_ref,omitempty"`
 	Headers      map[string]string `json:"headers,omitempty"`
 	AllowedTools []string          `json:"allowed_tools,omitempty"`
+	// stdio 类型：由主程序以子进程方式启动
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	WorkDir string            `json:"work_dir,omitempty"`
+	Limits  *mcpStdioLimits   `json:"limits,omitempty"`
+}
+
+type mcpStdioLimits struct {
+	MaxMemoryMB   int `json:"max_memory_mb,omitempty"`
+	MaxCPUSeconds int `json:"max_cpu_seconds,omitempty"`
+	MaxOpenFiles  int `json:"max_open_files,omitempty"`
 }
 
 func buildStoredMarketConfig(req upsertMCPMarketRequest, existing *mcpmarket.MarketConnection) (mcpmarket.MarketConnection, error) {
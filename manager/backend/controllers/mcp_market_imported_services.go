@@ -614,7 +614,11 @@ func listImportedServiceTools(ctx context.Context, service models.MCPMarketServi
 	if err != nil {
 		return nil, err
 	}
+	return listTransportTools(ctx, transportInstance)
+}
 
+// listTransportTools 通过给定传输初始化MCP客户端并列出工具，结束后关闭连接
+func listTransportTools(ctx context.Context, transportInstance transport.Interface) ([]mcpMarketImportedToolView, error) {
 	mcpClient := client.NewClient(transportInstance)
 	defer mcpClient.Close()
 
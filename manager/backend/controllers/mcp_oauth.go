@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"xiaozhi/manager/backend/services/audit"
+	mcpmarket "xiaozhi/manager/backend/services/mcp_market"
+	mcpoauth "xiaozhi/manager/backend/services/mcp_oauth"
+
+	"github.com/gin-gonic/gin"
+)
+
+type beginMCPOAuthRequest struct {
+	ServerName   string   `json:"server_name" binding:"required"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+}
+
+type mcpOAuthStatusView struct {
+	ServerName      string     `json:"server_name"`
+	ServerURL       string     `json:"server_url"`
+	Status          string     `json:"status"`
+	Issuer          string     `json:"issuer"`
+	ClientID        string     `json:"client_id"`
+	Scopes          string     `json:"scopes"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+	LastRefreshedAt *time.Time `json:"last_refreshed_at"`
+	LastError       string     `json:"last_error"`
+}
+
+func mcpOAuthService(c *gin.Context) *mcpoauth.Service {
+	svc := mcpoauth.Default()
+	if svc == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "MCP OAuth 服务未初始化"})
+	}
+	return svc
+}
+
+// GetMCPOAuthStatuses 全局MCP服务器的 OAuth 授权状态
+func (ac *AdminController) GetMCPOAuthStatuses(c *gin.Context) {
+	svc := mcpOAuthService(c)
+	if svc == nil {
+		return
+	}
+	rows, err := svc.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询授权状态失败"})
+		return
+	}
+	views := make([]mcpOAuthStatusView, 0, len(rows))
+	for _, row := range rows {
+		views = append(views, mcpOAuthStatusView{
+			ServerName:      row.ServerName,
+			ServerURL:       row.ServerURL,
+			Status:          row.Status,
+			Issuer:          row.Issuer,
+			ClientID:        mcpmarket.MaskToken(row.ClientID),
+			Scopes:          row.Scopes,
+			ExpiresAt:       row.ExpiresAt,
+			LastRefreshedAt: row.LastRefreshedAt,
+			LastError:       row.LastError,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": views})
+}
+
+// BeginMCPOAuth 为已保存的全局MCP服务器发起 OAuth 授权，返回授权页地址（前端在新窗口打开）
+func (ac *AdminController) BeginMCPOAuth(c *gin.Context) {
+	svc := mcpOAuthService(c)
+	if svc == nil {
+		return
+	}
+	var req beginMCPOAuthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 地址以已保存的配置为准，避免向任意地址发起发现请求
+	merged, _, err := ac.loadCurrentMCPConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取MCP配置失败"})
+		return
+	}
+	servers, err := decodeMCPServers(asMap(merged.MCP["global"])["servers"])
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析MCP配置失败"})
+		return
+	}
+	name := strings.TrimSpace(req.ServerName)
+	var endpoint string
+	for _, server := range servers {
+		if strings.TrimSpace(server.Name) != name {
+			continue
+		}
+		endpoint = strings.TrimSpace(server.Url)
+		if strings.EqualFold(strings.TrimSpace(server.Type), mcpmarket.TransportSSE) && strings.TrimSpace(server.SSEUrl) != "" {
+			endpoint = strings.TrimSpace(server.SSEUrl)
+		}
+		break
+	}
+	if endpoint == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未找到该服务器或服务器未配置URL，请先保存配置"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 20*time.Second)
+	defer cancel()
+	authURL, err := svc.Begin(ctx, mcpoauth.BeginRequest{
+		ServerName:   name,
+		ServerURL:    endpoint,
+		RedirectURI:  externalBaseURL(c, svc.PublicURL()) + "/api/mcp-oauth/callback",
+		Scopes:       req.Scopes,
+		ClientID:     req.ClientID,
+		ClientSecret: req.ClientSecret,
+	})
+	if err != nil {
+		log.Printf("[MCP OAuth] 发起授权失败: server=%s err=%v", name, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"authorization_url": authURL}})
+}
+
+// MCPOAuthCallback 授权服务器回调（浏览器跳转，无登录态），完成后跳回 MCP 配置页
+func (ac *AdminController) MCPOAuthCallback(c *gin.Context) {
+	svc := mcpoauth.Default()
+	if svc == nil {
+		redirectMCPOAuthResult(c, "", "MCP OAuth 服务未初始化")
+		return
+	}
+	if errMsg := c.Query("error"); errMsg != "" {
+		// 用户拒绝授权时也要消费掉 state
+		name, _ := svc.Finish(c.Request.Context(), c.Query("state"), "")
+		redirectMCPOAuthResult(c, name, "授权服务器拒绝授权: "+errMsg)
+		return
+	}
+	name, err := svc.Finish(c.Request.Context(), c.Query("state"), c.Query("code"))
+	if err != nil {
+		log.Printf("[MCP OAuth] 授权回调失败: server=%s err=%v", name, err)
+		redirectMCPOAuthResult(c, name, err.Error())
+		return
+	}
+	audit.Record(ac.DB, audit.Entry{
+		ActorRole:    audit.ActorRoleSystem,
+		Action:       audit.ActionUpdate,
+		ResourceType: "mcp_oauth",
+		ResourceID:   name,
+		Method:       c.Request.Method,
+		Path:         c.Request.URL.Path,
+		StatusCode:   http.StatusOK,
+		After:        map[string]interface{}{"status": mcpoauth.StatusAuthorized},
+		IP:           c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+	})
+	redirectMCPOAuthResult(c, name, "")
+}
+
+func redirectMCPOAuthResult(c *gin.Context, serverName, errMsg string) {
+	q := url.Values{"mcp_oauth": {"success"}}
+	if serverName != "" {
+		q.Set("server", serverName)
+	}
+	if errMsg != "" {
+		q.Set("mcp_oauth", "error")
+		q.Set("message", errMsg)
+	}
+	c.Redirect(http.StatusFound, "/admin/mcp-config?"+q.Encode())
+}
+
+// RevokeMCPOAuth 删除服务器的授权信息
+func (ac *AdminController) RevokeMCPOAuth(c *gin.Context) {
+	svc := mcpOAuthService(c)
+	if svc == nil {
+		return
+	}
+	if err := svc.Revoke(c.Param("server_name")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除授权失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已删除授权"})
+}
+
+// GetMCPOAuthTokenInternal 主程序获取 auth_ref=oauth 服务器的访问令牌（内部服务接口），即将到期时先刷新
+func (ac *AdminController) GetMCPOAuthTokenInternal(c *gin.Context) {
+	svc := mcpOAuthService(c)
+	if svc == nil {
+		return
+	}
+	name := strings.TrimSpace(c.Query("server"))
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 server 参数"})
+		return
+	}
+	token, err := svc.AccessToken(c.Request.Context(), name)
+	switch {
+	case errors.Is(err, mcpoauth.ErrNotAuthorized):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, mcpoauth.ErrReauthRequired):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"data": token})
+	}
+}
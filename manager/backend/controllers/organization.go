@@ -0,0 +1,496 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"xiaozhi/manager/backend/middleware"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const defaultInvitationTTL = 7 * 24 * time.Hour
+
+type OrganizationController struct {
+	DB *gorm.DB
+}
+
+// OrganizationInfo 组织信息及当前用户在其中的角色
+type OrganizationInfo struct {
+	models.Organization
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions,omitempty"`
+	MemberCount int64    `json:"member_count"`
+}
+
+type OrganizationMemberInfo struct {
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// currentOrgID 返回 OrgContext 解析出的当前组织ID
+func currentOrgID(c *gin.Context) uint {
+	v, _ := c.Get("org_id")
+	id, _ := v.(uint)
+	return id
+}
+
+func currentUserID(c *gin.Context) uint {
+	v, _ := c.Get("user_id")
+	id, _ := v.(uint)
+	return id
+}
+
+// ListMyOrganizations 获取当前用户所属的组织列表（个人组织排在最前）
+func (oc *OrganizationController) ListMyOrganizations(c *gin.Context) {
+	userID := currentUserID(c)
+	if _, err := models.PersonalOrganizationID(oc.DB, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取个人组织失败"})
+		return
+	}
+
+	var members []models.OrganizationMember
+	if err := oc.DB.Where("user_id = ?", userID).Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取组织列表失败"})
+		return
+	}
+	roleByOrg := make(map[uint]string, len(members))
+	orgIDs := make([]uint, 0, len(members))
+	for _, m := range members {
+		roleByOrg[m.OrgID] = m.Role
+		orgIDs = append(orgIDs, m.OrgID)
+	}
+
+	var orgs []models.Organization
+	if len(orgIDs) > 0 {
+		if err := oc.DB.Where("id IN ?", orgIDs).Order("personal DESC, id ASC").Find(&orgs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取组织列表失败"})
+			return
+		}
+	}
+
+	result := make([]OrganizationInfo, 0, len(orgs))
+	for _, org := range orgs {
+		result = append(result, oc.toInfo(org, roleByOrg[org.ID]))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// CreateOrganization 创建团队组织，创建者成为所有者
+func (oc *OrganizationController) CreateOrganization(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required,min=2,max=100"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	userID := currentUserID(c)
+	org := models.Organization{Name: strings.TrimSpace(req.Name), OwnerID: userID}
+	err := oc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OrganizationMember{OrgID: org.ID, UserID: userID, Role: models.OrgRoleOwner}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建组织失败"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": oc.toInfo(org, models.OrgRoleOwner)})
+}
+
+// GetOrganization 获取当前组织信息及当前用户的角色和权限
+func (oc *OrganizationController) GetOrganization(c *gin.Context) {
+	org, ok := oc.loadCurrentOrg(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": oc.toInfo(*org, c.GetString("org_role"))})
+}
+
+// UpdateOrganization 修改组织名称
+func (oc *OrganizationController) UpdateOrganization(c *gin.Context) {
+	org, ok := oc.loadCurrentOrg(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name string `json:"name" binding:"required,min=2,max=100"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	org.Name = strings.TrimSpace(req.Name)
+	if err := oc.DB.Save(org).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新组织失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": oc.toInfo(*org, c.GetString("org_role"))})
+}
+
+// DeleteOrganization 删除团队组织，组织下仍有智能体、设备、知识库或声纹组时拒绝删除
+func (oc *OrganizationController) DeleteOrganization(c *gin.Context) {
+	org, ok := oc.loadCurrentOrg(c)
+	if !ok {
+		return
+	}
+	if org.Personal {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "个人组织不能删除"})
+		return
+	}
+	for _, model := range []interface{}{&models.Agent{}, &models.Device{}, &models.KnowledgeBase{}, &models.SpeakerGroup{}} {
+		var count int64
+		if err := oc.DB.Model(model).Where("org_id = ?", org.ID).Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "检查组织资源失败"})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "组织下仍有智能体、设备、知识库或声纹组，请先迁移或删除"})
+			return
+		}
+	}
+
+	err := oc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("org_id = ?", org.ID).Delete(&models.OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("org_id = ?", org.ID).Delete(&models.OrganizationInvitation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.APIToken{}).Where("org_id = ?", org.ID).Update("is_active", false).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("org_id = ?", org.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("org_id = ?", org.ID).Delete(&models.Webhook{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(org).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除组织失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "组织已删除"})
+}
+
+// ListMembers 获取组织成员列表
+func (oc *OrganizationController) ListMembers(c *gin.Context) {
+	var members []OrganizationMemberInfo
+	err := oc.DB.Table("organization_members AS m").
+		Select("m.user_id, u.username, u.email, m.role, m.created_at").
+		Joins("JOIN users u ON u.id = m.user_id").
+		Where("m.org_id = ?", currentOrgID(c)).
+		Order("m.id ASC").
+		Scan(&members).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取成员列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": members})
+}
+
+// UpdateMemberRole 修改成员角色，组织至少保留一个所有者
+func (oc *OrganizationController) UpdateMemberRole(c *gin.Context) {
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if !models.ValidOrgRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的成员角色"})
+		return
+	}
+
+	member, ok := oc.loadMember(c)
+	if !ok {
+		return
+	}
+	if member.Role == models.OrgRoleOwner && req.Role != models.OrgRoleOwner {
+		if !oc.hasOtherOwner(c, member) {
+			return
+		}
+	}
+	if err := oc.DB.Model(member).Update("role", req.Role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改成员角色失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "成员角色已更新"})
+}
+
+// RemoveMember 移除成员
+func (oc *OrganizationController) RemoveMember(c *gin.Context) {
+	member, ok := oc.loadMember(c)
+	if !ok {
+		return
+	}
+	oc.removeMember(c, member)
+}
+
+// LeaveOrganization 当前用户退出组织
+func (oc *OrganizationController) LeaveOrganization(c *gin.Context) {
+	var member models.OrganizationMember
+	if err := oc.DB.Where("org_id = ? AND user_id = ?", currentOrgID(c), currentUserID(c)).First(&member).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不是该组织成员"})
+		return
+	}
+	oc.removeMember(c, &member)
+}
+
+func (oc *OrganizationController) removeMember(c *gin.Context, member *models.OrganizationMember) {
+	org, ok := oc.loadCurrentOrg(c)
+	if !ok {
+		return
+	}
+	if org.Personal && member.UserID == org.OwnerID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能移除个人组织的所有者"})
+		return
+	}
+	if member.Role == models.OrgRoleOwner && !oc.hasOtherOwner(c, member) {
+		return
+	}
+	err := oc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(member).Error; err != nil {
+			return err
+		}
+		// 成员在该组织下创建的 API Token 一并失效
+		return tx.Model(&models.APIToken{}).
+			Where("org_id = ? AND user_id = ?", member.OrgID, member.UserID).
+			Update("is_active", false).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "移除成员失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "成员已移除"})
+}
+
+// CreateInvitation 邀请成员加入组织（明文邀请码仅返回一次）
+func (oc *OrganizationController) CreateInvitation(c *gin.Context) {
+	org, ok := oc.loadCurrentOrg(c)
+	if !ok {
+		return
+	}
+	if org.Personal {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "个人组织不能邀请成员，请先创建团队组织"})
+		return
+	}
+
+	var req struct {
+		Email        string `json:"email"`
+		Role         string `json:"role" binding:"required"`
+		ExpiresInDay int    `json:"expires_in_days"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if !models.ValidOrgRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的成员角色"})
+		return
+	}
+
+	rawToken, prefix, hash, err := generateInvitationToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成邀请码失败"})
+		return
+	}
+	ttl := defaultInvitationTTL
+	if req.ExpiresInDay > 0 {
+		ttl = time.Duration(req.ExpiresInDay) * 24 * time.Hour
+	}
+	invitation := models.OrganizationInvitation{
+		OrgID:       org.ID,
+		Email:       strings.ToLower(strings.TrimSpace(req.Email)),
+		Role:        req.Role,
+		TokenPrefix: prefix,
+		TokenHash:   hash,
+		Status:      "pending",
+		InvitedBy:   currentUserID(c),
+		ExpiresAt:   time.Now().Add(ttl),
+	}
+	if err := oc.DB.Create(&invitation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建邀请失败"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "邀请已创建，请将邀请码发送给被邀请人，后续无法再次查看",
+		"data": gin.H{
+			"token":      rawToken,
+			"invitation": invitation,
+		},
+	})
+}
+
+// ListInvitations 获取组织的邀请列表
+func (oc *OrganizationController) ListInvitations(c *gin.Context) {
+	var invitations []models.OrganizationInvitation
+	if err := oc.DB.Where("org_id = ?", currentOrgID(c)).Order("id DESC").Find(&invitations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取邀请列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": invitations})
+}
+
+// RevokeInvitation 撤销尚未接受的邀请
+func (oc *OrganizationController) RevokeInvitation(c *gin.Context) {
+	res := oc.DB.Model(&models.OrganizationInvitation{}).
+		Where("id = ? AND org_id = ? AND status = ?", c.Param("invitation_id"), currentOrgID(c), "pending").
+		Update("status", "revoked")
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "撤销邀请失败"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "邀请不存在或已处理"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "邀请已撤销"})
+}
+
+// AcceptInvitation 当前用户凭邀请码加入组织
+func (oc *OrganizationController) AcceptInvitation(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := oc.DB.First(&user, currentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	sum := sha256.Sum256([]byte(strings.TrimSpace(req.Token)))
+	var invitation models.OrganizationInvitation
+	if err := oc.DB.Where("token_hash = ? AND status = ?", hex.EncodeToString(sum[:]), "pending").First(&invitation).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "邀请不存在或已失效"})
+		return
+	}
+	if time.Now().After(invitation.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "邀请已过期"})
+		return
+	}
+	if invitation.Email != "" && !strings.EqualFold(invitation.Email, strings.TrimSpace(user.Email)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "该邀请不属于当前用户"})
+		return
+	}
+
+	var count int64
+	oc.DB.Model(&models.OrganizationMember{}).Where("org_id = ? AND user_id = ?", invitation.OrgID, user.ID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "已经是该组织成员"})
+		return
+	}
+
+	now := time.Now()
+	err := oc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&models.OrganizationMember{OrgID: invitation.OrgID, UserID: user.ID, Role: invitation.Role}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&invitation).Updates(map[string]interface{}{
+			"status":      "accepted",
+			"accepted_by": user.ID,
+			"accepted_at": now,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "加入组织失败"})
+		return
+	}
+
+	var org models.Organization
+	oc.DB.First(&org, invitation.OrgID)
+	c.JSON(http.StatusOK, gin.H{"message": "已加入组织", "data": oc.toInfo(org, invitation.Role)})
+}
+
+// GetOrganizationsAdmin 管理员查看全部组织
+func (oc *OrganizationController) GetOrganizationsAdmin(c *gin.Context) {
+	var orgs []models.Organization
+	if err := oc.DB.Order("id ASC").Find(&orgs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取组织列表失败"})
+		return
+	}
+	result := make([]OrganizationInfo, 0, len(orgs))
+	for _, org := range orgs {
+		info := oc.toInfo(org, "")
+		info.Permissions = nil
+		result = append(result, info)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+func (oc *OrganizationController) toInfo(org models.Organization, role string) OrganizationInfo {
+	info := OrganizationInfo{Organization: org, Role: role, Permissions: middleware.RolePermissions(role)}
+	oc.DB.Model(&models.OrganizationMember{}).Where("org_id = ?", org.ID).Count(&info.MemberCount)
+	return info
+}
+
+func (oc *OrganizationController) loadCurrentOrg(c *gin.Context) (*models.Organization, bool) {
+	var org models.Organization
+	if err := oc.DB.First(&org, currentOrgID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "组织不存在"})
+		return nil, false
+	}
+	return &org, true
+}
+
+func (oc *OrganizationController) loadMember(c *gin.Context) (*models.OrganizationMember, bool) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return nil, false
+	}
+	var member models.OrganizationMember
+	if err := oc.DB.Where("org_id = ? AND user_id = ?", currentOrgID(c), userID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "成员不存在"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询成员失败"})
+		}
+		return nil, false
+	}
+	return &member, true
+}
+
+// hasOtherOwner 组织必须至少保留一个所有者
+func (oc *OrganizationController) hasOtherOwner(c *gin.Context, member *models.OrganizationMember) bool {
+	var owners int64
+	oc.DB.Model(&models.OrganizationMember{}).
+		Where("org_id = ? AND role = ? AND id != ?", member.OrgID, models.OrgRoleOwner, member.ID).
+		Count(&owners)
+	if owners == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "组织至少需要保留一个所有者"})
+		return false
+	}
+	return true
+}
+
+func generateInvitationToken() (string, string, string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+	raw := "xzinv_" + hex.EncodeToString(buf)
+	sum := sha256.Sum256([]byte(raw))
+	return raw, raw[:12], hex.EncodeToString(sum[:]), nil
+}
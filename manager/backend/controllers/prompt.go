@@ -0,0 +1,280 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"xiaozhi-esp32-server-golang/pkg/prompttpl"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PromptController 管理提示词共享片段、设备模板变量与模板预览
+type PromptController struct {
+	DB *gorm.DB
+}
+
+var snippetNamePattern = regexp.MustCompile(`^[\p{Han}A-Za-z0-9_\-]{1,64}$`)
+
+// devicePromptVarsRequest 设备的提示词模板变量，未传的字段保持不变
+type devicePromptVarsRequest struct {
+	DisplayName   *string `json:"display_name"`
+	OwnerNickname *string `json:"owner_nickname"`
+	Location      *string `json:"location"`
+	Timezone      *string `json:"timezone"`
+}
+
+func (r devicePromptVarsRequest) apply(device *models.Device) error {
+	if r.Timezone != nil {
+		tz := strings.TrimSpace(*r.Timezone)
+		if tz != "" {
+			if _, err := time.LoadLocation(tz); err != nil {
+				return errors.New("时区无效，请使用 IANA 时区名称，如 Asia/Shanghai")
+			}
+		}
+		device.Timezone = tz
+	}
+	if r.DisplayName != nil {
+		device.DisplayName = truncateRunes(strings.TrimSpace(*r.DisplayName), 100)
+	}
+	if r.OwnerNickname != nil {
+		device.OwnerNickname = truncateRunes(strings.TrimSpace(*r.OwnerNickname), 50)
+	}
+	if r.Location != nil {
+		device.Location = truncateRunes(strings.TrimSpace(*r.Location), 100)
+	}
+	return nil
+}
+
+// promptVarsResponse 随设备配置下发的模板变量
+type promptVarsResponse struct {
+	DeviceName    string `json:"device_name"`
+	OwnerNickname string `json:"owner_nickname"`
+	Location      string `json:"location"`
+	Timezone      string `json:"timezone"`
+}
+
+func buildPromptVars(device models.Device) promptVarsResponse {
+	name := device.DisplayName
+	if name == "" {
+		name = device.DeviceName
+	}
+	return promptVarsResponse{
+		DeviceName:    name,
+		OwnerNickname: device.OwnerNickname,
+		Location:      device.Location,
+		Timezone:      device.Timezone,
+	}
+}
+
+// loadPromptSnippets 读取组织内的共享片段，名称 -> 内容
+func loadPromptSnippets(db *gorm.DB, orgID uint) map[string]string {
+	snippets := map[string]string{}
+	if orgID == 0 {
+		return snippets
+	}
+	var rows []models.PromptSnippet
+	if err := db.Where("org_id = ?", orgID).Find(&rows).Error; err != nil {
+		log.Printf("读取组织 %d 提示词片段失败: %v", orgID, err)
+		return snippets
+	}
+	for _, row := range rows {
+		snippets[row.Name] = row.Content
+	}
+	return snippets
+}
+
+// ListPromptVariables 返回模板支持的变量，供编辑器提示
+func (pc *PromptController) ListPromptVariables(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": prompttpl.Variables})
+}
+
+// ListSnippets 获取当前组织的提示词片段
+func (pc *PromptController) ListSnippets(c *gin.Context) {
+	var snippets []models.PromptSnippet
+	if err := pc.DB.Where("org_id = ?", currentOrgID(c)).Order("name ASC").Find(&snippets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取提示词片段失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": snippets})
+}
+
+type snippetRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	Content     string `json:"content"`
+}
+
+// validateSnippet 校验名称与内容语法，内容中可引用组织内其它片段
+func (pc *PromptController) validateSnippet(orgID uint, req *snippetRequest, excludeID uint) error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Description = truncateRunes(strings.TrimSpace(req.Description), 200)
+	if !snippetNamePattern.MatchString(req.Name) {
+		return errors.New("片段名称仅支持 1-64 位中文、字母、数字、下划线和中划线")
+	}
+	var count int64
+	pc.DB.Model(&models.PromptSnippet{}).Where("org_id = ? AND name = ? AND id <> ?", orgID, req.Name, excludeID).Count(&count)
+	if count > 0 {
+		return errors.New("片段名称已存在")
+	}
+	snippets := loadPromptSnippets(pc.DB, orgID)
+	delete(snippets, req.Name)
+	if err := prompttpl.Validate(req.Content, snippets); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CreateSnippet 创建提示词片段
+func (pc *PromptController) CreateSnippet(c *gin.Context) {
+	var req snippetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	orgID := currentOrgID(c)
+	if err := pc.validateSnippet(orgID, &req, 0); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	snippet := models.PromptSnippet{
+		OrgID:       orgID,
+		UserID:      currentUserID(c),
+		Name:        req.Name,
+		Description: req.Description,
+		Content:     req.Content,
+	}
+	if err := pc.DB.Create(&snippet).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建提示词片段失败"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "提示词片段创建成功", "data": snippet})
+}
+
+// UpdateSnippet 更新提示词片段，设备下次获取配置时生效
+func (pc *PromptController) UpdateSnippet(c *gin.Context) {
+	orgID := currentOrgID(c)
+	var snippet models.PromptSnippet
+	if err := pc.DB.Where("id = ? AND org_id = ?", c.Param("id"), orgID).First(&snippet).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "提示词片段不存在"})
+		return
+	}
+	var req snippetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if err := pc.validateSnippet(orgID, &req, snippet.ID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	snippet.Name = req.Name
+	snippet.Description = req.Description
+	snippet.Content = req.Content
+	if err := pc.DB.Save(&snippet).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新提示词片段失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "提示词片段已更新", "data": snippet})
+}
+
+// DeleteSnippet 删除提示词片段；仍引用该片段的提示词渲染失败时会回退为原文
+func (pc *PromptController) DeleteSnippet(c *gin.Context) {
+	result := pc.DB.Where("id = ? AND org_id = ?", c.Param("id"), currentOrgID(c)).Delete(&models.PromptSnippet{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除提示词片段失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "提示词片段不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "提示词片段已删除"})
+}
+
+// UpdateDevicePromptVars 更新设备的提示词模板变量
+func (pc *PromptController) UpdateDevicePromptVars(c *gin.Context) {
+	var device models.Device
+	if err := pc.DB.Where("id = ? AND org_id = ?", c.Param("id"), currentOrgID(c)).First(&device).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "设备不存在或不属于当前组织"})
+		return
+	}
+	var req devicePromptVarsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if err := req.apply(&device); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err := pc.DB.Model(&device).Select("display_name", "owner_nickname", "location", "timezone").Updates(&device).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设备变量失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "设备变量已更新", "data": buildPromptVars(device)})
+}
+
+// PreviewPrompt 按指定设备渲染提示词模板。
+// template 为空时使用设备所属智能体的提示词；天气在预览中不调用工具，可通过 weather 传入示例值。
+func (pc *PromptController) PreviewPrompt(c *gin.Context) {
+	var req struct {
+		DeviceID    uint    `json:"device_id" binding:"required"`
+		AgentID     uint    `json:"agent_id"`
+		Template    *string `json:"template"`
+		SpeakerName string  `json:"speaker_name"`
+		Weather     string  `json:"weather"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	orgID := currentOrgID(c)
+	var device models.Device
+	if err := pc.DB.Where("id = ? AND org_id = ?", req.DeviceID, orgID).First(&device).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "设备不存在或不属于当前组织"})
+		return
+	}
+	agentID := req.AgentID
+	if agentID == 0 {
+		agentID = device.AgentID
+	}
+	var agent models.Agent
+	if agentID != 0 {
+		if err := pc.DB.Where("id = ? AND org_id = ?", agentID, orgID).First(&agent).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在或不属于当前组织"})
+			return
+		}
+	}
+	text := agent.CustomPrompt
+	if req.Template != nil {
+		text = *req.Template
+	}
+
+	vars := buildPromptVars(device)
+	weather := strings.TrimSpace(req.Weather)
+	if weather == "" {
+		weather = "[实时天气]"
+	}
+	rendered, err := prompttpl.Render(text, loadPromptSnippets(pc.DB, orgID), prompttpl.Vars{
+		AssistantName: agent.Name,
+		DeviceID:      device.DeviceName,
+		DeviceName:    vars.DeviceName,
+		OwnerNickname: vars.OwnerNickname,
+		Location:      vars.Location,
+		SpeakerName:   strings.TrimSpace(req.SpeakerName),
+		Now:           prompttpl.NowIn(vars.Timezone),
+		Weather:       func() string { return weather },
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"rendered": rendered, "vars": vars}})
+}
@@ -0,0 +1,425 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"xiaozhi/manager/backend/models"
+	"xiaozhi/manager/backend/services/revision"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RevisionController 智能体与角色的配置版本：列表、对比、回滚与发布
+type RevisionController struct {
+	DB *gorm.DB
+}
+
+func revisionAuthor(c *gin.Context) revision.Author {
+	return revision.Author{ID: currentUserID(c), Name: c.GetString("username")}
+}
+
+// captureAgentRevisionBase 在修改智能体前读取快照，用于为存量智能体补初始版本
+func captureAgentRevisionBase(db *gorm.DB, agentID uint) *revision.AgentSnapshot {
+	snap, err := revision.CaptureAgent(db, agentID)
+	if err != nil {
+		log.Printf("读取智能体 %d 版本快照失败: %v", agentID, err)
+		return nil
+	}
+	return snap
+}
+
+// recordAgentRevision 智能体写入后追加版本，失败只记录日志，不影响本次修改
+func recordAgentRevision(db *gorm.DB, c *gin.Context, agent *models.Agent, before *revision.AgentSnapshot, comment string) *models.Revision {
+	after, err := revision.CaptureAgent(db, agent.ID)
+	if err != nil {
+		log.Printf("读取智能体 %d 版本快照失败: %v", agent.ID, err)
+		return nil
+	}
+	entry := revision.Entry{
+		ResourceType: revision.ResourceAgent,
+		ResourceID:   agent.ID,
+		OrgID:        agent.OrgID,
+		Author:       revisionAuthor(c),
+		Comment:      strings.TrimSpace(comment),
+		After:        after,
+	}
+	if before != nil {
+		entry.Before = before
+	}
+	rev, err := revision.Record(db, entry)
+	if err != nil {
+		log.Printf("记录智能体 %d 配置版本失败: %v", agent.ID, err)
+		return nil
+	}
+	return rev
+}
+
+func captureRoleRevisionBase(db *gorm.DB, roleID uint) *revision.RoleSnapshot {
+	snap, err := revision.CaptureRole(db, roleID)
+	if err != nil {
+		log.Printf("读取角色 %d 版本快照失败: %v", roleID, err)
+		return nil
+	}
+	return snap
+}
+
+// recordRoleRevision 角色写入后追加版本，失败只记录日志
+func recordRoleRevision(db *gorm.DB, c *gin.Context, role *models.Role, before *revision.RoleSnapshot, comment string) *models.Revision {
+	after, err := revision.CaptureRole(db, role.ID)
+	if err != nil {
+		log.Printf("读取角色 %d 版本快照失败: %v", role.ID, err)
+		return nil
+	}
+	entry := revision.Entry{
+		ResourceType: revision.ResourceRole,
+		ResourceID:   role.ID,
+		OrgID:        role.OrgID,
+		Author:       revisionAuthor(c),
+		Comment:      strings.TrimSpace(comment),
+		After:        after,
+	}
+	if before != nil {
+		entry.Before = before
+	}
+	rev, err := revision.Record(db, entry)
+	if err != nil {
+		log.Printf("记录角色 %d 配置版本失败: %v", role.ID, err)
+		return nil
+	}
+	return rev
+}
+
+// publishedAgentSnapshot 读取智能体已发布版本的快照
+func publishedAgentSnapshot(db *gorm.DB, agent models.Agent) (*revision.AgentSnapshot, *models.Revision, error) {
+	rev, err := revision.Get(db, revision.ResourceAgent, agent.ID, *agent.PublishedRevisionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	snap, err := revision.DecodeAgent(rev)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snap, rev, nil
+}
+
+// findAgent 管理员接口不限组织，其余接口限定当前组织
+func (rc *RevisionController) findAgent(c *gin.Context) (*models.Agent, bool) {
+	query := rc.DB.Where("id = ?", c.Param("id"))
+	if !strings.HasPrefix(c.FullPath(), "/api/admin/") {
+		query = query.Where("org_id = ?", currentOrgID(c))
+	}
+	var agent models.Agent
+	if err := query.First(&agent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在"})
+		return nil, false
+	}
+	return &agent, true
+}
+
+// findRole 查看：管理员、角色所属组织或全局角色；修改（write=true）：管理员或角色所属组织
+func (rc *RevisionController) findRole(c *gin.Context, write bool) (*models.Role, bool) {
+	var role models.Role
+	if err := rc.DB.First(&role, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "角色不存在"})
+		return nil, false
+	}
+	if strings.Contains(c.FullPath(), "/admin/roles/global/") && role.RoleType != "global" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该接口仅允许操作全局角色"})
+		return nil, false
+	}
+	isAdmin := c.GetString("role") == "admin"
+	isOwner := roleInCurrentOrg(c, &role)
+	if !isAdmin && !isOwner && (write || role.RoleType != "global") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权操作此角色"})
+		return nil, false
+	}
+	return &role, true
+}
+
+// findRevision 读取路由中的 rev_id 对应版本
+func (rc *RevisionController) findRevision(c *gin.Context, resourceType string, resourceID uint) (*models.Revision, bool) {
+	revID, _ := strconv.ParseUint(c.Param("rev_id"), 10, 64)
+	rev, err := revision.Get(rc.DB, resourceType, resourceID, uint(revID))
+	if errors.Is(err, revision.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "版本不存在"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取版本失败"})
+		return nil, false
+	}
+	return rev, true
+}
+
+func (rc *RevisionController) listRevisions(c *gin.Context, resourceType string, resourceID uint, extra gin.H) {
+	revisions, err := revision.List(rc.DB, resourceType, resourceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取版本列表失败"})
+		return
+	}
+	resp := gin.H{"data": revisions}
+	for k, v := range extra {
+		resp[k] = v
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// revisionDetail 返回版本内容及与对比版本的差异：against 指定对比版本 ID，默认与上一版本对比
+func (rc *RevisionController) revisionDetail(c *gin.Context, resourceType string, resourceID uint) {
+	rev, ok := rc.findRevision(c, resourceType, resourceID)
+	if !ok {
+		return
+	}
+	var against *models.Revision
+	var err error
+	if v := c.Query("against"); v != "" {
+		againstID, _ := strconv.ParseUint(v, 10, 64)
+		against, err = revision.Get(rc.DB, resourceType, resourceID, uint(againstID))
+	} else {
+		against, err = revision.Previous(rc.DB, rev)
+		if errors.Is(err, revision.ErrNotFound) {
+			err = nil
+		}
+	}
+	if errors.Is(err, revision.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "对比版本不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取对比版本失败"})
+		return
+	}
+	changes, err := revision.Diff(against, rev)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"revision": rev, "against": against, "changes": changes}})
+}
+
+type revisionActionRequest struct {
+	Comment string `json:"comment"`
+}
+
+// ListAgentRevisions 获取智能体的版本列表
+func (rc *RevisionController) ListAgentRevisions(c *gin.Context) {
+	agent, ok := rc.findAgent(c)
+	if !ok {
+		return
+	}
+	rc.listRevisions(c, revision.ResourceAgent, agent.ID, gin.H{"published_revision_id": agent.PublishedRevisionID})
+}
+
+// GetAgentRevision 获取智能体的某个版本及差异
+func (rc *RevisionController) GetAgentRevision(c *gin.Context) {
+	agent, ok := rc.findAgent(c)
+	if !ok {
+		return
+	}
+	rc.revisionDetail(c, revision.ResourceAgent, agent.ID)
+}
+
+// RollbackAgent 将智能体恢复到指定版本，恢复结果作为一个新版本记录
+func (rc *RevisionController) RollbackAgent(c *gin.Context) {
+	agent, ok := rc.findAgent(c)
+	if !ok {
+		return
+	}
+	target, ok := rc.findRevision(c, revision.ResourceAgent, agent.ID)
+	if !ok {
+		return
+	}
+	var req revisionActionRequest
+	_ = c.ShouldBindJSON(&req)
+
+	snap, err := revision.DecodeAgent(target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析版本内容失败"})
+		return
+	}
+
+	// 版本中引用的 MCP 服务与知识库可能已被删除或停用，恢复时剔除并返回提示
+	warnings := make([]string, 0)
+	options, err := listEnabledGlobalMCPServiceNames(rc.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取 MCP 服务列表失败"})
+		return
+	}
+	allowed := buildMCPServiceNameSet(options)
+	kept := make([]string, 0)
+	for _, name := range splitMCPServiceNames(snap.MCPServiceNames) {
+		if _, ok := allowed[name]; ok {
+			kept = append(kept, name)
+		} else {
+			warnings = append(warnings, "MCP 服务已不可用: "+name)
+		}
+	}
+	snap.MCPServiceNames = strings.Join(kept, ",")
+
+	kbIDs := make([]uint, 0, len(snap.KnowledgeBaseIDs))
+	if len(snap.KnowledgeBaseIDs) > 0 {
+		if err := rc.DB.Model(&models.KnowledgeBase{}).Where("org_id = ? AND id IN ?", agent.OrgID, snap.KnowledgeBaseIDs).
+			Order("id ASC").Pluck("id", &kbIDs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "校验知识库失败"})
+			return
+		}
+		if len(kbIDs) != len(uniqueUintSlice(snap.KnowledgeBaseIDs)) {
+			warnings = append(warnings, "部分知识库已删除，未恢复关联")
+		}
+	}
+
+	before := captureAgentRevisionBase(rc.DB, agent.ID)
+	snap.ApplyToAgent(agent)
+	err = rc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(agent).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("agent_id = ?", agent.ID).Delete(&models.AgentKnowledgeBase{}).Error; err != nil {
+			return err
+		}
+		for _, kbID := range kbIDs {
+			if err := tx.Create(&models.AgentKnowledgeBase{AgentID: agent.ID, KnowledgeBaseID: kbID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "回滚智能体失败"})
+		return
+	}
+
+	comment := strings.TrimSpace(req.Comment)
+	if comment == "" {
+		comment = "回滚到版本 " + strconv.Itoa(target.Version)
+	}
+	after, err := revision.CaptureAgent(rc.DB, agent.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取智能体配置失败"})
+		return
+	}
+	entry := revision.Entry{
+		ResourceType: revision.ResourceAgent,
+		ResourceID:   agent.ID,
+		OrgID:        agent.OrgID,
+		Author:       revisionAuthor(c),
+		Comment:      comment,
+		RollbackFrom: &target.Version,
+		After:        after,
+	}
+	if before != nil {
+		entry.Before = before
+	}
+	rev, err := revision.Record(rc.DB, entry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "记录回滚版本失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"agent": agent, "revision": rev, "warnings": warnings}})
+}
+
+// PublishAgentRevision 将指定版本设为已发布：设备运行时使用该版本，当前配置作为草稿继续编辑测试
+func (rc *RevisionController) PublishAgentRevision(c *gin.Context) {
+	agent, ok := rc.findAgent(c)
+	if !ok {
+		return
+	}
+	rev, ok := rc.findRevision(c, revision.ResourceAgent, agent.ID)
+	if !ok {
+		return
+	}
+	if err := rc.DB.Model(agent).Update("published_revision_id", rev.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "发布版本失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已发布版本 " + strconv.Itoa(rev.Version), "data": rev})
+}
+
+// UnpublishAgent 取消发布，设备运行时恢复使用智能体当前配置
+func (rc *RevisionController) UnpublishAgent(c *gin.Context) {
+	agent, ok := rc.findAgent(c)
+	if !ok {
+		return
+	}
+	if err := rc.DB.Model(agent).Update("published_revision_id", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消发布失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已取消发布，设备将使用当前配置"})
+}
+
+// ListRoleRevisions 获取角色的版本列表
+func (rc *RevisionController) ListRoleRevisions(c *gin.Context) {
+	role, ok := rc.findRole(c, false)
+	if !ok {
+		return
+	}
+	rc.listRevisions(c, revision.ResourceRole, role.ID, nil)
+}
+
+// GetRoleRevision 获取角色的某个版本及差异
+func (rc *RevisionController) GetRoleRevision(c *gin.Context) {
+	role, ok := rc.findRole(c, false)
+	if !ok {
+		return
+	}
+	rc.revisionDetail(c, revision.ResourceRole, role.ID)
+}
+
+// RollbackRole 将角色恢复到指定版本
+func (rc *RevisionController) RollbackRole(c *gin.Context) {
+	role, ok := rc.findRole(c, true)
+	if !ok {
+		return
+	}
+	target, ok := rc.findRevision(c, revision.ResourceRole, role.ID)
+	if !ok {
+		return
+	}
+	var req revisionActionRequest
+	_ = c.ShouldBindJSON(&req)
+
+	snap, err := revision.DecodeRole(target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析版本内容失败"})
+		return
+	}
+	before := captureRoleRevisionBase(rc.DB, role.ID)
+	snap.ApplyToRole(role)
+	if err := rc.DB.Save(role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "回滚角色失败"})
+		return
+	}
+
+	comment := strings.TrimSpace(req.Comment)
+	if comment == "" {
+		comment = "回滚到版本 " + strconv.Itoa(target.Version)
+	}
+	after, err := revision.CaptureRole(rc.DB, role.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取角色配置失败"})
+		return
+	}
+	entry := revision.Entry{
+		ResourceType: revision.ResourceRole,
+		ResourceID:   role.ID,
+		OrgID:        role.OrgID,
+		Author:       revisionAuthor(c),
+		Comment:      comment,
+		RollbackFrom: &target.Version,
+		After:        after,
+	}
+	if before != nil {
+		entry.Before = before
+	}
+	rev, err := revision.Record(rc.DB, entry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "记录回滚版本失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"role": role, "revision": rev}})
+}
@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"fmt"
 	"log"
 	"net/http"
+	"xiaozhi/manager/backend/config"
+	"xiaozhi/manager/backend/database"
 	"xiaozhi/manager/backend/models"
 
 	"github.com/gin-gonic/gin"
@@ -11,13 +14,71 @@ import (
 )
 
 type SetupController struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Config *config.Config
 }
 
 type SetupRequest struct {
 	AdminUsername string `json:"admin_username" binding:"required,min=3,max=50"`
 	AdminPassword string `json:"admin_password" binding:"required,min=6,max=100"`
 	AdminEmail    string `json:"admin_email" binding:"required,email"`
+	// Database 可选：在向导中选择的数据库（mysql/sqlite/postgres），为空时使用当前配置的数据库
+	Database *config.DatabaseConfig `json:"database"`
+}
+
+// initialized 当前数据库中已存在管理员，说明系统已初始化，安装向导的写操作一律拒绝
+func (sc *SetupController) initialized() bool {
+	if sc.DB == nil || !sc.DB.Migrator().HasTable(&models.User{}) {
+		return false
+	}
+	var count int64
+	sc.DB.Model(&models.User{}).Where("role = ?", "admin").Count(&count)
+	return count > 0
+}
+
+// currentStorageType 当前生效的数据库类型
+func (sc *SetupController) currentStorageType() string {
+	if sc.Config == nil {
+		return ""
+	}
+	return sc.Config.Database.GetStorageType()
+}
+
+// openSetupDatabase 连接向导中选择的数据库并检查可用性
+func openSetupDatabase(dbConfig config.DatabaseConfig) (*gorm.DB, error) {
+	db, err := database.Open(dbConfig)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	if err := sqlDB.Ping(); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// TestDatabase 测试向导中填写的数据库连接
+func (sc *SetupController) TestDatabase(c *gin.Context) {
+	if sc.initialized() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "系统已初始化，无法修改数据库配置"})
+		return
+	}
+	var req config.DatabaseConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	db, err := openSetupDatabase(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "数据库连接失败: " + err.Error()})
+		return
+	}
+	database.Close(db)
+	c.JSON(http.StatusOK, gin.H{"message": "数据库连接成功", "type": req.GetStorageType()})
 }
 
 // 检查数据库是否需要初始化
@@ -57,6 +118,15 @@ func (sc *SetupController) CheckSetupStatus(c *gin.Context) {
 	})
 }
 
+// GetDatabaseOptions 返回当前数据库类型与可选类型，供向导展示
+func (sc *SetupController) GetDatabaseOptions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"current":   sc.currentStorageType(),
+		"available": database.SupportedTypes,
+		"editable":  !sc.initialized() && sc.Config != nil && sc.Config.Path != "",
+	})
+}
+
 // 初始化数据库
 func (sc *SetupController) InitializeDatabase(c *gin.Context) {
 	var req SetupRequest
@@ -65,13 +135,34 @@ func (sc *SetupController) InitializeDatabase(c *gin.Context) {
 		return
 	}
 
-	if sc.DB == nil {
+	db := sc.DB
+	restartRequired := false
+	if req.Database != nil {
+		if sc.initialized() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "系统已初始化，无法修改数据库配置"})
+			return
+		}
+		if sc.Config == nil || sc.Config.Path == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "未找到配置文件，无法保存数据库选择"})
+			return
+		}
+		selected, err := openSetupDatabase(*req.Database)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "数据库连接失败: " + err.Error()})
+			return
+		}
+		defer database.Close(selected)
+		db = selected
+		restartRequired = true
+	}
+
+	if db == nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库连接不可用"})
 		return
 	}
 
 	// 开始事务
-	tx := sc.DB.Begin()
+	tx := db.Begin()
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "启动数据库事务失败"})
 		return
@@ -85,17 +176,7 @@ func (sc *SetupController) InitializeDatabase(c *gin.Context) {
 
 	// 1. 自动迁移表结构
 	log.Println("开始自动迁移数据库表结构...")
-	err := tx.AutoMigrate(
-		&models.User{},
-		&models.Device{},
-		&models.Agent{},
-		&models.Config{},
-		&models.MCPMarketService{},
-		&models.GlobalRole{},
-		&models.SpeakerGroup{},
-		&models.SpeakerSample{},
-		&models.ChatMessage{},
-	)
+	err := tx.AutoMigrate(database.Models()...)
 	if err != nil {
 		tx.Rollback()
 		log.Printf("数据库表结构迁移失败: %v", err)
@@ -185,9 +266,20 @@ func (sc *SetupController) InitializeDatabase(c *gin.Context) {
 		return
 	}
 
+	// 8. 保存数据库选择，重启后生效
+	if req.Database != nil {
+		if err := config.SaveDatabaseConfig(sc.Config.Path, *req.Database); err != nil {
+			log.Printf("保存数据库配置失败: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("数据库已初始化，但保存配置失败: %v", err)})
+			return
+		}
+		log.Printf("已保存数据库配置，类型: %s", req.Database.GetStorageType())
+	}
+
 	log.Printf("数据库初始化成功，管理员用户: %s", req.AdminUsername)
 	c.JSON(http.StatusOK, gin.H{
-		"message": "数据库初始化成功",
+		"message":          "数据库初始化成功",
+		"restart_required": restartRequired,
 		"admin": gin.H{
 			"username": admin.Username,
 			"email":    admin.Email,
@@ -61,6 +61,7 @@ func (sgc *SpeakerGroupController) CreateSpeakerGroup(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "认证信息缺失"})
 		return
 	}
+	orgID := currentOrgID(c)
 
 	var req struct {
 		AgentID     uint    `json:"agent_id" binding:"required"`
@@ -76,9 +77,9 @@ func (sgc *SpeakerGroupController) CreateSpeakerGroup(c *gin.Context) {
 		return
 	}
 
-	// 验证智能体是否存在且属于当前用户
+	// 验证智能体是否存在且属于当前组织
 	var agent models.Agent
-	if err := sgc.DB.Where("id = ? AND user_id = ?", req.AgentID, userID).First(&agent).Error; err != nil {
+	if err := sgc.DB.Where("id = ? AND org_id = ?", req.AgentID, orgID).First(&agent).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "智能体不存在或无权限访问"})
 			return
@@ -89,7 +90,7 @@ func (sgc *SpeakerGroupController) CreateSpeakerGroup(c *gin.Context) {
 
 	// 检查同一用户下是否已存在相同名称的声纹组
 	var existingGroup models.SpeakerGroup
-	if err := sgc.DB.Where("user_id = ? AND name = ?", userID, req.Name).First(&existingGroup).Error; err == nil {
+	if err := sgc.DB.Where("(org_id = ? OR user_id = ?) AND name = ?", orgID, userID, req.Name).First(&existingGroup).Error; err == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "该声纹组名称已存在，请使用其他名称"})
 		return
 	} else if err != gorm.ErrRecordNotFound {
@@ -100,6 +101,7 @@ func (sgc *SpeakerGroupController) CreateSpeakerGroup(c *gin.Context) {
 	// 创建声纹组
 	speakerGroup := models.SpeakerGroup{
 		UserID:      userID.(uint),
+		OrgID:       orgID,
 		AgentID:     req.AgentID,
 		Name:        req.Name,
 		Prompt:      req.Prompt,
@@ -131,11 +133,12 @@ func (sgc *SpeakerGroupController) CreateSpeakerGroup(c *gin.Context) {
 
 // GetSpeakerGroups 获取声纹组列表
 func (sgc *SpeakerGroupController) GetSpeakerGroups(c *gin.Context) {
-	userID, exists := c.Get("user_id")
+	_, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "认证信息缺失"})
 		return
 	}
+	orgID := currentOrgID(c)
 
 	// 获取查询参数
 	agentIDStr := c.Query("agent_id")
@@ -152,7 +155,7 @@ func (sgc *SpeakerGroupController) GetSpeakerGroups(c *gin.Context) {
 	offset := (page - 1) * pageSize
 
 	// 构建查询
-	query := sgc.DB.Model(&models.SpeakerGroup{}).Where("user_id = ?", userID)
+	query := sgc.DB.Model(&models.SpeakerGroup{}).Where("org_id = ?", orgID)
 
 	// 按智能体过滤
 	if agentIDStr != "" {
@@ -215,11 +218,12 @@ func (sgc *SpeakerGroupController) GetSpeakerGroups(c *gin.Context) {
 
 // GetSpeakerGroup 获取声纹组详情（包含样本列表）
 func (sgc *SpeakerGroupController) GetSpeakerGroup(c *gin.Context) {
-	userID, exists := c.Get("user_id")
+	_, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "认证信息缺失"})
 		return
 	}
+	orgID := currentOrgID(c)
 
 	id := c.Param("id")
 	speakerGroupID, err := strconv.ParseUint(id, 10, 32)
@@ -230,7 +234,7 @@ func (sgc *SpeakerGroupController) GetSpeakerGroup(c *gin.Context) {
 
 	// 查询声纹组
 	var speakerGroup models.SpeakerGroup
-	if err := sgc.DB.Where("id = ? AND user_id = ?", speakerGroupID, userID).First(&speakerGroup).Error; err != nil {
+	if err := sgc.DB.Where("id = ? AND org_id = ?", speakerGroupID, orgID).First(&speakerGroup).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "声纹组不存在"})
 			return
@@ -280,11 +284,12 @@ func (sgc *SpeakerGroupController) GetSpeakerGroup(c *gin.Context) {
 
 // UpdateSpeakerGroup 更新声纹组
 func (sgc *SpeakerGroupController) UpdateSpeakerGroup(c *gin.Context) {
-	userID, exists := c.Get("user_id")
+	_, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "认证信息缺失"})
 		return
 	}
+	orgID := currentOrgID(c)
 
 	id := c.Param("id")
 	speakerGroupID, err := strconv.ParseUint(id, 10, 32)
@@ -309,7 +314,7 @@ func (sgc *SpeakerGroupController) UpdateSpeakerGroup(c *gin.Context) {
 
 	// 查询声纹组
 	var speakerGroup models.SpeakerGroup
-	if err := sgc.DB.Where("id = ? AND user_id = ?", speakerGroupID, userID).First(&speakerGroup).Error; err != nil {
+	if err := sgc.DB.Where("id = ? AND org_id = ?", speakerGroupID, orgID).First(&speakerGroup).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "声纹组不存在"})
 			return
@@ -321,7 +326,7 @@ func (sgc *SpeakerGroupController) UpdateSpeakerGroup(c *gin.Context) {
 	// 如果更新了智能体ID，需要验证新智能体是否存在
 	if req.AgentID != nil && *req.AgentID != speakerGroup.AgentID {
 		var agent models.Agent
-		if err := sgc.DB.Where("id = ? AND user_id = ?", *req.AgentID, userID).First(&agent).Error; err != nil {
+		if err := sgc.DB.Where("id = ? AND org_id = ?", *req.AgentID, orgID).First(&agent).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "智能体不存在或无权限访问"})
 				return
@@ -336,7 +341,7 @@ func (sgc *SpeakerGroupController) UpdateSpeakerGroup(c *gin.Context) {
 	if req.Name != "" && req.Name != speakerGroup.Name {
 		// 检查同一用户下是否已存在相同名称的声纹组（排除当前声纹组）
 		var existingGroup models.SpeakerGroup
-		if err := sgc.DB.Where("user_id = ? AND name = ? AND id != ?", userID, req.Name, speakerGroupID).First(&existingGroup).Error; err == nil {
+		if err := sgc.DB.Where("(org_id = ? OR user_id = ?) AND name = ? AND id != ?", orgID, speakerGroup.UserID, req.Name, speakerGroupID).First(&existingGroup).Error; err == nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "该声纹组名称已存在，请使用其他名称"})
 			return
 		} else if err != gorm.ErrRecordNotFound {
@@ -365,11 +370,12 @@ func (sgc *SpeakerGroupController) UpdateSpeakerGroup(c *gin.Context) {
 
 // DeleteSpeakerGroup 删除声纹组
 func (sgc *SpeakerGroupController) DeleteSpeakerGroup(c *gin.Context) {
-	userID, exists := c.Get("user_id")
+	_, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "认证信息缺失"})
 		return
 	}
+	orgID := currentOrgID(c)
 
 	id := c.Param("id")
 	speakerGroupID, err := strconv.ParseUint(id, 10, 32)
@@ -380,7 +386,7 @@ func (sgc *SpeakerGroupController) DeleteSpeakerGroup(c *gin.Context) {
 
 	// 查询声纹组
 	var speakerGroup models.SpeakerGroup
-	if err := sgc.DB.Where("id = ? AND user_id = ?", speakerGroupID, userID).First(&speakerGroup).Error; err != nil {
+	if err := sgc.DB.Where("id = ? AND org_id = ?", speakerGroupID, orgID).First(&speakerGroup).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "声纹组不存在"})
 			return
@@ -394,7 +400,7 @@ func (sgc *SpeakerGroupController) DeleteSpeakerGroup(c *gin.Context) {
 	sgc.DB.Where("speaker_group_id = ?", speakerGroupID).Find(&samples)
 
 	// 调用 asr_server 删除接口（通过 speaker_id，即声纹组的主键 ID，一次性删除所有样本）
-	err = sgc.callDeleteAPI(fmt.Sprintf("%d", speakerGroup.ID), speakerGroup.AgentID, userID)
+	err = sgc.callDeleteAPI(fmt.Sprintf("%d", speakerGroup.ID), speakerGroup.AgentID, speakerGroup.UserID)
 	if err != nil {
 		log.Printf("asr_server 删除声纹组失败 (speaker_id: %d): %v", speakerGroup.ID, err)
 		// 继续执行本地删除，不中断流程
@@ -428,6 +434,7 @@ func (sgc *SpeakerGroupController) AddSample(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "认证信息缺失"})
 		return
 	}
+	orgID := currentOrgID(c)
 
 	groupIDStr := c.Param("id") // 改为使用 :id 参数
 	groupID, err := strconv.ParseUint(groupIDStr, 10, 32)
@@ -436,9 +443,9 @@ func (sgc *SpeakerGroupController) AddSample(c *gin.Context) {
 		return
 	}
 
-	// 验证声纹组是否存在且属于当前用户
+	// 验证声纹组是否存在且属于当前组织
 	var speakerGroup models.SpeakerGroup
-	if err := sgc.DB.Where("id = ? AND user_id = ?", groupID, userID).First(&speakerGroup).Error; err != nil {
+	if err := sgc.DB.Where("id = ? AND org_id = ?", groupID, orgID).First(&speakerGroup).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "声纹组不存在"})
 			return
@@ -456,8 +463,8 @@ func (sgc *SpeakerGroupController) AddSample(c *gin.Context) {
 	if messageID != "" {
 		// 从历史聊天记录中获取音频
 		var chatMessage models.ChatMessage
-		if err := sgc.DB.Where("message_id = ? AND user_id = ? AND role = ? AND is_deleted = ?",
-			messageID, userID, "user", false).First(&chatMessage).Error; err != nil {
+		if err := sgc.DB.Where("message_id = ? AND org_id = ? AND role = ? AND is_deleted = ?",
+			messageID, orgID, "user", false).First(&chatMessage).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
 				c.JSON(http.StatusNotFound, gin.H{"error": "历史聊天记录不存在或不是用户消息"})
 				return
@@ -527,7 +534,7 @@ func (sgc *SpeakerGroupController) AddSample(c *gin.Context) {
 
 	// 保存音频文件到本地
 	filePath, savedFileSize, err := sgc.AudioStorage.SaveAudioFile(
-		userID.(uint),
+		speakerGroup.UserID,
 		uint(groupID),
 		sampleUUID,
 		fileName,
@@ -547,7 +554,7 @@ func (sgc *SpeakerGroupController) AddSample(c *gin.Context) {
 		speakerGroup.AgentID, // agent_id
 		file,
 		header,
-		userID,
+		speakerGroup.UserID, // 声纹服务按声纹组创建者注册，组织内其他成员追加样本时保持一致
 	)
 	if err != nil {
 		// 如果注册失败，删除已保存的文件
@@ -570,7 +577,7 @@ func (sgc *SpeakerGroupController) AddSample(c *gin.Context) {
 	if err := sgc.DB.Create(&sample).Error; err != nil {
 		// 如果数据库保存失败，删除文件和 asr_server 中的记录
 		sgc.AudioStorage.DeleteAudioFile(filePath)
-		sgc.callDeleteAPI(sampleUUID, speakerGroup.AgentID, userID, sampleUUID)
+		sgc.callDeleteAPI(sampleUUID, speakerGroup.AgentID, speakerGroup.UserID, sampleUUID)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存样本记录失败"})
 		return
 	}
@@ -593,11 +600,12 @@ func (sgc *SpeakerGroupController) AddSample(c *gin.Context) {
 
 // GetSamples 获取声纹组下的所有样本
 func (sgc *SpeakerGroupController) GetSamples(c *gin.Context) {
-	userID, exists := c.Get("user_id")
+	_, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "认证信息缺失"})
 		return
 	}
+	orgID := currentOrgID(c)
 
 	groupIDStr := c.Param("id") // 改为使用 :id 参数
 	groupID, err := strconv.ParseUint(groupIDStr, 10, 32)
@@ -606,9 +614,9 @@ func (sgc *SpeakerGroupController) GetSamples(c *gin.Context) {
 		return
 	}
 
-	// 验证声纹组是否存在且属于当前用户
+	// 验证声纹组是否存在且属于当前组织
 	var speakerGroup models.SpeakerGroup
-	if err := sgc.DB.Where("id = ? AND user_id = ?", groupID, userID).First(&speakerGroup).Error; err != nil {
+	if err := sgc.DB.Where("id = ? AND org_id = ?", groupID, orgID).First(&speakerGroup).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "声纹组不存在"})
 			return
@@ -646,11 +654,12 @@ func (sgc *SpeakerGroupController) GetSamples(c *gin.Context) {
 
 // DeleteSample 删除声纹样本
 func (sgc *SpeakerGroupController) DeleteSample(c *gin.Context) {
-	userID, exists := c.Get("user_id")
+	_, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "认证信息缺失"})
 		return
 	}
+	orgID := currentOrgID(c)
 
 	groupIDStr := c.Param("id") // 改为使用 :id 参数
 	sampleIDStr := c.Param("sample_id")
@@ -667,9 +676,9 @@ func (sgc *SpeakerGroupController) DeleteSample(c *gin.Context) {
 		return
 	}
 
-	// 验证样本是否存在且属于当前用户
+	// 验证样本是否存在且属于当前组织
 	var sample models.SpeakerSample
-	if err := sgc.DB.Where("id = ? AND speaker_group_id = ? AND user_id = ?", sampleID, groupID, userID).First(&sample).Error; err != nil {
+	if err := sgc.DB.Where("id = ? AND speaker_group_id = ?", sampleID, groupID).First(&sample).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "样本不存在"})
 			return
@@ -678,15 +687,15 @@ func (sgc *SpeakerGroupController) DeleteSample(c *gin.Context) {
 		return
 	}
 
-	// 查询声纹组以获取 AgentID
+	// 查询声纹组以获取 AgentID，同时校验声纹组属于当前组织
 	var speakerGroup models.SpeakerGroup
-	if err := sgc.DB.Where("id = ?", groupID).First(&speakerGroup).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询声纹组失败"})
+	if err := sgc.DB.Where("id = ? AND org_id = ?", groupID, orgID).First(&speakerGroup).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "声纹组不存在"})
 		return
 	}
 
 	// 调用 asr_server 删除接口（通过 UUID）
-	sgc.callDeleteAPI(sample.UUID, speakerGroup.AgentID, userID, sample.UUID)
+	sgc.callDeleteAPI(sample.UUID, speakerGroup.AgentID, speakerGroup.UserID, sample.UUID)
 
 	// 删除本地文件
 	sgc.AudioStorage.DeleteAudioFile(sample.FilePath)
@@ -708,11 +717,12 @@ func (sgc *SpeakerGroupController) DeleteSample(c *gin.Context) {
 
 // VerifySpeakerGroup 验证声纹组
 func (sgc *SpeakerGroupController) VerifySpeakerGroup(c *gin.Context) {
-	userID, exists := c.Get("user_id")
+	_, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "认证信息缺失"})
 		return
 	}
+	orgID := currentOrgID(c)
 
 	id := c.Param("id")
 	speakerGroupID, err := strconv.ParseUint(id, 10, 32)
@@ -721,9 +731,9 @@ func (sgc *SpeakerGroupController) VerifySpeakerGroup(c *gin.Context) {
 		return
 	}
 
-	// 验证声纹组是否存在且属于当前用户
+	// 验证声纹组是否存在且属于当前组织
 	var speakerGroup models.SpeakerGroup
-	if err := sgc.DB.Where("id = ? AND user_id = ?", speakerGroupID, userID).First(&speakerGroup).Error; err != nil {
+	if err := sgc.DB.Where("id = ? AND org_id = ?", speakerGroupID, orgID).First(&speakerGroup).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "声纹组不存在"})
 			return
@@ -741,7 +751,7 @@ func (sgc *SpeakerGroupController) VerifySpeakerGroup(c *gin.Context) {
 	defer file.Close()
 
 	// 调用 asr_server 验证接口
-	result, err := sgc.callVerifyAPI(fmt.Sprintf("%d", speakerGroup.ID), speakerGroup.AgentID, file, header, userID)
+	result, err := sgc.callVerifyAPI(fmt.Sprintf("%d", speakerGroup.ID), speakerGroup.AgentID, file, header, speakerGroup.UserID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "验证失败: " + err.Error()})
 		return
@@ -841,11 +851,12 @@ func (sgc *SpeakerGroupController) callVerifyAPI(speakerID string, agentID uint,
 
 // GetSampleFile 获取样本音频文件
 func (sgc *SpeakerGroupController) GetSampleFile(c *gin.Context) {
-	userID, exists := c.Get("user_id")
+	_, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "认证信息缺失"})
 		return
 	}
+	orgID := currentOrgID(c)
 
 	groupIDStr := c.Param("id")
 	sampleIDStr := c.Param("sample_id")
@@ -862,9 +873,15 @@ func (sgc *SpeakerGroupController) GetSampleFile(c *gin.Context) {
 		return
 	}
 
-	// 验证样本是否存在且属于当前用户
+	var groupCount int64
+	if err := sgc.DB.Model(&models.SpeakerGroup{}).Where("id = ? AND org_id = ?", groupID, orgID).Count(&groupCount).Error; err != nil || groupCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "声纹组不存在"})
+		return
+	}
+
+	// 验证样本是否存在且属于当前组织
 	var sample models.SpeakerSample
-	if err := sgc.DB.Where("id = ? AND speaker_group_id = ? AND user_id = ?", sampleID, groupID, userID).First(&sample).Error; err != nil {
+	if err := sgc.DB.Where("id = ? AND speaker_group_id = ?", sampleID, groupID).First(&sample).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "样本不存在"})
 			return
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"xiaozhi/manager/backend/middleware"
+	"xiaozhi/manager/backend/models"
+	"xiaozhi/manager/backend/services/audit"
+	"xiaozhi/manager/backend/services/sso"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SSOController 单点登录：OIDC 授权码 + PKCE 与 LDAP 绑定
+type SSOController struct {
+	DB  *gorm.DB
+	SSO *sso.Manager
+}
+
+type ssoExchangeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// ListProviders 登录页可用的登录方式
+func (sc *SSOController) ListProviders(c *gin.Context) {
+	cfg := sc.SSO.Config()
+	providers := sc.SSO.Providers()
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"providers":           providers,
+		"ldap_enabled":        sc.SSO.LDAP() != nil,
+		"local_login_enabled": !cfg.DisableLocalLogin || len(providers) == 0,
+	}})
+}
+
+// redirectURL 回调地址：优先使用配置的 public_url，反向代理部署时需正确设置
+func (sc *SSOController) redirectURL(c *gin.Context, provider string) string {
+	return externalBaseURL(c, sc.SSO.Config().PublicURL) + "/api/auth/oidc/" + url.PathEscape(provider) + "/callback"
+}
+
+// externalBaseURL manager 对外访问地址：配置了 public_url 时直接使用，否则按请求推断
+func externalBaseURL(c *gin.Context, publicURL string) string {
+	if base := strings.TrimRight(publicURL, "/"); base != "" {
+		return base
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// safeReturnPath 只允许站内相对路径，防止开放重定向
+func safeReturnPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return ""
+	}
+	return p
+}
+
+// BeginOIDC 跳转到身份提供方授权页
+func (sc *SSOController) BeginOIDC(c *gin.Context) {
+	provider := c.Param("provider")
+	authURL, err := sc.SSO.BeginOIDC(provider, sc.redirectURL(c, provider), safeReturnPath(c.Query("redirect")))
+	if errors.Is(err, sso.ErrUnknownProvider) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("[SSO] 发起 OIDC 登录失败: provider=%s err=%v", provider, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "无法连接身份提供方"})
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback 身份提供方回调：完成授权码交换与用户开通后，带一次性交换码跳回前端
+func (sc *SSOController) OIDCCallback(c *gin.Context) {
+	provider := c.Param("provider")
+	if errMsg := c.Query("error"); errMsg != "" {
+		sc.redirectLoginError(c, "身份提供方拒绝登录: "+errMsg)
+		return
+	}
+	id, returnTo, err := sc.SSO.FinishOIDC(c.Request.Context(), provider, c.Query("state"), c.Query("code"))
+	if err != nil {
+		log.Printf("[SSO] OIDC 回调失败: provider=%s err=%v", provider, err)
+		sc.redirectLoginError(c, "单点登录失败，请重试")
+		return
+	}
+	user, err := sc.provision(c, id)
+	if err != nil {
+		sc.redirectLoginError(c, "开通账号失败")
+		return
+	}
+	code, err := sc.SSO.IssueLoginCode(user.ID)
+	if err != nil {
+		sc.redirectLoginError(c, "单点登录失败，请重试")
+		return
+	}
+	q := url.Values{"code": {code}}
+	if returnTo != "" {
+		q.Set("redirect", returnTo)
+	}
+	c.Redirect(http.StatusFound, "/sso/callback?"+q.Encode())
+}
+
+func (sc *SSOController) redirectLoginError(c *gin.Context, msg string) {
+	c.Redirect(http.StatusFound, "/sso/callback?"+url.Values{"error": {msg}}.Encode())
+}
+
+// Exchange 用一次性交换码换取 JWT，返回结构与 /login 一致
+func (sc *SSOController) Exchange(c *gin.Context) {
+	var req ssoExchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := sc.SSO.RedeemLoginCode(req.Code)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "登录交换码无效或已过期"})
+		return
+	}
+	var user models.User
+	if err := sc.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
+		return
+	}
+	sc.respondToken(c, &user)
+}
+
+// LDAPLogin LDAP 用户名密码登录
+func (sc *SSOController) LDAPLogin(c *gin.Context) {
+	authenticator := sc.SSO.LDAP()
+	if authenticator == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用 LDAP 登录"})
+		return
+	}
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, err := authenticator.Authenticate(req.Username, req.Password)
+	if errors.Is(err, sso.ErrInvalidCredentials) {
+		log.Printf("[SSO] LDAP 登录失败 - 用户: %s, 客户端IP: %s", req.Username, c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("[SSO] LDAP 认证异常: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "LDAP 服务不可用"})
+		return
+	}
+	user, err := sc.provision(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "开通账号失败"})
+		return
+	}
+	sc.respondToken(c, user)
+}
+
+// provision 即时开通用户，新建账号时写入审计日志
+func (sc *SSOController) provision(c *gin.Context, id *sso.Identity) (*models.User, error) {
+	user, created, err := sso.Provision(sc.DB, sc.SSO.Config(), id)
+	if err != nil {
+		log.Printf("[SSO] 开通用户失败: provider=%s subject=%s err=%v", id.Provider, id.Subject, err)
+		return nil, err
+	}
+	log.Printf("[SSO] ✅ 单点登录成功 - 用户: %s, 来源: %s, 分组: %v", user.Username, id.Provider, id.Groups)
+	if created {
+		audit.Record(sc.DB, audit.Entry{
+			ActorID:      user.ID,
+			ActorName:    user.Username,
+			ActorRole:    audit.ActorRoleSystem,
+			Action:       audit.ActionCreate,
+			ResourceType: "users",
+			ResourceID:   strconv.FormatUint(uint64(user.ID), 10),
+			Method:       c.Request.Method,
+			Path:         c.Request.URL.Path,
+			StatusCode:   http.StatusOK,
+			After:        map[string]interface{}{"username": user.Username, "email": user.Email, "role": user.Role, "provider": id.Provider, "groups": id.Groups},
+			IP:           c.ClientIP(),
+			UserAgent:    c.Request.UserAgent(),
+		})
+	}
+	return user, nil
+}
+
+func (sc *SSOController) respondToken(c *gin.Context, user *models.User) {
+	token, err := middleware.GenerateToken(user.ID, user.Username, user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"token": token,
+		"user": gin.H{
+			"id":       user.ID,
+			"username": user.Username,
+			"email":    user.Email,
+			"role":     user.Role,
+		},
+	})
+}
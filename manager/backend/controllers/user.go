@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"xiaozhi/manager/backend/middleware"
 	"xiaozhi/manager/backend/models"
 
 	"github.com/gin-gonic/gin"
@@ -28,6 +29,8 @@ type UserController struct {
 		CallOpenClawChatFromClient(ctx context.Context, body map[string]interface{}) (map[string]interface{}, error)
 		CallOpenClawChatStreamFromClient(ctx context.Context, body map[string]interface{}, onResponse func(*WebSocketResponse) error) (map[string]interface{}, error)
 		InjectMessageToDevice(ctx context.Context, deviceID, message string, skipLlm bool) error
+		AskAgentFromClient(ctx context.Context, body map[string]interface{}) (map[string]interface{}, error)
+		RequestMcpCatalogFromClient(ctx context.Context, body map[string]interface{}) (map[string]interface{}, error)
 	}
 }
 
@@ -83,7 +86,7 @@ func normalizeMemoryMode(mode string) string {
 
 // 注入消息到设备
 func (uc *UserController) InjectMessage(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 
 	var req struct {
 		DeviceID string `json:"device_id" binding:"required"`
@@ -96,12 +99,16 @@ func (uc *UserController) InjectMessage(c *gin.Context) {
 		return
 	}
 
-	// 验证设备是否属于当前用户
+	// 验证设备是否属于当前组织
 	var device models.Device
 
-	if err := uc.DB.Where("device_name = ? AND user_id = ?", req.DeviceID, userID).First(&device).Error; err != nil {
+	if err := uc.DB.Where("device_name = ? AND org_id = ?", req.DeviceID, orgID).First(&device).Error; err != nil {
 		log.Printf("[InjectMessage] 设备查询失败: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "设备不存在或不属于当前用户"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "设备不存在或不属于当前组织"})
+		return
+	}
+	if r := middleware.TokenRestriction(c); r != nil && (!r.AllowsDevice(device.DeviceName) || !r.AllowsAgent(device.AgentID)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API Token 无权访问该设备"})
 		return
 	}
 
@@ -127,6 +134,7 @@ func (uc *UserController) InjectMessage(c *gin.Context) {
 // 用户直接创建设备（无需验证码）
 func (uc *UserController) CreateDevice(c *gin.Context) {
 	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 
 	var req struct {
 		DeviceName string `json:"device_name" binding:"required,min=2,max=50"`
@@ -138,10 +146,15 @@ func (uc *UserController) CreateDevice(c *gin.Context) {
 		return
 	}
 
-	// 验证智能体是否存在且属于当前用户
+	if r := middleware.TokenRestriction(c); r != nil && (!r.AllowsAgent(req.AgentID) || !r.AllowsDevice(req.DeviceName)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API Token 无权访问该智能体或设备"})
+		return
+	}
+
+	// 验证智能体是否存在且属于当前组织
 	var agent models.Agent
-	if err := uc.DB.Where("id = ? AND user_id = ?", req.AgentID, userID).First(&agent).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "智能体不存在或不属于当前用户"})
+	if err := uc.DB.Where("id = ? AND org_id = ?", req.AgentID, orgID).First(&agent).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "智能体不存在或不属于当前组织"})
 		return
 	}
 
@@ -166,6 +179,7 @@ func (uc *UserController) CreateDevice(c *gin.Context) {
 	// 创建设备
 	device := models.Device{
 		UserID:     userID.(uint),
+		OrgID:      orgID,
 		AgentID:    req.AgentID,
 		DeviceCode: deviceCode,
 		DeviceName: req.DeviceName,
@@ -196,7 +210,7 @@ func generateRandomCode() string {
 
 // 获取用户所有设备概览（只读）
 func (uc *UserController) GetMyDevices(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 
 	type DeviceOverview struct {
 		ID           uint       `json:"id"`
@@ -207,10 +221,16 @@ func (uc *UserController) GetMyDevices(c *gin.Context) {
 		Activated    bool       `json:"activated"`
 		LastActiveAt *time.Time `json:"last_active_at"`
 		CreatedAt    time.Time  `json:"created_at"`
+		// 提示词模板变量
+		DisplayName   string `json:"display_name"`
+		OwnerNickname string `json:"owner_nickname"`
+		Location      string `json:"location"`
+		Timezone      string `json:"timezone"`
 	}
 
 	var devices []models.Device
-	if err := uc.DB.Where("user_id = ?", userID).Find(&devices).Error; err != nil {
+	query := restrictDevicesByToken(c, uc.DB.Where("org_id = ?", orgID), "device_name")
+	if err := restrictAgentsByToken(c, query, "agent_id").Find(&devices).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取设备列表失败"})
 		return
 	}
@@ -219,19 +239,23 @@ func (uc *UserController) GetMyDevices(c *gin.Context) {
 	var result []DeviceOverview
 	for _, device := range devices {
 		overview := DeviceOverview{
-			ID:           device.ID,
-			DeviceName:   device.DeviceName,
-			DeviceCode:   device.DeviceCode,
-			AgentID:      device.AgentID,
-			Activated:    device.Activated,
-			LastActiveAt: device.LastActiveAt,
-			CreatedAt:    device.CreatedAt,
+			ID:            device.ID,
+			DeviceName:    device.DeviceName,
+			DeviceCode:    device.DeviceCode,
+			AgentID:       device.AgentID,
+			Activated:     device.Activated,
+			LastActiveAt:  device.LastActiveAt,
+			DisplayName:   device.DisplayName,
+			OwnerNickname: device.OwnerNickname,
+			Location:      device.Location,
+			Timezone:      device.Timezone,
+			CreatedAt:     device.CreatedAt,
 		}
 
 		// 如果设备绑定了智能体，获取智能体名称
 		if device.AgentID > 0 {
 			var agent models.Agent
-			if err := uc.DB.Where("id = ? AND user_id = ?", device.AgentID, userID).First(&agent).Error; err == nil {
+			if err := uc.DB.Where("id = ? AND org_id = ?", device.AgentID, orgID).First(&agent).Error; err == nil {
 				overview.AgentName = agent.Name
 			}
 		}
@@ -244,10 +268,10 @@ func (uc *UserController) GetMyDevices(c *gin.Context) {
 
 // 智能体管理
 func (uc *UserController) GetAgents(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 
 	var agents []models.Agent
-	if err := uc.DB.Where("user_id = ?", userID).Find(&agents).Error; err != nil {
+	if err := restrictAgentsByToken(c, uc.DB.Where("org_id = ?", orgID), "id").Find(&agents).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取智能体列表失败"})
 		return
 	}
@@ -291,6 +315,13 @@ func (uc *UserController) GetAgents(c *gin.Context) {
 
 func (uc *UserController) CreateAgent(c *gin.Context) {
 	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
+
+	// 限定了智能体范围的 API Token 不能创建新智能体
+	if r := middleware.TokenRestriction(c); r != nil && r.AgentIDs != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API Token 限定了智能体范围，不能创建智能体"})
+		return
+	}
 
 	var req struct {
 		Name             string                  `json:"name" binding:"required,min=2,max=50"`
@@ -302,7 +333,11 @@ func (uc *UserController) CreateAgent(c *gin.Context) {
 		MemoryMode       string                  `json:"memory_mode"`
 		MCPServiceNames  string                  `json:"mcp_service_names"`
 		OpenClaw         *OpenClawConfigResponse `json:"openclaw"`
+		MCPResources     *[]agentMCPResource     `json:"mcp_resources"`
+		ToolPolicies     *[]agentToolPolicy      `json:"tool_policies"`
+		AudioFrontend    *agentAudioFrontend     `json:"audio_frontend"`
 		KnowledgeBaseIDs []uint                  `json:"knowledge_base_ids"`
+		RevisionComment  string                  `json:"revision_comment"` // 本次修改的版本说明
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -321,13 +356,34 @@ func (uc *UserController) CreateAgent(c *gin.Context) {
 		return
 	}
 
-	if err := uc.validateKnowledgeBaseOwnership(userID.(uint), req.KnowledgeBaseIDs); err != nil {
+	var mcpResources string
+	if req.MCPResources != nil {
+		if mcpResources, err = normalizeAgentMCPResources(*req.MCPResources); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	var toolPolicies string
+	if req.ToolPolicies != nil {
+		if toolPolicies, err = normalizeAgentToolPolicies(*req.ToolPolicies); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	audioFrontend, err := normalizeAgentAudioFrontend(req.AudioFrontend)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := uc.validateKnowledgeBaseOwnership(orgID, req.KnowledgeBaseIDs); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	agent := models.Agent{
 		UserID:          userID.(uint),
+		OrgID:           orgID,
 		Name:            req.Name,
 		CustomPrompt:    req.CustomPrompt,
 		LLMConfigID:     req.LLMConfigID,
@@ -336,6 +392,9 @@ func (uc *UserController) CreateAgent(c *gin.Context) {
 		ASRSpeed:        req.ASRSpeed,
 		MemoryMode:      req.MemoryMode,
 		MCPServiceNames: normalizedMCPServiceNames,
+		MCPResources:    mcpResources,
+		ToolPolicies:    toolPolicies,
+		AudioFrontend:   audioFrontend,
 		Status:          "active",
 	}
 	openClawCfg := mergeOpenClawConfig(
@@ -352,16 +411,21 @@ func (uc *UserController) CreateAgent(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新智能体知识库关联失败"})
 		return
 	}
+	comment := req.RevisionComment
+	if strings.TrimSpace(comment) == "" {
+		comment = "创建智能体"
+	}
+	recordAgentRevision(uc.DB, c, &agent, nil, comment)
 
 	c.JSON(http.StatusCreated, gin.H{"success": true, "data": gin.H{"agent": agent, "knowledge_base_ids": uniqueUintSlice(req.KnowledgeBaseIDs)}})
 }
 
 func (uc *UserController) GetAgent(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	id, _ := strconv.Atoi(c.Param("id"))
 
 	var agent models.Agent
-	if err := uc.DB.Where("id = ? AND user_id = ?", id, userID).First(&agent).Error; err != nil {
+	if err := uc.DB.Where("id = ? AND org_id = ?", id, orgID).First(&agent).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在"})
 		return
 	}
@@ -399,11 +463,11 @@ func (uc *UserController) GetAgent(c *gin.Context) {
 }
 
 func (uc *UserController) UpdateAgent(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	id := c.Param("id")
 
 	var agent models.Agent
-	if err := uc.DB.Where("id = ? AND user_id = ?", id, userID).First(&agent).Error; err != nil {
+	if err := uc.DB.Where("id = ? AND org_id = ?", id, orgID).First(&agent).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在"})
 		return
 	}
@@ -418,7 +482,11 @@ func (uc *UserController) UpdateAgent(c *gin.Context) {
 		MemoryMode       *string                 `json:"memory_mode"`
 		MCPServiceNames  string                  `json:"mcp_service_names"`
 		OpenClaw         *OpenClawConfigResponse `json:"openclaw"`
+		MCPResources     *[]agentMCPResource     `json:"mcp_resources"`
+		ToolPolicies     *[]agentToolPolicy      `json:"tool_policies"`
+		AudioFrontend    *agentAudioFrontend     `json:"audio_frontend"`
 		KnowledgeBaseIDs []uint                  `json:"knowledge_base_ids"`
+		RevisionComment  string                  `json:"revision_comment"` // 本次修改的版本说明
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -449,17 +517,39 @@ func (uc *UserController) UpdateAgent(c *gin.Context) {
 		return
 	}
 	agent.MCPServiceNames = normalizedMCPServiceNames
+	// 未提交 mcp_resources 时保留原有的固定资源
+	if req.MCPResources != nil {
+		if agent.MCPResources, err = normalizeAgentMCPResources(*req.MCPResources); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	// 未提交 tool_policies 时保留原有的工具策略
+	if req.ToolPolicies != nil {
+		if agent.ToolPolicies, err = normalizeAgentToolPolicies(*req.ToolPolicies); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	// 未提交 audio_frontend 时保留原有的音频前端配置
+	if req.AudioFrontend != nil {
+		if agent.AudioFrontend, err = normalizeAgentAudioFrontend(req.AudioFrontend); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 	openClawCfg := mergeOpenClawConfig(
 		buildOpenClawConfigFromAgent(agent),
 		req.OpenClaw,
 	)
 	applyOpenClawConfigToAgent(&agent, openClawCfg)
 
+	before := captureAgentRevisionBase(uc.DB, agent.ID)
 	if err := uc.DB.Save(&agent).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新智能体失败"})
 		return
 	}
-	if err := uc.validateKnowledgeBaseOwnership(userID.(uint), req.KnowledgeBaseIDs); err != nil {
+	if err := uc.validateKnowledgeBaseOwnership(orgID, req.KnowledgeBaseIDs); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -467,16 +557,17 @@ func (uc *UserController) UpdateAgent(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新智能体知识库关联失败"})
 		return
 	}
+	rev := recordAgentRevision(uc.DB, c, &agent, before, req.RevisionComment)
 
-	c.JSON(http.StatusOK, gin.H{"data": gin.H{"agent": agent, "knowledge_base_ids": uniqueUintSlice(req.KnowledgeBaseIDs)}})
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"agent": agent, "knowledge_base_ids": uniqueUintSlice(req.KnowledgeBaseIDs), "revision": rev}})
 }
 
 func (uc *UserController) DeleteAgent(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	id := c.Param("id")
 
 	var agent models.Agent
-	if err := uc.DB.Where("id = ? AND user_id = ?", id, userID).First(&agent).Error; err != nil {
+	if err := uc.DB.Where("id = ? AND org_id = ?", id, orgID).First(&agent).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在"})
 		return
 	}
@@ -486,25 +577,26 @@ func (uc *UserController) DeleteAgent(c *gin.Context) {
 		return
 	}
 	_ = uc.DB.Where("agent_id = ?", agent.ID).Delete(&models.AgentKnowledgeBase{}).Error
+	_ = uc.DB.Where("agent_id = ?", agent.ID).Delete(&models.AgentIntentRule{}).Error
 
 	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
 }
 
 // 获取智能体关联的设备
 func (uc *UserController) GetAgentDevices(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	agentID := c.Param("id")
 
-	// 首先验证智能体是否存在且属于当前用户
+	// 首先验证智能体是否存在且属于当前组织
 	var agent models.Agent
-	if err := uc.DB.Where("id = ? AND user_id = ?", agentID, userID).First(&agent).Error; err != nil {
+	if err := uc.DB.Where("id = ? AND org_id = ?", agentID, orgID).First(&agent).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在"})
 		return
 	}
 
 	// 获取属于该智能体的设备
 	var devices []models.Device
-	if err := uc.DB.Where("user_id = ? AND agent_id = ?", userID, agentID).Find(&devices).Error; err != nil {
+	if err := uc.DB.Where("org_id = ? AND agent_id = ?", orgID, agentID).Find(&devices).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取设备列表失败"})
 		return
 	}
@@ -515,6 +607,7 @@ func (uc *UserController) GetAgentDevices(c *gin.Context) {
 // 将设备添加到智能体
 func (uc *UserController) AddDeviceToAgent(c *gin.Context) {
 	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	agentID := c.Param("id")
 
 	var req struct {
@@ -526,9 +619,9 @@ func (uc *UserController) AddDeviceToAgent(c *gin.Context) {
 		return
 	}
 
-	// 首先验证智能体是否存在且属于当前用户
+	// 首先验证智能体是否存在且属于当前组织
 	var agent models.Agent
-	if err := uc.DB.Where("id = ? AND user_id = ?", agentID, userID).First(&agent).Error; err != nil {
+	if err := uc.DB.Where("id = ? AND org_id = ?", agentID, orgID).First(&agent).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在"})
 		return
 	}
@@ -540,8 +633,9 @@ func (uc *UserController) AddDeviceToAgent(c *gin.Context) {
 		return
 	}
 
-	// 绑定设备到用户和智能体
+	// 绑定设备到用户、当前组织和智能体
 	device.UserID = userID.(uint)
+	device.OrgID = orgID
 
 	// 转换agentID字符串为uint
 	agentIDInt, err := strconv.Atoi(agentID)
@@ -564,20 +658,20 @@ func (uc *UserController) AddDeviceToAgent(c *gin.Context) {
 
 // 从智能体移除设备
 func (uc *UserController) RemoveDeviceFromAgent(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	agentID := c.Param("id")
 	deviceID := c.Param("device_id")
 
-	// 首先验证智能体是否存在且属于当前用户
+	// 首先验证智能体是否存在且属于当前组织
 	var agent models.Agent
-	if err := uc.DB.Where("id = ? AND user_id = ?", agentID, userID).First(&agent).Error; err != nil {
+	if err := uc.DB.Where("id = ? AND org_id = ?", agentID, orgID).First(&agent).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在"})
 		return
 	}
 
 	// 查找设备并验证所有权
 	var device models.Device
-	if err := uc.DB.Where("id = ? AND user_id = ? AND agent_id = ?", deviceID, userID, agentID).First(&device).Error; err != nil {
+	if err := uc.DB.Where("id = ? AND org_id = ? AND agent_id = ?", deviceID, orgID, agentID).First(&device).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "设备不存在或不属于此智能体"})
 		return
 	}
@@ -759,9 +853,10 @@ func (uc *UserController) GetVoiceOptions(c *gin.Context) {
 	}
 
 	// 再追加用户复刻音色（若与系统音色重复，优先保留复刻标签并置于后方）
-	if userID, ok := c.Get("user_id"); ok && configID != "" {
+	if _, ok := c.Get("user_id"); ok && configID != "" {
+		orgID := currentOrgID(c)
 		var clones []models.VoiceClone
-		if err := uc.DB.Where("user_id = ? AND provider = ? AND tts_config_id = ? AND status = ?", userID, provider, configID, "active").Order("created_at DESC").Find(&clones).Error; err == nil {
+		if err := uc.DB.Where("org_id = ? AND provider = ? AND tts_config_id = ? AND status = ?", orgID, provider, configID, "active").Order("created_at DESC").Find(&clones).Error; err == nil {
 			for _, clone := range clones {
 				opt := BuildVoiceOptionForClone(clone)
 				key := strings.TrimSpace(opt.Value)
@@ -784,8 +879,8 @@ func (uc *UserController) GetVoiceOptions(c *gin.Context) {
 		if err := uc.DB.Table("voice_clones").
 			Select("voice_clones.*").
 			Joins("JOIN users ON users.id = voice_clones.user_id").
-			Where("voice_clones.user_id <> ? AND voice_clones.provider = ? AND voice_clones.tts_config_id = ? AND voice_clones.status = ? AND voice_clones.shared_to_all = ? AND users.role = ?",
-				userID, provider, configID, "active", true, "admin").
+			Where("voice_clones.org_id <> ? AND voice_clones.provider = ? AND voice_clones.tts_config_id = ? AND voice_clones.status = ? AND voice_clones.shared_to_all = ? AND users.role = ?",
+				orgID, provider, configID, "active", true, "admin").
 			Order("voice_clones.created_at DESC").
 			Scan(&sharedClones).Error; err == nil {
 			for _, clone := range sharedClones {
@@ -832,7 +927,7 @@ func (uc *UserController) GetTTSConfigs(c *gin.Context) {
 
 // GetDeviceMcpTools 获取设备维度MCP工具列表（用户版本）
 func (uc *UserController) GetDeviceMcpTools(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	deviceID := c.Param("id")
 	if deviceID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "device_id parameter is required"})
@@ -840,8 +935,8 @@ func (uc *UserController) GetDeviceMcpTools(c *gin.Context) {
 	}
 
 	var device models.Device
-	if err := uc.DB.Where("id = ? AND user_id = ?", deviceID, userID).First(&device).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "设备不存在或不属于当前用户"})
+	if err := uc.DB.Where("id = ? AND org_id = ?", deviceID, orgID).First(&device).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "设备不存在或不属于当前组织"})
 		return
 	}
 
@@ -856,7 +951,7 @@ func (uc *UserController) GetDeviceMcpTools(c *gin.Context) {
 
 // CallAgentMcpTool 调用智能体维度MCP工具（用户版本）
 func (uc *UserController) CallAgentMcpTool(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	agentID := c.Param("id")
 
 	var req struct {
@@ -869,8 +964,8 @@ func (uc *UserController) CallAgentMcpTool(c *gin.Context) {
 	}
 
 	var agent models.Agent
-	if err := uc.DB.Where("id = ? AND user_id = ?", agentID, userID).First(&agent).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在或不属于当前用户"})
+	if err := uc.DB.Where("id = ? AND org_id = ?", agentID, orgID).First(&agent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在或不属于当前组织"})
 		return
 	}
 
@@ -879,6 +974,23 @@ func (uc *UserController) CallAgentMcpTool(c *gin.Context) {
 		"tool_name": req.ToolName,
 		"arguments": req.Arguments,
 	}
+	// API Token 限定了设备时只在允许的设备上调用
+	if r := middleware.TokenRestriction(c); r != nil && r.DeviceNames != nil {
+		sess := &agentMCPSession{uc: uc, c: c, agent: agent}
+		deviceID := ""
+		for _, t := range sess.reportedTools(c.Request.Context()) {
+			if t.Name == req.ToolName {
+				deviceID = t.deviceID
+				break
+			}
+		}
+		if deviceID == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API Token允许的设备均未上报该工具"})
+			return
+		}
+		delete(body, "agent_id")
+		body["device_id"] = deviceID
+	}
 	result, err := uc.WebSocketController.CallMcpToolFromClient(context.Background(), body)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "调用MCP工具失败: " + err.Error()})
@@ -889,11 +1001,11 @@ func (uc *UserController) CallAgentMcpTool(c *gin.Context) {
 }
 
 func (uc *UserController) GetAgentMCPServiceOptions(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	id := c.Param("id")
 
 	var agent models.Agent
-	if err := uc.DB.Where("id = ? AND user_id = ?", id, userID).First(&agent).Error; err != nil {
+	if err := uc.DB.Where("id = ? AND org_id = ?", id, orgID).First(&agent).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在"})
 		return
 	}
@@ -914,7 +1026,7 @@ func (uc *UserController) GetAgentMCPServiceOptions(c *gin.Context) {
 
 // CallDeviceMcpTool 调用设备维度MCP工具（用户版本）
 func (uc *UserController) CallDeviceMcpTool(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	deviceID := c.Param("id")
 
 	var req struct {
@@ -927,8 +1039,8 @@ func (uc *UserController) CallDeviceMcpTool(c *gin.Context) {
 	}
 
 	var device models.Device
-	if err := uc.DB.Where("id = ? AND user_id = ?", deviceID, userID).First(&device).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "设备不存在或不属于当前用户"})
+	if err := uc.DB.Where("id = ? AND org_id = ?", deviceID, orgID).First(&device).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "设备不存在或不属于当前组织"})
 		return
 	}
 
@@ -948,22 +1060,22 @@ func (uc *UserController) CallDeviceMcpTool(c *gin.Context) {
 
 // GetAgentMCPEndpoint 获取智能体的MCP接入点URL（用户版本）
 func (uc *UserController) GetAgentMCPEndpoint(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	agentID := c.Param("id")
 	if agentID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id parameter is required"})
 		return
 	}
 
-	// 验证智能体是否存在且属于当前用户
+	// 验证智能体是否存在且属于当前组织
 	var agent models.Agent
-	if err := uc.DB.Where("id = ? AND user_id = ?", agentID, userID).First(&agent).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在或不属于当前用户"})
+	if err := uc.DB.Where("id = ? AND org_id = ?", agentID, orgID).First(&agent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在或不属于当前组织"})
 		return
 	}
 
 	// 使用公共函数生成MCP接入点
-	endpoint, err := GenerateAgentMCPEndpoint(uc.DB, agentID, userID.(uint))
+	endpoint, err := GenerateAgentMCPEndpoint(uc.DB, agentID, agent.UserID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -975,7 +1087,7 @@ func (uc *UserController) GetAgentMCPEndpoint(c *gin.Context) {
 
 // GetAgentOpenClawEndpoint 获取智能体的OpenClaw接入点URL（用户版本）
 func (uc *UserController) GetAgentOpenClawEndpoint(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	agentID := c.Param("id")
 	if agentID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id parameter is required"})
@@ -983,12 +1095,12 @@ func (uc *UserController) GetAgentOpenClawEndpoint(c *gin.Context) {
 	}
 
 	var agent models.Agent
-	if err := uc.DB.Where("id = ? AND user_id = ?", agentID, userID).First(&agent).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在或不属于当前用户"})
+	if err := uc.DB.Where("id = ? AND org_id = ?", agentID, orgID).First(&agent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在或不属于当前组织"})
 		return
 	}
 
-	endpoint, err := GenerateAgentOpenClawEndpoint(uc.DB, agentID, userID.(uint))
+	endpoint, err := GenerateAgentOpenClawEndpoint(uc.DB, agentID, agent.UserID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -1034,7 +1146,7 @@ func (uc *UserController) GetAgentOpenClawEndpoint(c *gin.Context) {
 
 // CallAgentOpenClawChatTest 调用智能体 OpenClaw 对话测试（用户版本）
 func (uc *UserController) CallAgentOpenClawChatTest(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	agentID := c.Param("id")
 	if agentID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id parameter is required"})
@@ -1060,8 +1172,8 @@ func (uc *UserController) CallAgentOpenClawChatTest(c *gin.Context) {
 	}
 
 	var agent models.Agent
-	if err := uc.DB.Where("id = ? AND user_id = ?", agentID, userID).First(&agent).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在或不属于当前用户"})
+	if err := uc.DB.Where("id = ? AND org_id = ?", agentID, orgID).First(&agent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在或不属于当前组织"})
 		return
 	}
 
@@ -1152,14 +1264,14 @@ func (uc *UserController) CallAgentOpenClawChatTest(c *gin.Context) {
 
 // GetAgentMcpTools 获取智能体的MCP工具列表（用户版本）
 func (uc *UserController) GetAgentMcpTools(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	orgID := currentOrgID(c)
 	agentID := c.Param("id")
 
-	// 用户验证函数：验证智能体是否存在且属于当前用户
+	// 用户验证函数：验证智能体是否存在且属于当前组织
 	userAgentValidator := func(agentID string) error {
 		var agent models.Agent
-		if err := uc.DB.Where("id = ? AND user_id = ?", agentID, userID).First(&agent).Error; err != nil {
-			return fmt.Errorf("智能体不存在或不属于当前用户")
+		if err := uc.DB.Where("id = ? AND org_id = ?", agentID, orgID).First(&agent).Error; err != nil {
+			return fmt.Errorf("智能体不存在或不属于当前组织")
 		}
 		return nil
 	}
@@ -1170,7 +1282,6 @@ func (uc *UserController) GetAgentMcpTools(c *gin.Context) {
 
 // 获取仪表板统计数据
 func (uc *UserController) GetDashboardStats(c *gin.Context) {
-	userID, _ := c.Get("user_id")
 	userRole, _ := c.Get("role")
 
 	type DashboardStats struct {
@@ -1191,13 +1302,14 @@ func (uc *UserController) GetDashboardStats(c *gin.Context) {
 		fiveMinutesAgo := time.Now().Add(-5 * time.Minute)
 		uc.DB.Model(&models.Device{}).Where("last_active_at > ?", fiveMinutesAgo).Count(&stats.OnlineDevices)
 	} else {
-		// 普通用户只查看自己的数据
+		// 普通用户只查看当前组织的数据
+		orgID := currentOrgID(c)
 		stats.TotalUsers = 0 // 普通用户不显示用户数
-		uc.DB.Model(&models.Device{}).Where("user_id = ?", userID).Count(&stats.TotalDevices)
-		uc.DB.Model(&models.Agent{}).Where("user_id = ?", userID).Count(&stats.TotalAgents)
-		// 在线设备：用户自己的最近5分钟内活跃的设备
+		uc.DB.Model(&models.Device{}).Where("org_id = ?", orgID).Count(&stats.TotalDevices)
+		uc.DB.Model(&models.Agent{}).Where("org_id = ?", orgID).Count(&stats.TotalAgents)
+		// 在线设备：当前组织最近5分钟内活跃的设备
 		fiveMinutesAgo := time.Now().Add(-5 * time.Minute)
-		uc.DB.Model(&models.Device{}).Where("user_id = ? AND last_active_at > ?", userID, fiveMinutesAgo).Count(&stats.OnlineDevices)
+		uc.DB.Model(&models.Device{}).Where("org_id = ? AND last_active_at > ?", orgID, fiveMinutesAgo).Count(&stats.OnlineDevices)
 	}
 
 	c.JSON(http.StatusOK, stats)
@@ -241,8 +241,10 @@ func (vcc *VoiceCloneController) CreateVoiceClone(c *gin.Context) {
 		"queued_at":   time.Now(),
 	})
 
+	orgID := currentOrgID(c)
 	clone := models.VoiceClone{
 		UserID:             userID,
+		OrgID:              orgID,
 		Name:               name,
 		Provider:           rawProvider,
 		ProviderVoiceID:    providerVoiceID,
@@ -254,6 +256,7 @@ func (vcc *VoiceCloneController) CreateVoiceClone(c *gin.Context) {
 	}
 	audio := models.VoiceCloneAudio{
 		UserID:         userID,
+		OrgID:          orgID,
 		SourceType:     sourceType,
 		FilePath:       filePath,
 		FileName:       header.Filename,
@@ -310,15 +313,14 @@ func (vcc *VoiceCloneController) CreateVoiceClone(c *gin.Context) {
 }
 
 func (vcc *VoiceCloneController) GetVoiceClones(c *gin.Context) {
-	userIDAny, exists := c.Get("user_id")
-	if !exists {
+	if _, exists := c.Get("user_id"); !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "认证信息缺失"})
 		return
 	}
-	userID := userIDAny.(uint)
+	orgID := currentOrgID(c)
 
 	ttsConfigID := strings.TrimSpace(c.Query("tts_config_id"))
-	query := vcc.DB.Model(&models.VoiceClone{}).Where("user_id = ? AND status != ?", userID, "deleted")
+	query := vcc.DB.Model(&models.VoiceClone{}).Where("org_id = ? AND status != ?", orgID, "deleted")
 	if ttsConfigID != "" {
 		query = query.Where("tts_config_id = ?", ttsConfigID)
 	}
@@ -343,7 +345,7 @@ func (vcc *VoiceCloneController) GetVoiceClones(c *gin.Context) {
 	}
 
 	var tasks []models.VoiceCloneTask
-	if err := vcc.DB.Where("user_id = ? AND voice_clone_id IN ?", userID, cloneIDs).Order("created_at DESC").Find(&tasks).Error; err != nil {
+	if err := vcc.DB.Where("voice_clone_id IN ?", cloneIDs).Order("created_at DESC").Find(&tasks).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询复刻任务失败"})
 		return
 	}
@@ -409,12 +411,11 @@ func (vcc *VoiceCloneController) GetVoiceClones(c *gin.Context) {
 }
 
 func (vcc *VoiceCloneController) UpdateVoiceClone(c *gin.Context) {
-	userIDAny, exists := c.Get("user_id")
-	if !exists {
+	if _, exists := c.Get("user_id"); !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "认证信息缺失"})
 		return
 	}
-	userID := userIDAny.(uint)
+	orgID := currentOrgID(c)
 
 	cloneID := strings.TrimSpace(c.Param("id"))
 	if cloneID == "" {
@@ -432,7 +433,7 @@ func (vcc *VoiceCloneController) UpdateVoiceClone(c *gin.Context) {
 	}
 
 	var clone models.VoiceClone
-	if err := vcc.DB.Where("id = ? AND user_id = ? AND status != ?", cloneID, userID, "deleted").First(&clone).Error; err != nil {
+	if err := vcc.DB.Where("id = ? AND org_id = ? AND status != ?", cloneID, orgID, "deleted").First(&clone).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "复刻音色不存在"})
 			return
@@ -482,12 +483,11 @@ func (vcc *VoiceCloneController) UpdateVoiceClone(c *gin.Context) {
 }
 
 func (vcc *VoiceCloneController) DeleteVoiceClone(c *gin.Context) {
-	userIDAny, exists := c.Get("user_id")
-	if !exists {
+	if _, exists := c.Get("user_id"); !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "认证信息缺失"})
 		return
 	}
-	userID := userIDAny.(uint)
+	orgID := currentOrgID(c)
 
 	cloneID := strings.TrimSpace(c.Param("id"))
 	if cloneID == "" {
@@ -496,7 +496,7 @@ func (vcc *VoiceCloneController) DeleteVoiceClone(c *gin.Context) {
 	}
 
 	var clone models.VoiceClone
-	if err := vcc.DB.Where("id = ? AND user_id = ? AND status != ?", cloneID, userID, "deleted").First(&clone).Error; err != nil {
+	if err := vcc.DB.Where("id = ? AND org_id = ? AND status != ?", cloneID, orgID, "deleted").First(&clone).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "复刻音色不存在"})
 			return
@@ -510,7 +510,7 @@ func (vcc *VoiceCloneController) DeleteVoiceClone(c *gin.Context) {
 		"deleted_at": now,
 	})
 	if err := vcc.DB.Model(&models.VoiceClone{}).
-		Where("id = ? AND user_id = ?", clone.ID, userID).
+		Where("id = ?", clone.ID).
 		Updates(map[string]any{
 			"status":        "deleted",
 			"shared_to_all": false,
@@ -524,12 +524,11 @@ func (vcc *VoiceCloneController) DeleteVoiceClone(c *gin.Context) {
 }
 
 func (vcc *VoiceCloneController) RetryVoiceClone(c *gin.Context) {
-	userIDAny, exists := c.Get("user_id")
-	if !exists {
+	if _, exists := c.Get("user_id"); !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "认证信息缺失"})
 		return
 	}
-	userID := userIDAny.(uint)
+	orgID := currentOrgID(c)
 
 	cloneID := strings.TrimSpace(c.Param("id"))
 	if cloneID == "" {
@@ -541,10 +540,10 @@ func (vcc *VoiceCloneController) RetryVoiceClone(c *gin.Context) {
 	var task models.VoiceCloneTask
 	now := time.Now()
 	err := vcc.DB.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("id = ? AND user_id = ? AND status != ?", cloneID, userID, "deleted").First(&clone).Error; err != nil {
+		if err := tx.Where("id = ? AND org_id = ? AND status != ?", cloneID, orgID, "deleted").First(&clone).Error; err != nil {
 			return err
 		}
-		if err := tx.Where("voice_clone_id = ? AND user_id = ?", clone.ID, userID).
+		if err := tx.Where("voice_clone_id = ?", clone.ID).
 			Order("created_at DESC, id DESC").
 			First(&task).Error; err != nil {
 			return err
@@ -561,7 +560,7 @@ func (vcc *VoiceCloneController) RetryVoiceClone(c *gin.Context) {
 			"last_error":  "",
 		})
 		updateClone := tx.Model(&models.VoiceClone{}).
-			Where("id = ? AND user_id = ?", clone.ID, userID).
+			Where("id = ?", clone.ID).
 			Updates(map[string]any{
 				"status":    voiceCloneStatusProcessing,
 				"meta_json": cloneMetaJSON,
@@ -611,6 +610,7 @@ func (vcc *VoiceCloneController) AppendVoiceCloneAudio(c *gin.Context) {
 		return
 	}
 	userID := userIDAny.(uint)
+	orgID := currentOrgID(c)
 
 	cloneID := strings.TrimSpace(c.Param("id"))
 	if cloneID == "" {
@@ -619,7 +619,7 @@ func (vcc *VoiceCloneController) AppendVoiceCloneAudio(c *gin.Context) {
 	}
 
 	var clone models.VoiceClone
-	if err := vcc.DB.Where("id = ? AND user_id = ? AND status != ?", cloneID, userID, "deleted").First(&clone).Error; err != nil {
+	if err := vcc.DB.Where("id = ? AND org_id = ? AND status != ?", cloneID, orgID, "deleted").First(&clone).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "复刻音色不存在"})
 			return
@@ -682,6 +682,7 @@ func (vcc *VoiceCloneController) AppendVoiceCloneAudio(c *gin.Context) {
 	audio := models.VoiceCloneAudio{
 		VoiceCloneID:   &clone.ID,
 		UserID:         userID,
+		OrgID:          clone.OrgID,
 		SourceType:     sourceType,
 		FilePath:       filePath,
 		FileName:       header.Filename,
@@ -701,7 +702,7 @@ func (vcc *VoiceCloneController) AppendVoiceCloneAudio(c *gin.Context) {
 		"last_append_result":    result.RawResponse,
 		"last_append_http_code": result.ResponseCode,
 	})
-	if err := vcc.DB.Model(&models.VoiceClone{}).Where("id = ? AND user_id = ?", clone.ID, userID).Update("meta_json", metaJSON).Error; err != nil {
+	if err := vcc.DB.Model(&models.VoiceClone{}).Where("id = ?", clone.ID).Update("meta_json", metaJSON).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新复刻元数据失败"})
 		return
 	}
@@ -715,12 +716,11 @@ func (vcc *VoiceCloneController) AppendVoiceCloneAudio(c *gin.Context) {
 }
 
 func (vcc *VoiceCloneController) PreviewClonedVoice(c *gin.Context) {
-	userIDAny, exists := c.Get("user_id")
-	if !exists {
+	if _, exists := c.Get("user_id"); !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "认证信息缺失"})
 		return
 	}
-	userID := userIDAny.(uint)
+	orgID := currentOrgID(c)
 
 	cloneID := strings.TrimSpace(c.Param("id"))
 	if cloneID == "" {
@@ -729,7 +729,7 @@ func (vcc *VoiceCloneController) PreviewClonedVoice(c *gin.Context) {
 	}
 
 	var clone models.VoiceClone
-	if err := vcc.DB.Where("id = ? AND user_id = ? AND status != ?", cloneID, userID, "deleted").First(&clone).Error; err != nil {
+	if err := vcc.DB.Where("id = ? AND org_id = ? AND status != ?", cloneID, orgID, "deleted").First(&clone).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "复刻音色不存在"})
 			return
@@ -800,22 +800,21 @@ func (vcc *VoiceCloneController) PreviewClonedVoice(c *gin.Context) {
 }
 
 func (vcc *VoiceCloneController) GetVoiceCloneAudios(c *gin.Context) {
-	userIDAny, exists := c.Get("user_id")
-	if !exists {
+	if _, exists := c.Get("user_id"); !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "认证信息缺失"})
 		return
 	}
-	userID := userIDAny.(uint)
+	orgID := currentOrgID(c)
 
 	cloneID := strings.TrimSpace(c.Param("id"))
 	var clone models.VoiceClone
-	if err := vcc.DB.Where("id = ? AND user_id = ?", cloneID, userID).First(&clone).Error; err != nil {
+	if err := vcc.DB.Where("id = ? AND org_id = ?", cloneID, orgID).First(&clone).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "复刻音色不存在"})
 		return
 	}
 
 	var audios []models.VoiceCloneAudio
-	if err := vcc.DB.Where("voice_clone_id = ? AND user_id = ?", clone.ID, userID).Order("created_at DESC").Find(&audios).Error; err != nil {
+	if err := vcc.DB.Where("voice_clone_id = ?", clone.ID).Order("created_at DESC").Find(&audios).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询复刻音频失败"})
 		return
 	}
@@ -823,16 +822,15 @@ func (vcc *VoiceCloneController) GetVoiceCloneAudios(c *gin.Context) {
 }
 
 func (vcc *VoiceCloneController) GetVoiceCloneAudioFile(c *gin.Context) {
-	userIDAny, exists := c.Get("user_id")
-	if !exists {
+	if _, exists := c.Get("user_id"); !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "认证信息缺失"})
 		return
 	}
-	userID := userIDAny.(uint)
+	orgID := currentOrgID(c)
 
 	audioID := strings.TrimSpace(c.Param("audio_id"))
 	var audio models.VoiceCloneAudio
-	if err := vcc.DB.Where("id = ? AND user_id = ?", audioID, userID).First(&audio).Error; err != nil {
+	if err := vcc.DB.Where("id = ? AND org_id = ?", audioID, orgID).First(&audio).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "复刻音频不存在"})
 		return
 	}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"xiaozhi/manager/backend/models"
+	"xiaozhi/manager/backend/services/webhook"
 
 	"gorm.io/gorm"
 )
@@ -205,7 +206,7 @@ func (vcc *VoiceCloneController) finishVoiceCloneTaskSuccess(task *models.VoiceC
 	}
 	taskMetaJSON, _ := json.Marshal(taskMeta)
 
-	return vcc.DB.Transaction(func(tx *gorm.DB) error {
+	err := vcc.DB.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Model(&models.VoiceClone{}).Where("id = ? AND user_id = ? AND status != ?", clone.ID, clone.UserID, "deleted").Updates(map[string]any{
 			"provider_voice_id": result.VoiceID,
 			"status":            voiceCloneStatusActive,
@@ -223,6 +224,25 @@ func (vcc *VoiceCloneController) finishVoiceCloneTaskSuccess(task *models.VoiceC
 		}
 		return nil
 	})
+	if err == nil {
+		vcc.publishVoiceCloneEvent(webhook.EventVoiceCloneSucceeded, task, map[string]any{
+			"voice_clone_id":    clone.ID,
+			"name":              clone.Name,
+			"provider_voice_id": result.VoiceID,
+		})
+	}
+	return err
+}
+
+// publishVoiceCloneEvent 事件发布到复刻音色所属的组织
+func (vcc *VoiceCloneController) publishVoiceCloneEvent(eventType string, task *models.VoiceCloneTask, data map[string]any) {
+	var clone models.VoiceClone
+	if err := vcc.DB.Select("id", "org_id").First(&clone, task.VoiceCloneID).Error; err != nil || clone.OrgID == 0 {
+		return
+	}
+	data["task_id"] = task.TaskID
+	data["provider"] = task.Provider
+	webhook.Publish(webhook.Event{Type: eventType, OrgID: clone.OrgID, Data: data})
 }
 
 func (vcc *VoiceCloneController) finishVoiceCloneTaskFailed(task *models.VoiceCloneTask, clone *models.VoiceClone, failure error) {
@@ -276,6 +296,10 @@ func (vcc *VoiceCloneController) finishVoiceCloneTaskFailed(task *models.VoiceCl
 		return
 	}
 	log.Printf("[voice_clone][task] task failed: task_primary_id=%d task_id=%s reason=%s", task.ID, task.TaskID, lastError)
+	vcc.publishVoiceCloneEvent(webhook.EventVoiceCloneFailed, task, map[string]any{
+		"voice_clone_id": task.VoiceCloneID,
+		"error":          lastError,
+	})
 }
 
 func mergeJSONMeta(raw string, updates map[string]any) string {
@@ -0,0 +1,276 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"xiaozhi/manager/backend/models"
+	"xiaozhi/manager/backend/services/webhook"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// WebhookController 管理当前组织的 Webhook 订阅与投递记录
+type WebhookController struct {
+	DB *gorm.DB
+	// AllowPrivateNetwork 与 webhook.allow_private_network 一致，为 false 时拒绝内网地址
+	AllowPrivateNetwork bool
+}
+
+type webhookRequest struct {
+	Name     string   `json:"name" binding:"required,min=2,max=100"`
+	URL      string   `json:"url" binding:"required"`
+	Events   []string `json:"events"`
+	AgentID  uint     `json:"agent_id"`
+	IsActive *bool    `json:"is_active"`
+}
+
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// validate 校验请求并写入订阅，智能体必须属于当前组织
+func (wc *WebhookController) validate(c *gin.Context, req webhookRequest, hook *models.Webhook) error {
+	u, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("URL 必须是 http/https 地址")
+	}
+	if !wc.AllowPrivateNetwork {
+		if err := webhook.ValidateURLHost(u.Hostname()); err != nil {
+			return errors.New("URL 不能指向内网、回环或链路本地地址")
+		}
+	}
+	if len(req.Events) == 0 {
+		return errors.New("至少选择一个事件")
+	}
+	for _, e := range req.Events {
+		if !webhook.ValidEvent(e) {
+			return errors.New("无效的事件类型: " + e)
+		}
+	}
+	if req.AgentID != 0 {
+		var count int64
+		wc.DB.Model(&models.Agent{}).Where("id = ? AND org_id = ?", req.AgentID, currentOrgID(c)).Count(&count)
+		if count == 0 {
+			return errors.New("智能体不存在或不属于当前组织")
+		}
+	}
+
+	hook.Name = strings.TrimSpace(req.Name)
+	hook.URL = u.String()
+	hook.Events = strings.Join(req.Events, ",")
+	hook.AgentID = req.AgentID
+	if req.IsActive != nil {
+		hook.IsActive = *req.IsActive
+	}
+	return nil
+}
+
+func (wc *WebhookController) loadWebhook(c *gin.Context) (*models.Webhook, bool) {
+	var hook models.Webhook
+	if err := wc.DB.Where("id = ? AND org_id = ?", c.Param("id"), currentOrgID(c)).First(&hook).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook不存在"})
+		return nil, false
+	}
+	return &hook, true
+}
+
+// ListEvents 获取可订阅的事件类型
+func (wc *WebhookController) ListEvents(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": webhook.AllEvents})
+}
+
+// ListWebhooks 获取当前组织的 Webhook 列表
+func (wc *WebhookController) ListWebhooks(c *gin.Context) {
+	var hooks []models.Webhook
+	if err := wc.DB.Where("org_id = ?", currentOrgID(c)).Order("id DESC").Find(&hooks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取Webhook列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": hooks})
+}
+
+// CreateWebhook 创建 Webhook，签名密钥仅在创建和重置时返回
+func (wc *WebhookController) CreateWebhook(c *gin.Context) {
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	hook := models.Webhook{OrgID: currentOrgID(c), UserID: currentUserID(c), IsActive: true}
+	if err := wc.validate(c, req, &hook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成签名密钥失败"})
+		return
+	}
+	hook.Secret = secret
+	hook.SecretPrefix = secret[:12]
+	if err := wc.DB.Create(&hook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建Webhook失败"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Webhook创建成功，请妥善保存签名密钥，后续无法再次查看",
+		"data":    gin.H{"webhook": hook, "secret": secret},
+	})
+}
+
+// UpdateWebhook 更新 Webhook
+func (wc *WebhookController) UpdateWebhook(c *gin.Context) {
+	hook, ok := wc.loadWebhook(c)
+	if !ok {
+		return
+	}
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if err := wc.validate(c, req, hook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := wc.DB.Model(hook).Select("name", "url", "events", "agent_id", "is_active").Updates(hook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新Webhook失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook已更新", "data": hook})
+}
+
+// DeleteWebhook 删除 Webhook 及其投递记录
+func (wc *WebhookController) DeleteWebhook(c *gin.Context) {
+	hook, ok := wc.loadWebhook(c)
+	if !ok {
+		return
+	}
+	err := wc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", hook.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(hook).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除Webhook失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook已删除"})
+}
+
+// RotateSecret 重置签名密钥
+func (wc *WebhookController) RotateSecret(c *gin.Context) {
+	hook, ok := wc.loadWebhook(c)
+	if !ok {
+		return
+	}
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成签名密钥失败"})
+		return
+	}
+	if err := wc.DB.Model(hook).Updates(map[string]interface{}{"secret": secret, "secret_prefix": secret[:12]}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置签名密钥失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "签名密钥已重置", "data": gin.H{"secret": secret}})
+}
+
+// SendTestEvent 同步投递一条测试事件并返回投递结果
+func (wc *WebhookController) SendTestEvent(c *gin.Context) {
+	hook, ok := wc.loadWebhook(c)
+	if !ok {
+		return
+	}
+	dispatcher := webhook.Default()
+	if dispatcher == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Webhook投递服务未启动"})
+		return
+	}
+	delivery, err := dispatcher.SendTest(c.Request.Context(), *hook)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "发送测试事件失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": delivery})
+}
+
+// ListDeliveries 获取投递记录，status=dead 即死信列表
+func (wc *WebhookController) ListDeliveries(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := wc.DB.Model(&models.WebhookDelivery{}).Where("org_id = ?", currentOrgID(c))
+	if id := c.Param("id"); id != "" {
+		query = query.Where("webhook_id = ?", id)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if eventType := c.Query("event_type"); eventType != "" {
+		query = query.Where("event_type = ?", eventType)
+	}
+
+	var total int64
+	query.Count(&total)
+	var deliveries []models.WebhookDelivery
+	if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取投递记录失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": deliveries, "total": total, "page": page, "page_size": pageSize})
+}
+
+// Redeliver 重新投递（死信或已成功的记录）
+func (wc *WebhookController) Redeliver(c *gin.Context) {
+	var delivery models.WebhookDelivery
+	if err := wc.DB.Where("id = ? AND org_id = ?", c.Param("delivery_id"), currentOrgID(c)).First(&delivery).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "投递记录不存在"})
+		return
+	}
+	dispatcher := webhook.Default()
+	if dispatcher == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Webhook投递服务未启动"})
+		return
+	}
+	if delivery.Status != webhook.StatusDead && delivery.Status != webhook.StatusSuccess {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该记录正在投递中"})
+		return
+	}
+	if err := dispatcher.Redeliver(delivery.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重新投递失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已重新加入投递队列"})
+}
+
+// publishDeviceWebhookEvent 按设备所属组织与智能体发布事件
+func publishDeviceWebhookEvent(db *gorm.DB, eventType, deviceName string, data map[string]interface{}) {
+	var device models.Device
+	if err := db.Where("device_name = ?", deviceName).First(&device).Error; err != nil {
+		return
+	}
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	data["device_id"] = device.DeviceName
+	data["device_db_id"] = device.ID
+	webhook.Publish(webhook.Event{Type: eventType, OrgID: device.OrgID, AgentID: device.AgentID, Data: data})
+}
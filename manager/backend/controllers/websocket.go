@@ -17,6 +17,7 @@ import (
 	"gorm.io/gorm"
 
 	"xiaozhi/manager/backend/models"
+	"xiaozhi/manager/backend/services/webhook"
 )
 
 type WebSocketController struct {
@@ -406,6 +407,7 @@ func (client *WebSocketClient) handleDeviceActiveRequest(request *WebSocketReque
 
 	client.sendResponse(request.ID, 200, response, "")
 	log.Printf("设备 %s 活跃时间已更新为: %s", deviceID, now.Format(time.RFC3339))
+	publishDeviceWebhookEvent(client.controller.DB, webhook.EventDeviceOnline, deviceID, map[string]interface{}{"online_at": now})
 }
 
 // 处理设备离线请求
@@ -452,6 +454,7 @@ func (client *WebSocketClient) handleDeviceInactiveRequest(request *WebSocketReq
 
 	client.sendResponse(request.ID, 200, response, "")
 	log.Printf("设备 %s 已设置为离线状态", deviceID)
+	publishDeviceWebhookEvent(client.controller.DB, webhook.EventDeviceOffline, deviceID, map[string]interface{}{"offline_at": time.Now()})
 }
 
 // 发送响应
@@ -694,6 +697,37 @@ func (ctrl *WebSocketController) CallMcpToolFromClient(ctx context.Context, body
 	return response.Body, nil
 }
 
+// AskAgentFromClient 请求一个主程序实例以智能体的 LLM 配置回答文本，只发给一个实例避免重复调用 LLM
+func (ctrl *WebSocketController) AskAgentFromClient(ctx context.Context, body map[string]interface{}) (map[string]interface{}, error) {
+	clientUUID := ctrl.GetFirstConnectedClientUUID()
+	if clientUUID == "" {
+		return nil, fmt.Errorf("没有连接的客户端")
+	}
+	response, err := ctrl.SendRequestToClient(ctx, clientUUID, "POST", "/api/agent/ask", body)
+	if err != nil {
+		return nil, err
+	}
+	if response.Status != http.StatusOK {
+		return nil, fmt.Errorf("%s", strings.TrimSpace(response.Error))
+	}
+	if response.Body == nil {
+		return map[string]interface{}{}, nil
+	}
+	return response.Body, nil
+}
+
+// RequestMcpCatalogFromClient 请求主程序返回 MCP 资源与提示词列表
+func (ctrl *WebSocketController) RequestMcpCatalogFromClient(ctx context.Context, body map[string]interface{}) (map[string]interface{}, error) {
+	response, err := ctrl.broadcastRequestAndWaitFirstSuccess(ctx, "GET", "/api/mcp/resources", body)
+	if err != nil {
+		return nil, err
+	}
+	if response.Body == nil {
+		return map[string]interface{}{}, nil
+	}
+	return response.Body, nil
+}
+
 // RequestOpenClawStatusFromClient 请求客户端返回 OpenClaw 连接状态
 func (ctrl *WebSocketController) RequestOpenClawStatusFromClient(ctx context.Context, agentID string) (map[string]interface{}, error) {
 	body := map[string]interface{}{
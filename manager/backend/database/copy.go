@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// CopyOptions 跨库数据迁移参数
+type CopyOptions struct {
+	BatchSize int  // 每批读取/写入的行数，默认 500
+	Truncate  bool // 目标库已有数据时先清空；否则拒绝迁移，避免主键冲突或数据混杂
+}
+
+// CopyResult 单张表的迁移结果
+type CopyResult struct {
+	Table string `json:"table"`
+	Rows  int64  `json:"rows"`
+}
+
+// CopyData 将 src 中全部模型的数据原样复制到 dst（如 SQLite/MySQL → PostgreSQL）。
+// 目标库会先按模型自动建表；复制保留原主键，不触发模型钩子（不会重复创建个人组织、不会被审计日志只读限制拦截），
+// 写入 PostgreSQL 后会把自增序列推进到当前最大 ID 之后
+func CopyData(src, dst *gorm.DB, opts CopyOptions) ([]CopyResult, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	all := Models()
+	if err := dst.AutoMigrate(all...); err != nil {
+		return nil, fmt.Errorf("目标库表结构迁移失败: %w", err)
+	}
+
+	schemas := make([]*schema.Schema, 0, len(all))
+	cache := &sync.Map{}
+	for _, m := range all {
+		sch, err := schema.Parse(m, cache, dst.NamingStrategy)
+		if err != nil {
+			return nil, fmt.Errorf("解析模型失败: %w", err)
+		}
+		schemas = append(schemas, sch)
+	}
+
+	for _, sch := range schemas {
+		var count int64
+		if err := dst.Table(sch.Table).Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("检查目标表 %s 失败: %w", sch.Table, err)
+		}
+		if count == 0 {
+			continue
+		}
+		if !opts.Truncate {
+			return nil, fmt.Errorf("目标表 %s 已有 %d 条数据，如需覆盖请开启清空选项", sch.Table, count)
+		}
+		if err := dst.Exec("DELETE FROM " + dst.Statement.Quote(sch.Table)).Error; err != nil {
+			return nil, fmt.Errorf("清空目标表 %s 失败: %w", sch.Table, err)
+		}
+	}
+
+	results := make([]CopyResult, 0, len(schemas))
+	for i, sch := range schemas {
+		rows, err := copyTable(src, dst, all[i], sch, opts.BatchSize)
+		if err != nil {
+			return results, fmt.Errorf("复制表 %s 失败: %w", sch.Table, err)
+		}
+		log.Printf("已复制表 %s: %d 条", sch.Table, rows)
+		results = append(results, CopyResult{Table: sch.Table, Rows: rows})
+	}
+
+	if dst.Dialector.Name() == "postgres" {
+		for _, sch := range schemas {
+			if err := resetPostgresSequence(dst, sch); err != nil {
+				return results, err
+			}
+		}
+	}
+	return results, nil
+}
+
+// copyTable 以模型类型分批读取源表（由 GORM 负责各驱动的类型转换），再按列写入目标表
+func copyTable(src, dst *gorm.DB, model interface{}, sch *schema.Schema, batchSize int) (int64, error) {
+	sliceType := reflect.SliceOf(reflect.TypeOf(model).Elem())
+	batch := reflect.New(sliceType)
+	var total int64
+	var writeErr error
+
+	reader := src.Session(&gorm.Session{SkipHooks: true}).Model(model)
+	err := reader.FindInBatches(batch.Interface(), batchSize, func(tx *gorm.DB, _ int) error {
+		items := batch.Elem()
+		rows := make([]map[string]interface{}, 0, items.Len())
+		for i := 0; i < items.Len(); i++ {
+			rows = append(rows, rowValues(sch, items.Index(i)))
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		if writeErr = dst.Table(sch.Table).Create(&rows).Error; writeErr != nil {
+			return writeErr
+		}
+		total += int64(len(rows))
+		return nil
+	}).Error
+	if writeErr != nil {
+		return total, writeErr
+	}
+	return total, err
+}
+
+// rowValues 取出一行全部列的值（包括零值，避免 default:true 等列被数据库默认值覆盖）。
+// JSON 列的空字符串写为 NULL，PostgreSQL jsonb 与 MySQL json 均不接受空串
+func rowValues(sch *schema.Schema, item reflect.Value) map[string]interface{} {
+	row := make(map[string]interface{}, len(sch.DBNames))
+	for _, name := range sch.DBNames {
+		field := sch.FieldsByDBName[name]
+		value, zero := field.ValueOf(context.Background(), item)
+		if zero && isJSONColumn(field) {
+			value = nil
+		}
+		row[name] = value
+	}
+	return row
+}
+
+func isJSONColumn(field *schema.Field) bool {
+	return strings.EqualFold(string(field.DataType), "json")
+}
+
+// resetPostgresSequence 显式写入主键后，序列不会随之推进，需手动对齐，否则后续插入会主键冲突
+func resetPostgresSequence(db *gorm.DB, sch *schema.Schema) error {
+	pk := sch.PrioritizedPrimaryField
+	if pk == nil || !pk.AutoIncrement {
+		return nil
+	}
+	sql := fmt.Sprintf(
+		"SELECT setval(pg_get_serial_sequence('%s', '%s'), COALESCE((SELECT MAX(%s) FROM %s), 0) + 1, false)",
+		sch.Table, pk.DBName, db.Statement.Quote(pk.DBName), db.Statement.Quote(sch.Table),
+	)
+	if err := db.Exec(sql).Error; err != nil {
+		return fmt.Errorf("重置表 %s 自增序列失败: %w", sch.Table, err)
+	}
+	return nil
+}
@@ -1,48 +1,106 @@
 package database
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"xiaozhi/manager/backend/config"
 	"xiaozhi/manager/backend/models"
+	pgstore "xiaozhi/manager/backend/storage/postgres"
 
 	"github.com/glebarez/sqlite"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
-func Init(cfg config.DatabaseConfig) *gorm.DB {
-	var db *gorm.DB
-	var err error
+// SupportedTypes 支持的数据库类型
+var SupportedTypes = []string{"sqlite", "mysql", "postgres"}
 
-	storageType := cfg.GetStorageType()
+// Models 返回需要自动迁移的全部模型，初始化、安装向导与跨库数据迁移共用同一份列表。
+// 顺序即建表与数据复制顺序
+func Models() []interface{} {
+	return []interface{}{
+		&models.User{},
+		&models.APIToken{},
+		&models.Device{},
+		&models.Agent{},
+		&models.KnowledgeBase{},
+		&models.KnowledgeBaseDocument{},
+		&models.AgentKnowledgeBase{},
+		&models.AgentIntentRule{},
+		&models.Config{},
+		&models.MCPMarketService{},
+		&models.GlobalRole{},
+		&models.Role{}, // 新增：统一角色表
+		&models.ChatMessage{},
+		&models.SpeakerGroup{},
+		&models.SpeakerSample{},
+		&models.VoiceClone{},
+		&models.VoiceCloneAudio{},
+		&models.VoiceCloneTask{},
+		&models.UserVoiceCloneQuota{},
+		&models.Organization{},
+		&models.OrganizationMember{},
+		&models.OrganizationInvitation{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.AuditLog{},
+		&models.Revision{},
+		&models.Experiment{},
+		&models.ExperimentVariant{},
+		&models.ExperimentTurn{},
+		&models.PromptSnippet{},
+		&models.UserIdentity{},
+		&models.MCPOAuthToken{},
+	}
+}
 
-	if storageType == "sqlite" {
+// Open 按配置连接数据库（不做迁移），配置缺失时返回 ErrNotConfigured
+func Open(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	switch cfg.GetStorageType() {
+	case "sqlite":
 		if cfg.SQLite == nil {
-			log.Println("SQLite配置为空，将使用fallback模式运行（硬编码用户验证）")
-			return nil
+			return nil, fmt.Errorf("SQLite%w", ErrNotConfigured)
 		}
 		// 确保数据库文件所在目录存在，避免 SQLite 报 unable to open database file
 		dir := filepath.Dir(cfg.SQLite.FilePath)
 		if err := os.MkdirAll(dir, 0755); err != nil {
-			log.Printf("创建数据库目录失败 %s: %v", dir, err)
-			return nil
+			return nil, fmt.Errorf("创建数据库目录失败 %s: %w", dir, err)
 		}
 		log.Println("使用SQLite数据库:", cfg.SQLite.FilePath)
-		db, err = gorm.Open(sqlite.Open(cfg.SQLite.FilePath), &gorm.Config{})
-	} else {
+		return gorm.Open(sqlite.Open(cfg.SQLite.FilePath), &gorm.Config{})
+	case "postgres":
+		if cfg.Postgres == nil {
+			return nil, fmt.Errorf("PostgreSQL%w", ErrNotConfigured)
+		}
+		if err := pgstore.ValidateConfig(cfg.Postgres); err != nil {
+			return nil, err
+		}
+		pgCfg := pgstore.NewConfigFromDatabase(cfg.Postgres)
+		log.Printf("使用PostgreSQL数据库: %s:%d/%s", pgCfg.Host, pgCfg.Port, pgCfg.Database)
+		return gorm.Open(pgstore.Open(pgCfg.DSN()), &gorm.Config{})
+	default:
 		if cfg.MySQL == nil {
-			log.Println("MySQL配置为空，将使用fallback模式运行（硬编码用户验证）")
-			return nil
+			return nil, fmt.Errorf("MySQL%w", ErrNotConfigured)
 		}
 		// MySQL 数据库连接
 		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
 			cfg.MySQL.Username, cfg.MySQL.Password, cfg.MySQL.Host, cfg.MySQL.Port, cfg.MySQL.Database)
-		db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+		return gorm.Open(mysql.Open(dsn), &gorm.Config{})
 	}
+}
+
+// ErrNotConfigured 对应数据库类型的配置段为空
+var ErrNotConfigured = errors.New("配置为空")
 
+func Init(cfg config.DatabaseConfig) *gorm.DB {
+	db, err := Open(cfg)
+	if errors.Is(err, ErrNotConfigured) {
+		log.Printf("%v，将使用fallback模式运行（硬编码用户验证）", err)
+		return nil
+	}
 	if err != nil {
 		log.Println("数据库连接失败:", err)
 		log.Println("将使用fallback模式运行（硬编码用户验证）")
@@ -53,26 +111,7 @@ func Init(cfg config.DatabaseConfig) *gorm.DB {
 
 	// 自动迁移数据库表结构
 	log.Println("开始自动迁移数据库表结构...")
-	err = db.AutoMigrate(
-		&models.User{},
-		&models.APIToken{},
-		&models.Device{},
-		&models.Agent{},
-		&models.KnowledgeBase{},
-		&models.KnowledgeBaseDocument{},
-		&models.AgentKnowledgeBase{},
-		&models.Config{},
-		&models.MCPMarketService{},
-		&models.GlobalRole{},
-		&models.Role{}, // 新增：统一角色表
-		&models.ChatMessage{},
-		&models.SpeakerGroup{},
-		&models.SpeakerSample{},
-		&models.VoiceClone{},
-		&models.VoiceCloneAudio{},
-		&models.VoiceCloneTask{},
-		&models.UserVoiceCloneQuota{},
-	)
+	err = db.AutoMigrate(Models()...)
 	if err != nil {
 		log.Printf("数据库表结构迁移失败: %v", err)
 		log.Println("将使用fallback模式运行（硬编码用户验证）")
@@ -87,6 +126,11 @@ func Init(cfg config.DatabaseConfig) *gorm.DB {
 		// 迁移失败不影响启动，只是数据没有迁移
 	}
 
+	// 为存量用户创建个人组织，并将其名下资源归入个人组织
+	if err := migratePersonalOrganizations(db); err != nil {
+		log.Printf("迁移个人组织失败: %v", err)
+	}
+
 	return db
 }
 
@@ -158,3 +202,42 @@ func migrateGlobalRolesToRoles(db *gorm.DB) error {
 	log.Println("全局角色数据迁移完成")
 	return nil
 }
+
+// migratePersonalOrganizations 为每个用户创建个人组织，并把尚未归属组织（org_id = 0）的资源归入创建者的个人组织。
+// 可重复执行：已有个人组织的用户与已归属组织的资源会被跳过。
+func migratePersonalOrganizations(db *gorm.DB) error {
+	var users []models.User
+	if err := db.Find(&users).Error; err != nil {
+		return fmt.Errorf("查询用户失败: %w", err)
+	}
+
+	// roles 中的全局角色 user_id 为 NULL，不会被归入组织
+	tables := []string{"agents", "devices", "knowledge_bases", "speaker_groups", "chat_messages", "api_tokens", "roles", "voice_clones", "voice_clone_audios"}
+	for i := range users {
+		user := &users[i]
+		org, err := models.EnsurePersonalOrganization(db, user)
+		if err != nil {
+			return fmt.Errorf("用户 %s: %w", user.Username, err)
+		}
+		for _, table := range tables {
+			res := db.Table(table).Where("user_id = ? AND org_id = ?", user.ID, 0).Update("org_id", org.ID)
+			if res.Error != nil {
+				return fmt.Errorf("迁移 %s 失败: %w", table, res.Error)
+			}
+			if res.RowsAffected > 0 {
+				log.Printf("已将用户 %s 的 %d 条 %s 记录归入个人组织 %d", user.Username, res.RowsAffected, table, org.ID)
+			}
+		}
+	}
+
+	// 角色的配置版本随角色归属组织
+	res := db.Exec("UPDATE revisions SET org_id = (SELECT roles.org_id FROM roles WHERE roles.id = revisions.resource_id) "+
+		"WHERE resource_type = ? AND org_id = 0 AND EXISTS (SELECT 1 FROM roles WHERE roles.id = revisions.resource_id AND roles.org_id <> 0)", "role")
+	if res.Error != nil {
+		return fmt.Errorf("迁移角色配置版本失败: %w", res.Error)
+	}
+	if res.RowsAffected > 0 {
+		log.Printf("已将 %d 条角色配置版本归入角色所属组织", res.RowsAffected)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API Token 访问范围
+const (
+	ScopeAll           = "*" // 旧版令牌，未设置范围时视为全部权限
+	ScopeAgentsRead    = "agents:read"
+	ScopeAgentsWrite   = "agents:write"
+	ScopeDevicesRead   = "devices:read"
+	ScopeDevicesWrite  = "devices:write"
+	ScopeDevicesInject = "devices:inject"
+	ScopeHistoryRead   = "history:read"
+	ScopeMCPRead       = "mcp:read"
+	ScopeMCPCall       = "mcp:call"
+)
+
+// AllScopes 可分配给 API Token 的全部范围
+var AllScopes = []string{
+	ScopeAgentsRead, ScopeAgentsWrite,
+	ScopeDevicesRead, ScopeDevicesWrite, ScopeDevicesInject,
+	ScopeHistoryRead,
+	ScopeMCPRead, ScopeMCPCall,
+}
+
+// DefaultAPITokenRateLimit 未单独设置时每个 API Token 每分钟的请求上限
+const DefaultAPITokenRateLimit = 60
+
+// ValidScope 判断是否为合法的 API Token 范围
+func ValidScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APITokenRestriction 当前请求所用 API Token 的访问限制
+type APITokenRestriction struct {
+	Scopes      map[string]bool
+	AgentIDs    map[uint]bool   // 为空表示不限制
+	DeviceNames map[string]bool // 为空表示不限制
+}
+
+func newAPITokenRestriction(t *models.APIToken) *APITokenRestriction {
+	r := &APITokenRestriction{Scopes: make(map[string]bool)}
+	scopes := models.SplitList(t.Scopes)
+	if len(scopes) == 0 {
+		scopes = []string{ScopeAll}
+	}
+	for _, s := range scopes {
+		r.Scopes[s] = true
+	}
+	for _, s := range models.SplitList(t.AgentIDs) {
+		if id, err := strconv.ParseUint(s, 10, 64); err == nil {
+			if r.AgentIDs == nil {
+				r.AgentIDs = make(map[uint]bool)
+			}
+			r.AgentIDs[uint(id)] = true
+		}
+	}
+	for _, s := range models.SplitList(t.DeviceNames) {
+		if r.DeviceNames == nil {
+			r.DeviceNames = make(map[string]bool)
+		}
+		r.DeviceNames[s] = true
+	}
+	return r
+}
+
+// HasScope 判断是否拥有指定范围
+func (r *APITokenRestriction) HasScope(scope string) bool {
+	return r.Scopes[ScopeAll] || r.Scopes[scope]
+}
+
+// AllowsAgent 判断是否允许访问指定智能体
+func (r *APITokenRestriction) AllowsAgent(id uint) bool {
+	return r.AgentIDs == nil || r.AgentIDs[id]
+}
+
+// AllowsDevice 判断是否允许访问指定设备
+func (r *APITokenRestriction) AllowsDevice(deviceName string) bool {
+	return r.DeviceNames == nil || r.DeviceNames[deviceName]
+}
+
+// AgentIDList 返回智能体白名单，不限制时返回 nil
+func (r *APITokenRestriction) AgentIDList() []uint {
+	if r.AgentIDs == nil {
+		return nil
+	}
+	ids := make([]uint, 0, len(r.AgentIDs))
+	for id := range r.AgentIDs {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// DeviceNameList 返回设备白名单，不限制时返回 nil
+func (r *APITokenRestriction) DeviceNameList() []string {
+	if r.DeviceNames == nil {
+		return nil
+	}
+	names := make([]string, 0, len(r.DeviceNames))
+	for name := range r.DeviceNames {
+		names = append(names, name)
+	}
+	return names
+}
+
+// TokenRestriction 返回当前请求的 API Token 限制，JWT 请求返回 nil
+func TokenRestriction(c *gin.Context) *APITokenRestriction {
+	v, ok := c.Get("api_token_restriction")
+	if !ok {
+		return nil
+	}
+	r, _ := v.(*APITokenRestriction)
+	return r
+}
+
+// RequireScope 要求 API Token 拥有指定范围，JWT 请求不受限制
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if r := TokenRestriction(c); r != nil && !r.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API Token 缺少访问范围", "scope": scope})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RestrictAgentParam 校验路径参数中的智能体是否在 API Token 允许的范围内
+func RestrictAgentParam(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r := TokenRestriction(c)
+		if r == nil || r.AgentIDs == nil {
+			c.Next()
+			return
+		}
+		id, err := strconv.ParseUint(c.Param(param), 10, 64)
+		if err != nil || !r.AllowsAgent(uint(id)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API Token 无权访问该智能体"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ipAllowed 判断来源 IP 是否命中白名单，白名单为空时不限制；支持单个 IP 与 CIDR
+func ipAllowed(clientIP string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, item := range allowed {
+		if _, network, err := net.ParseCIDR(item); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if allowedIP := net.ParseIP(item); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateIPOrCIDR 校验 IP 或 CIDR 格式
+func ValidateIPOrCIDR(value string) bool {
+	if _, _, err := net.ParseCIDR(value); err == nil {
+		return true
+	}
+	return net.ParseIP(value) != nil
+}
+
+// tokenRateLimiter 按令牌的固定窗口限流（进程内，多实例部署时每个实例单独计数）
+type tokenRateLimiter struct {
+	mu      sync.Mutex
+	window  time.Duration
+	buckets map[uint]*rateBucket
+}
+
+type rateBucket struct {
+	start time.Time
+	count int
+}
+
+var apiTokenLimiter = newTokenRateLimiter(time.Minute)
+
+func newTokenRateLimiter(window time.Duration) *tokenRateLimiter {
+	return &tokenRateLimiter{window: window, buckets: make(map[uint]*rateBucket)}
+}
+
+// allow 记录一次请求，返回是否放行、窗口内剩余次数与窗口重置时间
+func (l *tokenRateLimiter) allow(tokenID uint, limit int, now time.Time) (bool, int, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[tokenID]
+	if !ok || now.Sub(b.start) >= l.window {
+		// 顺带清理过期窗口，避免吊销的令牌长期占用内存
+		if len(l.buckets) > 1024 {
+			for id, other := range l.buckets {
+				if now.Sub(other.start) >= l.window {
+					delete(l.buckets, id)
+				}
+			}
+		}
+		b = &rateBucket{start: now}
+		l.buckets[tokenID] = b
+	}
+	reset := b.start.Add(l.window)
+	if b.count >= limit {
+		return false, 0, reset
+	}
+	b.count++
+	return true, limit - b.count, reset
+}
@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIPAllowed(t *testing.T) {
+	allowed := []string{"10.0.0.0/8", "192.168.1.5", "2001:db8::/32"}
+	cases := map[string]bool{
+		"10.1.2.3":    true,
+		"192.168.1.5": true,
+		"192.168.1.6": false,
+		"2001:db8::1": true,
+		"not-an-ip":   false,
+	}
+	for ip, want := range cases {
+		if got := ipAllowed(ip, allowed); got != want {
+			t.Errorf("ipAllowed(%q) = %v, want %v", ip, got, want)
+		}
+	}
+	if !ipAllowed("8.8.8.8", nil) {
+		t.Fatal("empty allow list should not restrict")
+	}
+}
+
+func TestTokenRateLimiterWindow(t *testing.T) {
+	l := newTokenRateLimiter(time.Minute)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if ok, _, _ := l.allow(1, 3, now); !ok {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+	if ok, remaining, _ := l.allow(1, 3, now); ok || remaining != 0 {
+		t.Fatal("fourth request should be limited")
+	}
+	if ok, _, _ := l.allow(2, 3, now); !ok {
+		t.Fatal("limits should be per token")
+	}
+	if ok, _, _ := l.allow(1, 3, now.Add(time.Minute)); !ok {
+		t.Fatal("new window should reset the counter")
+	}
+}
+
+func TestOpenAPIAuthScopesAndLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newOrgTestDB(t)
+	if err := db.AutoMigrate(&models.APIToken{}); err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Username: "alice", Email: "alice@example.com", Password: "x"}
+	db.Create(&user)
+
+	const raw = "xzpat_scoped"
+	token := models.APIToken{
+		UserID:             user.ID,
+		Name:               "scoped",
+		TokenHash:          hashToken(raw),
+		IsActive:           true,
+		Scopes:             ScopeAgentsRead,
+		AgentIDs:           "7",
+		AllowedCIDRs:       "192.0.2.0/24",
+		RateLimitPerMinute: 2,
+	}
+	db.Create(&token)
+
+	router := gin.New()
+	router.Use(OpenAPIAuth(db))
+	router.GET("/agents/:id", RequireScope(ScopeAgentsRead), RestrictAgentParam("id"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.POST("/inject", RequireScope(ScopeDevicesInject), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	do := func(method, path, ip string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		req.Header.Set("X-API-Token", raw)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := do(http.MethodGet, "/agents/7", "203.0.113.1"); code != http.StatusForbidden {
+		t.Fatalf("expected ip allow list to reject, got %d", code)
+	}
+	if code := do(http.MethodGet, "/agents/7", "192.0.2.10"); code != http.StatusOK {
+		t.Fatalf("expected allowed agent, got %d", code)
+	}
+	if code := do(http.MethodGet, "/agents/8", "192.0.2.10"); code != http.StatusForbidden {
+		t.Fatalf("expected agent restriction, got %d", code)
+	}
+	if code := do(http.MethodPost, "/inject", "192.0.2.10"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected rate limit after 2 requests, got %d", code)
+	}
+
+	var saved models.APIToken
+	db.First(&saved, token.ID)
+	if saved.RequestCount != 2 || saved.RateLimitedCount != 1 || saved.DeniedCount != 1 || saved.LastUsedIP != "192.0.2.10" {
+		t.Fatalf("unexpected usage counters: %+v", saved)
+	}
+}
+
+func TestOpenAPIAuthIgnoresForgedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newOrgTestDB(t)
+	if err := db.AutoMigrate(&models.APIToken{}); err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Username: "bob", Email: "bob@example.com", Password: "x"}
+	db.Create(&user)
+	const raw = "xzpat_cidr"
+	db.Create(&models.APIToken{UserID: user.ID, Name: "cidr", TokenHash: hashToken(raw), IsActive: true, AllowedCIDRs: "192.0.2.0/24"})
+
+	do := func(router *gin.Engine, remoteIP, forwarded string) int {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.RemoteAddr = remoteIP + ":1234"
+		req.Header.Set("X-API-Token", raw)
+		req.Header.Set("X-Forwarded-For", forwarded)
+		req.Header.Set("X-Real-IP", forwarded)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	newRouter := func(proxies []string) *gin.Engine {
+		router := gin.New()
+		if err := SetTrustedProxies(router, proxies); err != nil {
+			t.Fatal(err)
+		}
+		router.Use(OpenAPIAuth(db))
+		router.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+		return router
+	}
+
+	direct := newRouter(nil)
+	if code := do(direct, "203.0.113.1", "192.0.2.10"); code != http.StatusForbidden {
+		t.Fatalf("forged X-Forwarded-For should be ignored without trusted proxies, got %d", code)
+	}
+	if code := do(direct, "192.0.2.10", "203.0.113.1"); code != http.StatusOK {
+		t.Fatalf("expected remote address to be used, got %d", code)
+	}
+
+	proxied := newRouter([]string{"10.0.0.0/8"})
+	if code := do(proxied, "10.0.0.2", "192.0.2.10"); code != http.StatusOK {
+		t.Fatalf("expected forwarded address from trusted proxy to be used, got %d", code)
+	}
+	if code := do(proxied, "203.0.113.1", "192.0.2.10"); code != http.StatusForbidden {
+		t.Fatalf("forwarded header from untrusted peer should be ignored, got %d", code)
+	}
+}
+
+func TestRequireScopeLegacyToken(t *testing.T) {
+	r := newAPITokenRestriction(&models.APIToken{})
+	if !r.HasScope(ScopeMCPCall) || !r.AllowsAgent(1) || !r.AllowsDevice("aa") {
+		t.Fatal("token without scopes should keep full access")
+	}
+}
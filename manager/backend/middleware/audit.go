@@ -0,0 +1,284 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"xiaozhi/manager/backend/services/audit"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	auditMaxRequestBody  = 1 << 20  // 超过 1MB 的请求体（上传等）只记录元信息
+	auditMaxResponseBody = 64 << 10 // 仅用于提取创建结果，超出部分不缓存
+)
+
+// auditResourceTables 路由资源到数据表的映射，命中时在处理前后各取一次快照计算 before/after
+var auditResourceTables = map[string]string{
+	"configs":                      "configs",
+	"vad-configs":                  "configs",
+	"asr-configs":                  "configs",
+	"llm-configs":                  "configs",
+	"tts-configs":                  "configs",
+	"speaker-configs":              "configs",
+	"vision-configs":               "configs",
+	"ota-configs":                  "configs",
+	"mqtt-configs":                 "configs",
+	"mqtt-server-configs":          "configs",
+	"udp-configs":                  "configs",
+	"mcp-configs":                  "configs",
+	"mcp-markets":                  "configs",
+	"memory-configs":               "configs",
+	"knowledge-search-configs":     "configs",
+	"mcp-market/imported-services": "mcp_market_services",
+	"global-roles":                 "global_roles",
+	"roles":                        "roles",
+	"roles/global":                 "roles",
+	"devices":                      "devices",
+	"agents":                       "agents",
+	"users":                        "users",
+	"users/knowledge-bases":        "knowledge_bases",
+	"knowledge-bases":              "knowledge_bases",
+	"api-tokens":                   "api_tokens",
+	"webhooks":                     "webhooks",
+	"orgs":                         "organizations",
+}
+
+// 路由前缀中仅表示访问范围的段，不计入资源类型
+var auditScopeSegments = map[string]bool{"admin": true, "user": true, "internal": true}
+
+// auditOpenAPIPrefix 外部 OpenAPI 路由前缀，与用户路由共用资源类型
+var auditOpenAPIPrefix = []string{"open", "v1"}
+
+// auditRoute 从路由模板解析出的资源信息
+type auditRoute struct {
+	ResourceType string
+	Action       string
+	ParamKey     string // 资源 ID 对应的路由参数名
+}
+
+// parseAuditRoute 将 /api/admin/configs/:id/toggle 解析为 资源=configs、动作=toggle、ID 参数=id
+func parseAuditRoute(method, fullPath string) auditRoute {
+	segs := strings.Split(strings.Trim(strings.TrimPrefix(fullPath, "/api"), "/"), "/")
+	if len(segs) > 0 && auditScopeSegments[segs[0]] {
+		segs = segs[1:]
+	} else if len(segs) >= len(auditOpenAPIPrefix) && segs[0] == auditOpenAPIPrefix[0] && segs[1] == auditOpenAPIPrefix[1] {
+		segs = segs[len(auditOpenAPIPrefix):]
+	}
+	lastParam := -1
+	for i, s := range segs {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			lastParam = i
+		}
+	}
+
+	var route auditRoute
+	var resource, actions []string
+	for i, s := range segs {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			continue
+		}
+		if lastParam >= 0 && i > lastParam {
+			actions = append(actions, s)
+		} else {
+			resource = append(resource, s)
+		}
+	}
+	if lastParam >= 0 {
+		route.ParamKey = segs[lastParam][1:]
+	}
+	route.ResourceType = strings.Join(resource, "/")
+	if len(actions) > 0 {
+		route.Action = strings.Join(actions, "/")
+		return route
+	}
+	switch method {
+	case http.MethodPost:
+		route.Action = audit.ActionCreate
+	case http.MethodDelete:
+		route.Action = audit.ActionDelete
+	default:
+		route.Action = audit.ActionUpdate
+	}
+	return route
+}
+
+// auditResponseWriter 旁路缓存响应体，用于提取创建接口返回的资源
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditResponseWriter) Write(data []byte) (int, error) {
+	if w.body.Len() < auditMaxResponseBody {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *auditResponseWriter) WriteString(s string) (int, error) {
+	if w.body.Len() < auditMaxResponseBody {
+		w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// AuditTrail 自动为写操作（POST/PUT/PATCH/DELETE）记录审计日志，读请求直接放行。
+// 需挂在 JWTAuth / OpenAPIAuth 之后以获取操作者，组织上下文在处理完成后读取，因此可挂在 OrgContext 之前
+func AuditTrail(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		if db == nil || method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions || c.FullPath() == "" {
+			c.Next()
+			return
+		}
+
+		route := parseAuditRoute(method, c.FullPath())
+		resourceID := ""
+		if route.ParamKey != "" {
+			resourceID = c.Param(route.ParamKey)
+		}
+		requestBody := readAuditRequestBody(c)
+
+		table := auditResourceTables[route.ResourceType]
+		var before map[string]interface{}
+		if table != "" && resourceID != "" {
+			before = auditSnapshot(db, table, route.ParamKey, resourceID)
+		}
+
+		writer := &auditResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		status := writer.Status()
+		var after interface{}
+		switch {
+		case status >= http.StatusBadRequest:
+			after = requestBody
+		case table != "" && resourceID != "" && route.Action != audit.ActionDelete:
+			if snap := auditSnapshot(db, table, route.ParamKey, resourceID); snap != nil {
+				after = snap
+			} else {
+				after = requestBody
+			}
+		case route.Action == audit.ActionCreate:
+			if data := auditResponseData(writer.body.Bytes()); data != nil {
+				after = data
+				if resourceID == "" {
+					resourceID = auditResourceIDFromData(data)
+				}
+			} else {
+				after = requestBody
+			}
+		case route.Action != audit.ActionDelete:
+			after = requestBody
+		}
+
+		entry := audit.Entry{
+			OrgID:        auditOrgID(c, before),
+			Action:       route.Action,
+			ResourceType: route.ResourceType,
+			ResourceID:   resourceID,
+			Method:       method,
+			Path:         c.Request.URL.Path,
+			StatusCode:   status,
+			After:        after,
+			IP:           c.ClientIP(),
+			UserAgent:    c.Request.UserAgent(),
+		}
+		if before != nil {
+			entry.Before = before
+		}
+		if tokenID, ok := c.Get("api_token_id"); ok {
+			// API Token 请求以令牌为操作者，便于追溯到具体令牌并吊销
+			entry.ActorID, _ = tokenID.(uint)
+			entry.ActorName = fmt.Sprintf("api_token:%d/%s", entry.ActorID, c.GetString("username"))
+			entry.ActorRole = audit.ActorRoleAPIToken
+		} else if v, ok := c.Get("user_id"); ok {
+			entry.ActorID, _ = v.(uint)
+			entry.ActorName = c.GetString("username")
+			entry.ActorRole = c.GetString("role")
+		} else {
+			entry.ActorName = audit.ActorRoleSystem
+			entry.ActorRole = audit.ActorRoleSystem
+		}
+		audit.Record(db, entry)
+	}
+}
+
+// readAuditRequestBody 读取并回填请求体；非 JSON 或过大的请求只记录内容类型与长度
+func readAuditRequestBody(c *gin.Context) interface{} {
+	if c.Request.Body == nil || c.Request.ContentLength == 0 {
+		return nil
+	}
+	contentType := c.ContentType()
+	if contentType != gin.MIMEJSON || c.Request.ContentLength > auditMaxRequestBody {
+		return map[string]interface{}{"content_type": contentType, "content_length": c.Request.ContentLength}
+	}
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, auditMaxRequestBody+1))
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), c.Request.Body))
+	if err != nil || len(data) > auditMaxRequestBody {
+		return map[string]interface{}{"content_type": contentType, "content_length": len(data)}
+	}
+	var body interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil
+	}
+	return body
+}
+
+// auditSnapshot 读取资源当前的整行数据，设备类内部接口以 device_name 定位
+func auditSnapshot(db *gorm.DB, table, paramKey, resourceID string) map[string]interface{} {
+	column := "id"
+	if paramKey == "device_name" {
+		column = "device_name"
+	}
+	row := make(map[string]interface{})
+	if err := db.Table(table).Where(column+" = ?", resourceID).Take(&row).Error; err != nil {
+		return nil
+	}
+	return row
+}
+
+// auditResponseData 提取 {"data": {...}} 响应中的资源对象
+func auditResponseData(body []byte) map[string]interface{} {
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if len(body) == 0 || json.Unmarshal(body, &resp) != nil {
+		return nil
+	}
+	return resp.Data
+}
+
+func auditResourceIDFromData(data map[string]interface{}) string {
+	if id, ok := data["id"]; ok && id != nil {
+		return fmt.Sprint(id)
+	}
+	return ""
+}
+
+// auditOrgID 优先取请求的组织上下文，否则取资源自身的 org_id（管理员接口不经过 OrgContext）
+func auditOrgID(c *gin.Context, before map[string]interface{}) uint {
+	if id, ok := c.Get("org_id"); ok {
+		if orgID, _ := id.(uint); orgID != 0 {
+			return orgID
+		}
+	}
+	if before != nil {
+		switch v := before["org_id"].(type) {
+		case int64:
+			return uint(v)
+		case uint64:
+			return uint(v)
+		case float64:
+			return uint(v)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseAuditRoute(t *testing.T) {
+	cases := []struct {
+		method, path string
+		want         auditRoute
+	}{
+		{http.MethodPut, "/api/admin/configs/:id", auditRoute{"configs", "update", "id"}},
+		{http.MethodPost, "/api/admin/configs/:id/toggle", auditRoute{"configs", "toggle", "id"}},
+		{http.MethodPost, "/api/admin/llm-configs", auditRoute{"llm-configs", "create", ""}},
+		{http.MethodDelete, "/api/admin/users/:id/knowledge-bases/:kb_id", auditRoute{"users/knowledge-bases", "delete", "kb_id"}},
+		{http.MethodPatch, "/api/admin/roles/global/:id/default", auditRoute{"roles/global", "default", "id"}},
+		{http.MethodPost, "/api/internal/devices/:device_name/switch-role", auditRoute{"devices", "switch-role", "device_name"}},
+		{http.MethodPut, "/api/orgs/:org_id/members/:user_id", auditRoute{"orgs/members", "update", "user_id"}},
+		{http.MethodPut, "/api/open/v1/agents/:id", auditRoute{"agents", "update", "id"}},
+		{http.MethodPost, "/api/open/v1/agents/:id/mcp-call", auditRoute{"agents", "mcp-call", "id"}},
+	}
+	for _, tc := range cases {
+		if got := parseAuditRoute(tc.method, tc.path); got != tc.want {
+			t.Errorf("parseAuditRoute(%s %s) = %+v, want %+v", tc.method, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestAuditTrailRecordsRedactedDiff(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newOrgTestDB(t)
+	if err := db.AutoMigrate(&models.Config{}, &models.Device{}, &models.AuditLog{}); err != nil {
+		t.Fatal(err)
+	}
+	cfg := models.Config{Type: "llm", Name: "qwen", ConfigID: "qwen", JsonData: `{"api_key":"sk-old","model":"qwen-plus"}`}
+	db.Create(&cfg)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", uint(1))
+		c.Set("username", "admin")
+		c.Set("role", "admin")
+	}, AuditTrail(db))
+	router.PUT("/api/admin/llm-configs/:id", func(c *gin.Context) {
+		var req struct {
+			JsonData string `json:"json_data"`
+		}
+		c.ShouldBindJSON(&req)
+		db.Model(&models.Config{}).Where("id = ?", c.Param("id")).Update("json_data", req.JsonData)
+		c.JSON(http.StatusOK, gin.H{"message": "ok"})
+	})
+	router.POST("/api/admin/devices", func(c *gin.Context) {
+		device := models.Device{UserID: 1, OrgID: 3, DeviceCode: "123456", DeviceName: "aa:bb", PreSecretKey: "psk"}
+		db.Create(&device)
+		c.JSON(http.StatusCreated, gin.H{"data": device})
+	})
+	router.GET("/api/admin/devices", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	body := `{"json_data":"{\"api_key\":\"sk-new\",\"model\":\"qwen-max\"}"}`
+	req := httptest.NewRequest(http.MethodPut, "/api/admin/llm-configs/1", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/admin/devices", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/admin/devices", nil))
+
+	var logs []models.AuditLog
+	db.Order("id").Find(&logs)
+	if len(logs) != 2 {
+		t.Fatalf("expected 2 audit logs (reads are skipped), got %d", len(logs))
+	}
+
+	update := logs[0]
+	if update.ActorName != "admin" || update.Action != "update" || update.ResourceType != "llm-configs" || update.ResourceID != "1" {
+		t.Fatalf("unexpected update log: %+v", update)
+	}
+	for _, field := range []string{update.Before, update.After, update.Diff} {
+		if strings.Contains(field, "sk-old") || strings.Contains(field, "sk-new") {
+			t.Fatalf("secret leaked into audit log: %s", field)
+		}
+	}
+	var diff map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(update.Diff), &diff); err != nil {
+		t.Fatalf("invalid diff %q: %v", update.Diff, err)
+	}
+	change, ok := diff["json_data"]
+	if !ok || !strings.Contains(change["before"].(string), "qwen-plus") || !strings.Contains(change["after"].(string), "qwen-max") {
+		t.Fatalf("expected json_data change in diff, got %s", update.Diff)
+	}
+
+	create := logs[1]
+	if create.Action != "create" || create.ResourceID != "1" {
+		t.Fatalf("unexpected create log: %+v", create)
+	}
+	if strings.Contains(create.After, "psk") {
+		t.Fatalf("pre_secret_key leaked: %s", create.After)
+	}
+
+	if err := db.Model(&update).Update("action", "tampered").Error; err == nil {
+		t.Fatal("audit log should be immutable")
+	}
+	if err := db.Delete(&update).Error; err == nil {
+		t.Fatal("audit log should not be deletable")
+	}
+}
+
+func TestAuditTrailRecordsAPITokenActor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newOrgTestDB(t)
+	if err := db.AutoMigrate(&models.APIToken{}, &models.AuditLog{}); err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Username: "carol", Email: "carol@example.com", Password: "x"}
+	db.Create(&user)
+	const raw = "xzpat_audit"
+	token := models.APIToken{UserID: user.ID, Name: "ci", TokenHash: hashToken(raw), IsActive: true}
+	db.Create(&token)
+
+	router := gin.New()
+	router.Use(OpenAPIAuth(db), AuditTrail(db))
+	router.POST("/api/open/v1/devices/inject-message", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodPost, "/api/open/v1/devices/inject-message", strings.NewReader(`{"message":"hi"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Token", raw)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	var logs []models.AuditLog
+	db.Find(&logs)
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 audit log, got %d", len(logs))
+	}
+	got := logs[0]
+	if got.ActorID != token.ID || got.ActorRole != "api_token" || got.ActorName != "api_token:1/carol" || got.ResourceType != "devices/inject-message" {
+		t.Fatalf("unexpected api token audit log: %+v", got)
+	}
+}
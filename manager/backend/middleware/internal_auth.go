@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InternalSecretHeader 主程序调用敏感内部服务接口时携带的共享密钥请求头
+const InternalSecretHeader = "X-Internal-Secret"
+
+// InternalAuth 保护返回敏感数据的内部服务接口（如 MCP OAuth 访问令牌）。
+// 配置了 secret 时要求请求头 X-Internal-Secret 与之一致；未配置时只允许回环地址直连，
+// 此时使用连接来源地址而非 ClientIP，避免经反向代理转发的外部请求被当作本机请求
+func InternalAuth(secret string) gin.HandlerFunc {
+	secret = strings.TrimSpace(secret)
+	return func(c *gin.Context) {
+		if secret != "" {
+			got := c.GetHeader(InternalSecretHeader)
+			if subtle.ConstantTimeCompare([]byte(got), []byte(secret)) != 1 {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "内部服务密钥无效"})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+		host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+		if err != nil {
+			host = c.Request.RemoteAddr
+		}
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "未配置内部服务密钥时仅允许本机访问"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
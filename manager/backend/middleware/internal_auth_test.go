@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestInternalAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newRouter := func(secret string) *gin.Engine {
+		r := gin.New()
+		r.GET("/internal", InternalAuth(secret), func(c *gin.Context) { c.Status(http.StatusOK) })
+		return r
+	}
+	do := func(r *gin.Engine, remoteAddr, secret, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/internal", nil)
+		req.RemoteAddr = remoteAddr
+		if secret != "" {
+			req.Header.Set(InternalSecretHeader, secret)
+		}
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 未配置密钥：仅回环地址可访问，转发头不影响判断
+	open := newRouter("")
+	if code := do(open, "127.0.0.1:5000", "", ""); code != http.StatusOK {
+		t.Fatalf("loopback status=%d", code)
+	}
+	if code := do(open, "[::1]:5000", "", ""); code != http.StatusOK {
+		t.Fatalf("ipv6 loopback status=%d", code)
+	}
+	if code := do(open, "10.0.0.8:5000", "", "127.0.0.1"); code != http.StatusForbidden {
+		t.Fatalf("remote status=%d, want 403", code)
+	}
+
+	// 配置密钥：必须携带正确的请求头，回环地址也不例外
+	guarded := newRouter("s3cret")
+	if code := do(guarded, "10.0.0.8:5000", "s3cret", ""); code != http.StatusOK {
+		t.Fatalf("valid secret status=%d", code)
+	}
+	if code := do(guarded, "127.0.0.1:5000", "", ""); code != http.StatusUnauthorized {
+		t.Fatalf("missing secret status=%d, want 401", code)
+	}
+	if code := do(guarded, "10.0.0.8:5000", "wrong", ""); code != http.StatusUnauthorized {
+		t.Fatalf("wrong secret status=%d, want 401", code)
+	}
+}
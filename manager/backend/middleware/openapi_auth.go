@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 	"xiaozhi/manager/backend/models"
@@ -12,6 +13,19 @@ import (
 	"gorm.io/gorm"
 )
 
+// SetTrustedProxies 设置可信反向代理，c.ClientIP() 仅在请求来自这些地址时采信转发头。
+// proxies 为空或配置无效时不信任任何代理，ClientIP 等于连接来源地址
+func SetTrustedProxies(r *gin.Engine, proxies []string) error {
+	if len(proxies) == 0 {
+		return r.SetTrustedProxies(nil)
+	}
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		_ = r.SetTrustedProxies(nil)
+		return err
+	}
+	return nil
+}
+
 func hashToken(raw string) string {
 	sum := sha256.Sum256([]byte(raw))
 	return hex.EncodeToString(sum[:])
@@ -21,6 +35,7 @@ func hashToken(raw string) string {
 // API Token 支持两种请求头：
 // 1) Authorization: Bearer <token>
 // 2) X-API-Token: <token>
+// API Token 请求还会校验来源 IP 白名单并按令牌限流，访问范围由 RequireScope 在各路由上校验。
 func OpenAPIAuth(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if db == nil {
@@ -75,13 +90,44 @@ func OpenAPIAuth(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		db.Model(&apiToken).Updates(map[string]interface{}{"last_used_at": now})
+		// 依赖 SetTrustedProxies：未配置可信代理时 ClientIP 不会采信客户端伪造的 X-Forwarded-For
+		clientIP := c.ClientIP()
+		if !ipAllowed(clientIP, models.SplitList(apiToken.AllowedCIDRs)) {
+			db.Model(&apiToken).UpdateColumn("denied_count", gorm.Expr("denied_count + ?", 1))
+			c.JSON(http.StatusForbidden, gin.H{"error": "来源IP不在API Token允许范围内"})
+			c.Abort()
+			return
+		}
+
+		limit := apiToken.RateLimitPerMinute
+		if limit <= 0 {
+			limit = DefaultAPITokenRateLimit
+		}
+		allowed, remaining, reset := apiTokenLimiter.allow(apiToken.ID, limit, now)
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		if !allowed {
+			db.Model(&apiToken).UpdateColumn("rate_limited_count", gorm.Expr("rate_limited_count + ?", 1))
+			c.Header("Retry-After", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "API Token请求过于频繁，请稍后再试"})
+			c.Abort()
+			return
+		}
+
+		db.Model(&apiToken).UpdateColumns(map[string]interface{}{
+			"last_used_at":  now,
+			"last_used_ip":  clientIP,
+			"request_count": gorm.Expr("request_count + ?", 1),
+		})
 
 		c.Set("user_id", user.ID)
 		c.Set("username", user.Username)
 		c.Set("role", user.Role)
 		c.Set("auth_type", "api_token")
 		c.Set("api_token_id", apiToken.ID)
+		c.Set("api_token_org_id", apiToken.OrgID)
+		c.Set("api_token_restriction", newAPITokenRestriction(&apiToken))
 		c.Next()
 	}
 }
@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// HeaderOrgID 指定当前操作的组织，未指定时使用个人组织
+const HeaderOrgID = "X-Org-ID"
+
+// 组织内资源权限
+const (
+	PermAgentRead      = "agent:read"
+	PermAgentWrite     = "agent:write"
+	PermAgentOperate   = "agent:operate" // MCP 调用、OpenClaw 对话测试
+	PermDeviceRead     = "device:read"
+	PermDeviceWrite    = "device:write"
+	PermDeviceOperate  = "device:operate" // 消息注入、MCP 调用、切换角色
+	PermKnowledgeRead  = "knowledge:read"
+	PermKnowledgeWrite = "knowledge:write"
+	PermSpeakerRead    = "speaker:read"
+	PermSpeakerWrite   = "speaker:write"
+	PermHistoryRead    = "history:read"
+	PermHistoryDelete  = "history:delete"
+	PermMemberRead     = "member:read"
+	PermMemberManage   = "member:manage" // 邀请、移除成员，修改成员角色
+	PermOrgManage      = "org:manage"    // 修改、删除组织
+	PermWebhookRead    = "webhook:read"
+	PermWebhookWrite   = "webhook:write" // 管理订阅、发送测试事件、重新投递
+	PermRoleRead       = "role:read"
+	PermRoleWrite      = "role:write" // 角色增删改、启停与版本回滚
+	PermVoiceRead      = "voice:read"
+	PermVoiceWrite     = "voice:write" // 声音复刻、追加音频、重试
+	PermAPITokenRead   = "api_token:read"
+	PermAPITokenWrite  = "api_token:write" // 创建、修改、吊销组织内的 API Token
+)
+
+// allPermissions 全部权限（有序，用于返回给前端）
+var allPermissions = []string{
+	PermAgentRead, PermAgentWrite, PermAgentOperate,
+	PermDeviceRead, PermDeviceWrite, PermDeviceOperate,
+	PermKnowledgeRead, PermKnowledgeWrite,
+	PermSpeakerRead, PermSpeakerWrite,
+	PermHistoryRead, PermHistoryDelete,
+	PermMemberRead, PermMemberManage, PermOrgManage,
+	PermWebhookRead, PermWebhookWrite,
+	PermRoleRead, PermRoleWrite,
+	PermVoiceRead, PermVoiceWrite,
+	PermAPITokenRead, PermAPITokenWrite,
+}
+
+var readPermissions = []string{
+	PermAgentRead, PermDeviceRead, PermKnowledgeRead, PermSpeakerRead, PermHistoryRead, PermMemberRead, PermWebhookRead,
+	PermRoleRead, PermVoiceRead, PermAPITokenRead,
+}
+
+var editPermissions = []string{
+	PermAgentWrite, PermAgentOperate, PermDeviceWrite, PermDeviceOperate, PermKnowledgeWrite, PermSpeakerWrite, PermHistoryDelete,
+	PermWebhookWrite, PermRoleWrite, PermVoiceWrite, PermAPITokenWrite,
+}
+
+var rolePermissions = map[string]map[string]bool{
+	models.OrgRoleOwner:    permissionSet(readPermissions, editPermissions, []string{PermMemberManage, PermOrgManage}),
+	models.OrgRoleEditor:   permissionSet(readPermissions, editPermissions),
+	models.OrgRoleOperator: permissionSet(readPermissions, []string{PermAgentOperate, PermDeviceOperate}),
+	models.OrgRoleViewer:   permissionSet(readPermissions),
+}
+
+func permissionSet(groups ...[]string) map[string]bool {
+	set := make(map[string]bool)
+	for _, group := range groups {
+		for _, p := range group {
+			set[p] = true
+		}
+	}
+	return set
+}
+
+// HasPermission 判断组织角色是否拥有指定权限
+func HasPermission(orgRole, perm string) bool {
+	return rolePermissions[orgRole][perm]
+}
+
+// RolePermissions 返回组织角色拥有的全部权限
+func RolePermissions(orgRole string) []string {
+	perms := make([]string, 0, len(rolePermissions[orgRole]))
+	for _, p := range allPermissions {
+		if HasPermission(orgRole, p) {
+			perms = append(perms, p)
+		}
+	}
+	return perms
+}
+
+// OrgContext 解析当前组织并校验成员身份，写入 org_id / org_role。
+// 组织来源优先级：API Token 绑定的组织 > 路径参数 :org_id > X-Org-ID 请求头 > org_id 查询参数 > 个人组织。
+// 系统管理员可以进入任意组织，按所有者权限处理。
+func OrgContext(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "数据库不可用"})
+			c.Abort()
+			return
+		}
+		userID, _ := c.Get("user_id")
+		uid, _ := userID.(uint)
+		if uid == 0 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+			c.Abort()
+			return
+		}
+
+		requested := strings.TrimSpace(c.Param("org_id"))
+		if requested == "" {
+			requested = strings.TrimSpace(c.GetHeader(HeaderOrgID))
+		}
+		if requested == "" {
+			requested = strings.TrimSpace(c.Query("org_id"))
+		}
+		var orgID uint
+		if requested != "" {
+			id, err := strconv.ParseUint(requested, 10, 64)
+			if err != nil || id == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "无效的组织ID"})
+				c.Abort()
+				return
+			}
+			orgID = uint(id)
+		}
+		if tokenOrg, ok := c.Get("api_token_org_id"); ok {
+			if id, _ := tokenOrg.(uint); id != 0 {
+				if orgID != 0 && orgID != id {
+					c.JSON(http.StatusForbidden, gin.H{"error": "API Token 无权访问该组织"})
+					c.Abort()
+					return
+				}
+				orgID = id
+			}
+		}
+		if orgID == 0 {
+			id, err := models.PersonalOrganizationID(db, uid)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "获取个人组织失败"})
+				c.Abort()
+				return
+			}
+			orgID = id
+		}
+
+		var member models.OrganizationMember
+		orgRole := ""
+		if err := db.Where("org_id = ? AND user_id = ?", orgID, uid).First(&member).Error; err == nil {
+			orgRole = member.Role
+		} else if role, _ := c.Get("role"); role == "admin" {
+			var count int64
+			db.Model(&models.Organization{}).Where("id = ?", orgID).Count(&count)
+			if count > 0 {
+				orgRole = models.OrgRoleOwner
+			}
+		}
+		if orgRole == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "不是该组织成员"})
+			c.Abort()
+			return
+		}
+
+		c.Set("org_id", orgID)
+		c.Set("org_role", orgRole)
+		c.Next()
+	}
+}
+
+// RequirePermission 要求当前组织角色拥有指定权限，需在 OrgContext 之后使用
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgRole := c.GetString("org_role")
+		if !HasPermission(orgRole, perm) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "当前组织角色无权执行该操作", "permission": perm, "org_role": orgRole})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
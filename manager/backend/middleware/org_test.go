@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"xiaozhi/manager/backend/database/dbtest"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func TestRolePermissionMatrix(t *testing.T) {
+	tests := []struct {
+		role    string
+		perm    string
+		allowed bool
+	}{
+		{models.OrgRoleOwner, PermOrgManage, true},
+		{models.OrgRoleOwner, PermMemberManage, true},
+		{models.OrgRoleEditor, PermAgentWrite, true},
+		{models.OrgRoleEditor, PermMemberManage, false},
+		{models.OrgRoleOperator, PermDeviceOperate, true},
+		{models.OrgRoleOperator, PermAgentOperate, true},
+		{models.OrgRoleOperator, PermAgentWrite, false},
+		{models.OrgRoleOperator, PermHistoryDelete, false},
+		{models.OrgRoleViewer, PermKnowledgeRead, true},
+		{models.OrgRoleViewer, PermDeviceOperate, false},
+		{models.OrgRoleEditor, PermRoleWrite, true},
+		{models.OrgRoleEditor, PermAPITokenWrite, true},
+		{models.OrgRoleOperator, PermVoiceWrite, false},
+		{models.OrgRoleViewer, PermRoleRead, true},
+		{models.OrgRoleViewer, PermAPITokenWrite, false},
+		{"", PermAgentRead, false},
+	}
+	for _, tt := range tests {
+		if got := HasPermission(tt.role, tt.perm); got != tt.allowed {
+			t.Errorf("HasPermission(%q, %q) = %v, want %v", tt.role, tt.perm, got, tt.allowed)
+		}
+	}
+	if got := len(RolePermissions(models.OrgRoleOwner)); got != len(allPermissions) {
+		t.Fatalf("owner should have all %d permissions, got %d", len(allPermissions), got)
+	}
+}
+
+func newOrgTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return dbtest.Open(t, &models.User{}, &models.Organization{}, &models.OrganizationMember{}, &models.Agent{})
+}
+
+func TestOrgContextResolvesMembership(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newOrgTestDB(t)
+
+	alice := models.User{Username: "alice", Email: "alice@example.com", Password: "x"}
+	bob := models.User{Username: "bob", Email: "bob@example.com", Password: "x"}
+	db.Create(&alice)
+	db.Create(&bob)
+	alicePersonal, err := models.PersonalOrganizationID(db, alice.ID)
+	if err != nil || alicePersonal == 0 {
+		t.Fatalf("expected personal org to be created with user, got %d err=%v", alicePersonal, err)
+	}
+
+	team := models.Organization{Name: "team", OwnerID: alice.ID}
+	db.Create(&team)
+	db.Create(&models.OrganizationMember{OrgID: team.ID, UserID: alice.ID, Role: models.OrgRoleOwner})
+	db.Create(&models.OrganizationMember{OrgID: team.ID, UserID: bob.ID, Role: models.OrgRoleViewer})
+
+	// 未指定组织的资源自动归入创建者的个人组织
+	agent := models.Agent{UserID: alice.ID, Name: "a"}
+	if err := db.Create(&agent).Error; err != nil {
+		t.Fatal(err)
+	}
+	if agent.OrgID != alicePersonal {
+		t.Fatalf("expected agent in personal org %d, got %d", alicePersonal, agent.OrgID)
+	}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.GetHeader("X-User"))
+		c.Set("user_id", uint(id))
+		c.Set("role", c.GetHeader("X-Role"))
+	}, OrgContext(db))
+	router.GET("/read", RequirePermission(PermAgentRead), func(c *gin.Context) {
+		c.String(http.StatusOK, "%d:%s", c.GetUint("org_id"), c.GetString("org_role"))
+	})
+	router.GET("/write", RequirePermission(PermAgentWrite), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	do := func(path string, user uint, org uint, role string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-User", strconv.Itoa(int(user)))
+		req.Header.Set("X-Role", role)
+		if org != 0 {
+			req.Header.Set(HeaderOrgID, strconv.Itoa(int(org)))
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("/read", alice.ID, 0, "user"); w.Code != http.StatusOK || w.Body.String() != strconv.Itoa(int(alicePersonal))+":owner" {
+		t.Fatalf("expected personal org by default, got %d %s", w.Code, w.Body.String())
+	}
+	if w := do("/read", bob.ID, team.ID, "user"); w.Code != http.StatusOK {
+		t.Fatalf("viewer should read team resources, got %d", w.Code)
+	}
+	if w := do("/write", bob.ID, team.ID, "user"); w.Code != http.StatusForbidden {
+		t.Fatalf("viewer should not write, got %d", w.Code)
+	}
+	if w := do("/read", bob.ID, alicePersonal, "user"); w.Code != http.StatusForbidden {
+		t.Fatalf("non-member should be rejected, got %d", w.Code)
+	}
+	if w := do("/write", bob.ID, alicePersonal, "admin"); w.Code != http.StatusOK {
+		t.Fatalf("system admin should act as owner, got %d", w.Code)
+	}
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrAuditLogImmutable 审计日志只允许追加，禁止修改与删除
+var ErrAuditLogImmutable = errors.New("审计日志不可修改或删除")
+
+// AuditLog 审计日志：记录谁在什么时候对哪个资源做了什么，before/after 中的密钥已脱敏
+type AuditLog struct {
+	ID           uint      `json:"id" gorm:"primarykey"`
+	OrgID        uint      `json:"org_id" gorm:"not null;default:0;index"`
+	ActorID      uint      `json:"actor_id" gorm:"not null;default:0;index"`              // 用户 ID，API Token 请求为令牌 ID；0 表示系统或设备
+	ActorName    string    `json:"actor_name" gorm:"type:varchar(100);index"`             // 用户名、system、device:<设备名> 或 api_token:<令牌ID>/<用户名>
+	ActorRole    string    `json:"actor_role" gorm:"type:varchar(20)"`                    // admin/user/system/device/api_token
+	Action       string    `json:"action" gorm:"type:varchar(50);not null;index"`         // create/update/delete/toggle/activate ...
+	ResourceType string    `json:"resource_type" gorm:"type:varchar(100);not null;index"` // 如 configs、devices、users/knowledge-bases
+	ResourceID   string    `json:"resource_id" gorm:"type:varchar(100);index"`
+	Method       string    `json:"method" gorm:"type:varchar(10)"`
+	Path         string    `json:"path" gorm:"type:varchar(500)"`
+	StatusCode   int       `json:"status_code"`
+	Before       string    `json:"before" gorm:"type:text"` // 变更前快照（JSON）
+	After        string    `json:"after" gorm:"type:text"`  // 变更后快照或请求体（JSON）
+	Diff         string    `json:"diff" gorm:"type:text"`   // 字段级差异 {"field":{"before":..,"after":..}}
+	IP           string    `json:"ip" gorm:"type:varchar(64)"`
+	UserAgent    string    `json:"user_agent" gorm:"type:varchar(500)"`
+	CreatedAt    time.Time `json:"created_at" gorm:"index"`
+}
+
+func (AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+func (AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
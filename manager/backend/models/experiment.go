@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// 实验状态
+const (
+	ExperimentStatusDraft   = "draft"
+	ExperimentStatusRunning = "running"
+	ExperimentStatusStopped = "stopped"
+)
+
+// Experiment 智能体 A/B 实验：按设备哈希把流量分到各分组，分组覆盖智能体的提示词、LLM、TTS 配置
+type Experiment struct {
+	ID          uint                `json:"id" gorm:"primarykey"`
+	OrgID       uint                `json:"org_id" gorm:"not null;index"`
+	UserID      uint                `json:"user_id" gorm:"not null;index"` // 创建者
+	AgentID     uint                `json:"agent_id" gorm:"not null;index"`
+	Name        string              `json:"name" gorm:"type:varchar(100);not null"`
+	Description string              `json:"description" gorm:"type:varchar(500)"`
+	Status      string              `json:"status" gorm:"type:varchar(20);not null;index"` // draft/running/stopped
+	StartedAt   *time.Time          `json:"started_at"`
+	StoppedAt   *time.Time          `json:"stopped_at"`
+	Variants    []ExperimentVariant `json:"variants" gorm:"foreignKey:ExperimentID"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+// ExperimentVariant 实验分组，覆盖字段为空时沿用智能体配置（对照组可全部留空）
+type ExperimentVariant struct {
+	ID           uint    `json:"id" gorm:"primarykey"`
+	ExperimentID uint    `json:"experiment_id" gorm:"not null;index"`
+	Key          string  `json:"key" gorm:"type:varchar(32);not null"` // 分组标识，写入指标与聊天记录
+	Name         string  `json:"name" gorm:"type:varchar(100)"`
+	Weight       int     `json:"weight" gorm:"not null;default:0"` // 流量权重，按各组权重之和分配
+	Prompt       *string `json:"prompt" gorm:"type:text"`
+	LLMConfigID  *string `json:"llm_config_id" gorm:"type:varchar(100)"`
+	TTSConfigID  *string `json:"tts_config_id" gorm:"type:varchar(100)"`
+	Voice        *string `json:"voice" gorm:"type:varchar(200)"`
+}
+
+// ExperimentTurn 主程序上报的单轮对话结果，用于按分组汇总实验指标
+type ExperimentTurn struct {
+	ID              uint      `json:"id" gorm:"primarykey"`
+	ExperimentID    uint      `json:"experiment_id" gorm:"not null;index:idx_experiment_turns_variant,priority:1"`
+	Variant         string    `json:"variant" gorm:"type:varchar(32);not null;index:idx_experiment_turns_variant,priority:2"`
+	DeviceID        string    `json:"device_id" gorm:"type:varchar(100)"`
+	SessionID       string    `json:"session_id" gorm:"type:varchar(100)"`
+	TurnLatencyMs   int64     `json:"turn_latency_ms" gorm:"not null;default:0"`
+	AsrFirstTextMs  int64     `json:"asr_first_text_ms" gorm:"not null;default:0"`
+	LlmFirstTokenMs int64     `json:"llm_first_token_ms" gorm:"not null;default:0"`
+	TtsFirstFrameMs int64     `json:"tts_first_frame_ms" gorm:"not null;default:0"`
+	Interrupted     bool      `json:"interrupted" gorm:"not null;default:false"`
+	ErrorMessage    string    `json:"error_message" gorm:"type:varchar(500)"` // 为空表示成功；打断不计为失败
+	CreatedAt       time.Time `json:"created_at" gorm:"index"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// 成员关系的维护来源
+const MemberManagedBySSO = "sso"
+
+// UserIdentity 用户在外部身份提供方（OIDC/LDAP）的身份，用于单点登录时关联本地用户
+type UserIdentity struct {
+	ID          uint       `json:"id" gorm:"primarykey"`
+	UserID      uint       `json:"user_id" gorm:"not null;index"`
+	Provider    string     `json:"provider" gorm:"type:varchar(100);not null;uniqueIndex:idx_user_identities_provider_subject,priority:1"` // oidc:<name> 或 ldap
+	Subject     string     `json:"subject" gorm:"type:varchar(255);not null;uniqueIndex:idx_user_identities_provider_subject,priority:2"`  // OIDC sub 或 LDAP DN
+	Email       string     `json:"email" gorm:"type:varchar(100)"`
+	Groups      string     `json:"groups" gorm:"type:text"` // 最近一次登录时的分组，逗号分隔
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// MCPOAuthToken 全局 MCP 服务器的 OAuth 授权状态，按服务器名称一一对应。
+// 客户端密钥与令牌使用 MCP_MARKET_SECRET_KEY 加密存储，不通过 JSON 输出
+type MCPOAuthToken struct {
+	ID         uint   `json:"id" gorm:"primarykey"`
+	ServerName string `json:"server_name" gorm:"type:varchar(150);not null;uniqueIndex"`
+	ServerURL  string `json:"server_url" gorm:"type:text;not null"`
+	Status     string `json:"status" gorm:"type:varchar(32);not null;index"` // pending / authorized / reauth_required
+
+	// 发现结果与客户端注册信息
+	Issuer                 string `json:"issuer" gorm:"type:text"`
+	AuthorizationEndpoint  string `json:"-" gorm:"type:text"`
+	TokenEndpoint          string `json:"-" gorm:"type:text"`
+	Resource               string `json:"resource" gorm:"type:text"` // RFC 8707 resource 参数
+	RedirectURI            string `json:"-" gorm:"type:text"`
+	ClientID               string `json:"client_id" gorm:"type:varchar(255)"`
+	ClientSecretCiphertext string `json:"-" gorm:"type:text"`
+	ClientSecretNonce      string `json:"-" gorm:"type:varchar(64)"`
+	Scopes                 string `json:"scopes" gorm:"type:text"` // 空格分隔
+
+	AccessTokenCiphertext  string     `json:"-" gorm:"type:text"`
+	AccessTokenNonce       string     `json:"-" gorm:"type:varchar(64)"`
+	RefreshTokenCiphertext string     `json:"-" gorm:"type:text"`
+	RefreshTokenNonce      string     `json:"-" gorm:"type:varchar(64)"`
+	TokenType              string     `json:"token_type" gorm:"type:varchar(32)"`
+	ExpiresAt              *time.Time `json:"expires_at"`
+	LastRefreshedAt        *time.Time `json:"last_refreshed_at"`
+	LastError              string     `json:"last_error" gorm:"type:text"`
+
+	// 授权进行中的一次性状态，回调完成后清空
+	PendingState     string     `json:"-" gorm:"type:varchar(128);index"`
+	PendingVerifier  string     `json:"-" gorm:"type:varchar(128)"`
+	PendingExpiresAt *time.Time `json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/json"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -22,20 +23,47 @@ type User struct {
 type APIToken struct {
 	ID          uint       `json:"id" gorm:"primarykey"`
 	UserID      uint       `json:"user_id" gorm:"not null;index"`
+	OrgID       uint       `json:"org_id" gorm:"not null;default:0;index"` // 令牌作用的组织，0 表示使用个人组织
 	Name        string     `json:"name" gorm:"type:varchar(100);not null"`
 	TokenPrefix string     `json:"token_prefix" gorm:"type:varchar(20);index"`
 	TokenHash   string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
 	IsActive    bool       `json:"is_active" gorm:"default:true;index"`
 	LastUsedAt  *time.Time `json:"last_used_at"`
 	ExpiresAt   *time.Time `json:"expires_at" gorm:"index"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// 访问范围：逗号分隔，Scopes 为空表示旧版令牌（全部权限），其余为空表示不限制
+	Scopes             string `json:"scopes" gorm:"type:varchar(500)"`
+	AgentIDs           string `json:"agent_ids" gorm:"type:varchar(500)"`      // 允许访问的智能体ID
+	DeviceNames        string `json:"device_names" gorm:"type:varchar(1000)"`  // 允许访问的设备（MAC）
+	AllowedCIDRs       string `json:"allowed_cidrs" gorm:"type:varchar(1000)"` // 允许的来源 IP/CIDR
+	RateLimitPerMinute int    `json:"rate_limit_per_minute" gorm:"default:0"`  // 每分钟请求上限，0 使用默认值
+
+	// 用量统计
+	RequestCount     int64  `json:"request_count" gorm:"default:0"`
+	RateLimitedCount int64  `json:"rate_limited_count" gorm:"default:0"`
+	DeniedCount      int64  `json:"denied_count" gorm:"default:0"` // 来源 IP、访问范围校验未通过的次数
+	LastUsedIP       string `json:"last_used_ip" gorm:"type:varchar(64)"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SplitList 拆分逗号分隔的配置值，忽略空项
+func SplitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
 }
 
 // 设备模型
 type Device struct {
 	ID           uint       `json:"id" gorm:"primarykey"`
 	UserID       uint       `json:"user_id" gorm:"not null"`
+	OrgID        uint       `json:"org_id" gorm:"not null;default:0;index"`                                   // 所属组织
 	AgentID      uint       `json:"agent_id" gorm:"not null;default:0"`                                       // 智能体ID，一台设备只能属于一个智能体
 	RoleID       *uint      `json:"role_id" gorm:"index"`                                                     // 角色ID（可选，覆盖智能体配置）
 	DeviceCode   string     `json:"device_code" gorm:"type:varchar(100);uniqueIndex:idx_devices_device_code"` // 6位激活码
@@ -44,14 +72,22 @@ type Device struct {
 	PreSecretKey string     `json:"pre_secret_key" gorm:"type:varchar(128)"` // 预激活密钥
 	Activated    bool       `json:"activated" gorm:"default:false"`          // 设备是否已激活
 	LastActiveAt *time.Time `json:"last_active_at"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
+	// 提示词模板变量：{{device_name}}（显示名称，为空时使用设备标识）、{{owner_nickname}}、{{location}}，
+	// 时区用于 {{local_time}} 等时间变量
+	DisplayName   string    `json:"display_name" gorm:"type:varchar(100)"`
+	OwnerNickname string    `json:"owner_nickname" gorm:"type:varchar(50)"`
+	Location      string    `json:"location" gorm:"type:varchar(100)"`
+	Timezone      string    `json:"timezone" gorm:"type:varchar(64)"` // IANA 时区，如 Asia/Shanghai，空表示服务器时区
+	AudioFrontend string    `json:"audio_frontend" gorm:"type:text"`  // 设备级音频前端处理覆盖项（JSON），逐项覆盖智能体配置
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 // 智能体模型
 type Agent struct {
 	ID              uint    `json:"id" gorm:"primarykey"`
-	UserID          uint    `json:"user_id" gorm:"not null"`
+	UserID          uint    `json:"user_id" gorm:"not null"`                             // 创建者
+	OrgID           uint    `json:"org_id" gorm:"not null;default:0;index"`              // 所属组织
 	Name            string  `json:"name" gorm:"type:varchar(100);not null"`              // 昵称
 	CustomPrompt    string  `json:"custom_prompt" gorm:"type:text"`                      // 角色介绍(prompt)
 	LLMConfigID     *string `json:"llm_config_id" gorm:"type:varchar(100)"`              // 语言模型配置ID
@@ -62,16 +98,28 @@ type Agent struct {
 	MCPServiceNames string  `json:"mcp_service_names" gorm:"type:text"`                  // 逗号分隔的MCP服务名，空=使用全部已启用全局MCP服务
 	// OpenClaw 配置，JSON字符串，结构：
 	// {"allowed":true,"enter_keywords":["进入openclaw"],"exit_keywords":["退出openclaw"]}
-	OpenClawConfig string    `json:"openclaw_config" gorm:"type:text"`
-	Status         string    `json:"status" gorm:"type:varchar(20);default:'active'"` // active, inactive
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	OpenClawConfig string `json:"openclaw_config" gorm:"type:text"`
+	// 固定为上下文的 MCP 资源，JSON字符串，结构：
+	// [{"server":"docs","uri":"docs://faq","name":"常见问题","max_chars":2000}]，server 为 device 表示设备侧 MCP
+	MCPResources string `json:"mcp_resources" gorm:"type:text"`
+	// 工具调用策略，JSON字符串，结构：
+	// [{"tool":"device_*","policy":"confirm","prompt":"确定要执行吗？"}]，policy 为 allow/confirm/deny
+	ToolPolicies string `json:"tool_policies" gorm:"type:text"`
+	// 上行音频前端处理（高通/降噪/去混响/AGC），JSON字符串，只保存覆盖全局 audio_frontend 的项，结构：
+	// {"enabled":true,"noise_suppression":{"over_subtraction":3},"dereverb":{"enabled":true,"t60_ms":600}}
+	AudioFrontend string `json:"audio_frontend" gorm:"type:text"`
+	Status        string `json:"status" gorm:"type:varchar(20);default:'active'"` // active, inactive
+	// 已发布版本：设置后设备运行时使用该版本的快照，当前行作为草稿继续编辑与测试；为空表示直接使用当前配置
+	PublishedRevisionID *uint     `json:"published_revision_id" gorm:"index"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
 }
 
-// KnowledgeBase 用户知识库（每用户独立）
+// KnowledgeBase 知识库（归属组织，UserID 为创建者）
 type KnowledgeBase struct {
 	ID                 uint       `json:"id" gorm:"primarykey"`
 	UserID             uint       `json:"user_id" gorm:"not null;index"`
+	OrgID              uint       `json:"org_id" gorm:"not null;default:0;index"`
 	Name               string     `json:"name" gorm:"type:varchar(100);not null"`
 	Description        string     `json:"description" gorm:"type:text"`
 	Content            string     `json:"content" gorm:"type:text"`
@@ -110,6 +158,25 @@ type AgentKnowledgeBase struct {
 	CreatedAt       time.Time `json:"created_at"`
 }
 
+// AgentIntentRule 智能体意图路由规则：在 LLM 之前按关键词/正则/语义相似度匹配用户原话并执行动作
+type AgentIntentRule struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	AgentID   uint      `json:"agent_id" gorm:"not null;index"`
+	Name      string    `json:"name" gorm:"type:varchar(100);not null"`
+	MatchType string    `json:"match_type" gorm:"type:varchar(20);not null"` // keyword, regex, embedding
+	Patterns  string    `json:"patterns" gorm:"type:text"`                   // JSON 字符串数组：关键词 / 正则 / 语义示例句
+	Threshold float64   `json:"threshold" gorm:"default:0"`                  // 语义相似度阈值，0 表示使用主程序默认值
+	Action    string    `json:"action" gorm:"type:varchar(20);not null"`     // tool, reply, agent, mode, llm
+	ToolName  string    `json:"tool_name" gorm:"type:varchar(100)"`
+	ToolArgs  string    `json:"tool_args" gorm:"type:text"` // JSON 对象，支持 {{text}} 与正则命名分组占位符
+	Reply     string    `json:"reply" gorm:"type:text"`
+	Target    string    `json:"target" gorm:"type:varchar(100)"` // agent: 目标智能体名称；mode: openclaw / normal
+	Priority  int       `json:"priority" gorm:"default:0;index"`
+	Enabled   bool      `json:"enabled" gorm:"not null"` // 不使用 default:true，避免创建时 false 被数据库默认值覆盖
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
 // 通用配置模型
 type Config struct {
 	ID        uint      `json:"id" gorm:"primarykey"`
@@ -148,7 +215,8 @@ type MCPMarketService struct {
 // Role 角色模型（统一管理全局角色和用户角色）
 type Role struct {
 	ID          uint   `json:"id" gorm:"primarykey"`
-	UserID      *uint  `json:"user_id" gorm:"index"` // 所属用户ID，NULL表示全局角色
+	UserID      *uint  `json:"user_id" gorm:"index"`                   // 创建者ID，NULL表示全局角色
+	OrgID       uint   `json:"org_id" gorm:"not null;default:0;index"` // 用户角色所属组织，全局角色为 0
 	Name        string `json:"name" gorm:"type:varchar(100);not null"`
 	Description string `json:"description" gorm:"type:text"`
 	Prompt      string `json:"prompt" gorm:"type:text"` // 系统提示词
@@ -191,6 +259,7 @@ type GlobalRole struct {
 type SpeakerGroup struct {
 	ID          uint      `json:"id" gorm:"primarykey"`
 	UserID      uint      `json:"user_id" gorm:"not null;index;uniqueIndex:idx_speaker_groups_user_name,priority:1"`
+	OrgID       uint      `json:"org_id" gorm:"not null;default:0;index"`
 	AgentID     uint      `json:"agent_id" gorm:"not null;index"`
 	Name        string    `json:"name" gorm:"type:varchar(100);not null;uniqueIndex:idx_speaker_groups_user_name,priority:2"`
 	Prompt      string    `json:"prompt" gorm:"type:text"`
@@ -221,7 +290,8 @@ type SpeakerSample struct {
 // VoiceClone 复刻音色模型
 type VoiceClone struct {
 	ID                 uint      `json:"id" gorm:"primarykey"`
-	UserID             uint      `json:"user_id" gorm:"not null;index"`
+	UserID             uint      `json:"user_id" gorm:"not null;index"`          // 创建者
+	OrgID              uint      `json:"org_id" gorm:"not null;default:0;index"` // 所属组织
 	Name               string    `json:"name" gorm:"type:varchar(100);not null"`
 	Provider           string    `json:"provider" gorm:"type:varchar(50);not null;index"`
 	ProviderVoiceID    string    `json:"provider_voice_id" gorm:"type:varchar(200);not null;index"`
@@ -239,6 +309,7 @@ type VoiceCloneAudio struct {
 	ID             uint      `json:"id" gorm:"primarykey"`
 	VoiceCloneID   *uint     `json:"voice_clone_id" gorm:"index"`
 	UserID         uint      `json:"user_id" gorm:"not null;index"`
+	OrgID          uint      `json:"org_id" gorm:"not null;default:0;index"`
 	SourceType     string    `json:"source_type" gorm:"type:varchar(20);not null"` // upload/record
 	FilePath       string    `json:"file_path" gorm:"type:varchar(500);not null"`
 	FileName       string    `json:"file_name" gorm:"type:varchar(255)"`
@@ -287,6 +358,7 @@ type ChatMessage struct {
 	DeviceID  string `json:"device_id" gorm:"type:varchar(100);index:idx_device_id;not null"`
 	AgentID   string `json:"agent_id" gorm:"type:varchar(64);index:idx_agent_id;not null"`
 	UserID    uint   `json:"user_id" gorm:"index:idx_user_id;not null"`
+	OrgID     uint   `json:"org_id" gorm:"index:idx_org_id;not null;default:0"`
 	SessionID string `json:"session_id" gorm:"type:varchar(64);index:idx_session_id"` // 仅作分组标记
 
 	// 消息内容
@@ -326,6 +398,10 @@ func (m *ChatMessage) BeforeSave(tx *gorm.DB) error {
 		}
 		m.MetadataJSON = string(data)
 	}
+	// json/jsonb 列不接受空串，无元数据时写入空对象
+	if m.MetadataJSON == "" {
+		m.MetadataJSON = "{}"
+	}
 	return nil
 }
 
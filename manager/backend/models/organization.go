@@ -0,0 +1,157 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 组织成员角色
+const (
+	OrgRoleOwner    = "owner"    // 所有者：全部权限，包括成员管理与删除组织
+	OrgRoleEditor   = "editor"   // 编辑者：管理智能体、设备、知识库、声纹组
+	OrgRoleOperator = "operator" // 运维：只读 + 设备/智能体操作（消息注入、MCP 调用、切换角色）
+	OrgRoleViewer   = "viewer"   // 访客：只读
+)
+
+// ValidOrgRole 判断是否为合法的组织成员角色
+func ValidOrgRole(role string) bool {
+	switch role {
+	case OrgRoleOwner, OrgRoleEditor, OrgRoleOperator, OrgRoleViewer:
+		return true
+	}
+	return false
+}
+
+// Organization 组织：智能体、设备、知识库、声纹组与聊天记录归属于组织，成员按角色授权
+type Organization struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	Name      string    `json:"name" gorm:"type:varchar(100);not null"`
+	Personal  bool      `json:"personal" gorm:"not null;index"`                         // 个人组织：每个用户自动创建一个，不可删除、不可邀请成员
+	OwnerID   uint      `json:"owner_id" gorm:"not null;index"`                         // 创建者（个人组织为所属用户；单点登录自动创建的组织为 0）
+	SSOKey    *string   `json:"sso_key,omitempty" gorm:"type:varchar(100);uniqueIndex"` // 单点登录自动创建的组织的稳定标识（映射中的 org_key），用户创建的组织为空
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OrganizationMember 组织成员
+type OrganizationMember struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	OrgID     uint      `json:"org_id" gorm:"not null;uniqueIndex:idx_org_members_org_user,priority:1"`
+	UserID    uint      `json:"user_id" gorm:"not null;index;uniqueIndex:idx_org_members_org_user,priority:2"`
+	Role      string    `json:"role" gorm:"type:varchar(20);not null"` // owner, editor, operator, viewer
+	ManagedBy string    `json:"managed_by" gorm:"type:varchar(20)"`    // sso: 由单点登录分组映射维护，登录时随分组同步
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OrganizationInvitation 组织邀请（仅保存令牌哈希，明文只在创建时返回一次）
+type OrganizationInvitation struct {
+	ID          uint       `json:"id" gorm:"primarykey"`
+	OrgID       uint       `json:"org_id" gorm:"not null;index"`
+	Email       string     `json:"email" gorm:"type:varchar(100);index"` // 为空表示任何持有邀请链接的用户均可接受
+	Role        string     `json:"role" gorm:"type:varchar(20);not null"`
+	TokenPrefix string     `json:"token_prefix" gorm:"type:varchar(20)"`
+	TokenHash   string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	Status      string     `json:"status" gorm:"type:varchar(20);not null;index"` // pending, accepted, revoked
+	InvitedBy   uint       `json:"invited_by" gorm:"not null"`
+	AcceptedBy  *uint      `json:"accepted_by"`
+	AcceptedAt  *time.Time `json:"accepted_at"`
+	ExpiresAt   time.Time  `json:"expires_at" gorm:"index"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// EnsurePersonalOrganization 确保用户拥有个人组织，不存在时创建并将用户设为所有者
+func EnsurePersonalOrganization(db *gorm.DB, user *User) (*Organization, error) {
+	db = db.Session(&gorm.Session{NewDB: true})
+	var org Organization
+	err := db.Where("owner_id = ? AND personal = ?", user.ID, true).First(&org).Error
+	if err == nil {
+		return &org, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		org = Organization{Name: fmt.Sprintf("%s 的个人空间", user.Username), Personal: true, OwnerID: user.ID}
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrganizationMember{OrgID: org.ID, UserID: user.ID, Role: OrgRoleOwner}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建个人组织失败: %w", err)
+	}
+	return &org, nil
+}
+
+// PersonalOrganizationID 返回用户个人组织ID，不存在时自动创建
+func PersonalOrganizationID(db *gorm.DB, userID uint) (uint, error) {
+	var user User
+	if err := db.Session(&gorm.Session{NewDB: true}).First(&user, userID).Error; err != nil {
+		return 0, err
+	}
+	org, err := EnsurePersonalOrganization(db, &user)
+	if err != nil {
+		return 0, err
+	}
+	return org.ID, nil
+}
+
+// fillOrgID 未指定组织的资源归入创建者的个人组织（兼容管理员代建、设备激活等未感知组织的写入路径）
+func fillOrgID(tx *gorm.DB, orgID *uint, userID uint) error {
+	if *orgID != 0 || userID == 0 {
+		return nil
+	}
+	id, err := PersonalOrganizationID(tx, userID)
+	if err != nil {
+		return err
+	}
+	*orgID = id
+	return nil
+}
+
+// AfterCreate 新用户自动创建个人组织
+func (u *User) AfterCreate(tx *gorm.DB) error {
+	_, err := EnsurePersonalOrganization(tx, u)
+	return err
+}
+
+func (d *Device) BeforeSave(tx *gorm.DB) error {
+	return fillOrgID(tx, &d.OrgID, d.UserID)
+}
+
+func (a *Agent) BeforeSave(tx *gorm.DB) error {
+	return fillOrgID(tx, &a.OrgID, a.UserID)
+}
+
+func (k *KnowledgeBase) BeforeSave(tx *gorm.DB) error {
+	return fillOrgID(tx, &k.OrgID, k.UserID)
+}
+
+func (g *SpeakerGroup) BeforeSave(tx *gorm.DB) error {
+	return fillOrgID(tx, &g.OrgID, g.UserID)
+}
+
+func (r *Role) BeforeSave(tx *gorm.DB) error {
+	if r.UserID == nil || r.RoleType == "global" {
+		return nil
+	}
+	return fillOrgID(tx, &r.OrgID, *r.UserID)
+}
+
+func (v *VoiceClone) BeforeSave(tx *gorm.DB) error {
+	return fillOrgID(tx, &v.OrgID, v.UserID)
+}
+
+func (a *VoiceCloneAudio) BeforeSave(tx *gorm.DB) error {
+	return fillOrgID(tx, &a.OrgID, a.UserID)
+}
+
+func (m *ChatMessage) BeforeCreate(tx *gorm.DB) error {
+	return fillOrgID(tx, &m.OrgID, m.UserID)
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// PromptSnippet 组织内共享的提示词片段，在智能体或角色提示词中以 {{template "名称"}} 引用
+type PromptSnippet struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	OrgID       uint      `json:"org_id" gorm:"not null;uniqueIndex:idx_prompt_snippets_org_name,priority:1"`
+	UserID      uint      `json:"user_id" gorm:"not null;index"` // 创建者
+	Name        string    `json:"name" gorm:"type:varchar(64);not null;uniqueIndex:idx_prompt_snippets_org_name,priority:2"`
+	Description string    `json:"description" gorm:"type:varchar(200)"`
+	Content     string    `json:"content" gorm:"type:text"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrRevisionImmutable 配置版本一经生成不可修改或删除，回滚通过生成新版本实现
+var ErrRevisionImmutable = errors.New("配置版本不可修改或删除")
+
+// Revision 智能体/角色配置的版本快照，每次创建、更新、回滚都会追加一条
+type Revision struct {
+	ID           uint      `json:"id" gorm:"primarykey"`
+	ResourceType string    `json:"resource_type" gorm:"type:varchar(20);not null;uniqueIndex:idx_revisions_resource_version,priority:1"` // agent / role
+	ResourceID   uint      `json:"resource_id" gorm:"not null;uniqueIndex:idx_revisions_resource_version,priority:2"`
+	Version      int       `json:"version" gorm:"not null;uniqueIndex:idx_revisions_resource_version,priority:3"` // 资源内递增，从 1 开始
+	OrgID        uint      `json:"org_id" gorm:"not null;default:0;index"`
+	Snapshot     string    `json:"snapshot" gorm:"type:text;not null"`  // 配置快照（JSON）
+	AuthorID     uint      `json:"author_id" gorm:"not null;default:0"` // 0 表示系统生成（如功能上线前的初始版本）
+	AuthorName   string    `json:"author_name" gorm:"type:varchar(100)"`
+	Comment      string    `json:"comment" gorm:"type:varchar(500)"`
+	RollbackFrom *int      `json:"rollback_from,omitempty"` // 由回滚生成时记录目标版本号
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (Revision) BeforeUpdate(tx *gorm.DB) error {
+	return ErrRevisionImmutable
+}
+
+func (Revision) BeforeDelete(tx *gorm.DB) error {
+	return ErrRevisionImmutable
+}
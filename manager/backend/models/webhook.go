@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Webhook 外部事件订阅：事件按组织匹配，可限定智能体与事件类型
+type Webhook struct {
+	ID           uint       `json:"id" gorm:"primarykey"`
+	OrgID        uint       `json:"org_id" gorm:"not null;index"`
+	UserID       uint       `json:"user_id" gorm:"not null;index"`            // 创建者
+	AgentID      uint       `json:"agent_id" gorm:"not null;default:0;index"` // 0 表示组织内全部智能体
+	Name         string     `json:"name" gorm:"type:varchar(100);not null"`
+	URL          string     `json:"url" gorm:"type:varchar(1000);not null"`
+	Secret       string     `json:"-" gorm:"type:varchar(100);not null"` // HMAC-SHA256 签名密钥
+	SecretPrefix string     `json:"secret_prefix" gorm:"type:varchar(20)"`
+	Events       string     `json:"events" gorm:"type:varchar(500);not null"` // 逗号分隔，* 表示全部事件
+	IsActive     bool       `json:"is_active" gorm:"not null;index"`
+	LastStatus   string     `json:"last_status" gorm:"type:varchar(20)"` // 最近一次投递结果：success/failed
+	LastSentAt   *time.Time `json:"last_sent_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// WebhookDelivery 单次事件投递记录，失败按指数退避重试，超过最大次数进入死信
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primarykey"`
+	WebhookID      uint       `json:"webhook_id" gorm:"not null;index"`
+	OrgID          uint       `json:"org_id" gorm:"not null;index"`
+	EventID        string     `json:"event_id" gorm:"type:varchar(64);not null;index"`
+	EventType      string     `json:"event_type" gorm:"type:varchar(64);not null;index"`
+	Payload        string     `json:"payload" gorm:"type:text"`
+	Status         string     `json:"status" gorm:"type:varchar(20);not null;index"` // pending/delivering/success/dead
+	Attempts       int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at" gorm:"index"`
+	ResponseStatus int        `json:"response_status"`
+	ResponseBody   string     `json:"response_body" gorm:"type:text"`
+	LastError      string     `json:"last_error" gorm:"type:text"`
+	DurationMs     int64      `json:"duration_ms"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
@@ -2,10 +2,15 @@ package router
 
 import (
 	"io/fs"
+	"log"
 	"net/http"
+	"time"
 	"xiaozhi/manager/backend/config"
 	"xiaozhi/manager/backend/controllers"
 	"xiaozhi/manager/backend/middleware"
+	mcpoauth "xiaozhi/manager/backend/services/mcp_oauth"
+	"xiaozhi/manager/backend/services/sso"
+	"xiaozhi/manager/backend/services/webhook"
 	"xiaozhi/manager/backend/static"
 
 	"github.com/gin-contrib/cors"
@@ -15,24 +20,45 @@ import (
 
 func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 	r := gin.Default()
+	if err := middleware.SetTrustedProxies(r, cfg.Server.TrustedProxies); err != nil {
+		log.Printf("trusted_proxies 配置无效，忽略转发头: %v", err)
+	}
 
 	// CORS配置
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowAllOrigins = true
-	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-API-Token"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-API-Token", middleware.HeaderOrgID}
 	corsConfig.AllowCredentials = true
 	r.Use(cors.New(corsConfig))
 
 	// 初始化控制器
-	authController := &controllers.AuthController{DB: db}
+	ssoManager := sso.NewManager(cfg.SSO, nil)
+	authController := &controllers.AuthController{DB: db, LocalLoginDisabled: cfg.SSO.DisableLocalLogin && len(ssoManager.Providers()) > 0}
+	ssoController := &controllers.SSOController{DB: db, SSO: ssoManager}
 	webSocketController := controllers.NewWebSocketController(db)
 	adminController := &controllers.AdminController{DB: db, WebSocketController: webSocketController}
 	userController := &controllers.UserController{DB: db, WebSocketController: webSocketController}
 	deviceActivationController := &controllers.DeviceActivationController{DB: db}
-	setupController := &controllers.SetupController{DB: db}
+	setupController := &controllers.SetupController{DB: db, Config: cfg}
 	speakerGroupController := controllers.NewSpeakerGroupController(db, cfg)
 	voiceCloneController := controllers.NewVoiceCloneController(db, cfg)
 	poolStatsController := controllers.NewPoolStatsController()
+	organizationController := &controllers.OrganizationController{DB: db}
+	webhookController := &controllers.WebhookController{DB: db, AllowPrivateNetwork: cfg.Webhook.AllowPrivateNetwork}
+	auditController := &controllers.AuditController{DB: db}
+	revisionController := &controllers.RevisionController{DB: db}
+	experimentController := &controllers.ExperimentController{DB: db}
+	promptController := &controllers.PromptController{DB: db}
+	if db != nil {
+		webhook.Init(db, webhook.Options{
+			MaxAttempts:         cfg.Webhook.MaxAttempts,
+			BaseBackoff:         time.Duration(cfg.Webhook.BaseBackoffSeconds) * time.Second,
+			Timeout:             time.Duration(cfg.Webhook.TimeoutSeconds) * time.Second,
+			RetentionDays:       cfg.Webhook.RetentionDays,
+			AllowPrivateNetwork: cfg.Webhook.AllowPrivateNetwork,
+		})
+		mcpoauth.Init(db, mcpoauth.Options{PublicURL: cfg.SSO.PublicURL})
+	}
 
 	// 初始化聊天历史控制器（使用传入的 cfg，不重新 Load 避免内嵌时读错路径）
 	audioBasePath := "./storage/chat_history/audio"
@@ -56,9 +82,21 @@ func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 		api.POST("/login", authController.Login)
 		api.POST("/register", authController.Register)
 
+		// 单点登录（OIDC / LDAP）
+		api.GET("/auth/sso/providers", ssoController.ListProviders)
+		api.POST("/auth/sso/exchange", ssoController.Exchange)
+		api.GET("/auth/oidc/:provider/login", ssoController.BeginOIDC)
+		api.GET("/auth/oidc/:provider/callback", ssoController.OIDCCallback)
+		api.POST("/auth/ldap/login", ssoController.LDAPLogin)
+
+		// 全局MCP服务器 OAuth 授权回调（由授权服务器重定向，无需认证）
+		api.GET("/mcp-oauth/callback", adminController.MCPOAuthCallback)
+
 		// 数据库初始化相关路由（无需认证）
 		api.GET("/setup/status", setupController.CheckSetupStatus)
 		api.POST("/setup/initialize", setupController.InitializeDatabase)
+		api.GET("/setup/database", setupController.GetDatabaseOptions)
+		api.POST("/setup/test-database", setupController.TestDatabase)
 
 		// 设备激活相关公开接口（无需认证）
 		api.GET("/public/device/check-activation", deviceActivationController.CheckDeviceActivation)
@@ -72,87 +110,162 @@ func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 		api.PUT("/internal/history/messages/:message_id/audio", chatHistoryController.UpdateMessageAudio) // 更新消息音频（内部服务接口）
 		api.GET("/internal/history/messages", chatHistoryController.GetMessagesForInit)                   // 获取消息（用于初始化加载，内部服务接口）
 		api.POST("/internal/pool/stats", poolStatsController.ReportPoolStats)                             // 上报资源池统计数据（内部服务接口）
-		api.POST("/internal/devices/:device_name/switch-role", adminController.SwitchDeviceRoleByNameInternal)
-		api.POST("/internal/devices/:device_name/restore-default-role", adminController.RestoreDeviceDefaultRoleInternal)
+		api.POST("/internal/experiments/turns", experimentController.ReportExperimentTurns)               // 上报实验轮次结果（内部服务接口）
+		// 获取MCP服务器OAuth访问令牌（内部服务接口，返回明文令牌，需内部密钥或本机访问）
+		api.GET("/internal/mcp-oauth/token", middleware.InternalAuth(cfg.Server.InternalSecret), adminController.GetMCPOAuthTokenInternal)
+		api.POST("/internal/devices/:device_name/switch-role", middleware.AuditTrail(db), adminController.SwitchDeviceRoleByNameInternal)
+		api.POST("/internal/devices/:device_name/restore-default-role", middleware.AuditTrail(db), adminController.RestoreDeviceDefaultRoleInternal)
 
 		// 需要认证的路由
 		auth := api.Group("")
 		auth.Use(middleware.JWTAuth())
+		// 所有写操作（管理员配置、设备、角色、MCP 等）自动记录审计日志
+		auth.Use(middleware.AuditTrail(db))
 		{
+			// 组织上下文与权限：资源按当前组织（X-Org-ID，默认个人组织）隔离，按成员角色授权
+			orgCtx := middleware.OrgContext(db)
+			perm := middleware.RequirePermission
+
 			auth.GET("/profile", authController.GetProfile)
 			// 通用接口，获取系统中的设备信息
-			auth.GET("/dashboard/stats", userController.GetDashboardStats)
+			auth.GET("/dashboard/stats", orgCtx, userController.GetDashboardStats)
 			// 设备角色接口（管理员和普通用户均可访问，控制器内做权限校验）
-			auth.POST("/devices/:id/apply-role", adminController.ApplyRoleToDevice)
+			auth.POST("/devices/:id/apply-role", orgCtx, perm(middleware.PermDeviceOperate), adminController.ApplyRoleToDevice)
+
+			// 组织管理
+			orgs := auth.Group("/orgs")
+			{
+				orgs.GET("", organizationController.ListMyOrganizations)
+				orgs.POST("", organizationController.CreateOrganization)
+				orgs.POST("/invitations/accept", organizationController.AcceptInvitation)
+
+				org := orgs.Group("/:org_id", orgCtx)
+				org.GET("", organizationController.GetOrganization)
+				org.PUT("", perm(middleware.PermOrgManage), organizationController.UpdateOrganization)
+				org.DELETE("", perm(middleware.PermOrgManage), organizationController.DeleteOrganization)
+				org.POST("/leave", organizationController.LeaveOrganization)
+				org.GET("/members", perm(middleware.PermMemberRead), organizationController.ListMembers)
+				org.PUT("/members/:user_id", perm(middleware.PermMemberManage), organizationController.UpdateMemberRole)
+				org.DELETE("/members/:user_id", perm(middleware.PermMemberManage), organizationController.RemoveMember)
+				org.GET("/invitations", perm(middleware.PermMemberManage), organizationController.ListInvitations)
+				org.POST("/invitations", perm(middleware.PermMemberManage), organizationController.CreateInvitation)
+				org.DELETE("/invitations/:invitation_id", perm(middleware.PermMemberManage), organizationController.RevokeInvitation)
+			}
 
 			// 角色管理（文档主路径）
-			auth.GET("/roles", adminController.GetRolesNew)
-			auth.GET("/roles/:id", adminController.GetRoleNew)
-			auth.POST("/roles", adminController.CreateRoleNew)
-			auth.PUT("/roles/:id", adminController.UpdateRoleNew)
-			auth.DELETE("/roles/:id", adminController.DeleteRoleNew)
-			auth.PATCH("/roles/:id/toggle", adminController.ToggleRoleStatus)
+			auth.GET("/roles", orgCtx, perm(middleware.PermRoleRead), adminController.GetRolesNew)
+			auth.GET("/roles/:id", orgCtx, perm(middleware.PermRoleRead), adminController.GetRoleNew)
+			auth.POST("/roles", orgCtx, perm(middleware.PermRoleWrite), adminController.CreateRoleNew)
+			auth.PUT("/roles/:id", orgCtx, perm(middleware.PermRoleWrite), adminController.UpdateRoleNew)
+			auth.DELETE("/roles/:id", orgCtx, perm(middleware.PermRoleWrite), adminController.DeleteRoleNew)
+			auth.PATCH("/roles/:id/toggle", orgCtx, perm(middleware.PermRoleWrite), adminController.ToggleRoleStatus)
+			auth.GET("/roles/:id/revisions", orgCtx, perm(middleware.PermRoleRead), revisionController.ListRoleRevisions)
+			auth.GET("/roles/:id/revisions/:rev_id", orgCtx, perm(middleware.PermRoleRead), revisionController.GetRoleRevision)
+			auth.POST("/roles/:id/revisions/:rev_id/rollback", orgCtx, perm(middleware.PermRoleWrite), revisionController.RollbackRole)
 
 			// 用户路由
-			user := auth.Group("/user")
+			user := auth.Group("/user", orgCtx)
 			{
 				// 角色管理
-				user.GET("/roles", adminController.GetRolesNew)
-				user.GET("/roles/:id", adminController.GetRoleNew)
-				user.POST("/roles", adminController.CreateRoleNew)
-				user.PUT("/roles/:id", adminController.UpdateRoleNew)
-				user.DELETE("/roles/:id", adminController.DeleteRoleNew)
-				user.PATCH("/roles/:id/toggle", adminController.ToggleRoleStatus)
+				user.GET("/roles", perm(middleware.PermRoleRead), adminController.GetRolesNew)
+				user.GET("/roles/:id", perm(middleware.PermRoleRead), adminController.GetRoleNew)
+				user.POST("/roles", perm(middleware.PermRoleWrite), adminController.CreateRoleNew)
+				user.PUT("/roles/:id", perm(middleware.PermRoleWrite), adminController.UpdateRoleNew)
+				user.DELETE("/roles/:id", perm(middleware.PermRoleWrite), adminController.DeleteRoleNew)
+				user.PATCH("/roles/:id/toggle", perm(middleware.PermRoleWrite), adminController.ToggleRoleStatus)
+				user.GET("/roles/:id/revisions", perm(middleware.PermRoleRead), revisionController.ListRoleRevisions)
+				user.GET("/roles/:id/revisions/:rev_id", perm(middleware.PermRoleRead), revisionController.GetRoleRevision)
+				user.POST("/roles/:id/revisions/:rev_id/rollback", perm(middleware.PermRoleWrite), revisionController.RollbackRole)
 
 				// API Token（供OpenAPI调用）
-				user.GET("/api-tokens", userController.ListAPITokens)
-				user.POST("/api-tokens", userController.CreateAPIToken)
-				user.DELETE("/api-tokens/:id", userController.RevokeAPIToken)
+				// Webhook 订阅与投递记录
+				user.GET("/webhooks/events", perm(middleware.PermWebhookRead), webhookController.ListEvents)
+				user.GET("/webhooks", perm(middleware.PermWebhookRead), webhookController.ListWebhooks)
+				user.POST("/webhooks", perm(middleware.PermWebhookWrite), webhookController.CreateWebhook)
+				user.PUT("/webhooks/:id", perm(middleware.PermWebhookWrite), webhookController.UpdateWebhook)
+				user.DELETE("/webhooks/:id", perm(middleware.PermWebhookWrite), webhookController.DeleteWebhook)
+				user.POST("/webhooks/:id/rotate-secret", perm(middleware.PermWebhookWrite), webhookController.RotateSecret)
+				user.POST("/webhooks/:id/test", perm(middleware.PermWebhookWrite), webhookController.SendTestEvent)
+				user.GET("/webhooks/:id/deliveries", perm(middleware.PermWebhookRead), webhookController.ListDeliveries)
+				user.GET("/webhook-deliveries", perm(middleware.PermWebhookRead), webhookController.ListDeliveries)
+				user.POST("/webhook-deliveries/:delivery_id/redeliver", perm(middleware.PermWebhookWrite), webhookController.Redeliver)
+
+				user.GET("/api-tokens", perm(middleware.PermAPITokenRead), userController.ListAPITokens)
+				user.GET("/api-tokens/scopes", perm(middleware.PermAPITokenRead), userController.ListAPITokenScopes)
+				user.POST("/api-tokens", perm(middleware.PermAPITokenWrite), userController.CreateAPIToken)
+				user.PUT("/api-tokens/:id", perm(middleware.PermAPITokenWrite), userController.UpdateAPIToken)
+				user.DELETE("/api-tokens/:id", perm(middleware.PermAPITokenWrite), userController.RevokeAPIToken)
 
 				// 设备管理
-				user.GET("/devices", userController.GetMyDevices)
-				user.POST("/devices", userController.CreateDevice)
+				user.GET("/devices", perm(middleware.PermDeviceRead), userController.GetMyDevices)
+				user.POST("/devices", perm(middleware.PermDeviceWrite), userController.CreateDevice)
 
 				// 智能体管理
-				user.GET("/agents", userController.GetAgents)
-				user.POST("/agents", userController.CreateAgent)
-				user.GET("/agents/:id", userController.GetAgent)
-				user.PUT("/agents/:id", userController.UpdateAgent)
-				user.DELETE("/agents/:id", userController.DeleteAgent)
-				user.GET("/agents/:id/devices", userController.GetAgentDevices)
-				user.POST("/agents/:id/devices", userController.AddDeviceToAgent)
-				user.DELETE("/agents/:id/devices/:device_id", userController.RemoveDeviceFromAgent)
-				user.GET("/agents/:id/knowledge-bases", userController.GetAgentKnowledgeBases)
-				user.PUT("/agents/:id/knowledge-bases", userController.UpdateAgentKnowledgeBases)
+				user.GET("/agents", perm(middleware.PermAgentRead), userController.GetAgents)
+				user.POST("/agents", perm(middleware.PermAgentWrite), userController.CreateAgent)
+				user.GET("/agents/:id", perm(middleware.PermAgentRead), userController.GetAgent)
+				user.PUT("/agents/:id", perm(middleware.PermAgentWrite), userController.UpdateAgent)
+				user.DELETE("/agents/:id", perm(middleware.PermAgentWrite), userController.DeleteAgent)
+				user.GET("/agents/:id/devices", perm(middleware.PermDeviceRead), userController.GetAgentDevices)
+				user.POST("/agents/:id/devices", perm(middleware.PermDeviceWrite), userController.AddDeviceToAgent)
+				user.DELETE("/agents/:id/devices/:device_id", perm(middleware.PermDeviceWrite), userController.RemoveDeviceFromAgent)
+				user.GET("/agents/:id/knowledge-bases", perm(middleware.PermAgentRead), userController.GetAgentKnowledgeBases)
+				user.PUT("/agents/:id/knowledge-bases", perm(middleware.PermAgentWrite), userController.UpdateAgentKnowledgeBases)
+				user.GET("/agents/:id/intent-rules", perm(middleware.PermAgentRead), userController.GetAgentIntentRules)
+				user.PUT("/agents/:id/intent-rules", perm(middleware.PermAgentWrite), userController.UpdateAgentIntentRules)
+				// 智能体配置版本：历史、对比、回滚与发布
+				user.GET("/agents/:id/revisions", perm(middleware.PermAgentRead), revisionController.ListAgentRevisions)
+				user.GET("/agents/:id/revisions/:rev_id", perm(middleware.PermAgentRead), revisionController.GetAgentRevision)
+				user.POST("/agents/:id/revisions/:rev_id/rollback", perm(middleware.PermAgentWrite), revisionController.RollbackAgent)
+				user.POST("/agents/:id/revisions/:rev_id/publish", perm(middleware.PermAgentWrite), revisionController.PublishAgentRevision)
+				user.DELETE("/agents/:id/published", perm(middleware.PermAgentWrite), revisionController.UnpublishAgent)
+				// 智能体 A/B 实验
+				user.GET("/experiments", perm(middleware.PermAgentRead), experimentController.ListExperiments)
+				user.POST("/experiments", perm(middleware.PermAgentWrite), experimentController.CreateExperiment)
+				user.GET("/experiments/:id", perm(middleware.PermAgentRead), experimentController.GetExperiment)
+				user.PUT("/experiments/:id", perm(middleware.PermAgentWrite), experimentController.UpdateExperiment)
+				user.DELETE("/experiments/:id", perm(middleware.PermAgentWrite), experimentController.DeleteExperiment)
+				user.POST("/experiments/:id/start", perm(middleware.PermAgentWrite), experimentController.StartExperiment)
+				user.POST("/experiments/:id/stop", perm(middleware.PermAgentWrite), experimentController.StopExperiment)
+				user.GET("/experiments/:id/results", perm(middleware.PermAgentRead), experimentController.GetExperimentResults)
+				// 提示词模板：共享片段、设备变量与预览
+				user.GET("/prompt-variables", perm(middleware.PermAgentRead), promptController.ListPromptVariables)
+				user.GET("/prompt-snippets", perm(middleware.PermAgentRead), promptController.ListSnippets)
+				user.POST("/prompt-snippets", perm(middleware.PermAgentWrite), promptController.CreateSnippet)
+				user.PUT("/prompt-snippets/:id", perm(middleware.PermAgentWrite), promptController.UpdateSnippet)
+				user.DELETE("/prompt-snippets/:id", perm(middleware.PermAgentWrite), promptController.DeleteSnippet)
+				user.POST("/prompt-preview", perm(middleware.PermAgentRead), promptController.PreviewPrompt)
+				user.PUT("/devices/:id/prompt-vars", perm(middleware.PermDeviceWrite), promptController.UpdateDevicePromptVars)
+				user.PUT("/devices/:id/audio-frontend", perm(middleware.PermDeviceWrite), userController.UpdateDeviceAudioFrontend)
 
 				// 用户知识库管理（纯文本）
-				user.GET("/knowledge-bases", userController.GetKnowledgeBases)
-				user.POST("/knowledge-bases", userController.CreateKnowledgeBase)
-				user.GET("/knowledge-bases/:id", userController.GetKnowledgeBase)
-				user.PUT("/knowledge-bases/:id", userController.UpdateKnowledgeBase)
-				user.DELETE("/knowledge-bases/:id", userController.DeleteKnowledgeBase)
-				user.POST("/knowledge-bases/:id/sync", userController.SyncKnowledgeBase)
-				user.POST("/knowledge-bases/:id/test-search", userController.TestKnowledgeBaseSearch)
-				user.GET("/knowledge-bases/:id/documents", userController.GetKnowledgeBaseDocuments)
-				user.POST("/knowledge-bases/:id/documents", userController.CreateKnowledgeBaseDocument)
-				user.POST("/knowledge-bases/:id/documents/upload", userController.CreateKnowledgeBaseDocumentByUpload)
-				user.PUT("/knowledge-bases/:id/documents/:doc_id", userController.UpdateKnowledgeBaseDocument)
-				user.DELETE("/knowledge-bases/:id/documents/:doc_id", userController.DeleteKnowledgeBaseDocument)
-				user.POST("/knowledge-bases/:id/documents/:doc_id/sync", userController.SyncKnowledgeBaseDocument)
+				user.GET("/knowledge-bases", perm(middleware.PermKnowledgeRead), userController.GetKnowledgeBases)
+				user.POST("/knowledge-bases", perm(middleware.PermKnowledgeWrite), userController.CreateKnowledgeBase)
+				user.GET("/knowledge-bases/:id", perm(middleware.PermKnowledgeRead), userController.GetKnowledgeBase)
+				user.PUT("/knowledge-bases/:id", perm(middleware.PermKnowledgeWrite), userController.UpdateKnowledgeBase)
+				user.DELETE("/knowledge-bases/:id", perm(middleware.PermKnowledgeWrite), userController.DeleteKnowledgeBase)
+				user.POST("/knowledge-bases/:id/sync", perm(middleware.PermKnowledgeWrite), userController.SyncKnowledgeBase)
+				user.POST("/knowledge-bases/:id/test-search", perm(middleware.PermKnowledgeRead), userController.TestKnowledgeBaseSearch)
+				user.GET("/knowledge-bases/:id/documents", perm(middleware.PermKnowledgeRead), userController.GetKnowledgeBaseDocuments)
+				user.POST("/knowledge-bases/:id/documents", perm(middleware.PermKnowledgeWrite), userController.CreateKnowledgeBaseDocument)
+				user.POST("/knowledge-bases/:id/documents/upload", perm(middleware.PermKnowledgeWrite), userController.CreateKnowledgeBaseDocumentByUpload)
+				user.PUT("/knowledge-bases/:id/documents/:doc_id", perm(middleware.PermKnowledgeWrite), userController.UpdateKnowledgeBaseDocument)
+				user.DELETE("/knowledge-bases/:id/documents/:doc_id", perm(middleware.PermKnowledgeWrite), userController.DeleteKnowledgeBaseDocument)
+				user.POST("/knowledge-bases/:id/documents/:doc_id/sync", perm(middleware.PermKnowledgeWrite), userController.SyncKnowledgeBaseDocument)
 
 				// 角色模板和音色选项
 				user.GET("/role-templates", userController.GetRoleTemplates)
-				user.GET("/voice-options", userController.GetVoiceOptions)
-				user.GET("/voice-clone/capabilities", voiceCloneController.GetCloneProviderCapabilities)
-				user.POST("/voice-clones", voiceCloneController.CreateVoiceClone)
-				user.GET("/voice-clones", voiceCloneController.GetVoiceClones)
-				user.PUT("/voice-clones/:id", voiceCloneController.UpdateVoiceClone)
-				user.DELETE("/voice-clones/:id", voiceCloneController.DeleteVoiceClone)
-				user.POST("/voice-clones/:id/retry", voiceCloneController.RetryVoiceClone)
-				user.POST("/voice-clones/:id/append-audio", voiceCloneController.AppendVoiceCloneAudio)
-				user.GET("/voice-clones/:id/preview", voiceCloneController.PreviewClonedVoice)
-				user.GET("/voice-clones/:id/audios", voiceCloneController.GetVoiceCloneAudios)
-				user.GET("/voice-clones/audios/:audio_id/file", voiceCloneController.GetVoiceCloneAudioFile)
+				user.GET("/voice-options", perm(middleware.PermVoiceRead), userController.GetVoiceOptions)
+				user.GET("/voice-clone/capabilities", perm(middleware.PermVoiceRead), voiceCloneController.GetCloneProviderCapabilities)
+				user.POST("/voice-clones", perm(middleware.PermVoiceWrite), voiceCloneController.CreateVoiceClone)
+				user.GET("/voice-clones", perm(middleware.PermVoiceRead), voiceCloneController.GetVoiceClones)
+				user.PUT("/voice-clones/:id", perm(middleware.PermVoiceWrite), voiceCloneController.UpdateVoiceClone)
+				user.DELETE("/voice-clones/:id", perm(middleware.PermVoiceWrite), voiceCloneController.DeleteVoiceClone)
+				user.POST("/voice-clones/:id/retry", perm(middleware.PermVoiceWrite), voiceCloneController.RetryVoiceClone)
+				user.POST("/voice-clones/:id/append-audio", perm(middleware.PermVoiceWrite), voiceCloneController.AppendVoiceCloneAudio)
+				user.GET("/voice-clones/:id/preview", perm(middleware.PermVoiceRead), voiceCloneController.PreviewClonedVoice)
+				user.GET("/voice-clones/:id/audios", perm(middleware.PermVoiceRead), voiceCloneController.GetVoiceCloneAudios)
+				user.GET("/voice-clones/audios/:audio_id/file", perm(middleware.PermVoiceRead), voiceCloneController.GetVoiceCloneAudioFile)
 
 				// 角色管理（暂时注释，待实现）
 				// user.GET("/roles", adminController.GetRoles)
@@ -166,57 +279,65 @@ func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 				user.GET("/tts-configs", userController.GetTTSConfigs)
 
 				// MCP接入点
-				user.GET("/agents/:id/mcp-services/options", userController.GetAgentMCPServiceOptions)
-				user.GET("/agents/:id/mcp-endpoint", userController.GetAgentMCPEndpoint)
-				user.GET("/agents/:id/openclaw-endpoint", userController.GetAgentOpenClawEndpoint)
-				user.POST("/agents/:id/openclaw-chat-test", userController.CallAgentOpenClawChatTest)
-				user.GET("/agents/:id/mcp-tools", userController.GetAgentMcpTools)
-				user.POST("/agents/:id/mcp-call", userController.CallAgentMcpTool)
-				user.GET("/devices/:id/mcp-tools", userController.GetDeviceMcpTools)
-				user.POST("/devices/:id/mcp-call", userController.CallDeviceMcpTool)
+				user.GET("/agents/:id/mcp-services/options", perm(middleware.PermAgentRead), userController.GetAgentMCPServiceOptions)
+				user.GET("/agents/:id/mcp-endpoint", perm(middleware.PermAgentWrite), userController.GetAgentMCPEndpoint)
+				user.GET("/agents/:id/openclaw-endpoint", perm(middleware.PermAgentWrite), userController.GetAgentOpenClawEndpoint)
+				user.POST("/agents/:id/openclaw-chat-test", perm(middleware.PermAgentOperate), userController.CallAgentOpenClawChatTest)
+				user.GET("/agents/:id/mcp-tools", perm(middleware.PermAgentRead), userController.GetAgentMcpTools)
+				user.GET("/agents/:id/mcp-resources", perm(middleware.PermAgentRead), userController.GetAgentMcpCatalog)
+				user.POST("/agents/:id/mcp-call", perm(middleware.PermAgentOperate), userController.CallAgentMcpTool)
+				user.GET("/devices/:id/mcp-tools", perm(middleware.PermDeviceRead), userController.GetDeviceMcpTools)
+				user.POST("/devices/:id/mcp-call", perm(middleware.PermDeviceOperate), userController.CallDeviceMcpTool)
 
 				// 消息注入
-				user.POST("/devices/inject-message", userController.InjectMessage)
+				user.POST("/devices/inject-message", perm(middleware.PermDeviceOperate), userController.InjectMessage)
 
 				// 声纹组管理
-				user.POST("/speaker-groups", speakerGroupController.CreateSpeakerGroup)
-				user.GET("/speaker-groups", speakerGroupController.GetSpeakerGroups)
-				user.GET("/speaker-groups/:id", speakerGroupController.GetSpeakerGroup)
-				user.PUT("/speaker-groups/:id", speakerGroupController.UpdateSpeakerGroup)
-				user.DELETE("/speaker-groups/:id", speakerGroupController.DeleteSpeakerGroup)
-				user.POST("/speaker-groups/:id/verify", speakerGroupController.VerifySpeakerGroup)
+				user.POST("/speaker-groups", perm(middleware.PermSpeakerWrite), speakerGroupController.CreateSpeakerGroup)
+				user.GET("/speaker-groups", perm(middleware.PermSpeakerRead), speakerGroupController.GetSpeakerGroups)
+				user.GET("/speaker-groups/:id", perm(middleware.PermSpeakerRead), speakerGroupController.GetSpeakerGroup)
+				user.PUT("/speaker-groups/:id", perm(middleware.PermSpeakerWrite), speakerGroupController.UpdateSpeakerGroup)
+				user.DELETE("/speaker-groups/:id", perm(middleware.PermSpeakerWrite), speakerGroupController.DeleteSpeakerGroup)
+				user.POST("/speaker-groups/:id/verify", perm(middleware.PermSpeakerRead), speakerGroupController.VerifySpeakerGroup)
 
 				// 声纹样本管理（注意：使用 :id 而不是 :group_id，避免路由冲突）
-				user.POST("/speaker-groups/:id/samples", speakerGroupController.AddSample)
-				user.GET("/speaker-groups/:id/samples", speakerGroupController.GetSamples)
-				user.GET("/speaker-groups/:id/samples/:sample_id/file", speakerGroupController.GetSampleFile)
-				user.DELETE("/speaker-groups/:id/samples/:sample_id", speakerGroupController.DeleteSample)
+				user.POST("/speaker-groups/:id/samples", perm(middleware.PermSpeakerWrite), speakerGroupController.AddSample)
+				user.GET("/speaker-groups/:id/samples", perm(middleware.PermSpeakerRead), speakerGroupController.GetSamples)
+				user.GET("/speaker-groups/:id/samples/:sample_id/file", perm(middleware.PermSpeakerRead), speakerGroupController.GetSampleFile)
+				user.DELETE("/speaker-groups/:id/samples/:sample_id", perm(middleware.PermSpeakerWrite), speakerGroupController.DeleteSample)
 
 				// 聊天历史
-				user.GET("/history/messages", chatHistoryController.GetMessages)
-				user.DELETE("/history/messages/:id", chatHistoryController.DeleteMessage)
-				user.GET("/history/export", chatHistoryController.ExportMessages)
-				user.GET("/history/agents/:agent_id/messages", chatHistoryController.GetMessagesByAgent)
-				user.GET("/history/messages/:id/audio", chatHistoryController.GetAudioFile)
+				user.GET("/history/messages", perm(middleware.PermHistoryRead), chatHistoryController.GetMessages)
+				user.DELETE("/history/messages/:id", perm(middleware.PermHistoryDelete), chatHistoryController.DeleteMessage)
+				user.GET("/history/export", perm(middleware.PermHistoryRead), chatHistoryController.ExportMessages)
+				user.GET("/history/agents/:agent_id/messages", perm(middleware.PermHistoryRead), chatHistoryController.GetMessagesByAgent)
+				user.GET("/history/messages/:id/audio", perm(middleware.PermHistoryRead), chatHistoryController.GetAudioFile)
 			}
 
 			// 外部OpenAPI路由（支持JWT或API Token）
 			openV1 := api.Group("/open/v1")
-			openV1.Use(middleware.OpenAPIAuth(db))
+			openV1.Use(middleware.OpenAPIAuth(db), middleware.AuditTrail(db), orgCtx)
 			{
+				// API Token 按访问范围、智能体白名单限制；JWT 请求不受影响
+				scope := middleware.RequireScope
+				agentParam := middleware.RestrictAgentParam("id")
+
 				openV1.GET("/profile", authController.GetProfile)
-				openV1.GET("/devices", userController.GetMyDevices)
-				openV1.POST("/devices", userController.CreateDevice)
-				openV1.GET("/agents", userController.GetAgents)
-				openV1.POST("/agents", userController.CreateAgent)
-				openV1.GET("/agents/:id", userController.GetAgent)
-				openV1.PUT("/agents/:id", userController.UpdateAgent)
-				openV1.DELETE("/agents/:id", userController.DeleteAgent)
-				openV1.GET("/history/messages", chatHistoryController.GetMessages)
-				openV1.GET("/history/export", chatHistoryController.ExportMessages)
-				openV1.POST("/devices/inject-message", userController.InjectMessage)
-				openV1.GET("/agents/:id/mcp-tools", userController.GetAgentMcpTools)
-				openV1.POST("/agents/:id/mcp-call", userController.CallAgentMcpTool)
+				openV1.GET("/devices", scope(middleware.ScopeDevicesRead), perm(middleware.PermDeviceRead), userController.GetMyDevices)
+				openV1.POST("/devices", scope(middleware.ScopeDevicesWrite), perm(middleware.PermDeviceWrite), userController.CreateDevice)
+				openV1.GET("/agents", scope(middleware.ScopeAgentsRead), perm(middleware.PermAgentRead), userController.GetAgents)
+				openV1.POST("/agents", scope(middleware.ScopeAgentsWrite), perm(middleware.PermAgentWrite), userController.CreateAgent)
+				openV1.GET("/agents/:id", scope(middleware.ScopeAgentsRead), agentParam, perm(middleware.PermAgentRead), userController.GetAgent)
+				openV1.PUT("/agents/:id", scope(middleware.ScopeAgentsWrite), agentParam, perm(middleware.PermAgentWrite), userController.UpdateAgent)
+				openV1.DELETE("/agents/:id", scope(middleware.ScopeAgentsWrite), agentParam, perm(middleware.PermAgentWrite), userController.DeleteAgent)
+				openV1.GET("/history/messages", scope(middleware.ScopeHistoryRead), perm(middleware.PermHistoryRead), chatHistoryController.GetMessages)
+				openV1.GET("/history/export", scope(middleware.ScopeHistoryRead), perm(middleware.PermHistoryRead), chatHistoryController.ExportMessages)
+				openV1.POST("/devices/inject-message", scope(middleware.ScopeDevicesInject), perm(middleware.PermDeviceOperate), userController.InjectMessage)
+				openV1.GET("/agents/:id/mcp-tools", scope(middleware.ScopeMCPRead), agentParam, perm(middleware.PermAgentRead), userController.GetAgentMcpTools)
+				openV1.GET("/agents/:id/mcp-resources", scope(middleware.ScopeMCPRead), agentParam, perm(middleware.PermAgentRead), userController.GetAgentMcpCatalog)
+				openV1.POST("/agents/:id/mcp-call", scope(middleware.ScopeMCPCall), agentParam, perm(middleware.PermAgentOperate), userController.CallAgentMcpTool)
+				// 智能体作为 streamable HTTP MCP 服务器，内置工具按令牌访问范围注册
+				openV1.Match([]string{http.MethodPost, http.MethodGet, http.MethodDelete}, "/agents/:id/mcp", scope(middleware.ScopeMCPRead), agentParam, perm(middleware.PermAgentRead), userController.ServeAgentMCP)
 			}
 
 			// 管理员路由
@@ -293,6 +414,9 @@ func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 				admin.GET("/mcp-configs", adminController.GetMCPConfigs)
 				admin.POST("/mcp-configs", adminController.CreateMCPConfig)
 				admin.POST("/mcp-configs/discover-tools", adminController.DiscoverMCPConfigTools)
+				admin.GET("/mcp-oauth", adminController.GetMCPOAuthStatuses)
+				admin.POST("/mcp-oauth/authorize", adminController.BeginMCPOAuth)
+				admin.DELETE("/mcp-oauth/:server_name", adminController.RevokeMCPOAuth)
 				admin.PUT("/mcp-configs/:id", adminController.UpdateMCPConfig)
 				admin.DELETE("/mcp-configs/:id", adminController.DeleteMCPConfig)
 				admin.GET("/mcp-markets", adminController.GetMCPMarkets)
@@ -338,6 +462,9 @@ func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 				admin.DELETE("/roles/global/:id", adminController.DeleteRoleNew)
 				admin.PATCH("/roles/global/:id/toggle", adminController.ToggleRoleStatus)
 				admin.PATCH("/roles/global/:id/default", adminController.SetDefaultRole)
+				admin.GET("/roles/global/:id/revisions", revisionController.ListRoleRevisions)
+				admin.GET("/roles/global/:id/revisions/:rev_id", revisionController.GetRoleRevision)
+				admin.POST("/roles/global/:id/revisions/:rev_id/rollback", revisionController.RollbackRole)
 
 				// 设备管理
 				admin.GET("/devices", adminController.GetDevices)
@@ -355,10 +482,19 @@ func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 				admin.GET("/agents/:id/openclaw-endpoint", adminController.GetAgentOpenClawEndpoint)
 				admin.POST("/agents/:id/openclaw-chat-test", adminController.CallAgentOpenClawChatTest)
 				admin.GET("/agents/:id/mcp-tools", adminController.GetAgentMcpTools)
+				admin.GET("/agents/:id/mcp-resources", adminController.GetAgentMcpCatalog)
 				admin.POST("/agents/:id/mcp-call", adminController.CallAgentMcpTool)
+				admin.GET("/agents/:id/revisions", revisionController.ListAgentRevisions)
+				admin.GET("/agents/:id/revisions/:rev_id", revisionController.GetAgentRevision)
+				admin.POST("/agents/:id/revisions/:rev_id/rollback", revisionController.RollbackAgent)
+				admin.POST("/agents/:id/revisions/:rev_id/publish", revisionController.PublishAgentRevision)
+				admin.DELETE("/agents/:id/published", revisionController.UnpublishAgent)
 				admin.GET("/devices/:id/mcp-tools", adminController.GetDeviceMcpTools)
 				admin.POST("/devices/:id/mcp-call", adminController.CallDeviceMcpTool)
 
+				// 组织（只读总览）
+				admin.GET("/organizations", organizationController.GetOrganizationsAdmin)
+
 				// 用户管理
 				admin.GET("/users", adminController.GetUsers)
 				admin.POST("/users", adminController.CreateUser)
@@ -380,6 +516,12 @@ func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 				// 一键测试配置（OTA 在 manager 内，VAD/ASR/LLM/TTS 经 WebSocket 发主程序）
 				admin.POST("/configs/test", adminController.TestConfigs)
 
+				// 审计日志（只读）
+				admin.GET("/audit", auditController.ListAuditLogs)
+				admin.GET("/audit/facets", auditController.ListAuditFacets)
+				admin.GET("/audit/export", auditController.ExportAuditLogs)
+				admin.GET("/audit/:id", auditController.GetAuditLog)
+
 				// 资源池统计
 				admin.GET("/pool/stats", poolStatsController.GetPoolStats)
 				admin.GET("/pool/stats/summary", poolStatsController.GetPoolStatsSummary)
@@ -0,0 +1,247 @@
+// Package audit 负责写入只追加的审计日志：脱敏、计算字段差异并落库。
+// HTTP 请求由 middleware.AuditTrail 自动记录，设备激活等非 HTTP 管理动作直接调用 Record。
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+	"xiaozhi/manager/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// 操作者角色
+const (
+	ActorRoleSystem   = "system"
+	ActorRoleDevice   = "device"
+	ActorRoleAPIToken = "api_token"
+)
+
+// 常用动作
+const (
+	ActionCreate   = "create"
+	ActionUpdate   = "update"
+	ActionDelete   = "delete"
+	ActionActivate = "activate"
+)
+
+const redactedValue = "***"
+
+// Entry 一条待写入的审计记录，Before/After 可以是任意可 JSON 序列化的值
+type Entry struct {
+	OrgID        uint
+	ActorID      uint
+	ActorName    string
+	ActorRole    string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Method       string
+	Path         string
+	StatusCode   int
+	Before       interface{}
+	After        interface{}
+	IP           string
+	UserAgent    string
+}
+
+// Change 单个字段的变更
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Record 脱敏并写入审计日志，写入失败只记日志，不影响业务
+func Record(db *gorm.DB, e Entry) {
+	if db == nil {
+		return
+	}
+	if err := db.Create(Build(e)).Error; err != nil {
+		log.Printf("写入审计日志失败: action=%s resource=%s/%s err=%v", e.Action, e.ResourceType, e.ResourceID, err)
+	}
+}
+
+// Build 将 Entry 转为脱敏后的 AuditLog
+func Build(e Entry) *models.AuditLog {
+	rawBefore, rawAfter := normalize(e.Before), normalize(e.After)
+	before, after := Redact(rawBefore), Redact(rawAfter)
+	entry := &models.AuditLog{
+		OrgID:        e.OrgID,
+		ActorID:      e.ActorID,
+		ActorName:    truncate(e.ActorName, 100),
+		ActorRole:    e.ActorRole,
+		Action:       truncate(e.Action, 50),
+		ResourceType: truncate(e.ResourceType, 100),
+		ResourceID:   truncate(e.ResourceID, 100),
+		Method:       e.Method,
+		Path:         truncate(e.Path, 500),
+		StatusCode:   e.StatusCode,
+		Before:       marshal(before),
+		After:        marshal(after),
+		IP:           truncate(e.IP, 64),
+		UserAgent:    truncate(e.UserAgent, 500),
+	}
+	// 差异基于脱敏前的值计算，密钥被轮换时仍能体现为一条（脱敏后的）变更
+	if diff := Diff(rawBefore, rawAfter); len(diff) > 0 {
+		for k, change := range diff {
+			if isSensitiveKey(k) {
+				diff[k] = Change{Before: redactedValue, After: redactedValue}
+			} else {
+				diff[k] = Change{Before: Redact(change.Before), After: Redact(change.After)}
+			}
+		}
+		entry.Diff = marshal(diff)
+	}
+	return entry
+}
+
+// Diff 比较两个 JSON 对象的顶层字段，返回发生变化的字段；任一方不是对象时返回 nil。
+// after 只包含提交字段（局部更新）时，未出现的字段视为未变更
+func Diff(before, after interface{}) map[string]Change {
+	b, okB := before.(map[string]interface{})
+	a, okA := after.(map[string]interface{})
+	if !okB || !okA {
+		return nil
+	}
+	out := make(map[string]Change)
+	for k, av := range a {
+		if ignoredDiffKeys[k] {
+			continue
+		}
+		bv, exists := b[k]
+		if !exists || !reflect.DeepEqual(bv, av) {
+			out[k] = Change{Before: bv, After: av}
+		}
+	}
+	return out
+}
+
+// 时间戳每次更新都会变化，不计入差异
+var ignoredDiffKeys = map[string]bool{"updated_at": true}
+
+// 敏感字段名（小写），与主服务 configtest 的 redactSensitive 保持一致并补充管理后台特有字段
+var sensitiveKeys = map[string]bool{
+	"api_key": true, "access_token": true, "token": true, "password": true, "secret": true,
+	"token_hash": true, "refresh_token": true, "client_secret": true, "pre_secret_key": true,
+	"secret_key": true, "access_key": true, "private_key": true, "authorization": true,
+}
+
+// 以这些后缀结尾的字段同样视为密钥（如 app_secret、sk_key），max_tokens 之类不受影响
+var sensitiveKeySuffixes = []string{"_key", "_secret", "_token", "_password"}
+
+func isSensitiveKey(key string) bool {
+	lower := strings.ToLower(key)
+	if sensitiveKeys[lower] {
+		return true
+	}
+	for _, suffix := range sensitiveKeySuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact 深拷贝并将敏感字段替换为 "***"；值为 JSON 字符串（如配置的 json_data）时会解析后递归脱敏
+func Redact(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, val := range x {
+			if isSensitiveKey(k) {
+				if s, ok := val.(string); ok && s == "" {
+					m[k] = s
+				} else if val == nil {
+					m[k] = nil
+				} else {
+					m[k] = redactedValue
+				}
+			} else {
+				m[k] = Redact(val)
+			}
+		}
+		return m
+	case []interface{}:
+		arr := make([]interface{}, len(x))
+		for i, val := range x {
+			arr[i] = Redact(val)
+		}
+		return arr
+	case string:
+		trimmed := strings.TrimSpace(x)
+		if len(trimmed) < 2 || (trimmed[0] != '{' && trimmed[0] != '[') {
+			return x
+		}
+		var nested interface{}
+		if err := json.Unmarshal([]byte(trimmed), &nested); err != nil {
+			return x
+		}
+		redacted, _ := json.Marshal(Redact(nested))
+		return string(redacted)
+	default:
+		return v
+	}
+}
+
+// normalize 将结构体等值转为 JSON 通用结构，[]byte（部分驱动扫描 map 时返回）转为字符串
+func normalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for k, val := range x {
+			if b, ok := val.([]byte); ok {
+				out[k] = string(b)
+			} else {
+				out[k] = val
+			}
+		}
+		// 统一经过一次 JSON 往返，使时间、数字等与 After 中的请求体可比较
+		return roundTrip(out)
+	case []byte:
+		var parsed interface{}
+		if err := json.Unmarshal(x, &parsed); err == nil {
+			return parsed
+		}
+		return string(x)
+	default:
+		return roundTrip(v)
+	}
+}
+
+func roundTrip(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil
+	}
+	return out
+}
+
+func marshal(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,165 @@
+// Package experiment 负责 A/B 实验的分组校验与结果汇总。
+// 分流在主程序获取配置时按设备哈希完成，主程序按轮次上报结果，这里按分组聚合。
+package experiment
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"xiaozhi/manager/backend/models"
+
+	"gorm.io/gorm"
+)
+
+var variantKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ValidateVariants 校验分组：至少两组，标识唯一且合法，权重非负且总和大于 0
+func ValidateVariants(variants []models.ExperimentVariant) error {
+	if len(variants) < 2 {
+		return errors.New("实验至少需要两个分组")
+	}
+	seen := make(map[string]bool, len(variants))
+	total := 0
+	for _, v := range variants {
+		if !variantKeyPattern.MatchString(v.Key) {
+			return fmt.Errorf("分组标识 %q 无效：仅支持 1-32 位字母、数字、下划线和中划线", v.Key)
+		}
+		if seen[v.Key] {
+			return fmt.Errorf("分组标识 %q 重复", v.Key)
+		}
+		seen[v.Key] = true
+		if v.Weight < 0 {
+			return fmt.Errorf("分组 %s 的权重不能为负数", v.Key)
+		}
+		total += v.Weight
+	}
+	if total == 0 {
+		return errors.New("分组权重之和必须大于 0")
+	}
+	return nil
+}
+
+// VariantResult 单个分组的汇总结果，延迟单位为毫秒，仅统计有该阶段数据的轮次
+type VariantResult struct {
+	Key                string  `json:"key"`
+	Name               string  `json:"name"`
+	Weight             int     `json:"weight"`
+	Turns              int64   `json:"turns"`
+	Devices            int64   `json:"devices"`
+	Sessions           int64   `json:"sessions"`
+	AvgLatencyMs       float64 `json:"avg_latency_ms"`
+	P50LatencyMs       int64   `json:"p50_latency_ms"`
+	P95LatencyMs       int64   `json:"p95_latency_ms"`
+	AvgLlmFirstTokenMs float64 `json:"avg_llm_first_token_ms"`
+	AvgTtsFirstFrameMs float64 `json:"avg_tts_first_frame_ms"`
+	Interruptions      int64   `json:"interruptions"`
+	InterruptionRate   float64 `json:"interruption_rate"`
+	Errors             int64   `json:"errors"`
+	ErrorRate          float64 `json:"error_rate"`
+}
+
+type variantAggregate struct {
+	Variant            string
+	Turns              int64
+	Devices            int64
+	Sessions           int64
+	LatencySamples     int64
+	AvgLatencyMs       float64
+	AvgLlmFirstTokenMs float64
+	AvgTtsFirstFrameMs float64
+	Interruptions      int64
+	Errors             int64
+}
+
+// Results 按分组汇总实验结果；已在实验中删除的分组若有数据也会返回，排在定义的分组之后
+func Results(db *gorm.DB, exp *models.Experiment) ([]VariantResult, error) {
+	var rows []variantAggregate
+	err := db.Model(&models.ExperimentTurn{}).
+		Select(`variant,
+			COUNT(*) AS turns,
+			COUNT(DISTINCT device_id) AS devices,
+			COUNT(DISTINCT session_id) AS sessions,
+			SUM(CASE WHEN turn_latency_ms > 0 THEN 1 ELSE 0 END) AS latency_samples,
+			COALESCE(AVG(CASE WHEN turn_latency_ms > 0 THEN turn_latency_ms END), 0) AS avg_latency_ms,
+			COALESCE(AVG(CASE WHEN llm_first_token_ms > 0 THEN llm_first_token_ms END), 0) AS avg_llm_first_token_ms,
+			COALESCE(AVG(CASE WHEN tts_first_frame_ms > 0 THEN tts_first_frame_ms END), 0) AS avg_tts_first_frame_ms,
+			SUM(CASE WHEN interrupted THEN 1 ELSE 0 END) AS interruptions,
+			SUM(CASE WHEN error_message <> '' THEN 1 ELSE 0 END) AS errors`).
+		Where("experiment_id = ?", exp.ID).
+		Group("variant").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]variantAggregate, len(rows))
+	for _, row := range rows {
+		byKey[row.Variant] = row
+	}
+
+	results := make([]VariantResult, 0, len(exp.Variants)+len(rows))
+	appendResult := func(key, name string, weight int) error {
+		result := VariantResult{Key: key, Name: name, Weight: weight}
+		if agg, ok := byKey[key]; ok {
+			delete(byKey, key)
+			result.Turns = agg.Turns
+			result.Devices = agg.Devices
+			result.Sessions = agg.Sessions
+			result.AvgLatencyMs = agg.AvgLatencyMs
+			result.AvgLlmFirstTokenMs = agg.AvgLlmFirstTokenMs
+			result.AvgTtsFirstFrameMs = agg.AvgTtsFirstFrameMs
+			result.Interruptions = agg.Interruptions
+			result.Errors = agg.Errors
+			if agg.Turns > 0 {
+				result.InterruptionRate = float64(agg.Interruptions) / float64(agg.Turns)
+				result.ErrorRate = float64(agg.Errors) / float64(agg.Turns)
+			}
+			var err error
+			if result.P50LatencyMs, err = latencyPercentile(db, exp.ID, key, agg.LatencySamples, 0.5); err != nil {
+				return err
+			}
+			if result.P95LatencyMs, err = latencyPercentile(db, exp.ID, key, agg.LatencySamples, 0.95); err != nil {
+				return err
+			}
+		}
+		results = append(results, result)
+		return nil
+	}
+	for _, v := range exp.Variants {
+		if err := appendResult(v.Key, v.Name, v.Weight); err != nil {
+			return nil, err
+		}
+	}
+	for _, row := range rows {
+		if _, ok := byKey[row.Variant]; ok {
+			if err := appendResult(row.Variant, "", 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return results, nil
+}
+
+// latencyPercentile 取整轮延迟的分位数（最近秩法），直接在数据库中排序定位，避免整表载入内存
+func latencyPercentile(db *gorm.DB, experimentID uint, variant string, samples int64, p float64) (int64, error) {
+	if samples <= 0 {
+		return 0, nil
+	}
+	rank := int64(math.Ceil(float64(samples)*p)) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= samples {
+		rank = samples - 1
+	}
+	var values []int64
+	err := db.Model(&models.ExperimentTurn{}).
+		Where("experiment_id = ? AND variant = ? AND turn_latency_ms > 0", experimentID, variant).
+		Order("turn_latency_ms ASC").
+		Offset(int(rank)).Limit(1).
+		Pluck("turn_latency_ms", &values).Error
+	if err != nil || len(values) == 0 {
+		return 0, err
+	}
+	return values[0], nil
+}
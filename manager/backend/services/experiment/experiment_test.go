@@ -0,0 +1,77 @@
+package experiment
+
+import (
+	"testing"
+	"xiaozhi/manager/backend/database/dbtest"
+	"xiaozhi/manager/backend/models"
+)
+
+func TestValidateVariants(t *testing.T) {
+	cases := []struct {
+		name     string
+		variants []models.ExperimentVariant
+		ok       bool
+	}{
+		{"valid", []models.ExperimentVariant{{Key: "A", Weight: 50}, {Key: "B", Weight: 50}}, true},
+		{"single", []models.ExperimentVariant{{Key: "A", Weight: 1}}, false},
+		{"duplicate", []models.ExperimentVariant{{Key: "A", Weight: 1}, {Key: "A", Weight: 1}}, false},
+		{"bad key", []models.ExperimentVariant{{Key: "a b", Weight: 1}, {Key: "B", Weight: 1}}, false},
+		{"negative", []models.ExperimentVariant{{Key: "A", Weight: -1}, {Key: "B", Weight: 2}}, false},
+		{"zero total", []models.ExperimentVariant{{Key: "A"}, {Key: "B"}}, false},
+	}
+	for _, tc := range cases {
+		if err := ValidateVariants(tc.variants); (err == nil) != tc.ok {
+			t.Errorf("%s: err = %v, want ok=%v", tc.name, err, tc.ok)
+		}
+	}
+}
+
+func TestResults(t *testing.T) {
+	db := dbtest.Open(t, &models.ExperimentTurn{})
+	exp := &models.Experiment{ID: 1, Variants: []models.ExperimentVariant{
+		{Key: "A", Name: "对照组", Weight: 50},
+		{Key: "B", Name: "新提示词", Weight: 50},
+		{Key: "C", Weight: 0},
+	}}
+	turns := []models.ExperimentTurn{
+		{ExperimentID: 1, Variant: "A", DeviceID: "d1", SessionID: "s1", TurnLatencyMs: 1000, LlmFirstTokenMs: 300},
+		{ExperimentID: 1, Variant: "A", DeviceID: "d1", SessionID: "s1", TurnLatencyMs: 2000, LlmFirstTokenMs: 500},
+		{ExperimentID: 1, Variant: "A", DeviceID: "d2", SessionID: "s2", TurnLatencyMs: 3000, Interrupted: true},
+		{ExperimentID: 1, Variant: "A", DeviceID: "d2", SessionID: "s2", ErrorMessage: "llm timeout"},
+		{ExperimentID: 1, Variant: "B", DeviceID: "d3", SessionID: "s3", TurnLatencyMs: 800},
+		{ExperimentID: 1, Variant: "old", DeviceID: "d4", SessionID: "s4", TurnLatencyMs: 900},
+		{ExperimentID: 2, Variant: "A", DeviceID: "d5", SessionID: "s5", TurnLatencyMs: 9000},
+	}
+	if err := db.Create(&turns).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Results(db, exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 || results[3].Key != "old" {
+		t.Fatalf("expected defined variants followed by removed ones, got %+v", results)
+	}
+
+	a := results[0]
+	if a.Turns != 4 || a.Devices != 2 || a.Sessions != 2 {
+		t.Fatalf("variant A counts = %+v", a)
+	}
+	if a.AvgLatencyMs != 2000 || a.P50LatencyMs != 2000 || a.P95LatencyMs != 3000 {
+		t.Fatalf("variant A latency = avg %v p50 %d p95 %d", a.AvgLatencyMs, a.P50LatencyMs, a.P95LatencyMs)
+	}
+	if a.AvgLlmFirstTokenMs != 400 {
+		t.Fatalf("variant A llm first token avg = %v, want 400", a.AvgLlmFirstTokenMs)
+	}
+	if a.Interruptions != 1 || a.InterruptionRate != 0.25 || a.Errors != 1 || a.ErrorRate != 0.25 {
+		t.Fatalf("variant A outcomes = %+v", a)
+	}
+
+	if results[1].Turns != 1 || results[1].P95LatencyMs != 800 {
+		t.Fatalf("variant B = %+v", results[1])
+	}
+	if results[2].Turns != 0 || results[2].P50LatencyMs != 0 {
+		t.Fatalf("variant C without traffic should be empty, got %+v", results[2])
+	}
+}
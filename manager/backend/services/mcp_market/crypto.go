@@ -34,6 +34,12 @@ func loadSecretKey() ([]byte, error) {
 	return rawKey, nil
 }
 
+// CheckSecretKey 校验加密密钥已正确配置，用于在写入敏感数据前提前报错
+func CheckSecretKey() error {
+	_, err := loadSecretKey()
+	return err
+}
+
 func EncryptText(plain string) (ciphertextB64, nonceB64 string, err error) {
 	if plain == "" {
 		return "", "", nil
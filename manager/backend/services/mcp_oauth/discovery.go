@@ -0,0 +1,203 @@
+package mcp_oauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ProtectedResourceMetadata RFC 9728 受保护资源元数据
+type ProtectedResourceMetadata struct {
+	Resource             string   `json:"resource"`
+	AuthorizationServers []string `json:"authorization_servers"`
+	ScopesSupported      []string `json:"scopes_supported,omitempty"`
+}
+
+// AuthServerMetadata RFC 8414 授权服务器元数据
+type AuthServerMetadata struct {
+	Issuer                        string   `json:"issuer"`
+	AuthorizationEndpoint         string   `json:"authorization_endpoint"`
+	TokenEndpoint                 string   `json:"token_endpoint"`
+	RegistrationEndpoint          string   `json:"registration_endpoint,omitempty"`
+	ScopesSupported               []string `json:"scopes_supported,omitempty"`
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported,omitempty"`
+}
+
+// Discovery 一次发现的结果
+type Discovery struct {
+	Resource string
+	Scopes   []string // 资源声明支持的 scope，未指定 scope 时使用
+	Server   AuthServerMetadata
+}
+
+var resourceMetadataParam = regexp.MustCompile(`resource_metadata="([^"]+)"`)
+
+// Discover 按 MCP 授权规范发现授权服务器：
+// 先取受保护资源元数据（401 响应的 WWW-Authenticate 或 /.well-known/oauth-protected-resource），
+// 再取授权服务器元数据（RFC 8414 / OIDC），都没有时回退到 MCP 服务器同源的默认端点
+func Discover(ctx context.Context, client *http.Client, serverURL string) (*Discovery, error) {
+	u, err := url.Parse(strings.TrimSpace(serverURL))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("MCP 服务器地址无效: %s", serverURL)
+	}
+	origin := u.Scheme + "://" + u.Host
+
+	d := &Discovery{Resource: canonicalResource(u)}
+	issuer := origin
+
+	var prm ProtectedResourceMetadata
+	candidates := make([]string, 0, 3)
+	if metaURL := probeResourceMetadataURL(ctx, client, u.String()); metaURL != "" {
+		candidates = append(candidates, metaURL)
+	}
+	candidates = append(candidates, wellKnownURLs(u, "oauth-protected-resource")...)
+	for _, candidate := range candidates {
+		if getJSON(ctx, client, candidate, &prm) == nil && len(prm.AuthorizationServers) > 0 {
+			issuer = strings.TrimRight(prm.AuthorizationServers[0], "/")
+			if prm.Resource != "" {
+				d.Resource = prm.Resource
+			}
+			d.Scopes = prm.ScopesSupported
+			break
+		}
+	}
+
+	issuerURL, err := url.Parse(issuer)
+	if err != nil || issuerURL.Host == "" {
+		return nil, fmt.Errorf("授权服务器地址无效: %s", issuer)
+	}
+	metaCandidates := append(wellKnownURLs(issuerURL, "oauth-authorization-server"), wellKnownURLs(issuerURL, "openid-configuration")...)
+	metaCandidates = append(metaCandidates, issuer+"/.well-known/openid-configuration")
+	for _, candidate := range metaCandidates {
+		var meta AuthServerMetadata
+		if getJSON(ctx, client, candidate, &meta) == nil && meta.AuthorizationEndpoint != "" && meta.TokenEndpoint != "" {
+			d.Server = meta
+			return d, nil
+		}
+	}
+
+	// 早期 MCP 规范约定的默认端点
+	d.Server = AuthServerMetadata{
+		Issuer:                issuer,
+		AuthorizationEndpoint: issuer + "/authorize",
+		TokenEndpoint:         issuer + "/token",
+		RegistrationEndpoint:  issuer + "/register",
+	}
+	return d, nil
+}
+
+// canonicalResource 资源标识：去掉 query/fragment 与末尾斜杠
+func canonicalResource(u *url.URL) string {
+	c := *u
+	c.RawQuery = ""
+	c.Fragment = ""
+	c.Scheme = strings.ToLower(c.Scheme)
+	c.Host = strings.ToLower(c.Host)
+	return strings.TrimRight(c.String(), "/")
+}
+
+// wellKnownURLs 带路径的地址优先尝试 /.well-known/<name>/<path>，再尝试根路径
+func wellKnownURLs(u *url.URL, name string) []string {
+	origin := u.Scheme + "://" + u.Host
+	ret := make([]string, 0, 2)
+	if p := strings.TrimRight(u.EscapedPath(), "/"); p != "" {
+		ret = append(ret, origin+"/.well-known/"+name+p)
+	}
+	return append(ret, origin+"/.well-known/"+name)
+}
+
+// probeResourceMetadataURL 未带令牌访问 MCP 服务器，从 401 响应的 WWW-Authenticate 中读取资源元数据地址
+func probeResourceMetadataURL(ctx context.Context, client *http.Client, serverURL string) string {
+	body := []byte(`{"jsonrpc":"2.0","id":0,"method":"ping"}`)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, serverURL, bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	resp, err := client.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusUnauthorized {
+		return ""
+	}
+	for _, header := range resp.Header.Values("WWW-Authenticate") {
+		if m := resourceMetadataParam.FindStringSubmatch(header); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+func getJSON(ctx context.Context, client *http.Client, target string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// registrationRequest RFC 7591 动态客户端注册请求（公共客户端，依赖 PKCE）
+type registrationRequest struct {
+	ClientName              string   `json:"client_name"`
+	RedirectURIs            []string `json:"redirect_uris"`
+	GrantTypes              []string `json:"grant_types"`
+	ResponseTypes           []string `json:"response_types"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	Scope                   string   `json:"scope,omitempty"`
+}
+
+type registrationResponse struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// registerClient 向授权服务器动态注册客户端
+func registerClient(ctx context.Context, client *http.Client, endpoint, clientName, redirectURI string, scopes []string) (*registrationResponse, error) {
+	payload, _ := json.Marshal(registrationRequest{
+		ClientName:              clientName,
+		RedirectURIs:            []string{redirectURI},
+		GrantTypes:              []string{"authorization_code", "refresh_token"},
+		ResponseTypes:           []string{"code"},
+		TokenEndpointAuthMethod: "none",
+		Scope:                   strings.Join(scopes, " "),
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("动态注册客户端失败: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("动态注册客户端失败: HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var ret registrationResponse
+	if err := json.Unmarshal(body, &ret); err != nil || ret.ClientID == "" {
+		return nil, fmt.Errorf("动态注册客户端失败: 响应中缺少 client_id")
+	}
+	return &ret, nil
+}
@@ -0,0 +1,483 @@
+package mcp_oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"xiaozhi/manager/backend/models"
+	mcpmarket "xiaozhi/manager/backend/services/mcp_market"
+
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// 授权状态
+const (
+	StatusPending        = "pending"         // 已发起授权，等待用户在授权页确认
+	StatusAuthorized     = "authorized"      // 令牌可用
+	StatusReauthRequired = "reauth_required" // 刷新失败或令牌失效，需要管理员重新授权
+)
+
+// AuthRef 全局 MCP 服务器配置中 auth_ref 取该值时，主程序按服务器名称向 manager 获取访问令牌
+const AuthRef = "oauth"
+
+const pendingAuthTTL = 10 * time.Minute
+
+var (
+	ErrNotAuthorized  = errors.New("MCP 服务器尚未完成 OAuth 授权")
+	ErrReauthRequired = errors.New("OAuth 令牌已失效，需要重新授权")
+	ErrInvalidState   = errors.New("授权状态无效或已过期，请重新发起授权")
+)
+
+// Options 服务参数
+type Options struct {
+	HTTPClient   *http.Client
+	PublicURL    string        // manager 对外访问地址，用于拼接授权回调地址；为空时按请求推断
+	ClientName   string        // 动态注册时使用的客户端名称
+	RefreshSkew  time.Duration // 令牌到期前多久开始刷新
+	PollInterval time.Duration // 后台检查即将到期令牌的间隔
+}
+
+func (o *Options) setDefaults() {
+	if o.HTTPClient == nil {
+		o.HTTPClient = &http.Client{Timeout: 15 * time.Second}
+	}
+	if o.ClientName == "" {
+		o.ClientName = "xiaozhi-manager"
+	}
+	if o.RefreshSkew <= 0 {
+		o.RefreshSkew = 5 * time.Minute
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = time.Minute
+	}
+}
+
+// Service 全局 MCP 服务器的 OAuth 2.1 授权：发现、动态注册、授权码 + PKCE、加密存储与自动刷新
+type Service struct {
+	db   *gorm.DB
+	opts Options
+
+	refreshMu sync.Mutex // 串行化刷新，避免并发刷新使轮换后的 refresh token 失效
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+var (
+	defaultService *Service
+	initOnce       sync.Once
+)
+
+// Init 初始化全局服务并启动后台刷新（只生效一次）
+func Init(db *gorm.DB, opts Options) *Service {
+	initOnce.Do(func() {
+		defaultService = NewService(db, opts)
+		defaultService.Start()
+	})
+	return defaultService
+}
+
+// Default 返回全局服务，未初始化时返回 nil
+func Default() *Service {
+	return defaultService
+}
+
+// NewService 创建服务
+func NewService(db *gorm.DB, opts Options) *Service {
+	opts.setDefaults()
+	return &Service{db: db, opts: opts, stop: make(chan struct{})}
+}
+
+// PublicURL manager 对外访问地址
+func (s *Service) PublicURL() string {
+	return s.opts.PublicURL
+}
+
+// Start 启动后台刷新协程
+func (s *Service) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.opts.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.RefreshDue(context.Background())
+			}
+		}
+	}()
+}
+
+// Stop 停止后台刷新
+func (s *Service) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// BeginRequest 发起授权参数
+type BeginRequest struct {
+	ServerName   string
+	ServerURL    string
+	RedirectURI  string
+	Scopes       []string
+	ClientID     string // 授权服务器不支持动态注册时手动填写
+	ClientSecret string
+}
+
+// Begin 发现授权服务器、必要时动态注册客户端，返回带 PKCE 的授权地址
+func (s *Service) Begin(ctx context.Context, req BeginRequest) (string, error) {
+	name := strings.TrimSpace(req.ServerName)
+	if name == "" || strings.TrimSpace(req.ServerURL) == "" {
+		return "", fmt.Errorf("服务器名称和地址不能为空")
+	}
+	if err := mcpmarket.CheckSecretKey(); err != nil {
+		return "", fmt.Errorf("令牌需加密存储: %w", err)
+	}
+
+	row, err := s.load(name)
+	if err != nil && !errors.Is(err, ErrNotAuthorized) {
+		return "", err
+	}
+	if row == nil {
+		row = &models.MCPOAuthToken{ServerName: name, Status: StatusPending}
+	}
+
+	d, err := Discover(ctx, s.opts.HTTPClient, req.ServerURL)
+	if err != nil {
+		return "", err
+	}
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = d.Scopes
+	}
+
+	clientID := strings.TrimSpace(req.ClientID)
+	clientSecret := strings.TrimSpace(req.ClientSecret)
+	if clientID == "" && row.ClientID != "" && row.TokenEndpoint == d.Server.TokenEndpoint && row.RedirectURI == req.RedirectURI {
+		// 沿用已注册的客户端，避免每次授权都向授权服务器注册新客户端
+		clientID = row.ClientID
+		if clientSecret, err = mcpmarket.DecryptText(row.ClientSecretCiphertext, row.ClientSecretNonce); err != nil {
+			return "", err
+		}
+	}
+	if clientID == "" {
+		if d.Server.RegistrationEndpoint == "" {
+			return "", fmt.Errorf("授权服务器不支持动态客户端注册，请手动填写 Client ID")
+		}
+		reg, err := registerClient(ctx, s.opts.HTTPClient, d.Server.RegistrationEndpoint, s.opts.ClientName, req.RedirectURI, scopes)
+		if err != nil {
+			return "", err
+		}
+		clientID, clientSecret = reg.ClientID, reg.ClientSecret
+	}
+	secretCT, secretNonce, err := mcpmarket.EncryptText(clientSecret)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+	pendingExpiresAt := time.Now().Add(pendingAuthTTL)
+
+	row.ServerURL = strings.TrimSpace(req.ServerURL)
+	row.Issuer = d.Server.Issuer
+	row.AuthorizationEndpoint = d.Server.AuthorizationEndpoint
+	row.TokenEndpoint = d.Server.TokenEndpoint
+	row.Resource = d.Resource
+	row.RedirectURI = req.RedirectURI
+	row.ClientID = clientID
+	row.ClientSecretCiphertext, row.ClientSecretNonce = secretCT, secretNonce
+	row.Scopes = strings.Join(scopes, " ")
+	row.PendingState = state
+	row.PendingVerifier = verifier
+	row.PendingExpiresAt = &pendingExpiresAt
+	if row.AccessTokenCiphertext == "" {
+		row.Status = StatusPending
+	}
+	if err := s.db.Save(row).Error; err != nil {
+		return "", err
+	}
+
+	conf, err := s.oauth2Config(row)
+	if err != nil {
+		return "", err
+	}
+	return conf.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oauth2.SetAuthURLParam("resource", row.Resource)), nil
+}
+
+// Finish 处理授权回调：校验 state，用授权码与 PKCE verifier 换取令牌并加密保存，返回服务器名称
+func (s *Service) Finish(ctx context.Context, state, code string) (string, error) {
+	if strings.TrimSpace(state) == "" {
+		return "", ErrInvalidState
+	}
+	var row models.MCPOAuthToken
+	if err := s.db.Where("pending_state = ?", state).First(&row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrInvalidState
+		}
+		return "", err
+	}
+	verifier, expiresAt := row.PendingVerifier, row.PendingExpiresAt
+	// state 只能使用一次
+	row.PendingState, row.PendingVerifier, row.PendingExpiresAt = "", "", nil
+	if expiresAt == nil || time.Now().After(*expiresAt) {
+		s.db.Save(&row)
+		return row.ServerName, ErrInvalidState
+	}
+	if strings.TrimSpace(code) == "" {
+		s.db.Save(&row)
+		return row.ServerName, fmt.Errorf("授权回调缺少授权码")
+	}
+
+	conf, err := s.oauth2Config(&row)
+	if err != nil {
+		return row.ServerName, err
+	}
+	token, err := conf.Exchange(s.httpContext(ctx), code, oauth2.VerifierOption(verifier), oauth2.SetAuthURLParam("resource", row.Resource))
+	if err != nil {
+		row.LastError = fmt.Sprintf("授权码换取令牌失败: %v", err)
+		s.db.Save(&row)
+		return row.ServerName, errors.New(row.LastError)
+	}
+	if err := s.storeToken(&row, token); err != nil {
+		return row.ServerName, err
+	}
+	return row.ServerName, nil
+}
+
+// Token 主程序使用的访问令牌
+type Token struct {
+	AccessToken string     `json:"access_token"`
+	TokenType   string     `json:"token_type"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// AccessToken 返回服务器当前可用的访问令牌，即将到期时先刷新
+func (s *Service) AccessToken(ctx context.Context, serverName string) (*Token, error) {
+	row, err := s.load(serverName)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case row.Status == StatusReauthRequired:
+		return nil, ErrReauthRequired
+	case row.AccessTokenCiphertext == "":
+		return nil, ErrNotAuthorized
+	}
+
+	if s.needsRefresh(row) {
+		refreshed, err := s.refresh(ctx, serverName)
+		switch {
+		case err == nil:
+			row = refreshed
+		case errors.Is(err, ErrReauthRequired):
+			return nil, err
+		case row.ExpiresAt != nil && time.Now().After(*row.ExpiresAt):
+			return nil, err
+		default:
+			// 刷新暂时失败但令牌尚未过期，继续使用旧令牌，由后台稍后重试
+			log.Printf("[MCP OAuth] 刷新令牌失败，继续使用当前令牌: server=%s err=%v", serverName, err)
+		}
+	}
+
+	access, err := mcpmarket.DecryptText(row.AccessTokenCiphertext, row.AccessTokenNonce)
+	if err != nil {
+		return nil, err
+	}
+	tokenType := row.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	return &Token{AccessToken: access, TokenType: tokenType, ExpiresAt: row.ExpiresAt}, nil
+}
+
+// RefreshDue 刷新即将到期的令牌；没有 refresh token 且已过期的标记为需要重新授权
+func (s *Service) RefreshDue(ctx context.Context) {
+	var rows []models.MCPOAuthToken
+	deadline := time.Now().Add(s.opts.RefreshSkew)
+	if err := s.db.Where("status = ? AND expires_at IS NOT NULL AND expires_at < ?", StatusAuthorized, deadline).Find(&rows).Error; err != nil {
+		log.Printf("[MCP OAuth] 查询待刷新令牌失败: %v", err)
+		return
+	}
+	for i := range rows {
+		row := &rows[i]
+		if row.RefreshTokenCiphertext == "" {
+			if time.Now().After(*row.ExpiresAt) {
+				s.markReauth(row, "令牌已过期且授权服务器未下发 refresh token")
+			}
+			continue
+		}
+		if _, err := s.refresh(ctx, row.ServerName); err != nil {
+			log.Printf("[MCP OAuth] 刷新令牌失败: server=%s err=%v", row.ServerName, err)
+		}
+	}
+}
+
+// List 全部服务器的授权状态
+func (s *Service) List() ([]models.MCPOAuthToken, error) {
+	var rows []models.MCPOAuthToken
+	if err := s.db.Order("server_name ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// Revoke 删除服务器的授权信息（含已注册的客户端）
+func (s *Service) Revoke(serverName string) error {
+	return s.db.Where("server_name = ?", strings.TrimSpace(serverName)).Delete(&models.MCPOAuthToken{}).Error
+}
+
+func (s *Service) load(serverName string) (*models.MCPOAuthToken, error) {
+	var row models.MCPOAuthToken
+	if err := s.db.Where("server_name = ?", strings.TrimSpace(serverName)).First(&row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotAuthorized
+		}
+		return nil, err
+	}
+	return &row, nil
+}
+
+func (s *Service) needsRefresh(row *models.MCPOAuthToken) bool {
+	return row.ExpiresAt != nil && time.Until(*row.ExpiresAt) < s.opts.RefreshSkew
+}
+
+// refresh 使用 refresh token 换取新令牌。授权服务器以 4xx 拒绝时标记为需要重新授权，网络等临时错误保留原状态
+func (s *Service) refresh(ctx context.Context, serverName string) (*models.MCPOAuthToken, error) {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	// 拿到锁后重新读取，可能已被其它调用刷新
+	row, err := s.load(serverName)
+	if err != nil {
+		return nil, err
+	}
+	if row.Status == StatusReauthRequired {
+		return nil, ErrReauthRequired
+	}
+	if !s.needsRefresh(row) {
+		return row, nil
+	}
+	if row.RefreshTokenCiphertext == "" {
+		if time.Now().After(*row.ExpiresAt) {
+			s.markReauth(row, "令牌已过期且授权服务器未下发 refresh token")
+			return nil, ErrReauthRequired
+		}
+		return row, nil
+	}
+
+	refreshToken, err := mcpmarket.DecryptText(row.RefreshTokenCiphertext, row.RefreshTokenNonce)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := s.oauth2Config(row)
+	if err != nil {
+		return nil, err
+	}
+	expired := &oauth2.Token{RefreshToken: refreshToken, Expiry: time.Now().Add(-time.Second)}
+	token, err := conf.TokenSource(s.httpContext(ctx), expired).Token()
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) && retrieveErr.Response != nil &&
+			retrieveErr.Response.StatusCode >= 400 && retrieveErr.Response.StatusCode < 500 {
+			s.markReauth(row, fmt.Sprintf("刷新令牌被拒绝: %v", err))
+			return nil, ErrReauthRequired
+		}
+		row.LastError = fmt.Sprintf("刷新令牌失败: %v", err)
+		s.db.Model(row).Update("last_error", row.LastError)
+		return nil, err
+	}
+	if err := s.storeToken(row, token); err != nil {
+		return nil, err
+	}
+	log.Printf("[MCP OAuth] 令牌已刷新: server=%s", serverName)
+	return row, nil
+}
+
+func (s *Service) markReauth(row *models.MCPOAuthToken, reason string) {
+	row.Status = StatusReauthRequired
+	row.LastError = reason
+	if err := s.db.Model(row).Updates(map[string]interface{}{"status": row.Status, "last_error": reason}).Error; err != nil {
+		log.Printf("[MCP OAuth] 更新授权状态失败: server=%s err=%v", row.ServerName, err)
+	}
+	log.Printf("[MCP OAuth] 需要重新授权: server=%s reason=%s", row.ServerName, reason)
+}
+
+// storeToken 加密保存令牌；授权服务器未轮换 refresh token 时保留原值
+func (s *Service) storeToken(row *models.MCPOAuthToken, token *oauth2.Token) error {
+	accessCT, accessNonce, err := mcpmarket.EncryptText(token.AccessToken)
+	if err != nil {
+		return err
+	}
+	row.AccessTokenCiphertext, row.AccessTokenNonce = accessCT, accessNonce
+	if token.RefreshToken != "" {
+		refreshCT, refreshNonce, err := mcpmarket.EncryptText(token.RefreshToken)
+		if err != nil {
+			return err
+		}
+		row.RefreshTokenCiphertext, row.RefreshTokenNonce = refreshCT, refreshNonce
+	}
+	row.TokenType = token.TokenType
+	row.ExpiresAt = nil
+	if !token.Expiry.IsZero() {
+		expiry := token.Expiry
+		row.ExpiresAt = &expiry
+	}
+	now := time.Now()
+	row.LastRefreshedAt = &now
+	row.LastError = ""
+	row.Status = StatusAuthorized
+	return s.db.Save(row).Error
+}
+
+func (s *Service) oauth2Config(row *models.MCPOAuthToken) (*oauth2.Config, error) {
+	secret, err := mcpmarket.DecryptText(row.ClientSecretCiphertext, row.ClientSecretNonce)
+	if err != nil {
+		return nil, err
+	}
+	authStyle := oauth2.AuthStyleAutoDetect
+	if secret == "" {
+		// 公共客户端：client_id 放在请求体中
+		authStyle = oauth2.AuthStyleInParams
+	}
+	var scopes []string
+	if row.Scopes != "" {
+		scopes = strings.Fields(row.Scopes)
+	}
+	return &oauth2.Config{
+		ClientID:     row.ClientID,
+		ClientSecret: secret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   row.AuthorizationEndpoint,
+			TokenURL:  row.TokenEndpoint,
+			AuthStyle: authStyle,
+		},
+		RedirectURL: row.RedirectURI,
+		Scopes:      scopes,
+	}, nil
+}
+
+func (s *Service) httpContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, s.opts.HTTPClient)
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,246 @@
+package mcp_oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+	"xiaozhi/manager/backend/database/dbtest"
+	"xiaozhi/manager/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// mockAuthServer 本地模拟的 MCP 资源服务器 + 授权服务器
+type mockAuthServer struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	registrations int
+	challenges    map[string]string // code -> code_challenge
+	refreshToken  string
+	issued        int
+	expiresIn     int
+	rejectRefresh bool
+	lastResource  string
+}
+
+func newMockAuthServer(t *testing.T) *mockAuthServer {
+	m := &mockAuthServer{challenges: map[string]string{}, expiresIn: 3600}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mcp", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer resource_metadata="%s/.well-known/oauth-protected-resource/mcp"`, m.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	mux.HandleFunc("/.well-known/oauth-protected-resource/mcp", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ProtectedResourceMetadata{
+			Resource:             m.URL + "/mcp",
+			AuthorizationServers: []string{m.URL + "/auth"},
+			ScopesSupported:      []string{"tools"},
+		})
+	})
+	mux.HandleFunc("/.well-known/oauth-authorization-server/auth", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(AuthServerMetadata{
+			Issuer:                        m.URL + "/auth",
+			AuthorizationEndpoint:         m.URL + "/auth/authorize",
+			TokenEndpoint:                 m.URL + "/auth/token",
+			RegistrationEndpoint:          m.URL + "/auth/register",
+			CodeChallengeMethodsSupported: []string{"S256"},
+		})
+	})
+	mux.HandleFunc("/auth/register", func(w http.ResponseWriter, r *http.Request) {
+		var req registrationRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if len(req.RedirectURIs) != 1 || req.TokenEndpointAuthMethod != "none" {
+			http.Error(w, "bad registration", http.StatusBadRequest)
+			return
+		}
+		m.mu.Lock()
+		m.registrations++
+		m.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(registrationResponse{ClientID: "dyn-client"})
+	})
+	mux.HandleFunc("/auth/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("client_id") != "dyn-client" || q.Get("code_challenge_method") != "S256" || q.Get("resource") != m.URL+"/mcp" {
+			http.Error(w, "bad authorize request", http.StatusBadRequest)
+			return
+		}
+		code := fmt.Sprintf("code-%d", time.Now().UnixNano())
+		m.mu.Lock()
+		m.challenges[code] = q.Get("code_challenge")
+		m.mu.Unlock()
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code="+code+"&state="+url.QueryEscape(q.Get("state")), http.StatusFound)
+	})
+	mux.HandleFunc("/auth/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if r.Form.Get("client_id") != "dyn-client" {
+			tokenError(w, "invalid_client")
+			return
+		}
+		switch r.Form.Get("grant_type") {
+		case "authorization_code":
+			challenge, ok := m.challenges[r.Form.Get("code")]
+			delete(m.challenges, r.Form.Get("code"))
+			sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+			if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+				tokenError(w, "invalid_grant")
+				return
+			}
+			m.lastResource = r.Form.Get("resource")
+		case "refresh_token":
+			if m.rejectRefresh || r.Form.Get("refresh_token") != m.refreshToken {
+				tokenError(w, "invalid_grant")
+				return
+			}
+		default:
+			tokenError(w, "unsupported_grant_type")
+			return
+		}
+		m.issued++
+		m.refreshToken = fmt.Sprintf("rt-%d", m.issued)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  fmt.Sprintf("at-%d", m.issued),
+			"token_type":    "bearer",
+			"refresh_token": m.refreshToken,
+			"expires_in":    m.expiresIn,
+		})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+// authorize 模拟用户在授权页确认，返回回调中的 code 和 state
+func authorize(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d", resp.StatusCode)
+	}
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc.Query().Get("code"), loc.Query().Get("state")
+}
+
+func expireSoon(t *testing.T, db *gorm.DB, name string) {
+	t.Helper()
+	if err := db.Model(&models.MCPOAuthToken{}).Where("server_name = ?", name).
+		Update("expires_at", time.Now().Add(time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOAuthFlow(t *testing.T) {
+	t.Setenv("MCP_MARKET_SECRET_KEY", "0123456789abcdef0123456789abcdef")
+	as := newMockAuthServer(t)
+	db := dbtest.Open(t, &models.MCPOAuthToken{})
+	svc := NewService(db, Options{})
+	ctx := context.Background()
+
+	if _, err := svc.AccessToken(ctx, "remote"); !errors.Is(err, ErrNotAuthorized) {
+		t.Fatalf("want ErrNotAuthorized, got %v", err)
+	}
+
+	authURL, err := svc.Begin(ctx, BeginRequest{ServerName: "remote", ServerURL: as.URL + "/mcp", RedirectURI: "http://manager.local/api/mcp-oauth/callback"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := authorize(t, authURL)
+	name, err := svc.Finish(ctx, state, code)
+	if err != nil || name != "remote" {
+		t.Fatalf("finish: name=%q err=%v", name, err)
+	}
+	if as.lastResource != as.URL+"/mcp" {
+		t.Fatalf("resource = %q", as.lastResource)
+	}
+	if _, err := svc.Finish(ctx, state, code); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("state should be single use, got %v", err)
+	}
+
+	token, err := svc.AccessToken(ctx, "remote")
+	if err != nil || token.AccessToken != "at-1" || token.TokenType != "Bearer" {
+		t.Fatalf("token = %+v err=%v", token, err)
+	}
+
+	// 令牌以密文落库
+	var row models.MCPOAuthToken
+	db.Where("server_name = ?", "remote").First(&row)
+	if row.AccessTokenCiphertext == "" || row.AccessTokenCiphertext == "at-1" || row.Scopes != "tools" {
+		t.Fatalf("unexpected stored row: %+v", row)
+	}
+
+	// 即将到期时按需刷新，refresh token 轮换
+	expireSoon(t, db, "remote")
+	if token, err = svc.AccessToken(ctx, "remote"); err != nil || token.AccessToken != "at-2" {
+		t.Fatalf("refreshed token = %+v err=%v", token, err)
+	}
+
+	// 后台刷新
+	expireSoon(t, db, "remote")
+	svc.RefreshDue(ctx)
+	if token, _ = svc.AccessToken(ctx, "remote"); token.AccessToken != "at-3" {
+		t.Fatalf("background refresh token = %+v", token)
+	}
+
+	// 重新授权沿用已注册客户端
+	if _, err := svc.Begin(ctx, BeginRequest{ServerName: "remote", ServerURL: as.URL + "/mcp", RedirectURI: "http://manager.local/api/mcp-oauth/callback"}); err != nil {
+		t.Fatal(err)
+	}
+	if as.registrations != 1 {
+		t.Fatalf("registrations = %d, want 1", as.registrations)
+	}
+
+	// 刷新被拒绝后需要重新授权
+	as.mu.Lock()
+	as.rejectRefresh = true
+	as.mu.Unlock()
+	expireSoon(t, db, "remote")
+	if _, err := svc.AccessToken(ctx, "remote"); !errors.Is(err, ErrReauthRequired) {
+		t.Fatalf("want ErrReauthRequired, got %v", err)
+	}
+	db.Where("server_name = ?", "remote").First(&row)
+	if row.Status != StatusReauthRequired || row.LastError == "" {
+		t.Fatalf("status = %s last_error = %q", row.Status, row.LastError)
+	}
+
+	if err := svc.Revoke("remote"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.AccessToken(ctx, "remote"); !errors.Is(err, ErrNotAuthorized) {
+		t.Fatalf("want ErrNotAuthorized after revoke, got %v", err)
+	}
+}
+
+func TestBeginRequiresSecretKey(t *testing.T) {
+	t.Setenv("MCP_MARKET_SECRET_KEY", "")
+	svc := NewService(dbtest.Open(t, &models.MCPOAuthToken{}), Options{})
+	if _, err := svc.Begin(context.Background(), BeginRequest{ServerName: "x", ServerURL: "http://127.0.0.1:1/mcp", RedirectURI: "http://localhost/cb"}); err == nil {
+		t.Fatal("want error when secret key missing")
+	}
+}
@@ -0,0 +1,285 @@
+package revision
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"xiaozhi/manager/backend/models"
+	"xiaozhi/manager/backend/services/audit"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ResourceAgent = "agent"
+	ResourceRole  = "role"
+)
+
+// ErrNotFound 指定的版本不存在或不属于该资源
+var ErrNotFound = errors.New("版本不存在")
+
+// AgentSnapshot 智能体可回滚的配置项（不含归属、状态等管理字段）
+type AgentSnapshot struct {
+	Name             string  `json:"name"`
+	CustomPrompt     string  `json:"custom_prompt"`
+	LLMConfigID      *string `json:"llm_config_id"`
+	TTSConfigID      *string `json:"tts_config_id"`
+	Voice            *string `json:"voice"`
+	ASRSpeed         string  `json:"asr_speed"`
+	MemoryMode       string  `json:"memory_mode"`
+	MCPServiceNames  string  `json:"mcp_service_names"`
+	OpenClawConfig   string  `json:"openclaw_config"`
+	MCPResources     string  `json:"mcp_resources"`
+	ToolPolicies     string  `json:"tool_policies"`
+	AudioFrontend    string  `json:"audio_frontend"`
+	KnowledgeBaseIDs []uint  `json:"knowledge_base_ids"`
+}
+
+// RoleSnapshot 角色可回滚的配置项
+type RoleSnapshot struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Prompt      string  `json:"prompt"`
+	LLMConfigID *string `json:"llm_config_id"`
+	TTSConfigID *string `json:"tts_config_id"`
+	Voice       *string `json:"voice"`
+	SortOrder   int     `json:"sort_order"`
+}
+
+// Author 版本作者
+type Author struct {
+	ID   uint
+	Name string
+}
+
+// Entry 一次待记录的版本
+type Entry struct {
+	ResourceType string
+	ResourceID   uint
+	OrgID        uint
+	Author       Author
+	Comment      string
+	RollbackFrom *int
+	// Before 为本次修改前的快照：资源还没有任何版本（功能上线前创建的数据）时，先以它补一条初始版本，保证可回滚到修改前
+	Before interface{}
+	After  interface{}
+}
+
+// CaptureAgent 读取智能体当前配置（含知识库关联）作为快照
+func CaptureAgent(db *gorm.DB, agentID uint) (*AgentSnapshot, error) {
+	var agent models.Agent
+	if err := db.First(&agent, agentID).Error; err != nil {
+		return nil, err
+	}
+	var kbIDs []uint
+	if err := db.Model(&models.AgentKnowledgeBase{}).Where("agent_id = ?", agentID).Order("knowledge_base_id ASC").Pluck("knowledge_base_id", &kbIDs).Error; err != nil {
+		return nil, err
+	}
+	return &AgentSnapshot{
+		Name:             agent.Name,
+		CustomPrompt:     agent.CustomPrompt,
+		LLMConfigID:      agent.LLMConfigID,
+		TTSConfigID:      agent.TTSConfigID,
+		Voice:            agent.Voice,
+		ASRSpeed:         agent.ASRSpeed,
+		MemoryMode:       agent.MemoryMode,
+		MCPServiceNames:  agent.MCPServiceNames,
+		OpenClawConfig:   agent.OpenClawConfig,
+		MCPResources:     agent.MCPResources,
+		ToolPolicies:     agent.ToolPolicies,
+		AudioFrontend:    agent.AudioFrontend,
+		KnowledgeBaseIDs: kbIDs,
+	}, nil
+}
+
+// CaptureRole 读取角色当前配置作为快照
+func CaptureRole(db *gorm.DB, roleID uint) (*RoleSnapshot, error) {
+	var role models.Role
+	if err := db.First(&role, roleID).Error; err != nil {
+		return nil, err
+	}
+	return &RoleSnapshot{
+		Name:        role.Name,
+		Description: role.Description,
+		Prompt:      role.Prompt,
+		LLMConfigID: role.LLMConfigID,
+		TTSConfigID: role.TTSConfigID,
+		Voice:       role.Voice,
+		SortOrder:   role.SortOrder,
+	}, nil
+}
+
+// Record 追加一个版本；与最新版本内容相同且不是回滚时不重复记录，直接返回最新版本
+func Record(db *gorm.DB, e Entry) (*models.Revision, error) {
+	after, err := json.Marshal(e.After)
+	if err != nil {
+		return nil, err
+	}
+
+	var created *models.Revision
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var latest models.Revision
+		err := tx.Where("resource_type = ? AND resource_id = ?", e.ResourceType, e.ResourceID).
+			Order("version DESC").Take(&latest).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if e.Before != nil {
+				before, err := json.Marshal(e.Before)
+				if err != nil {
+					return err
+				}
+				if string(before) != string(after) {
+					latest = models.Revision{
+						ResourceType: e.ResourceType,
+						ResourceID:   e.ResourceID,
+						Version:      1,
+						OrgID:        e.OrgID,
+						Snapshot:     string(before),
+						AuthorName:   audit.ActorRoleSystem,
+						Comment:      "初始版本",
+					}
+					if err := tx.Create(&latest).Error; err != nil {
+						return err
+					}
+				}
+			}
+		case err != nil:
+			return err
+		default:
+			if e.RollbackFrom == nil && latest.Snapshot == string(after) {
+				created = &latest
+				return nil
+			}
+		}
+
+		rev := models.Revision{
+			ResourceType: e.ResourceType,
+			ResourceID:   e.ResourceID,
+			Version:      latest.Version + 1,
+			OrgID:        e.OrgID,
+			Snapshot:     string(after),
+			AuthorID:     e.Author.ID,
+			AuthorName:   e.Author.Name,
+			Comment:      e.Comment,
+			RollbackFrom: e.RollbackFrom,
+		}
+		if err := tx.Create(&rev).Error; err != nil {
+			return err
+		}
+		created = &rev
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// List 按版本号倒序列出资源的全部版本
+func List(db *gorm.DB, resourceType string, resourceID uint) ([]models.Revision, error) {
+	var revisions []models.Revision
+	err := db.Where("resource_type = ? AND resource_id = ?", resourceType, resourceID).
+		Order("version DESC").Find(&revisions).Error
+	return revisions, err
+}
+
+// Get 获取资源的指定版本（按版本记录 ID）
+func Get(db *gorm.DB, resourceType string, resourceID, revisionID uint) (*models.Revision, error) {
+	var rev models.Revision
+	err := db.Where("id = ? AND resource_type = ? AND resource_id = ?", revisionID, resourceType, resourceID).Take(&rev).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// Previous 获取指定版本的上一个版本，不存在时返回 ErrNotFound
+func Previous(db *gorm.DB, rev *models.Revision) (*models.Revision, error) {
+	var prev models.Revision
+	err := db.Where("resource_type = ? AND resource_id = ? AND version < ?", rev.ResourceType, rev.ResourceID, rev.Version).
+		Order("version DESC").Take(&prev).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &prev, nil
+}
+
+// FieldChange 单个字段在两个版本之间的差异
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Diff 比较两个版本快照，按字段名排序返回变化项；from 为空表示与空配置比较
+func Diff(from, to *models.Revision) ([]FieldChange, error) {
+	before := map[string]interface{}{}
+	if from != nil {
+		if err := json.Unmarshal([]byte(from.Snapshot), &before); err != nil {
+			return nil, fmt.Errorf("解析版本 %d 失败: %w", from.Version, err)
+		}
+	}
+	after := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(to.Snapshot), &after); err != nil {
+		return nil, fmt.Errorf("解析版本 %d 失败: %w", to.Version, err)
+	}
+	changes := audit.Diff(before, after)
+	out := make([]FieldChange, 0, len(changes))
+	for field, ch := range changes {
+		out = append(out, FieldChange{Field: field, Before: ch.Before, After: ch.After})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Field < out[j].Field })
+	return out, nil
+}
+
+// DecodeAgent 解析智能体版本快照
+func DecodeAgent(rev *models.Revision) (*AgentSnapshot, error) {
+	var snap AgentSnapshot
+	if err := json.Unmarshal([]byte(rev.Snapshot), &snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// DecodeRole 解析角色版本快照
+func DecodeRole(rev *models.Revision) (*RoleSnapshot, error) {
+	var snap RoleSnapshot
+	if err := json.Unmarshal([]byte(rev.Snapshot), &snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// ApplyToAgent 将快照中的配置写入智能体结构体（不落库）
+func (s *AgentSnapshot) ApplyToAgent(agent *models.Agent) {
+	agent.Name = s.Name
+	agent.CustomPrompt = s.CustomPrompt
+	agent.LLMConfigID = s.LLMConfigID
+	agent.TTSConfigID = s.TTSConfigID
+	agent.Voice = s.Voice
+	agent.ASRSpeed = s.ASRSpeed
+	agent.MemoryMode = s.MemoryMode
+	agent.MCPServiceNames = s.MCPServiceNames
+	agent.OpenClawConfig = s.OpenClawConfig
+	agent.MCPResources = s.MCPResources
+	agent.ToolPolicies = s.ToolPolicies
+	agent.AudioFrontend = s.AudioFrontend
+}
+
+// ApplyToRole 将快照中的配置写入角色结构体（不落库）
+func (s *RoleSnapshot) ApplyToRole(role *models.Role) {
+	role.Name = s.Name
+	role.Description = s.Description
+	role.Prompt = s.Prompt
+	role.LLMConfigID = s.LLMConfigID
+	role.TTSConfigID = s.TTSConfigID
+	role.Voice = s.Voice
+	role.SortOrder = s.SortOrder
+}
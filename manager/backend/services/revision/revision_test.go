@@ -0,0 +1,116 @@
+package revision
+
+import (
+	"errors"
+	"testing"
+	"xiaozhi/manager/backend/database/dbtest"
+	"xiaozhi/manager/backend/models"
+)
+
+func TestRecordVersions(t *testing.T) {
+	db := dbtest.Open(t, &models.Revision{})
+	v1 := &AgentSnapshot{Name: "助手", CustomPrompt: "a"}
+	v2 := &AgentSnapshot{Name: "助手", CustomPrompt: "b"}
+
+	// 资源没有历史版本时，先补一条修改前的初始版本
+	rev, err := Record(db, Entry{ResourceType: ResourceAgent, ResourceID: 1, Author: Author{ID: 7, Name: "alice"}, Comment: "改提示词", Before: v1, After: v2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev.Version != 2 || rev.AuthorName != "alice" || rev.Comment != "改提示词" {
+		t.Fatalf("unexpected revision: %+v", rev)
+	}
+
+	// 内容未变化时不新增版本
+	same, err := Record(db, Entry{ResourceType: ResourceAgent, ResourceID: 1, After: v2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same.ID != rev.ID {
+		t.Fatalf("identical snapshot should not create a version, got v%d", same.Version)
+	}
+
+	revisions, err := List(db, ResourceAgent, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || revisions[0].Version != 2 || revisions[1].Comment != "初始版本" {
+		t.Fatalf("unexpected history: %+v", revisions)
+	}
+
+	// 回滚即使内容与最新一致也要留下记录
+	from := 1
+	rb, err := Record(db, Entry{ResourceType: ResourceAgent, ResourceID: 1, RollbackFrom: &from, After: v1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rb.Version != 3 || rb.RollbackFrom == nil || *rb.RollbackFrom != 1 {
+		t.Fatalf("unexpected rollback revision: %+v", rb)
+	}
+
+	// 其它资源的版本号独立编号
+	other, err := Record(db, Entry{ResourceType: ResourceRole, ResourceID: 1, After: &RoleSnapshot{Name: "r"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Version != 1 {
+		t.Fatalf("role versions should start at 1, got %d", other.Version)
+	}
+
+	if _, err := Get(db, ResourceRole, 1, rb.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("revision of another resource should not be found, got %v", err)
+	}
+	prev, err := Previous(db, rb)
+	if err != nil || prev.Version != 2 {
+		t.Fatalf("previous of v3 should be v2, got %+v, %v", prev, err)
+	}
+}
+
+func TestRevisionImmutable(t *testing.T) {
+	db := dbtest.Open(t, &models.Revision{})
+	rev, err := Record(db, Entry{ResourceType: ResourceAgent, ResourceID: 1, After: &AgentSnapshot{Name: "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(rev).Update("comment", "x").Error; !errors.Is(err, models.ErrRevisionImmutable) {
+		t.Fatalf("update should be rejected, got %v", err)
+	}
+	if err := db.Delete(rev).Error; !errors.Is(err, models.ErrRevisionImmutable) {
+		t.Fatalf("delete should be rejected, got %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	db := dbtest.Open(t, &models.Revision{})
+	llm := "llm-1"
+	first, _ := Record(db, Entry{ResourceType: ResourceAgent, ResourceID: 1, After: &AgentSnapshot{Name: "a", KnowledgeBaseIDs: []uint{1}}})
+	second, _ := Record(db, Entry{ResourceType: ResourceAgent, ResourceID: 1, After: &AgentSnapshot{Name: "b", LLMConfigID: &llm, KnowledgeBaseIDs: []uint{1, 2}}})
+
+	changes, err := Diff(first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields []string
+	for _, ch := range changes {
+		fields = append(fields, ch.Field)
+	}
+	want := []string{"knowledge_base_ids", "llm_config_id", "name"}
+	if len(fields) != len(want) {
+		t.Fatalf("changed fields = %v, want %v", fields, want)
+	}
+	for i := range want {
+		if fields[i] != want[i] {
+			t.Fatalf("changed fields = %v, want %v", fields, want)
+		}
+	}
+
+	snap, err := DecodeAgent(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var agent models.Agent
+	snap.ApplyToAgent(&agent)
+	if agent.Name != "b" || agent.LLMConfigID == nil || *agent.LLMConfigID != llm {
+		t.Fatalf("snapshot not applied: %+v", agent)
+	}
+}
@@ -0,0 +1,165 @@
+package sso
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"xiaozhi/manager/backend/config"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrInvalidCredentials 用户名或密码错误（不区分用户不存在与密码错误）
+var ErrInvalidCredentials = errors.New("用户名或密码错误")
+
+// ldapConn LDAP 连接中用到的操作，便于测试替换
+type ldapConn interface {
+	Bind(username, password string) error
+	Search(req *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// LDAPAuthenticator 通过 LDAP 绑定校验用户名密码
+type LDAPAuthenticator struct {
+	cfg  config.LDAPConfig
+	dial func() (ldapConn, error)
+}
+
+// NewLDAPAuthenticator 创建 LDAP 认证器
+func NewLDAPAuthenticator(cfg config.LDAPConfig) *LDAPAuthenticator {
+	a := &LDAPAuthenticator{cfg: cfg}
+	a.dial = a.dialServer
+	return a
+}
+
+func (a *LDAPAuthenticator) dialServer() (ldapConn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: a.cfg.InsecureSkipVerify}
+	conn, err := ldap.DialURL(a.cfg.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("连接 LDAP 失败: %w", err)
+	}
+	if a.cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP StartTLS 失败: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func valueOr(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+// bindService 以服务账号绑定，未配置服务账号时保持匿名
+func (a *LDAPAuthenticator) bindService(conn ldapConn) error {
+	if a.cfg.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+		return fmt.Errorf("LDAP 服务账号绑定失败: %w", err)
+	}
+	return nil
+}
+
+// Authenticate 查找用户条目并以用户密码绑定，成功后返回身份与分组
+func (a *LDAPAuthenticator) Authenticate(username, password string) (*Identity, error) {
+	username = strings.TrimSpace(username)
+	// 空密码在多数 LDAP 服务器上会被当作匿名绑定而“成功”，必须拒绝
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := a.bindService(conn); err != nil {
+		return nil, err
+	}
+
+	usernameAttr := valueOr(a.cfg.UsernameAttribute, "uid")
+	emailAttr := valueOr(a.cfg.EmailAttribute, "mail")
+	groupAttr := valueOr(a.cfg.GroupAttribute, "memberOf")
+	filter := fmt.Sprintf(valueOr(a.cfg.UserFilter, "(uid=%s)"), ldap.EscapeFilter(username))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 10, false,
+		filter, []string{usernameAttr, emailAttr, groupAttr}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("LDAP 查找用户失败: %w", err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("LDAP 用户绑定失败: %w", err)
+	}
+
+	id := &Identity{
+		Provider: ProviderLDAP,
+		Subject:  entry.DN,
+		Username: valueOr(entry.GetAttributeValue(usernameAttr), username),
+		Email:    entry.GetAttributeValue(emailAttr),
+		// 目录中的邮箱由管理员维护，视为已验证
+		EmailVerified: entry.GetAttributeValue(emailAttr) != "",
+	}
+	for _, dn := range entry.GetAttributeValues(groupAttr) {
+		id.Groups = append(id.Groups, groupNameFromDN(dn))
+	}
+
+	if a.cfg.GroupBaseDN != "" {
+		groups, err := a.searchGroups(conn, entry.DN)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range groups {
+			if !containsFold(id.Groups, g) {
+				id.Groups = append(id.Groups, g)
+			}
+		}
+	}
+	return id, nil
+}
+
+// searchGroups 按 group_filter 搜索用户所属分组，搜索前切回服务账号
+func (a *LDAPAuthenticator) searchGroups(conn ldapConn, userDN string) ([]string, error) {
+	if err := a.bindService(conn); err != nil {
+		return nil, err
+	}
+	nameAttr := valueOr(a.cfg.GroupNameAttribute, "cn")
+	filter := fmt.Sprintf(valueOr(a.cfg.GroupFilter, "(member=%s)"), ldap.EscapeFilter(userDN))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 10, false,
+		filter, []string{nameAttr}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("LDAP 查找分组失败: %w", err)
+	}
+	groups := make([]string, 0, len(result.Entries))
+	for _, e := range result.Entries {
+		if name := e.GetAttributeValue(nameAttr); name != "" {
+			groups = append(groups, name)
+		}
+	}
+	return groups, nil
+}
+
+// groupNameFromDN 取分组 DN 第一个 RDN 的值，如 cn=admins,ou=groups,dc=example → admins；非 DN 原样返回
+func groupNameFromDN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+		return dn
+	}
+	return parsed.RDNs[0].Attributes[0].Value
+}
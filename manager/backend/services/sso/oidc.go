@@ -0,0 +1,304 @@
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"xiaozhi/manager/backend/config"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	pendingLoginTTL = 10 * time.Minute
+	loginCodeTTL    = time.Minute
+)
+
+// ErrUnknownProvider 未配置的身份提供方
+var ErrUnknownProvider = errors.New("未配置该身份提供方")
+
+// ProviderInfo 登录页展示的身份提供方
+type ProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Type        string `json:"type"` // oidc / ldap
+}
+
+// OIDCProvider 单个 OIDC 身份提供方，首次使用时才做发现，避免 IdP 暂不可用时影响 manager 启动
+type OIDCProvider struct {
+	cfg    config.OIDCProviderConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func (p *OIDCProvider) context() context.Context {
+	// go-oidc 在后续刷新公钥时沿用发现时的 context，这里不能使用请求级 context
+	return oidc.ClientContext(context.Background(), p.client)
+}
+
+func (p *OIDCProvider) discover() (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider != nil {
+		return p.provider, nil
+	}
+	provider, err := oidc.NewProvider(p.context(), p.cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC 发现失败: %w", err)
+	}
+	p.provider = provider
+	return provider, nil
+}
+
+func (p *OIDCProvider) oauth2Config(provider *oidc.Provider, redirectURL string) *oauth2.Config {
+	scopes := p.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+	}
+}
+
+// claims 从声明中提取身份，分组声明支持字符串数组或逗号分隔的字符串
+func (p *OIDCProvider) identity(claims map[string]interface{}) *Identity {
+	usernameClaim := p.cfg.UsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = "preferred_username"
+	}
+	id := &Identity{Provider: providerOIDCPrefix + p.cfg.Name}
+	id.Subject, _ = claims["sub"].(string)
+	id.Username, _ = claims[usernameClaim].(string)
+	if id.Username == "" {
+		id.Username, _ = claims["name"].(string)
+	}
+	id.Email, _ = claims["email"].(string)
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		id.EmailVerified = v
+	case string:
+		id.EmailVerified = v == "true"
+	}
+	id.Groups = groupsClaim(claims, p.groupsClaimName())
+	return id
+}
+
+func (p *OIDCProvider) groupsClaimName() string {
+	if p.cfg.GroupsClaim != "" {
+		return p.cfg.GroupsClaim
+	}
+	return "groups"
+}
+
+func groupsClaim(claims map[string]interface{}, name string) []string {
+	switch v := claims[name].(type) {
+	case []interface{}:
+		groups := make([]string, 0, len(v))
+		for _, g := range v {
+			if s, ok := g.(string); ok && s != "" {
+				groups = append(groups, s)
+			}
+		}
+		return groups
+	case string:
+		var groups []string
+		for _, g := range strings.Split(v, ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				groups = append(groups, g)
+			}
+		}
+		return groups
+	}
+	return nil
+}
+
+// exchange 用授权码和 PKCE verifier 换取令牌，校验 ID Token 签名、受众与 nonce 后返回身份。
+// ID Token 中没有分组声明时再从 UserInfo 端点读取
+func (p *OIDCProvider) exchange(ctx context.Context, redirectURL, code, verifier, nonce string) (*Identity, error) {
+	provider, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	ctx = oidc.ClientContext(ctx, p.client)
+	conf := p.oauth2Config(provider, redirectURL)
+	token, err := conf.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("授权码换取令牌失败: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("令牌响应缺少 id_token")
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("ID Token 校验失败: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("ID Token nonce 不匹配")
+	}
+
+	claims := map[string]interface{}{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("解析 ID Token 声明失败: %w", err)
+	}
+	if _, ok := claims[p.groupsClaimName()]; !ok && provider.UserInfoEndpoint() != "" {
+		if info, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(token)); err == nil && info.Subject == idToken.Subject {
+			extra := map[string]interface{}{}
+			if err := info.Claims(&extra); err == nil {
+				for k, v := range extra {
+					if _, exists := claims[k]; !exists {
+						claims[k] = v
+					}
+				}
+			}
+		}
+	}
+
+	id := p.identity(claims)
+	if id.Subject == "" {
+		return nil, errors.New("ID Token 缺少 sub")
+	}
+	return id, nil
+}
+
+type pendingLogin struct {
+	provider    string
+	nonce       string
+	verifier    string
+	redirectURL string
+	returnTo    string
+}
+
+// Manager 管理已配置的身份提供方与登录中间状态
+type Manager struct {
+	cfg       config.SSOConfig
+	providers map[string]*OIDCProvider
+	ldap      *LDAPAuthenticator
+
+	pending *ttlStore[pendingLogin]
+	codes   *ttlStore[uint]
+}
+
+// NewManager 创建单点登录管理器；httpClient 为空时使用 10 秒超时的默认客户端（测试中可注入）
+func NewManager(cfg config.SSOConfig, httpClient *http.Client) *Manager {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	m := &Manager{
+		cfg:       cfg,
+		providers: make(map[string]*OIDCProvider),
+		pending:   newTTLStore[pendingLogin](),
+		codes:     newTTLStore[uint](),
+	}
+	for _, pc := range cfg.OIDC {
+		if pc.Name == "" || pc.Issuer == "" || pc.ClientID == "" {
+			continue
+		}
+		m.providers[pc.Name] = &OIDCProvider{cfg: pc, client: httpClient}
+	}
+	if cfg.LDAP.Enabled {
+		m.ldap = NewLDAPAuthenticator(cfg.LDAP)
+	}
+	return m
+}
+
+// Config 返回单点登录配置
+func (m *Manager) Config() config.SSOConfig {
+	return m.cfg
+}
+
+// Providers 按配置顺序返回可用的身份提供方
+func (m *Manager) Providers() []ProviderInfo {
+	infos := make([]ProviderInfo, 0, len(m.providers)+1)
+	for _, pc := range m.cfg.OIDC {
+		if _, ok := m.providers[pc.Name]; !ok {
+			continue
+		}
+		name := pc.DisplayName
+		if name == "" {
+			name = pc.Name
+		}
+		infos = append(infos, ProviderInfo{Name: pc.Name, DisplayName: name, Type: "oidc"})
+	}
+	if m.ldap != nil {
+		infos = append(infos, ProviderInfo{Name: ProviderLDAP, DisplayName: "LDAP", Type: "ldap"})
+	}
+	return infos
+}
+
+// LDAP 返回 LDAP 认证器，未启用时为 nil
+func (m *Manager) LDAP() *LDAPAuthenticator {
+	return m.ldap
+}
+
+// BeginOIDC 生成 state、nonce 与 PKCE verifier，返回 IdP 授权地址；returnTo 为登录完成后前端跳转的路径
+func (m *Manager) BeginOIDC(name, redirectURL, returnTo string) (string, error) {
+	p, ok := m.providers[name]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+	provider, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	state, err := randomString(24)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomString(24)
+	if err != nil {
+		return "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+	m.pending.put(state, pendingLogin{
+		provider:    name,
+		nonce:       nonce,
+		verifier:    verifier,
+		redirectURL: redirectURL,
+		returnTo:    returnTo,
+	}, pendingLoginTTL)
+	return p.oauth2Config(provider, redirectURL).AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// FinishOIDC 校验回调的 state 并完成授权码交换；state 只能使用一次
+func (m *Manager) FinishOIDC(ctx context.Context, name, state, code string) (*Identity, string, error) {
+	pending, ok := m.pending.take(state)
+	if !ok || pending.provider != name {
+		return nil, "", errors.New("登录状态无效或已过期，请重新登录")
+	}
+	p, ok := m.providers[name]
+	if !ok {
+		return nil, "", ErrUnknownProvider
+	}
+	id, err := p.exchange(ctx, pending.redirectURL, code, pending.verifier, pending.nonce)
+	if err != nil {
+		return nil, "", err
+	}
+	return id, pending.returnTo, nil
+}
+
+// IssueLoginCode 为完成单点登录的用户生成一次性交换码，前端凭交换码换取 JWT，避免令牌出现在地址栏
+func (m *Manager) IssueLoginCode(userID uint) (string, error) {
+	code, err := randomString(24)
+	if err != nil {
+		return "", err
+	}
+	m.codes.put(code, userID, loginCodeTTL)
+	return code, nil
+}
+
+// RedeemLoginCode 兑换一次性交换码
+func (m *Manager) RedeemLoginCode(code string) (uint, bool) {
+	return m.codes.take(code)
+}
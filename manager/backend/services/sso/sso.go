@@ -0,0 +1,307 @@
+// Package sso 实现管理后台的单点登录：OIDC 授权码 + PKCE、LDAP 绑定，
+// 首次登录即时创建本地用户，并按配置把 IdP 分组映射为系统角色与组织成员角色。
+package sso
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"xiaozhi/manager/backend/config"
+	"xiaozhi/manager/backend/models"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	ProviderLDAP       = "ldap"
+	providerOIDCPrefix = "oidc:"
+
+	defaultRole = "user"
+)
+
+// Identity 身份提供方认证通过后返回的用户身份
+type Identity struct {
+	Provider      string // oidc:<name> 或 ldap
+	Subject       string // OIDC sub 或 LDAP DN，在同一提供方内唯一且稳定
+	Username      string
+	Email         string
+	EmailVerified bool
+	Groups        []string
+}
+
+var orgRoleRank = map[string]int{
+	models.OrgRoleViewer:   1,
+	models.OrgRoleOperator: 2,
+	models.OrgRoleEditor:   3,
+	models.OrgRoleOwner:    4,
+}
+
+// orgGrant 分组映射命中的组织：name 用于自动创建时的组织名称，role 为成员角色
+type orgGrant struct {
+	name string
+	role string
+}
+
+// mappedRoles 根据分组映射计算系统角色与各组织的成员角色（按 org_key 归并，同一组织命中多条时取最高权限）。
+// roleManaged 表示映射中配置了系统角色，此时每次登录都按分组同步用户的系统角色
+func mappedRoles(cfg config.SSOConfig, groups []string) (role string, roleManaged bool, orgRoles map[string]orgGrant) {
+	role = cfg.DefaultRole
+	if role == "" {
+		role = defaultRole
+	}
+	orgRoles = make(map[string]orgGrant)
+	for _, m := range cfg.GroupMappings {
+		if m.Role != "" {
+			roleManaged = true
+		}
+		if !containsFold(groups, m.Group) {
+			continue
+		}
+		if m.Role == "admin" {
+			role = "admin"
+		}
+		if org := strings.TrimSpace(m.Org); org != "" {
+			key := strings.TrimSpace(m.OrgKey)
+			if key == "" {
+				key = org
+			}
+			orgRole := m.OrgRole
+			if !models.ValidOrgRole(orgRole) {
+				orgRole = models.OrgRoleViewer
+			}
+			if orgRoleRank[orgRole] > orgRoleRank[orgRoles[key].role] {
+				orgRoles[key] = orgGrant{name: org, role: orgRole}
+			}
+		}
+	}
+	return role, roleManaged, orgRoles
+}
+
+func containsFold(list []string, target string) bool {
+	for _, v := range list {
+		if strings.EqualFold(strings.TrimSpace(v), strings.TrimSpace(target)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Provision 根据外部身份查找或创建本地用户，并同步系统角色与组织成员关系。
+// created 表示本次登录新建了用户
+func Provision(db *gorm.DB, cfg config.SSOConfig, id *Identity) (user *models.User, created bool, err error) {
+	if id == nil || id.Provider == "" || id.Subject == "" {
+		return nil, false, errors.New("身份信息不完整")
+	}
+	role, roleManaged, orgRoles := mappedRoles(cfg, id.Groups)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		user = &models.User{}
+		findErr := tx.Where("provider = ? AND subject = ?", id.Provider, id.Subject).First(&identity).Error
+		switch {
+		case findErr == nil:
+			if err := tx.First(user, identity.UserID).Error; err != nil {
+				return fmt.Errorf("关联的本地用户不存在: %w", err)
+			}
+		case errors.Is(findErr, gorm.ErrRecordNotFound):
+			identity = models.UserIdentity{Provider: id.Provider, Subject: id.Subject}
+			linked := false
+			if cfg.LinkByEmail && id.EmailVerified && id.Email != "" {
+				if err := tx.Where("email = ?", id.Email).First(user).Error; err == nil {
+					linked = true
+				} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+					return err
+				}
+			}
+			if !linked {
+				if err := createUser(tx, id, role, user); err != nil {
+					return err
+				}
+				created = true
+			}
+			identity.UserID = user.ID
+		default:
+			return findErr
+		}
+
+		if roleManaged && user.Role != role {
+			if err := tx.Model(user).Update("role", role).Error; err != nil {
+				return err
+			}
+			user.Role = role
+		}
+		if _, err := models.EnsurePersonalOrganization(tx, user); err != nil {
+			return err
+		}
+		if err := syncOrgMemberships(tx, user.ID, orgRoles); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		identity.Email = id.Email
+		identity.Groups = strings.Join(id.Groups, ",")
+		identity.LastLoginAt = &now
+		return tx.Save(&identity).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return user, created, nil
+}
+
+var usernameSanitizer = regexp.MustCompile(`[^A-Za-z0-9_.\-@\p{Han}]`)
+
+// createUser 即时创建本地用户：用户名冲突时追加序号，密码为随机值（只能通过单点登录进入）
+func createUser(tx *gorm.DB, id *Identity, role string, user *models.User) error {
+	base := strings.TrimSpace(id.Username)
+	if base == "" && id.Email != "" {
+		base = strings.SplitN(id.Email, "@", 2)[0]
+	}
+	base = usernameSanitizer.ReplaceAllString(base, "_")
+	if base == "" {
+		base = "sso_user"
+	}
+	if r := []rune(base); len(r) > 40 {
+		base = string(r[:40])
+	}
+	username := base
+	for i := 2; ; i++ {
+		var count int64
+		if err := tx.Model(&models.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			break
+		}
+		if i > 1000 {
+			return errors.New("无法生成唯一的用户名")
+		}
+		username = fmt.Sprintf("%s_%d", base, i)
+	}
+
+	// 邮箱有唯一索引：缺失或已被其它账号使用时使用不可投递的占位地址
+	email := strings.TrimSpace(id.Email)
+	if email != "" {
+		var count int64
+		if err := tx.Model(&models.User{}).Where("email = ?", email).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			email = ""
+		}
+	}
+	if email == "" {
+		email = username + "@sso.invalid"
+	}
+
+	secret, err := randomString(32)
+	if err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	*user = models.User{Username: username, Password: string(hash), Email: email, Role: role}
+	if err := tx.Create(user).Error; err != nil {
+		return fmt.Errorf("创建用户失败: %w", err)
+	}
+	return nil
+}
+
+// syncOrgMemberships 按映射同步组织成员关系：组织只按 sso_key 匹配，不会命中用户自建的同名组织；
+// 不存在时自动创建且不归属任何个人。手动添加的成员关系保持不变，由单点登录维护且已不再命中映射的成员关系会被移除
+func syncOrgMemberships(tx *gorm.DB, userID uint, orgRoles map[string]orgGrant) error {
+	keep := make([]uint, 0, len(orgRoles))
+	for key, grant := range orgRoles {
+		role := grant.role
+		var org models.Organization
+		err := tx.Where("sso_key = ?", key).First(&org).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ssoKey := key
+			org = models.Organization{Name: grant.name, SSOKey: &ssoKey}
+			err = tx.Create(&org).Error
+		}
+		if err != nil {
+			return err
+		}
+		keep = append(keep, org.ID)
+
+		var member models.OrganizationMember
+		err = tx.Where("org_id = ? AND user_id = ?", org.ID, userID).First(&member).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			member = models.OrganizationMember{OrgID: org.ID, UserID: userID, Role: role, ManagedBy: models.MemberManagedBySSO}
+			if err := tx.Create(&member).Error; err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case member.ManagedBy == models.MemberManagedBySSO && member.Role != role:
+			if err := tx.Model(&member).Update("role", role).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	stale := tx.Where("user_id = ? AND managed_by = ?", userID, models.MemberManagedBySSO)
+	if len(keep) > 0 {
+		stale = stale.Where("org_id NOT IN ?", keep)
+	}
+	return stale.Delete(&models.OrganizationMember{}).Error
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ttlStore 带过期时间的一次性键值存储，用于 OIDC 登录中间状态与登录交换码。
+// 状态保存在进程内存中，多实例部署时需保证回调落到发起登录的实例（会话保持）
+type ttlStore[T any] struct {
+	mu    sync.Mutex
+	items map[string]ttlItem[T]
+}
+
+type ttlItem[T any] struct {
+	value    T
+	expireAt time.Time
+}
+
+func newTTLStore[T any]() *ttlStore[T] {
+	return &ttlStore[T]{items: make(map[string]ttlItem[T])}
+}
+
+func (s *ttlStore[T]) put(key string, value T, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, item := range s.items {
+		if now.After(item.expireAt) {
+			delete(s.items, k)
+		}
+	}
+	s.items[key] = ttlItem[T]{value: value, expireAt: now.Add(ttl)}
+}
+
+// take 取出并删除，过期或不存在时返回 false
+func (s *ttlStore[T]) take(key string) (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[key]
+	delete(s.items, key)
+	if !ok || time.Now().After(item.expireAt) {
+		var zero T
+		return zero, false
+	}
+	return item.value, true
+}
@@ -0,0 +1,363 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+	"xiaozhi/manager/backend/config"
+	"xiaozhi/manager/backend/database/dbtest"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return dbtest.Open(t, &models.User{}, &models.Organization{}, &models.OrganizationMember{}, &models.UserIdentity{})
+}
+
+func memberRole(t *testing.T, db *gorm.DB, userID uint, orgName string) string {
+	t.Helper()
+	var member models.OrganizationMember
+	err := db.Joins("JOIN organizations ON organizations.id = organization_members.org_id").
+		Where("organization_members.user_id = ? AND organizations.name = ?", userID, orgName).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return member.Role
+}
+
+func TestProvisionGroupMappings(t *testing.T) {
+	db := newTestDB(t)
+	cfg := config.SSOConfig{
+		GroupMappings: []config.SSOGroupMapping{
+			{Group: "xiaozhi-admins", Role: "admin"},
+			{Group: "family", Org: "家庭", OrgRole: models.OrgRoleViewer},
+			{Group: "family-parents", Org: "家庭", OrgRole: models.OrgRoleEditor},
+		},
+	}
+
+	// 其他用户抢先创建的同名组织不能被分组映射命中
+	mallory := models.User{Username: "mallory", Password: "x", Email: "mallory@example.com", Role: "user"}
+	db.Create(&mallory)
+	squatted := models.Organization{Name: "家庭", OwnerID: mallory.ID}
+	db.Create(&squatted)
+
+	id := &Identity{Provider: "oidc:corp", Subject: "u-1", Username: "alice smith", Email: "alice@example.com", Groups: []string{"Xiaozhi-Admins", "family", "family-parents"}}
+	user, created, err := Provision(db, cfg, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || user.Username != "alice_smith" || user.Role != "admin" || user.Email != "alice@example.com" {
+		t.Fatalf("unexpected user: created=%v %+v", created, user)
+	}
+	if role := memberRole(t, db, user.ID, "家庭"); role != models.OrgRoleEditor {
+		t.Fatalf("org role = %q, want editor", role)
+	}
+	var ssoOrg models.Organization
+	if err := db.Where("sso_key = ?", "家庭").First(&ssoOrg).Error; err != nil {
+		t.Fatal(err)
+	}
+	if ssoOrg.ID == squatted.ID || ssoOrg.OwnerID != 0 {
+		t.Fatalf("sso org must be a new ownerless org, got %+v", ssoOrg)
+	}
+	var squattedMembers int64
+	db.Model(&models.OrganizationMember{}).Where("org_id = ?", squatted.ID).Count(&squattedMembers)
+	if squattedMembers != 0 {
+		t.Fatalf("user-created org gained %d sso members", squattedMembers)
+	}
+
+	// 修改映射的显示名称但保持 org_key 不变时沿用原组织
+	renamed := cfg
+	renamed.GroupMappings = []config.SSOGroupMapping{{Group: "family", Org: "我的家", OrgKey: "家庭", OrgRole: models.OrgRoleViewer}}
+	if _, _, err := Provision(db, renamed, id); err != nil {
+		t.Fatal(err)
+	}
+	var member models.OrganizationMember
+	if err := db.Where("org_id = ? AND user_id = ?", ssoOrg.ID, user.ID).First(&member).Error; err != nil || member.Role != models.OrgRoleViewer {
+		t.Fatalf("org_key should keep the same org: %+v, %v", member, err)
+	}
+	if _, _, err := Provision(db, cfg, id); err != nil {
+		t.Fatal(err)
+	}
+	if role := memberRole(t, db, user.ID, "alice_smith 的个人空间"); role != models.OrgRoleOwner {
+		t.Fatalf("personal org role = %q, want owner", role)
+	}
+
+	// 手动加入的组织不受分组同步影响
+	manual := models.Organization{Name: "手动", OwnerID: user.ID}
+	db.Create(&manual)
+	db.Create(&models.OrganizationMember{OrgID: manual.ID, UserID: user.ID, Role: models.OrgRoleViewer})
+
+	// 再次登录：同一身份复用用户，失去分组后降级并移除由单点登录维护的成员关系
+	id.Groups = nil
+	again, created, err := Provision(db, cfg, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created || again.ID != user.ID || again.Role != "user" {
+		t.Fatalf("unexpected second login: created=%v %+v", created, again)
+	}
+	if role := memberRole(t, db, user.ID, "家庭"); role != "" {
+		t.Fatalf("stale sso membership kept with role %q", role)
+	}
+	if role := memberRole(t, db, user.ID, "手动"); role != models.OrgRoleViewer {
+		t.Fatalf("manual membership changed to %q", role)
+	}
+}
+
+func TestProvisionLinkAndUsernameConflict(t *testing.T) {
+	db := newTestDB(t)
+	existing := models.User{Username: "bob", Password: "x", Email: "bob@example.com", Role: "user"}
+	db.Create(&existing)
+
+	// 未开启按邮箱关联：新建用户，用户名与邮箱冲突时分别追加序号和使用占位邮箱
+	id := &Identity{Provider: ProviderLDAP, Subject: "uid=bob,dc=example", Username: "bob", Email: "bob@example.com", EmailVerified: true}
+	user, created, err := Provision(db, config.SSOConfig{}, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || user.Username != "bob_2" || user.Email != "bob_2@sso.invalid" {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+
+	// 开启后，已验证邮箱关联到已有账号
+	id2 := &Identity{Provider: "oidc:corp", Subject: "bob-sub", Username: "bob", Email: "bob@example.com", EmailVerified: true}
+	linked, created, err := Provision(db, config.SSOConfig{LinkByEmail: true}, id2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created || linked.ID != existing.ID {
+		t.Fatalf("expected link to existing user, got created=%v %+v", created, linked)
+	}
+
+	// 未验证的邮箱不做关联
+	id3 := &Identity{Provider: "oidc:other", Subject: "bob-sub", Username: "bob", Email: "bob@example.com"}
+	other, created, err := Provision(db, config.SSOConfig{LinkByEmail: true}, id3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || other.ID == existing.ID {
+		t.Fatalf("unverified email must not link: %+v", other)
+	}
+}
+
+// mockIdP 进程内的 OIDC 提供方：发现、JWKS、授权码换令牌（校验 PKCE S256）
+type mockIdP struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	groups    []string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "k1", Algorithm: "RS256", Use: "sig"}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if r.Form.Get("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		signer, _ := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: idp.key}, (&jose.SignerOptions{}).WithHeader("kid", "k1"))
+		claims, _ := json.Marshal(map[string]interface{}{
+			"iss":                idp.server.URL,
+			"sub":                "carol-sub",
+			"aud":                "xiaozhi",
+			"exp":                time.Now().Add(time.Hour).Unix(),
+			"iat":                time.Now().Unix(),
+			"nonce":              idp.nonce,
+			"preferred_username": "carol",
+			"email":              "carol@example.com",
+			"email_verified":     true,
+			"groups":             idp.groups,
+		})
+		jws, _ := signer.Sign(claims)
+		idToken, _ := jws.CompactSerialize()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "at", "token_type": "Bearer", "expires_in": 3600, "id_token": idToken})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.groups = []string{"ops"}
+	cfg := config.SSOConfig{
+		OIDC:          []config.OIDCProviderConfig{{Name: "corp", DisplayName: "企业账号", Issuer: idp.server.URL, ClientID: "xiaozhi", ClientSecret: "s"}},
+		GroupMappings: []config.SSOGroupMapping{{Group: "ops", Org: "运维组", OrgRole: models.OrgRoleOperator}},
+	}
+	m := NewManager(cfg, idp.server.Client())
+	if infos := m.Providers(); len(infos) != 1 || infos[0].DisplayName != "企业账号" {
+		t.Fatalf("unexpected providers: %+v", infos)
+	}
+
+	authURL, err := m.BeginOIDC("corp", "http://manager/api/auth/oidc/corp/callback", "/user/agents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("nonce") == "" || q.Get("state") == "" {
+		t.Fatalf("authorization url missing pkce/nonce/state: %s", authURL)
+	}
+	idp.challenge = q.Get("code_challenge")
+	idp.nonce = q.Get("nonce")
+
+	if _, _, err := m.FinishOIDC(context.Background(), "corp", "forged", "good-code"); err == nil {
+		t.Fatal("unknown state should be rejected")
+	}
+	id, returnTo, err := m.FinishOIDC(context.Background(), "corp", q.Get("state"), "good-code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if returnTo != "/user/agents" || id.Provider != "oidc:corp" || id.Subject != "carol-sub" || id.Username != "carol" || !id.EmailVerified {
+		t.Fatalf("unexpected identity: %+v", id)
+	}
+	// state 只能使用一次
+	if _, _, err := m.FinishOIDC(context.Background(), "corp", q.Get("state"), "good-code"); err == nil {
+		t.Fatal("state reuse should be rejected")
+	}
+
+	db := newTestDB(t)
+	user, _, err := Provision(db, cfg, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role := memberRole(t, db, user.ID, "运维组"); role != models.OrgRoleOperator {
+		t.Fatalf("org role = %q, want operator", role)
+	}
+
+	code, _ := m.IssueLoginCode(user.ID)
+	if got, ok := m.RedeemLoginCode(code); !ok || got != user.ID {
+		t.Fatalf("redeem = %d, %v", got, ok)
+	}
+	if _, ok := m.RedeemLoginCode(code); ok {
+		t.Fatal("login code should be single use")
+	}
+}
+
+func TestOIDCNonceMismatch(t *testing.T) {
+	idp := newMockIdP(t)
+	m := NewManager(config.SSOConfig{OIDC: []config.OIDCProviderConfig{{Name: "corp", Issuer: idp.server.URL, ClientID: "xiaozhi"}}}, idp.server.Client())
+	authURL, err := m.BeginOIDC("corp", "http://manager/cb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	idp.challenge = u.Query().Get("code_challenge")
+	idp.nonce = "replayed"
+	if _, _, err := m.FinishOIDC(context.Background(), "corp", u.Query().Get("state"), "good-code"); err == nil {
+		t.Fatal("nonce mismatch should be rejected")
+	}
+}
+
+type fakeLDAP struct {
+	users  map[string]string // dn -> password
+	entry  *ldap.Entry
+	groups []*ldap.Entry
+	filter []string
+	bound  string
+}
+
+func (f *fakeLDAP) Bind(dn, password string) error {
+	if pw, ok := f.users[dn]; !ok || pw != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+	f.bound = dn
+	return nil
+}
+
+func (f *fakeLDAP) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	f.filter = append(f.filter, req.Filter)
+	if req.BaseDN == "ou=groups,dc=example" {
+		return &ldap.SearchResult{Entries: f.groups}, nil
+	}
+	if req.Filter == "(uid=dave)" {
+		return &ldap.SearchResult{Entries: []*ldap.Entry{f.entry}}, nil
+	}
+	return &ldap.SearchResult{}, nil
+}
+
+func (f *fakeLDAP) Close() error { return nil }
+
+func TestLDAPAuthenticate(t *testing.T) {
+	conn := &fakeLDAP{
+		users: map[string]string{"cn=svc,dc=example": "svc-pw", "uid=dave,ou=people,dc=example": "dave-pw"},
+		entry: ldap.NewEntry("uid=dave,ou=people,dc=example", map[string][]string{
+			"uid":      {"dave"},
+			"mail":     {"dave@example.com"},
+			"memberOf": {"cn=admins,ou=groups,dc=example"},
+		}),
+		groups: []*ldap.Entry{ldap.NewEntry("cn=family,ou=groups,dc=example", map[string][]string{"cn": {"family"}})},
+	}
+	a := NewLDAPAuthenticator(config.LDAPConfig{
+		Enabled: true, BindDN: "cn=svc,dc=example", BindPassword: "svc-pw",
+		BaseDN: "ou=people,dc=example", GroupBaseDN: "ou=groups,dc=example",
+	})
+	a.dial = func() (ldapConn, error) { return conn, nil }
+
+	id, err := a.Authenticate("dave", "dave-pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Provider != ProviderLDAP || id.Subject != "uid=dave,ou=people,dc=example" || id.Email != "dave@example.com" {
+		t.Fatalf("unexpected identity: %+v", id)
+	}
+	if len(id.Groups) != 2 || id.Groups[0] != "admins" || id.Groups[1] != "family" {
+		t.Fatalf("unexpected groups: %v", id.Groups)
+	}
+
+	if _, err := a.Authenticate("dave", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong password err = %v", err)
+	}
+	if _, err := a.Authenticate("dave", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("empty password err = %v", err)
+	}
+	if _, err := a.Authenticate("nobody", "x"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("unknown user err = %v", err)
+	}
+
+	// 用户名中的过滤器特殊字符必须转义
+	conn.filter = nil
+	a.Authenticate("*)(uid=*", "x")
+	if len(conn.filter) != 1 || conn.filter[0] != `(uid=\2a\29\28uid=\2a)` {
+		t.Fatalf("filter not escaped: %v", conn.filter)
+	}
+}
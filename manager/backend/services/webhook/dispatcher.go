@@ -0,0 +1,516 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 事件类型
+const (
+	EventDeviceOnline          = "device.online"
+	EventDeviceOffline         = "device.offline"
+	EventConversationTurnEnded = "conversation.turn_completed"
+	EventToolCalled            = "tool.called"
+	EventVoiceCloneSucceeded   = "voice_clone.succeeded"
+	EventVoiceCloneFailed      = "voice_clone.failed"
+	EventTest                  = "webhook.test"
+
+	EventAll = "*"
+)
+
+// AllEvents 可订阅的事件类型
+var AllEvents = []string{
+	EventDeviceOnline, EventDeviceOffline,
+	EventConversationTurnEnded, EventToolCalled,
+	EventVoiceCloneSucceeded, EventVoiceCloneFailed,
+}
+
+// 投递状态
+const (
+	StatusPending    = "pending"
+	StatusDelivering = "delivering"
+	StatusSuccess    = "success"
+	StatusDead       = "dead"
+)
+
+// 请求头
+const (
+	HeaderEvent     = "X-Xiaozhi-Event"
+	HeaderDelivery  = "X-Xiaozhi-Delivery"
+	HeaderSignature = "X-Xiaozhi-Signature"
+)
+
+// Event 对外推送的事件
+type Event struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	OrgID     uint                   `json:"org_id"`
+	AgentID   uint                   `json:"agent_id,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// Options 投递参数
+type Options struct {
+	MaxAttempts    int           // 最大投递次数（含首次），超过后进入死信
+	BaseBackoff    time.Duration // 首次重试间隔，之后按 2 倍递增
+	MaxBackoff     time.Duration
+	Timeout        time.Duration // 单次请求超时
+	Workers        int
+	PollInterval   time.Duration // 扫描到期重试的间隔
+	RetentionDays  int           // 成功投递记录保留天数
+	HTTPClient     *http.Client
+	ResponseMaxLen int
+	// AllowPrivateNetwork 允许投递到内网、回环等地址，仅用于内网部署或测试
+	AllowPrivateNetwork bool
+}
+
+func (o *Options) setDefaults() {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 6
+	}
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = 10 * time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = time.Hour
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Second
+	}
+	if o.Workers <= 0 {
+		o.Workers = 4
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = 5 * time.Second
+	}
+	if o.RetentionDays <= 0 {
+		o.RetentionDays = 30
+	}
+	if o.HTTPClient == nil {
+		o.HTTPClient = newHTTPClient(o.Timeout, o.AllowPrivateNetwork)
+	}
+	if o.ResponseMaxLen <= 0 {
+		o.ResponseMaxLen = 1024
+	}
+}
+
+// Dispatcher 将事件匹配到订阅并异步投递
+type Dispatcher struct {
+	db     *gorm.DB
+	opts   Options
+	events chan Event
+	wake   chan struct{}
+	jobs   chan uint
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+var (
+	defaultDispatcher *Dispatcher
+	initOnce          sync.Once
+)
+
+// Init 初始化全局投递器并启动后台任务（只生效一次）
+func Init(db *gorm.DB, opts Options) *Dispatcher {
+	initOnce.Do(func() {
+		defaultDispatcher = NewDispatcher(db, opts)
+		defaultDispatcher.Start()
+	})
+	return defaultDispatcher
+}
+
+// Default 返回全局投递器，未初始化时返回 nil
+func Default() *Dispatcher {
+	return defaultDispatcher
+}
+
+// Publish 向全局投递器发布事件，未初始化时忽略
+func Publish(evt Event) {
+	if d := Default(); d != nil {
+		d.Publish(evt)
+	}
+}
+
+// NewDispatcher 创建投递器
+func NewDispatcher(db *gorm.DB, opts Options) *Dispatcher {
+	opts.setDefaults()
+	return &Dispatcher{
+		db:     db,
+		opts:   opts,
+		events: make(chan Event, 1024),
+		wake:   make(chan struct{}, 1),
+		jobs:   make(chan uint, 256),
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start 启动事件分发、重试扫描与投递协程
+func (d *Dispatcher) Start() {
+	// 进程退出时正在投递的记录重新排队
+	d.db.Model(&models.WebhookDelivery{}).Where("status = ?", StatusDelivering).
+		Update("status", StatusPending)
+
+	d.wg.Add(2 + d.opts.Workers)
+	go d.fanOutLoop()
+	go d.scheduleLoop()
+	for i := 0; i < d.opts.Workers; i++ {
+		go d.workerLoop()
+	}
+}
+
+// Stop 停止后台任务
+func (d *Dispatcher) Stop() {
+	close(d.stop)
+	d.wg.Wait()
+}
+
+// Publish 异步发布事件，队列已满时丢弃并记录日志
+func (d *Dispatcher) Publish(evt Event) {
+	if evt.ID == "" {
+		evt.ID = uuid.NewString()
+	}
+	if evt.CreatedAt.IsZero() {
+		evt.CreatedAt = time.Now()
+	}
+	select {
+	case d.events <- evt:
+	default:
+		log.Printf("[webhook] 事件队列已满，丢弃事件: type=%s org_id=%d", evt.Type, evt.OrgID)
+	}
+}
+
+func (d *Dispatcher) fanOutLoop() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case evt := <-d.events:
+			n, err := d.enqueue(evt)
+			if err != nil {
+				log.Printf("[webhook] 创建投递记录失败: type=%s err=%v", evt.Type, err)
+				continue
+			}
+			if n > 0 {
+				d.notify()
+			}
+		}
+	}
+}
+
+// enqueue 为匹配的订阅创建投递记录，返回记录数
+func (d *Dispatcher) enqueue(evt Event) (int, error) {
+	var hooks []models.Webhook
+	query := d.db.Where("org_id = ? AND is_active = ?", evt.OrgID, true)
+	if evt.AgentID != 0 {
+		query = query.Where("agent_id IN ?", []uint{0, evt.AgentID})
+	} else {
+		query = query.Where("agent_id = ?", 0)
+	}
+	if err := query.Find(&hooks).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, hook := range hooks {
+		if !Subscribed(hook.Events, evt.Type) {
+			continue
+		}
+		if _, err := d.createDelivery(hook, evt); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (d *Dispatcher) createDelivery(hook models.Webhook, evt Event) (*models.WebhookDelivery, error) {
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	delivery := &models.WebhookDelivery{
+		WebhookID:     hook.ID,
+		OrgID:         hook.OrgID,
+		EventID:       evt.ID,
+		EventType:     evt.Type,
+		Payload:       string(payload),
+		Status:        StatusPending,
+		NextAttemptAt: &now,
+	}
+	return delivery, d.db.Create(delivery).Error
+}
+
+// SendTest 向指定订阅同步投递一次测试事件，失败时按正常流程重试
+func (d *Dispatcher) SendTest(ctx context.Context, hook models.Webhook) (*models.WebhookDelivery, error) {
+	evt := Event{
+		ID:        uuid.NewString(),
+		Type:      EventTest,
+		OrgID:     hook.OrgID,
+		AgentID:   hook.AgentID,
+		CreatedAt: time.Now(),
+		Data:      map[string]interface{}{"webhook_id": hook.ID, "message": "这是一条测试事件"},
+	}
+	delivery, err := d.createDelivery(hook, evt)
+	if err != nil {
+		return nil, err
+	}
+	if !d.claim(delivery.ID) {
+		return delivery, nil
+	}
+	d.deliver(ctx, delivery.ID)
+	err = d.db.First(delivery, delivery.ID).Error
+	return delivery, err
+}
+
+// Redeliver 将投递记录（通常是死信）重新排队
+func (d *Dispatcher) Redeliver(deliveryID uint) error {
+	now := time.Now()
+	err := d.db.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status IN ?", deliveryID, []string{StatusDead, StatusSuccess}).
+		Updates(map[string]interface{}{"status": StatusPending, "attempts": 0, "next_attempt_at": now}).Error
+	if err == nil {
+		d.notify()
+	}
+	return err
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) scheduleLoop() {
+	defer d.wg.Done()
+	ticker := time.NewTicker(d.opts.PollInterval)
+	defer ticker.Stop()
+	lastCleanup := time.Time{}
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+
+		var ids []uint
+		d.db.Model(&models.WebhookDelivery{}).
+			Where("status = ? AND next_attempt_at <= ?", StatusPending, time.Now()).
+			Order("next_attempt_at ASC").Limit(100).Pluck("id", &ids)
+		for _, id := range ids {
+			if !d.claim(id) {
+				continue
+			}
+			select {
+			case d.jobs <- id:
+			case <-d.stop:
+				return
+			}
+		}
+
+		if time.Since(lastCleanup) > time.Hour {
+			lastCleanup = time.Now()
+			cutoff := time.Now().AddDate(0, 0, -d.opts.RetentionDays)
+			d.db.Where("status = ? AND created_at < ?", StatusSuccess, cutoff).Delete(&models.WebhookDelivery{})
+		}
+	}
+}
+
+// claim 将待投递记录标记为投递中，避免重复投递
+func (d *Dispatcher) claim(id uint) bool {
+	res := d.db.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ?", id, StatusPending).
+		Update("status", StatusDelivering)
+	return res.Error == nil && res.RowsAffected == 1
+}
+
+func (d *Dispatcher) workerLoop() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case id := <-d.jobs:
+			d.deliver(context.Background(), id)
+		}
+	}
+}
+
+// deliver 执行一次投递并更新记录与订阅状态
+func (d *Dispatcher) deliver(ctx context.Context, id uint) {
+	var delivery models.WebhookDelivery
+	if err := d.db.First(&delivery, id).Error; err != nil {
+		return
+	}
+	var hook models.Webhook
+	if err := d.db.First(&hook, delivery.WebhookID).Error; err != nil {
+		d.db.Model(&delivery).Updates(map[string]interface{}{"status": StatusDead, "last_error": "订阅已删除"})
+		return
+	}
+
+	start := time.Now()
+	status, body, err := d.post(ctx, hook, delivery)
+	attempts := delivery.Attempts + 1
+	updates := map[string]interface{}{
+		"attempts":        attempts,
+		"response_status": status,
+		"response_body":   "",
+		"duration_ms":     time.Since(start).Milliseconds(),
+		"last_error":      "",
+	}
+	if err == nil && status >= 200 && status < 300 {
+		now := time.Now()
+		// 只保存成功投递的响应内容，失败时不回显对端响应，避免借投递探测内部服务
+		updates["response_body"] = body
+		updates["status"] = StatusSuccess
+		updates["delivered_at"] = now
+		updates["next_attempt_at"] = nil
+		d.db.Model(&hook).UpdateColumns(map[string]interface{}{"last_status": "success", "last_sent_at": now})
+	} else {
+		if err == nil {
+			err = fmt.Errorf("HTTP %d", status)
+		}
+		updates["last_error"] = err.Error()
+		// 地址被拦截时重试没有意义，直接进入死信，也不记录底层连接细节
+		blocked := errors.Is(err, ErrBlockedAddress)
+		if blocked {
+			updates["last_error"] = ErrBlockedAddress.Error()
+		}
+		if blocked || attempts >= d.opts.MaxAttempts {
+			updates["status"] = StatusDead
+			updates["next_attempt_at"] = nil
+			log.Printf("[webhook] 投递失败进入死信: delivery_id=%d webhook_id=%d event=%s err=%v", delivery.ID, hook.ID, delivery.EventType, err)
+		} else {
+			next := time.Now().Add(Backoff(attempts, d.opts.BaseBackoff, d.opts.MaxBackoff))
+			updates["status"] = StatusPending
+			updates["next_attempt_at"] = next
+		}
+		d.db.Model(&hook).UpdateColumns(map[string]interface{}{"last_status": "failed", "last_sent_at": time.Now()})
+	}
+	d.db.Model(&delivery).Updates(updates)
+}
+
+func (d *Dispatcher) post(ctx context.Context, hook models.Webhook, delivery models.WebhookDelivery) (int, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader([]byte(delivery.Payload)))
+	if err != nil {
+		return 0, "", err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "xiaozhi-webhook/1.0")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.EventID)
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, timestamp, []byte(delivery.Payload)))
+
+	resp, err := d.opts.HTTPClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, int64(d.opts.ResponseMaxLen)))
+	return resp.StatusCode, string(body), nil
+}
+
+// Sign 生成签名头：t=<unix 秒>,v1=<hex(HMAC-SHA256(secret, "<t>.<body>"))>
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	ts := strconv.FormatInt(timestamp, 10)
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 校验签名头，tolerance 为允许的时间偏差（<=0 不校验时间）
+func Verify(secret, header string, body []byte, tolerance time.Duration) bool {
+	var ts int64
+	var sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "t":
+			ts, _ = strconv.ParseInt(v, 10, 64)
+		case "v1":
+			sig = v
+		}
+	}
+	if ts == 0 || sig == "" {
+		return false
+	}
+	if tolerance > 0 {
+		if diff := time.Since(time.Unix(ts, 0)); diff > tolerance || diff < -tolerance {
+			return false
+		}
+	}
+	expected := Sign(secret, ts, body)
+	return hmac.Equal([]byte(expected), []byte("t="+strconv.FormatInt(ts, 10)+",v1="+sig))
+}
+
+// Backoff 第 attempt 次失败后的重试间隔：base * 2^(attempt-1)，不超过 max
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := base
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	return delay
+}
+
+// Subscribed 判断订阅的事件列表是否包含指定事件；测试事件总是投递
+func Subscribed(events, eventType string) bool {
+	if eventType == EventTest {
+		return true
+	}
+	for _, e := range models.SplitList(events) {
+		if e == EventAll || e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidEvent 判断是否为可订阅的事件类型
+func ValidEvent(eventType string) bool {
+	if eventType == EventAll {
+		return true
+	}
+	for _, e := range AllEvents {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"xiaozhi/manager/backend/database/dbtest"
+	"xiaozhi/manager/backend/models"
+
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return dbtest.Open(t, &models.Webhook{}, &models.WebhookDelivery{})
+}
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"type":"device.online"}`)
+	header := Sign("whsec_test", time.Now().Unix(), body)
+	if !Verify("whsec_test", header, body, time.Minute) {
+		t.Fatal("expected signature to verify")
+	}
+	if Verify("whsec_other", header, body, time.Minute) {
+		t.Fatal("expected wrong secret to fail")
+	}
+	if Verify("whsec_test", header, []byte(`{}`), time.Minute) {
+		t.Fatal("expected tampered body to fail")
+	}
+	old := Sign("whsec_test", time.Now().Add(-time.Hour).Unix(), body)
+	if Verify("whsec_test", old, body, 5*time.Minute) {
+		t.Fatal("expected stale timestamp to fail")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	base, max := 10*time.Second, time.Minute
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for i, w := range want {
+		if got := Backoff(i+1, base, max); got != w {
+			t.Errorf("Backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestDispatcherDeliversMatchingSubscriptions(t *testing.T) {
+	db := newTestDB(t)
+	received := make(chan *http.Request, 4)
+	bodies := make(chan []byte, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	hooks := []models.Webhook{
+		{OrgID: 1, Name: "all", URL: server.URL, Secret: "s1", Events: EventAll, IsActive: true},
+		{OrgID: 1, AgentID: 7, Name: "agent 7 tools", URL: server.URL, Secret: "s2", Events: EventToolCalled, IsActive: true},
+		{OrgID: 1, AgentID: 8, Name: "other agent", URL: server.URL, Secret: "s3", Events: EventAll, IsActive: true},
+		{OrgID: 2, Name: "other org", URL: server.URL, Secret: "s4", Events: EventAll, IsActive: true},
+	}
+	for i := range hooks {
+		db.Create(&hooks[i])
+	}
+
+	d := NewDispatcher(db, Options{PollInterval: 20 * time.Millisecond, AllowPrivateNetwork: true})
+	d.Start()
+	defer d.Stop()
+
+	d.Publish(Event{Type: EventToolCalled, OrgID: 1, AgentID: 7, Data: map[string]interface{}{"tool": "light_off"}})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-received:
+			body := <-bodies
+			secret := map[string]string{"all": "s1", "agent 7 tools": "s2"}
+			ok := false
+			for _, s := range secret {
+				if Verify(s, r.Header.Get(HeaderSignature), body, time.Minute) {
+					ok = true
+				}
+			}
+			if !ok || r.Header.Get(HeaderEvent) != EventToolCalled {
+				t.Fatalf("unexpected request headers: %v", r.Header)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("expected 2 deliveries, got %d", i)
+		}
+	}
+	select {
+	case <-received:
+		t.Fatal("event should not reach other agents or orgs")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDispatcherRetriesThenDeadLetters(t *testing.T) {
+	db := newTestDB(t)
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("internal details"))
+	}))
+	defer server.Close()
+
+	hook := models.Webhook{OrgID: 1, Name: "failing", URL: server.URL, Secret: "s", Events: EventDeviceOnline, IsActive: true}
+	db.Create(&hook)
+
+	d := NewDispatcher(db, Options{MaxAttempts: 3, BaseBackoff: 10 * time.Millisecond, PollInterval: 10 * time.Millisecond, AllowPrivateNetwork: true})
+	d.Start()
+	defer d.Stop()
+
+	delivery, err := d.SendTest(context.Background(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Attempts != 1 || delivery.ResponseStatus != http.StatusInternalServerError || delivery.Status != StatusPending {
+		t.Fatalf("unexpected first attempt: %+v", delivery)
+	}
+	if delivery.ResponseBody != "" {
+		t.Fatalf("failed delivery should not keep response body: %q", delivery.ResponseBody)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		db.First(delivery, delivery.ID)
+		if delivery.Status == StatusDead {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if delivery.Status != StatusDead || delivery.Attempts != 3 || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("expected dead letter after 3 attempts, got status=%s attempts=%d calls=%d", delivery.Status, delivery.Attempts, calls)
+	}
+
+	if err := d.Redeliver(delivery.ID); err != nil {
+		t.Fatal(err)
+	}
+	db.First(delivery, delivery.ID)
+	if delivery.Status == StatusDead && delivery.Attempts == 3 {
+		t.Fatal("expected redeliver to requeue the dead letter")
+	}
+}
+
+func TestDispatcherBlocksPrivateAddresses(t *testing.T) {
+	db := newTestDB(t)
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte("secret"))
+	}))
+	defer server.Close()
+
+	// 域名解析到回环地址时同样在连接阶段被拦截
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	for _, target := range []string{server.URL, "http://localhost:" + port} {
+		hook := models.Webhook{OrgID: 1, Name: "internal", URL: target, Secret: "s", Events: EventAll, IsActive: true}
+		db.Create(&hook)
+
+		d := NewDispatcher(db, Options{MaxAttempts: 3})
+		delivery, err := d.SendTest(context.Background(), hook)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if delivery.Status != StatusDead || delivery.ResponseBody != "" || delivery.LastError != ErrBlockedAddress.Error() {
+			t.Fatalf("expected blocked dead letter for %s, got %+v", target, delivery)
+		}
+	}
+	if atomic.LoadInt32(&calls) != 0 {
+		t.Fatalf("blocked address should never be reached, calls=%d", calls)
+	}
+}
+
+func TestValidateURLHost(t *testing.T) {
+	blocked := []string{"127.0.0.1", "localhost", "10.0.0.8", "172.16.1.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "::1", "fd00::1", "fe80::1", "0.0.0.0"}
+	for _, host := range blocked {
+		if ValidateURLHost(host) == nil {
+			t.Errorf("expected %s to be blocked", host)
+		}
+	}
+	for _, host := range []string{"example.com", "8.8.8.8", "2001:4860:4860::8888"} {
+		if err := ValidateURLHost(host); err != nil {
+			t.Errorf("expected %s to be allowed: %v", host, err)
+		}
+	}
+}
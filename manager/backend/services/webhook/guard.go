@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress 目标地址为内网、回环、链路本地（含云厂商元数据 169.254.169.254）等地址时拒绝投递
+var ErrBlockedAddress = errors.New("目标地址不允许访问")
+
+// blockedIP 判断是否为禁止投递的地址
+func blockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		carrierGradeNAT.Contains(ip)
+}
+
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// dialControl 在建立连接前检查实际要连接的 IP。检查发生在 DNS 解析之后，域名解析到内网地址（含 DNS rebinding）同样会被拒绝
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || blockedIP(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	return nil
+}
+
+// newHTTPClient 创建投递用的 http.Client；allowPrivate 为 false 时拒绝连接内网地址，且不使用环境变量中的代理
+func newHTTPClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = dialControl
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   timeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	if allowPrivate {
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		// 重定向目标同样经过 dialControl 检查
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 3 {
+				return errors.New("重定向次数过多")
+			}
+			return nil
+		},
+	}
+}
+
+// ValidateURLHost 保存订阅时的预检查：URL 主机为 IP 字面量时拒绝内网地址；域名在投递时按解析结果检查
+func ValidateURLHost(host string) error {
+	if ip := net.ParseIP(host); ip != nil && blockedIP(ip) {
+		return ErrBlockedAddress
+	}
+	if host == "localhost" {
+		return ErrBlockedAddress
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"fmt"
+	"net/url"
+	"xiaozhi/manager/backend/config"
+)
+
+// Config PostgreSQL配置
+type Config struct {
+	Host            string `json:"host"`
+	Port            int    `json:"port"`
+	Username        string `json:"username"`
+	Password        string `json:"password"`
+	Database        string `json:"database"`
+	SSLMode         string `json:"sslmode"`
+	Schema          string `json:"schema"`
+	TimeZone        string `json:"timezone"`
+	MaxIdleConns    int    `json:"max_idle_conns"`
+	MaxOpenConns    int    `json:"max_open_conns"`
+	ConnMaxLifetime int    `json:"conn_max_lifetime"`
+}
+
+// NewConfigFromDatabase 从数据库配置创建PostgreSQL配置
+func NewConfigFromDatabase(cfg *config.PostgresConfig) *Config {
+	c := &Config{
+		Host:            cfg.Host,
+		Port:            cfg.Port,
+		Username:        cfg.Username,
+		Password:        cfg.Password,
+		Database:        cfg.Database,
+		SSLMode:         cfg.SSLMode,
+		Schema:          cfg.Schema,
+		TimeZone:        cfg.TimeZone,
+		MaxIdleConns:    10,
+		MaxOpenConns:    100,
+		ConnMaxLifetime: 3600,
+	}
+	if c.Port == 0 {
+		c.Port = 5432
+	}
+	if c.SSLMode == "" {
+		c.SSLMode = "disable"
+	}
+	return c
+}
+
+// DSN 生成数据源名称（URL 形式，用户名密码中的特殊字符会被转义）
+func (c *Config) DSN() string {
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(c.Username, c.Password),
+		Host:   fmt.Sprintf("%s:%d", c.Host, c.Port),
+		Path:   "/" + c.Database,
+	}
+	q := url.Values{}
+	q.Set("sslmode", c.SSLMode)
+	if c.Schema != "" {
+		q.Set("search_path", c.Schema)
+	}
+	if c.TimeZone != "" {
+		q.Set("TimeZone", c.TimeZone)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// Validate 验证配置
+func (c *Config) Validate() error {
+	if c.Host == "" {
+		return fmt.Errorf("PostgreSQL host is required")
+	}
+	if c.Port == 0 {
+		return fmt.Errorf("PostgreSQL port is required")
+	}
+	if c.Username == "" {
+		return fmt.Errorf("PostgreSQL username is required")
+	}
+	if c.Database == "" {
+		return fmt.Errorf("PostgreSQL database name is required")
+	}
+	return nil
+}
+
+// ValidateConfig 验证PostgreSQL配置
+func ValidateConfig(cfg *config.PostgresConfig) error {
+	if cfg == nil {
+		return fmt.Errorf("PostgreSQL config is required")
+	}
+	if cfg.Host == "" {
+		return fmt.Errorf("PostgreSQL host is required")
+	}
+	if cfg.Username == "" {
+		return fmt.Errorf("PostgreSQL username is required")
+	}
+	if cfg.Database == "" {
+		return fmt.Errorf("PostgreSQL database name is required")
+	}
+	return nil
+}
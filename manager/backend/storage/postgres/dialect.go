@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"regexp"
+	"strings"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/migrator"
+	"gorm.io/gorm/schema"
+)
+
+// Dialector 在官方 postgres 方言之上，把模型里按 MySQL 书写的列类型映射为 PostgreSQL 类型，
+// 使同一套模型无需改 tag 即可在三种数据库上迁移
+type Dialector struct {
+	*postgres.Dialector
+}
+
+// Open 创建 PostgreSQL 方言。使用简单协议：管理后台查询量不大，
+// 且可避免 AutoMigrate 改表后服务端预编译语句缓存失效（cached plan must not change result type）
+func Open(dsn string) gorm.Dialector {
+	return &Dialector{Dialector: postgres.New(postgres.Config{DSN: dsn, PreferSimpleProtocol: true}).(*postgres.Dialector)}
+}
+
+var fixedCharType = regexp.MustCompile(`^char\((\d+)\)$`)
+
+// mysqlTypeMapping MySQL 风格类型 → PostgreSQL 类型
+var mysqlTypeMapping = map[string]string{
+	"double":     "double precision",
+	"json":       "jsonb", // 聊天元数据、工具调用、复刻元数据等 JSON 列使用 jsonb，便于索引与校验
+	"datetime":   "timestamptz",
+	"longtext":   "text",
+	"mediumtext": "text",
+	"tinytext":   "text",
+}
+
+// MapDataType 返回 PostgreSQL 下的列类型，无需转换时返回空字符串
+func MapDataType(dataType string) string {
+	lower := strings.ToLower(strings.TrimSpace(dataType))
+	if t, ok := mysqlTypeMapping[lower]; ok {
+		return t
+	}
+	// char(n) 在 PostgreSQL 中为 bpchar，与 GORM 的类型比较不一致会导致每次启动都改表，统一用 varchar(n)
+	if m := fixedCharType.FindStringSubmatch(lower); m != nil {
+		return "varchar(" + m[1] + ")"
+	}
+	return ""
+}
+
+func (d Dialector) DataTypeOf(field *schema.Field) string {
+	if t := MapDataType(string(field.DataType)); t != "" {
+		return t
+	}
+	return d.Dialector.DataTypeOf(field)
+}
+
+// Migrator 与官方实现一致，仅将方言替换为当前包装，使 DataTypeOf 的映射在建表和改表时生效
+func (d Dialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return postgres.Migrator{Migrator: migrator.Migrator{Config: migrator.Config{
+		DB:                          db,
+		Dialector:                   d,
+		CreateIndexAfterCreateTable: true,
+	}}}
+}
@@ -15,7 +15,8 @@ import {
   Tab, 
   Cell,
   Popup,
-  Icon
+  Icon,
+  Switch
 } from 'vant'
 import 'vant/lib/index.css'
 import * as ElementPlusIconsVue from '@element-plus/icons-vue'
@@ -42,6 +43,7 @@ app.use(Tab)
 app.use(Cell)
 app.use(Popup)
 app.use(Icon)
+app.use(Switch)
 
 app.use(createPinia())
 app.use(router)
@@ -35,6 +35,11 @@ const routes = [
     name: 'Login',
     component: getLoginComponent
   },
+  {
+    path: '/sso/callback',
+    name: 'SsoCallback',
+    component: () => import('../views/SsoCallback.vue')
+  },
 
   {
     path: '/openapi-docs',
@@ -163,6 +168,12 @@ const routes = [
             component: () => import('../views/admin/PoolStats.vue'),
             meta: { title: '资源池统计' }
           },
+          {
+            path: 'audit-logs',
+            name: 'AuditLogs',
+            component: () => import('../views/admin/AuditLogs.vue'),
+            meta: { title: '审计日志' }
+          },
           {
             path: 'global-roles',
             name: 'GlobalRoles',
@@ -256,13 +267,43 @@ const routes = [
         component: () => import('../views/user/AgentHistory.vue'),
         meta: { title: '聊天历史记录' }
       },
+      {
+        path: '/user/agents/:id/revisions',
+        name: 'AgentRevisions',
+        component: () => import('../views/user/AgentRevisions.vue'),
+        meta: { title: '智能体版本历史' }
+      },
 
+      {
+        path: '/user/organizations',
+        name: 'UserOrganizations',
+        component: () => import('../views/user/Organizations.vue'),
+        meta: { title: '组织与成员' }
+      },
       {
         path: '/user/api-tokens',
         name: 'UserAPITokens',
         component: () => import('../views/user/APITokens.vue'),
         meta: { title: 'API Token 管理' }
       },
+      {
+        path: '/user/webhooks',
+        name: 'UserWebhooks',
+        component: () => import('../views/user/Webhooks.vue'),
+        meta: { title: 'Webhook 管理' }
+      },
+      {
+        path: '/user/experiments',
+        name: 'UserExperiments',
+        component: () => import('../views/user/Experiments.vue'),
+        meta: { title: 'A/B 实验' }
+      },
+      {
+        path: '/user/prompt-templates',
+        name: 'UserPromptTemplates',
+        component: () => import('../views/user/PromptTemplates.vue'),
+        meta: { title: '提示词模板' }
+      },
       {
         path: '/user/knowledge-bases',
         name: 'UserKnowledgeBases',
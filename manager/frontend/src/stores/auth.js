@@ -10,16 +10,22 @@ export const useAuthStore = defineStore('auth', () => {
   const isAuthenticated = computed(() => !!token.value)
   const isAdmin = computed(() => user.value?.role === 'admin')
 
+  const setSession = (data) => {
+    const { token: newToken, user: userData } = data
+
+    token.value = newToken
+    user.value = userData
+
+    localStorage.setItem('token', newToken)
+    localStorage.setItem('user', JSON.stringify(userData))
+
+    return userData
+  }
+
   const login = async (credentials) => {
     try {
       const response = await api.post('/login', credentials)
-      const { token: newToken, user: userData } = response.data
-      
-      token.value = newToken
-      user.value = userData
-      
-      localStorage.setItem('token', newToken)
-      localStorage.setItem('user', JSON.stringify(userData))
+      const userData = setSession(response.data)
       
       return { success: true, user: userData }
     } catch (error) {
@@ -30,6 +36,32 @@ export const useAuthStore = defineStore('auth', () => {
     }
   }
 
+  // LDAP 登录，返回结构与本地登录一致
+  const loginWithLDAP = async (credentials) => {
+    try {
+      const response = await api.post('/auth/ldap/login', credentials)
+      return { success: true, user: setSession(response.data) }
+    } catch (error) {
+      return {
+        success: false,
+        message: error.response?.data?.error || '登录失败'
+      }
+    }
+  }
+
+  // OIDC 回调后用一次性交换码换取令牌
+  const exchangeSSOCode = async (code) => {
+    try {
+      const response = await api.post('/auth/sso/exchange', { code })
+      return { success: true, user: setSession(response.data) }
+    } catch (error) {
+      return {
+        success: false,
+        message: error.response?.data?.error || '单点登录失败'
+      }
+    }
+  }
+
   const register = async (userData) => {
     try {
       await api.post('/register', userData)
@@ -47,6 +79,7 @@ export const useAuthStore = defineStore('auth', () => {
     user.value = null
     localStorage.removeItem('token')
     localStorage.removeItem('user')
+    localStorage.removeItem('current_org_id')
   }
 
   const getProfile = async () => {
@@ -75,6 +108,8 @@ export const useAuthStore = defineStore('auth', () => {
     isAdmin,
     isValidating,
     login,
+    loginWithLDAP,
+    exchangeSSOCode,
     register,
     logout,
     getProfile
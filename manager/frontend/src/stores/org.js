@@ -0,0 +1,55 @@
+import { defineStore } from 'pinia'
+import { ref, computed } from 'vue'
+import api from '../utils/api'
+
+export const ORG_STORAGE_KEY = 'current_org_id'
+
+export const roleLabels = {
+  owner: '所有者',
+  editor: '编辑者',
+  operator: '运维',
+  viewer: '访客'
+}
+
+export const useOrgStore = defineStore('org', () => {
+  const orgs = ref([])
+  const currentOrgId = ref(Number(localStorage.getItem(ORG_STORAGE_KEY)) || null)
+
+  const currentOrg = computed(() => orgs.value.find((o) => o.id === currentOrgId.value) || null)
+  const can = (perm) => !!currentOrg.value?.permissions?.includes(perm)
+
+  const setCurrentOrg = (id) => {
+    currentOrgId.value = id || null
+    if (id) {
+      localStorage.setItem(ORG_STORAGE_KEY, String(id))
+    } else {
+      localStorage.removeItem(ORG_STORAGE_KEY)
+    }
+  }
+
+  const loadOrgs = async () => {
+    const res = await api.get('/orgs')
+    orgs.value = res.data.data || []
+    // 已退出或被移除的组织回退到个人组织
+    if (!currentOrg.value) {
+      const personal = orgs.value.find((o) => o.personal) || orgs.value[0]
+      setCurrentOrg(personal?.id)
+    }
+    return orgs.value
+  }
+
+  const clear = () => {
+    orgs.value = []
+    setCurrentOrg(null)
+  }
+
+  return {
+    orgs,
+    currentOrgId,
+    currentOrg,
+    can,
+    setCurrentOrg,
+    loadOrgs,
+    clear
+  }
+})
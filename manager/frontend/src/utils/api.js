@@ -13,6 +13,11 @@ api.interceptors.request.use(
     if (token) {
       config.headers.Authorization = `Bearer ${token}`
     }
+    // 当前组织，未设置时后端使用个人组织
+    const orgId = localStorage.getItem('current_org_id')
+    if (orgId && !config.headers['X-Org-ID']) {
+      config.headers['X-Org-ID'] = orgId
+    }
     return config
   },
   (error) => {
@@ -29,6 +34,7 @@ api.interceptors.response.use(
     if (error.response?.status === 401) {
       localStorage.removeItem('token')
       localStorage.removeItem('user')
+      localStorage.removeItem('current_org_id')
       window.location.href = '/login'
     } else {
       ElMessage.error(error.response?.data?.error || '请求失败')
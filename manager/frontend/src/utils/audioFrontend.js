@@ -0,0 +1,52 @@
+// 音频前端表单只暴露常用参数，其余参数（截止频率、预算等）沿用上一级配置
+export function defaultAudioFrontendForm() {
+  return {
+    mode: 'inherit',
+    high_pass: true,
+    noise_suppression: true,
+    over_subtraction: 2,
+    dereverb: false,
+    t60_ms: 500,
+    agc: true,
+    target_dbfs: -20
+  }
+}
+
+// parseAudioFrontend 将智能体或设备保存的 audio_frontend JSON 字符串转换为表单
+export function parseAudioFrontend(raw) {
+  const result = defaultAudioFrontendForm()
+  if (!raw || typeof raw !== 'string') {
+    return result
+  }
+  try {
+    const parsed = JSON.parse(raw) || {}
+    if (parsed.enabled === true) result.mode = 'on'
+    if (parsed.enabled === false) result.mode = 'off'
+    if (typeof parsed.high_pass?.enabled === 'boolean') result.high_pass = parsed.high_pass.enabled
+    if (typeof parsed.noise_suppression?.enabled === 'boolean') result.noise_suppression = parsed.noise_suppression.enabled
+    if (typeof parsed.noise_suppression?.over_subtraction === 'number') result.over_subtraction = parsed.noise_suppression.over_subtraction
+    if (typeof parsed.dereverb?.enabled === 'boolean') result.dereverb = parsed.dereverb.enabled
+    if (typeof parsed.dereverb?.t60_ms === 'number') result.t60_ms = parsed.dereverb.t60_ms
+    if (typeof parsed.agc?.enabled === 'boolean') result.agc = parsed.agc.enabled
+    if (typeof parsed.agc?.target_dbfs === 'number') result.target_dbfs = parsed.agc.target_dbfs
+  } catch (_) {
+    return defaultAudioFrontendForm()
+  }
+  return result
+}
+
+export function buildAudioFrontendPayload(cfg) {
+  if (cfg.mode === 'off') {
+    return { enabled: false }
+  }
+  if (cfg.mode !== 'on') {
+    return {}
+  }
+  return {
+    enabled: true,
+    high_pass: { enabled: cfg.high_pass },
+    noise_suppression: { enabled: cfg.noise_suppression, over_subtraction: cfg.over_subtraction },
+    dereverb: { enabled: cfg.dereverb, t60_ms: cfg.t60_ms },
+    agc: { enabled: cfg.agc, target_dbfs: cfg.target_dbfs }
+  }
+}
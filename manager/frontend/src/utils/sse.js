@@ -136,6 +136,10 @@ export const postJSONWithSSE = async ({
     if (token) {
       headers.Authorization = `Bearer ${token}`
     }
+    const orgId = localStorage.getItem('current_org_id')
+    if (orgId) {
+      headers['X-Org-ID'] = orgId
+    }
 
     const response = await fetch(url, {
       method: 'POST',
@@ -136,11 +136,21 @@ const siliconflowThinkingConfig = {
   budgetStep: 128
 }
 
+const geminiThinkingConfig = {
+  label: '深度思考',
+  options: booleanThinkingOptions,
+  showBudgetFor: ['enabled'],
+  budgetMin: 128,
+  budgetMax: 32768,
+  budgetStep: 128
+}
+
 const providerTypeMap = {
   openai: 'openai',
   ollama: 'ollama',
   azure: 'openai',
   anthropic: 'openai',
+  gemini: 'gemini',
   zhipu: 'openai',
   aliyun: 'openai',
   doubao: 'openai',
@@ -238,6 +248,21 @@ const catalog = {
       hint: '自定义模型未命中文档内列表。若使用手动思考，需要显式填写 budget_tokens；Adaptive 请仅在文档确认支持的模型上使用。'
     }
   },
+  gemini: {
+    quickUrl: 'https://generativelanguage.googleapis.com/v1beta',
+    modelPlaceholder: '请选择或输入模型名称',
+    modelHint: '通过原生 generateContent 接口调用，支持函数调用、图片输入和安全评级。关闭思考仅对 Flash 系列生效。',
+    models: [
+      createModel('gemini-2.5-pro', geminiThinkingConfig),
+      createModel('gemini-2.5-flash', geminiThinkingConfig),
+      createModel('gemini-2.5-flash-lite', geminiThinkingConfig),
+      createModel('gemini-2.0-flash', false)
+    ],
+    fallbackThinking: {
+      ...geminiThinkingConfig,
+      hint: '自定义模型未命中文档内列表。若模型支持 thinkingBudget，可按文档填写；留空时不会传该字段。'
+    }
+  },
   zhipu: {
     quickUrl: 'https://open.bigmodel.cn/api/paas/v4',
     modelPlaceholder: '请选择或输入模型名称',
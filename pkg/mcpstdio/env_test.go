@@ -0,0 +1,17 @@
+package mcpstdio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnv(t *testing.T) {
+	t.Setenv("PATH", "/usr/bin")
+	t.Setenv("DB_PASSWORD", "secret")
+
+	env := Env(map[string]string{"B": "2", " A ": "1", "": "x"})
+	assert.Contains(t, env, "PATH=/usr/bin")
+	assert.NotContains(t, env, "DB_PASSWORD=secret")
+	assert.Equal(t, []string{"A=1", "B=2"}, env[len(env)-2:])
+}
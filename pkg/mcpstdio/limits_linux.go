@@ -0,0 +1,65 @@
+//go:build linux
+
+package mcpstdio
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// limitShell 用于在 exec 目标命令前执行 ulimit 的 shell
+var limitShell = "/bin/sh"
+
+// WrapLimits 将命令包装为 sh -c 'ulimit ...; exec "$0" "$@"'，子进程从第一条指令起即受限。
+// 未配置限制或找不到 sh 时原样返回并返回 false，由调用方在启动后通过 prlimit 补设
+func WrapLimits(command string, args []string, limits Limits) (string, []string, bool) {
+	var ulimits []string
+	if limits.MaxMemoryMB > 0 {
+		ulimits = append(ulimits, fmt.Sprintf("ulimit -v %d", limits.MaxMemoryMB*1024))
+	}
+	if limits.MaxCPUSeconds > 0 {
+		ulimits = append(ulimits, fmt.Sprintf("ulimit -t %d", limits.MaxCPUSeconds))
+	}
+	if limits.MaxOpenFiles > 0 {
+		ulimits = append(ulimits, fmt.Sprintf("ulimit -n %d", limits.MaxOpenFiles))
+	}
+	if len(ulimits) == 0 {
+		return command, args, false
+	}
+	if _, err := os.Stat(limitShell); err != nil {
+		return command, args, false
+	}
+	script := strings.Join(ulimits, " && ") + ` && exec "$0" "$@"`
+	wrapped := append([]string{"-c", script, command}, args...)
+	return limitShell, wrapped, true
+}
+
+// ApplyLimits 通过 prlimit 为已启动的子进程设置资源上限
+func ApplyLimits(pid int, limits Limits) error {
+	set := func(resource int, value uint64, name string) error {
+		rlimit := &unix.Rlimit{Cur: value, Max: value}
+		if err := unix.Prlimit(pid, resource, rlimit, nil); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	}
+	if limits.MaxMemoryMB > 0 {
+		if err := set(unix.RLIMIT_AS, uint64(limits.MaxMemoryMB)*1024*1024, "max_memory_mb"); err != nil {
+			return err
+		}
+	}
+	if limits.MaxCPUSeconds > 0 {
+		if err := set(unix.RLIMIT_CPU, uint64(limits.MaxCPUSeconds), "max_cpu_seconds"); err != nil {
+			return err
+		}
+	}
+	if limits.MaxOpenFiles > 0 {
+		if err := set(unix.RLIMIT_NOFILE, uint64(limits.MaxOpenFiles), "max_open_files"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+//go:build linux
+
+package mcpstdio
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrapLimits(t *testing.T) {
+	command, args, ok := WrapLimits("uvx", []string{"mcp-server-fetch"}, Limits{})
+	assert.False(t, ok)
+	assert.Equal(t, "uvx", command)
+	assert.Equal(t, []string{"mcp-server-fetch"}, args)
+
+	// 目标进程 exec 前即已受限
+	command, args, ok = WrapLimits("/bin/sh", []string{"-c", "ulimit -n; ulimit -t"}, Limits{MaxOpenFiles: 256, MaxCPUSeconds: 30})
+	require.True(t, ok)
+	out, err := exec.Command(command, args...).Output()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"256", "30"}, strings.Fields(string(out)))
+}
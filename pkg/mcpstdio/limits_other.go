@@ -0,0 +1,18 @@
+//go:build !linux
+
+package mcpstdio
+
+import "fmt"
+
+// WrapLimits 非 Linux 平台不包装命令
+func WrapLimits(command string, args []string, limits Limits) (string, []string, bool) {
+	return command, args, false
+}
+
+// ApplyLimits 非 Linux 平台无法设置资源限制，配置了限制时返回错误
+func ApplyLimits(pid int, limits Limits) error {
+	if !limits.IsZero() {
+		return fmt.Errorf("当前平台不支持设置资源限制")
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Package mcpstdio 拉起 stdio MCP 服务器子进程时共用的环境变量与资源限制处理。
+// 主程序长期运行的 stdio 服务器与 manager 的工具探测使用同一实现，保证两边启动的进程环境一致。
+package mcpstdio
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// Limits stdio 子进程的资源限制，0 表示不限制（仅 Linux 生效）。
+// 限制为尽力而为：优先经 /bin/sh 的 ulimit 在 exec 前设置，找不到 sh 时退回启动后 prlimit，
+// 此时进程启动初期不受限
+type Limits struct {
+	MaxMemoryMB   int `json:"max_memory_mb,omitempty" mapstructure:"max_memory_mb"`     // 虚拟内存上限（RLIMIT_AS）
+	MaxCPUSeconds int `json:"max_cpu_seconds,omitempty" mapstructure:"max_cpu_seconds"` // 累计 CPU 时间上限（RLIMIT_CPU）
+	MaxOpenFiles  int `json:"max_open_files,omitempty" mapstructure:"max_open_files"`   // 文件描述符上限（RLIMIT_NOFILE）
+}
+
+// IsZero 是否未配置任何限制
+func (l Limits) IsZero() bool {
+	return l.MaxMemoryMB <= 0 && l.MaxCPUSeconds <= 0 && l.MaxOpenFiles <= 0
+}
+
+// inheritedEnv 子进程仅从本进程继承的环境变量，其余（代理、API Key 等）需在 env 中显式配置，
+// 避免数据库密码、JWT 密钥等服务端密钥泄露给第三方命令
+var inheritedEnv = []string{"PATH", "HOME", "LANG"}
+
+// Env 构造子进程环境变量：继承的变量在前，配置的变量按名称排序在后
+func Env(env map[string]string) []string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		if strings.TrimSpace(k) != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	ret := make([]string, 0, len(inheritedEnv)+len(keys))
+	for _, k := range inheritedEnv {
+		if v, ok := os.LookupEnv(k); ok {
+			ret = append(ret, k+"="+v)
+		}
+	}
+	for _, k := range keys {
+		ret = append(ret, strings.TrimSpace(k)+"="+env[k])
+	}
+	return ret
+}
@@ -0,0 +1,139 @@
+// Package prompttpl 渲染系统提示词模板。
+// 主程序每轮对话渲染一次，manager 的预览接口复用同一实现，保证预览与线上结果一致，因此只依赖标准库。
+//
+// 语法基于 text/template：
+//
+//	{{device_name}} {{owner_nickname}} {{location}} {{local_time}} {{weekday}} {{weather}} {{speaker_name}}
+//	{{if speaker_name}}正在和{{speaker_name}}对话{{else}}对方身份未知{{end}}
+//	{{if lt hour 12}}上午好{{end}}
+//	{{template "片段名"}}
+package prompttpl
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const rootName = "prompt"
+
+var weekdays = [...]string{"星期日", "星期一", "星期二", "星期三", "星期四", "星期五", "星期六"}
+
+// Vars 渲染变量，未设置的变量渲染为空字符串，可配合 if 做条件段落
+type Vars struct {
+	AssistantName string
+	DeviceID      string
+	DeviceName    string
+	OwnerNickname string
+	Location      string
+	SpeakerName   string    // 声纹识别到的说话人，未识别时为空
+	Now           time.Time // 设备所在时区的当前时间
+	// Weather 惰性获取天气，仅模板中引用 weather 时调用；为空时渲染为空字符串
+	Weather func() string
+}
+
+// Variables 支持的变量及说明，供前端提示
+var Variables = []struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}{
+	{"assistant_name", "智能体名称"},
+	{"device_id", "设备 ID"},
+	{"device_name", "设备名称"},
+	{"owner_nickname", "主人称呼"},
+	{"location", "设备所在地"},
+	{"local_time", "设备时区的当前时间，如 14:05"},
+	{"date", "设备时区的当前日期，如 2024年05月01日"},
+	{"weekday", "星期，如 星期三"},
+	{"hour", "当前小时（0-23），可用于 {{if lt hour 12}}"},
+	{"weather", "天气（由配置的天气工具实时获取）"},
+	{"speaker_name", "声纹识别到的说话人"},
+}
+
+func funcs(vars Vars) template.FuncMap {
+	now := vars.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	var weather *string
+	return template.FuncMap{
+		"assistant_name": func() string { return vars.AssistantName },
+		"device_id":      func() string { return vars.DeviceID },
+		"device_name":    func() string { return vars.DeviceName },
+		"owner_nickname": func() string { return vars.OwnerNickname },
+		"location":       func() string { return vars.Location },
+		"speaker_name":   func() string { return vars.SpeakerName },
+		"local_time":     func() string { return now.Format("15:04") },
+		"date":           func() string { return now.Format("2006年01月02日") },
+		"weekday":        func() string { return weekdays[now.Weekday()] },
+		"hour":           func() int { return now.Hour() },
+		"weather": func() string {
+			// 同一次渲染中多处引用只获取一次
+			if weather == nil {
+				s := ""
+				if vars.Weather != nil {
+					s = vars.Weather()
+				}
+				weather = &s
+			}
+			return *weather
+		},
+	}
+}
+
+func parse(text string, snippets map[string]string, fm template.FuncMap) (*template.Template, error) {
+	root, err := template.New(rootName).Funcs(fm).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("解析提示词模板失败: %w", err)
+	}
+	for name, body := range snippets {
+		if name == rootName {
+			continue
+		}
+		if _, err := root.New(name).Parse(body); err != nil {
+			return nil, fmt.Errorf("解析提示词片段 %s 失败: %w", name, err)
+		}
+	}
+	return root, nil
+}
+
+// IsTemplate 判断文本是否包含模板语法，不包含时无需渲染
+func IsTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+// Validate 校验模板语法及引用的变量；片段是否存在在渲染时才会检查
+func Validate(text string, snippets map[string]string) error {
+	_, err := parse(text, snippets, funcs(Vars{}))
+	return err
+}
+
+// Render 渲染模板；snippets 为可通过 {{template "名称"}} 引用的共享片段
+func Render(text string, snippets map[string]string, vars Vars) (string, error) {
+	if !IsTemplate(text) {
+		return text, nil
+	}
+	tmpl, err := parse(text, snippets, funcs(vars))
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, nil); err != nil {
+		return "", fmt.Errorf("渲染提示词模板失败: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// NowIn 返回指定时区的当前时间，时区为空或无效时使用本地时区
+func NowIn(timezone string) time.Time {
+	now := time.Now()
+	if timezone == "" {
+		return now
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return now
+	}
+	return now.In(loc)
+}
@@ -0,0 +1,63 @@
+package prompttpl
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	weatherCalls := 0
+	vars := Vars{
+		AssistantName: "小智",
+		DeviceName:    "客厅音箱",
+		OwnerNickname: "小明",
+		Location:      "杭州",
+		Now:           now,
+		Weather: func() string {
+			weatherCalls++
+			return "晴 25℃"
+		},
+	}
+	snippets := map[string]string{"礼貌": "请称呼对方为{{owner_nickname}}。"}
+
+	text := `我是{{assistant_name}}，在{{location}}的{{device_name}}里。{{weekday}} {{local_time}}，{{weather}}/{{weather}}。` +
+		`{{if lt hour 12}}上午{{else}}下午{{end}}{{if speaker_name}}，正在和{{speaker_name}}说话{{end}}。{{template "礼貌"}}`
+	got, err := Render(text, snippets, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "我是小智，在杭州的客厅音箱里。星期三 09:30，晴 25℃/晴 25℃。上午。请称呼对方为小明。"
+	if got != want {
+		t.Fatalf("got %q\nwant %q", got, want)
+	}
+	if weatherCalls != 1 {
+		t.Fatalf("weather fetched %d times, want 1", weatherCalls)
+	}
+
+	vars.SpeakerName = "妈妈"
+	got, _ = Render("{{if speaker_name}}你好{{speaker_name}}{{end}}", nil, vars)
+	if got != "你好妈妈" {
+		t.Fatalf("speaker section = %q", got)
+	}
+}
+
+func TestRenderPlainTextAndErrors(t *testing.T) {
+	plain := "没有模板语法的提示词 {单括号}"
+	if got, err := Render(plain, nil, Vars{}); err != nil || got != plain {
+		t.Fatalf("plain text changed: %q, %v", got, err)
+	}
+	if got, _ := Render("{{weather}}", nil, Vars{}); got != "" {
+		t.Fatalf("weather without provider = %q", got)
+	}
+	if err := Validate("{{unknown_var}}", nil); err == nil {
+		t.Fatal("expected error for unknown variable")
+	}
+	if err := Validate("{{if device_name}}", nil); err == nil {
+		t.Fatal("expected error for unclosed if")
+	}
+	if _, err := Render(`{{template "missing"}}`, nil, Vars{}); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("expected missing snippet error, got %v", err)
+	}
+}